@@ -25,31 +25,35 @@ var addCmd = &cobra.Command{
 }
 
 type addCmdConfig struct {
-	force   bool
-	prompt  bool
-	options chezmoi.AddOptions
+	SecretCheck   bool
+	force         bool
+	noSecretCheck bool
+	prompt        bool
+	options       chezmoi.AddOptions
 }
 
 func init() {
 	rootCmd.AddCommand(addCmd)
 
 	persistentFlags := addCmd.PersistentFlags()
-	persistentFlags.BoolVarP(&config.add.options.Empty, "empty", "e", false, "add empty files")
-	persistentFlags.BoolVar(&config.add.options.Encrypt, "encrypt", false, "encrypt files")
-	persistentFlags.BoolVarP(&config.add.force, "force", "f", false, "overwrite source state, even if template would be lost")
-	persistentFlags.BoolVarP(&config.add.options.Exact, "exact", "x", false, "add directories exactly")
-	persistentFlags.BoolVarP(&config.add.prompt, "prompt", "p", false, "prompt before adding")
-	persistentFlags.BoolVarP(&config.add.options.Recursive, "recursive", "r", false, "recurse in to subdirectories")
-	persistentFlags.BoolVarP(&config.add.options.Template, "template", "T", false, "add files as templates")
-	persistentFlags.BoolVarP(&config.add.options.AutoTemplate, "autotemplate", "a", false, "auto generate the template when adding files as templates")
-
-	markRemainingZshCompPositionalArgumentsAsFiles(addCmd, 1)
+	persistentFlags.BoolVar(&config.Add.options.Create, "create", false, "add files that are only created if they do not exist")
+	persistentFlags.BoolVarP(&config.Add.options.Empty, "empty", "e", false, "add empty files")
+	persistentFlags.BoolVar(&config.Add.options.Encrypt, "encrypt", false, "encrypt files")
+	persistentFlags.BoolVarP(&config.Add.force, "force", "f", false, "overwrite source state, even if template would be lost")
+	persistentFlags.BoolVarP(&config.Add.options.Exact, "exact", "x", false, "add directories exactly")
+	persistentFlags.BoolVar(&config.Add.noSecretCheck, "no-secret-check", false, "do not check for secrets in plaintext")
+	persistentFlags.BoolVar(&config.Add.options.NoSuffix, "no-suffix", false, "add templates without the .tmpl suffix")
+	persistentFlags.BoolVarP(&config.Add.prompt, "interactive", "i", false, "prompt before adding each file")
+	persistentFlags.BoolVarP(&config.Add.prompt, "prompt", "p", false, "prompt before adding each file")
+	persistentFlags.BoolVarP(&config.Add.options.Recursive, "recursive", "r", true, "recurse in to subdirectories")
+	persistentFlags.BoolVarP(&config.Add.options.Template, "template", "T", false, "add files as templates")
+	persistentFlags.BoolVarP(&config.Add.options.AutoTemplate, "autotemplate", "a", false, "auto generate the template when adding files as templates")
 }
 
 func (c *Config) runAddCmd(cmd *cobra.Command, args []string) (err error) {
 	// Make --autotemplate imply --template.
-	if c.add.options.AutoTemplate {
-		c.add.options.Template = true
+	if c.Add.options.AutoTemplate {
+		c.Add.options.Template = true
 	}
 
 	ts, err := c.getTargetState(nil)
@@ -71,20 +75,52 @@ func (c *Config) runAddCmd(cmd *cobra.Command, args []string) (err error) {
 		}
 	}()
 	for _, arg := range args {
-		path, err := filepath.Abs(arg)
+		path, err := c.getTargetPath(ts, arg)
 		if err != nil {
 			return err
 		}
-		if c.add.options.Recursive {
+		// Directories added with --encrypt are added as a single encrypted
+		// bundle, so their contents are not added separately.
+		recursive := c.Add.options.Recursive
+		if recursive && c.Add.options.Encrypt {
+			if info, err := c.fs.Stat(path); err == nil && info.IsDir() {
+				recursive = false
+			}
+		}
+		if recursive {
+			// When prompting, directories are only added when the first entry
+			// inside them is chosen, so pendingDirs holds the directories that
+			// have been walked but not yet added.
+			type pendingDir struct {
+				path string
+				info os.FileInfo
+			}
+			var pendingDirs []pendingDir
+			addPendingDirs := func(path string) error {
+				for _, dir := range pendingDirs {
+					if !strings.HasPrefix(path, dir.path+string(filepath.Separator)) {
+						continue
+					}
+					if err := ts.Add(c.fs, c.Add.options, dir.path, dir.info, c.Follow, c.mutator); err != nil {
+						return err
+					}
+				}
+				pendingDirs = nil
+				return nil
+			}
 			if err := vfs.Walk(c.fs, path, func(path string, info os.FileInfo, err error) error {
 				if err != nil {
 					return err
 				}
 				if ts.TargetIgnore.Match(strings.TrimPrefix(path, destDirPrefix)) {
 					cmd.Printf("warning: %s: skipping file ignored by .chezmoiignore\n", path)
+					// Do not add anything inside ignored directories.
+					if info.IsDir() {
+						return filepath.SkipDir
+					}
 					return nil
 				}
-				if !c.add.force {
+				if !c.Add.force {
 					entry, err := ts.Get(c.fs, path)
 					if err != nil && !os.IsNotExist(err) {
 						return err
@@ -93,9 +129,19 @@ func (c *Config) runAddCmd(cmd *cobra.Command, args []string) (err error) {
 						cmd.Printf("warning: %s: skipping file generated by template, use --force to force\n", path)
 						return nil
 					}
+					if file, ok := entry.(*chezmoi.File); ok && file.Modify {
+						cmd.Printf("warning: %s: skipping file generated by modify script, use --force to force\n", path)
+						return nil
+					}
 				}
-				if c.add.prompt {
-					choice, err := c.prompt(fmt.Sprintf("Add %s", path), "ynqa")
+				if c.Add.prompt {
+					// Only prompt for files. Directories are added as the
+					// parents of the files that are chosen.
+					if info.IsDir() {
+						pendingDirs = append(pendingDirs, pendingDir{path: path, info: info})
+						return nil
+					}
+					choice, err := c.prompt(fmt.Sprintf("Add %s", path), "ynqa", 'n')
 					if err != nil {
 						return err
 					}
@@ -106,10 +152,20 @@ func (c *Config) runAddCmd(cmd *cobra.Command, args []string) (err error) {
 					case 'q':
 						panic(&quit) // abort vfs.Walk by panicking
 					case 'a':
-						c.add.prompt = false
+						c.Add.prompt = false
+					}
+				}
+				if info.Mode().IsRegular() {
+					if ok, err := c.confirmNoSecrets(path, strings.TrimPrefix(path, destDirPrefix)); err != nil {
+						return err
+					} else if !ok {
+						return nil
 					}
 				}
-				return ts.Add(c.fs, c.add.options, path, info, c.Follow, c.mutator)
+				if err := addPendingDirs(path); err != nil {
+					return err
+				}
+				return ts.Add(c.fs, c.Add.options, path, info, c.Follow, c.mutator)
 			}); err != nil {
 				return err
 			}
@@ -118,7 +174,7 @@ func (c *Config) runAddCmd(cmd *cobra.Command, args []string) (err error) {
 				cmd.Printf("warning: %s: skipping file ignored by .chezmoiignore\n", path)
 				continue
 			}
-			if !c.add.force {
+			if !c.Add.force {
 				entry, err := ts.Get(c.fs, path)
 				if err != nil && !os.IsNotExist(err) {
 					return err
@@ -127,9 +183,13 @@ func (c *Config) runAddCmd(cmd *cobra.Command, args []string) (err error) {
 					cmd.Printf("warning: %s: skipping file generated by template, use --force to force\n", path)
 					continue
 				}
+				if file, ok := entry.(*chezmoi.File); ok && file.Modify {
+					cmd.Printf("warning: %s: skipping file generated by modify script, use --force to force\n", path)
+					continue
+				}
 			}
-			if c.add.prompt {
-				choice, err := c.prompt(fmt.Sprintf("Add %s", path), "ynqa")
+			if c.Add.prompt {
+				choice, err := c.prompt(fmt.Sprintf("Add %s", path), "ynqa", 'n')
 				if err != nil {
 					return err
 				}
@@ -140,10 +200,15 @@ func (c *Config) runAddCmd(cmd *cobra.Command, args []string) (err error) {
 				case 'q':
 					return nil
 				case 'a':
-					c.add.prompt = false
+					c.Add.prompt = false
 				}
 			}
-			if err := ts.Add(c.fs, c.add.options, path, nil, c.Follow, c.mutator); err != nil {
+			if ok, err := c.confirmNoSecrets(path, strings.TrimPrefix(path, destDirPrefix)); err != nil {
+				return err
+			} else if !ok {
+				continue
+			}
+			if err := ts.Add(c.fs, c.Add.options, path, nil, c.Follow, c.mutator); err != nil {
 				return err
 			}
 		}
@@ -0,0 +1,77 @@
+// +build !windows
+
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+func TestAddPerm(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".local/share/chezmoi": &vfst.Dir{Perm: 0o700},
+			".bashrc":              &vfst.File{Perm: 0o644, Contents: []byte("# bashrc\n")},
+			".private":             &vfst.File{Perm: 0o600, Contents: []byte("# private\n")},
+			".shared":              &vfst.File{Perm: 0o640, Contents: []byte("# shared\n")},
+			"bin/tool":             &vfst.File{Perm: 0o750, Contents: []byte("#!/bin/sh\n")},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	require.NoError(t, fs.Chmod("/home/user/bin/tool", os.ModeSetuid|0o750))
+	c := newTestConfig(fs)
+	assert.NoError(t, c.runAddCmd(nil, []string{
+		"/home/user/.bashrc",
+		"/home/user/.private",
+		"/home/user/.shared",
+		"/home/user/bin/tool",
+	}))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.local/share/chezmoi/dot_bashrc",
+			vfst.TestContentsString("# bashrc\n"),
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/private_dot_private",
+			vfst.TestContentsString("# private\n"),
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/perm_0640_dot_shared",
+			vfst.TestContentsString("# shared\n"),
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/bin/perm_4750_tool",
+			vfst.TestContentsString("#!/bin/sh\n"),
+		),
+	)
+}
+
+func TestAddNestedPrivateDir(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".local/share/chezmoi": &vfst.Dir{Perm: 0o700},
+			".ssh": &vfst.Dir{
+				Perm: 0o700,
+				Entries: map[string]interface{}{
+					"config": &vfst.File{Perm: 0o644, Contents: []byte("# config\n")},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	c := newTestConfig(fs)
+	assert.NoError(t, c.runAddCmd(nil, []string{"/home/user/.ssh/config"}))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.local/share/chezmoi/private_dot_ssh",
+			vfst.TestIsDir,
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/private_dot_ssh/config",
+			vfst.TestContentsString("# config\n"),
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/private_dot_ssh/.keep",
+			vfst.TestDoesNotExist,
+		),
+	)
+}
@@ -1,12 +1,16 @@
 package cmd
 
 import (
+	"bytes"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	vfs "github.com/twpayne/go-vfs"
 	"github.com/twpayne/go-vfs/vfst"
 
 	"github.com/twpayne/chezmoi/internal/chezmoi"
@@ -185,6 +189,24 @@ func TestAddCommand(t *testing.T) {
 				),
 			},
 		},
+		{
+			name: "add_create",
+			args: []string{"/home/user/.config/foo/config"},
+			add: addCmdConfig{
+				options: chezmoi.AddOptions{
+					Create: true,
+				},
+			},
+			root: map[string]interface{}{
+				"/home/user/.config/foo/config": "initial\n",
+			},
+			tests: []vfst.Test{
+				vfst.TestPath("/home/user/.local/share/chezmoi/dot_config/foo/create_config",
+					vfst.TestModeIsRegular,
+					vfst.TestContentsString("initial\n"),
+				),
+			},
+		},
 		{
 			name: "add_recursive",
 			args: []string{"/home/user/.config"},
@@ -205,6 +227,77 @@ func TestAddCommand(t *testing.T) {
 				),
 			},
 		},
+		{
+			name: "add_not_recursive",
+			args: []string{"/home/user/.config"},
+			root: map[string]interface{}{
+				"/home/user":                             &vfst.Dir{Perm: 0o755},
+				"/home/user/.local/share/chezmoi":        &vfst.Dir{Perm: 0o700},
+				"/home/user/.config/micro/settings.json": "{}",
+			},
+			tests: []vfst.Test{
+				vfst.TestPath("/home/user/.local/share/chezmoi/dot_config",
+					vfst.TestIsDir,
+				),
+				vfst.TestPath("/home/user/.local/share/chezmoi/dot_config/.keep",
+					vfst.TestModeIsRegular,
+				),
+				vfst.TestPath("/home/user/.local/share/chezmoi/dot_config/micro",
+					vfst.TestDoesNotExist,
+				),
+			},
+		},
+		{
+			name: "add_recursive_ignored",
+			args: []string{"/home/user/.config"},
+			add: addCmdConfig{
+				options: chezmoi.AddOptions{
+					Recursive: true,
+				},
+			},
+			root: map[string]interface{}{
+				"/home/user":                                     &vfst.Dir{Perm: 0o755},
+				"/home/user/.local/share/chezmoi":                &vfst.Dir{Perm: 0o700},
+				"/home/user/.local/share/chezmoi/.chezmoiignore": ".config/cache\n",
+				"/home/user/.config/micro/settings.json":         "{}",
+				"/home/user/.config/cache/data":                  "data",
+			},
+			tests: []vfst.Test{
+				vfst.TestPath("/home/user/.local/share/chezmoi/dot_config/micro/settings.json",
+					vfst.TestModeIsRegular,
+					vfst.TestContentsString("{}"),
+				),
+				vfst.TestPath("/home/user/.local/share/chezmoi/dot_config/cache",
+					vfst.TestDoesNotExist,
+				),
+			},
+		},
+		{
+			name: "add_nested_directory_not_exact",
+			args: []string{"/home/user/.config/micro/settings.json"},
+			add: addCmdConfig{
+				options: chezmoi.AddOptions{
+					Exact: true,
+				},
+			},
+			root: map[string]interface{}{
+				"/home/user":                             &vfst.Dir{Perm: 0o755},
+				"/home/user/.local/share/chezmoi":        &vfst.Dir{Perm: 0o700},
+				"/home/user/.config/micro/settings.json": "{}",
+			},
+			tests: []vfst.Test{
+				vfst.TestPath("/home/user/.local/share/chezmoi/dot_config/micro/settings.json",
+					vfst.TestModeIsRegular,
+					vfst.TestContentsString("{}"),
+				),
+				vfst.TestPath("/home/user/.local/share/chezmoi/dot_config/.keep",
+					vfst.TestDoesNotExist,
+				),
+				vfst.TestPath("/home/user/.local/share/chezmoi/dot_config/micro/.keep",
+					vfst.TestDoesNotExist,
+				),
+			},
+		},
 		{
 			name: "add_nested_directory",
 			args: []string{"/home/user/.config/micro/settings.json"},
@@ -562,6 +655,52 @@ func TestAddCommand(t *testing.T) {
 	}
 }
 
+func TestAddNoSuffix(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".local/share/chezmoi": &vfst.Dir{Perm: 0o700},
+			".gitconfig":           "[user]\n\temail = john.smith@company.com\n",
+			".hgrc":                "[ui]\nusername = john.smith@company.com\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	stdout := &bytes.Buffer{}
+	c := newTestConfig(
+		fs,
+		withStdout(stdout),
+		withData(map[string]interface{}{
+			"email": "john.smith@company.com",
+		}),
+		withAddCmdConfig(addCmdConfig{
+			options: chezmoi.AddOptions{
+				AutoTemplate: true,
+				NoSuffix:     true,
+			},
+		}),
+	)
+	c.TemplateGlobs = []string{"dot_gitconfig"}
+	require.NoError(t, c.runAddCmd(nil, []string{"/home/user/.gitconfig"}))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.local/share/chezmoi/dot_gitconfig",
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("[user]\n\temail = {{ .email }}\n"),
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/dot_gitconfig.tmpl",
+			vfst.TestDoesNotExist,
+		),
+	)
+	require.NoError(t, c.runCatCmd(nil, []string{"/home/user/.gitconfig"}))
+	assert.Equal(t, "[user]\n\temail = john.smith@company.com\n", stdout.String())
+
+	assert.Error(t, c.runAddCmd(nil, []string{"/home/user/.hgrc"}))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.local/share/chezmoi/dot_hgrc",
+			vfst.TestDoesNotExist,
+		),
+	)
+}
+
 func TestIssue192(t *testing.T) {
 	root := []interface{}{
 		map[string]interface{}{
@@ -589,3 +728,169 @@ func TestIssue192(t *testing.T) {
 		),
 	)
 }
+
+func TestAddSourceDirs(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user":                   &vfst.Dir{Perm: 0o755},
+		"/home/user/.bashrc":           "# work\n",
+		"/home/user/.config/git":       "# git\n",
+		"/home/user/public":            &vfst.Dir{Perm: 0o700},
+		"/home/user/public/dot_bashrc": "# public\n",
+		"/home/user/public/dot_config": &vfst.Dir{Perm: 0o755},
+		"/home/user/work":              &vfst.Dir{Perm: 0o700},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	c := newTestConfig(fs)
+	c.SourceDir = "/home/user/work"
+	c.SourceDirs = []string{"/home/user/public", "/home/user/work"}
+	assert.NoError(t, c.runAddCmd(nil, []string{"/home/user/.bashrc", "/home/user/.config/git"}))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/public/dot_bashrc",
+			vfst.TestContentsString("# public\n"),
+		),
+		vfst.TestPath("/home/user/work/dot_bashrc",
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("# work\n"),
+		),
+		vfst.TestPath("/home/user/public/dot_config/git",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/work/dot_config/git",
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("# git\n"),
+		),
+	)
+}
+
+func TestAddInteractive(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		stdin         string
+		dryRun        bool
+		template      bool
+		expectedAdded []string
+	}{
+		{
+			name:          "some",
+			stdin:         "y\nn\ny\ny\n",
+			expectedAdded: []string{"a", "c", "functions/d"},
+		},
+		{
+			name:  "quit",
+			stdin: "n\nq\n",
+		},
+		{
+			name:          "add_after_quit",
+			stdin:         "y\nq\n",
+			expectedAdded: []string{"a"},
+		},
+		{
+			name:          "all",
+			stdin:         "n\na\n",
+			expectedAdded: []string{"b", "c", "functions/d"},
+		},
+		{
+			name:   "dry_run",
+			stdin:  "y\ny\ny\ny\n",
+			dryRun: true,
+		},
+		{
+			name:          "template",
+			stdin:         "y\nn\nn\nn\n",
+			template:      true,
+			expectedAdded: []string{"a.tmpl"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+				"/home/user":                      &vfst.Dir{Perm: 0o755},
+				"/home/user/.local/share/chezmoi": &vfst.Dir{Perm: 0o700},
+				"/home/user/.config/fish": map[string]interface{}{
+					"a":           "# a\n",
+					"b":           "# b\n",
+					"c":           "# c\n",
+					"functions/d": "# d\n",
+				},
+			})
+			require.NoError(t, err)
+			defer cleanup()
+			stderr := &bytes.Buffer{}
+			options := []configOption{
+				withStdin(strings.NewReader(tc.stdin)),
+				withStderr(stderr),
+				withAddCmdConfig(addCmdConfig{
+					prompt: true,
+					options: chezmoi.AddOptions{
+						Recursive: true,
+						Template:  tc.template,
+					},
+				}),
+			}
+			if tc.dryRun {
+				options = append(options, withMutator(chezmoi.NullMutator{}))
+			}
+			c := newTestConfig(fs, options...)
+			require.NoError(t, c.runAddCmd(nil, []string{"/home/user/.config/fish"}))
+
+			var added []string
+			sourceDir := "/home/user/.local/share/chezmoi/dot_config/fish"
+			if _, err := fs.Stat(sourceDir); err == nil {
+				require.NoError(t, vfs.Walk(fs, sourceDir, func(path string, info os.FileInfo, err error) error {
+					if err != nil {
+						return err
+					}
+					if !info.Mode().IsRegular() {
+						return nil
+					}
+					relPath, err := filepath.Rel(sourceDir, path)
+					if err != nil {
+						return err
+					}
+					added = append(added, filepath.ToSlash(relPath))
+					return nil
+				}))
+			}
+			assert.Equal(t, tc.expectedAdded, added)
+			if tc.dryRun {
+				assert.Equal(t, 4, strings.Count(stderr.String(), "Add /home/user/.config/fish/"))
+			}
+		})
+	}
+}
+
+func TestAddPromptDirAttributes(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user":                      &vfst.Dir{Perm: 0o755},
+		"/home/user/.local/share/chezmoi": &vfst.Dir{Perm: 0o700},
+		"/home/user/.config/fish": map[string]interface{}{
+			"a":           "# a\n",
+			"empty":       &vfst.Dir{Perm: 0o755},
+			"functions/d": "# d\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	c := newTestConfig(fs,
+		withStdin(strings.NewReader("n\ny\n")),
+		withAddCmdConfig(addCmdConfig{
+			prompt: true,
+			options: chezmoi.AddOptions{
+				Exact:     true,
+				Recursive: true,
+			},
+		}),
+	)
+	require.NoError(t, c.runAddCmd(nil, []string{"/home/user/.config/fish"}))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.local/share/chezmoi/dot_config/exact_fish/exact_functions/d",
+			vfst.TestContentsString("# d\n"),
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/dot_config/exact_fish/a",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/dot_config/exact_fish/exact_empty",
+			vfst.TestDoesNotExist,
+		),
+	)
+}
@@ -0,0 +1,71 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+func TestAddEncryptAge(t *testing.T) {
+	// fakeAge "encrypts" and "decrypts" its standard input with rot13.
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	fakeAge := filepath.Join(tempDir, "age")
+	require.NoError(t, ioutil.WriteFile(fakeAge, []byte("#!/bin/sh\ntr a-zA-Z n-za-mN-ZA-M\n"), 0o755))
+
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.secret":              "secret\n",
+		"/home/user/.local/share/chezmoi": &vfst.Dir{Perm: 0o700},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	newConfig := func(options ...configOption) *Config {
+		c := newTestConfig(fs, options...)
+		c.Encryption.Method = "age"
+		c.Age.Command = fakeAge
+		c.Age.Identity = "/home/user/key.txt"
+		c.Age.Recipient = "age1recipient"
+		return c
+	}
+
+	c := newConfig()
+	c.Add.options.Encrypt = true
+	require.NoError(t, c.runAddCmd(nil, []string{"/home/user/.secret"}))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.local/share/chezmoi/encrypted_private_dot_secret",
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("frperg\n"),
+		),
+	)
+
+	stdout := &bytes.Buffer{}
+	c = newConfig(withStdout(stdout))
+	require.NoError(t, c.runCatCmd(nil, []string{"/home/user/.secret"}))
+	assert.Equal(t, "secret\n", stdout.String())
+}
+
+func TestUnknownEncryptionMethod(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": &vfst.Dir{Perm: 0o700},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	c := newTestConfig(fs)
+	c.Encryption.Method = "rot13"
+	_, err = c.getTargetState(nil)
+	assert.EqualError(t, err, "rot13: unknown encryption.method")
+}
@@ -1,7 +1,24 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/spf13/cobra"
+	vfs "github.com/twpayne/go-vfs"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
 )
 
 var applyCmd = &cobra.Command{
@@ -13,13 +30,125 @@ var applyCmd = &cobra.Command{
 	RunE:    config.runApplyCmd,
 }
 
+type applyCmdConfig struct {
+	Backup          bool
+	BackupDir       string
+	BackupKeep      int
+	ClearImmutable  bool
+	noBackup        bool
+	noPrune         bool
+	prune           bool
+	resume          bool
+	rewriteSymlinks bool
+	to              string
+	withScripts     bool
+	rewriteLinkname func(string) string
+}
+
+// An applyLogConfig configures the log of operations written by commands that
+// apply the target state.
+type applyLogConfig struct {
+	file    string
+	format  string
+	mutator *chezmoi.LogMutator
+}
+
+// A remoteConfig configures the use of a remote repository as a temporary
+// source directory.
+type remoteConfig struct {
+	url          string
+	allowScripts bool
+}
+
+// logFormats are the values accepted by --log-format.
+var logFormats = []string{"json"}
+
+// An applyProgress records the entries completed by an apply so that a failed
+// apply can be resumed.
+type applyProgress struct {
+	StateHash string   `json:"stateHash"`
+	Completed []string `json:"completed"`
+}
+
+var applyProgressKey = []byte("progress")
+
+// applyProgressInterval is the number of targets completed between recordings
+// of the progress of an apply, so that an interrupted apply can be resumed
+// without writing the persistent state after every target.
+const applyProgressInterval = 100
+
+// An appliedSource records the commit of the source directory that was last
+// applied.
+type appliedSource struct {
+	Commit string    `json:"commit"`
+	Dirty  bool      `json:"dirty"`
+	Time   time.Time `json:"time"`
+}
+
 func init() {
 	rootCmd.AddCommand(applyCmd)
 
-	markRemainingZshCompPositionalArgumentsAsFiles(applyCmd, 1)
+	persistentFlags := applyCmd.PersistentFlags()
+	persistentFlags.BoolVar(&config.Apply.noBackup, "no-backup", false, "do not back up changed targets")
+	persistentFlags.BoolVar(&config.Apply.noPrune, "no-prune", false, "do not remove targets removed from the source state")
+	persistentFlags.BoolVar(&config.Apply.prune, "prune", false, "remove targets removed from the source state without prompting")
+	persistentFlags.BoolVar(&config.Apply.resume, "resume", false, "skip entries completed by the previous failed apply")
+	persistentFlags.BoolVar(&config.Apply.rewriteSymlinks, "rewrite-symlinks", false, "with --to, rewrite absolute symlink targets in the destination directory")
+	persistentFlags.BoolVar(&config.symlink, "symlink", false, "apply plain files as symlinks to their source files")
+	persistentFlags.StringVar(&config.Apply.to, "to", "", "apply to a staging directory instead of the destination directory")
+	persistentFlags.BoolVar(&config.Apply.withScripts, "with-scripts", false, "with --to, run scripts")
+	persistentFlags.StringArrayVar(&config.exclude, "exclude", nil, "exclude entry types or targets matching pattern")
+	persistentFlags.BoolVar(&config.excludeEncrypted, "exclude-encrypted", false, "exclude encrypted targets")
+	persistentFlags.StringSliceVarP(&config.include, "include", "i", []string{"all"}, "include entry types")
+	addApplyLogFlags(applyCmd)
+	addRemoteFlags(applyCmd)
+	addTrustFlag(applyCmd)
+	panicOnError(applyCmd.RegisterFlagCompletionFunc("include", completeCommaSeparatedWords(entryTypeWords)))
+}
+
+// addApplyLogFlags adds the --log-file and --log-format flags to cmd.
+func addApplyLogFlags(cmd *cobra.Command) {
+	persistentFlags := cmd.PersistentFlags()
+	persistentFlags.StringVar(&config.applyLog.file, "log-file", "", "append a log of operations to file")
+	persistentFlags.StringVar(&config.applyLog.format, "log-format", "json", "log format")
+	panicOnError(cmd.RegisterFlagCompletionFunc("log-format", completeWords(logFormats)))
+}
+
+// addRemoteFlags adds the --remote and --allow-scripts flags, and the clone
+// flags, to cmd.
+func addRemoteFlags(cmd *cobra.Command) {
+	persistentFlags := cmd.PersistentFlags()
+	persistentFlags.StringVar(&config.remote.url, "remote", "", "use a temporary clone of repo as the source directory")
+	persistentFlags.BoolVar(&config.remote.allowScripts, "allow-scripts", false, "allow scripts from the remote repo to run")
+	addCloneFlags(cmd)
 }
 
 func (c *Config) runApplyCmd(cmd *cobra.Command, args []string) error {
+	if c.Apply.to != "" {
+		if err := c.useStagingDestDir(c.Apply.to); err != nil {
+			return err
+		}
+	} else if c.Apply.rewriteSymlinks || c.Apply.withScripts {
+		return errors.New("--rewrite-symlinks and --with-scripts require --to")
+	}
+
+	if c.remote.url != "" {
+		remoteSourceDir, err := c.makeTempClone(c.remote.url, "chezmoi-remote")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = c.fs.RemoveAll(remoteSourceDir)
+		}()
+		c.useRemoteSourceDir(remoteSourceDir)
+		// Trust in a remote repo is never stored, so it is only trusted with
+		// --trust.
+		if !c.trust.trust {
+			c.restrictSourceState(c.remote.url)
+		}
+		return c.applyArgs(args, chezmoi.NewMemoryPersistentState())
+	}
+
 	persistentState, err := c.getPersistentState(nil)
 	if err != nil {
 		return err
@@ -28,3 +157,566 @@ func (c *Config) runApplyCmd(cmd *cobra.Command, args []string) error {
 
 	return c.applyArgs(args, persistentState)
 }
+
+// getApplyProgress returns the progress of the current apply of ts. If
+// resuming and the previous apply of the same target state failed or was
+// interrupted then the entries that it recorded as completed are included. ts
+// is only hashed when resuming, or when the progress is recorded.
+func (c *Config) getApplyProgress(ts *chezmoi.TargetState, persistentState chezmoi.PersistentState) (*applyProgress, error) {
+	progress := &applyProgress{}
+	if !c.Apply.resume {
+		return progress, nil
+	}
+	stateHash, err := ts.Hash(c.fs)
+	if err != nil {
+		return nil, err
+	}
+	progress.StateHash = hex.EncodeToString(stateHash)
+	data, err := persistentState.Get(c.applyProgressBucket, applyProgressKey)
+	if err != nil || data == nil {
+		return progress, err
+	}
+	var previousProgress applyProgress
+	if err := json.Unmarshal(data, &previousProgress); err != nil {
+		return progress, nil
+	}
+	if previousProgress.StateHash == progress.StateHash {
+		progress.Completed = previousProgress.Completed
+	}
+	return progress, nil
+}
+
+// recordApplyProgress records progress, the progress of a failed or unfinished
+// apply of ts, in persistentState so that the apply can be resumed.
+func (c *Config) recordApplyProgress(ts *chezmoi.TargetState, progress *applyProgress, persistentState chezmoi.PersistentState) error {
+	if progress.StateHash == "" {
+		stateHash, err := ts.Hash(c.fs)
+		if err != nil {
+			return err
+		}
+		progress.StateHash = hex.EncodeToString(stateHash)
+	}
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	return persistentState.Set(c.applyProgressBucket, applyProgressKey, data)
+}
+
+// clearApplyProgress removes the progress of a failed apply from
+// persistentState, if there is any.
+func (c *Config) clearApplyProgress(persistentState chezmoi.PersistentState) error {
+	data, err := persistentState.Get(c.applyProgressBucket, applyProgressKey)
+	if err != nil || data == nil {
+		return err
+	}
+	return persistentState.Delete(c.applyProgressBucket, applyProgressKey)
+}
+
+// makeTempClone clones repo into a new temporary directory whose name begins
+// with prefix and returns its path. The caller is responsible for removing the
+// directory.
+func (c *Config) makeTempClone(repo, prefix string) (string, error) {
+	vcs, err := c.getVCS()
+	if err != nil {
+		return "", err
+	}
+
+	tempDir := os.TempDir()
+	if err := vfs.MkdirAll(c.fs, tempDir, 0o777); err != nil {
+		return "", err
+	}
+	rawTempDir, err := c.fs.RawPath(tempDir)
+	if err != nil {
+		return "", err
+	}
+	rawCloneDir, err := ioutil.TempDir(rawTempDir, prefix)
+	if err != nil {
+		return "", err
+	}
+	cloneDir := filepath.Join(tempDir, filepath.Base(rawCloneDir))
+
+	cloneArgs, err := c.getCloneArgs(vcs, repo, rawCloneDir)
+	if err == nil {
+		// The clone is run directly rather than with c.mutator, which does
+		// not run commands in dry run mode. Its output is written to stderr
+		// so that it is not mixed with any diff.
+		//nolint:gosec
+		cmd := exec.Command(c.SourceVCS.Command, cloneArgs...)
+		cmd.Stdout = c.Stderr
+		cmd.Stderr = c.Stderr
+		err = cmd.Run()
+	}
+	if err != nil {
+		_ = c.fs.RemoveAll(cloneDir)
+		return "", err
+	}
+	return cloneDir, nil
+}
+
+// pruneTargets removes targets that were applied by a previous apply to
+// ts.DestDir but that are no longer in ts, prompting for each one unless
+// c.Apply.prune is set or in dry run mode, and then records the targets in ts
+// as applied. Targets that are ignored are never treated as removed.
+func (c *Config) pruneTargets(ts *chezmoi.TargetState, persistentState chezmoi.PersistentState) error {
+	if c.Apply.prune && c.Apply.noPrune {
+		return fmt.Errorf("--prune and --no-prune cannot be used together")
+	}
+
+	appliedTargetNames := make(map[string]struct{})
+	// The contents of encrypted directories are unknown if encrypted targets
+	// are excluded.
+	var encryptedDirNames []string
+	for _, entry := range ts.AllEntries() {
+		if _, ok := entry.(*chezmoi.Script); ok || ts.TargetIgnore.Match(entry.TargetName()) {
+			continue
+		}
+		appliedTargetNames[entry.TargetName()] = struct{}{}
+		if dir, ok := entry.(*chezmoi.Dir); ok && dir.Encrypted && c.isExcludingEncrypted() {
+			encryptedDirNames = append(encryptedDirNames, dir.TargetName())
+		}
+	}
+
+	key := []byte(ts.DestDir)
+	data, err := persistentState.Get(c.appliedTargetBucket, key)
+	if err != nil {
+		return err
+	}
+	var previousTargetNames []string
+	if data != nil {
+		if err := json.Unmarshal(data, &previousTargetNames); err != nil {
+			return err
+		}
+	}
+
+	// Remove targets in reverse order so that the contents of directories
+	// are removed before the directories themselves.
+	sort.Sort(sort.Reverse(sort.StringSlice(previousTargetNames)))
+	prune := c.Apply.prune || c.DryRun
+	quit := false
+	for _, targetName := range previousTargetNames {
+		if _, ok := appliedTargetNames[targetName]; ok {
+			continue
+		}
+		// Targets that are ignored, that are inside encrypted directories whose
+		// contents are unknown, or that are not pruned because of --no-prune
+		// or because the user quit, are still tracked so that they can be
+		// pruned later.
+		if ts.TargetIgnore.Match(targetName) || isInsideAny(targetName, encryptedDirNames) || quit || c.Apply.noPrune {
+			appliedTargetNames[targetName] = struct{}{}
+			continue
+		}
+		targetPath := filepath.Join(ts.DestDir, targetName)
+		info, err := c.fs.Lstat(targetPath)
+		switch {
+		case os.IsNotExist(err):
+			continue
+		case err != nil:
+			return err
+		case info.IsDir():
+			// Directories are only removed if they are empty, so that
+			// unmanaged files are not removed.
+			if infos, err := c.fs.ReadDir(targetPath); err != nil {
+				return err
+			} else if len(infos) != 0 {
+				continue
+			}
+		}
+		if !prune {
+			choice, err := c.prompt(fmt.Sprintf("%s was removed from the source state, remove it", targetPath), "ynqa", 'q')
+			if err != nil {
+				return err
+			}
+			switch choice {
+			case 'n':
+				continue
+			case 'q':
+				quit = true
+				appliedTargetNames[targetName] = struct{}{}
+				continue
+			case 'a':
+				prune = true
+			}
+		}
+		if err := c.mutator.RemoveAll(targetPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if c.DryRun {
+		return nil
+	}
+	targetNames := make([]string, 0, len(appliedTargetNames))
+	for targetName := range appliedTargetNames {
+		targetNames = append(targetNames, targetName)
+	}
+	sort.Strings(targetNames)
+	data, err = json.Marshal(targetNames)
+	if err != nil {
+		return err
+	}
+	return persistentState.Set(c.appliedTargetBucket, key, data)
+}
+
+// isInsideAny returns whether targetName is inside any of dirNames.
+func isInsideAny(targetName string, dirNames []string) bool {
+	for _, dirName := range dirNames {
+		if strings.HasPrefix(targetName, dirName+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// A destSymlink is a directory in the destination directory that is a symlink
+// to somewhere outside the destination directory.
+type destSymlink struct {
+	path     string
+	linkname string
+}
+
+// checkDestSymlinks checks whether any directory containing the targets of
+// entries, or of all entries in ts if entries is empty, is a symlink to
+// somewhere outside ts.DestDir. Applying such targets without --follow would
+// either write through the symlink or replace it. If there are any such
+// directories then they are reported and, unless in dry run mode, the user
+// must confirm to continue.
+func (c *Config) checkDestSymlinks(ts *chezmoi.TargetState, entries []chezmoi.Entry) error {
+	var allEntries []chezmoi.Entry
+	if len(entries) == 0 {
+		allEntries = ts.AllEntries()
+	} else {
+		for _, entry := range entries {
+			allEntries = entry.AppendAllEntries(allEntries)
+		}
+	}
+
+	rawDestDir, err := c.fs.RawPath(ts.DestDir)
+	if err != nil {
+		return err
+	}
+	if rawDestDir, err = filepath.EvalSymlinks(rawDestDir); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	// Each directory is only checked once, however many targets it contains.
+	// checked records whether each checked directory is a symlink outside the
+	// destination directory.
+	checked := make(map[string]bool)
+	var destSymlinks []destSymlink
+	for _, entry := range allEntries {
+		if ts.TargetIgnore.Match(entry.TargetName()) {
+			continue
+		}
+		// Check the directories containing the target, and the target itself
+		// if it is a directory.
+		dirNames := strings.Split(filepath.Dir(entry.TargetName()), string(filepath.Separator))
+		if _, ok := entry.(*chezmoi.Dir); ok {
+			dirNames = strings.Split(entry.TargetName(), string(filepath.Separator))
+		}
+		for i := range dirNames {
+			dirName := filepath.Join(dirNames[:i+1]...)
+			if dirName == "." {
+				break
+			}
+			isDestSymlink, ok := checked[dirName]
+			if !ok {
+				destSymlink, err := c.getDestSymlink(rawDestDir, filepath.Join(ts.DestDir, dirName))
+				if err != nil {
+					return err
+				}
+				isDestSymlink = destSymlink != nil
+				checked[dirName] = isDestSymlink
+				if isDestSymlink {
+					destSymlinks = append(destSymlinks, *destSymlink)
+				}
+			}
+			// Everything below the symlink is reached through it.
+			if isDestSymlink {
+				break
+			}
+		}
+	}
+	if len(destSymlinks) == 0 {
+		return nil
+	}
+
+	sort.Slice(destSymlinks, func(i, j int) bool {
+		return destSymlinks[i].path < destSymlinks[j].path
+	})
+	for _, destSymlink := range destSymlinks {
+		fmt.Fprintf(c.Stderr, "warning: %s: symlink to %s, outside %s\n", destSymlink.path, destSymlink.linkname, ts.DestDir)
+	}
+	if c.DryRun {
+		return nil
+	}
+	choice, err := c.prompt("Apply targets in symlinked directories", "yn", 'n')
+	if err != nil {
+		return err
+	}
+	if choice != 'y' {
+		return fmt.Errorf("%d directory symlink(s) outside %s, use --follow to follow them", len(destSymlinks), ts.DestDir)
+	}
+	return nil
+}
+
+// getDestSymlink returns a *destSymlink if path is a symlink that resolves to
+// somewhere outside rawDestDir, which must have its symlinks evaluated.
+func (c *Config) getDestSymlink(rawDestDir, path string) (*destSymlink, error) {
+	info, err := c.fs.Lstat(path)
+	switch {
+	case os.IsNotExist(err):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	case info.Mode()&os.ModeType != os.ModeSymlink:
+		return nil, nil
+	}
+	linkname, err := c.fs.Readlink(path)
+	if err != nil {
+		return nil, err
+	}
+	rawPath, err := c.fs.RawPath(path)
+	if err != nil {
+		return nil, err
+	}
+	resolvedPath, err := filepath.EvalSymlinks(rawPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if relPath, err := filepath.Rel(rawDestDir, resolvedPath); err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return nil, nil
+	}
+	return &destSymlink{
+		path:     path,
+		linkname: linkname,
+	}, nil
+}
+
+// backupRunNameFormat is the format of the names of the per-run backup
+// directories, chosen so that they sort in the order that they were created.
+const backupRunNameFormat = "20060102T150405.000000000Z"
+
+// getBackupDir returns the directory that backups are stored in.
+func (c *Config) getBackupDir() string {
+	if c.Apply.BackupDir != "" {
+		return c.Apply.BackupDir
+	}
+	return filepath.Join(c.bds.CacheHome, "chezmoi", "backup")
+}
+
+// newBackupMutator returns a BackupMutator that wraps c.mutator and backs up
+// targets in ts to a new per-run directory in the backup directory.
+func (c *Config) newBackupMutator(ts *chezmoi.TargetState) *chezmoi.BackupMutator {
+	runName := time.Now().UTC().Format(backupRunNameFormat)
+	private := func(targetPath string) bool {
+		entry, err := ts.Get(c.fs, targetPath)
+		if err != nil {
+			return false
+		}
+		switch entry := entry.(type) {
+		case *chezmoi.Dir:
+			return entry.Private()
+		case *chezmoi.File:
+			return entry.Private()
+		default:
+			return false
+		}
+	}
+	return chezmoi.NewBackupMutator(c.mutator, c.fs, ts.DestDir, c.getBackupDir(), runName, private)
+}
+
+// pruneBackups removes all but the most recent c.Apply.BackupKeep per-run
+// backup directories. If c.Apply.BackupKeep is not positive then all backups
+// are kept.
+func (c *Config) pruneBackups() error {
+	if c.Apply.BackupKeep <= 0 {
+		return nil
+	}
+	backupDir := c.getBackupDir()
+	infos, err := c.fs.ReadDir(backupDir)
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return err
+	}
+	// Only consider directories whose names are per-run backup directory
+	// names, so that anything else in the backup directory is left alone.
+	var runNames []string
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(backupRunNameFormat, info.Name()); err != nil {
+			continue
+		}
+		runNames = append(runNames, info.Name())
+	}
+	if len(runNames) <= c.Apply.BackupKeep {
+		return nil
+	}
+	sort.Strings(runNames)
+	for _, runName := range runNames[:len(runNames)-c.Apply.BackupKeep] {
+		if err := c.fs.RemoveAll(filepath.Join(backupDir, runName)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getSourceHead returns the commit of the source directory's working copy, or
+// the empty string if the source directory is not a working copy of the source
+// VCS. dirty is set if the working copy has uncommitted changes.
+func (c *Config) getSourceHead() (commit string, dirty bool, err error) {
+	vcs, err := c.getVCS()
+	if err != nil {
+		return "", false, nil
+	}
+	headArgs := vcs.HeadArgs()
+	if headArgs == nil {
+		return "", false, nil
+	}
+	output, err := c.output(c.SourceDir, c.SourceVCS.Command, headArgs...)
+	if err != nil {
+		return "", false, nil
+	}
+	commit = strings.TrimSpace(string(output))
+	if statusArgs := vcs.StatusArgs(); statusArgs != nil {
+		output, err := c.output(c.SourceDir, c.SourceVCS.Command, statusArgs...)
+		if err != nil {
+			return "", false, err
+		}
+		dirty = len(bytes.TrimSpace(output)) != 0
+	}
+	return commit, dirty, nil
+}
+
+// getAppliedSource returns the commit of the source directory that was last
+// applied, or nil if it has never been applied. It reads the persistent state
+// that is already open, if any, and only reads it once.
+func (c *Config) getAppliedSource() (*appliedSource, error) {
+	if c.readAppliedSource {
+		return c.lastAppliedSource, nil
+	}
+	persistentState := c.persistentState
+	if persistentState == nil {
+		var err error
+		persistentState, err = c.openPersistentState(&bolt.Options{
+			ReadOnly: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer persistentState.Close()
+	}
+	data, err := persistentState.Get(c.appliedSourceBucket, []byte(c.SourceDir))
+	if err != nil {
+		return nil, err
+	}
+	c.readAppliedSource = true
+	if data == nil {
+		return nil, nil
+	}
+	var source appliedSource
+	if err := json.Unmarshal(data, &source); err != nil {
+		return nil, nil
+	}
+	c.lastAppliedSource = &source
+	return &source, nil
+}
+
+// recordAppliedSource records the commit of the source directory that was
+// applied in persistentState, if the source directory is a working copy of the
+// source VCS.
+func (c *Config) recordAppliedSource(persistentState chezmoi.PersistentState) error {
+	commit, dirty, err := c.getSourceHead()
+	if err != nil || commit == "" {
+		return err
+	}
+	source := &appliedSource{
+		Commit: commit,
+		Dirty:  dirty,
+		Time:   time.Now().UTC(),
+	}
+	data, err := json.Marshal(source)
+	if err != nil {
+		return err
+	}
+	if err := persistentState.Set(c.appliedSourceBucket, []byte(c.SourceDir), data); err != nil {
+		return err
+	}
+	c.lastAppliedSource = source
+	c.readAppliedSource = true
+	return nil
+}
+
+// useStagingDestDir makes dir, as given by --to, the destination directory for
+// this invocation, for example to build a container image. Relative paths are
+// resolved against the working directory and dir is created if needed. Scripts
+// are skipped unless --with-scripts is given, and the state of targets and
+// scripts is recorded separately from the configured destination directory's.
+// With --rewrite-symlinks, absolute symlink targets in the configured
+// destination directory are rewritten to the same paths in dir.
+func (c *Config) useStagingDestDir(dir string) error {
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(c.workingDir, dir)
+	}
+	dir = filepath.Clean(dir)
+	if err := vfs.MkdirAll(c.mutator, dir, 0o777&^os.FileMode(c.Umask)); err != nil {
+		return err
+	}
+	if c.Apply.rewriteSymlinks {
+		c.Apply.rewriteLinkname = getRewriteLinkname(c.DestDir, dir)
+	}
+	c.DestDir = dir
+	if !c.Apply.withScripts {
+		c.exclude = append(c.exclude, "scripts")
+	}
+	c.namespaceApplyBuckets(dir)
+	return nil
+}
+
+// getRewriteLinkname returns a function that rewrites absolute symlink targets
+// in fromDir to the same paths in toDir, and returns all other symlink targets
+// unchanged.
+func getRewriteLinkname(fromDir, toDir string) func(string) string {
+	return func(linkname string) string {
+		if !filepath.IsAbs(linkname) {
+			return linkname
+		}
+		relPath, err := filepath.Rel(fromDir, linkname)
+		if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			return linkname
+		}
+		return filepath.Join(toDir, relPath)
+	}
+}
+
+// useRemoteSourceDir makes remoteSourceDir the only source directory.
+func (c *Config) useRemoteSourceDir(remoteSourceDir string) {
+	c.SourceDir = remoteSourceDir
+	c.SourceDirs = nil
+}
+
+// setApplyProgressOptions sets the options in applyOptions that skip entries
+// already completed by progress and add each completed entry to progress.
+func (c *Config) setApplyProgressOptions(applyOptions *chezmoi.ApplyOptions, progress *applyProgress) {
+	completed := make(map[string]bool, len(progress.Completed))
+	for _, targetName := range progress.Completed {
+		completed[targetName] = true
+	}
+	applyOptions.Skip = func(targetName string) bool {
+		return completed[targetName]
+	}
+	applyOptions.Completed = func(targetName string) error {
+		completed[targetName] = true
+		progress.Completed = append(progress.Completed, targetName)
+		return nil
+	}
+}
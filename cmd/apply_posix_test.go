@@ -1,12 +1,25 @@
+//go:build !windows
 // +build !windows
 
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	vfs "github.com/twpayne/go-vfs"
 	"github.com/twpayne/go-vfs/vfst"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
 )
 
 func getApplyScriptTestCases(tempDir string) []scriptTestCase {
@@ -74,11 +87,1190 @@ func getApplyScriptTestCases(tempDir string) []scriptTestCase {
 				),
 			},
 		},
+		{
+			name: "before_after",
+			root: map[string]interface{}{
+				"/home/user/.local/share/chezmoi": map[string]interface{}{
+					"dir/run_before_sub":     getOrderedScript(tempDir, "sub"),
+					"run_after_aa_after":     getOrderedScript(tempDir, "after"),
+					"run_mm_during":          getOrderedScript(tempDir, "during"),
+					"run_once_before_zz_zzz": getOrderedScript(tempDir, "once-before"),
+					"zzfile":                 "# contents of zzfile\n",
+				},
+			},
+			tests: []vfst.Test{
+				vfst.TestPath(filepath.Join(tempDir, "evidence"),
+					vfst.TestModeIsRegular,
+					vfst.TestContentsString(strings.Join([]string{
+						"sub nofile\n",
+						"once-before nofile\n",
+						"during nofile\n",
+						"after file\n",
+						"sub file\n",
+						"during file\n",
+						"after file\n",
+						"sub file\n",
+						"during file\n",
+						"after file\n",
+					}, "")),
+				),
+			},
+		},
 	}
 }
 
+// getOrderedScript returns a script that records name and whether zzfile
+// exists.
+func getOrderedScript(tempDir, name string) string {
+	return "#!/bin/sh\nif [ -f " + filepath.Join(tempDir, "zzfile") + " ]; then echo " + name + " file; else echo " + name + " nofile; fi >>" + filepath.Join(tempDir, "evidence") + "\n"
+}
+
 func getRunOnceFiles() map[string]interface{} {
 	return map[string]interface{}{
 		"/home/user/.local/share/chezmoi/run_once_foo.tmpl": "#!/bin/sh\necho bar >> {{ .TempFile }}\n",
 	}
 }
+
+func TestApplyDryRunDoesNotRecordScriptState(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	fs := vfs.NewPathFS(vfs.OSFS, tempDir)
+	require.NoError(t, vfst.NewBuilder().Build(
+		fs,
+		map[string]interface{}{
+			"/home/user/.local/share/chezmoi/run_once_true": "#!/bin/sh\necho foo >>" + filepath.Join(tempDir, "evidence") + "\n",
+		},
+	))
+
+	stdout := &bytes.Buffer{}
+	c := newTestConfig(
+		fs,
+		withDestDir("/"),
+		withDryRun(true),
+		withMutator(chezmoi.NullMutator{}),
+		withStdout(stdout),
+	)
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	assert.Contains(t, stdout.String(), "would run script run_once_true (not yet run)\n")
+	vfst.RunTests(t, vfs.OSFS, "",
+		vfst.TestPath(filepath.Join(tempDir, "evidence"),
+			vfst.TestDoesNotExist,
+		),
+	)
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.local/state/chezmoi/chezmoistate.boltdb",
+			vfst.TestDoesNotExist,
+		),
+	)
+
+	c = newTestConfig(
+		fs,
+		withDestDir("/"),
+	)
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, vfs.OSFS, "",
+		vfst.TestPath(filepath.Join(tempDir, "evidence"),
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("foo\n"),
+		),
+	)
+}
+
+func TestApplyNoPersistentState(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	fs := vfs.NewPathFS(vfs.OSFS, tempDir)
+	require.NoError(t, vfst.NewBuilder().Build(
+		fs,
+		map[string]interface{}{
+			"/home/user/.local/share/chezmoi/run_once_true": "#!/bin/sh\necho foo >>" + filepath.Join(tempDir, "evidence") + "\n",
+		},
+	))
+
+	for i := 0; i < 2; i++ {
+		stderr := &bytes.Buffer{}
+		c := newTestConfig(
+			fs,
+			withDestDir("/"),
+			withStderr(stderr),
+		)
+		c.NoPersistentState = true
+		require.NoError(t, c.runApplyCmd(nil, nil))
+		assert.Contains(t, stderr.String(), "run_once_ scripts will be run every time")
+	}
+	vfst.RunTests(t, vfs.OSFS, "",
+		vfst.TestPath(filepath.Join(tempDir, "evidence"),
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("foo\nfoo\n"),
+		),
+	)
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.local/state/chezmoi/chezmoistate.boltdb",
+			vfst.TestDoesNotExist,
+		),
+	)
+}
+
+func TestApplyVerboseSummary(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".local/share/chezmoi": map[string]interface{}{
+				"dot_bashrc":        "# bashrc\n",
+				"dot_dir/foo":       "foo",
+				"private_dot_netrc": "# netrc\n",
+				"dot_zshrc":         "# new zshrc\n",
+				"symlink_dot_vimrc": ".dir/vimrc",
+			},
+			".bashrc": "# bashrc\n",
+			".netrc":  &vfst.File{Perm: 0o644, Contents: []byte("# netrc\n")},
+			".zshrc":  &vfst.File{Perm: 0o600, Contents: []byte("# zshrc\n")},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	stdout := &bytes.Buffer{}
+	c := newTestConfig(
+		fs,
+		withMutator(chezmoi.NewSummaryMutator(stdout, chezmoi.NewFSMutator(fs), fs, false, "/home/user", false)),
+	)
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	assert.Equal(t, strings.Join([]string{
+		"created .dir",
+		"created " + filepath.Join(".dir", "foo"),
+		"updated .netrc (mode 0644→0600)",
+		"created .vimrc",
+		"updated .zshrc (contents, mode 0600→0644)",
+	}, "\n")+"\n", stdout.String())
+}
+
+func TestApplyVerboseSummaryScript(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	fs := vfs.NewPathFS(vfs.OSFS, tempDir)
+	require.NoError(t, vfst.NewBuilder().Build(
+		fs,
+		map[string]interface{}{
+			"/home/user/.local/share/chezmoi/run_once_install.sh": "#!/bin/sh\n",
+		},
+	))
+
+	stdout := &bytes.Buffer{}
+	c := newTestConfig(
+		fs,
+		withDestDir("/"),
+		withDryRun(true),
+		withMutator(chezmoi.NewSummaryMutator(stdout, chezmoi.NullMutator{}, fs, false, "", true)),
+	)
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	assert.Equal(t, "would run script run_once_install.sh (not yet run)\n", stdout.String())
+
+	stdout.Reset()
+	c = newTestConfig(
+		fs,
+		withDestDir("/"),
+		withMutator(chezmoi.NewSummaryMutator(stdout, chezmoi.NewFSMutator(fs), fs, false, "", false)),
+	)
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	assert.Regexp(t, `\Aran script run_once_install\.sh \(\d+(\.\d+)?m?s, .*/home/user/\.run/chezmoi/\d+\.install\.sh\)\n\z`, stdout.String())
+
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/run_fail.sh", []byte("#!/bin/sh\nexit 1\n"), 0o644))
+	stdout.Reset()
+	c = newTestConfig(
+		fs,
+		withDestDir("/"),
+		withMutator(chezmoi.NewSummaryMutator(stdout, chezmoi.NewFSMutator(fs), fs, false, "", false)),
+	)
+	assert.Error(t, c.runApplyCmd(nil, nil))
+	assert.Regexp(t, `\Afailed script run_fail\.sh \(\d+(\.\d+)?m?s, .*\.fail\.sh, exit status 1\)\n\z`, stdout.String())
+}
+
+func TestApplyScriptTempDir(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	fs := vfs.NewPathFS(vfs.OSFS, tempDir)
+	require.NoError(t, vfst.NewBuilder().Build(
+		fs,
+		map[string]interface{}{
+			"/home/user/.local/share/chezmoi/run_script.sh": "#!/bin/sh\necho $0 >" + filepath.Join(tempDir, "evidence") + "\n",
+			"/home/user/readonly":                           &vfst.Dir{Perm: 0o500},
+		},
+	))
+
+	for _, tc := range []struct {
+		name            string
+		scriptsTempDir  string
+		expectedTempDir string
+	}{
+		{
+			name:            "configured",
+			scriptsTempDir:  "/home/user/scripts",
+			expectedTempDir: "/home/user/scripts",
+		},
+		{
+			name:            "fallback",
+			scriptsTempDir:  "/home/user/readonly/scripts",
+			expectedTempDir: "/home/user/.cache/chezmoi/scripts",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.name == "fallback" && os.Geteuid() == 0 {
+				t.Skip("root can create directories in read-only directories")
+			}
+			stdout := &bytes.Buffer{}
+			c := newTestConfig(
+				fs,
+				withStdout(stdout),
+			)
+			c.Verbose = true
+			c.Scripts.TempDir = tc.scriptsTempDir
+			require.NoError(t, c.runApplyCmd(nil, nil))
+			rawExpectedTempDir, err := fs.RawPath(tc.expectedTempDir)
+			require.NoError(t, err)
+			evidence, err := ioutil.ReadFile(filepath.Join(tempDir, "evidence"))
+			require.NoError(t, err)
+			assert.Equal(t, rawExpectedTempDir, filepath.Dir(strings.TrimSpace(string(evidence))))
+			assert.Contains(t, stdout.String(), "ran script run_script.sh from "+rawExpectedTempDir+"/")
+			vfst.RunTests(t, fs, "",
+				vfst.TestPath(tc.expectedTempDir,
+					vfst.TestIsDir,
+					vfst.TestModePerm(0o700),
+				),
+			)
+			infos, err := fs.ReadDir(tc.expectedTempDir)
+			require.NoError(t, err)
+			assert.Empty(t, infos)
+		})
+	}
+}
+
+func TestApplyLogFile(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	fs := vfs.NewPathFS(vfs.OSFS, tempDir)
+	require.NoError(t, vfst.NewBuilder().Build(
+		fs,
+		map[string]interface{}{
+			"/home/user/.local/share/chezmoi": map[string]interface{}{
+				"dot_foo":  "bar\n",
+				"run_fail": "#!/bin/sh\nexit 3\n",
+			},
+		},
+	))
+
+	log := &bytes.Buffer{}
+	logMutator := chezmoi.NewLogMutator(log, chezmoi.NewFSMutator(fs), fs, false)
+	c := newTestConfig(
+		fs,
+		withDestDir("/"),
+		withMutator(logMutator),
+		withStdout(&bytes.Buffer{}),
+	)
+	c.applyLog.mutator = logMutator
+	require.Error(t, c.runApplyCmd(nil, nil))
+
+	var entries []chezmoi.LogEntry
+	for _, line := range strings.Split(strings.TrimSuffix(log.String(), "\n"), "\n") {
+		var entry chezmoi.LogEntry
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	var actions []string
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+	}
+	assert.Contains(t, actions, "write")
+	assert.Contains(t, actions, "script")
+	assert.NotContains(t, log.String(), "bar")
+	for _, entry := range entries {
+		if entry.Script == "run_fail" {
+			require.NotNil(t, entry.ExitStatus)
+			assert.Equal(t, 3, *entry.ExitStatus)
+		}
+	}
+}
+
+func TestApplyLink(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	destDir := filepath.Join(tempDir, "home")
+	sourceDir := filepath.Join(tempDir, "source")
+	require.NoError(t, vfst.NewBuilder().Build(
+		vfs.OSFS,
+		map[string]interface{}{
+			destDir: map[string]interface{}{
+				".bashrc": "# old .bashrc\n",
+			},
+			sourceDir: map[string]interface{}{
+				"link_dot_bashrc": "# .bashrc\n",
+				"link_dot_zshrc":  "# .zshrc\n",
+			},
+		},
+	))
+	newLinkTestConfig := func(options ...configOption) *Config {
+		c := newTestConfig(vfs.OSFS, append([]configOption{withDestDir(destDir)}, options...)...)
+		c.SourceDir = sourceDir
+		return c
+	}
+
+	require.NoError(t, newLinkTestConfig().runApplyCmd(nil, nil))
+	vfst.RunTests(t, vfs.OSFS, "",
+		vfst.TestPath(filepath.Join(destDir, ".bashrc"),
+			vfst.TestModeType(os.ModeSymlink),
+			vfst.TestSymlinkTarget(filepath.Join(sourceDir, "link_dot_bashrc")),
+		),
+		vfst.TestPath(filepath.Join(destDir, ".zshrc"),
+			vfst.TestModeType(os.ModeSymlink),
+			vfst.TestSymlinkTarget(filepath.Join(sourceDir, "link_dot_zshrc")),
+		),
+	)
+
+	mutator := chezmoi.NewAnyMutator(chezmoi.NullMutator{})
+	require.NoError(t, newLinkTestConfig(withMutator(mutator)).runApplyCmd(nil, nil))
+	assert.False(t, mutator.Mutated())
+
+	// Switching the target back to a regular file replaces the symlink.
+	require.NoError(t, os.Rename(filepath.Join(sourceDir, "link_dot_bashrc"), filepath.Join(sourceDir, "dot_bashrc")))
+	require.NoError(t, newLinkTestConfig().runApplyCmd(nil, nil))
+	vfst.RunTests(t, vfs.OSFS, "",
+		vfst.TestPath(filepath.Join(destDir, ".bashrc"),
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("# .bashrc\n"),
+		),
+		vfst.TestPath(filepath.Join(sourceDir, "dot_bashrc"),
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("# .bashrc\n"),
+		),
+	)
+
+	// Adding a symlink to the target's source file records that it is linked.
+	require.NoError(t, os.Remove(filepath.Join(destDir, ".bashrc")))
+	require.NoError(t, os.Symlink(filepath.Join(sourceDir, "dot_bashrc"), filepath.Join(destDir, ".bashrc")))
+	require.NoError(t, newLinkTestConfig().runAddCmd(nil, []string{filepath.Join(destDir, ".bashrc")}))
+	vfst.RunTests(t, vfs.OSFS, "",
+		vfst.TestPath(filepath.Join(sourceDir, "dot_bashrc"),
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath(filepath.Join(sourceDir, "link_dot_bashrc"),
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("# .bashrc\n"),
+		),
+	)
+}
+
+func TestApplySymlinkMode(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	destDir := filepath.Join(tempDir, "home")
+	sourceDir := filepath.Join(tempDir, "source")
+	require.NoError(t, vfst.NewBuilder().Build(
+		vfs.OSFS,
+		map[string]interface{}{
+			destDir: map[string]interface{}{
+				".bashrc": "# old .bashrc\n",
+			},
+			sourceDir: map[string]interface{}{
+				"dot_bashrc":          "# .bashrc\n",
+				"dot_hushlogin":       "",
+				"dot_profile.tmpl":    "# {{ \"profile\" }}\n",
+				"executable_dot_hook": "#!/bin/sh\n",
+				"private_dot_netrc":   "machine example.com\n",
+			},
+		},
+	))
+	newSymlinkModeTestConfig := func(symlink bool, options ...configOption) *Config {
+		c := newTestConfig(vfs.OSFS, append([]configOption{withDestDir(destDir)}, options...)...)
+		c.SourceDir = sourceDir
+		c.symlink = symlink
+		return c
+	}
+
+	// In symlink mode, only plain files are applied as symlinks.
+	require.NoError(t, newSymlinkModeTestConfig(true).runApplyCmd(nil, nil))
+	vfst.RunTests(t, vfs.OSFS, "",
+		vfst.TestPath(filepath.Join(destDir, ".bashrc"),
+			vfst.TestModeType(os.ModeSymlink),
+			vfst.TestSymlinkTarget(filepath.Join(sourceDir, "dot_bashrc")),
+		),
+		vfst.TestPath(filepath.Join(destDir, ".hushlogin"),
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath(filepath.Join(destDir, ".profile"),
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("# profile\n"),
+		),
+		vfst.TestPath(filepath.Join(destDir, ".hook"),
+			vfst.TestModeIsRegular,
+			vfst.TestModePerm(0o755),
+		),
+		vfst.TestPath(filepath.Join(destDir, ".netrc"),
+			vfst.TestModeIsRegular,
+			vfst.TestModePerm(0o600),
+		),
+	)
+
+	mutator := chezmoi.NewAnyMutator(chezmoi.NullMutator{})
+	require.NoError(t, newSymlinkModeTestConfig(true, withMutator(mutator)).runApplyCmd(nil, nil))
+	assert.False(t, mutator.Mutated())
+
+	// Leaving symlink mode replaces the symlinks with regular files.
+	mutator = chezmoi.NewAnyMutator(chezmoi.NullMutator{})
+	require.NoError(t, newSymlinkModeTestConfig(false, withMutator(mutator)).runApplyCmd(nil, nil))
+	assert.True(t, mutator.Mutated())
+	require.NoError(t, newSymlinkModeTestConfig(false).runApplyCmd(nil, nil))
+	vfst.RunTests(t, vfs.OSFS, "",
+		vfst.TestPath(filepath.Join(destDir, ".bashrc"),
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("# .bashrc\n"),
+		),
+		vfst.TestPath(filepath.Join(sourceDir, "dot_bashrc"),
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("# .bashrc\n"),
+		),
+	)
+
+	// The symlink configuration variable also enables symlink mode.
+	c := newSymlinkModeTestConfig(false)
+	c.Symlink = true
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, vfs.OSFS, "",
+		vfst.TestPath(filepath.Join(destDir, ".bashrc"),
+			vfst.TestModeType(os.ModeSymlink),
+			vfst.TestSymlinkTarget(filepath.Join(sourceDir, "dot_bashrc")),
+		),
+	)
+}
+
+func TestApplyRemote(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in $PATH")
+	}
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	repoDir := filepath.Join(tempDir, "repo")
+	require.NoError(t, vfst.NewBuilder().Build(
+		vfs.OSFS,
+		map[string]interface{}{
+			repoDir: map[string]interface{}{
+				"dot_foo":  "bar\n",
+				"run_true": "#!/bin/sh\necho foo >>" + filepath.Join(tempDir, "evidence") + "\n",
+			},
+		},
+	))
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=chezmoi", "-c", "user.email=chezmoi@example.com"}, args...)...)
+		cmd.Dir = repoDir
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+	git("init", "--quiet")
+	git("add", ".")
+	git("commit", "--quiet", "--message", "initial")
+
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	c := newTestConfig(fs, withStderr(ioutil.Discard))
+	c.remote.url = repoDir
+	err = c.runApplyCmd(nil, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--allow-scripts")
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.foo",
+			vfst.TestDoesNotExist,
+		),
+	)
+
+	c = newTestConfig(fs, withStderr(ioutil.Discard))
+	c.remote.url = repoDir
+	c.remote.allowScripts = true
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.foo",
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("bar\n"),
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.local/state/chezmoi/chezmoistate.boltdb",
+			vfst.TestDoesNotExist,
+		),
+	)
+	vfst.RunTests(t, vfs.OSFS, "",
+		vfst.TestPath(filepath.Join(tempDir, "evidence"),
+			vfst.TestModeIsRegular,
+		),
+	)
+
+	infos, err := fs.ReadDir(os.TempDir())
+	if err == nil {
+		for _, info := range infos {
+			assert.False(t, strings.HasPrefix(info.Name(), "chezmoi-remote"))
+		}
+	}
+}
+
+func TestApplyElevationFailed(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_bar": "# bar\n",
+			"dot_foo": "# foo\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	stderr := &bytes.Buffer{}
+	c := newTestConfig(fs, withStderr(stderr))
+	c.Elevation = elevationConfig{
+		Command: "false",
+		Targets: []string{".foo"},
+	}
+	elevate, err := c.getElevate()
+	require.NoError(t, err)
+	c.mutator = chezmoi.NewElevatingMutator(c.mutator, fs, c.Elevation.Command, c.Elevation.Args, elevate, nil)
+	err = c.runApplyCmd(nil, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1 target(s) skipped")
+	assert.Contains(t, stderr.String(), "/home/user/.foo: elevation failed")
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.bar",
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("# bar\n"),
+		),
+		vfst.TestPath("/home/user/.foo",
+			vfst.TestDoesNotExist,
+		),
+	)
+}
+
+func TestApplyPerm(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".local/share/chezmoi": map[string]interface{}{
+				"perm_0660_dot_shared":  "# shared\n",
+				"perm_2775_project/foo": "foo",
+			},
+			".shared": &vfst.File{Perm: 0o644, Contents: []byte("# shared\n")},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	stdout := &bytes.Buffer{}
+	c := newTestConfig(
+		fs,
+		withMutator(chezmoi.NewSummaryMutator(stdout, chezmoi.NewFSMutator(fs), fs, false, "/home/user", false)),
+	)
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	assert.Equal(t, strings.Join([]string{
+		"updated .shared (mode 0644→0660)",
+		"created project",
+		"updated project (mode 0755→2775)",
+		"created " + filepath.Join("project", "foo"),
+	}, "\n")+"\n", stdout.String())
+	for path, expectedMode := range map[string]os.FileMode{
+		"/home/user/.shared": 0o660,
+		"/home/user/project": os.ModeDir | os.ModeSetgid | 0o775,
+	} {
+		info, err := fs.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, expectedMode, info.Mode(), path)
+	}
+
+	stdout.Reset()
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	assert.Equal(t, "", stdout.String())
+}
+
+func TestApplyDestSymlinks(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".config": &vfst.Symlink{Target: "../../tmp/synced"},
+			".cfg":    &vfst.Symlink{Target: "real"},
+			"real":    &vfst.Dir{Perm: 0o755},
+			".local/share/chezmoi": map[string]interface{}{
+				"dot_cfg/bar":    "bar\n",
+				"dot_config/foo": "foo\n",
+			},
+		},
+		"/tmp/synced": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	stderr := &bytes.Buffer{}
+	c := newTestConfig(fs, withDryRun(true), withMutator(chezmoi.NullMutator{}), withStderr(stderr))
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	assert.Equal(t, "warning: /home/user/.config: symlink to ../../tmp/synced, outside /home/user\n", stderr.String())
+
+	stderr.Reset()
+	c = newTestConfig(fs, withStdin(strings.NewReader("n\n")), withStdout(ioutil.Discard), withStderr(stderr))
+	assert.Error(t, c.runApplyCmd(nil, []string{"/home/user/.config/foo"}))
+	assert.Contains(t, stderr.String(), "/home/user/.config: symlink to ../../tmp/synced")
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.config",
+			vfst.TestModeType(os.ModeSymlink),
+		),
+		vfst.TestPath("/tmp/synced/foo",
+			vfst.TestDoesNotExist,
+		),
+	)
+
+	c = newTestConfig(fs, withFollow(true), withStderr(stderr))
+	require.NoError(t, c.runApplyCmd(nil, []string{"/home/user/.config/foo"}))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/tmp/synced/foo",
+			vfst.TestContentsString("foo\n"),
+		),
+	)
+}
+
+func TestApplyBackup(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".bashrc": "# old\n",
+			".netrc": &vfst.File{
+				Perm:     0o644,
+				Contents: []byte("old\n"),
+			},
+			".local/share/chezmoi": map[string]interface{}{
+				"dot_bashrc":        "# new\n",
+				"private_dot_netrc": "new\n",
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	backupDir := "/home/user/.cache/chezmoi/backup"
+	getRunDirs := func() []string {
+		infos, err := fs.ReadDir(backupDir)
+		require.NoError(t, err)
+		var runDirs []string
+		for _, info := range infos {
+			runDirs = append(runDirs, filepath.Join(backupDir, info.Name()))
+		}
+		return runDirs
+	}
+
+	c := newTestConfig(fs)
+	c.Apply.Backup = true
+	c.Apply.BackupKeep = 1
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	runDirs := getRunDirs()
+	require.Len(t, runDirs, 1)
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath(backupDir,
+			vfst.TestIsDir,
+			vfst.TestModePerm(0o700),
+		),
+		vfst.TestPath(filepath.Join(runDirs[0], ".bashrc"),
+			vfst.TestContentsString("# old\n"),
+			vfst.TestModePerm(0o644),
+		),
+		vfst.TestPath(filepath.Join(runDirs[0], ".netrc"),
+			vfst.TestContentsString("old\n"),
+			vfst.TestModePerm(0o600),
+		),
+	)
+
+	require.NoError(t, fs.WriteFile("/home/user/.bashrc", []byte("# changed\n"), 0o644))
+	c = newTestConfig(fs)
+	c.Apply.Backup = true
+	c.Apply.noBackup = true
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	assert.Equal(t, runDirs, getRunDirs())
+
+	require.NoError(t, fs.WriteFile("/home/user/.bashrc", []byte("# changed again\n"), 0o644))
+	c = newTestConfig(fs)
+	c.Apply.Backup = true
+	c.Apply.BackupKeep = 1
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	newRunDirs := getRunDirs()
+	require.Len(t, newRunDirs, 1)
+	assert.NotEqual(t, runDirs, newRunDirs)
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath(filepath.Join(newRunDirs[0], ".bashrc"),
+			vfst.TestContentsString("# changed again\n"),
+		),
+		vfst.TestPath(filepath.Join(newRunDirs[0], ".netrc"),
+			vfst.TestDoesNotExist,
+		),
+	)
+}
+
+func TestPruneBackups(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.cache/chezmoi/backup": &vfst.Dir{
+			Perm: 0o755,
+			Entries: map[string]interface{}{
+				"20200101T000000.000000000Z/.bashrc": "# 1\n",
+				"20200102T000000.000000000Z/.bashrc": "# 2\n",
+				"20200103T000000.000000000Z/.bashrc": "# 3\n",
+				"important/file":                     "keep\n",
+				"zzz/file":                           "keep\n",
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	c := newTestConfig(fs)
+	c.Apply.BackupKeep = 1
+	require.NoError(t, c.pruneBackups())
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.cache/chezmoi/backup",
+			vfst.TestModePerm(0o755),
+		),
+		vfst.TestPath("/home/user/.cache/chezmoi/backup/20200101T000000.000000000Z",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.cache/chezmoi/backup/20200102T000000.000000000Z",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.cache/chezmoi/backup/20200103T000000.000000000Z/.bashrc",
+			vfst.TestContentsString("# 3\n"),
+		),
+		vfst.TestPath("/home/user/.cache/chezmoi/backup/important/file",
+			vfst.TestContentsString("keep\n"),
+		),
+		vfst.TestPath("/home/user/.cache/chezmoi/backup/zzz/file",
+			vfst.TestContentsString("keep\n"),
+		),
+	)
+}
+
+func TestApplyRecordsSourceCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in $PATH")
+	}
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_foo": "old\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	sourceDir, err := fs.RawPath("/home/user/.local/share/chezmoi")
+	require.NoError(t, err)
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=chezmoi", "-c", "user.email=chezmoi@example.com"}, args...)...)
+		cmd.Dir = sourceDir
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+		return strings.TrimSpace(string(output))
+	}
+	git("init", "--quiet")
+	git("add", ".")
+	git("commit", "--quiet", "--message", "old")
+	oldCommit := git("rev-parse", "HEAD")
+
+	stdout := &strings.Builder{}
+	c := newTestConfig(fs, withStdout(stdout))
+	assert.Equal(t, exitCodeError(1), c.runStatusSourceDrift())
+	assert.Equal(t, "applied: never\nhead:    "+oldCommit+"\n", stdout.String())
+
+	c = newTestConfig(fs)
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	// The applied commit is still available once the persistent state is
+	// closed, for example to auto-commit after edit --apply.
+	data, err := c.getDefaultData()
+	require.NoError(t, err)
+	assert.Equal(t, oldCommit, data["lastAppliedCommit"])
+
+	stdout.Reset()
+	c = newTestConfig(fs, withStdout(stdout))
+	require.NoError(t, c.runStatusSourceDrift())
+	assert.Regexp(t, `\Aapplied: `+oldCommit+` at \S+\nhead:    `+oldCommit+`\n\z`, stdout.String())
+	data, err = c.getDefaultData()
+	require.NoError(t, err)
+	assert.Equal(t, oldCommit, data["lastAppliedCommit"])
+
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/dot_foo", []byte("new\n"), 0o644))
+	c = newTestConfig(fs)
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	git("commit", "--quiet", "--all", "--message", "new")
+	newCommit := git("rev-parse", "HEAD")
+
+	stdout.Reset()
+	c = newTestConfig(fs, withStdout(stdout))
+	assert.Equal(t, exitCodeError(1), c.runStatusSourceDrift())
+	assert.Regexp(t, `\Aapplied: `+oldCommit+` \(dirty\) at \S+\nhead:    `+newCommit+`\n\z`, stdout.String())
+}
+
+func TestApplyTo(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	evidence := filepath.Join(tempDir, "evidence")
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_foo":           "foo\n",
+			"symlink_dot_bar":   "/home/user/.foo\n",
+			"symlink_dot_baz":   "/etc/baz\n",
+			"run_once_dest_dir": "#!/bin/sh\necho $CHEZMOI_DEST_DIR >> " + evidence + "\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	rawPath := func(path string) string {
+		rawPath, err := fs.RawPath(path)
+		require.NoError(t, err)
+		return rawPath
+	}
+
+	c := newTestConfig(fs)
+	c.Apply.to = "/stage/home/user"
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/stage/home/user/.foo",
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("foo\n"),
+		),
+		vfst.TestPath("/stage/home/user/.bar",
+			vfst.TestModeType(os.ModeSymlink),
+			vfst.TestSymlinkTarget(rawPath("/home/user/.foo")),
+		),
+		vfst.TestPath("/home/user/.foo",
+			vfst.TestDoesNotExist,
+		),
+	)
+	vfst.RunTests(t, vfs.OSFS, "",
+		vfst.TestPath(evidence,
+			vfst.TestDoesNotExist,
+		),
+	)
+
+	c = newTestConfig(fs)
+	c.Apply.to = "/stage2"
+	c.Apply.rewriteSymlinks = true
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/stage2/.bar",
+			vfst.TestModeType(os.ModeSymlink),
+			vfst.TestSymlinkTarget(rawPath("/stage2/.foo")),
+		),
+		vfst.TestPath("/stage2/.baz",
+			vfst.TestModeType(os.ModeSymlink),
+			vfst.TestSymlinkTarget(rawPath("/etc/baz")),
+		),
+	)
+
+	// Scripts are run from their target directory, so use directories that
+	// also exist outside the test filesystem.
+	c = newTestConfig(fs, withDestDir("/"))
+	c.Apply.to = "/"
+	c.Apply.withScripts = true
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, vfs.OSFS, "",
+		vfst.TestPath(evidence,
+			vfst.TestContentsString("/\n"),
+		),
+	)
+
+	// The run_once_ script was only recorded as run for the staging
+	// directory, so it is run once more for the destination directory.
+	for i := 0; i < 2; i++ {
+		c = newTestConfig(fs, withDestDir("/"))
+		require.NoError(t, c.runApplyCmd(nil, nil))
+	}
+	vfst.RunTests(t, vfs.OSFS, "",
+		vfst.TestPath(evidence,
+			vfst.TestContentsString("/\n/\n"),
+		),
+	)
+
+	c = newTestConfig(fs)
+	c.Apply.withScripts = true
+	assert.EqualError(t, c.runApplyCmd(nil, nil), "--rewrite-symlinks and --with-scripts require --to")
+}
+
+func TestApplyExcludeEncrypted(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	// fakeAge "encrypts" and "decrypts" its standard input with rot13.
+	fakeAge := filepath.Join(tempDir, "age")
+	require.NoError(t, ioutil.WriteFile(fakeAge, []byte("#!/bin/sh\ntr a-zA-Z n-za-mN-ZA-M\n"), 0o755))
+	// noKeyAge fails as if the identity is missing.
+	noKeyAge := filepath.Join(tempDir, "age-no-key")
+	require.NoError(t, ioutil.WriteFile(noKeyAge, []byte("#!/bin/sh\necho no identity >&2\nexit 1\n"), 0o755))
+
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.gnupg/gpg.conf": "use-agent\n",
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_file":             "file\n",
+			"encrypted_dot_secret": "frperg\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	newConfig := func(ageCommand string, options ...configOption) *Config {
+		c := newTestConfig(fs, options...)
+		c.Encryption.Method = "age"
+		c.Age.Command = ageCommand
+		c.Age.Identity = "/home/user/key.txt"
+		c.Age.Recipient = "age1recipient"
+		return c
+	}
+
+	c := newConfig(fakeAge)
+	c.Add.options.Encrypt = true
+	require.NoError(t, c.runAddCmd(nil, []string{"/home/user/.gnupg"}))
+	require.NoError(t, newConfig(fakeAge).runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.secret",
+			vfst.TestContentsString("secret\n"),
+		),
+	)
+	require.NoError(t, fs.RemoveAll("/home/user/.secret"))
+	require.NoError(t, fs.RemoveAll("/home/user/.file"))
+
+	// Without the key, apply fails naming the source file and suggesting
+	// --exclude-encrypted.
+	c = newConfig(noKeyAge, withStderr(ioutil.Discard))
+	err = c.runApplyCmd(nil, []string{"/home/user/.secret"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "/home/user/.local/share/chezmoi/encrypted_dot_secret: decryption failed")
+	assert.Contains(t, err.Error(), "--exclude-encrypted")
+
+	// With --exclude-encrypted, encrypted targets are skipped, including the
+	// encrypted directory, whose contents are not pruned.
+	stderr := &strings.Builder{}
+	c = newConfig(noKeyAge, withStderr(stderr))
+	c.excludeEncrypted = true
+	c.Apply.prune = true
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	assert.Equal(t, "skipped 2 encrypted target(s)\n", stderr.String())
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.file",
+			vfst.TestContentsString("file\n"),
+		),
+		vfst.TestPath("/home/user/.secret",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.gnupg/gpg.conf",
+			vfst.TestContentsString("use-agent\n"),
+		),
+	)
+
+	// encryption.exclude composes with other exclusions in diff and verify.
+	require.NoError(t, fs.WriteFile("/home/user/.file", []byte("changed\n"), 0o644))
+	stdout := &strings.Builder{}
+	stderr.Reset()
+	c = newConfig(noKeyAge, withStdout(stdout), withStderr(stderr))
+	c.Encryption.Exclude = true
+	c.Diff.NoPager = true
+	c.exclude = []string{"files"}
+	require.NoError(t, c.runDiffCmd(nil, nil))
+	assert.Equal(t, "", stdout.String())
+	assert.Equal(t, "skipped 2 encrypted target(s)\n", stderr.String())
+
+	stdout.Reset()
+	c = newConfig(noKeyAge, withStdout(stdout), withStderr(ioutil.Discard))
+	c.excludeEncrypted = true
+	assert.Equal(t, exitCodeError(1), c.runVerifyCmd(nil, nil))
+	assert.Equal(t, ".file\n", stdout.String())
+}
+
+func TestApplyModify(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.kube/config": "current-context: old\nclusters: []\n",
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_kube/modify_config": "#!/bin/sh\necho run >>" + filepath.Join(tempDir, "evidence") + "\nsed 's/old/new/'\n",
+			"modify_dot_new.tmpl":    "#!/bin/sh\ncontents=$(cat)\necho \"${contents:-{{ \"created\" }}}\"\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	// Diffs and dry runs run modify scripts, but do not write their output.
+	stdout := &strings.Builder{}
+	c := newTestConfig(fs, withStdout(stdout))
+	c.Diff.NoPager = true
+	require.NoError(t, c.runDiffCmd(nil, nil))
+	assert.Contains(t, stdout.String(), "-current-context: old\n+current-context: new\n")
+	assert.Contains(t, stdout.String(), "+created\n")
+	require.NoError(t, newTestConfig(fs, withDryRun(true), withMutator(chezmoi.NullMutator{})).runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.kube/config",
+			vfst.TestContentsString("current-context: old\nclusters: []\n"),
+		),
+		vfst.TestPath("/home/user/.new",
+			vfst.TestDoesNotExist,
+		),
+	)
+	vfst.RunTests(t, vfs.OSFS, "",
+		vfst.TestPath(filepath.Join(tempDir, "evidence"),
+			vfst.TestContentsString("run\nrun\n"),
+		),
+	)
+
+	// Targets are only rewritten if the script's output differs from them.
+	for i := 0; i < 2; i++ {
+		require.NoError(t, newTestConfig(fs).runApplyCmd(nil, nil))
+		vfst.RunTests(t, fs, "",
+			vfst.TestPath("/home/user/.kube/config",
+				vfst.TestContentsString("current-context: new\nclusters: []\n"),
+			),
+			vfst.TestPath("/home/user/.new",
+				vfst.TestContentsString("created\n"),
+			),
+		)
+	}
+	require.NoError(t, newTestConfig(fs).runVerifyCmd(nil, nil))
+
+	// Failing scripts abort apply.
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/dot_kube/modify_config", []byte("#!/bin/sh\nexit 1\n"), 0o644))
+	assert.EqualError(t, newTestConfig(fs).runApplyCmd(nil, nil), "/home/user/.local/share/chezmoi/dot_kube/modify_config: modify script: exit status 1")
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.kube/config",
+			vfst.TestContentsString("current-context: new\nclusters: []\n"),
+		),
+	)
+}
+
+func TestApplyOwners(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_bar":       "# bar\n",
+			"dot_app/conf":  "# conf\n",
+			"dot_app/other": "# other\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	owners := []ownerConfig{
+		{
+			Targets: []string{".app", ".app/conf"},
+			Owner:   "1234:5678",
+		},
+	}
+	withEUID := func(euid int) configOption {
+		ul := defaultUserLookup
+		ul.geteuid = func() int { return euid }
+		return withUserLookup(ul)
+	}
+
+	t.Run("privileged", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		c := newTestConfig(fs,
+			withDryRun(true),
+			withMutator(chezmoi.NewVerboseMutator(stdout, chezmoi.NullMutator{}, false, 0)),
+			withEUID(0),
+		)
+		c.Owners = owners
+		require.NoError(t, c.runApplyCmd(nil, nil))
+		assert.Contains(t, stdout.String(), "chown -h 1234:5678 /home/user/.app\n")
+		assert.Contains(t, stdout.String(), "chown -h 1234:5678 /home/user/.app/conf\n")
+		assert.NotContains(t, stdout.String(), "chown -h 1234:5678 /home/user/.app/other")
+		assert.NotContains(t, stdout.String(), "chown -h 1234:5678 /home/user/.bar")
+	})
+
+	t.Run("unprivileged", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		c := newTestConfig(fs,
+			withDryRun(true),
+			withMutator(chezmoi.NewVerboseMutator(stdout, chezmoi.NullMutator{}, false, 0)),
+			withStderr(stderr),
+			withEUID(1000),
+		)
+		c.Owners = owners
+		require.NoError(t, c.runApplyCmd(nil, nil))
+		assert.NotContains(t, stdout.String(), "chown")
+		assert.Equal(t, ""+
+			"warning: .app/conf: not running as root, not changing owner to 1234:5678\n"+
+			"warning: .app: not running as root, not changing owner to 1234:5678\n",
+			stderr.String())
+	})
+
+	t.Run("already_owned", func(t *testing.T) {
+		require.NoError(t, newTestConfig(fs).runApplyCmd(nil, nil))
+
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		c := newTestConfig(fs,
+			withDryRun(true),
+			withMutator(chezmoi.NewVerboseMutator(stdout, chezmoi.NullMutator{}, false, 0)),
+			withStderr(stderr),
+			withEUID(1000),
+		)
+		c.Owners = []ownerConfig{
+			{
+				Targets: []string{".bar"},
+				Owner:   strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid()),
+			},
+		}
+		require.NoError(t, c.runApplyCmd(nil, nil))
+		assert.NotContains(t, stdout.String(), "chown")
+		assert.Empty(t, stderr.String())
+	})
+
+	t.Run("missing_owner", func(t *testing.T) {
+		stderr := &bytes.Buffer{}
+		c := newTestConfig(fs,
+			withDryRun(true),
+			withMutator(chezmoi.NullMutator{}),
+			withStderr(stderr),
+			withEUID(0),
+		)
+		c.Owners = []ownerConfig{
+			{
+				Targets: []string{".app/*"},
+				Owner:   "chezmoi-missing-user",
+			},
+		}
+		require.NoError(t, c.runApplyCmd(nil, nil))
+		assert.Equal(t, "warning: owners.owner: chezmoi-missing-user: unknown user, not changing owners\n", stderr.String())
+	})
+
+	t.Run("verify", func(t *testing.T) {
+		require.NoError(t, newTestConfig(fs).runApplyCmd(nil, nil))
+		require.NoError(t, newTestConfig(fs).runVerifyCmd(nil, nil))
+
+		stdout := &bytes.Buffer{}
+		c := newTestConfig(fs, withStdout(stdout), withEUID(0))
+		c.Owners = owners
+		assert.Equal(t, exitCodeError(1), c.runVerifyCmd(nil, nil))
+		assert.Equal(t, ".app\n.app/conf\n", stdout.String())
+	})
+}
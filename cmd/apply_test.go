@@ -1,15 +1,20 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	vfs "github.com/twpayne/go-vfs"
 	"github.com/twpayne/go-vfs/vfst"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
 )
 
 type scriptTestCase struct {
@@ -149,6 +154,27 @@ func TestApplyCommand(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "include_template",
+			root: map[string]interface{}{
+				"/home/user/.local/share/chezmoi": map[string]interface{}{
+					"dir/file.tmpl":             `{{ includeTemplate "foo" "cont" }}{{ includeTemplate "bar/foo" }}`,
+					".chezmoitemplates/foo":     "{{ . }}",
+					".chezmoitemplates/bar/foo": `{{ includeTemplate "baz" (dict "suffix" (lower "ENTS")) }}`,
+					".chezmoitemplates/baz":     "{{ .suffix }}",
+				},
+			},
+		},
+		{
+			name: "ignore_with_template",
+			root: map[string]interface{}{
+				"/home/user/.local/share/chezmoi": map[string]interface{}{
+					".chezmoiignore":           `{{ template "ignore" }}`,
+					".chezmoitemplates/ignore": "ignored\n",
+					"ignored":                  "ignored\n",
+				},
+			},
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.root["/home/user/.local/share/chezmoi/dir/file"] = "contents"
@@ -350,6 +376,79 @@ func TestApplyRemove(t *testing.T) {
 				),
 			},
 		},
+		{
+			name: "remove_symlink",
+			root: map[string]interface{}{
+				"/home/user/.local/share/chezmoi/.chezmoiremove": "foo\n",
+				"/home/user/foo": &vfst.Symlink{Target: "bar"},
+			},
+			tests: []vfst.Test{
+				vfst.TestPath("/home/user/foo",
+					vfst.TestDoesNotExist,
+				),
+			},
+		},
+		{
+			name: "no_matches",
+			root: map[string]interface{}{
+				"/home/user/.local/share/chezmoi/.chezmoiremove": "missing\nmissing/**/*\n",
+				"/home/user/foo": "# contents of foo\n",
+			},
+			tests: []vfst.Test{
+				vfst.TestPath("/home/user/foo",
+					vfst.TestModeIsRegular,
+				),
+			},
+		},
+		{
+			name: "dont_remove_managed",
+			root: map[string]interface{}{
+				"/home/user/.local/share/chezmoi/.chezmoiremove": "f*\n",
+				"/home/user/.local/share/chezmoi/foo":            "# contents of foo\n",
+				"/home/user/foo":                                 "# old contents of foo\n",
+			},
+			tests: []vfst.Test{
+				vfst.TestPath("/home/user/foo",
+					vfst.TestModeIsRegular,
+					vfst.TestContentsString("# contents of foo\n"),
+				),
+			},
+		},
+		{
+			name: "dont_remove_outside_dest_dir",
+			root: map[string]interface{}{
+				"/home/user/.local/share/chezmoi/.chezmoiremove": "..\n../foo\n../user2/*\n",
+				"/home/foo":        "# contents of foo\n",
+				"/home/user2/file": "# contents of file\n",
+			},
+			tests: []vfst.Test{
+				vfst.TestPath("/home/user",
+					vfst.TestIsDir,
+				),
+				vfst.TestPath("/home/foo",
+					vfst.TestModeIsRegular,
+				),
+				vfst.TestPath("/home/user2/file",
+					vfst.TestModeIsRegular,
+				),
+			},
+		},
+		{
+			name: "dont_remove_through_symlink",
+			root: map[string]interface{}{
+				"/home/user/.local/share/chezmoi/.chezmoiremove": "link/*\n**/file\n",
+				"/home/user/link":  &vfst.Symlink{Target: "../user2"},
+				"/home/user2/file": "# contents of file\n",
+			},
+			tests: []vfst.Test{
+				vfst.TestPath("/home/user/link",
+					vfst.TestModeType(os.ModeSymlink),
+				),
+				vfst.TestPath("/home/user2/file",
+					vfst.TestModeIsRegular,
+				),
+			},
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			fs, cleanup, err := vfst.NewTestFS(tc.root)
@@ -366,6 +465,31 @@ func TestApplyRemove(t *testing.T) {
 	}
 }
 
+func TestApplyRemoveDryRunVerbose(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi/.chezmoiremove": "foo\n",
+		"/home/user/foo": map[string]interface{}{
+			"bar": "# contents of bar\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	stdout := &strings.Builder{}
+	c := newTestConfig(
+		fs,
+		withDryRun(true),
+		withMutator(chezmoi.NewSummaryMutator(stdout, chezmoi.NullMutator{}, fs, false, "/home/user", true)),
+		withRemove(true),
+	)
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	assert.Equal(t, "would remove foo\n", stdout.String())
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/foo/bar",
+			vfst.TestModeIsRegular,
+		),
+	)
+}
+
 func TestApplyScript(t *testing.T) {
 	tempDir, err := ioutil.TempDir("", "chezmoi")
 	require.NoError(t, err)
@@ -424,7 +548,7 @@ func TestApplyRunOnce(t *testing.T) {
 
 	require.NoError(t, c.runApplyCmd(nil, nil))
 	vfst.RunTests(t, fs, "",
-		vfst.TestPath("/home/user/.config/chezmoi/chezmoistate.boltdb",
+		vfst.TestPath("/home/user/.local/state/chezmoi/chezmoistate.boltdb",
 			vfst.TestModeIsRegular,
 		),
 	)
@@ -485,3 +609,822 @@ func TestApplyRemoveEmptySymlink(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyWarnEncryptedPrivate(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"encrypted_foo":         "ciphertext",
+			"encrypted_private_bar": "ciphertext",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	stderr := &strings.Builder{}
+	c := newTestConfig(fs)
+	c.Stderr = stderr
+	ts, err := c.getTargetState(nil)
+	require.NoError(t, err)
+	persistentState, err := c.getPersistentState(nil)
+	require.NoError(t, err)
+	defer persistentState.Close()
+
+	require.NoError(t, c.warnEncryptedPrivate(ts, persistentState))
+	assert.Contains(t, stderr.String(), filepath.Join("/home/user/foo")+": encrypted")
+	assert.NotContains(t, stderr.String(), filepath.Join("/home/user/bar"))
+
+	stderr.Reset()
+	require.NoError(t, c.warnEncryptedPrivate(ts, persistentState))
+	assert.Equal(t, "", stderr.String())
+}
+
+// A failWriteFileMutator is a chezmoi.Mutator that fails when writing a
+// specific file.
+type failWriteFileMutator struct {
+	chezmoi.Mutator
+	filename string
+}
+
+func (m failWriteFileMutator) WriteFile(filename string, data []byte, perm os.FileMode, currData []byte) error {
+	if filename == m.filename {
+		return errors.New("write failed")
+	}
+	return m.Mutator.WriteFile(filename, data, perm, currData)
+}
+
+func TestApplyResume(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_a": "a",
+			"dot_b": "b",
+			"dot_c": "c",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	c := newTestConfig(fs, withMutator(failWriteFileMutator{
+		Mutator:  chezmoi.NewFSMutator(fs),
+		filename: filepath.Join("/home/user/.b"),
+	}))
+	assert.Error(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.a",
+			vfst.TestContentsString("a"),
+		),
+		vfst.TestPath("/home/user/.c",
+			vfst.TestDoesNotExist,
+		),
+	)
+
+	// Modify a target completed by the failed apply so that resuming can be
+	// detected.
+	require.NoError(t, fs.WriteFile("/home/user/.a", []byte("modified"), 0o644))
+
+	// A dry run does not change the progress of the failed apply.
+	c = newTestConfig(fs, withDryRun(true), withMutator(chezmoi.NullMutator{}))
+	require.NoError(t, c.runApplyCmd(nil, nil))
+
+	c = newTestConfig(fs)
+	c.Apply.resume = true
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.a",
+			vfst.TestContentsString("modified"),
+		),
+		vfst.TestPath("/home/user/.b",
+			vfst.TestContentsString("b"),
+		),
+		vfst.TestPath("/home/user/.c",
+			vfst.TestContentsString("c"),
+		),
+	)
+
+	// The successful apply cleared the progress, so resuming applies
+	// everything.
+	c = newTestConfig(fs)
+	c.Apply.resume = true
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.a",
+			vfst.TestContentsString("a"),
+		),
+	)
+}
+
+// A panicWriteFileMutator is a chezmoi.Mutator that panics when writing a
+// specific file, as if chezmoi were interrupted.
+type panicWriteFileMutator struct {
+	chezmoi.Mutator
+	filename string
+}
+
+func (m panicWriteFileMutator) WriteFile(filename string, data []byte, perm os.FileMode, currData []byte) error {
+	if filename == m.filename {
+		panic("interrupted")
+	}
+	return m.Mutator.WriteFile(filename, data, perm, currData)
+}
+
+func TestApplyResumeInterrupted(t *testing.T) {
+	sourceFiles := make(map[string]interface{})
+	for i := 0; i < applyProgressInterval+applyProgressInterval/2; i++ {
+		name := fmt.Sprintf("%03d", i)
+		sourceFiles["dot_"+name] = name
+	}
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": sourceFiles,
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	// Interrupt the apply after more than applyProgressInterval targets have
+	// been written.
+	interruptedName := fmt.Sprintf("%03d", applyProgressInterval+applyProgressInterval/4)
+	c := newTestConfig(fs, withMutator(panicWriteFileMutator{
+		Mutator:  chezmoi.NewFSMutator(fs),
+		filename: filepath.Join("/home/user", "."+interruptedName),
+	}))
+	assert.Panics(t, func() {
+		_ = c.runApplyCmd(nil, nil)
+	})
+
+	// Modify a target whose completion was recorded, and a target that was
+	// written after the progress was last recorded.
+	recordedName := fmt.Sprintf("%03d", 0)
+	unrecordedName := fmt.Sprintf("%03d", applyProgressInterval)
+	for _, name := range []string{recordedName, unrecordedName} {
+		require.NoError(t, fs.WriteFile(filepath.Join("/home/user", "."+name), []byte("modified"), 0o644))
+	}
+
+	c = newTestConfig(fs)
+	c.Apply.resume = true
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath(filepath.Join("/home/user", "."+recordedName),
+			vfst.TestContentsString("modified"),
+		),
+		vfst.TestPath(filepath.Join("/home/user", "."+unrecordedName),
+			vfst.TestContentsString(unrecordedName),
+		),
+		vfst.TestPath(filepath.Join("/home/user", "."+interruptedName),
+			vfst.TestContentsString(interruptedName),
+		),
+	)
+}
+
+func TestApplyResumeSourceStateChanged(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_a": "a",
+			"dot_b": "b",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	c := newTestConfig(fs, withMutator(failWriteFileMutator{
+		Mutator:  chezmoi.NewFSMutator(fs),
+		filename: filepath.Join("/home/user/.b"),
+	}))
+	assert.Error(t, c.runApplyCmd(nil, nil))
+
+	require.NoError(t, fs.WriteFile("/home/user/.a", []byte("modified"), 0o644))
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/dot_b", []byte("b2"), 0o644))
+
+	c = newTestConfig(fs)
+	c.Apply.resume = true
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.a",
+			vfst.TestContentsString("a"),
+		),
+		vfst.TestPath("/home/user/.b",
+			vfst.TestContentsString("b2"),
+		),
+	)
+}
+
+func TestApplyExclude(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_bar": "bar",
+			"dot_dir": map[string]interface{}{
+				"baz": "baz",
+				"qux": "qux",
+			},
+			"dot_foo": "foo",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	c := newTestConfig(fs)
+	c.exclude = []string{"/home/user/.foo", "/home/user/.dir/q*"}
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.bar",
+			vfst.TestContentsString("bar"),
+		),
+		vfst.TestPath("/home/user/.dir/baz",
+			vfst.TestContentsString("baz"),
+		),
+		vfst.TestPath("/home/user/.dir/qux",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.foo",
+			vfst.TestDoesNotExist,
+		),
+	)
+}
+
+func TestApplyExcludeEntryTypes(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_dir": map[string]interface{}{
+				"file":            "file",
+				"symlink_symlink": "file",
+			},
+			"dot_empty/.keep":     "",
+			"symlink_dot_symlink": ".dir/file",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	c := newTestConfig(fs)
+	c.exclude = []string{"dirs", "symlinks"}
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.dir/file",
+			vfst.TestContentsString("file"),
+		),
+		vfst.TestPath("/home/user/.dir/symlink",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.empty",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.symlink",
+			vfst.TestDoesNotExist,
+		),
+	)
+}
+
+func TestApplyExcludeEntryTypeNamedTargets(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dirs":    "dirs",
+			"scripts": "scripts",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	// Entry types do not also exclude targets with the same name in the
+	// working directory.
+	c := newTestConfig(fs)
+	c.workingDir = "/home/user"
+	c.exclude = []string{"dirs", "scripts"}
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/dirs",
+			vfst.TestContentsString("dirs"),
+		),
+		vfst.TestPath("/home/user/scripts",
+			vfst.TestContentsString("scripts"),
+		),
+	)
+
+	// Nor does excluding scripts when applying to a staging directory.
+	c = newTestConfig(fs)
+	c.workingDir = "/stage"
+	c.Apply.to = "/stage"
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/stage/scripts",
+			vfst.TestContentsString("scripts"),
+		),
+	)
+
+	// Such targets are excluded by their paths.
+	c = newTestConfig(fs)
+	c.workingDir = "/stage2"
+	c.Apply.to = "/stage2"
+	c.exclude = []string{"./scripts"}
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/stage2/dirs",
+			vfst.TestContentsString("dirs"),
+		),
+		vfst.TestPath("/stage2/scripts",
+			vfst.TestDoesNotExist,
+		),
+	)
+}
+
+func TestApplyIncludeEntryTypes(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_dir": map[string]interface{}{
+				"subdir/file":     "file",
+				"symlink_symlink": "subdir/file",
+			},
+			"dot_empty/.keep": "",
+			"run_fail":        "#!/bin/sh\nexit 1\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	c := newTestConfig(fs)
+	c.include = []string{"files"}
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.dir/subdir/file",
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("file"),
+		),
+		vfst.TestPath("/home/user/.dir/symlink",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.empty",
+			vfst.TestDoesNotExist,
+		),
+	)
+
+	c = newTestConfig(fs)
+	c.include = []string{"scripts"}
+	assert.Error(t, c.runApplyCmd(nil, nil))
+
+	c = newTestConfig(fs)
+	c.include = []string{"symlinks", "unknown"}
+	assert.EqualError(t, c.runApplyCmd(nil, nil), "unknown: unknown entry type")
+}
+
+func TestFiltersEntries(t *testing.T) {
+	for _, tc := range []struct {
+		include  []string
+		exclude  []string
+		expected bool
+	}{
+		{expected: false},
+		{include: []string{"all"}, expected: false},
+		{include: []string{"dirs", "files", "scripts", "symlinks"}, expected: false},
+		{include: []string{"files"}, expected: true},
+		{include: []string{"unknown"}, expected: true},
+		{include: []string{"all"}, exclude: []string{"scripts"}, expected: true},
+		{include: []string{"all"}, exclude: []string{".bashrc"}, expected: true},
+	} {
+		t.Run(strings.Join(append(tc.include, tc.exclude...), "_"), func(t *testing.T) {
+			c := newTestConfig(vfs.OSFS)
+			c.exclude = tc.exclude
+			assert.Equal(t, tc.expected, c.filtersEntries(tc.include))
+		})
+	}
+}
+
+func TestApplySubtree(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.config": &vfst.Dir{Perm: 0o755},
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			".chezmoiignore":  ".config/nvim/ignored\n",
+			"dot_broken.tmpl": "{{ fail \"broken\" }}",
+			"dot_config": map[string]interface{}{
+				"nvim": map[string]interface{}{
+					"ignored":  "ignored",
+					"init.vim": "init.vim",
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	require.Error(t, newTestConfig(fs).runApplyCmd(nil, nil))
+
+	// Only the parts of the source state needed for the arguments are
+	// populated, so the broken template is not executed.
+	require.NoError(t, newTestConfig(fs).runApplyCmd(nil, []string{"/home/user/.config/nvim"}))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.broken",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.config/nvim/ignored",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.config/nvim/init.vim",
+			vfst.TestContentsString("init.vim"),
+		),
+	)
+}
+
+func TestGetArgsPopulateOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name                string
+		args                []string
+		relativeToDest      bool
+		expectedTargetNames []string
+	}{
+		{
+			name: "no_args",
+		},
+		{
+			name:                "absolute",
+			args:                []string{"/home/user/.bashrc", "/home/user/.config/nvim"},
+			expectedTargetNames: []string{".bashrc", filepath.Join(".config", "nvim")},
+		},
+		{
+			name: "relative",
+			args: []string{".bashrc"},
+		},
+		{
+			name:                "relative_to_dest",
+			args:                []string{".bashrc"},
+			relativeToDest:      true,
+			expectedTargetNames: []string{".bashrc"},
+		},
+		{
+			name: "glob",
+			args: []string{"/home/user/.b*"},
+		},
+		{
+			name: "dest_dir",
+			args: []string{"/home/user"},
+		},
+		{
+			name: "outside_dest_dir",
+			args: []string{"/etc/hosts"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestConfig(nil)
+			c.relativeToDest = tc.relativeToDest
+			populateOptions := c.getArgsPopulateOptions(tc.args)
+			if tc.expectedTargetNames == nil {
+				assert.Nil(t, populateOptions)
+				return
+			}
+			require.NotNil(t, populateOptions)
+			assert.Equal(t, tc.expectedTargetNames, populateOptions.TargetNames)
+		})
+	}
+}
+
+func TestApplyPrune(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_a": "a",
+			"dot_b": "b",
+			"dot_c": "c",
+			"dot_d": "d",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	require.NoError(t, newTestConfig(fs).runApplyCmd(nil, nil))
+
+	require.NoError(t, fs.Remove("/home/user/.local/share/chezmoi/dot_b"))
+	require.NoError(t, fs.Remove("/home/user/.local/share/chezmoi/dot_c"))
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/.chezmoiignore", []byte(".d\n"), 0o644))
+
+	c := newTestConfig(fs)
+	c.Apply.noPrune = true
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.b",
+			vfst.TestContentsString("b"),
+		),
+		vfst.TestPath("/home/user/.c",
+			vfst.TestContentsString("c"),
+		),
+	)
+
+	// Targets are prompted for in reverse order.
+	c = newTestConfig(fs, withStdin(strings.NewReader("y\nn\n")), withStdout(ioutil.Discard))
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.a",
+			vfst.TestContentsString("a"),
+		),
+		vfst.TestPath("/home/user/.b",
+			vfst.TestContentsString("b"),
+		),
+		vfst.TestPath("/home/user/.c",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.d",
+			vfst.TestContentsString("d"),
+		),
+	)
+
+	// Ignored targets are still tracked, so they are pruned once they are
+	// removed from the source state and no longer ignored.
+	require.NoError(t, fs.Remove("/home/user/.local/share/chezmoi/dot_d"))
+	require.NoError(t, fs.Remove("/home/user/.local/share/chezmoi/.chezmoiignore"))
+	c = newTestConfig(fs)
+	c.Apply.prune = true
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.b",
+			vfst.TestContentsString("b"),
+		),
+		vfst.TestPath("/home/user/.d",
+			vfst.TestDoesNotExist,
+		),
+	)
+
+	// Applied targets are recorded separately for each destination
+	// directory.
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/dot_e", []byte("e"), 0o644))
+	c = newTestConfig(fs, withDestDir("/tmp/dest"))
+	require.NoError(t, vfs.MkdirAll(fs, "/tmp/dest", 0o755))
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	require.NoError(t, fs.Remove("/home/user/.local/share/chezmoi/dot_e"))
+	c = newTestConfig(fs)
+	c.Apply.prune = true
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/tmp/dest/.e",
+			vfst.TestContentsString("e"),
+		),
+	)
+	c = newTestConfig(fs, withDestDir("/tmp/dest"))
+	c.Apply.prune = true
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/tmp/dest/.e",
+			vfst.TestDoesNotExist,
+		),
+	)
+}
+
+func TestApplySkipTargets(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".config/app": map[string]interface{}{
+				"config": "# old\n",
+				"state":  "# old\n",
+			},
+			".local/share/chezmoi": map[string]interface{}{
+				"dot_config/app": map[string]interface{}{
+					"config": "# new\n",
+					"state":  "# new\n",
+				},
+				"dot_foo": "foo",
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	stderr := &strings.Builder{}
+	c := newTestConfig(fs, withStderr(stderr))
+	c.SkipTargets = []string{"~/.config/app/state", "/home/user/.foo"}
+	c.Verbose = true
+	c.exclude = []string{"/home/user/.config/app/state"}
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	assert.Equal(t, "skipped 2 target(s) matching skipTargets\n", stderr.String())
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.config/app/config",
+			vfst.TestContentsString("# new\n"),
+		),
+		vfst.TestPath("/home/user/.config/app/state",
+			vfst.TestContentsString("# old\n"),
+		),
+		vfst.TestPath("/home/user/.foo",
+			vfst.TestDoesNotExist,
+		),
+	)
+
+	c = newTestConfig(fs)
+	c.SkipTargets = []string{"~/.config/app/state", "/home/user/.foo"}
+	require.NoError(t, c.runApplyCmd(nil, []string{"/home/user/.config/app"}))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.config/app/state",
+			vfst.TestContentsString("# old\n"),
+		),
+	)
+
+	require.NoError(t, c.runApplyCmd(nil, []string{"/home/user/.config/app/state", "/home/user/.foo"}))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.config/app/state",
+			vfst.TestContentsString("# new\n"),
+		),
+		vfst.TestPath("/home/user/.foo",
+			vfst.TestContentsString("foo"),
+		),
+	)
+}
+
+func TestApplyLinkTemplate(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi/link_dot_bashrc.tmpl": "# .bashrc\n",
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	c := newTestConfig(fs)
+	assert.Error(t, c.runApplyCmd(nil, nil))
+}
+
+func TestApplyExactIgnored(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.cache": map[string]interface{}{
+			"app": map[string]interface{}{
+				"host.cache": "host\n",
+				"old":        "old\n",
+			},
+			"keep":  "keep\n",
+			"local": "local\n",
+			"stale": "stale\n",
+		},
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			".chezmoiignore":       ".cache/local\n.cache/**/*.cache\n",
+			"exact_dot_cache/keep": "keep\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	stdout := &strings.Builder{}
+	c := newTestConfig(
+		fs,
+		withMutator(chezmoi.NewSummaryMutator(stdout, chezmoi.NewFSMutator(fs), fs, false, "", false)),
+	)
+	c.Verbose = true
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	assert.Equal(t, strings.Join([]string{
+		"skipped /home/user/.cache/app/host.cache (ignored)",
+		"removed /home/user/.cache/app/old",
+		"skipped /home/user/.cache/local (ignored)",
+		"removed /home/user/.cache/stale",
+		"",
+	}, "\n"), stdout.String())
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.cache/app/host.cache",
+			vfst.TestContentsString("host\n"),
+		),
+		vfst.TestPath("/home/user/.cache/app/old",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.cache/keep",
+			vfst.TestContentsString("keep\n"),
+		),
+		vfst.TestPath("/home/user/.cache/local",
+			vfst.TestContentsString("local\n"),
+		),
+		vfst.TestPath("/home/user/.cache/stale",
+			vfst.TestDoesNotExist,
+		),
+	)
+}
+
+func TestApplyEmptyDirs(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.exact/old":     "old\n",
+		"/home/user/.sockets/a":     "a\n",
+		"/home/user/.sockets/local": "local\n",
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			".chezmoiignore":            ".sockets/local\n",
+			"empty_dot_cache/.keep":     "",
+			"exact_dot_exact/.keep":     "",
+			"private_empty_dot_sockets": &vfst.Dir{Perm: 0o755},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	// Empty directories are created, and their contents are removed, except
+	// for ignored targets. Exact directories without entries behave the same.
+	for i := 0; i < 2; i++ {
+		c := newTestConfig(fs)
+		c.Apply.prune = true
+		require.NoError(t, c.runApplyCmd(nil, nil))
+		vfst.RunTests(t, fs, "",
+			vfst.TestPath("/home/user/.cache",
+				vfst.TestIsDir,
+				vfst.TestModePerm(0o755),
+			),
+			vfst.TestPath("/home/user/.exact/old",
+				vfst.TestDoesNotExist,
+			),
+			vfst.TestPath("/home/user/.sockets",
+				vfst.TestIsDir,
+				vfst.TestModePerm(0o700),
+			),
+			vfst.TestPath("/home/user/.sockets/a",
+				vfst.TestDoesNotExist,
+			),
+			vfst.TestPath("/home/user/.sockets/local",
+				vfst.TestContentsString("local\n"),
+			),
+		)
+	}
+
+	// Targets cannot be added inside empty directories.
+	require.NoError(t, fs.WriteFile("/home/user/.cache/file", []byte("file\n"), 0o644))
+	assert.EqualError(t, newTestConfig(fs).runAddCmd(nil, []string{"/home/user/.cache/file"}), "/home/user/.cache/file: inside empty directory /home/user/.cache")
+}
+
+func TestApplyEmptyDirsInconsistent(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		root          map[string]interface{}
+		sourceDirs    []string
+		expectedError string
+	}{
+		{
+			name: "empty_dir_with_entries",
+			root: map[string]interface{}{
+				"/home/user/.local/share/chezmoi/empty_dot_cache/file": "file\n",
+			},
+			expectedError: "/home/user/.local/share/chezmoi/empty_dot_cache: contains file, but the empty_ prefix makes target .cache an empty directory",
+		},
+		{
+			name: "empty_dir_with_entries_from_other_source_dir",
+			root: map[string]interface{}{
+				"/home/user/public/dot_cache/file":      "file\n",
+				"/home/user/work/empty_dot_cache/.keep": "",
+			},
+			sourceDirs:    []string{"/home/user/public", "/home/user/work"},
+			expectedError: "/home/user/work/empty_dot_cache: contains file, but the empty_ prefix makes target .cache an empty directory",
+		},
+		{
+			name: "dir_named_empty_before_empty_attribute",
+			root: map[string]interface{}{
+				"/home/user/.local/share/chezmoi/dir/file":        "file\n",
+				"/home/user/.local/share/chezmoi/empty_dir/.keep": "",
+			},
+			expectedError: "/home/user/.local/share/chezmoi/empty_dir: contains file, but the empty_ prefix makes target dir an empty directory",
+		},
+		{
+			name: "dir_replaced_by_symlink",
+			root: map[string]interface{}{
+				"/home/user/.local/share/chezmoi/dot_config/git":     "# git\n",
+				"/home/user/.local/share/chezmoi/symlink_dot_config": ".dotfiles/config\n",
+			},
+			expectedError: "/home/user/.local/share/chezmoi/symlink_dot_config: replaces directory .config, which contains managed targets",
+		},
+		{
+			name: "dir_replaced_by_file_from_other_source_dir",
+			root: map[string]interface{}{
+				"/home/user/public/dot_config/git": "# git\n",
+				"/home/user/work/dot_config":       "# config\n",
+			},
+			sourceDirs:    []string{"/home/user/public", "/home/user/work"},
+			expectedError: "/home/user/work/dot_config: replaces directory .config, which contains managed targets",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(tc.root)
+			require.NoError(t, err)
+			defer cleanup()
+			c := newTestConfig(fs)
+			if len(tc.sourceDirs) != 0 {
+				c.SourceDir = tc.sourceDirs[len(tc.sourceDirs)-1]
+				c.SourceDirs = tc.sourceDirs
+			}
+			assert.EqualError(t, c.runApplyCmd(nil, nil), tc.expectedError)
+		})
+	}
+}
+
+func TestApplyCreate(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.existing": "modified\n",
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"create_dot_existing.tmpl": "{{ .missing }}\n",
+			"create_dot_missing":       "initial\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	// Existing targets are up to date, so their templates are not even
+	// executed, and missing targets are created.
+	stdout := &strings.Builder{}
+	c := newTestConfig(fs, withStdout(stdout))
+	c.Diff.NoPager = true
+	require.NoError(t, c.runDiffCmd(nil, nil))
+	assert.NotContains(t, stdout.String(), ".existing")
+	assert.Contains(t, stdout.String(), ".missing")
+
+	require.NoError(t, newTestConfig(fs).runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.existing",
+			vfst.TestContentsString("modified\n"),
+		),
+		vfst.TestPath("/home/user/.missing",
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("initial\n"),
+		),
+	)
+
+	// Once created, targets are not overwritten.
+	require.NoError(t, fs.WriteFile("/home/user/.missing", []byte("modified\n"), 0o600))
+	require.NoError(t, newTestConfig(fs).runVerifyCmd(nil, nil))
+	require.NoError(t, newTestConfig(fs).runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.missing",
+			vfst.TestContentsString("modified\n"),
+		),
+	)
+}
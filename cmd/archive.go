@@ -2,33 +2,135 @@ package cmd
 
 import (
 	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
 )
 
+type archiveCmdConfig struct {
+	decrypt bool
+	format  string
+	gzip    bool
+	include []string
+	output  string
+}
+
 var archiveCmd = &cobra.Command{
 	Use:     "archive",
 	Args:    cobra.NoArgs,
-	Short:   "Write a tar archive of the target state to stdout",
+	Short:   "Write a tar or zip archive of the target state to stdout",
 	Long:    mustGetLongHelp("archive"),
 	Example: getExample("archive"),
 	PreRunE: config.ensureNoError,
 	RunE:    config.runArchiveCmd,
 }
 
+var archiveFormats = []string{"tar", "zip"}
+
 func init() {
 	rootCmd.AddCommand(archiveCmd)
+
+	persistentFlags := archiveCmd.PersistentFlags()
+	persistentFlags.BoolVar(&config.archive.decrypt, "decrypt", false, "include the decrypted contents of encrypted files")
+	persistentFlags.StringArrayVar(&config.exclude, "exclude", nil, "exclude entry types or targets matching pattern")
+	persistentFlags.StringVarP(&config.archive.format, "format", "f", "tar", "format ("+strings.Join(archiveFormats, ", ")+")")
+	persistentFlags.BoolVarP(&config.archive.gzip, "gzip", "z", false, "compress the archive with gzip")
+	persistentFlags.StringSliceVarP(&config.archive.include, "include", "i", []string{"all"}, "include entry types")
+	persistentFlags.StringVarP(&config.archive.output, "output", "o", "", "output filename")
+	panicOnError(archiveCmd.MarkPersistentFlagFilename("output"))
+	panicOnError(archiveCmd.RegisterFlagCompletionFunc("format", completeWords(archiveFormats)))
+	panicOnError(archiveCmd.RegisterFlagCompletionFunc("include", completeCommaSeparatedWords(entryTypeWords)))
 }
 
 func (c *Config) runArchiveCmd(cmd *cobra.Command, args []string) error {
+	encryptedMode, err := c.getEncryptedMode(c.archive.decrypt)
+	if err != nil {
+		return err
+	}
 	ts, err := c.getTargetState(nil)
 	if err != nil {
 		return err
 	}
-	w := tar.NewWriter(c.Stdout)
-	if err := ts.Archive(w, os.FileMode(c.Umask)); err != nil {
+	include, err := c.getEntryFilter(ts, c.archive.include)
+	if err != nil {
 		return err
 	}
-	return w.Close()
+	ts.Filter(include)
+
+	if c.archive.output == "" {
+		return c.writeArchive(c.Stdout, ts, encryptedMode)
+	}
+
+	// Write the archive to a temporary file next to the output and only
+	// rename it when it is complete, so that a failure does not leave a
+	// truncated archive. Archives of decrypted files contain secrets.
+	perm := os.FileMode(0o666)
+	if c.archive.decrypt {
+		perm = 0o600
+	}
+	tempPath := c.archive.output + ".chezmoi-tmp"
+	f, err := c.fs.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if err := c.writeArchive(f, ts, encryptedMode); err != nil {
+		_ = f.Close()
+		_ = c.fs.Remove(tempPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = c.fs.Remove(tempPath)
+		return err
+	}
+	if err := c.fs.Rename(tempPath, c.archive.output); err != nil {
+		_ = c.fs.Remove(tempPath)
+		return err
+	}
+	return nil
+}
+
+// writeArchive writes an archive of ts in the configured format to output.
+func (c *Config) writeArchive(output io.Writer, ts *chezmoi.TargetState, encryptedMode chezmoi.EncryptedMode) error {
+	switch strings.ToLower(c.archive.format) {
+	case "", "tar":
+		var w *tar.Writer
+		var gzipWriter *gzip.Writer
+		if c.archive.gzip {
+			gzipWriter = gzip.NewWriter(output)
+			w = tar.NewWriter(gzipWriter)
+		} else {
+			w = tar.NewWriter(output)
+		}
+		if err := ts.ArchiveTAR(w, ts.Umask, encryptedMode); err != nil {
+			return err
+		}
+		// The tar writer must be closed before the gzip writer so that the
+		// end of the tar archive is compressed.
+		if err := w.Close(); err != nil {
+			return err
+		}
+		if gzipWriter != nil {
+			return gzipWriter.Close()
+		}
+		return nil
+	case "zip":
+		if c.archive.gzip {
+			return errors.New("--gzip cannot be used with --format=zip")
+		}
+		w := zip.NewWriter(output)
+		if err := ts.ArchiveZIP(w, ts.Umask, encryptedMode); err != nil {
+			return err
+		}
+		return w.Close()
+	default:
+		return fmt.Errorf("%s: unknown format", c.archive.format)
+	}
 }
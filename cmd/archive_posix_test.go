@@ -0,0 +1,178 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+func TestArchiveAndDumpEncrypted(t *testing.T) {
+	// fakeGPG "decrypts" every file to the same plaintext.
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	fakeGPG := filepath.Join(tempDir, "gpg")
+	require.NoError(t, ioutil.WriteFile(fakeGPG, []byte("#!/bin/sh\necho plaintext secret > \"$2\"\n"), 0o755))
+
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_file":                       "contents\n",
+			"private_dot_ssh/encrypted_id_1": "ciphertext\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	archive := func(options ...configOption) map[string]string {
+		stdout := &bytes.Buffer{}
+		c := newTestConfig(fs, append([]configOption{withStdout(stdout)}, options...)...)
+		c.GPG.Command = fakeGPG
+		require.NoError(t, c.runArchiveCmd(nil, nil))
+		assert.NotContains(t, stdout.String(), "plaintext secret")
+		files := make(map[string]string)
+		r := tar.NewReader(stdout)
+		for {
+			h, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			data, err := ioutil.ReadAll(r)
+			require.NoError(t, err)
+			files[h.Name] = string(data)
+		}
+		return files
+	}
+
+	assert.Equal(t, map[string]string{
+		".file":                                 "contents\n",
+		".ssh":                                  "",
+		filepath.Join(".ssh", "encrypted_id_1"): "ciphertext\n",
+	}, archive())
+
+	assert.Equal(t, map[string]string{
+		".file": "contents\n",
+		".ssh":  "",
+	}, archive(func(c *Config) {
+		c.Encryption.Export = "skip"
+	}))
+
+	stdout := &bytes.Buffer{}
+	c := newTestConfig(fs, withStdout(stdout))
+	c.GPG.Command = fakeGPG
+	c.archive.decrypt = true
+	require.NoError(t, c.runArchiveCmd(nil, nil))
+	assert.Contains(t, stdout.String(), "plaintext secret")
+
+	stdout.Reset()
+	c = newTestConfig(fs, withStdout(stdout), withDumpCmdConfig(dumpCmdConfig{
+		format:    "json",
+		recursive: true,
+	}))
+	c.GPG.Command = fakeGPG
+	require.NoError(t, c.runDumpCmd(nil, nil))
+	assert.NotContains(t, stdout.String(), "plaintext secret")
+	assert.Contains(t, stdout.String(), "ciphertext")
+
+	stdout.Reset()
+	c = newTestConfig(fs, withStdout(stdout), withDumpCmdConfig(dumpCmdConfig{
+		decrypt:   true,
+		format:    "json",
+		recursive: true,
+	}))
+	c.GPG.Command = fakeGPG
+	require.NoError(t, c.runDumpCmd(nil, nil))
+	assert.Contains(t, stdout.String(), "plaintext secret")
+}
+
+func TestArchiveModesMatchApply(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": &vfst.Dir{Perm: 0o755},
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_file":                      "file\n",
+			"executable_dot_script":         "#!/bin/sh\n",
+			"private_dot_ssh/private_id":    "id\n",
+			"private_dot_ssh/config":        "config\n",
+			"exact_dot_bin/executable_tool": "#!/bin/sh\n",
+			"perm_2750_shared/file":         "shared\n",
+			"perm_1777_tmp/perm_0600_file":  "tmp\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	stdout := &bytes.Buffer{}
+	c := newTestConfig(fs, withStdout(stdout))
+	require.NoError(t, c.runArchiveCmd(nil, nil))
+	archiveModes := make(map[string]int64)
+	r := tar.NewReader(stdout)
+	for {
+		h, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		archiveModes[h.Name] = h.Mode
+	}
+
+	c = newTestConfig(fs)
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	applyModes := make(map[string]int64)
+	for name := range archiveModes {
+		info, err := fs.Lstat(filepath.Join("/home/user", name))
+		require.NoError(t, err)
+		mode := int64(info.Mode().Perm())
+		if info.Mode()&os.ModeSetgid != 0 {
+			mode |= 0o2000
+		}
+		if info.Mode()&os.ModeSticky != 0 {
+			mode |= 0o1000
+		}
+		applyModes[name] = mode
+	}
+
+	assert.Equal(t, applyModes, archiveModes)
+	assert.Equal(t, int64(0o700), archiveModes[".ssh"])
+	assert.Equal(t, int64(0o600), archiveModes[filepath.Join(".ssh", "id")])
+	assert.Equal(t, int64(0o755), archiveModes[filepath.Join(".bin", "tool")])
+	assert.Equal(t, int64(0o2750), archiveModes["shared"])
+	assert.Equal(t, int64(0o1777), archiveModes["tmp"])
+}
+
+func TestArchiveGzipTar(t *testing.T) {
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("tar not found in $PATH")
+	}
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dir/file":        "contents",
+			"symlink_symlink": "target",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	c := newTestConfig(fs)
+	c.archive.gzip = true
+	c.archive.output = "/home/user/archive.tar.gz"
+	require.NoError(t, c.runArchiveCmd(nil, nil))
+
+	archivePath, err := fs.RawPath("/home/user/archive.tar.gz")
+	require.NoError(t, err)
+	output, err := exec.Command("tar", "-tzf", archivePath).Output()
+	require.NoError(t, err)
+	assert.Equal(t, "dir\ndir/file\nsymlink\n", string(output))
+}
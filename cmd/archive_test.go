@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
 	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -47,3 +50,207 @@ func TestArchiveCmd(t *testing.T) {
 	_, err = r.Next()
 	assert.Equal(t, err, io.EOF)
 }
+
+func TestArchiveCmdOwners(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi/dir/file": "contents",
+		"/home/user/.local/share/chezmoi/other":    "contents",
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	stdout := &bytes.Buffer{}
+	c := newTestConfig(
+		fs,
+		withStdout(stdout),
+	)
+	c.Owners = []ownerConfig{
+		{
+			Targets: []string{"dir/**"},
+			Owner:   "1234:5678",
+		},
+	}
+	assert.NoError(t, c.runArchiveCmd(nil, nil))
+	r := tar.NewReader(stdout)
+	owners := make(map[string][2]int)
+	for {
+		h, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		owners[filepath.ToSlash(h.Name)] = [2]int{h.Uid, h.Gid}
+	}
+	assert.Equal(t, [2]int{1234, 5678}, owners["dir/file"])
+	assert.NotEqual(t, [2]int{1234, 5678}, owners["dir"])
+	assert.NotEqual(t, [2]int{1234, 5678}, owners["other"])
+}
+
+func TestArchiveCmdPerm(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi/perm_2750_dir/perm_0640_file": "contents",
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	stdout := &bytes.Buffer{}
+	c := newTestConfig(
+		fs,
+		withStdout(stdout),
+	)
+	assert.NoError(t, c.runArchiveCmd(nil, nil))
+	r := tar.NewReader(stdout)
+
+	h, err := r.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "dir", h.Name)
+	assert.Equal(t, int64(0o2750), h.Mode)
+
+	h, err = r.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join("dir", "file"), h.Name)
+	assert.Equal(t, int64(0o640), h.Mode)
+
+	_, err = r.Next()
+	assert.Equal(t, err, io.EOF)
+}
+
+func TestArchiveCmdInclude(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dir/file":        "contents",
+			"emptydir/.keep":  "",
+			"scripts_dir":     map[string]interface{}{"run_script": "#!/bin/sh\n"},
+			"skip/file":       "contents",
+			"symlink_symlink": "target",
+			"run_script":      "#!/bin/sh\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	stdout := &bytes.Buffer{}
+	c := newTestConfig(fs, withStdout(stdout))
+	c.archive.include = []string{"files", "symlinks"}
+	c.exclude = []string{"/home/user/skip"}
+	require.NoError(t, c.runArchiveCmd(nil, nil))
+
+	var names []string
+	r := tar.NewReader(stdout)
+	for {
+		h, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, h.Name)
+	}
+	assert.Equal(t, []string{"dir", filepath.Join("dir", "file"), "symlink"}, names)
+}
+
+func TestArchiveCmdZIP(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dir/private_file": "contents",
+			"run_script":       "#!/bin/sh\n",
+			"symlink_symlink":  "target",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	c := newTestConfig(fs)
+	c.archive.format = "zip"
+	c.archive.output = "/home/user/archive.zip"
+	require.NoError(t, c.runArchiveCmd(nil, nil))
+
+	data, err := fs.ReadFile("/home/user/archive.zip")
+	require.NoError(t, err)
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	type zipEntry struct {
+		name     string
+		mode     os.FileMode
+		contents string
+	}
+	var actual []zipEntry
+	for _, f := range r.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		contents, err := ioutil.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		actual = append(actual, zipEntry{
+			name:     f.Name,
+			mode:     f.Mode(),
+			contents: string(contents),
+		})
+	}
+	assert.Equal(t, []zipEntry{
+		{name: "dir/", mode: os.ModeDir | 0o755},
+		{name: "dir/file", mode: 0o600, contents: "contents"},
+		{name: "script", mode: 0o755, contents: "#!/bin/sh\n"},
+		{name: "symlink", mode: os.ModeSymlink | 0o777, contents: "target"},
+	}, actual)
+}
+
+func TestArchiveCmdUnknownFormat(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": &vfst.Dir{Perm: 0o700},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	c := newTestConfig(fs)
+	c.archive.format = "rar"
+	assert.EqualError(t, c.runArchiveCmd(nil, nil), "rar: unknown format")
+}
+
+func TestArchiveCmdOutputFailure(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".local/share/chezmoi/dot_file": "contents",
+			"archive.zip":                   "old archive",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	c := newTestConfig(fs)
+	c.archive.format = "zip"
+	c.archive.gzip = true
+	c.archive.output = "/home/user/archive.zip"
+	assert.EqualError(t, c.runArchiveCmd(nil, nil), "--gzip cannot be used with --format=zip")
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/archive.zip",
+			vfst.TestContentsString("old archive"),
+		),
+		vfst.TestPath("/home/user/archive.zip.chezmoi-tmp",
+			vfst.TestDoesNotExist,
+		),
+	)
+}
+
+func TestArchiveCmdGzip(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi/dir/file": "contents",
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	stdout := &bytes.Buffer{}
+	c := newTestConfig(fs, withStdout(stdout))
+	c.archive.gzip = true
+	require.NoError(t, c.runArchiveCmd(nil, nil))
+
+	gzipReader, err := gzip.NewReader(stdout)
+	require.NoError(t, err)
+	r := tar.NewReader(gzipReader)
+	var names []string
+	for {
+		h, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, h.Name)
+	}
+	assert.Equal(t, []string{"dir", filepath.Join("dir", "file")}, names)
+	require.NoError(t, gzipReader.Close())
+
+	c.archive.format = "zip"
+	assert.EqualError(t, c.runArchiveCmd(nil, nil), "--gzip cannot be used with --format=zip")
+}
@@ -20,12 +20,10 @@ var catCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(catCmd)
-
-	markRemainingZshCompPositionalArgumentsAsFiles(catCmd, 1)
 }
 
 func (c *Config) runCatCmd(cmd *cobra.Command, args []string) error {
-	ts, err := c.getTargetState(nil)
+	ts, err := c.getTargetState(c.getArgsPopulateOptions(args))
 	if err != nil {
 		return err
 	}
@@ -48,7 +46,11 @@ func (c *Config) runCatCmd(cmd *cobra.Command, args []string) error {
 			if err != nil {
 				return err
 			}
-			fmt.Println(linkname)
+			if _, err := fmt.Fprintln(c.Stdout, linkname); err != nil {
+				return err
+			}
+		case *chezmoi.Dir:
+			return fmt.Errorf("%s: is a directory, not a file or symlink", args[i])
 		default:
 			return fmt.Errorf("%s: not a file or symlink", args[i])
 		}
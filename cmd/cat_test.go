@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+func TestCatCmd(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		args           []string
+		expectedStdout string
+		expectedErr    string
+	}{
+		{
+			name:           "file",
+			args:           []string{"/home/user/.file"},
+			expectedStdout: "# contents of .file\n",
+		},
+		{
+			name:           "template",
+			args:           []string{"/home/user/.template"},
+			expectedStdout: "email = user@example.com\n",
+		},
+		{
+			name:           "symlink",
+			args:           []string{"/home/user/.symlink"},
+			expectedStdout: ".file\n",
+		},
+		{
+			name:           "multiple",
+			args:           []string{"/home/user/.file", "/home/user/.symlink"},
+			expectedStdout: "# contents of .file\n.file\n",
+		},
+		{
+			name:        "dir",
+			args:        []string{"/home/user/.dir"},
+			expectedErr: "/home/user/.dir: is a directory, not a file or symlink",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+				"/home/user": &vfst.Dir{Perm: 0o755},
+				"/home/user/.local/share/chezmoi": map[string]interface{}{
+					"dot_dir/file":        "# contents of .dir/file\n",
+					"dot_file":            "# contents of .file\n",
+					"dot_template.tmpl":   "email = {{ .email }}\n",
+					"symlink_dot_symlink": ".file\n",
+				},
+			})
+			require.NoError(t, err)
+			defer cleanup()
+
+			stdout := &bytes.Buffer{}
+			c := newTestConfig(
+				fs,
+				withData(map[string]interface{}{
+					"email": "user@example.com",
+				}),
+				withStdout(stdout),
+			)
+			err = c.runCatCmd(nil, tc.args)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedStdout, stdout.String())
+			vfst.RunTests(t, fs, "",
+				vfst.TestPath("/home/user/.file",
+					vfst.TestDoesNotExist,
+				),
+			)
+		})
+	}
+}
@@ -25,11 +25,24 @@ var chattrCmd = &cobra.Command{
 
 type boolModifier int
 
+// chattrAttributes are the attributes accepted by chattr, including
+// abbreviations.
+var chattrAttributes = []string{
+	"empty", "e",
+	"encrypt",
+	"exact",
+	"executable", "x",
+	"link", "l",
+	"private", "p",
+	"template", "t",
+}
+
 type attributeModifiers struct {
 	empty      boolModifier
 	encrypt    boolModifier
 	exact      boolModifier
 	executable boolModifier
+	link       boolModifier
 	private    boolModifier
 	template   boolModifier
 }
@@ -37,20 +50,17 @@ type attributeModifiers struct {
 func init() {
 	rootCmd.AddCommand(chattrCmd)
 
-	attributes := []string{
-		"empty", "e",
-		"encrypt",
-		"exact",
-		"executable", "x",
-		"private", "p",
-		"template", "t",
-	}
-	words := make([]string, 0, 4*len(attributes))
-	for _, attribute := range attributes {
+	words := make([]string, 0, 4*len(chattrAttributes))
+	for _, attribute := range chattrAttributes {
 		words = append(words, attribute, "-"+attribute, "+"+attribute, "no"+attribute)
 	}
-	panicOnError(chattrCmd.MarkZshCompPositionalArgumentWords(1, words...))
-	markRemainingZshCompPositionalArgumentsAsFiles(chattrCmd, 2)
+	completeAttributeModifiers := completeCommaSeparatedWords(words)
+	chattrCmd.ValidArgsFunction = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == 0 {
+			return completeAttributeModifiers(cmd, args, toComplete)
+		}
+		return nil, cobra.ShellCompDirectiveDefault
+	}
 }
 
 func (c *Config) runChattrCmd(cmd *cobra.Command, args []string) error {
@@ -68,51 +78,73 @@ func (c *Config) runChattrCmd(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	if err := checkNotInEncryptedDirs(ts, entries); err != nil {
+		return err
+	}
 
 	updates := make(map[string]func() error)
 	for _, entry := range entries {
+		sourceDir := ts.EntrySourceDir(entry)
 		dir, oldBase := filepath.Split(entry.SourceName())
-		oldpath := filepath.Join(ts.SourceDir, dir, oldBase)
+		oldpath := filepath.Join(sourceDir, dir, oldBase)
 		switch entry := entry.(type) {
 		case *chezmoi.Dir:
 			da := chezmoi.ParseDirAttributes(oldBase)
 			da.Exact = ams.exact.modify(entry.Exact)
-			perm := os.FileMode(0o777)
-			if private := ams.private.modify(entry.Private()); private {
-				perm &= 0o700
+			// Explicit permissions are kept unless private is changed.
+			if private := ams.private.modify(entry.Private()); !da.ExplicitPerm || private != entry.Private() {
+				perm := os.FileMode(0o777)
+				if private {
+					perm &= 0o700
+				}
+				da.ExplicitPerm = false
+				da.Perm = perm
 			}
-			da.Perm = perm
 			newBase := da.SourceName()
 			if newBase != oldBase {
-				newpath := filepath.Join(ts.SourceDir, dir, newBase)
+				newpath := filepath.Join(sourceDir, dir, newBase)
 				updates[oldpath] = func() error {
 					return c.mutator.Rename(oldpath, newpath)
 				}
 			}
 		case *chezmoi.File:
 			fa := chezmoi.ParseFileAttributes(oldBase)
-			mode := os.FileMode(0o666)
-			if executable := ams.executable.modify(entry.Executable()); executable {
-				mode |= 0o111
-			}
-			if private := ams.private.modify(entry.Private()); private {
-				mode &= 0o700
+			// Explicit permissions are kept unless executable or private is
+			// changed.
+			executable := ams.executable.modify(entry.Executable())
+			private := ams.private.modify(entry.Private())
+			if !fa.ExplicitPerm || executable != entry.Executable() || private != entry.Private() {
+				mode := os.FileMode(0o666)
+				if executable {
+					mode |= 0o111
+				}
+				if private {
+					mode &= 0o700
+				}
+				fa.ExplicitPerm = false
+				fa.Mode = mode
 			}
-			fa.Mode = mode
 			fa.Encrypted = ams.encrypt.modify(entry.Encrypted)
 			fa.Empty = ams.empty.modify(entry.Empty)
 			fa.Template = ams.template.modify(entry.Template)
-			newpath := filepath.Join(ts.SourceDir, dir, fa.SourceName())
+			fa.Link = ams.link.modify(false)
+			if fa.Link && (fa.Encrypted || fa.Template) {
+				return fmt.Errorf("%s: encrypted files and templates cannot be linked", entry.TargetName())
+			}
+			if fa.Link && fa.Create {
+				return fmt.Errorf("%s: files with the create_ attribute cannot be linked", entry.TargetName())
+			}
+			newpath := filepath.Join(sourceDir, dir, fa.SourceName())
 			if fa.Encrypted != entry.Encrypted {
-				oldContents, err := c.fs.ReadFile(filepath.Join(c.SourceDir, entry.SourceName()))
+				oldContents, err := c.fs.ReadFile(oldpath)
 				if err != nil {
 					return err
 				}
 				var newContents []byte
 				if fa.Encrypted {
-					newContents, err = ts.GPG.Encrypt(entry.TargetName(), oldContents)
+					newContents, err = ts.Encryption.Encrypt(oldContents)
 				} else {
-					newContents, err = ts.GPG.Decrypt(entry.TargetName(), oldContents)
+					newContents, err = ts.Encryption.Decrypt(oldContents)
 				}
 				if err != nil {
 					return err
@@ -133,9 +165,15 @@ func (c *Config) runChattrCmd(cmd *cobra.Command, args []string) error {
 		case *chezmoi.Symlink:
 			fa := chezmoi.ParseFileAttributes(oldBase)
 			fa.Template = ams.template.modify(entry.Template)
+			if fa.Link {
+				fa.Link = ams.link.modify(fa.Link)
+				if fa.Link && (fa.Encrypted || fa.Template) {
+					return fmt.Errorf("%s: encrypted files and templates cannot be linked", entry.TargetName())
+				}
+			}
 			newBase := fa.SourceName()
 			if newBase != oldBase {
-				newpath := filepath.Join(ts.SourceDir, dir, newBase)
+				newpath := filepath.Join(sourceDir, dir, newBase)
 				updates[oldpath] = func() error {
 					return c.mutator.Rename(oldpath, newpath)
 				}
@@ -192,6 +230,8 @@ func parseAttributeModifiers(s string) (*attributeModifiers, error) {
 			ams.exact = modifier
 		case "executable", "x":
 			ams.executable = modifier
+		case "link", "l":
+			ams.link = modifier
 		case "private", "p":
 			ams.private = modifier
 		case "template", "t":
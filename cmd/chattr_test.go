@@ -66,6 +66,54 @@ func TestChattrCommand(t *testing.T) {
 				),
 			},
 		},
+		{
+			name: "file_add_template_keeps_perm",
+			args: []string{"+template", "/home/user/foo"},
+			root: map[string]interface{}{
+				"/home/user/.local/share/chezmoi": map[string]interface{}{
+					"perm_0640_foo": "# contents of foo\n",
+				},
+			},
+			tests: []vfst.Test{
+				vfst.TestPath("/home/user/.local/share/chezmoi/perm_0640_foo",
+					vfst.TestDoesNotExist,
+				),
+				vfst.TestPath("/home/user/.local/share/chezmoi/perm_0640_foo.tmpl",
+					vfst.TestModeIsRegular,
+				),
+			},
+		},
+		{
+			name: "file_add_executable_replaces_perm",
+			args: []string{"+executable", "/home/user/foo"},
+			root: map[string]interface{}{
+				"/home/user/.local/share/chezmoi": map[string]interface{}{
+					"perm_0640_foo": "# contents of foo\n",
+				},
+			},
+			tests: []vfst.Test{
+				vfst.TestPath("/home/user/.local/share/chezmoi/perm_0640_foo",
+					vfst.TestDoesNotExist,
+				),
+				vfst.TestPath("/home/user/.local/share/chezmoi/executable_foo",
+					vfst.TestModeIsRegular,
+				),
+			},
+		},
+		{
+			name: "dir_add_exact_keeps_perm",
+			args: []string{"+exact", "/home/user/dir"},
+			root: map[string]interface{}{
+				"/home/user/.local/share/chezmoi": map[string]interface{}{
+					"perm_2775_dir": &vfst.Dir{Perm: 0o755},
+				},
+			},
+			tests: []vfst.Test{
+				vfst.TestPath("/home/user/.local/share/chezmoi/exact_perm_2775_dir",
+					vfst.TestIsDir,
+				),
+			},
+		},
 		{
 			name: "dir_remove_private",
 			args: []string{"-private", "/home/user/dir"},
@@ -3,6 +3,7 @@ package cmd
 import (
 	"os"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -58,6 +59,8 @@ func TestExercise(t *testing.T) {
 	// chezmoi add ~/.netrc
 	t.Run("chezmoi_add_netrc", func(t *testing.T) {
 		mustWriteFile("/home/user/.netrc", "# contents of .netrc\n", 0o600)
+		// ~/.netrc usually contains secrets, so confirm adding it.
+		c.Stdin = strings.NewReader("y\n")
 		assert.NoError(t, c.runAddCmd(nil, []string{"/home/user/.netrc"}))
 		path := "/home/user/.local/share/chezmoi/private_dot_netrc"
 		// Private files are not supported on Windows.
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+// commandVersionRegexp matches the first version in a command's output, for
+// example 3.2 in "tmux 3.2a" or 1.16.3 in "go version go1.16.3 linux/amd64".
+var commandVersionRegexp = regexp.MustCompile(`\d+\.\d+(?:\.\d+(?:-[0-9A-Za-z]+(?:\.[0-9A-Za-z]+)*)?)?`)
+
+// commandVersionCache caches versions by argv, including commands that were
+// not found.
+var commandVersionCache = make(map[string]*semver.Version)
+
+func init() {
+	// commandVersion can run any command, so it is restricted like the
+	// secret template functions.
+	config.addSecretTemplateFunc("commandVersion", config.commandVersionFunc)
+	config.addTemplateFunc("semverAtLeast", semverAtLeastFunc)
+}
+
+// commandVersionFunc returns the version printed by running name with args, or
+// --version if there are no args. It returns nil if name is not found, so
+// that missing commands can be tested for in templates. The version has the
+// same type as sprig's semver function returns.
+func (c *Config) commandVersionFunc(name string, args ...string) *semver.Version {
+	if len(args) == 0 {
+		args = []string{"--version"}
+	}
+	key := strings.Join(append([]string{name}, args...), "\x00")
+	if version, ok := commandVersionCache[key]; ok {
+		return version
+	}
+	output, err := c.mutator.IdempotentCmdOutput(exec.Command(name, args...))
+	var version *semver.Version
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+	case err != nil:
+		panic(fmt.Errorf("commandVersion: %s %s: %w\n%s", name, chezmoi.ShellQuoteArgs(args), err, output))
+	default:
+		version, err = parseCommandVersion(output)
+		if err != nil {
+			panic(fmt.Errorf("commandVersion: %s %s: %w", name, chezmoi.ShellQuoteArgs(args), err))
+		}
+	}
+	commandVersionCache[key] = version
+	return version
+}
+
+// parseCommandVersion returns the first version in output. Missing minor and
+// patch versions are zero.
+func parseCommandVersion(output []byte) (*semver.Version, error) {
+	match := commandVersionRegexp.Find(output)
+	if match == nil {
+		return nil, fmt.Errorf("no version found in %q", strings.TrimSpace(string(output)))
+	}
+	return semver.NewVersion(string(match))
+}
+
+// semverAtLeastFunc returns whether version is at least minimum. Either may be
+// a version or a string. A nil version, as returned by commandVersion for a
+// command that is not found, is never at least minimum.
+func semverAtLeastFunc(version, minimum interface{}) bool {
+	v, err := toSemver(version)
+	if err != nil {
+		panic(fmt.Errorf("semverAtLeast: %w", err))
+	}
+	if v == nil {
+		return false
+	}
+	m, err := toSemver(minimum)
+	if err != nil {
+		panic(fmt.Errorf("semverAtLeast: %w", err))
+	}
+	if m == nil {
+		return true
+	}
+	return !v.LessThan(m)
+}
+
+// toSemver converts value, which must be nil, a *semver.Version, or a string,
+// to a *semver.Version.
+func toSemver(value interface{}) (*semver.Version, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case *semver.Version:
+		return value, nil
+	case string:
+		return semver.NewVersion(value)
+	default:
+		return nil, fmt.Errorf("%v: not a version", value)
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+func TestCommandVersionFunc(t *testing.T) {
+	c := newConfig(withMutator(chezmoi.NullMutator{}))
+
+	version := c.commandVersionFunc("echo", "tmux", "3.10")
+	require.NotNil(t, version)
+	assert.Equal(t, "3.10.0", version.String())
+	assert.True(t, semverAtLeastFunc(version, "3.9"))
+	assert.Same(t, version, c.commandVersionFunc("echo", "tmux", "3.10"))
+
+	// Commands that are not found have no version, and are never at least
+	// any version.
+	version = c.commandVersionFunc("chezmoi-test-no-such-command")
+	assert.Nil(t, version)
+	assert.False(t, semverAtLeastFunc(version, "0.0.1"))
+
+	assert.Panics(t, func() {
+		c.commandVersionFunc("echo", "no version")
+	})
+	assert.Panics(t, func() {
+		c.commandVersionFunc("false")
+	})
+}
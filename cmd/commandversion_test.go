@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCommandVersion(t *testing.T) {
+	for _, tc := range []struct {
+		output        string
+		expected      string
+		expectedError bool
+	}{
+		{
+			output:   "tmux 3.2a\n",
+			expected: "3.2.0",
+		},
+		{
+			output:   "tmux 3.10\n",
+			expected: "3.10.0",
+		},
+		{
+			output:   "git version 2.30.1\n",
+			expected: "2.30.1",
+		},
+		{
+			output:   "go version go1.16.3 linux/amd64\n",
+			expected: "1.16.3",
+		},
+		{
+			output:   "v14.0.0-rc.1\n",
+			expected: "14.0.0-rc.1",
+		},
+		{
+			output:   "zsh 5.8 (x86_64-apple-darwin20.0)\n",
+			expected: "5.8.0",
+		},
+		{
+			output:        "unknown\n",
+			expectedError: true,
+		},
+	} {
+		t.Run(tc.output, func(t *testing.T) {
+			actual, err := parseCommandVersion([]byte(tc.output))
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual.String())
+		})
+	}
+}
+
+func TestSemverAtLeastFunc(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		version  interface{}
+		minimum  interface{}
+		expected bool
+	}{
+		{
+			name:     "equal",
+			version:  semver.MustParse("3.2"),
+			minimum:  "3.2",
+			expected: true,
+		},
+		{
+			name:     "greater",
+			version:  semver.MustParse("3.10"),
+			minimum:  "3.9",
+			expected: true,
+		},
+		{
+			name:     "less",
+			version:  "3.1.9",
+			minimum:  semver.MustParse("3.2"),
+			expected: false,
+		},
+		{
+			name:     "absent",
+			version:  (*semver.Version)(nil),
+			minimum:  "0.0.1",
+			expected: false,
+		},
+		{
+			name:     "nil",
+			version:  nil,
+			minimum:  "0.0.1",
+			expected: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, semverAtLeastFunc(tc.version, tc.minimum))
+		})
+	}
+
+	assert.Panics(t, func() {
+		semverAtLeastFunc("3.2", 3)
+	})
+}
+
+func TestCommandVersionIsRestricted(t *testing.T) {
+	assert.Contains(t, config.secretFuncNames, "commandVersion")
+}
@@ -1,23 +1,40 @@
 package cmd
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
+	vfs "github.com/twpayne/go-vfs"
+	xdg "github.com/twpayne/go-xdg/v3"
 )
 
 type completionCmdConfig struct {
-	output string
+	force   bool
+	install bool
+	output  string
+}
+
+// A completionInstallLocation is where the completion code for a shell is
+// installed, with a note on any further setup that is required.
+type completionInstallLocation struct {
+	path string
+	note string
 }
 
 var completionCmd = &cobra.Command{
 	Use:       "completion shell",
 	Args:      cobra.ExactArgs(1),
-	Short:     "Generate shell completion code for the specified shell (bash, fish, or zsh)",
+	Short:     "Generate shell completion code for the specified shell (bash, fish, powershell, or zsh)",
 	Long:      mustGetLongHelp("completion"),
 	Example:   getExample("completion"),
-	ValidArgs: []string{"bash", "fish", "zsh"},
+	ValidArgs: []string{"bash", "fish", "powershell", "zsh"},
 	RunE:      config.runCompletion,
 }
 
@@ -25,6 +42,8 @@ func init() {
 	rootCmd.AddCommand(completionCmd)
 
 	persistentFlags := completionCmd.PersistentFlags()
+	persistentFlags.BoolVarP(&config.completion.force, "force", "f", false, "overwrite an existing different file when installing")
+	persistentFlags.BoolVar(&config.completion.install, "install", false, "install in the conventional location for shell")
 	persistentFlags.StringVarP(&config.completion.output, "output", "o", "", "output filename")
 	panicOnError(completionCmd.MarkPersistentFlagFilename("output"))
 }
@@ -44,13 +63,137 @@ func (c *Config) runCompletion(cmd *cobra.Command, args []string) error {
 		if err := rootCmd.GenFishCompletion(output, true); err != nil {
 			return err
 		}
+	case "powershell":
+		if err := rootCmd.GenPowerShellCompletion(output); err != nil {
+			return err
+		}
 	default:
 		return errors.New("unsupported shell")
 	}
 
-	if c.completion.output == "" {
+	switch {
+	case c.completion.install && c.completion.output != "":
+		return errors.New("--install and --output cannot be used together")
+	case c.completion.install:
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		location, err := getCompletionInstallLocation(args[0], homeDir, c.bds, runtime.GOOS)
+		if err != nil {
+			return err
+		}
+		return c.installCompletion(args[0], location, []byte(output.String()))
+	case c.completion.output != "":
+		if err := vfs.MkdirAll(c.fs, filepath.Dir(c.completion.output), 0o777); err != nil {
+			return err
+		}
+		return c.fs.WriteFile(c.completion.output, []byte(output.String()), 0o666)
+	default:
 		_, err := c.Stdout.Write([]byte(output.String()))
 		return err
 	}
-	return c.fs.WriteFile(c.completion.output, []byte(output.String()), 0o666)
+}
+
+// getCompletionInstallLocation returns the conventional per-user location of
+// the completion code for shell, given the user's home directory and base
+// directories, on the operating system goos.
+func getCompletionInstallLocation(shell, homeDir string, bds *xdg.BaseDirectorySpecification, goos string) (*completionInstallLocation, error) {
+	switch shell {
+	case "bash":
+		return &completionInstallLocation{
+			path: filepath.Join(bds.DataHome, "bash-completion", "completions", "chezmoi"),
+		}, nil
+	case "fish":
+		return &completionInstallLocation{
+			path: filepath.Join(bds.ConfigHome, "fish", "completions", "chezmoi.fish"),
+		}, nil
+	case "powershell":
+		// The completion code is written next to the PowerShell profile
+		// rather than into it, so that the profile is never overwritten.
+		profileDir := filepath.Join(bds.ConfigHome, "powershell")
+		if goos == "windows" {
+			profileDir = filepath.Join(homeDir, "Documents", "PowerShell")
+		}
+		path := filepath.Join(profileDir, "chezmoi-completion.ps1")
+		return &completionInstallLocation{
+			path: path,
+			note: fmt.Sprintf("add the following line to %s:\n    . %s", filepath.Join(profileDir, "Microsoft.PowerShell_profile.ps1"), path),
+		}, nil
+	case "zsh":
+		completionsDir := filepath.Join(homeDir, ".zsh", "completions")
+		return &completionInstallLocation{
+			path: filepath.Join(completionsDir, "_chezmoi"),
+			note: fmt.Sprintf("if %s is not in your fpath, add the following line to ~/.zshrc before compinit:\n    fpath=(%s $fpath)", completionsDir, completionsDir),
+		}, nil
+	default:
+		return nil, errors.New("unsupported shell")
+	}
+}
+
+// installCompletion writes the completion code data for shell to location,
+// refusing to overwrite a different existing file unless c.completion.force is
+// set, and prints what it did.
+func (c *Config) installCompletion(shell string, location *completionInstallLocation, data []byte) error {
+	switch existingData, err := c.fs.ReadFile(location.path); {
+	case err == nil && bytes.Equal(existingData, data):
+		fmt.Fprintf(c.Stdout, "%s completion already installed in %s\n", shell, location.path)
+		return nil
+	case err == nil && !c.completion.force:
+		return fmt.Errorf("%s: file exists and is different, use --force to overwrite it", location.path)
+	case err != nil && !os.IsNotExist(err):
+		return err
+	}
+	if err := vfs.MkdirAll(c.fs, filepath.Dir(location.path), 0o777); err != nil {
+		return err
+	}
+	if err := c.fs.WriteFile(location.path, data, 0o666); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Stdout, "installed %s completion in %s\n", shell, location.path)
+	if location.note != "" {
+		fmt.Fprintln(c.Stdout, location.note)
+	}
+	return nil
+}
+
+// completeCommaSeparatedWords returns a completion function that completes the
+// last element of a comma-separated list of words.
+func completeCommaSeparatedWords(words []string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		prefix := ""
+		if i := strings.LastIndexByte(toComplete, ','); i != -1 {
+			prefix = toComplete[:i+1]
+		}
+		completions := make([]string, 0, len(words))
+		for _, word := range words {
+			if completion := prefix + word; strings.HasPrefix(completion, toComplete) {
+				completions = append(completions, completion)
+			}
+		}
+		return completions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+	}
+}
+
+// completeWords returns a completion function that completes words.
+func completeWords(words []string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		completions := make([]string, 0, len(words))
+		for _, word := range words {
+			if strings.HasPrefix(word, toComplete) {
+				completions = append(completions, word)
+			}
+		}
+		return completions, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// formats returns the sorted keys of formatMap.
+func formats() []string {
+	formats := make([]string, 0, len(formatMap))
+	for format := range formatMap {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
 }
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+	xdg "github.com/twpayne/go-xdg/v3"
+)
+
+func TestCompleteCommaSeparatedWords(t *testing.T) {
+	for _, tc := range []struct {
+		toComplete          string
+		expectedCompletions []string
+	}{
+		{
+			toComplete:          "",
+			expectedCompletions: []string{"dirs", "files", "symlinks"},
+		},
+		{
+			toComplete:          "f",
+			expectedCompletions: []string{"files"},
+		},
+		{
+			toComplete:          "files,",
+			expectedCompletions: []string{"files,dirs", "files,files", "files,symlinks"},
+		},
+		{
+			toComplete:          "files,s",
+			expectedCompletions: []string{"files,symlinks"},
+		},
+		{
+			toComplete:          "x",
+			expectedCompletions: []string{},
+		},
+	} {
+		t.Run(tc.toComplete, func(t *testing.T) {
+			completions, directive := completeCommaSeparatedWords(managedIncludeTypes)(nil, nil, tc.toComplete)
+			assert.Equal(t, tc.expectedCompletions, completions)
+			assert.Equal(t, cobra.ShellCompDirectiveNoFileComp|cobra.ShellCompDirectiveNoSpace, directive)
+		})
+	}
+}
+
+func TestCompletionValuesAreAccepted(t *testing.T) {
+	for _, attribute := range chattrAttributes {
+		_, err := parseAttributeModifiers(attribute)
+		assert.NoError(t, err, attribute)
+	}
+	for _, format := range formats() {
+		assert.NoError(t, formatMap[format](&bytes.Buffer{}, map[string]interface{}{"key": "value"}), format)
+	}
+	for _, entryType := range entryTypeWords {
+		_, err := parseEntryTypeSet([]string{entryType})
+		assert.NoError(t, err, entryType)
+	}
+	for _, value := range colorWords() {
+		_, err := parseColor(value, &bytes.Buffer{})
+		assert.NoError(t, err, value)
+	}
+	_, err := parseColor("unknown", &bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestCompletionDiffFormatsAreAccepted(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".file":                         "old\n",
+			".local/share/chezmoi/dot_file": "new\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	for _, format := range diffFormatNames() {
+		t.Run(format, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			c := newTestConfig(fs, withStdout(stdout))
+			c.Diff.Format = format
+			c.Diff.NoPager = true
+			require.NoError(t, c.runDiffCmd(nil, nil))
+			assert.Contains(t, stdout.String(), "+new\n")
+		})
+	}
+	c := newTestConfig(fs)
+	c.Diff.Format = "unknown"
+	assert.Error(t, c.runDiffCmd(nil, nil))
+}
+
+func TestGetCompletionInstallLocation(t *testing.T) {
+	bds := &xdg.BaseDirectorySpecification{
+		ConfigHome: "/home/user/.config",
+		DataHome:   "/home/user/.local/share",
+	}
+	for _, tc := range []struct {
+		shell        string
+		goos         string
+		expectedPath string
+		expectedNote bool
+	}{
+		{
+			shell:        "bash",
+			goos:         "linux",
+			expectedPath: "/home/user/.local/share/bash-completion/completions/chezmoi",
+		},
+		{
+			shell:        "fish",
+			goos:         "linux",
+			expectedPath: "/home/user/.config/fish/completions/chezmoi.fish",
+		},
+		{
+			shell:        "powershell",
+			goos:         "linux",
+			expectedPath: "/home/user/.config/powershell/chezmoi-completion.ps1",
+			expectedNote: true,
+		},
+		{
+			shell:        "powershell",
+			goos:         "windows",
+			expectedPath: "/home/user/Documents/PowerShell/chezmoi-completion.ps1",
+			expectedNote: true,
+		},
+		{
+			shell:        "zsh",
+			goos:         "darwin",
+			expectedPath: "/home/user/.zsh/completions/_chezmoi",
+			expectedNote: true,
+		},
+	} {
+		t.Run(tc.shell+"_"+tc.goos, func(t *testing.T) {
+			location, err := getCompletionInstallLocation(tc.shell, "/home/user", bds, tc.goos)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedPath, filepath.ToSlash(location.path))
+			assert.Equal(t, tc.expectedNote, location.note != "")
+		})
+	}
+	_, err := getCompletionInstallLocation("tcsh", "/home/user", bds, "linux")
+	assert.Error(t, err)
+}
+
+func TestInstallCompletion(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	location := &completionInstallLocation{
+		path: "/home/user/.zsh/completions/_chezmoi",
+		note: "note",
+	}
+
+	stdout := &bytes.Buffer{}
+	c := newTestConfig(fs, withStdout(stdout))
+	require.NoError(t, c.installCompletion("zsh", location, []byte("# new\n")))
+	assert.Equal(t, "installed zsh completion in /home/user/.zsh/completions/_chezmoi\nnote\n", stdout.String())
+
+	stdout.Reset()
+	require.NoError(t, c.installCompletion("zsh", location, []byte("# new\n")))
+	assert.Equal(t, "zsh completion already installed in /home/user/.zsh/completions/_chezmoi\n", stdout.String())
+
+	assert.Error(t, c.installCompletion("zsh", location, []byte("# newer\n")))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.zsh/completions/_chezmoi",
+			vfst.TestContentsString("# new\n"),
+		),
+	)
+
+	c.completion.force = true
+	require.NoError(t, c.installCompletion("zsh", location, []byte("# newer\n")))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.zsh/completions/_chezmoi",
+			vfst.TestContentsString("# newer\n"),
+		),
+	)
+}
+
+func TestCompletionOutputCreatesParentDirs(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	c := newTestConfig(fs)
+	c.completion.output = "/home/user/.config/fish/completions/chezmoi.fish"
+	require.NoError(t, c.runCompletion(nil, []string{"fish"}))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.config/fish/completions/chezmoi.fish",
+			vfst.TestModeIsRegular,
+		),
+	)
+}
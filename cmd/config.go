@@ -2,107 +2,248 @@ package cmd
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 	"unicode"
 
 	"github.com/Masterminds/sprig"
+	"github.com/bmatcuk/doublestar"
 	"github.com/pelletier/go-toml"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	vfs "github.com/twpayne/go-vfs"
 	xdg "github.com/twpayne/go-xdg/v3"
 	bolt "go.etcd.io/bbolt"
+	"golang.org/x/crypto/ssh/terminal"
 	yaml "gopkg.in/yaml.v2"
 
 	"github.com/twpayne/chezmoi/internal/chezmoi"
 )
 
-const commitMessageTemplateAsset = "assets/templates/COMMIT_MESSAGE.tmpl"
-
-var whitespaceRegexp = regexp.MustCompile(`\s+`)
+const (
+	chezmoiTemplateFuncPrefix  = "chezmoi_"
+	commitMessageTemplateAsset = "assets/templates/COMMIT_MESSAGE.tmpl"
+	dataName                   = ".chezmoidata"
+	rootName                   = ".chezmoiroot"
+	templatesDirName           = ".chezmoitemplates"
+)
 
 type sourceVCSConfig struct {
 	Command    string
 	AutoCommit bool
 	AutoPush   bool
 	Init       interface{}
+	GitFiles   bool
 	NotGit     bool
 	Pull       interface{}
+	Textconv   string
+}
+
+type encryptionConfig struct {
+	Exclude bool
+	Export  string
+	Method  string
+	Private bool
+}
+
+// encryptedModes maps the values of encryption.export to the modes used by
+// archive and dump without --decrypt.
+var encryptedModes = map[string]chezmoi.EncryptedMode{
+	"ciphertext": chezmoi.EncryptedModeCiphertext,
+	"skip":       chezmoi.EncryptedModeSkip,
+}
+
+type elevationConfig struct {
+	Command string
+	Args    []string
+	Targets []string
 }
 
 type templateConfig struct {
 	Options []string
 }
 
+type templateFuncsConfig struct {
+	Disable []string
+}
+
+type pathMapConfig struct {
+	Name    string
+	Targets map[string]string
+}
+
+type ownerConfig struct {
+	Targets []string
+	Owner   string
+}
+
+type scriptsConfig struct {
+	TempDir string
+}
+
+type scopedDirConfig struct {
+	Condition string
+	Priority  int
+}
+
 // A Config represents a configuration.
 type Config struct {
-	configFile        string
-	err               error
-	fs                vfs.FS
-	mutator           chezmoi.Mutator
-	SourceDir         string
-	DestDir           string
-	Umask             permValue
-	DryRun            bool
-	Follow            bool
-	Remove            bool
-	Verbose           bool
-	Color             string
-	Debug             bool
-	GPG               chezmoi.GPG
-	GPGRecipient      string
-	SourceVCS         sourceVCSConfig
-	Template          templateConfig
-	Merge             mergeConfig
-	Bitwarden         bitwardenCmdConfig
-	CD                cdCmdConfig
-	Diff              diffCmdConfig
-	GenericSecret     genericSecretCmdConfig
-	Gopass            gopassCmdConfig
-	KeePassXC         keePassXCCmdConfig
-	Lastpass          lastpassCmdConfig
-	Onepassword       onepasswordCmdConfig
-	Vault             vaultCmdConfig
-	Pass              passCmdConfig
-	Data              map[string]interface{}
-	colored           bool
-	maxDiffDataSize   int
-	templateFuncs     template.FuncMap
-	add               addCmdConfig
-	completion        completionCmdConfig
-	data              dataCmdConfig
-	dump              dumpCmdConfig
-	edit              editCmdConfig
-	executeTemplate   executeTemplateCmdConfig
-	_import           importCmdConfig
-	init              initCmdConfig
-	keyring           keyringCmdConfig
-	managed           managedCmdConfig
-	purge             purgeCmdConfig
-	remove            removeCmdConfig
-	update            updateCmdConfig
-	upgrade           upgradeCmdConfig
-	Stdin             io.Reader
-	Stdout            io.Writer
-	Stderr            io.Writer
-	bds               *xdg.BaseDirectorySpecification
-	scriptStateBucket []byte
+	configFile          string
+	err                 error
+	fs                  vfs.FS
+	mutator             chezmoi.Mutator
+	relativeToDest      bool
+	workingDir          string
+	SourceDir           string
+	SourceDirs          []string
+	DestDir             string
+	StateFile           string
+	Umask               permValue
+	DryRun              bool
+	NoPersistentState   bool
+	NoPrompt            bool
+	Follow              bool
+	Remove              bool
+	Symlink             bool
+	SkipTargets         []string
+	Verbose             bool
+	Color               string
+	Debug               bool
+	Elevation           elevationConfig
+	Encryption          encryptionConfig
+	Age                 chezmoi.Age
+	GPG                 chezmoi.GPG
+	GPGRecipient        string
+	SourceVCS           sourceVCSConfig
+	Template            templateConfig
+	TemplateFuncs       templateFuncsConfig
+	TemplateGlobs       []string
+	ScopedDirs          map[string]scopedDirConfig
+	PathMap             []pathMapConfig
+	Owners              []ownerConfig
+	Scripts             scriptsConfig
+	Merge               mergeConfig
+	Add                 addCmdConfig
+	Apply               applyCmdConfig
+	AWSSecretsManager   awsSecretsManagerCmdConfig
+	Bitwarden           bitwardenCmdConfig
+	CD                  cdCmdConfig
+	Diff                diffCmdConfig
+	Edit                editCmdConfig
+	GenericSecret       genericSecretCmdConfig
+	Gopass              gopassCmdConfig
+	KeePassXC           keePassXCCmdConfig
+	Lastpass            lastpassCmdConfig
+	Onepassword         onepasswordCmdConfig
+	Vault               vaultCmdConfig
+	Pass                passCmdConfig
+	Data                map[string]interface{}
+	DataMergeMode       map[string]string
+	colored             bool
+	maxDiffDataSize     int
+	templateFuncs       template.FuncMap
+	chezmoiFuncNames    []string
+	secretFuncNames     []string
+	shadowedFuncNames   []string
+	applyLog            applyLogConfig
+	archive             archiveCmdConfig
+	clone               cloneConfig
+	completion          completionCmdConfig
+	data                dataCmdConfig
+	dump                dumpCmdConfig
+	dumpConfig          dumpConfigCmdConfig
+	exclude             []string
+	excludeEncrypted    bool
+	symlink             bool
+	include             []string
+	executeTemplate     executeTemplateCmdConfig
+	generate            generateCmdConfig
+	_import             importCmdConfig
+	init                initCmdConfig
+	keyring             keyringCmdConfig
+	lint                lintCmdConfig
+	managed             managedCmdConfig
+	purge               purgeCmdConfig
+	remote              remoteConfig
+	remove              removeCmdConfig
+	state               stateCmdConfig
+	status              statusCmdConfig
+	trust               trustConfig
+	unmanaged           unmanagedCmdConfig
+	update              updateCmdConfig
+	upgrade             upgradeCmdConfig
+	verify              verifyCmdConfig
+	Stdin               io.Reader
+	stdinReader         *bufio.Reader
+	Stdout              io.Writer
+	Stderr              io.Writer
+	bds                 *xdg.BaseDirectorySpecification
+	stateHome           string
+	userLookup          userLookup
+	homeDirErr          error
+	allowSudo           bool
+	sudoUser            *sudoUser
+	persistentState     chezmoi.PersistentState
+	lastAppliedSource   *appliedSource
+	readAppliedSource   bool
+	applyProgressBucket []byte
+	configStateBucket   []byte
+	appliedSourceBucket []byte
+	appliedTargetBucket []byte
+	repoImportBucket    []byte
+	scriptStateBucket   []byte
+	destStateBucket     []byte
+	lastWrittenBucket   []byte
+	trustBucket         []byte
+	warningBucket       []byte
 }
 
 // A configOption sets an option on a Config.
 type configOption func(*Config)
 
+// A userLookup looks up the current user. Its functions can be replaced to
+// simulate lookup failures in tests.
+type userLookup struct {
+	currentUser   func() (*user.User, error)
+	homeDir       func() (string, error)
+	getenv        func(string) string
+	geteuid       func() int
+	lookupUser    func(string) (*user.User, error)
+	lookupGroup   func(string) (*user.Group, error)
+	lookupGroupID func(string) (*user.Group, error)
+	commandOutput func(string, ...string) ([]byte, error)
+}
+
+var defaultUserLookup = userLookup{
+	currentUser:   user.Current,
+	homeDir:       os.UserHomeDir,
+	getenv:        os.Getenv,
+	geteuid:       os.Geteuid,
+	lookupUser:    user.Lookup,
+	lookupGroup:   user.LookupGroup,
+	lookupGroupID: user.LookupGroupId,
+	commandOutput: func(name string, args ...string) ([]byte, error) {
+		return exec.Command(name, args...).Output()
+	},
+}
+
 var (
 	formatMap = map[string]func(io.Writer, interface{}) error{
 		"json": func(w io.Writer, value interface{}) error {
@@ -118,6 +259,10 @@ var (
 		},
 	}
 
+	// configFileExtensions are the extensions of config files that chezmoi
+	// reads, in order of preference.
+	configFileExtensions = append(append([]string{}, viper.SupportedExts...), "jsonc", "json5")
+
 	wellKnownAbbreviations = map[string]struct{}{
 		"ANSI": {},
 		"CPE":  {},
@@ -141,21 +286,60 @@ func newConfig(options ...configOption) *Config {
 		Template: templateConfig{
 			Options: chezmoi.DefaultTemplateOptions,
 		},
+		Add: addCmdConfig{
+			SecretCheck: true,
+		},
+		Apply: applyCmdConfig{
+			BackupKeep: 10,
+		},
 		Diff: diffCmdConfig{
 			Format: "chezmoi",
 		},
+		Elevation: elevationConfig{
+			Command: "sudo",
+		},
+		Encryption: encryptionConfig{
+			Export:  "ciphertext",
+			Method:  "gpg",
+			Private: true,
+		},
+		Edit: editCmdConfig{
+			WatchTimeout: 5 * time.Minute,
+		},
 		Merge: mergeConfig{
 			Command: "vimdiff",
 		},
+		lint: lintCmdConfig{
+			format: "text",
+		},
+		managed: managedCmdConfig{
+			format: "text",
+		},
+		unmanaged: unmanagedCmdConfig{
+			pathStyle: "absolute",
+		},
+		Age: chezmoi.Age{
+			Command: "age",
+		},
 		GPG: chezmoi.GPG{
 			Command: "gpg",
 		},
-		maxDiffDataSize:   1 * 1024 * 1024, // 1MB
-		templateFuncs:     sprig.TxtFuncMap(),
-		scriptStateBucket: []byte("script"),
-		Stdin:             os.Stdin,
-		Stdout:            os.Stdout,
-		Stderr:            os.Stderr,
+		maxDiffDataSize:     1 * 1024 * 1024, // 1MB
+		templateFuncs:       sprig.TxtFuncMap(),
+		userLookup:          defaultUserLookup,
+		applyProgressBucket: []byte("applyProgress"),
+		configStateBucket:   []byte("configState"),
+		appliedSourceBucket: []byte("appliedSource"),
+		appliedTargetBucket: []byte("appliedTargets"),
+		repoImportBucket:    []byte("repoImport"),
+		scriptStateBucket:   []byte("script"),
+		destStateBucket:     []byte("destState"),
+		lastWrittenBucket:   []byte("lastWritten"),
+		trustBucket:         []byte("trust"),
+		warningBucket:       []byte("warning"),
+		Stdin:               os.Stdin,
+		Stdout:              os.Stdout,
+		Stderr:              os.Stderr,
 	}
 	for _, option := range options {
 		option(c)
@@ -163,21 +347,111 @@ func newConfig(options ...configOption) *Config {
 	return c
 }
 
+// addTemplateFunc adds the chezmoi template function key, under both its bare
+// name and with chezmoiTemplateFuncPrefix, so that it can still be called if a
+// later version of sprig adds a function with the same name. chezmoi's
+// functions take precedence over sprig's, and the names of any sprig functions
+// that they shadow are recorded so that they can be logged.
 func (c *Config) addTemplateFunc(key string, value interface{}) {
 	if c.templateFuncs == nil {
 		c.templateFuncs = make(template.FuncMap)
 	}
-	if _, ok := c.templateFuncs[key]; ok {
-		panic(fmt.Sprintf("Config.addTemplateFunc: %s already defined", key))
+	for _, name := range []string{key, chezmoiTemplateFuncPrefix + key} {
+		if _, ok := c.templateFuncs[name]; ok {
+			if c.isChezmoiTemplateFunc(name) {
+				panic(fmt.Sprintf("Config.addTemplateFunc: %s already defined", name))
+			}
+			c.shadowedFuncNames = append(c.shadowedFuncNames, name)
+		}
+		c.templateFuncs[name] = value
+		c.chezmoiFuncNames = append(c.chezmoiFuncNames, name)
+	}
+}
+
+// addSecretTemplateFunc adds the template function key, which retrieves
+// secrets from a secret manager.
+func (c *Config) addSecretTemplateFunc(key string, value interface{}) {
+	c.addTemplateFunc(key, value)
+	c.secretFuncNames = append(c.secretFuncNames, key, chezmoiTemplateFuncPrefix+key)
+}
+
+// isChezmoiTemplateFunc returns whether name is a template function provided
+// by chezmoi, rather than by sprig.
+func (c *Config) isChezmoiTemplateFunc(name string) bool {
+	for _, chezmoiFuncName := range c.chezmoiFuncNames {
+		if name == chezmoiFuncName {
+			return true
+		}
+	}
+	return false
+}
+
+// disableTemplateFuncs replaces the template functions in
+// templateFuncs.disable with functions that return an error naming the config
+// option. Disabling a chezmoi function also disables its prefixed alias.
+func (c *Config) disableTemplateFuncs() error {
+	for _, key := range c.TemplateFuncs.Disable {
+		names := []string{key}
+		if c.isChezmoiTemplateFunc(chezmoiTemplateFuncPrefix + key) {
+			names = append(names, chezmoiTemplateFuncPrefix+key)
+		}
+		for _, name := range names {
+			name := name
+			value, ok := c.templateFuncs[name]
+			if !ok {
+				return fmt.Errorf("templateFuncs.disable: %s: unknown template function", name)
+			}
+			c.templateFuncs[name] = reflect.MakeFunc(reflect.TypeOf(value), func([]reflect.Value) []reflect.Value {
+				// text/template returns panics in functions as errors.
+				panic(fmt.Errorf("%s: disabled by templateFuncs.disable", name))
+			}).Interface()
+		}
+	}
+	return nil
+}
+
+// logShadowedTemplateFuncs logs the sprig template functions that are shadowed
+// by chezmoi's.
+func (c *Config) logShadowedTemplateFuncs() {
+	shadowedFuncNames := append([]string(nil), c.shadowedFuncNames...)
+	sort.Strings(shadowedFuncNames)
+	for _, name := range shadowedFuncNames {
+		log.Printf("template function %s: chezmoi's function shadows sprig's", name)
 	}
-	c.templateFuncs[key] = value
 }
 
 func (c *Config) applyArgs(args []string, persistentState chezmoi.PersistentState) error {
-	fs := vfs.NewReadOnlyFS(c.fs)
-	ts, err := c.getTargetState(nil)
+	// Check trust with the persistent state that the target state is applied
+	// with, so that the answer is recorded there.
+	if c.remote.url == "" {
+		if err := c.checkSourceDirTrust(persistentState); err != nil {
+			return err
+		}
+	}
+	ts, err := c.getTargetState(c.getApplyPopulateOptions(args))
 	if err != nil {
-		return err
+		return suggestExcludeEncrypted(err)
+	}
+	return c.applyTargetStateArgs(ts, args, persistentState)
+}
+
+func (c *Config) applyTargetStateArgs(ts *chezmoi.TargetState, args []string, persistentState chezmoi.PersistentState) error {
+	fs := vfs.NewReadOnlyFS(c.fs)
+	if !c.DryRun {
+		if err := c.warnEncryptedPrivate(ts, persistentState); err != nil {
+			return err
+		}
+	}
+	if c.remote.url != "" && !c.remote.allowScripts && !c.trust.trust && !c.DryRun {
+		// Scripts from a remote repo are untrusted code.
+		if script := findScript(ts.Entries, func(*chezmoi.Script) bool { return true }); script != nil {
+			return fmt.Errorf("%s: refusing to run script from %s, use --allow-scripts to run it", script.TargetName(), c.remote.url)
+		}
+	}
+	if isMemoryPersistentState(persistentState) && !c.DryRun {
+		if findScript(ts.Entries, func(s *chezmoi.Script) bool { return s.Once }) != nil {
+			fmt.Fprintf(c.Stderr, "warning: not using the persistent state, run_once_ scripts will be run every time\n")
+		}
 	}
 	applyOptions := &chezmoi.ApplyOptions{
 		DestDir:           ts.DestDir,
@@ -185,24 +459,202 @@ func (c *Config) applyArgs(args []string, persistentState chezmoi.PersistentStat
 		Ignore:            ts.TargetIgnore.Match,
 		PersistentState:   persistentState,
 		Remove:            c.Remove,
+		RewriteLinkname:   c.Apply.rewriteLinkname,
+		ScriptEnv:         []string{"CHEZMOI_DEST_DIR=" + ts.DestDir},
 		ScriptStateBucket: c.scriptStateBucket,
 		Stdout:            c.Stdout,
 		Umask:             ts.Umask,
 		Verbose:           c.Verbose,
+		Version:           rootCmd.Version,
 	}
-	if len(args) == 0 {
-		return ts.Apply(fs, c.mutator, c.Follow, applyOptions)
+	scriptTempDirs, err := c.getScriptTempDirs()
+	if err != nil {
+		return err
+	}
+	applyOptions.ScriptTempDirs = scriptTempDirs
+	if c.applyLog.mutator != nil {
+		applyOptions.LogScript = c.applyLog.mutator.LogScript
+	}
+	if ts.Owner != nil {
+		canChangeOwner, err := c.getCanChangeOwner(ts.DestDir)
+		if err != nil {
+			return err
+		}
+		applyOptions.Owner = ts.Owner
+		applyOptions.CanChangeOwner = canChangeOwner
+	}
+	elevationFailures := 0
+	applyOptions.ElevationFailed = func(targetName string, err *chezmoi.ElevationError) error {
+		fmt.Fprintf(c.Stderr, "warning: %v, skipping %s\n", err, targetName)
+		elevationFailures++
+		return nil
 	}
-	entries, err := c.getEntries(ts, args)
+	progress, err := c.getApplyProgress(ts, persistentState)
 	if err != nil {
 		return err
 	}
-	for _, entry := range entries {
-		if err := entry.Apply(fs, c.mutator, c.Follow, applyOptions); err != nil {
+	c.setApplyProgressOptions(applyOptions, progress)
+	// The progress is recorded if the apply fails, and every
+	// applyProgressInterval completed targets in case it is interrupted, so
+	// that it can be resumed.
+	recordProgress := func() error {
+		if c.DryRun {
+			return nil
+		}
+		return c.recordApplyProgress(ts, progress, persistentState)
+	}
+	completedProgress := applyOptions.Completed
+	applyOptions.Completed = func(targetName string) error {
+		if err := completedProgress(targetName); err != nil {
 			return err
 		}
+		if len(progress.Completed)%applyProgressInterval != 0 {
+			return nil
+		}
+		return recordProgress()
 	}
-	return nil
+	// Targets that have been applied are recorded so that their state can be
+	// recorded afterwards without reading them again.
+	appliedTargetNames := make(map[string]struct{})
+	completed := applyOptions.Completed
+	applyOptions.Completed = func(targetName string) error {
+		appliedTargetNames[targetName] = struct{}{}
+		if completed == nil {
+			return nil
+		}
+		return completed(targetName)
+	}
+	if c.filtersEntries(c.include) {
+		include, err := c.getEntryFilter(ts, c.include)
+		if err != nil {
+			return err
+		}
+		applyOptions.Include = include
+	}
+	// Encrypted targets are skipped, without decrypting them, if they are
+	// excluded.
+	skippedEncryptedTargetNames := make(map[string]struct{})
+	if c.isExcludingEncrypted() {
+		include := applyOptions.Include
+		applyOptions.Include = func(entry chezmoi.Entry) bool {
+			if isEncrypted(ts, entry) {
+				skippedEncryptedTargetNames[entry.TargetName()] = struct{}{}
+				return false
+			}
+			return include == nil || include(entry)
+		}
+	}
+	if c.trust.untrustedRepo != "" && c.remote.url == "" {
+		scriptTargetNames := make(map[string]struct{})
+		findScript(ts.Entries, func(script *chezmoi.Script) bool {
+			scriptTargetNames[script.TargetName()] = struct{}{}
+			return false
+		})
+		skip := applyOptions.Skip
+		applyOptions.Skip = func(targetName string) bool {
+			if _, ok := scriptTargetNames[targetName]; ok {
+				fmt.Fprintf(c.Stderr, "warning: %s: not running script from untrusted %s\n", targetName, c.trust.untrustedRepo)
+				return true
+			}
+			return skip != nil && skip(targetName)
+		}
+	}
+	var entries []chezmoi.Entry
+	if len(args) != 0 {
+		entries, err = c.getEntries(ts, args)
+		if err != nil {
+			return err
+		}
+	}
+	if !c.Follow {
+		if err := c.checkDestSymlinks(ts, entries); err != nil {
+			return err
+		}
+	}
+	// Targets matching skipTargets are skipped before any other checks,
+	// unless they are given explicitly as arguments.
+	skippedTargetNames := make(map[string]struct{})
+	if len(c.SkipTargets) != 0 {
+		skipTarget, err := c.getSkipTarget(ts)
+		if err != nil {
+			return err
+		}
+		explicitTargetNames := make(map[string]struct{}, len(entries))
+		for _, entry := range entries {
+			explicitTargetNames[entry.TargetName()] = struct{}{}
+		}
+		skip := applyOptions.Skip
+		applyOptions.Skip = func(targetName string) bool {
+			if _, ok := explicitTargetNames[targetName]; !ok && skipTarget(targetName) {
+				skippedTargetNames[targetName] = struct{}{}
+				return true
+			}
+			return skip != nil && skip(targetName)
+		}
+	}
+	var backupMutator *chezmoi.BackupMutator
+	if c.Apply.Backup && !c.Apply.noBackup && !c.DryRun {
+		backupMutator = c.newBackupMutator(ts)
+		mutator := c.mutator
+		c.mutator = backupMutator
+		defer func() {
+			c.mutator = mutator
+		}()
+	}
+	var applyErr error
+	if len(args) == 0 {
+		applyErr = ts.Apply(fs, c.mutator, c.Follow, applyOptions)
+	} else {
+		applyErr = ts.ApplyEntries(entries, fs, c.mutator, c.Follow, applyOptions)
+	}
+	if applyErr != nil {
+		if err := recordProgress(); err != nil {
+			return err
+		}
+		return suggestExcludeEncrypted(applyErr)
+	}
+	if c.Verbose && len(skippedTargetNames) != 0 {
+		fmt.Fprintf(c.Stderr, "skipped %d target(s) matching skipTargets\n", len(skippedTargetNames))
+	}
+	if len(skippedEncryptedTargetNames) != 0 {
+		fmt.Fprintf(c.Stderr, "skipped %d encrypted target(s)\n", len(skippedEncryptedTargetNames))
+	}
+	if elevationFailures != 0 {
+		if err := recordProgress(); err != nil {
+			return err
+		}
+		return fmt.Errorf("%d target(s) skipped because elevation failed", elevationFailures)
+	}
+	// Only a full apply knows which targets have been removed from the source
+	// state.
+	if len(args) == 0 {
+		if err := c.pruneTargets(ts, persistentState); err != nil {
+			return err
+		}
+	}
+	if backupMutator != nil && backupMutator.Created() {
+		if err := c.pruneBackups(); err != nil {
+			return err
+		}
+	}
+	if c.DryRun {
+		return nil
+	}
+	if err := c.recordDestStates(ts, entries, appliedTargetNames, persistentState); err != nil {
+		return err
+	}
+	if err := c.recordLastWritten(ts, entries, persistentState); err != nil {
+		return err
+	}
+	// Only a full apply puts the destination directory at a commit of the
+	// source directory.
+	if len(args) == 0 && c.remote.url == "" {
+		if err := c.recordAppliedSource(persistentState); err != nil {
+			return err
+		}
+	}
+	// The apply succeeded, so there is nothing to resume.
+	return c.clearApplyProgress(persistentState)
 }
 
 func (c *Config) autoCommit(vcs VCS) error {
@@ -225,7 +677,18 @@ func (c *Config) autoCommit(vcs VCS) error {
 	if err != nil {
 		return err
 	}
-	commitMessageTmpl, err := template.New("commit_message").Funcs(c.templateFuncs).Parse(string(commitMessageText))
+	appliedSource, err := c.getAppliedSource()
+	if err != nil {
+		return err
+	}
+	commitMessageTmpl, err := template.New("commit_message").Funcs(c.templateFuncs).Funcs(template.FuncMap{
+		"lastAppliedCommit": func() string {
+			if appliedSource == nil {
+				return ""
+			}
+			return appliedSource.Commit
+		},
+	}).Parse(string(commitMessageText))
 	if err != nil {
 		return err
 	}
@@ -245,6 +708,9 @@ func (c *Config) autoCommitAndAutoPush(cmd *cobra.Command, args []string) error
 	if c.DryRun {
 		return nil
 	}
+	if err := c.maintainGitFiles(); err != nil {
+		return err
+	}
 	if c.SourceVCS.AutoCommit || c.SourceVCS.AutoPush {
 		if err := c.autoCommit(vcs); err != nil {
 			return err
@@ -266,6 +732,69 @@ func (c *Config) autoPush(vcs VCS) error {
 	return c.run(c.SourceDir, c.SourceVCS.Command, pushArgs...)
 }
 
+// useSourceDirFlag uses c.SourceDir, as set by --source, for this invocation.
+// Relative paths are resolved against the working directory and the directory
+// must exist. A directory other than configSourceDir and c.SourceDirs, for
+// example a scratch checkout, is used as the only source directory, is never
+// automatically committed or pushed, and records the state of applying it,
+// including its scripts and targets, separately so that, for example, run_once_
+// scripts run from it are not recorded as run for the configured source
+// directory and the configured source directory's targets are not pruned.
+func (c *Config) useSourceDirFlag(configSourceDir string) error {
+	sourceDir := c.SourceDir
+	if !filepath.IsAbs(sourceDir) {
+		sourceDir = filepath.Join(c.workingDir, sourceDir)
+	}
+	sourceDir = filepath.Clean(sourceDir)
+	info, err := c.fs.Stat(sourceDir)
+	switch {
+	case os.IsNotExist(err):
+		return fmt.Errorf("%s: source directory does not exist", sourceDir)
+	case err != nil:
+		return err
+	case !info.IsDir():
+		return fmt.Errorf("%s: not a directory", sourceDir)
+	}
+	c.SourceDir = sourceDir
+	if sourceDir == filepath.Clean(configSourceDir) {
+		return nil
+	}
+	for _, dir := range c.SourceDirs {
+		if sourceDir == filepath.Clean(dir) {
+			c.SourceDir = dir
+			return nil
+		}
+	}
+	c.SourceDirs = nil
+	c.SourceVCS.AutoCommit = false
+	c.SourceVCS.AutoPush = false
+	c.namespaceApplyBuckets(sourceDir)
+	return nil
+}
+
+// namespaceApplyBuckets moves the persistent state buckets that record the
+// state of applying the source state to the destination directory into the
+// namespace namespace.
+func (c *Config) namespaceApplyBuckets(namespace string) {
+	for _, bucket := range []*[]byte{
+		&c.applyProgressBucket,
+		&c.appliedSourceBucket,
+		&c.appliedTargetBucket,
+		&c.destStateBucket,
+		&c.lastWrittenBucket,
+		&c.scriptStateBucket,
+	} {
+		*bucket = namespaceBucket(*bucket, namespace)
+	}
+}
+
+// namespaceBucket returns the name of bucket in the persistent state namespace
+// namespace, so state recorded for different source or destination directories
+// does not collide.
+func namespaceBucket(bucket []byte, namespace string) []byte {
+	return []byte(string(bucket) + ":" + namespace)
+}
+
 // ensureNoError ensures that no error was encountered when loading c.
 func (c *Config) ensureNoError(cmd *cobra.Command, args []string) error {
 	if c.err != nil {
@@ -300,32 +829,237 @@ func (c *Config) ensureSourceDirectory() error {
 	}
 }
 
+// A dataLayer is a source of template data.
+type dataLayer struct {
+	origin string
+	data   map[string]interface{}
+}
+
 func (c *Config) getData() (map[string]interface{}, error) {
+	layers, err := c.getDataLayers()
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]interface{})
+	for _, layer := range layers {
+		if err := c.mergeTopLevelData(data, layer.data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// getDataLayers returns the sources of template data in increasing order of
+// precedence. Data from the source directory overrides the default data, and
+// data from the config file overrides both.
+func (c *Config) getDataLayers() ([]dataLayer, error) {
 	defaultData, err := c.getDefaultData()
 	if err != nil {
 		return nil, err
 	}
-	data := map[string]interface{}{
-		"chezmoi": defaultData,
+	layers := []dataLayer{
+		{
+			origin: "default",
+			data: map[string]interface{}{
+				"chezmoi": defaultData,
+			},
+		},
+	}
+
+	sourceRoots, err := c.getSourceRoots(c.SourceDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, sourceRoot := range sourceRoots {
+		for _, format := range formats() {
+			sourceData, err := c.getSourceData(sourceRoot, format)
+			if err != nil {
+				return nil, err
+			}
+			if sourceData == nil {
+				continue
+			}
+			layers = append(layers, dataLayer{
+				origin: filepath.Join(sourceRoot, dataName+"."+format),
+				data:   sourceData,
+			})
+		}
+	}
+
+	if len(c.Data) != 0 {
+		origin := c.configFile
+		if origin == "" {
+			origin = "config"
+		}
+		layers = append(layers, dataLayer{
+			origin: origin,
+			data:   c.Data,
+		})
+	}
+	return layers, nil
+}
+
+// getSourceData returns the data in the .chezmoidata file of the given format
+// in sourceDir, or nil if there is no such file.
+func (c *Config) getSourceData(sourceDir, format string) (map[string]interface{}, error) {
+	path := filepath.Join(sourceDir, dataName+"."+format)
+	contents, err := c.fs.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return nil, nil
+	case err != nil:
+		return nil, err
 	}
-	for key, value := range c.Data {
-		data[key] = value
+	var data map[string]interface{}
+	switch format {
+	case "json":
+		err = json.Unmarshal(contents, &data)
+	case "toml":
+		var tree *toml.Tree
+		if tree, err = toml.LoadBytes(contents); err == nil {
+			data = tree.ToMap()
+		}
+	case "yaml":
+		err = yaml.Unmarshal(contents, &data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
 	}
 	return data, nil
 }
 
+// mergeTopLevelData merges src into dst, replacing rather than merging the
+// top-level keys whose merge mode is replace.
+func (c *Config) mergeTopLevelData(dst, src map[string]interface{}) error {
+	for key, value := range src {
+		switch mergeMode := c.DataMergeMode[key]; mergeMode {
+		case "", "merge":
+			if err := mergeData(dst, map[string]interface{}{key: value}, ""); err != nil {
+				return err
+			}
+		case "replace":
+			dst[key] = copyData(value)
+		default:
+			return fmt.Errorf("dataMergeMode.%s: invalid merge mode: %s", key, mergeMode)
+		}
+	}
+	return nil
+}
+
+// mergeData recursively merges src into dst. Maps are merged key by key and
+// all other values in src, including slices, replace those in dst. Merging a
+// map with a value that is not a map is an error. keyPath is the path of dst
+// and is used in errors.
+func mergeData(dst, src map[string]interface{}, keyPath string) error {
+	for key, srcValue := range src {
+		path := key
+		if keyPath != "" {
+			path = keyPath + "." + key
+		}
+		dstValue, ok := dst[key]
+		if !ok {
+			dst[key] = copyData(srcValue)
+			continue
+		}
+		dstMap, dstIsMap := toStringMap(dstValue)
+		srcMap, srcIsMap := toStringMap(srcValue)
+		switch {
+		case dstIsMap && srcIsMap:
+			if err := mergeData(dstMap, srcMap, path); err != nil {
+				return err
+			}
+			dst[key] = dstMap
+		case dstIsMap:
+			return fmt.Errorf("%s: cannot merge %T into map", path, srcValue)
+		case srcIsMap:
+			return fmt.Errorf("%s: cannot merge map into %T", path, dstValue)
+		default:
+			dst[key] = copyData(srcValue)
+		}
+	}
+	return nil
+}
+
+// copyData returns a deep copy of the maps and slices in value, converting the
+// map[interface{}]interface{}s produced by YAML decoding to
+// map[string]interface{}s.
+func copyData(value interface{}) interface{} {
+	if m, ok := toStringMap(value); ok {
+		return m
+	}
+	if s, ok := value.([]interface{}); ok {
+		result := make([]interface{}, 0, len(s))
+		for _, elem := range s {
+			result = append(result, copyData(elem))
+		}
+		return result
+	}
+	return value
+}
+
+// toStringMap returns a deep copy of value as a map[string]interface{} and
+// true if value is a map, or nil and false otherwise.
+func toStringMap(value interface{}) (map[string]interface{}, bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			result[k] = copyData(v)
+		}
+		return result, true
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			result[fmt.Sprint(k)] = copyData(v)
+		}
+		return result, true
+	default:
+		return nil, false
+	}
+}
+
 func (c *Config) getDefaultData() (map[string]interface{}, error) {
 	data := map[string]interface{}{
-		"arch":      runtime.GOARCH,
-		"os":        runtime.GOOS,
-		"sourceDir": c.SourceDir,
+		"arch":    runtime.GOARCH,
+		"os":      runtime.GOOS,
+		"umask":   c.Umask.String(),
+		"version": rootCmd.Version,
+	}
+
+	// The config file is always set, even if it does not exist, so templates
+	// can use it without checking.
+	configFile := c.configFile
+	if configFile != "" {
+		var err error
+		configFile, err = filepath.Abs(configFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	data["configFile"] = configFile
+
+	// The last applied commit is the empty string if the source directory
+	// has never been applied.
+	var lastAppliedCommit string
+	if appliedSource, err := c.getAppliedSource(); err != nil {
+		return nil, err
+	} else if appliedSource != nil {
+		lastAppliedCommit = appliedSource.Commit
 	}
+	data["lastAppliedCommit"] = lastAppliedCommit
 
-	currentUser, err := user.Current()
+	sourceRoot, err := c.getSourceRoot(c.SourceDir)
 	if err != nil {
 		return nil, err
 	}
-	data["username"] = currentUser.Username
+	data["sourceDir"] = sourceRoot
+
+	// The current user cannot always be looked up, for example in minimal
+	// containers. Keys whose values cannot be determined are omitted, so only
+	// templates that use them fail.
+	if username := c.userLookup.getUsername(); username != "" {
+		data["username"] = username
+	}
 
 	// user.LookupGroupId is generally unreliable:
 	//
@@ -338,16 +1072,30 @@ func (c *Config) getDefaultData() (map[string]interface{}, error) {
 	// being used, and so the lookup fails.
 	//
 	// So, only set group if user.LookupGroupId does not return an error.
-	group, err := user.LookupGroupId(currentUser.Gid)
-	if err == nil {
-		data["group"] = group.Name
+	if currentUser, err := c.userLookup.currentUser(); err == nil {
+		if group, err := user.LookupGroupId(currentUser.Gid); err == nil {
+			data["group"] = group.Name
+		}
 	}
 
-	homedir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, err
+	if homeDir, err := c.userLookup.getHomeDir(); err == nil {
+		data["homedir"] = homeDir
+	}
+
+	// The shell and locale are always set, to the empty string if they cannot
+	// be determined, so templates can use them without checking.
+	data["shell"] = c.userLookup.getShell()
+	data["locale"] = c.userLookup.getLocale()
+
+	// The destination directory is the home directory unless it is
+	// overridden, for example with --destination.
+	if c.DestDir != "" {
+		destDir, err := filepath.Abs(c.DestDir)
+		if err != nil {
+			return nil, err
+		}
+		data["destDir"] = destDir
 	}
-	data["homedir"] = homedir
 
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -375,69 +1123,968 @@ func (c *Config) getDefaultData() (map[string]interface{}, error) {
 	return data, nil
 }
 
-func (c *Config) getEditor() (string, []string) {
-	editor := os.Getenv("VISUAL")
-	if editor == "" {
-		editor = os.Getenv("EDITOR")
+// getEncryptedMode returns how archive and dump export encrypted files. They
+// are only decrypted if decrypt is set.
+func (c *Config) getEncryptedMode(decrypt bool) (chezmoi.EncryptedMode, error) {
+	if decrypt {
+		return chezmoi.EncryptedModeDecrypt, nil
 	}
-	if editor == "" {
-		editor = "vi"
+	encryptedMode, ok := encryptedModes[c.Encryption.Export]
+	if !ok {
+		return 0, fmt.Errorf("%s: unknown encryption.export", c.Encryption.Export)
 	}
-	components := whitespaceRegexp.Split(editor, -1)
-	return components[0], components[1:]
+	return encryptedMode, nil
 }
 
-func (c *Config) getEntries(ts *chezmoi.TargetState, args []string) ([]chezmoi.Entry, error) {
-	entries := []chezmoi.Entry{}
-	for _, arg := range args {
-		targetPath, err := filepath.Abs(arg)
-		if err != nil {
-			return nil, err
-		}
-		entry, err := ts.Get(c.fs, targetPath)
-		if err != nil {
-			return nil, err
-		}
-		if entry == nil {
-			return nil, fmt.Errorf("%s: not in source state", arg)
+// getEncryption returns the encryption selected by encryption.method.
+func (c *Config) getEncryption() (chezmoi.Encryption, error) {
+	switch c.Encryption.Method {
+	case "age":
+		return &c.Age, nil
+	case "gpg":
+		// For backwards compatibility, prioritize gpgRecipient over
+		// gpg.recipient.
+		if c.GPGRecipient != "" {
+			c.GPG.Recipient = c.GPGRecipient
 		}
-		entries = append(entries, entry)
+		return &c.GPG, nil
+	default:
+		return nil, fmt.Errorf("%s: unknown encryption.method", c.Encryption.Method)
 	}
-	return entries, nil
 }
 
-func (c *Config) getPersistentState(options *bolt.Options) (chezmoi.PersistentState, error) {
-	persistentStateFile := c.getPersistentStateFile()
-	if c.DryRun {
-		if options == nil {
+// getEditor returns the editor command and its arguments.
+func (c *Config) getEditor() (string, []string, error) {
+	return getEditor(c.Edit, os.Getenv, runtime.GOOS)
+}
+
+// getEditor returns the editor command and its arguments from edit, if set,
+// or else from $VISUAL or $EDITOR, as returned by getenv, or else the default
+// editor for goos. Editors from the environment are split into words like a
+// shell would, so that arguments and paths containing spaces can be quoted.
+func getEditor(edit editCmdConfig, getenv func(string) string, goos string) (string, []string, error) {
+	if edit.Command != "" {
+		return edit.Command, edit.Args, nil
+	}
+	for _, key := range []string{"VISUAL", "EDITOR"} {
+		value := getenv(key)
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		words, err := splitShellWords(value, goos != "windows")
+		if err != nil {
+			return "", nil, fmt.Errorf("$%s: %w", key, err)
+		}
+		return words[0], words[1:], nil
+	}
+	if goos == "windows" {
+		return "notepad", nil, nil
+	}
+	return "vi", nil, nil
+}
+
+// splitShellWords splits s into words like a POSIX shell, honoring single
+// quotes, double quotes, and, if backslashEscapes is true, backslash escapes.
+// Backslashes are not escapes on Windows, where they separate path
+// components.
+func splitShellWords(s string, backslashEscapes bool) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case r == '\'':
+			inWord = true
+			j := i + 1
+			for j < len(runes) && runes[j] != '\'' {
+				j++
+			}
+			if j == len(runes) {
+				return nil, errors.New("unterminated single quote")
+			}
+			word.WriteString(string(runes[i+1 : j]))
+			i = j
+		case r == '"':
+			inWord = true
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if backslashEscapes && runes[j] == '\\' && j+1 < len(runes) && strings.ContainsRune("\"\\$`", runes[j+1]) {
+					j++
+				}
+				word.WriteRune(runes[j])
+			}
+			if j == len(runes) {
+				return nil, errors.New("unterminated double quote")
+			}
+			i = j
+		case r == '\\' && backslashEscapes:
+			inWord = true
+			if i+1 == len(runes) {
+				return nil, errors.New("trailing backslash")
+			}
+			i++
+			word.WriteRune(runes[i])
+		default:
+			inWord = true
+			word.WriteRune(r)
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// getElevate returns a function that returns whether an absolute path requires
+// elevated privileges, according to c.Elevation.Targets.
+func (c *Config) getElevate() (func(string) bool, error) {
+	destDir, err := filepath.Abs(c.DestDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range c.Elevation.Targets {
+		if _, err := doublestar.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("elevation.targets: %s: %w", pattern, err)
+		}
+	}
+	return func(name string) bool {
+		relPath, err := filepath.Rel(destDir, name)
+		if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			return false
+		}
+		for _, pattern := range c.Elevation.Targets {
+			if ok, _ := doublestar.Match(pattern, filepath.ToSlash(relPath)); ok {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// getOwner returns a function that returns the owner of a target name, or nil
+// if no owners are configured. Owners are only looked up when a target first
+// matches their patterns, and an owner that cannot be looked up is warned about
+// once and then ignored, so that a missing user does not break every command.
+func (c *Config) getOwner() (func(string) *chezmoi.Owner, error) {
+	if len(c.Owners) == 0 {
+		return nil, nil
+	}
+	for _, ownerConfig := range c.Owners {
+		for _, pattern := range ownerConfig.Targets {
+			if _, err := doublestar.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("owners.targets: %s: %w", pattern, err)
+			}
+		}
+	}
+	owners := make([]*chezmoi.Owner, len(c.Owners))
+	onces := make([]sync.Once, len(c.Owners))
+	lookupOwner := func(i int) *chezmoi.Owner {
+		onces[i].Do(func() {
+			owner, err := c.userLookup.lookupOwner(c.Owners[i].Owner)
+			if err != nil {
+				fmt.Fprintf(c.Stderr, "warning: owners.owner: %v, not changing owners\n", err)
+				return
+			}
+			owners[i] = owner
+		})
+		return owners[i]
+	}
+	return func(targetName string) *chezmoi.Owner {
+		for i, ownerConfig := range c.Owners {
+			for _, pattern := range ownerConfig.Targets {
+				if ok, _ := doublestar.Match(pattern, filepath.ToSlash(targetName)); ok {
+					return lookupOwner(i)
+				}
+			}
+		}
+		return nil
+	}, nil
+}
+
+// getCanChangeOwner returns a function that returns whether chezmoi can give a
+// target in destDir to its owner, that is if it is running as root or the
+// target is elevated. Otherwise it warns, once per target, that the owner is not changed.
+func (c *Config) getCanChangeOwner(destDir string) (func(string, *chezmoi.Owner) bool, error) {
+	elevate := func(string) bool { return false }
+	if len(c.Elevation.Targets) != 0 {
+		var err error
+		elevate, err = c.getElevate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	privileged := c.userLookup.getEUID() == 0
+	warned := make(map[string]bool)
+	return func(targetName string, owner *chezmoi.Owner) bool {
+		if privileged || elevate(filepath.Join(destDir, targetName)) {
+			return true
+		}
+		if !warned[targetName] {
+			fmt.Fprintf(c.Stderr, "warning: %s: not running as root, not changing owner to %d:%d\n", targetName, owner.UID, owner.GID)
+			warned[targetName] = true
+		}
+		return false
+	}, nil
+}
+
+// lookupOwner returns the owner described by s, which is a user optionally
+// followed by a colon and a group. Users and groups are looked up by name,
+// falling back to numeric IDs. If the group is omitted then the user's primary
+// group is used.
+func (ul userLookup) lookupOwner(s string) (*chezmoi.Owner, error) {
+	username, groupname := s, ""
+	hasGroup := false
+	if index := strings.IndexByte(s, ':'); index != -1 {
+		username, groupname, hasGroup = s[:index], s[index+1:], true
+	}
+	if username == "" || hasGroup && groupname == "" {
+		return nil, fmt.Errorf("%q: invalid owner", s)
+	}
+
+	owner := &chezmoi.Owner{}
+	var primaryGID string
+	if u, err := ul.lookupUser(username); err == nil {
+		uid, err := strconv.Atoi(u.Uid)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid uid %q", username, u.Uid)
+		}
+		owner.UID = uid
+		owner.Username = u.Username
+		primaryGID = u.Gid
+	} else if uid, err := strconv.Atoi(username); err == nil && uid >= 0 {
+		owner.UID = uid
+	} else {
+		return nil, fmt.Errorf("%s: unknown user", username)
+	}
+
+	if !hasGroup {
+		if primaryGID == "" {
+			return nil, fmt.Errorf("%s: group required for unknown user", username)
+		}
+		gid, err := strconv.Atoi(primaryGID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid gid %q", username, primaryGID)
+		}
+		owner.GID = gid
+		if g, err := ul.lookupGroupID(primaryGID); err == nil {
+			owner.Groupname = g.Name
+		}
+		return owner, nil
+	}
+
+	if g, err := ul.lookupGroup(groupname); err == nil {
+		gid, err := strconv.Atoi(g.Gid)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid gid %q", groupname, g.Gid)
+		}
+		owner.GID = gid
+		owner.Groupname = g.Name
+	} else if gid, err := strconv.Atoi(groupname); err == nil && gid >= 0 {
+		owner.GID = gid
+	} else {
+		return nil, fmt.Errorf("%s: unknown group", groupname)
+	}
+	return owner, nil
+}
+
+// getApplyPopulateOptions returns the options to populate the target state
+// for commands that apply it to args. Encrypted directories are not decrypted
+// if encrypted targets are excluded, and plain files are populated as symlinks
+// in symlink mode.
+func (c *Config) getApplyPopulateOptions(args []string) *chezmoi.PopulateOptions {
+	populateOptions := c.getArgsPopulateOptions(args)
+	if !c.isExcludingEncrypted() && !c.isSymlinkMode() {
+		return populateOptions
+	}
+	if populateOptions == nil {
+		populateOptions = &chezmoi.PopulateOptions{
+			ExecuteTemplates: true,
+		}
+	}
+	populateOptions.NoDecrypt = c.isExcludingEncrypted()
+	populateOptions.Symlink = c.isSymlinkMode()
+	return populateOptions
+}
+
+// getStdoutWidth returns the width of the terminal if c.Stdout is a terminal,
+// or 80 otherwise.
+func (c *Config) getStdoutWidth() (int, error) {
+	if stdout, ok := c.Stdout.(*os.File); ok && terminal.IsTerminal(int(stdout.Fd())) {
+		width, _, err := terminal.GetSize(int(stdout.Fd()))
+		return width, err
+	}
+	return 80, nil
+}
+
+// isSymlinkMode returns whether plain files are applied as symlinks to their
+// source files, either by --symlink or by symlink.
+func (c *Config) isSymlinkMode() bool {
+	return c.symlink || c.Symlink
+}
+
+// isExcludingEncrypted returns whether encrypted targets are excluded, either
+// by --exclude-encrypted or by encryption.exclude.
+func (c *Config) isExcludingEncrypted() bool {
+	return c.excludeEncrypted || c.Encryption.Exclude
+}
+
+// isEncrypted returns whether entry is encrypted or is inside an encrypted
+// directory.
+func isEncrypted(ts *chezmoi.TargetState, entry chezmoi.Entry) bool {
+	switch entry := entry.(type) {
+	case *chezmoi.Dir:
+		if entry.Encrypted {
+			return true
+		}
+	case *chezmoi.File:
+		if entry.Encrypted {
+			return true
+		}
+	}
+	return ts.EncryptedDir(entry) != nil
+}
+
+// suggestExcludeEncrypted returns err, suggesting --exclude-encrypted if err
+// is because a source file could not be decrypted.
+func suggestExcludeEncrypted(err error) error {
+	var decryptionErr *chezmoi.DecryptionError
+	if errors.As(err, &decryptionErr) {
+		return fmt.Errorf("%w (use --exclude-encrypted to skip encrypted targets)", err)
+	}
+	return err
+}
+
+// getArgsPopulateOptions returns the options to populate only the parts of the
+// target state needed for args, or nil if the whole target state is needed.
+// Only absolute arguments, and relative arguments with --relative-to-dest,
+// that are not globs are resolved without the target state.
+func (c *Config) getArgsPopulateOptions(args []string) *chezmoi.PopulateOptions {
+	// Mapped target names cannot be restricted before the source state is
+	// populated.
+	if len(args) == 0 || len(c.PathMap) != 0 {
+		return nil
+	}
+	destDir, err := filepath.Abs(c.DestDir)
+	if err != nil {
+		return nil
+	}
+	targetNames := make([]string, 0, len(args))
+	for _, arg := range args {
+		var targetPath string
+		switch {
+		case isGlob(arg):
+			return nil
+		case filepath.IsAbs(arg):
+			targetPath = filepath.Clean(arg)
+		case c.relativeToDest:
+			targetPath = filepath.Join(destDir, arg)
+		default:
+			return nil
+		}
+		targetName, err := filepath.Rel(destDir, targetPath)
+		if err != nil || targetName == "." || targetName == ".." || strings.HasPrefix(targetName, ".."+string(filepath.Separator)) {
+			return nil
+		}
+		targetNames = append(targetNames, targetName)
+	}
+	return &chezmoi.PopulateOptions{
+		ExecuteTemplates: true,
+		TargetNames:      targetNames,
+	}
+}
+
+// getEntries returns the entries in ts for args. args may contain glob
+// patterns, which are expanded against the managed targets in ts rather than
+// the filesystem. Entries excluded by c.exclude are omitted.
+func (c *Config) getEntries(ts *chezmoi.TargetState, args []string) ([]chezmoi.Entry, error) {
+	excluded, err := c.getExcluded(ts)
+	if err != nil {
+		return nil, err
+	}
+	entries := []chezmoi.Entry{}
+	seenTargetNames := make(map[string]struct{})
+	// Every bad argument is reported, not just the first.
+	var errMsgs []string
+	for _, arg := range args {
+		argEntries, err := c.getArgEntries(ts, arg)
+		if err != nil {
+			errMsgs = append(errMsgs, err.Error())
+			continue
+		}
+		for _, entry := range argEntries {
+			targetName := entry.TargetName()
+			if _, ok := seenTargetNames[targetName]; ok || excluded(targetName) {
+				continue
+			}
+			seenTargetNames[targetName] = struct{}{}
+			entries = append(entries, entry)
+		}
+	}
+	if len(errMsgs) != 0 {
+		return nil, errors.New(strings.Join(errMsgs, "\n"))
+	}
+	return entries, nil
+}
+
+// checkNotInEncryptedDirs returns an error if any of entries are inside an
+// encrypted directory, whose source state can only be changed as a whole.
+func checkNotInEncryptedDirs(ts *chezmoi.TargetState, entries []chezmoi.Entry) error {
+	for _, entry := range entries {
+		if dir := ts.EncryptedDir(entry); dir != nil {
+			return fmt.Errorf("%s: inside encrypted directory %s", filepath.Join(ts.DestDir, entry.TargetName()), filepath.Join(ts.DestDir, dir.TargetName()))
+		}
+	}
+	return nil
+}
+
+// getArgEntries returns the entries in ts matching arg.
+func (c *Config) getArgEntries(ts *chezmoi.TargetState, arg string) ([]chezmoi.Entry, error) {
+	if isGlob(arg) {
+		entries, err := c.globArg(ts, arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			return nil, fmt.Errorf("%s: no matching targets", arg)
+		}
+		return entries, nil
+	}
+	targetPath, err := c.getTargetPath(ts, arg)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := ts.Get(c.fs, targetPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist) || err == nil && entry == nil:
+		return nil, c.notInSourceStateError(ts, arg, targetPath)
+	case err != nil:
+		return nil, err
+	}
+	return []chezmoi.Entry{entry}, nil
+}
+
+// notInSourceStateError returns an error explaining why targetPath, given as
+// arg, is not in ts. It reports whether targetPath is ignored, whether it is
+// inside a managed directory, and the closest managed target.
+func (c *Config) notInSourceStateError(ts *chezmoi.TargetState, arg, targetPath string) error {
+	targetName, err := filepath.Rel(ts.DestDir, targetPath)
+	if err != nil {
+		return err
+	}
+	for name := targetName; name != "." && name != string(filepath.Separator); name = filepath.Dir(name) {
+		if ts.TargetIgnore.Match(name) {
+			return fmt.Errorf("%s: ignored by .chezmoiignore on this machine", arg)
+		}
+	}
+
+	msg := fmt.Sprintf("%s: not in source state", arg)
+	for dirName := filepath.Dir(targetName); dirName != "."; dirName = filepath.Dir(dirName) {
+		if entry, err := ts.Get(c.fs, filepath.Join(ts.DestDir, dirName)); err == nil {
+			if _, ok := entry.(*chezmoi.Dir); ok {
+				msg += fmt.Sprintf(", but is inside managed directory %s", filepath.Join(ts.DestDir, dirName))
+				break
+			}
+		}
+	}
+
+	// Suggest the managed target with the smallest edit distance, as long as
+	// it is no more than half the length of the target name.
+	suggestion := ""
+	minDistance := len(targetName)/2 + 1
+	for _, entry := range ts.AllEntries() {
+		if ts.TargetIgnore.Match(entry.TargetName()) {
+			continue
+		}
+		distance := editDistance(targetName, entry.TargetName())
+		if distance < minDistance || distance == minDistance && suggestion != "" && entry.TargetName() < suggestion {
+			suggestion = entry.TargetName()
+			minDistance = distance
+		}
+	}
+	if suggestion != "" {
+		msg += fmt.Sprintf(", did you mean %s?", filepath.Join(ts.DestDir, suggestion))
+	}
+
+	return errors.New(msg)
+}
+
+// getExcluded returns a function that returns whether a target name is
+// excluded by c.exclude.
+func (c *Config) getExcluded(ts *chezmoi.TargetState) (func(string) bool, error) {
+	patterns := make([]string, 0, len(c.exclude))
+	for _, exclude := range c.exclude {
+		// Entry types are handled by getEntryFilter.
+		if _, ok := entryTypeNames[exclude]; ok {
+			continue
+		}
+		pattern, err := c.absArg(ts, exclude)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := doublestar.PathMatch(pattern, pattern); err != nil {
+			return nil, fmt.Errorf("%s: %w", exclude, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return func(targetName string) bool {
+		targetPath := filepath.Join(ts.DestDir, targetName)
+		for _, pattern := range patterns {
+			if ok, _ := doublestar.PathMatch(pattern, targetPath); ok {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// getSkipTarget returns a function that returns whether a target name matches
+// any of c.SkipTargets. Relative globs, and globs beginning with ~/, are
+// relative to the destination directory.
+func (c *Config) getSkipTarget(ts *chezmoi.TargetState) (func(string) bool, error) {
+	patterns := make([]string, 0, len(c.SkipTargets))
+	for _, skipTarget := range c.SkipTargets {
+		pattern := filepath.FromSlash(skipTarget)
+		switch {
+		case strings.HasPrefix(skipTarget, "~/"):
+			pattern = filepath.Join(ts.DestDir, pattern[2:])
+		case !filepath.IsAbs(pattern):
+			pattern = filepath.Join(ts.DestDir, pattern)
+		}
+		if _, err := doublestar.PathMatch(pattern, pattern); err != nil {
+			return nil, fmt.Errorf("skipTargets: %s: %w", skipTarget, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return func(targetName string) bool {
+		targetPath := filepath.Join(ts.DestDir, targetName)
+		for _, pattern := range patterns {
+			if ok, _ := doublestar.PathMatch(pattern, targetPath); ok {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// absArg returns the absolute path of arg. If c.relativeToDest is set then
+// relative paths are relative to the destination directory, otherwise they
+// are relative to the working directory.
+func (c *Config) absArg(ts *chezmoi.TargetState, arg string) (string, error) {
+	switch {
+	case filepath.IsAbs(arg):
+		return filepath.Clean(arg), nil
+	case c.relativeToDest:
+		return filepath.Join(ts.DestDir, arg), nil
+	case c.workingDir != "":
+		return filepath.Join(c.workingDir, arg), nil
+	default:
+		return filepath.Abs(arg)
+	}
+}
+
+// getTargetPath returns the target path of arg. If arg is relative, does not
+// exist relative to the working directory, and is not managed relative to the
+// working directory, but does exist or is managed relative to the destination
+// directory, then it is resolved relative to the destination directory.
+func (c *Config) getTargetPath(ts *chezmoi.TargetState, arg string) (string, error) {
+	targetPath, err := c.absArg(ts, arg)
+	if err != nil || filepath.IsAbs(arg) || c.relativeToDest {
+		return targetPath, err
+	}
+	destTargetPath := filepath.Join(ts.DestDir, arg)
+	if destTargetPath == targetPath || !c.targetPathExists(ts, destTargetPath) {
+		return targetPath, nil
+	}
+	if c.targetPathExists(ts, targetPath) {
+		if c.Verbose {
+			fmt.Fprintf(c.Stderr, "%s: resolved relative to the working directory, not the destination directory\n", arg)
+		}
+		return targetPath, nil
+	}
+	return destTargetPath, nil
+}
+
+// globArg returns the entries in ts matching the glob pattern arg. If arg is
+// relative and matches no entries relative to the working directory, then it
+// is matched relative to the destination directory.
+func (c *Config) globArg(ts *chezmoi.TargetState, arg string) ([]chezmoi.Entry, error) {
+	pattern, err := c.absArg(ts, arg)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := c.globEntries(ts, pattern)
+	if err != nil || len(entries) != 0 || filepath.IsAbs(arg) || c.relativeToDest {
+		return entries, err
+	}
+	return c.globEntries(ts, filepath.Join(ts.DestDir, arg))
+}
+
+// globEntries returns the entries in ts whose target paths match pattern,
+// sorted by target name.
+func (c *Config) globEntries(ts *chezmoi.TargetState, pattern string) ([]chezmoi.Entry, error) {
+	var entries []chezmoi.Entry
+	for _, entry := range ts.AllEntries() {
+		if ts.TargetIgnore.Match(entry.TargetName()) {
+			continue
+		}
+		ok, err := doublestar.PathMatch(pattern, filepath.Join(ts.DestDir, entry.TargetName()))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].TargetName() < entries[j].TargetName()
+	})
+	return entries, nil
+}
+
+// targetPathExists returns whether targetPath exists in the filesystem or is
+// managed by ts.
+func (c *Config) targetPathExists(ts *chezmoi.TargetState, targetPath string) bool {
+	if _, err := c.fs.Lstat(targetPath); err == nil {
+		return true
+	}
+	entry, err := ts.Get(c.fs, targetPath)
+	return err == nil && entry != nil
+}
+
+// A sharedPersistentState is a persistent state that c can read while it is
+// open.
+type sharedPersistentState struct {
+	chezmoi.PersistentState
+	c        *Config
+	readOnly bool
+}
+
+// Close closes s and stops c from reading it.
+func (s *sharedPersistentState) Close() error {
+	if s.c.persistentState == s {
+		s.c.persistentState = nil
+	}
+	return s.PersistentState.Close()
+}
+
+// getPersistentState returns the persistent state. If persistent state is
+// disabled, or if the persistent state is only read and cannot be opened, then
+// an empty in-memory persistent state is returned instead. The persistent state
+// is remembered until it is closed so that it can be read while it is open, for
+// example when building the template data, without opening it again.
+func (c *Config) getPersistentState(options *bolt.Options) (chezmoi.PersistentState, error) {
+	persistentState, err := c.openPersistentState(options)
+	if err != nil {
+		return nil, err
+	}
+	sharedPersistentState := &sharedPersistentState{
+		PersistentState: persistentState,
+		c:               c,
+		readOnly:        c.DryRun || options != nil && options.ReadOnly,
+	}
+	c.persistentState = sharedPersistentState
+	return sharedPersistentState, nil
+}
+
+// isMemoryPersistentState returns whether persistentState is only kept in
+// memory.
+func isMemoryPersistentState(persistentState chezmoi.PersistentState) bool {
+	if s, ok := persistentState.(*sharedPersistentState); ok {
+		persistentState = s.PersistentState
+	}
+	_, ok := persistentState.(*chezmoi.MemoryPersistentState)
+	return ok
+}
+
+// openPersistentState opens the persistent state as described in
+// getPersistentState.
+func (c *Config) openPersistentState(options *bolt.Options) (chezmoi.PersistentState, error) {
+	if c.NoPersistentState {
+		return chezmoi.NewMemoryPersistentState(), nil
+	}
+	persistentStateFile := c.getPersistentStateFile()
+	if legacyPersistentStateFile := c.getLegacyPersistentStateFile(); persistentStateFile == legacyPersistentStateFile && c.StateFile == "" && !c.DryRun {
+		persistentStateFile = c.migratePersistentStateFile(legacyPersistentStateFile, c.getDefaultPersistentStateFile())
+	}
+	if c.DryRun {
+		if options == nil {
 			options = &bolt.Options{}
 		}
 		options.ReadOnly = true
+	} else if err := c.repairOwnership(c.fs, persistentStateFile); err != nil {
+		return nil, err
 	}
-	return chezmoi.NewBoltPersistentState(c.fs, persistentStateFile, os.FileMode(c.Umask), options)
+	giveToSudoUser := c.giveToSudoUser(persistentStateFile)
+	persistentState, err := chezmoi.NewBoltPersistentState(c.fs, persistentStateFile, os.FileMode(c.Umask), options)
+	if err != nil && options != nil && options.ReadOnly {
+		fmt.Fprintf(c.Stderr, "warning: %s: %v, not using the persistent state\n", persistentStateFile, err)
+		return chezmoi.NewMemoryPersistentState(), nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := giveToSudoUser(); err != nil {
+		_ = persistentState.Close()
+		return nil, err
+	}
+	return persistentState, nil
 }
 
+// getPersistentStateFile returns the path of the persistent state file. This is
+// stateFile, if set, or else chezmoistate.boltdb in the chezmoi subdirectory of
+// the XDG state home directory. For backwards compatibility, if only the legacy
+// file next to the config file exists then it is returned instead.
 func (c *Config) getPersistentStateFile() string {
+	if c.StateFile != "" {
+		return c.StateFile
+	}
+	persistentStateFile := c.getDefaultPersistentStateFile()
+	if _, err := c.fs.Stat(persistentStateFile); err == nil {
+		return persistentStateFile
+	}
+	if legacyPersistentStateFile := c.getLegacyPersistentStateFile(); legacyPersistentStateFile != "" {
+		return legacyPersistentStateFile
+	}
+	return persistentStateFile
+}
+
+// getDefaultPersistentStateFile returns the default path of the persistent
+// state file in the XDG state home directory.
+func (c *Config) getDefaultPersistentStateFile() string {
+	return filepath.Join(c.stateHome, "chezmoi", "chezmoistate.boltdb")
+}
+
+// getLegacyPersistentStateFile returns the path of the persistent state file
+// used by earlier versions of chezmoi, next to the config file, if it exists.
+func (c *Config) getLegacyPersistentStateFile() string {
+	var legacyPersistentStateFiles []string
 	if c.configFile != "" {
-		return filepath.Join(filepath.Dir(c.configFile), "chezmoistate.boltdb")
+		legacyPersistentStateFiles = append(legacyPersistentStateFiles, filepath.Join(filepath.Dir(c.configFile), "chezmoistate.boltdb"))
 	}
 	for _, configDir := range c.bds.ConfigDirs {
-		persistentStateFile := filepath.Join(configDir, "chezmoi", "chezmoistate.boltdb")
-		if _, err := os.Stat(persistentStateFile); err == nil {
-			return persistentStateFile
+		legacyPersistentStateFiles = append(legacyPersistentStateFiles, filepath.Join(configDir, "chezmoi", "chezmoistate.boltdb"))
+	}
+	legacyPersistentStateFiles = append(legacyPersistentStateFiles, filepath.Join(filepath.Dir(getDefaultConfigFile(c.bds)), "chezmoistate.boltdb"))
+	for _, legacyPersistentStateFile := range legacyPersistentStateFiles {
+		if _, err := c.fs.Stat(legacyPersistentStateFile); err == nil {
+			return legacyPersistentStateFile
 		}
 	}
-	return filepath.Join(filepath.Dir(getDefaultConfigFile(c.bds)), "chezmoistate.boltdb")
+	return ""
+}
+
+// migratePersistentStateFile copies the legacy persistent state file to
+// persistentStateFile and checks the copy, printing a notice. It returns the
+// path of the persistent state file to use, which is legacyPersistentStateFile
+// if the copy fails. The legacy file is left in place, as the config directory
+// might be read-only.
+func (c *Config) migratePersistentStateFile(legacyPersistentStateFile, persistentStateFile string) string {
+	info, err := c.fs.Stat(legacyPersistentStateFile)
+	if err != nil || !info.Mode().IsRegular() {
+		return legacyPersistentStateFile
+	}
+	if err := c.copyPersistentStateFile(legacyPersistentStateFile, persistentStateFile); err != nil {
+		fmt.Fprintf(c.Stderr, "warning: %s: %v, using %s\n", persistentStateFile, err, legacyPersistentStateFile)
+		return legacyPersistentStateFile
+	}
+	fmt.Fprintf(c.Stderr, "notice: moved persistent state from %s to %s, %s can now be removed\n", legacyPersistentStateFile, persistentStateFile, legacyPersistentStateFile)
+	return persistentStateFile
+}
+
+// copyPersistentStateFile copies src to dst and verifies that dst has the
+// same contents as src, removing dst if it does not.
+func (c *Config) copyPersistentStateFile(src, dst string) error {
+	data, err := c.fs.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := vfs.MkdirAll(c.fs, filepath.Dir(dst), 0o700&^os.FileMode(c.Umask)); err != nil {
+		return err
+	}
+	if err := c.fs.WriteFile(dst, data, 0o600&^os.FileMode(c.Umask)); err != nil {
+		return err
+	}
+	if copied, err := c.fs.ReadFile(dst); err != nil || !bytes.Equal(copied, data) {
+		_ = c.fs.Remove(dst)
+		if err == nil {
+			err = errors.New("copy differs")
+		}
+		return err
+	}
+	return nil
+}
+
+// getHomeDir returns the current user's home directory, falling back to $HOME
+// and then to the home directory of the current user's account.
+func (ul userLookup) getHomeDir() (string, error) {
+	homeDir, err := ul.homeDir()
+	if err == nil && homeDir != "" {
+		return homeDir, nil
+	}
+	if homeDir := ul.getenv("HOME"); homeDir != "" {
+		return homeDir, nil
+	}
+	if currentUser, err := ul.currentUser(); err == nil && currentUser.HomeDir != "" {
+		return currentUser.HomeDir, nil
+	}
+	if err == nil {
+		err = errors.New("not set")
+	}
+	return "", fmt.Errorf("cannot determine home directory: %w", err)
+}
+
+// getUsername returns the current user's username, falling back to $USER and
+// then to $LOGNAME. It returns the empty string if the username cannot be
+// determined.
+func (ul userLookup) getUsername() string {
+	if currentUser, err := ul.currentUser(); err == nil && currentUser.Username != "" {
+		return currentUser.Username
+	}
+	for _, key := range []string{"USER", "LOGNAME"} {
+		if username := ul.getenv(key); username != "" {
+			return username
+		}
+	}
+	return ""
+}
+
+// getStateHome returns the XDG state home directory, which is $XDG_STATE_HOME,
+// as returned by getenv, or ~/.local/state if it is not set.
+func getStateHome(homeDir string, getenv func(string) string) string {
+	if stateHome := getenv("XDG_STATE_HOME"); stateHome != "" {
+		return stateHome
+	}
+	return filepath.Join(homeDir, ".local", "state")
+}
+
+// getScriptTempDirs returns the real paths of the directories in which scripts
+// are written before they are run, in order of preference. Unless
+// scripts.tempDir is set, scripts are written to a directory in the XDG runtime
+// directory, if there is one, or else to the system temporary directory. If
+// scripts cannot be run from there, for example because it is mounted noexec,
+// then they are written to a directory in the XDG cache directory instead.
+func (c *Config) getScriptTempDirs() ([]string, error) {
+	var tempDir string
+	switch {
+	case c.Scripts.TempDir != "":
+		tempDir = c.Scripts.TempDir
+	case c.bds.RuntimeDir != "":
+		tempDir = filepath.Join(c.bds.RuntimeDir, "chezmoi")
+	default:
+		tempDir = os.TempDir()
+	}
+	tempDirs := []string{
+		tempDir,
+		filepath.Join(c.bds.CacheHome, "chezmoi", "scripts"),
+	}
+	rawTempDirs := make([]string, 0, len(tempDirs))
+	for _, tempDir := range tempDirs {
+		rawTempDir, err := c.fs.RawPath(tempDir)
+		if err != nil {
+			return nil, err
+		}
+		rawTempDirs = append(rawTempDirs, rawTempDir)
+	}
+	return rawTempDirs, nil
+}
+
+// getSourceDirs returns the source directories in increasing order of
+// priority, with c.SourceDir replaced by sourceDir.
+func (c *Config) getSourceDirs(sourceDir string) []string {
+	if len(c.SourceDirs) == 0 {
+		return []string{sourceDir}
+	}
+	sourceDirs := make([]string, 0, len(c.SourceDirs))
+	for _, dir := range c.SourceDirs {
+		if dir == c.SourceDir {
+			dir = sourceDir
+		}
+		sourceDirs = append(sourceDirs, dir)
+	}
+	return sourceDirs
+}
+
+// getSourceRoot returns the root of the source state in sourceDir. This is
+// sourceDir itself unless sourceDir contains a .chezmoiroot file, in which case
+// it is the subdirectory of sourceDir named in that file.
+func (c *Config) getSourceRoot(sourceDir string) (string, error) {
+	data, err := c.fs.ReadFile(filepath.Join(sourceDir, rootName))
+	switch {
+	case os.IsNotExist(err):
+		return sourceDir, nil
+	case err != nil:
+		return "", err
+	}
+	relRoot := filepath.Clean(filepath.FromSlash(strings.TrimSpace(string(data))))
+	if filepath.IsAbs(relRoot) || relRoot == ".." || strings.HasPrefix(relRoot, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: %s: outside source directory", filepath.Join(sourceDir, rootName), relRoot)
+	}
+	return filepath.Join(sourceDir, relRoot), nil
+}
+
+// getSourceRoots returns the roots of the source state in each source
+// directory, with c.SourceDir replaced by sourceDir.
+func (c *Config) getSourceRoots(sourceDir string) ([]string, error) {
+	sourceDirs := c.getSourceDirs(sourceDir)
+	sourceRoots := make([]string, 0, len(sourceDirs))
+	for _, dir := range sourceDirs {
+		sourceRoot, err := c.getSourceRoot(dir)
+		if err != nil {
+			return nil, err
+		}
+		sourceRoots = append(sourceRoots, sourceRoot)
+	}
+	return sourceRoots, nil
 }
 
 func (c *Config) getTargetState(populateOptions *chezmoi.PopulateOptions) (*chezmoi.TargetState, error) {
-	fs := vfs.NewReadOnlyFS(c.fs)
+	return c.getTargetStateFromSourceDir(c.SourceDir, populateOptions)
+}
+
+// getTargetStateFromSourceDir returns the target state populated from
+// sourceDir, using the same data and template functions as c.SourceDir. The
+// source state is restricted first if the source directory is not trusted.
+func (c *Config) getTargetStateFromSourceDir(sourceDir string, populateOptions *chezmoi.PopulateOptions) (*chezmoi.TargetState, error) {
+	if err := c.checkTrust(); err != nil {
+		return nil, err
+	}
+	ts, err := c.newTargetState(sourceDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := ts.Populate(vfs.NewReadOnlyFS(c.fs), populateOptions); err != nil {
+		return nil, err
+	}
+	if Version != nil && ts.MinVersion != nil && Version.LessThan(*ts.MinVersion) {
+		return nil, fmt.Errorf("chezmoi version %s too old, source state requires at least %s", Version, ts.MinVersion)
+	}
+	return ts, nil
+}
 
+// newTargetState returns a new, unpopulated target state for sourceDir
+// configured from c. options are applied after c's configuration.
+func (c *Config) newTargetState(sourceDir string, options ...chezmoi.TargetStateOption) (*chezmoi.TargetState, error) {
 	data, err := c.getData()
 	if err != nil {
 		return nil, err
 	}
 
+	sourceRoot, err := c.getSourceRoot(sourceDir)
+	if err != nil {
+		return nil, err
+	}
+	sourceRoots, err := c.getSourceRoots(sourceDir)
+	if err != nil {
+		return nil, err
+	}
+
 	destDir := c.DestDir
 	if destDir != "" {
 		destDir, err = filepath.Abs(c.DestDir)
@@ -446,27 +2093,101 @@ func (c *Config) getTargetState(populateOptions *chezmoi.PopulateOptions) (*chez
 		}
 	}
 
-	// For backwards compatibility, prioritize gpgRecipient over gpg.recipient.
-	if c.GPGRecipient != "" {
-		c.GPG.Recipient = c.GPGRecipient
+	// Sort scoped directory rules by pattern so that the first matching rule
+	// is deterministic.
+	patterns := make([]string, 0, len(c.ScopedDirs))
+	for pattern := range c.ScopedDirs {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	scopedDirRules := make([]chezmoi.ScopedDirRule, 0, len(patterns))
+	for _, pattern := range patterns {
+		scopedDirRules = append(scopedDirRules, chezmoi.ScopedDirRule{
+			Pattern:   pattern,
+			Condition: c.ScopedDirs[pattern].Condition,
+			Priority:  c.ScopedDirs[pattern].Priority,
+		})
+	}
+
+	pathMap, err := getPathMap(c.PathMap, runtime.GOOS)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, err := c.getOwner()
+	if err != nil {
+		return nil, err
+	}
+
+	encryption, err := c.getEncryption()
+	if err != nil {
+		return nil, err
 	}
 
-	ts := chezmoi.NewTargetState(
+	scriptTempDirs, err := c.getScriptTempDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	return chezmoi.NewTargetState(append([]chezmoi.TargetStateOption{
 		chezmoi.WithDestDir(destDir),
-		chezmoi.WithGPG(&c.GPG),
-		chezmoi.WithSourceDir(c.SourceDir),
+		chezmoi.WithEncryptedPrivate(c.Encryption.Private),
+		chezmoi.WithEncryption(encryption),
+		chezmoi.WithOwner(owner),
+		chezmoi.WithPathMap(pathMap),
+		chezmoi.WithScopedDirRules(scopedDirRules),
+		chezmoi.WithScriptEnv([]string{"CHEZMOI_DEST_DIR=" + destDir}),
+		chezmoi.WithScriptTempDirs(scriptTempDirs),
+		chezmoi.WithSourceDir(sourceRoot),
+		chezmoi.WithSourceDirs(sourceRoots),
 		chezmoi.WithTemplateData(data),
 		chezmoi.WithTemplateFuncs(c.templateFuncs),
+		chezmoi.WithTemplateGlobs(c.TemplateGlobs),
 		chezmoi.WithTemplateOptions(c.Template.Options),
 		chezmoi.WithUmask(os.FileMode(c.Umask)),
-	)
-	if err := ts.Populate(fs, populateOptions); err != nil {
-		return nil, err
+	}, options...)...), nil
+}
+
+// getPathMap returns the map from logical target names to the target names
+// that they are deployed to on goos.
+func getPathMap(pathMapConfigs []pathMapConfig, goos string) (map[string]string, error) {
+	pathMap := make(map[string]string)
+	mappedNames := make(map[string]string)
+	for _, pmc := range pathMapConfigs {
+		target, ok := pmc.Targets[goos]
+		if !ok {
+			continue
+		}
+		name, err := getPathMapName(pmc.Name)
+		if err != nil {
+			return nil, fmt.Errorf("pathMap: %w", err)
+		}
+		mappedName, err := getPathMapName(target)
+		if err != nil {
+			return nil, fmt.Errorf("pathMap: %s: %w", pmc.Name, err)
+		}
+		if mappedName == name {
+			continue
+		}
+		if _, ok := pathMap[name]; ok {
+			return nil, fmt.Errorf("pathMap: %s: duplicate name", pmc.Name)
+		}
+		if otherName, ok := mappedNames[mappedName]; ok {
+			return nil, fmt.Errorf("pathMap: %s: target of both %s and %s", target, otherName, pmc.Name)
+		}
+		pathMap[name] = mappedName
+		mappedNames[mappedName] = pmc.Name
 	}
-	if Version != nil && ts.MinVersion != nil && Version.LessThan(*ts.MinVersion) {
-		return nil, fmt.Errorf("chezmoi version %s too old, source state requires at least %s", Version, ts.MinVersion)
+	return pathMap, nil
+}
+
+// getPathMapName returns the cleaned relative path in name.
+func getPathMapName(name string) (string, error) {
+	cleanName := filepath.Clean(filepath.FromSlash(name))
+	if name == "" || filepath.IsAbs(cleanName) || cleanName == "." || cleanName == ".." || strings.HasPrefix(cleanName, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%q: not a relative path inside the destination directory", name)
 	}
-	return ts, nil
+	return cleanName, nil
 }
 
 func (c *Config) getVCS() (VCS, error) {
@@ -489,22 +2210,42 @@ func (c *Config) output(dir, name string, argv ...string) ([]byte, error) {
 	return c.mutator.IdempotentCmdOutput(cmd)
 }
 
-//nolint:unparam
-func (c *Config) prompt(s, choices string) (byte, error) {
-	r := bufio.NewReader(c.Stdin)
+// prompt prints s and choices to c.Stderr and returns the choice read from
+// c.Stdin. If c.NoPrompt is set, or if c.Stdin is closed, then it returns
+// defaultChoice instead, or an error if defaultChoice is zero.
+func (c *Config) prompt(s, choices string, defaultChoice byte) (byte, error) {
+	if c.NoPrompt {
+		if defaultChoice == 0 {
+			return 0, fmt.Errorf("%s: prompting disabled by --no-prompt and no default choice", s)
+		}
+		return defaultChoice, nil
+	}
+	// Reuse the same reader for every prompt so that input buffered by one
+	// prompt is not lost to the next.
+	if c.stdinReader == nil {
+		c.stdinReader = bufio.NewReader(c.Stdin)
+	}
+	r := c.stdinReader
 	for {
-		_, err := fmt.Printf("%s [%s]? ", s, strings.Join(strings.Split(choices, ""), ","))
-		if err != nil {
+		if _, err := fmt.Fprintf(c.Stderr, "%s [%s]? ", s, strings.Join(strings.Split(choices, ""), ",")); err != nil {
 			return 0, err
 		}
 		line, err := r.ReadString('\n')
-		if err != nil {
+		if err != nil && !errors.Is(err, io.EOF) {
 			return 0, err
 		}
 		line = strings.TrimSpace(line)
 		if len(line) == 1 && strings.IndexByte(choices, line[0]) != -1 {
 			return line[0], nil
 		}
+		if err != nil {
+			// Stdin is closed, so no valid choice will ever be read.
+			if defaultChoice == 0 {
+				return 0, fmt.Errorf("%s: end of input and no default choice", s)
+			}
+			fmt.Fprintf(c.Stderr, "%c\n", defaultChoice)
+			return defaultChoice, nil
+		}
 	}
 }
 
@@ -525,7 +2266,10 @@ func (c *Config) run(dir, name string, argv ...string) error {
 }
 
 func (c *Config) runEditor(argv ...string) error {
-	editorName, editorArgs := c.getEditor()
+	editorName, editorArgs, err := c.getEditor()
+	if err != nil {
+		return err
+	}
 	return c.run("", editorName, append(editorArgs, argv...)...)
 }
 
@@ -533,6 +2277,83 @@ func (c *Config) validateData() error {
 	return validateKeys(config.Data, identifierRegexp)
 }
 
+// warnEncryptedPrivate prints a warning, once, if any encrypted files in ts are
+// only private because encryption.private is not explicitly set.
+func (c *Config) warnEncryptedPrivate(ts *chezmoi.TargetState, persistentState chezmoi.PersistentState) error {
+	if !c.Encryption.Private || viper.IsSet("encryption.private") {
+		return nil
+	}
+	key := []byte("encryptedPrivate")
+	warned, err := persistentState.Get(c.warningBucket, key)
+	if err != nil {
+		return err
+	}
+	if warned != nil {
+		return nil
+	}
+	var targetNames []string
+	for _, entry := range ts.AllEntries() {
+		file, ok := entry.(*chezmoi.File)
+		if !ok || !file.Encrypted || ts.TargetIgnore.Match(file.TargetName()) {
+			continue
+		}
+		fa := chezmoi.ParseFileAttributes(filepath.Base(file.SourceName()))
+		if fa.Mode.Perm()&0o77 != 0 {
+			targetNames = append(targetNames, file.TargetName())
+		}
+	}
+	if len(targetNames) == 0 {
+		return nil
+	}
+	sort.Strings(targetNames)
+	for _, targetName := range targetNames {
+		fmt.Fprintf(c.Stderr, "warning: %s: encrypted, applying with private permissions\n", filepath.Join(ts.DestDir, targetName))
+	}
+	fmt.Fprintf(c.Stderr, ""+
+		"warning: encrypted files are now private by default\n"+
+		"warning: to keep the previous behavior, set encryption.private = false in your config file\n",
+	)
+	return persistentState.Set(c.warningBucket, key, []byte("1"))
+}
+
+// findScript returns the first script found in entries, recursively, for
+// which match returns true, or nil if there is no such script.
+func findScript(entries map[string]chezmoi.Entry, match func(*chezmoi.Script) bool) *chezmoi.Script {
+	for _, entry := range entries {
+		switch entry := entry.(type) {
+		case *chezmoi.Dir:
+			if script := findScript(entry.Entries, match); script != nil {
+				return script
+			}
+		case *chezmoi.Script:
+			if match(entry) {
+				return entry
+			}
+		}
+	}
+	return nil
+}
+
+// entryMap returns entries keyed by target name.
+func entryMap(entries []chezmoi.Entry) map[string]chezmoi.Entry {
+	m := make(map[string]chezmoi.Entry, len(entries))
+	for _, entry := range entries {
+		m[entry.TargetName()] = entry
+	}
+	return m
+}
+
+// walkEntries calls f for each entry in entries, including scripts, and
+// recursively for the entries in each directory.
+func walkEntries(entries map[string]chezmoi.Entry, f func(chezmoi.Entry)) {
+	for _, entry := range entries {
+		f(entry)
+		if dir, ok := entry.(*chezmoi.Dir); ok {
+			walkEntries(dir.Entries, f)
+		}
+	}
+}
+
 func getAsset(name string) ([]byte, error) {
 	asset, ok := assets[name]
 	if !ok {
@@ -541,10 +2362,43 @@ func getAsset(name string) ([]byte, error) {
 	return asset, nil
 }
 
+// readConfig reads the config data of format ext into v. JSON, JSONC, and JSON5
+// config data may contain comments and trailing commas.
+func readConfig(v *viper.Viper, ext string, data []byte) error {
+	ext = strings.ToLower(ext)
+	switch ext {
+	case "json", "jsonc", "json5":
+		v.SetConfigType("json")
+		data = stripJSONComments(data)
+	default:
+		supported := false
+		for _, supportedExt := range viper.SupportedExts {
+			if ext == supportedExt {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return viper.UnsupportedConfigError(ext)
+		}
+		v.SetConfigType(ext)
+	}
+	return v.ReadConfig(bytes.NewReader(data))
+}
+
+// readConfigFile reads the config file configFile into v.
+func readConfigFile(v *viper.Viper, fs vfs.FS, configFile string) error {
+	data, err := fs.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+	return readConfig(v, strings.TrimPrefix(filepath.Ext(configFile), "."), data)
+}
+
 func getDefaultConfigFile(bds *xdg.BaseDirectorySpecification) string {
 	// Search XDG Base Directory Specification config directories first.
 	for _, configDir := range bds.ConfigDirs {
-		for _, extension := range viper.SupportedExts {
+		for _, extension := range configFileExtensions {
 			configFilePath := filepath.Join(configDir, "chezmoi", "chezmoi."+extension)
 			if _, err := os.Stat(configFilePath); err == nil {
 				return configFilePath
@@ -567,6 +2421,11 @@ func getDefaultSourceDir(bds *xdg.BaseDirectorySpecification) string {
 	return filepath.Join(bds.DataHome, "chezmoi")
 }
 
+// isGlob returns whether arg contains any glob metacharacters.
+func isGlob(arg string) bool {
+	return strings.ContainsAny(arg, "*?[{")
+}
+
 // isWellKnownAbbreviation returns true if word is a well known abbreviation.
 func isWellKnownAbbreviation(word string) bool {
 	_, ok := wellKnownAbbreviations[word]
@@ -579,6 +2438,14 @@ func panicOnError(err error) {
 	}
 }
 
+// An exitCodeError is returned by commands that have already reported their
+// result and need to exit with a specific exit code.
+type exitCodeError int
+
+func (e exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
 func printErrorAndExit(err error) {
 	fmt.Printf("chezmoi: %v\n", err)
 	os.Exit(1)
@@ -638,3 +2505,36 @@ func validateKeys(data interface{}, re *regexp.Regexp) error {
 	}
 	return nil
 }
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	switch {
+	case a <= b && a <= c:
+		return a
+	case b <= c:
+		return b
+	default:
+		return c
+	}
+}
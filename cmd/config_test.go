@@ -2,17 +2,23 @@ package cmd
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strings"
 	"testing"
 	"text/template"
+	"time"
 
 	"github.com/Masterminds/sprig"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	vfs "github.com/twpayne/go-vfs"
+	"github.com/twpayne/go-vfs/vfst"
 	xdg "github.com/twpayne/go-xdg/v3"
+	bolt "go.etcd.io/bbolt"
 
 	"github.com/twpayne/chezmoi/internal/chezmoi"
 )
@@ -69,6 +75,215 @@ func TestAutoCommitCommitMessage(t *testing.T) {
 	}
 }
 
+func TestGetDefaultDataChezmoiContext(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	c := newTestConfig(fs)
+	c.configFile = "/home/user/.config/chezmoi/chezmoi.toml"
+	data, err := c.getDefaultData()
+	require.NoError(t, err)
+	assert.Equal(t, "022", data["umask"])
+	expectedConfigFile, err := filepath.Abs(c.configFile)
+	require.NoError(t, err)
+	assert.Equal(t, expectedConfigFile, data["configFile"])
+	assert.Contains(t, data, "version")
+	assert.Equal(t, rootCmd.Version, data["version"])
+
+	c.configFile = ""
+	c.Umask = 0o77
+	data, err = c.getDefaultData()
+	require.NoError(t, err)
+	assert.Equal(t, "077", data["umask"])
+	assert.Equal(t, "", data["configFile"])
+}
+
+func TestGetDefaultDataUserLookupFailed(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	failedUserLookup := userLookup{
+		currentUser: func() (*user.User, error) {
+			return nil, errors.New("user: Current requires cgo or $USER set in environment")
+		},
+		homeDir: func() (string, error) {
+			return "", errors.New("$HOME is not defined")
+		},
+		getenv: func(string) string {
+			return ""
+		},
+		commandOutput: func(string, ...string) ([]byte, error) {
+			return nil, errors.New("exec: not found")
+		},
+	}
+
+	stdout := &bytes.Buffer{}
+	c := newTestConfig(fs, withUserLookup(failedUserLookup), withStdout(stdout))
+	data, err := c.getDefaultData()
+	require.NoError(t, err)
+	assert.NotContains(t, data, "username")
+	assert.NotContains(t, data, "group")
+	assert.NotContains(t, data, "homedir")
+	assert.Contains(t, data, "os")
+
+	require.NoError(t, c.runExecuteTemplateCmd(nil, []string{"{{ .chezmoi.os }}"}))
+	assert.Error(t, c.runExecuteTemplateCmd(nil, []string{"{{ .chezmoi.username }}"}))
+
+	failedUserLookup.getenv = func(key string) string {
+		return map[string]string{
+			"HOME":    "/home/user",
+			"LOGNAME": "user",
+		}[key]
+	}
+	c = newTestConfig(fs, withUserLookup(failedUserLookup))
+	data, err = c.getDefaultData()
+	require.NoError(t, err)
+	assert.Equal(t, "user", data["username"])
+	assert.Equal(t, "/home/user", data["homedir"])
+}
+
+func TestUserLookup(t *testing.T) {
+	errLookup := errors.New("lookup failed")
+	for _, tc := range []struct {
+		name             string
+		currentUser      *user.User
+		homeDir          string
+		env              map[string]string
+		expectedUsername string
+		expectedHomeDir  string
+	}{
+		{
+			name:             "lookup",
+			currentUser:      &user.User{Username: "user", HomeDir: "/home/account"},
+			homeDir:          "/home/user",
+			env:              map[string]string{"USER": "env"},
+			expectedUsername: "user",
+			expectedHomeDir:  "/home/user",
+		},
+		{
+			name:             "env",
+			env:              map[string]string{"HOME": "/home/env", "USER": "env", "LOGNAME": "logname"},
+			expectedUsername: "env",
+			expectedHomeDir:  "/home/env",
+		},
+		{
+			name:             "logname",
+			env:              map[string]string{"LOGNAME": "logname"},
+			expectedUsername: "logname",
+		},
+		{
+			name:             "account",
+			currentUser:      &user.User{Username: "user", HomeDir: "/home/account"},
+			expectedUsername: "user",
+			expectedHomeDir:  "/home/account",
+		},
+		{
+			name: "none",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ul := userLookup{
+				currentUser: func() (*user.User, error) {
+					if tc.currentUser == nil {
+						return nil, errLookup
+					}
+					return tc.currentUser, nil
+				},
+				homeDir: func() (string, error) {
+					if tc.homeDir == "" {
+						return "", errLookup
+					}
+					return tc.homeDir, nil
+				},
+				getenv: func(key string) string {
+					return tc.env[key]
+				},
+			}
+			assert.Equal(t, tc.expectedUsername, ul.getUsername())
+			homeDir, err := ul.getHomeDir()
+			if tc.expectedHomeDir == "" {
+				assert.True(t, errors.Is(err, errLookup))
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedHomeDir, homeDir)
+			}
+		})
+	}
+}
+
+func TestLookupOwner(t *testing.T) {
+	ul := userLookup{
+		lookupUser: func(username string) (*user.User, error) {
+			if username != "www-data" {
+				return nil, user.UnknownUserError(username)
+			}
+			return &user.User{Uid: "33", Gid: "33", Username: "www-data"}, nil
+		},
+		lookupGroup: func(groupname string) (*user.Group, error) {
+			if groupname != "adm" {
+				return nil, user.UnknownGroupError(groupname)
+			}
+			return &user.Group{Gid: "4", Name: "adm"}, nil
+		},
+		lookupGroupID: func(gid string) (*user.Group, error) {
+			if gid != "33" {
+				return nil, user.UnknownGroupIdError(gid)
+			}
+			return &user.Group{Gid: "33", Name: "www-data"}, nil
+		},
+	}
+	for _, tc := range []struct {
+		s             string
+		expectedOwner *chezmoi.Owner
+		expectedErr   string
+	}{
+		{
+			s:             "www-data",
+			expectedOwner: &chezmoi.Owner{UID: 33, GID: 33, Username: "www-data", Groupname: "www-data"},
+		},
+		{
+			s:             "www-data:adm",
+			expectedOwner: &chezmoi.Owner{UID: 33, GID: 4, Username: "www-data", Groupname: "adm"},
+		},
+		{
+			s:             "1234:5678",
+			expectedOwner: &chezmoi.Owner{UID: 1234, GID: 5678},
+		},
+		{
+			s:           "1234",
+			expectedErr: "1234: group required for unknown user",
+		},
+		{
+			s:           "nobody:adm",
+			expectedErr: "nobody: unknown user",
+		},
+		{
+			s:           "www-data:staff",
+			expectedErr: "staff: unknown group",
+		},
+		{
+			s:           "www-data:",
+			expectedErr: `"www-data:": invalid owner`,
+		},
+	} {
+		t.Run(tc.s, func(t *testing.T) {
+			owner, err := ul.lookupOwner(tc.s)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedOwner, owner)
+			}
+		})
+	}
+}
+
 func TestUpperSnakeCaseToCamelCase(t *testing.T) {
 	for s, want := range map[string]string{
 		"BUG_REPORT_URL":   "bugReportURL",
@@ -139,6 +354,9 @@ func newTestConfig(fs vfs.FS, options ...configOption) *Config {
 		[]configOption{
 			withTestFS(fs),
 			withTestUser("user"),
+			// Fake editors return immediately, so don't watch the files
+			// that they edit.
+			withEditWatchTimeout(0),
 		},
 		options...,
 	)...)
@@ -146,7 +364,13 @@ func newTestConfig(fs vfs.FS, options ...configOption) *Config {
 
 func withAddCmdConfig(add addCmdConfig) configOption {
 	return func(c *Config) {
-		c.add = add
+		c.Add = add
+	}
+}
+
+func withEditWatchTimeout(watchTimeout time.Duration) configOption {
+	return func(c *Config) {
+		c.Edit.WatchTimeout = watchTimeout
 	}
 }
 
@@ -162,6 +386,12 @@ func withDestDir(destDir string) configOption {
 	}
 }
 
+func withDryRun(dryRun bool) configOption {
+	return func(c *Config) {
+		c.DryRun = dryRun
+	}
+}
+
 func withDumpCmdConfig(dumpCmdConfig dumpCmdConfig) configOption {
 	return func(c *Config) {
 		c.dump = dumpCmdConfig
@@ -198,6 +428,12 @@ func withRemoveCmdConfig(remove removeCmdConfig) configOption {
 	}
 }
 
+func withStderr(stderr io.Writer) configOption {
+	return func(c *Config) {
+		c.Stderr = stderr
+	}
+}
+
 func withStdin(stdin io.Reader) configOption {
 	return func(c *Config) {
 		c.Stdin = stdin
@@ -210,6 +446,12 @@ func withStdout(stdout io.Writer) configOption {
 	}
 }
 
+func withUserLookup(userLookup userLookup) configOption {
+	return func(c *Config) {
+		c.userLookup = userLookup
+	}
+}
+
 func withTestFS(fs vfs.FS) configOption {
 	return func(c *Config) {
 		c.fs = fs
@@ -230,5 +472,971 @@ func withTestUser(username string) configOption {
 			CacheHome:  filepath.Join(homeDir, ".cache"),
 			RuntimeDir: filepath.Join(homeDir, ".run"),
 		}
+		c.stateHome = filepath.Join(homeDir, ".local", "state")
+	}
+}
+
+func TestGetEditor(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		edit         editCmdConfig
+		env          map[string]string
+		goos         string
+		expectedName string
+		expectedArgs []string
+		expectedErr  string
+	}{
+		{
+			name:         "default",
+			goos:         "linux",
+			expectedName: "vi",
+		},
+		{
+			name:         "default_windows",
+			goos:         "windows",
+			expectedName: "notepad",
+		},
+		{
+			name: "editor",
+			env: map[string]string{
+				"EDITOR": "nano",
+			},
+			goos:         "linux",
+			expectedName: "nano",
+		},
+		{
+			name: "visual_before_editor",
+			env: map[string]string{
+				"EDITOR": "nano",
+				"VISUAL": "code --wait",
+			},
+			goos:         "linux",
+			expectedName: "code",
+			expectedArgs: []string{"--wait"},
+		},
+		{
+			name: "multiple_flags",
+			env: map[string]string{
+				"VISUAL": "  emacsclient  -c   --alternate-editor=''  ",
+			},
+			goos:         "linux",
+			expectedName: "emacsclient",
+			expectedArgs: []string{"-c", "--alternate-editor="},
+		},
+		{
+			name: "quoted_path",
+			env: map[string]string{
+				"EDITOR": `"/Applications/Sublime Text.app/bin/subl" -w`,
+			},
+			goos:         "darwin",
+			expectedName: "/Applications/Sublime Text.app/bin/subl",
+			expectedArgs: []string{"-w"},
+		},
+		{
+			name: "escaped_space",
+			env: map[string]string{
+				"EDITOR": `/opt/my\ editor/bin/edit --title "a \"b\" c"`,
+			},
+			goos:         "linux",
+			expectedName: "/opt/my editor/bin/edit",
+			expectedArgs: []string{"--title", `a "b" c`},
+		},
+		{
+			name: "quoted_path_windows",
+			env: map[string]string{
+				"EDITOR": `"C:\Program Files\Microsoft VS Code\bin\code.cmd" --wait`,
+			},
+			goos:         "windows",
+			expectedName: `C:\Program Files\Microsoft VS Code\bin\code.cmd`,
+			expectedArgs: []string{"--wait"},
+		},
+		{
+			name: "unterminated_quote",
+			env: map[string]string{
+				"VISUAL": `"code --wait`,
+			},
+			goos:        "linux",
+			expectedErr: "$VISUAL: unterminated double quote",
+		},
+		{
+			name: "config_override",
+			edit: editCmdConfig{
+				Command: "/usr/local/bin/my editor",
+				Args:    []string{"--new-window"},
+			},
+			env: map[string]string{
+				"EDITOR": "nano",
+				"VISUAL": "code --wait",
+			},
+			goos:         "linux",
+			expectedName: "/usr/local/bin/my editor",
+			expectedArgs: []string{"--new-window"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			getenv := func(key string) string {
+				return tc.env[key]
+			}
+			name, args, err := getEditor(tc.edit, getenv, tc.goos)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedName, name)
+			if tc.expectedArgs == nil {
+				assert.Empty(t, args)
+			} else {
+				assert.Equal(t, tc.expectedArgs, args)
+			}
+		})
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		stdin          string
+		noPrompt       bool
+		defaultChoice  byte
+		expectedChoice byte
+		expectedErr    string
+		expectedStderr string
+	}{
+		{
+			name:           "choice",
+			stdin:          "y\n",
+			defaultChoice:  'n',
+			expectedChoice: 'y',
+			expectedStderr: "Continue [y,n]? ",
+		},
+		{
+			name:           "invalid_then_choice",
+			stdin:          "yes\n\nn\n",
+			defaultChoice:  'y',
+			expectedChoice: 'n',
+			expectedStderr: "Continue [y,n]? Continue [y,n]? Continue [y,n]? ",
+		},
+		{
+			name:           "choice_without_newline",
+			stdin:          "y",
+			expectedChoice: 'y',
+			expectedStderr: "Continue [y,n]? ",
+		},
+		{
+			name:           "eof_default",
+			stdin:          "yes\n",
+			defaultChoice:  'n',
+			expectedChoice: 'n',
+			expectedStderr: "Continue [y,n]? Continue [y,n]? n\n",
+		},
+		{
+			name:           "eof_no_default",
+			expectedErr:    "Continue: end of input and no default choice",
+			expectedStderr: "Continue [y,n]? ",
+		},
+		{
+			name:           "no_prompt_default",
+			stdin:          "y\n",
+			noPrompt:       true,
+			defaultChoice:  'n',
+			expectedChoice: 'n',
+		},
+		{
+			name:        "no_prompt_no_default",
+			noPrompt:    true,
+			expectedErr: "Continue: prompting disabled by --no-prompt and no default choice",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stderr := &bytes.Buffer{}
+			c := newConfig(withStdin(bytes.NewBufferString(tc.stdin)), withStderr(stderr))
+			c.NoPrompt = tc.noPrompt
+			choice, err := c.prompt("Continue", "yn", tc.defaultChoice)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedChoice, choice)
+			}
+			assert.Equal(t, tc.expectedStderr, stderr.String())
+		})
+	}
+}
+
+func TestGetEntries(t *testing.T) {
+	for _, tc := range []struct {
+		name                string
+		args                []string
+		exclude             []string
+		expectedTargetNames []string
+		expectedErr         string
+	}{
+		{
+			name: "exact",
+			args: []string{"/home/user/.config/zsh/b.zsh", "/home/user/.config/zsh/a.zsh"},
+			expectedTargetNames: []string{
+				".config/zsh/b.zsh",
+				".config/zsh/a.zsh",
+			},
+		},
+		{
+			name: "glob",
+			args: []string{"/home/user/.config/zsh/*.zsh"},
+			expectedTargetNames: []string{
+				".config/zsh/a.zsh",
+				".config/zsh/b.zsh",
+				".config/zsh/c.zsh",
+			},
+		},
+		{
+			name: "double_star",
+			args: []string{"/home/user/.config/**/*.zsh"},
+			expectedTargetNames: []string{
+				".config/zsh/a.zsh",
+				".config/zsh/b.zsh",
+				".config/zsh/c.zsh",
+				".config/zsh/functions/d.zsh",
+			},
+		},
+		{
+			name:    "glob_exclude",
+			args:    []string{"/home/user/.config/zsh/*.zsh"},
+			exclude: []string{"/home/user/.config/zsh/b.zsh"},
+			expectedTargetNames: []string{
+				".config/zsh/a.zsh",
+				".config/zsh/c.zsh",
+			},
+		},
+		{
+			name: "duplicates",
+			args: []string{"/home/user/.config/zsh/b.zsh", "/home/user/.config/zsh/*.zsh"},
+			expectedTargetNames: []string{
+				".config/zsh/b.zsh",
+				".config/zsh/a.zsh",
+				".config/zsh/c.zsh",
+			},
+		},
+		{
+			name:        "no_match",
+			args:        []string{"/home/user/.config/zsh/*.bash"},
+			expectedErr: "/home/user/.config/zsh/*.bash: no matching targets",
+		},
+		{
+			name:        "not_in_source_state",
+			args:        []string{"/home/user/.vimrc"},
+			expectedErr: "/home/user/.vimrc: not in source state",
+		},
+		{
+			name:        "suggestion",
+			args:        []string{"/home/user/.config/zsh/functions/e.zsh"},
+			expectedErr: "/home/user/.config/zsh/functions/e.zsh: not in source state, but is inside managed directory /home/user/.config/zsh/functions, did you mean /home/user/.config/zsh/functions/d.zsh?",
+		},
+		{
+			name:        "suggestion_tie",
+			args:        []string{"/home/user/.config/zsh/e.zsh"},
+			expectedErr: "/home/user/.config/zsh/e.zsh: not in source state, but is inside managed directory /home/user/.config/zsh, did you mean /home/user/.config/zsh/a.zsh?",
+		},
+		{
+			name:        "ignored",
+			args:        []string{"/home/user/.config/ignored/foo"},
+			expectedErr: "/home/user/.config/ignored/foo: ignored by .chezmoiignore on this machine",
+		},
+		{
+			name: "multiple_errors",
+			args: []string{"/home/user/.vimrc", "/home/user/.config/zsh/a.zsh", "/home/user/.config/zsh/*.bash"},
+			expectedErr: "/home/user/.vimrc: not in source state\n" +
+				"/home/user/.config/zsh/*.bash: no matching targets",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+				"/home/user/.local/share/chezmoi/.chezmoiignore": ".config/ignored\n",
+				"/home/user/.local/share/chezmoi/dot_config/zsh": map[string]interface{}{
+					"a.zsh":           "# a",
+					"b.zsh":           "# b",
+					"c.zsh":           "# c",
+					"functions/d.zsh": "# d",
+				},
+			})
+			require.NoError(t, err)
+			defer cleanup()
+			c := newTestConfig(fs)
+			c.exclude = tc.exclude
+			ts, err := c.getTargetState(nil)
+			require.NoError(t, err)
+			entries, err := c.getEntries(ts, tc.args)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			targetNames := make([]string, 0, len(entries))
+			for _, entry := range entries {
+				targetNames = append(targetNames, filepath.ToSlash(entry.TargetName()))
+			}
+			assert.Equal(t, tc.expectedTargetNames, targetNames)
+		})
+	}
+}
+
+func TestGetEntriesRelative(t *testing.T) {
+	for _, tc := range []struct {
+		name                string
+		workingDir          string
+		relativeToDest      bool
+		args                []string
+		expectedTargetNames []string
+		expectedErr         string
+		expectedStderr      string
+	}{
+		{
+			name:                "inside_dest_dir",
+			workingDir:          "/home/user",
+			args:                []string{".zshrc"},
+			expectedTargetNames: []string{".zshrc"},
+		},
+		{
+			name:                "inside_dest_subdir",
+			workingDir:          "/home/user/.config",
+			args:                []string{"zsh/a.zsh"},
+			expectedTargetNames: []string{".config/zsh/a.zsh"},
+		},
+		{
+			name:                "outside_dest_dir",
+			workingDir:          "/tmp",
+			args:                []string{".zshrc"},
+			expectedTargetNames: []string{".zshrc"},
+		},
+		{
+			name:                "outside_dest_dir_glob",
+			workingDir:          "/tmp",
+			args:                []string{".config/zsh/*.zsh"},
+			expectedTargetNames: []string{".config/zsh/a.zsh"},
+		},
+		{
+			name:           "ambiguous",
+			workingDir:     "/tmp",
+			args:           []string{".bashrc"},
+			expectedErr:    "/tmp/.bashrc: outside target directory",
+			expectedStderr: ".bashrc: resolved relative to the working directory, not the destination directory\n",
+		},
+		{
+			name:                "ambiguous_relative_to_dest",
+			workingDir:          "/tmp",
+			relativeToDest:      true,
+			args:                []string{".bashrc"},
+			expectedTargetNames: []string{".bashrc"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+				"/home/user/.local/share/chezmoi": map[string]interface{}{
+					"dot_bashrc":           "# bashrc",
+					"dot_config/zsh/a.zsh": "# a",
+					"dot_zshrc":            "# zshrc",
+				},
+				"/tmp/.bashrc": "# bashrc",
+			})
+			require.NoError(t, err)
+			defer cleanup()
+			stderr := &bytes.Buffer{}
+			c := newTestConfig(fs)
+			c.Stderr = stderr
+			c.relativeToDest = tc.relativeToDest
+			c.workingDir = tc.workingDir
+			ts, err := c.getTargetState(nil)
+			require.NoError(t, err)
+			entries, err := c.getEntries(ts, tc.args)
+			assert.Equal(t, tc.expectedStderr, stderr.String())
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, filepath.FromSlash(tc.expectedErr))
+				return
+			}
+			require.NoError(t, err)
+			targetNames := make([]string, 0, len(entries))
+			for _, entry := range entries {
+				targetNames = append(targetNames, filepath.ToSlash(entry.TargetName()))
+			}
+			assert.Equal(t, tc.expectedTargetNames, targetNames)
+		})
+	}
+}
+
+func TestMergeData(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		dst            map[string]interface{}
+		src            map[string]interface{}
+		expectedData   map[string]interface{}
+		expectedErrStr string
+	}{
+		{
+			name: "nested",
+			dst: map[string]interface{}{
+				"editor": map[string]interface{}{
+					"name":  "vim",
+					"theme": "dark",
+				},
+			},
+			src: map[string]interface{}{
+				"editor": map[interface{}]interface{}{
+					"theme": "light",
+					"plugins": map[interface{}]interface{}{
+						"fzf": true,
+					},
+				},
+			},
+			expectedData: map[string]interface{}{
+				"editor": map[string]interface{}{
+					"name":  "vim",
+					"theme": "light",
+					"plugins": map[string]interface{}{
+						"fzf": true,
+					},
+				},
+			},
+		},
+		{
+			name: "slices_replace",
+			dst: map[string]interface{}{
+				"paths": []interface{}{"a", "b"},
+			},
+			src: map[string]interface{}{
+				"paths": []interface{}{"c"},
+			},
+			expectedData: map[string]interface{}{
+				"paths": []interface{}{"c"},
+			},
+		},
+		{
+			name: "map_with_scalar",
+			dst: map[string]interface{}{
+				"editor": map[string]interface{}{
+					"theme": map[string]interface{}{
+						"name": "dark",
+					},
+				},
+			},
+			src: map[string]interface{}{
+				"editor": map[string]interface{}{
+					"theme": "light",
+				},
+			},
+			expectedErrStr: "editor.theme: cannot merge string into map",
+		},
+		{
+			name: "scalar_with_map",
+			dst: map[string]interface{}{
+				"editor": "vim",
+			},
+			src: map[string]interface{}{
+				"editor": map[string]interface{}{
+					"name": "emacs",
+				},
+			},
+			expectedErrStr: "editor: cannot merge map into string",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := mergeData(tc.dst, tc.src, "")
+			if tc.expectedErrStr != "" {
+				assert.EqualError(t, err, tc.expectedErrStr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedData, tc.dst)
+		})
+	}
+}
+
+func TestGetData(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			".chezmoidata.toml": "[editor]\n  name = \"vim\"\n  theme = \"dark\"\n[shell]\n  name = \"bash\"\n  prompt = \"$\"\n",
+			".chezmoidata.yaml": "editor:\n  theme: light\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	c := newTestConfig(fs)
+	c.Data = map[string]interface{}{
+		"editor": map[string]interface{}{
+			"name": "emacs",
+		},
+		"shell": map[string]interface{}{
+			"name": "zsh",
+		},
+	}
+	c.DataMergeMode = map[string]string{
+		"shell": "replace",
+	}
+	data, err := c.getData()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name":  "emacs",
+		"theme": "light",
+	}, data["editor"])
+	assert.Equal(t, map[string]interface{}{
+		"name": "zsh",
+	}, data["shell"])
+	assert.Contains(t, data, "chezmoi")
+
+	c.DataMergeMode["shell"] = "invalid"
+	_, err = c.getData()
+	assert.EqualError(t, err, "dataMergeMode.shell: invalid merge mode: invalid")
+}
+
+func TestGetSourceRoot(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		root               interface{}
+		expectedSourceRoot string
+		expectedErr        bool
+	}{
+		{
+			name:               "no_chezmoiroot",
+			root:               map[string]interface{}{},
+			expectedSourceRoot: "/home/user/.local/share/chezmoi",
+		},
+		{
+			name: "subdir",
+			root: map[string]interface{}{
+				".chezmoiroot": "home\n",
+			},
+			expectedSourceRoot: "/home/user/.local/share/chezmoi/home",
+		},
+		{
+			name: "nested_subdir",
+			root: map[string]interface{}{
+				".chezmoiroot": "dotfiles/home/../home",
+			},
+			expectedSourceRoot: "/home/user/.local/share/chezmoi/dotfiles/home",
+		},
+		{
+			name: "parent",
+			root: map[string]interface{}{
+				".chezmoiroot": "../other\n",
+			},
+			expectedErr: true,
+		},
+		{
+			name: "absolute",
+			root: map[string]interface{}{
+				".chezmoiroot": "/etc\n",
+			},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+				"/home/user/.local/share/chezmoi": tc.root,
+			})
+			require.NoError(t, err)
+			defer cleanup()
+			c := newTestConfig(fs)
+			sourceRoot, err := c.getSourceRoot(c.SourceDir)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, filepath.FromSlash(tc.expectedSourceRoot), sourceRoot)
+		})
+	}
+}
+
+func TestGetTargetStateSourceRoot(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			".chezmoiroot": "home\n",
+			"README.md":    "# dotfiles\n",
+			"home": map[string]interface{}{
+				".chezmoidata.toml": "email = \"user@example.com\"\n",
+				"dot_bashrc":        "# .bashrc\n",
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	c := newTestConfig(fs)
+	ts, err := c.getTargetState(nil)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("/home/user/.local/share/chezmoi", "home"), ts.SourceDir)
+	assert.Contains(t, ts.Entries, ".bashrc")
+	assert.NotContains(t, ts.Entries, "README.md")
+	assert.Equal(t, "user@example.com", ts.TemplateData["email"])
+}
+
+func TestGetPersistentStateFallback(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.config/chezmoi/chezmoistate.boltdb": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	stderr := &bytes.Buffer{}
+	c := newTestConfig(fs, withStderr(stderr))
+	c.configFile = "/home/user/.config/chezmoi/chezmoi.toml"
+
+	_, err = c.getPersistentState(nil)
+	assert.Error(t, err)
+	assert.Equal(t, "", stderr.String())
+
+	persistentState, err := c.getPersistentState(&bolt.Options{
+		ReadOnly: true,
+	})
+	require.NoError(t, err)
+	assert.True(t, isMemoryPersistentState(persistentState))
+	assert.Contains(t, stderr.String(), "not using the persistent state")
+
+	stderr.Reset()
+	c.NoPersistentState = true
+	persistentState, err = c.getPersistentState(nil)
+	require.NoError(t, err)
+	assert.True(t, isMemoryPersistentState(persistentState))
+	assert.Equal(t, "", stderr.String())
+}
+
+func TestGetPersistentStateMigration(t *testing.T) {
+	legacyPersistentStateFile := "/home/user/.config/chezmoi/chezmoistate.boltdb"
+	persistentStateFile := "/home/user/.local/state/chezmoi/chezmoistate.boltdb"
+	bucket := []byte("bucket")
+	key := []byte("key")
+	value := []byte("value")
+
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.config/chezmoi": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	legacyPersistentState, err := chezmoi.NewBoltPersistentState(fs, legacyPersistentStateFile, vfst.DefaultUmask, nil)
+	require.NoError(t, err)
+	require.NoError(t, legacyPersistentState.Set(bucket, key, value))
+	require.NoError(t, legacyPersistentState.Close())
+
+	newConfig := func(options ...configOption) (*Config, *bytes.Buffer) {
+		stderr := &bytes.Buffer{}
+		c := newTestConfig(fs, append(options, withStderr(stderr))...)
+		c.configFile = "/home/user/.config/chezmoi/chezmoi.toml"
+		return c, stderr
+	}
+
+	// In dry run mode the legacy file is used and not migrated.
+	c, stderr := newConfig(withDryRun(true))
+	persistentState, err := c.getPersistentState(nil)
+	require.NoError(t, err)
+	actualValue, err := persistentState.Get(bucket, key)
+	require.NoError(t, err)
+	assert.Equal(t, value, actualValue)
+	require.NoError(t, persistentState.Close())
+	assert.Equal(t, "", stderr.String())
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath(persistentStateFile,
+			vfst.TestDoesNotExist,
+		),
+	)
+
+	// Otherwise the legacy file is copied, with a notice, and the copy used.
+	c, stderr = newConfig()
+	persistentState, err = c.getPersistentState(nil)
+	require.NoError(t, err)
+	actualValue, err = persistentState.Get(bucket, key)
+	require.NoError(t, err)
+	assert.Equal(t, value, actualValue)
+	require.NoError(t, persistentState.Close())
+	assert.Contains(t, stderr.String(), "notice: moved persistent state from "+legacyPersistentStateFile+" to "+persistentStateFile)
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath(persistentStateFile,
+			vfst.TestModeIsRegular,
+			vfst.TestModePerm(0o600),
+		),
+		vfst.TestPath(legacyPersistentStateFile,
+			vfst.TestModeIsRegular,
+		),
+	)
+
+	// The notice is only printed once.
+	c, stderr = newConfig()
+	assert.Equal(t, persistentStateFile, c.getPersistentStateFile())
+	persistentState, err = c.getPersistentState(nil)
+	require.NoError(t, err)
+	require.NoError(t, persistentState.Close())
+	assert.Equal(t, "", stderr.String())
+
+	// stateFile overrides both.
+	c, _ = newConfig()
+	c.StateFile = "/home/user/state.boltdb"
+	assert.Equal(t, "/home/user/state.boltdb", c.getPersistentStateFile())
+}
+
+func TestGetStateHome(t *testing.T) {
+	assert.Equal(t, filepath.Join("/home/user", ".local", "state"), getStateHome("/home/user", func(string) string { return "" }))
+	assert.Equal(t, "/var/state", getStateHome("/home/user", func(key string) string {
+		if key == "XDG_STATE_HOME" {
+			return "/var/state"
+		}
+		return ""
+	}))
+}
+
+func TestAddTemplateFunc(t *testing.T) {
+	c := newConfig()
+	greet := func() string { return "hello" }
+	c.addTemplateFunc("greet", greet)
+	c.addTemplateFunc("env", greet)
+	assert.Contains(t, c.templateFuncs, "greet")
+	assert.Contains(t, c.templateFuncs, "chezmoi_greet")
+	assert.Contains(t, c.templateFuncs, "chezmoi_env")
+	assert.Equal(t, []string{"env"}, c.shadowedFuncNames)
+	assert.Panics(t, func() {
+		c.addTemplateFunc("greet", greet)
+	})
+}
+
+func TestDisableTemplateFuncs(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		disable     []string
+		template    string
+		expectedErr string
+	}{
+		{
+			name:        "sprig",
+			disable:     []string{"env"},
+			template:    `{{ env "HOME" }}`,
+			expectedErr: "env: disabled by templateFuncs.disable",
+		},
+		{
+			name:        "chezmoi",
+			disable:     []string{"greet"},
+			template:    `{{ greet }}`,
+			expectedErr: "greet: disabled by templateFuncs.disable",
+		},
+		{
+			name:        "chezmoi_alias",
+			disable:     []string{"greet"},
+			template:    `{{ chezmoi_greet }}`,
+			expectedErr: "chezmoi_greet: disabled by templateFuncs.disable",
+		},
+		{
+			name:     "other",
+			disable:  []string{"env"},
+			template: `{{ greet }}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+				"/home/user/.local/share/chezmoi/dot_file.tmpl": tc.template,
+			})
+			require.NoError(t, err)
+			defer cleanup()
+
+			c := newTestConfig(fs)
+			c.addTemplateFunc("greet", func() string { return "hello" })
+			c.TemplateFuncs.Disable = tc.disable
+			require.NoError(t, c.disableTemplateFuncs())
+			ts, err := c.getTargetState(nil)
+			require.NoError(t, err)
+			_, err = ts.Entries[".file"].(*chezmoi.File).Contents()
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+			}
+		})
+	}
+
+	c := newConfig()
+	c.TemplateFuncs.Disable = []string{"unknown"}
+	assert.EqualError(t, c.disableTemplateFuncs(), "templateFuncs.disable: unknown: unknown template function")
+}
+
+func TestGetPathMap(t *testing.T) {
+	pathMapConfigs := []pathMapConfig{
+		{
+			Name: ".config",
+			Targets: map[string]string{
+				"darwin":  "Library/Application Support",
+				"linux":   ".config",
+				"windows": "AppData/Roaming",
+			},
+		},
+		{
+			Name: ".local/share",
+			Targets: map[string]string{
+				"windows": "AppData/Local",
+			},
+		},
+	}
+	for _, tc := range []struct {
+		goos     string
+		expected map[string]string
+	}{
+		{
+			goos: "darwin",
+			expected: map[string]string{
+				".config": filepath.Join("Library", "Application Support"),
+			},
+		},
+		{
+			goos:     "linux",
+			expected: map[string]string{},
+		},
+		{
+			goos: "windows",
+			expected: map[string]string{
+				".config":                        filepath.Join("AppData", "Roaming"),
+				filepath.Join(".local", "share"): filepath.Join("AppData", "Local"),
+			},
+		},
+	} {
+		t.Run(tc.goos, func(t *testing.T) {
+			pathMap, err := getPathMap(pathMapConfigs, tc.goos)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, pathMap)
+		})
+	}
+
+	for _, pmcs := range [][]pathMapConfig{
+		{{Name: "/etc", Targets: map[string]string{"linux": "etc"}}},
+		{{Name: ".config", Targets: map[string]string{"linux": "../config"}}},
+		{
+			{Name: ".config", Targets: map[string]string{"linux": "config"}},
+			{Name: ".local", Targets: map[string]string{"linux": "config"}},
+		},
+	} {
+		_, err := getPathMap(pmcs, "linux")
+		assert.Error(t, err)
+	}
+}
+
+func TestApplyScratchSourceDir(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".local/share/chezmoi/dot_real": "real\n",
+			"src/dotfiles/dot_scratch":      "scratch\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	c := newTestConfig(fs)
+	require.NoError(t, c.runApplyCmd(nil, nil))
+
+	// Applying a scratch source directory does not prune the configured
+	// source directory's targets or replace its record of applied targets.
+	c = newTestConfig(fs)
+	c.SourceDir = "/home/user/src/dotfiles"
+	require.NoError(t, c.useSourceDirFlag("/home/user/.local/share/chezmoi"))
+	c.Apply.prune = true
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.real",
+			vfst.TestContentsString("real\n"),
+		),
+		vfst.TestPath("/home/user/.scratch",
+			vfst.TestContentsString("scratch\n"),
+		),
+	)
+
+	c = newTestConfig(fs)
+	persistentState, err := c.getPersistentState(nil)
+	require.NoError(t, err)
+	defer persistentState.Close()
+	data, err := persistentState.Get(c.appliedTargetBucket, []byte("/home/user"))
+	require.NoError(t, err)
+	assert.Equal(t, `[".real"]`, string(data))
+}
+
+func TestUseSourceDirFlag(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi":      &vfst.Dir{Perm: 0o700},
+		"/home/user/.local/share/chezmoi-work": &vfst.Dir{Perm: 0o700},
+		"/home/user/src/dotfiles":              &vfst.Dir{Perm: 0o755},
+		"/home/user/file":                      "",
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	for _, tc := range []struct {
+		name                      string
+		sourceDir                 string
+		sourceDirs                []string
+		expectedErr               string
+		expectedSourceDir         string
+		expectedSourceDirs        []string
+		expectedScriptStateBucket string
+		expectedAutoCommit        bool
+	}{
+		{
+			name:                      "config",
+			sourceDir:                 "/home/user/.local/share/chezmoi",
+			expectedSourceDir:         "/home/user/.local/share/chezmoi",
+			expectedScriptStateBucket: "script",
+			expectedAutoCommit:        true,
+		},
+		{
+			name:                      "source_dirs",
+			sourceDir:                 "/home/user/.local/share/chezmoi-work",
+			sourceDirs:                []string{"/home/user/.local/share/chezmoi", "/home/user/.local/share/chezmoi-work"},
+			expectedSourceDir:         "/home/user/.local/share/chezmoi-work",
+			expectedSourceDirs:        []string{"/home/user/.local/share/chezmoi", "/home/user/.local/share/chezmoi-work"},
+			expectedScriptStateBucket: "script",
+			expectedAutoCommit:        true,
+		},
+		{
+			name:                      "scratch",
+			sourceDir:                 "/home/user/src/dotfiles",
+			sourceDirs:                []string{"/home/user/.local/share/chezmoi", "/home/user/.local/share/chezmoi-work"},
+			expectedSourceDir:         "/home/user/src/dotfiles",
+			expectedScriptStateBucket: "script:/home/user/src/dotfiles",
+		},
+		{
+			name:                      "relative",
+			sourceDir:                 "dotfiles",
+			expectedSourceDir:         "/home/user/src/dotfiles",
+			expectedScriptStateBucket: "script:/home/user/src/dotfiles",
+		},
+		{
+			name:        "not_exist",
+			sourceDir:   "/home/user/src/missing",
+			expectedErr: "/home/user/src/missing: source directory does not exist",
+		},
+		{
+			name:        "not_a_directory",
+			sourceDir:   "/home/user/file",
+			expectedErr: "/home/user/file: not a directory",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestConfig(fs)
+			c.workingDir = "/home/user/src"
+			c.SourceDir = tc.sourceDir
+			c.SourceDirs = tc.sourceDirs
+			c.SourceVCS.AutoCommit = true
+			err := c.useSourceDirFlag("/home/user/.local/share/chezmoi")
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedSourceDir, c.SourceDir)
+			assert.Equal(t, tc.expectedSourceDirs, c.SourceDirs)
+			assert.Equal(t, tc.expectedScriptStateBucket, string(c.scriptStateBucket))
+			namespace := strings.TrimPrefix(tc.expectedScriptStateBucket, "script")
+			for expectedBucket, bucket := range map[string][]byte{
+				"applyProgress":  c.applyProgressBucket,
+				"appliedSource":  c.appliedSourceBucket,
+				"appliedTargets": c.appliedTargetBucket,
+				"destState":      c.destStateBucket,
+				"lastWritten":    c.lastWrittenBucket,
+			} {
+				assert.Equal(t, expectedBucket+namespace, string(bucket))
+			}
+			assert.Equal(t, tc.expectedAutoCommit, c.SourceVCS.AutoCommit)
+		})
 	}
 }
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -8,7 +9,9 @@ import (
 )
 
 type dataCmdConfig struct {
-	format string
+	format  string
+	origins bool
+	resolve string
 }
 
 var dataCmd = &cobra.Command{
@@ -26,9 +29,15 @@ func init() {
 
 	persistentFlags := dataCmd.PersistentFlags()
 	persistentFlags.StringVarP(&config.data.format, "format", "f", "json", "format (JSON, TOML, or YAML)")
+	persistentFlags.BoolVar(&config.data.origins, "origins", false, "annotate each value with its origin")
+	persistentFlags.StringVar(&config.data.resolve, "resolve", "", "print every origin that defines key")
+	panicOnError(dataCmd.RegisterFlagCompletionFunc("format", completeWords(formats())))
 }
 
 func (c *Config) runDataCmd(cmd *cobra.Command, args []string) error {
+	if c.data.origins && c.data.resolve != "" {
+		return fmt.Errorf("--origins and --resolve cannot be used together")
+	}
 	format, ok := formatMap[strings.ToLower(c.data.format)]
 	if !ok {
 		return fmt.Errorf("%s: unknown format", c.data.format)
@@ -37,5 +46,121 @@ func (c *Config) runDataCmd(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	return format(c.Stdout, data)
+	if !c.data.origins && c.data.resolve == "" {
+		return format(c.Stdout, data)
+	}
+
+	layers, err := c.getDataLayers()
+	if err != nil {
+		return err
+	}
+	if c.data.resolve != "" {
+		return c.printDataResolution(layers, c.data.resolve)
+	}
+	return format(c.Stdout, annotateDataOrigins(data, "", c.getDataOrigins(layers)))
+}
+
+// printDataResolution prints every layer in layers that defines keyPath, in
+// decreasing order of precedence, marking the layer whose value is used with
+// an asterisk.
+func (c *Config) printDataResolution(layers []dataLayer, keyPath string) error {
+	keys := strings.Split(keyPath, ".")
+	winner := -1
+	var defined []int
+	values := make(map[int]interface{})
+	for i, layer := range layers {
+		if value, ok := lookupData(layer.data, keys); ok {
+			winner = i
+			defined = append(defined, i)
+			values[i] = value
+			continue
+		}
+		// A top-level key whose merge mode is replace discards any value
+		// from earlier layers.
+		if _, ok := layer.data[keys[0]]; ok && c.DataMergeMode[keys[0]] == "replace" {
+			winner = -1
+		}
+	}
+	if len(defined) == 0 {
+		return fmt.Errorf("%s: not defined", keyPath)
+	}
+	for j := len(defined) - 1; j >= 0; j-- {
+		i := defined[j]
+		value, err := json.Marshal(copyData(values[i]))
+		if err != nil {
+			return err
+		}
+		marker := " "
+		if i == winner {
+			marker = "*"
+		}
+		fmt.Fprintf(c.Stdout, "%s %s: %s\n", marker, layers[i].origin, value)
+	}
+	return nil
+}
+
+// getDataOrigins returns the origin of each leaf value of the data merged
+// from layers, keyed by key path.
+func (c *Config) getDataOrigins(layers []dataLayer) map[string]string {
+	origins := make(map[string]string)
+	for _, layer := range layers {
+		for key, value := range layer.data {
+			if c.DataMergeMode[key] == "replace" {
+				for keyPath := range origins {
+					if keyPath == key || strings.HasPrefix(keyPath, key+".") {
+						delete(origins, keyPath)
+					}
+				}
+			}
+			addDataOrigins(origins, key, value, layer.origin)
+		}
+	}
+	return origins
+}
+
+// addDataOrigins sets the origin of each leaf value in value, which has
+// keyPath, to origin.
+func addDataOrigins(origins map[string]string, keyPath string, value interface{}, origin string) {
+	m, ok := toStringMap(value)
+	if !ok {
+		origins[keyPath] = origin
+		return
+	}
+	for key, elem := range m {
+		addDataOrigins(origins, keyPath+"."+key, elem, origin)
+	}
+}
+
+// annotateDataOrigins returns a copy of data, which has keyPath, in which
+// each leaf value is replaced by a map of the value and its origin.
+func annotateDataOrigins(data interface{}, keyPath string, origins map[string]string) interface{} {
+	m, ok := toStringMap(data)
+	if !ok {
+		return map[string]interface{}{
+			"origin": origins[keyPath],
+			"value":  data,
+		}
+	}
+	result := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		elemKeyPath := key
+		if keyPath != "" {
+			elemKeyPath = keyPath + "." + key
+		}
+		result[key] = annotateDataOrigins(value, elemKeyPath, origins)
+	}
+	return result
+}
+
+// lookupData returns the value in data with keys, and whether it exists.
+func lookupData(data map[string]interface{}, keys []string) (interface{}, bool) {
+	value, ok := data[keys[0]]
+	if !ok || len(keys) == 1 {
+		return value, ok
+	}
+	m, ok := toStringMap(value)
+	if !ok {
+		return nil, false
+	}
+	return lookupData(m, keys[1:])
 }
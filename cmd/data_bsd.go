@@ -0,0 +1,43 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/twpayne/go-vfs"
+	"golang.org/x/sys/unix"
+)
+
+// sysctl returns the value of the named sysctl. It is a variable so that tests
+// can replace it.
+var sysctl = unix.Sysctl
+
+// kernelInfoSysctls maps sysctl names to kernel info keys. Keys that are also
+// present on Linux have the same names.
+var kernelInfoSysctls = map[string]string{
+	"hw.machine":     "machine",
+	"kern.osrelease": "osrelease",
+	"kern.ostype":    "ostype",
+	"kern.version":   "version",
+}
+
+func getKernelInfo(fs vfs.FS) (map[string]string, error) {
+	var kernelInfo map[string]string
+	for name, key := range kernelInfoSysctls {
+		value, err := sysctl(name)
+		if err != nil {
+			continue
+		}
+		if kernelInfo == nil {
+			kernelInfo = make(map[string]string)
+		}
+		kernelInfo[key] = strings.TrimSpace(value)
+	}
+	return kernelInfo, nil
+}
+
+func getOSRelease(fs vfs.FS) (map[string]string, error) {
+	return nil, nil
+}
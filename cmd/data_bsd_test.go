@@ -0,0 +1,69 @@
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package cmd
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	vfs "github.com/twpayne/go-vfs"
+)
+
+func TestGetKernelInfo(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		sysctls            map[string]string
+		expectedKernelInfo map[string]string
+	}{
+		{
+			name: "darwin",
+			sysctls: map[string]string{
+				"hw.machine":     "x86_64",
+				"kern.osrelease": "19.6.0",
+				"kern.ostype":    "Darwin",
+				"kern.version":   "Darwin Kernel Version 19.6.0: Mon Aug 31 22:12:52 PDT 2020; root:xnu-6153.141.2~1/RELEASE_X86_64",
+			},
+			expectedKernelInfo: map[string]string{
+				"machine":   "x86_64",
+				"osrelease": "19.6.0",
+				"ostype":    "Darwin",
+				"version":   "Darwin Kernel Version 19.6.0: Mon Aug 31 22:12:52 PDT 2020; root:xnu-6153.141.2~1/RELEASE_X86_64",
+			},
+		},
+		{
+			name: "freebsd_version_with_trailing_newline",
+			sysctls: map[string]string{
+				"kern.ostype":  "FreeBSD",
+				"kern.version": "FreeBSD 12.1-RELEASE r354233 GENERIC\n",
+			},
+			expectedKernelInfo: map[string]string{
+				"ostype":  "FreeBSD",
+				"version": "FreeBSD 12.1-RELEASE r354233 GENERIC",
+			},
+		},
+		{
+			name:               "sysctl_fails",
+			sysctls:            nil,
+			expectedKernelInfo: nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			oldSysctl := sysctl
+			defer func() {
+				sysctl = oldSysctl
+			}()
+			sysctl = func(name string) (string, error) {
+				value, ok := tc.sysctls[name]
+				if !ok {
+					return "", syscall.ENOENT
+				}
+				return value, nil
+			}
+			kernelInfo, err := getKernelInfo(vfs.OSFS)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedKernelInfo, kernelInfo)
+		})
+	}
+}
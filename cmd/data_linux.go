@@ -6,8 +6,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"unicode"
 
@@ -47,10 +47,26 @@ func getKernelInfo(fs vfs.FS) (map[string]string, error) {
 	return kernelInfo, nil
 }
 
+// lsbRelease returns the output of lsb_release -a. It is a variable so that
+// tests can replace it.
+var lsbRelease = func() ([]byte, error) {
+	return exec.Command("lsb_release", "-a").Output()
+}
+
+// lsbReleaseKeys maps lsb_release field names to the equivalent os-release
+// keys.
+var lsbReleaseKeys = map[string]string{
+	"Codename":       "VERSION_CODENAME",
+	"Description":    "PRETTY_NAME",
+	"Distributor ID": "ID",
+	"Release":        "VERSION_ID",
+}
+
 // getOSRelease returns the operating system identification data as defined by
-// https://www.freedesktop.org/software/systemd/man/os-release.html.
+// https://www.freedesktop.org/software/systemd/man/os-release.html. If no
+// os-release file exists then the output of lsb_release is used instead.
 func getOSRelease(fs vfs.FS) (map[string]string, error) {
-	for _, filename := range []string{"/usr/lib/os-release", "/etc/os-release"} {
+	for _, filename := range []string{"/etc/os-release", "/usr/lib/os-release"} {
 		f, err := fs.Open(filename)
 		if os.IsNotExist(err) {
 			continue
@@ -64,17 +80,39 @@ func getOSRelease(fs vfs.FS) (map[string]string, error) {
 		}
 		return m, nil
 	}
+	if output, err := lsbRelease(); err == nil {
+		if m := parseLSBRelease(bytes.NewReader(output)); len(m) != 0 {
+			return m, nil
+		}
+	}
 	return nil, os.ErrNotExist
 }
 
-// maybeUnquote removes quotation marks around s.
-func maybeUnquote(s string) string {
-	// Try to unquote.
-	if s, err := strconv.Unquote(s); err == nil {
-		return s
+// parseLSBRelease parses the output of lsb_release -a from r into the
+// equivalent os-release keys. Unknown fields are ignored.
+func parseLSBRelease(r io.Reader) map[string]string {
+	result := make(map[string]string)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.SplitN(s.Text(), ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		key, ok := lsbReleaseKeys[strings.TrimSpace(fields[0])]
+		if !ok {
+			continue
+		}
+		value := strings.TrimSpace(fields[1])
+		if value == "" || value == "n/a" {
+			continue
+		}
+		if key == "ID" {
+			// os-release IDs are lowercase.
+			value = strings.ToLower(value)
+		}
+		result[key] = value
 	}
-	// Otherwise return s, unchanged.
-	return s
+	return result
 }
 
 // parseOSRelease parses operating system identification data from r as defined
@@ -94,8 +132,34 @@ func parseOSRelease(r io.Reader) (map[string]string, error) {
 			return nil, fmt.Errorf("cannot parse %q", token)
 		}
 		key := fields[0]
-		value := maybeUnquote(fields[1])
+		value := unquoteOSReleaseValue(strings.TrimRightFunc(fields[1], unicode.IsSpace))
 		result[key] = value
 	}
 	return result, s.Err()
 }
+
+// unquoteOSReleaseValue removes the shell-style quoting from s. Values in single
+// quotes are used literally. Elsewhere, a backslash escapes the following
+// character.
+func unquoteOSReleaseValue(s string) string {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return s[1 : len(s)-1]
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	if !strings.ContainsRune(s, '\\') {
+		return s
+	}
+	sb := strings.Builder{}
+	escaped := false
+	for _, r := range s {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"bytes"
+	"os"
+	"os/exec"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -62,9 +64,11 @@ func TestGetKernelInfo(t *testing.T) {
 
 func TestGetOSRelease(t *testing.T) {
 	for _, tc := range []struct {
-		name string
-		root map[string]interface{}
-		want map[string]string
+		name       string
+		root       map[string]interface{}
+		lsbRelease string
+		want       map[string]string
+		wantErr    error
 	}{
 		{
 			name: "fedora",
@@ -122,13 +126,57 @@ UBUNTU_CODENAME=bionic`,
 				"UBUNTU_CODENAME":    "bionic",
 			},
 		},
+		{
+			name: "etc_preferred",
+			root: map[string]interface{}{
+				"/etc/os-release":     "ID=etc\n",
+				"/usr/lib/os-release": "ID=usr\n",
+			},
+			want: map[string]string{
+				"ID": "etc",
+			},
+		},
+		{
+			name: "lsb_release",
+			root: map[string]interface{}{
+				"/etc": &vfst.Dir{Perm: 0o755},
+			},
+			lsbRelease: "" +
+				"Distributor ID:\tUbuntu\n" +
+				"Description:\tUbuntu 20.04.1 LTS\n" +
+				"Release:\t20.04\n" +
+				"Codename:\tfocal\n",
+			want: map[string]string{
+				"ID":               "ubuntu",
+				"PRETTY_NAME":      "Ubuntu 20.04.1 LTS",
+				"VERSION_ID":       "20.04",
+				"VERSION_CODENAME": "focal",
+			},
+		},
+		{
+			name: "missing",
+			root: map[string]interface{}{
+				"/etc": &vfst.Dir{Perm: 0o755},
+			},
+			wantErr: os.ErrNotExist,
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			fs, cleanup, err := vfst.NewTestFS(tc.root)
 			require.NoError(t, err)
 			defer cleanup()
+			oldLSBRelease := lsbRelease
+			defer func() {
+				lsbRelease = oldLSBRelease
+			}()
+			lsbRelease = func() ([]byte, error) {
+				if tc.lsbRelease == "" {
+					return nil, &exec.Error{Name: "lsb_release", Err: exec.ErrNotFound}
+				}
+				return []byte(tc.lsbRelease), nil
+			}
 			got, gotErr := getOSRelease(fs)
-			assert.NoError(t, gotErr)
+			assert.Equal(t, tc.wantErr, gotErr)
 			assert.Equal(t, tc.want, got)
 		})
 	}
@@ -192,9 +240,153 @@ UBUNTU_CODENAME=bionic`,
 				"UBUNTU_CODENAME":    "bionic",
 			},
 		},
+		{
+			s: `PRETTY_NAME="Debian GNU/Linux 10 (buster)"
+NAME="Debian GNU/Linux"
+VERSION_ID="10"
+VERSION="10 (buster)"
+VERSION_CODENAME=buster
+ID=debian
+HOME_URL="https://www.debian.org/"
+SUPPORT_URL="https://www.debian.org/support"
+BUG_REPORT_URL="https://bugs.debian.org/"`,
+			want: map[string]string{
+				"PRETTY_NAME":      "Debian GNU/Linux 10 (buster)",
+				"NAME":             "Debian GNU/Linux",
+				"VERSION_ID":       "10",
+				"VERSION":          "10 (buster)",
+				"VERSION_CODENAME": "buster",
+				"ID":               "debian",
+				"HOME_URL":         "https://www.debian.org/",
+				"SUPPORT_URL":      "https://www.debian.org/support",
+				"BUG_REPORT_URL":   "https://bugs.debian.org/",
+			},
+		},
+		{
+			s: `NAME="Alpine Linux"
+ID=alpine
+VERSION_ID=3.12.1
+PRETTY_NAME="Alpine Linux v3.12"
+HOME_URL="https://alpinelinux.org/"
+BUG_REPORT_URL="https://bugs.alpinelinux.org/"`,
+			want: map[string]string{
+				"NAME":           "Alpine Linux",
+				"ID":             "alpine",
+				"VERSION_ID":     "3.12.1",
+				"PRETTY_NAME":    "Alpine Linux v3.12",
+				"HOME_URL":       "https://alpinelinux.org/",
+				"BUG_REPORT_URL": "https://bugs.alpinelinux.org/",
+			},
+		},
+		{
+			s: `NAME=NixOS
+ID=nixos
+VERSION="20.09.2386.ae1b121d9a6 (Nightingale)"
+VERSION_CODENAME=nightingale
+VERSION_ID="20.09.2386.ae1b121d9a6"
+PRETTY_NAME="NixOS 20.09 (Nightingale)"
+LOGO="nix-snowflake"
+HOME_URL="https://nixos.org/"
+DOCUMENTATION_URL="https://nixos.org/learn.html"
+SUPPORT_URL="https://nixos.org/community.html"
+BUG_REPORT_URL="https://github.com/NixOS/nixpkgs/issues"`,
+			want: map[string]string{
+				"NAME":              "NixOS",
+				"ID":                "nixos",
+				"VERSION":           "20.09.2386.ae1b121d9a6 (Nightingale)",
+				"VERSION_CODENAME":  "nightingale",
+				"VERSION_ID":        "20.09.2386.ae1b121d9a6",
+				"PRETTY_NAME":       "NixOS 20.09 (Nightingale)",
+				"LOGO":              "nix-snowflake",
+				"HOME_URL":          "https://nixos.org/",
+				"DOCUMENTATION_URL": "https://nixos.org/learn.html",
+				"SUPPORT_URL":       "https://nixos.org/community.html",
+				"BUG_REPORT_URL":    "https://github.com/NixOS/nixpkgs/issues",
+			},
+		},
+		{
+			s: `NAME="Amazon Linux"
+VERSION="2"
+ID="amzn"
+ID_LIKE="centos rhel fedora"
+VERSION_ID="2"
+PRETTY_NAME="Amazon Linux 2"
+ANSI_COLOR="0;33"
+CPE_NAME="cpe:2.3:o:amazon:amazon_linux:2"
+HOME_URL="https://amazonlinux.com/"`,
+			want: map[string]string{
+				"NAME":        "Amazon Linux",
+				"VERSION":     "2",
+				"ID":          "amzn",
+				"ID_LIKE":     "centos rhel fedora",
+				"VERSION_ID":  "2",
+				"PRETTY_NAME": "Amazon Linux 2",
+				"ANSI_COLOR":  "0;33",
+				"CPE_NAME":    "cpe:2.3:o:amazon:amazon_linux:2",
+				"HOME_URL":    "https://amazonlinux.com/",
+			},
+		},
+		{
+			s: `SINGLE='a \literal "value"'
+DOUBLE="A \"quoted\" \$value with a \\ backslash"
+UNQUOTED=a\ b
+EQUALS="key=value"
+EMPTY=
+TRAILING="value"  `,
+			want: map[string]string{
+				"SINGLE":   `a \literal "value"`,
+				"DOUBLE":   `A "quoted" $value with a \ backslash`,
+				"UNQUOTED": "a b",
+				"EQUALS":   "key=value",
+				"EMPTY":    "",
+				"TRAILING": "value",
+			},
+		},
 	} {
 		got, gotErr := parseOSRelease(bytes.NewBufferString(tc.s))
 		assert.NoError(t, gotErr)
 		assert.Equal(t, tc.want, got)
 	}
 }
+
+func TestParseLSBRelease(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		s    string
+		want map[string]string
+	}{
+		{
+			name: "debian",
+			s: "" +
+				"No LSB modules are available.\n" +
+				"Distributor ID:\tDebian\n" +
+				"Description:\tDebian GNU/Linux 10 (buster)\n" +
+				"Release:\t10\n" +
+				"Codename:\tbuster\n",
+			want: map[string]string{
+				"ID":               "debian",
+				"PRETTY_NAME":      "Debian GNU/Linux 10 (buster)",
+				"VERSION_ID":       "10",
+				"VERSION_CODENAME": "buster",
+			},
+		},
+		{
+			name: "no_codename",
+			s: "" +
+				"LSB Version:\t:core-4.1-amd64:core-4.1-noarch\n" +
+				"Distributor ID:\tCentOS\n" +
+				"Description:\tCentOS Linux release 7.9.2009 (Core)\n" +
+				"Release:\t7.9.2009\n" +
+				"Codename:\tn/a\n",
+			want: map[string]string{
+				"ID":          "centos",
+				"PRETTY_NAME": "CentOS Linux release 7.9.2009 (Core)",
+				"VERSION_ID":  "7.9.2009",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, parseLSBRelease(bytes.NewBufferString(tc.s)))
+		})
+	}
+}
@@ -1,4 +1,4 @@
-// +build !linux
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
 
 package cmd
 
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+func newDataTestConfig(t *testing.T, stdout *strings.Builder) (*Config, func()) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			".chezmoidata.toml": "[editor]\n  name = \"vim\"\n  theme = \"dark\"\n[shell]\n  name = \"bash\"\n  prompt = \"$\"\n",
+			".chezmoidata.yaml": "editor:\n  theme: light\n  font:\n    size: 12\n",
+		},
+	})
+	require.NoError(t, err)
+
+	c := newTestConfig(fs, withStdout(stdout))
+	c.configFile = "/home/user/.config/chezmoi/chezmoi.toml"
+	c.data.format = "json"
+	c.Data = map[string]interface{}{
+		"editor": map[string]interface{}{
+			"name": "emacs",
+			"font": map[string]interface{}{
+				"size": 14,
+			},
+		},
+		"shell": map[string]interface{}{
+			"name": "zsh",
+		},
+	}
+	c.DataMergeMode = map[string]string{
+		"shell": "replace",
+	}
+	return c, cleanup
+}
+
+func TestDataResolve(t *testing.T) {
+	sourceDir := filepath.Join("/home/user/.local/share/chezmoi")
+	for _, tc := range []struct {
+		keyPath     string
+		expectedErr string
+		expected    []string
+	}{
+		{
+			keyPath: "editor.name",
+			expected: []string{
+				"* /home/user/.config/chezmoi/chezmoi.toml: \"emacs\"",
+				"  " + filepath.Join(sourceDir, ".chezmoidata.toml") + ": \"vim\"",
+			},
+		},
+		{
+			keyPath: "editor.theme",
+			expected: []string{
+				"* " + filepath.Join(sourceDir, ".chezmoidata.yaml") + ": \"light\"",
+				"  " + filepath.Join(sourceDir, ".chezmoidata.toml") + ": \"dark\"",
+			},
+		},
+		{
+			keyPath: "editor.font.size",
+			expected: []string{
+				"* /home/user/.config/chezmoi/chezmoi.toml: 14",
+				"  " + filepath.Join(sourceDir, ".chezmoidata.yaml") + ": 12",
+			},
+		},
+		{
+			keyPath: "shell.prompt",
+			expected: []string{
+				"  " + filepath.Join(sourceDir, ".chezmoidata.toml") + ": \"$\"",
+			},
+		},
+		{
+			keyPath:     "editor.missing",
+			expectedErr: "editor.missing: not defined",
+		},
+	} {
+		t.Run(tc.keyPath, func(t *testing.T) {
+			stdout := &strings.Builder{}
+			c, cleanup := newDataTestConfig(t, stdout)
+			defer cleanup()
+			c.data.resolve = tc.keyPath
+
+			err := c.runDataCmd(nil, nil)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, strings.Join(tc.expected, "\n")+"\n", stdout.String())
+		})
+	}
+}
+
+func TestDataOrigins(t *testing.T) {
+	stdout := &strings.Builder{}
+	c, cleanup := newDataTestConfig(t, stdout)
+	defer cleanup()
+	c.data.origins = true
+
+	require.NoError(t, c.runDataCmd(nil, nil))
+	var data map[string]interface{}
+	require.NoError(t, json.NewDecoder(bytes.NewBufferString(stdout.String())).Decode(&data))
+
+	sourceDir := filepath.Join("/home/user/.local/share/chezmoi")
+	configFile := "/home/user/.config/chezmoi/chezmoi.toml"
+	leaf := func(origin string, value interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"origin": origin,
+			"value":  value,
+		}
+	}
+	assert.Equal(t, map[string]interface{}{
+		"name":  leaf(configFile, "emacs"),
+		"theme": leaf(filepath.Join(sourceDir, ".chezmoidata.yaml"), "light"),
+		"font": map[string]interface{}{
+			"size": leaf(configFile, float64(14)),
+		},
+	}, data["editor"])
+	assert.Equal(t, map[string]interface{}{
+		"name": leaf(configFile, "zsh"),
+	}, data["shell"])
+	chezmoiData, ok := data["chezmoi"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "default", chezmoiData["sourceDir"].(map[string]interface{})["origin"])
+}
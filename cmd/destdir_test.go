@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+// TestDestDir runs the commands that resolve targets against a destination
+// directory that is not the home directory.
+func TestDestDir(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": &vfst.Dir{Perm: 0o700},
+		"/home/user/.bashrc":              "# home .bashrc\n",
+		"/mnt/otherhome": map[string]interface{}{
+			".bashrc":            "# other .bashrc\n",
+			".config/app/config": "# config\n",
+			".unmanaged":         "",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	newDestDirTestConfig := func(options ...configOption) *Config {
+		return newTestConfig(fs, append([]configOption{withDestDir("/mnt/otherhome")}, options...)...)
+	}
+
+	// Relative arguments that do not exist relative to the working directory
+	// are resolved relative to the destination directory.
+	c := newDestDirTestConfig(withAddCmdConfig(addCmdConfig{
+		options: chezmoi.AddOptions{
+			Recursive: true,
+		},
+	}))
+	require.NoError(t, c.runAddCmd(nil, []string{".bashrc", "/mnt/otherhome/.config"}))
+	vfst.RunTests(t, fs, "add",
+		vfst.TestPath("/home/user/.local/share/chezmoi/dot_bashrc",
+			vfst.TestContentsString("# other .bashrc\n"),
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/dot_config/app/config",
+			vfst.TestContentsString("# config\n"),
+		),
+	)
+
+	stdout := &bytes.Buffer{}
+	c = newDestDirTestConfig(withStdout(stdout), withManaged(managedCmdConfig{
+		include: managedIncludeTypes,
+	}))
+	require.NoError(t, c.runManagedCmd(nil, nil))
+	targetNames, err := extractPOSIXTargetNames(stdout.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"/mnt/otherhome/.bashrc",
+		"/mnt/otherhome/.config",
+		"/mnt/otherhome/.config/app",
+		"/mnt/otherhome/.config/app/config",
+	}, targetNames)
+
+	stdout.Reset()
+	c = newDestDirTestConfig(withStdout(stdout))
+	require.NoError(t, c.runUnmanagedCmd(nil, nil))
+	targetNames, err = extractPOSIXTargetNames(stdout.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"/mnt/otherhome/.unmanaged",
+	}, targetNames)
+
+	c = newDestDirTestConfig()
+	data, err := c.getDefaultData()
+	require.NoError(t, err)
+	assert.Equal(t, "/mnt/otherhome", posixify(data["destDir"].(string)))
+	assert.NotEqual(t, data["destDir"], data["homedir"])
+
+	b := &bytes.Buffer{}
+	w := tar.NewWriter(b)
+	require.NoError(t, w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     "imported",
+		Size:     int64(len("# imported\n")),
+		Mode:     0o644,
+	}))
+	_, err = w.Write([]byte("# imported\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	c = newDestDirTestConfig(withStdin(bytes.NewReader(b.Bytes())))
+	require.NoError(t, c.runImportCmd(nil, nil))
+	vfst.RunTests(t, fs, "import",
+		vfst.TestPath("/home/user/.local/share/chezmoi/imported",
+			vfst.TestContentsString("# imported\n"),
+		),
+	)
+
+	// Imports outside the destination directory are rejected.
+	c = newDestDirTestConfig(withStdin(bytes.NewReader(b.Bytes())))
+	c._import.importTAROptions.DestinationDir = "/home/user"
+	assert.Error(t, c.runImportCmd(nil, nil))
+
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/dot_config/app/config", []byte("# new config\n"), 0o644))
+	c = newDestDirTestConfig()
+	require.NoError(t, c.runApplyCmd(nil, []string{".config/app/config"}))
+	vfst.RunTests(t, fs, "apply",
+		vfst.TestPath("/mnt/otherhome/.config/app/config",
+			vfst.TestContentsString("# new config\n"),
+		),
+		vfst.TestPath("/mnt/otherhome/imported",
+			vfst.TestDoesNotExist,
+		),
+	)
+
+	c = newDestDirTestConfig()
+	c.remove.force = true
+	require.NoError(t, c.runRemoveCmd(nil, []string{".bashrc"}))
+	vfst.RunTests(t, fs, "remove",
+		vfst.TestPath("/mnt/otherhome/.bashrc",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/dot_bashrc",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.bashrc",
+			vfst.TestContentsString("# home .bashrc\n"),
+		),
+	)
+}
@@ -1,10 +1,16 @@
 package cmd
 
 import (
+	"archive/tar"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"unicode"
 
@@ -18,9 +24,44 @@ import (
 )
 
 type diffCmdConfig struct {
-	Format  string
-	NoPager bool
-	Pager   string
+	Format   string
+	NoPager  bool
+	Pager    string
+	revision string
+	stat     bool
+}
+
+// A diffFormat is a value accepted by diff --format.
+type diffFormat struct {
+	// newBaseMutator returns the mutator that the diff mutator wraps.
+	newBaseMutator func(fs vfs.FS) chezmoi.Mutator
+	// newMutator returns a mutator that writes the changes made to the
+	// target state in ts to w.
+	newMutator func(c *Config, w io.Writer, m chezmoi.Mutator, ts *chezmoi.TargetState) chezmoi.Mutator
+}
+
+// diffFormats are the values accepted by diff --format.
+var diffFormats = map[string]diffFormat{
+	"chezmoi": {
+		newBaseMutator: func(vfs.FS) chezmoi.Mutator {
+			return chezmoi.NullMutator{}
+		},
+		newMutator: func(c *Config, w io.Writer, m chezmoi.Mutator, ts *chezmoi.TargetState) chezmoi.Mutator {
+			return chezmoi.NewVerboseMutator(w, m, c.colored, c.maxDiffDataSize)
+		},
+	},
+	"git": {
+		newBaseMutator: func(fs vfs.FS) chezmoi.Mutator {
+			return chezmoi.NewFSMutator(vfs.NewReadOnlyFS(fs))
+		},
+		newMutator: func(c *Config, w io.Writer, m chezmoi.Mutator, ts *chezmoi.TargetState) chezmoi.Mutator {
+			unifiedEncoder := diff.NewUnifiedEncoder(w, diff.DefaultContextLines)
+			if c.colored {
+				unifiedEncoder.SetColor(diff.NewColorConfig())
+			}
+			return chezmoi.NewGitDiffMutator(unifiedEncoder, m, ts.DestDir+string(filepath.Separator))
+		},
+	},
 }
 
 var diffCmd = &cobra.Command{
@@ -36,20 +77,29 @@ func init() {
 	rootCmd.AddCommand(diffCmd)
 
 	persistentFlags := diffCmd.PersistentFlags()
-	persistentFlags.StringVarP(&config.Diff.Format, "format", "f", config.Diff.Format, "format, \"chezmoi\" or \"git\"")
+	persistentFlags.StringVarP(&config.Diff.Format, "format", "f", config.Diff.Format, "format ("+strings.Join(diffFormatNames(), ", ")+")")
 	persistentFlags.BoolVar(&config.Diff.NoPager, "no-pager", false, "disable pager")
-
-	markRemainingZshCompPositionalArgumentsAsFiles(diffCmd, 1)
+	persistentFlags.StringVarP(&config.Diff.revision, "revision", "r", "", "diff against revision of the source directory")
+	persistentFlags.BoolVar(&config.Diff.stat, "stat", false, "print a summary of changed lines per target")
+	persistentFlags.BoolVar(&config.symlink, "symlink", false, "apply plain files as symlinks to their source files")
+	persistentFlags.StringArrayVar(&config.exclude, "exclude", nil, "exclude entry types or targets matching pattern")
+	persistentFlags.BoolVar(&config.excludeEncrypted, "exclude-encrypted", false, "exclude encrypted targets")
+	persistentFlags.StringSliceVarP(&config.include, "include", "i", []string{"all"}, "include entry types")
+	addRemoteFlags(diffCmd)
+	addTrustFlag(diffCmd)
+	panicOnError(diffCmd.RegisterFlagCompletionFunc("format", completeWords(diffFormatNames())))
+	panicOnError(diffCmd.RegisterFlagCompletionFunc("include", completeCommaSeparatedWords(entryTypeWords)))
 }
 
 func (c *Config) runDiffCmd(cmd *cobra.Command, args []string) error {
 	c.DryRun = true // Prevent scripts from running.
 
-	switch c.Diff.Format {
-	case "chezmoi":
+	format, ok := diffFormats[c.Diff.Format]
+	switch {
+	case c.Diff.stat:
 		c.mutator = chezmoi.NullMutator{}
-	case "git":
-		c.mutator = chezmoi.NewFSMutator(vfs.NewReadOnlyFS(config.fs))
+	case ok:
+		c.mutator = format.newBaseMutator(c.fs)
 	default:
 		return fmt.Errorf("unknown diff format: %q", c.Diff.Format)
 	}
@@ -57,26 +107,62 @@ func (c *Config) runDiffCmd(cmd *cobra.Command, args []string) error {
 		c.mutator = chezmoi.NewDebugMutator(c.mutator)
 	}
 
-	persistentState, err := c.getPersistentState(&bolt.Options{
-		ReadOnly: true,
-	})
-	if err != nil {
-		return err
+	var persistentState chezmoi.PersistentState
+	if c.remote.url != "" {
+		if c.Diff.revision != "" {
+			return errors.New("--remote and --revision cannot be used together")
+		}
+		remoteSourceDir, err := c.makeTempClone(c.remote.url, "chezmoi-remote")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = c.fs.RemoveAll(remoteSourceDir)
+		}()
+		c.useRemoteSourceDir(remoteSourceDir)
+		// Trust in a remote repo is never stored, so it is only trusted with
+		// --trust.
+		if !c.trust.trust {
+			c.restrictSourceState(c.remote.url)
+		}
+		persistentState = chezmoi.NewMemoryPersistentState()
+	} else {
+		var err error
+		persistentState, err = c.getPersistentState(&bolt.Options{
+			ReadOnly: true,
+		})
+		if err != nil {
+			return err
+		}
 	}
 	defer persistentState.Close()
 
-	if c.Diff.NoPager || c.Diff.Pager == "" {
-		switch c.Diff.Format {
-		case "chezmoi":
-			c.mutator = chezmoi.NewVerboseMutator(c.Stdout, c.mutator, c.colored, c.maxDiffDataSize)
-		case "git":
-			unifiedEncoder := diff.NewUnifiedEncoder(c.Stdout, diff.DefaultContextLines)
-			if c.colored {
-				unifiedEncoder.SetColor(diff.NewColorConfig())
-			}
-			c.mutator = chezmoi.NewGitDiffMutator(unifiedEncoder, c.mutator, c.DestDir+string(filepath.Separator))
+	var ts *chezmoi.TargetState
+	var err error
+	if c.Diff.revision == "" {
+		ts, err = c.getTargetState(c.getApplyPopulateOptions(args))
+	} else {
+		var revisionSourceDir string
+		revisionSourceDir, err = c.makeRevisionSourceDir(c.Diff.revision)
+		if err != nil {
+			return err
 		}
-		return c.applyArgs(args, persistentState)
+		defer func() {
+			_ = c.fs.RemoveAll(revisionSourceDir)
+		}()
+		ts, err = c.getTargetStateFromSourceDir(revisionSourceDir, c.getApplyPopulateOptions(args))
+	}
+	if err != nil {
+		return suggestExcludeEncrypted(err)
+	}
+
+	if c.Diff.stat {
+		return c.writeDiffStat(ts, args, persistentState)
+	}
+
+	if c.Diff.NoPager || c.Diff.Pager == "" {
+		c.mutator = format.newMutator(c, c.Stdout, c.mutator, ts)
+		return c.applyTargetStateArgs(ts, args, persistentState)
 	}
 
 	var pagerCmd *exec.Cmd
@@ -103,18 +189,9 @@ func (c *Config) runDiffCmd(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	switch c.Diff.Format {
-	case "chezmoi":
-		c.mutator = chezmoi.NewVerboseMutator(pagerStdinPipe, c.mutator, c.colored, c.maxDiffDataSize)
-	case "git":
-		unifiedEncoder := diff.NewUnifiedEncoder(pagerStdinPipe, diff.DefaultContextLines)
-		if c.colored {
-			unifiedEncoder.SetColor(diff.NewColorConfig())
-		}
-		c.mutator = chezmoi.NewGitDiffMutator(unifiedEncoder, c.mutator, c.DestDir+string(filepath.Separator))
-	}
+	c.mutator = format.newMutator(c, pagerStdinPipe, c.mutator, ts)
 
-	if err := c.applyArgs(args, persistentState); err != nil {
+	if err := c.applyTargetStateArgs(ts, args, persistentState); err != nil {
 		return err
 	}
 
@@ -124,3 +201,119 @@ func (c *Config) runDiffCmd(cmd *cobra.Command, args []string) error {
 
 	return pagerCmd.Wait()
 }
+
+// diffFormatNames returns the sorted keys of diffFormats.
+func diffFormatNames() []string {
+	names := make([]string, 0, len(diffFormats))
+	for name := range diffFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeDiffStat writes a summary of the changes that applying ts to args would
+// make, like git diff --stat.
+func (c *Config) writeDiffStat(ts *chezmoi.TargetState, args []string, persistentState chezmoi.PersistentState) error {
+	c.Verbose = true // Summarize scripts that would be run.
+	diffStatMutator := chezmoi.NewDiffStatMutator(c.mutator, vfs.NewReadOnlyFS(c.fs), ts.DestDir+string(filepath.Separator))
+	c.mutator = diffStatMutator
+	if err := c.applyTargetStateArgs(ts, args, persistentState); err != nil {
+		return err
+	}
+	width, err := c.getStdoutWidth()
+	if err != nil {
+		return err
+	}
+	return diffStatMutator.WriteStat(c.Stdout, width)
+}
+
+// makeRevisionSourceDir creates a temporary directory containing the source
+// directory at revision and returns its path. The caller is responsible for
+// removing the directory.
+func (c *Config) makeRevisionSourceDir(revision string) (string, error) {
+	vcs, err := c.getVCS()
+	if err != nil {
+		return "", err
+	}
+	archiveArgs := vcs.ArchiveArgs(revision)
+	if archiveArgs == nil {
+		return "", fmt.Errorf("%s: diffing against a revision not supported", c.SourceVCS.Command)
+	}
+
+	//nolint:gosec
+	cmd := exec.Command(c.SourceVCS.Command, archiveArgs...)
+	cmd.Dir, err = c.fs.RawPath(c.SourceDir)
+	if err != nil {
+		return "", err
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) && len(exitError.Stderr) != 0 {
+			return "", fmt.Errorf("%s %s: %s", c.SourceVCS.Command, strings.Join(archiveArgs, " "), bytes.TrimSpace(exitError.Stderr))
+		}
+		return "", fmt.Errorf("%s %s: %w", c.SourceVCS.Command, strings.Join(archiveArgs, " "), err)
+	}
+
+	tempDir := os.TempDir()
+	if err := vfs.MkdirAll(c.fs, tempDir, 0o777); err != nil {
+		return "", err
+	}
+	rawTempDir, err := c.fs.RawPath(tempDir)
+	if err != nil {
+		return "", err
+	}
+	rawRevisionSourceDir, err := ioutil.TempDir(rawTempDir, "chezmoi-revision")
+	if err != nil {
+		return "", err
+	}
+	revisionSourceDir := filepath.Join(tempDir, filepath.Base(rawRevisionSourceDir))
+	if err := extractTAR(c.fs, revisionSourceDir, tar.NewReader(bytes.NewReader(output))); err != nil {
+		_ = c.fs.RemoveAll(revisionSourceDir)
+		return "", err
+	}
+	return revisionSourceDir, nil
+}
+
+// extractTAR extracts the directories, regular files, and symlinks in r into
+// dir.
+func extractTAR(fs vfs.FS, dir string, r *tar.Reader) error {
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%s: invalid path in archive", header.Name)
+		}
+		path := filepath.Join(dir, name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := vfs.MkdirAll(fs, path, 0o700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := vfs.MkdirAll(fs, filepath.Dir(path), 0o700); err != nil {
+				return err
+			}
+			contents, err := ioutil.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			if err := fs.WriteFile(path, contents, os.FileMode(header.Mode).Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := vfs.MkdirAll(fs, filepath.Dir(path), 0o700); err != nil {
+				return err
+			}
+			if err := fs.Symlink(header.Linkname, path); err != nil {
+				return err
+			}
+		}
+	}
+}
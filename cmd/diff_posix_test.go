@@ -1,3 +1,4 @@
+//go:build !windows
 // +build !windows
 
 package cmd
@@ -5,7 +6,9 @@ package cmd
 import (
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -35,3 +38,418 @@ func TestDiffDoesNotRunScript(t *testing.T) {
 		),
 	)
 }
+
+func TestDiffIncludeEntryTypes(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_file":            "file\n",
+			"run_script":          "#!/bin/sh\n",
+			"symlink_dot_symlink": ".file\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	for _, tc := range []struct {
+		include     []string
+		exclude     []string
+		contains    []string
+		notContains []string
+	}{
+		{
+			include:     []string{"scripts"},
+			contains:    []string{"run_script"},
+			notContains: []string{".file", ".symlink"},
+		},
+		{
+			include:     []string{"files", "symlinks"},
+			contains:    []string{".file", ".symlink"},
+			notContains: []string{"run_script"},
+		},
+		{
+			exclude:     []string{"files"},
+			contains:    []string{"run_script", ".symlink"},
+			notContains: []string{"+file\n"},
+		},
+	} {
+		t.Run(strings.Join(append(tc.include, tc.exclude...), "_"), func(t *testing.T) {
+			stdout := &strings.Builder{}
+			c := newTestConfig(fs, withStdout(stdout))
+			c.Diff.NoPager = true
+			c.include = tc.include
+			c.exclude = tc.exclude
+			require.NoError(t, c.runDiffCmd(nil, nil))
+			for _, s := range tc.contains {
+				assert.Contains(t, stdout.String(), s)
+			}
+			for _, s := range tc.notContains {
+				assert.NotContains(t, stdout.String(), s)
+			}
+		})
+	}
+}
+
+func TestDiffRevision(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in $PATH")
+	}
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".foo": "new\n",
+			".local/share/chezmoi": map[string]interface{}{
+				"dot_foo": "old\n",
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	sourceDir, err := fs.RawPath("/home/user/.local/share/chezmoi")
+	require.NoError(t, err)
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=chezmoi", "-c", "user.email=chezmoi@example.com"}, args...)...)
+		cmd.Dir = sourceDir
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+	git("init", "--quiet")
+	git("add", ".")
+	git("commit", "--quiet", "--message", "old")
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/dot_foo", []byte("new\n"), 0o644))
+	git("commit", "--quiet", "--all", "--message", "new")
+
+	stdout := &strings.Builder{}
+	c := newTestConfig(fs, withStdout(stdout))
+	c.Diff.NoPager = true
+	require.NoError(t, c.runDiffCmd(nil, nil))
+	assert.Equal(t, "", stdout.String())
+
+	c = newTestConfig(fs, withStdout(stdout))
+	c.Diff.NoPager = true
+	c.Diff.revision = "HEAD~1"
+	require.NoError(t, c.runDiffCmd(nil, nil))
+	assert.Contains(t, stdout.String(), "+old\n")
+
+	c = newTestConfig(fs, withStdout(stdout))
+	c.Diff.NoPager = true
+	c.Diff.revision = "nonexistent"
+	err = c.runDiffCmd(nil, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "nonexistent")
+
+	infos, err := fs.ReadDir(os.TempDir())
+	if err == nil {
+		for _, info := range infos {
+			assert.False(t, strings.HasPrefix(info.Name(), "chezmoi-revision"))
+		}
+	}
+}
+
+func TestDiffRevisionHg(t *testing.T) {
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("tar not found in $PATH")
+	}
+	binDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(binDir))
+	}()
+	// The fake hg archives dot_foo as hg archive would, under a
+	// <repo>-<hash>/ prefix and with .hg_archival.txt unless told otherwise.
+	hg := filepath.Join(binDir, "hg")
+	require.NoError(t, ioutil.WriteFile(hg, []byte(strings.Join([]string{
+		"#!/bin/sh",
+		"prefix=chezmoi-0123456789ab",
+		"archival=true",
+		"while [ $# -gt 0 ]; do",
+		"  case $1 in",
+		"  --prefix) prefix=$2; shift ;;",
+		"  -X) [ \"$2\" = .hg_archival.txt ] && archival=false; shift ;;",
+		"  esac",
+		"  shift",
+		"done",
+		"stage=" + filepath.Join(binDir, "stage"),
+		"rm -rf \"$stage\"",
+		"mkdir -p \"$stage/$prefix\"",
+		"printf 'old\\n' > \"$stage/$prefix/dot_foo\"",
+		"if [ $archival = true ]; then",
+		"  printf 'repo: 0123456789ab\\n' > \"$stage/$prefix/.hg_archival.txt\"",
+		"fi",
+		"cd \"$stage\" && exec tar -cf - \"$prefix\"",
+		"",
+	}, "\n")), 0o755))
+
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".foo": "new\n",
+			".local/share/chezmoi": map[string]interface{}{
+				"dot_foo": "new\n",
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	stdout := &strings.Builder{}
+	c := newTestConfig(fs, withStdout(stdout))
+	c.SourceVCS.Command = hg
+	c.Diff.NoPager = true
+	c.Diff.revision = "0123456789ab"
+	require.NoError(t, c.runDiffCmd(nil, nil))
+	assert.Contains(t, stdout.String(), "+old\n")
+	assert.NotContains(t, stdout.String(), "chezmoi-0123456789ab")
+	assert.NotContains(t, stdout.String(), ".hg_archival.txt")
+}
+
+func TestDiffRemote(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in $PATH")
+	}
+	repoDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(repoDir))
+	}()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, "dot_foo"), []byte("remote\n"), 0o644))
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=chezmoi", "-c", "user.email=chezmoi@example.com"}, args...)...)
+		cmd.Dir = repoDir
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+	git("init", "--quiet")
+	git("checkout", "--quiet", "-b", "other")
+	git("add", ".")
+	git("commit", "--quiet", "--message", "initial")
+
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".foo": "local\n",
+			".local/share/chezmoi": map[string]interface{}{
+				"dot_foo": "local\n",
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	stdout := &strings.Builder{}
+	c := newTestConfig(fs, withStdout(stdout), withStderr(ioutil.Discard))
+	c.Diff.NoPager = true
+	c.remote.url = repoDir
+	c.clone.branch = "other"
+	c.clone.depth = 1
+	require.NoError(t, c.runDiffCmd(nil, nil))
+	assert.Contains(t, stdout.String(), "+remote\n")
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.foo",
+			vfst.TestContentsString("local\n"),
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/dot_foo",
+			vfst.TestContentsString("local\n"),
+		),
+	)
+
+	c = newTestConfig(fs, withStdout(stdout), withStderr(ioutil.Discard))
+	c.remote.url = filepath.Join(repoDir, "nonexistent")
+	require.Error(t, c.runDiffCmd(nil, nil))
+
+	infos, err := fs.ReadDir(os.TempDir())
+	if err == nil {
+		for _, info := range infos {
+			assert.False(t, strings.HasPrefix(info.Name(), "chezmoi-remote"))
+		}
+	}
+}
+
+func TestDiffRemoteUntrusted(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in $PATH")
+	}
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	for _, tc := range []struct {
+		name            string
+		template        string
+		trust           bool
+		expectedFunc    string
+		expectedContent string
+	}{
+		{
+			name:         "secret",
+			template:     `{{ secret }}`,
+			expectedFunc: "secret",
+		},
+		{
+			name:            "secret_trusted",
+			template:        `{{ secret }}`,
+			trust:           true,
+			expectedContent: "+s3cret",
+		},
+		{
+			name:         "getHostByName",
+			template:     `{{ getHostByName "localhost" }}`,
+			expectedFunc: "getHostByName",
+		},
+		{
+			name:         "env",
+			template:     `{{ env "HOME" }}`,
+			expectedFunc: "env",
+		},
+		{
+			name:         "expandenv",
+			template:     `{{ expandenv "$HOME" }}`,
+			expectedFunc: "expandenv",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repoDir, err := ioutil.TempDir("", "chezmoi")
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, os.RemoveAll(repoDir))
+			}()
+			require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, "dot_file.tmpl"), []byte(tc.template), 0o644))
+			for _, args := range [][]string{
+				{"init", "--quiet"},
+				{"add", "."},
+				{"commit", "--quiet", "--message", "initial"},
+			} {
+				cmd := exec.Command("git", append([]string{"-c", "user.name=chezmoi", "-c", "user.email=chezmoi@example.com"}, args...)...)
+				cmd.Dir = repoDir
+				output, err := cmd.CombinedOutput()
+				require.NoError(t, err, string(output))
+			}
+
+			stdout := &strings.Builder{}
+			c := newTestConfig(fs, withStdout(stdout), withStderr(ioutil.Discard))
+			c.addSecretTemplateFunc("secret", func() string {
+				return "s3cret"
+			})
+			c.Diff.NoPager = true
+			c.remote.url = repoDir
+			c.trust.trust = tc.trust
+			err = c.runDiffCmd(nil, nil)
+			if tc.expectedFunc != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedFunc+": disabled because "+repoDir+" is not trusted")
+			} else {
+				require.NoError(t, err)
+				assert.Contains(t, stdout.String(), tc.expectedContent)
+			}
+		})
+	}
+}
+
+func TestDiffPartialTemplate(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.file": "contents\n",
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_file.tmpl":          `{{ includeTemplate "file" }}`,
+			".chezmoitemplates/file": "contents\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	stdout := &strings.Builder{}
+	c := newTestConfig(fs, withStdout(stdout))
+	c.Diff.NoPager = true
+	require.NoError(t, c.runDiffCmd(nil, nil))
+	assert.Equal(t, "", stdout.String())
+
+	// Changing a template in .chezmoitemplates changes the targets that
+	// include it.
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/.chezmoitemplates/file", []byte("new contents\n"), 0o644))
+	stdout.Reset()
+	c = newTestConfig(fs, withStdout(stdout))
+	c.Diff.NoPager = true
+	require.NoError(t, c.runDiffCmd(nil, nil))
+	assert.Contains(t, stdout.String(), ".file")
+	assert.Contains(t, stdout.String(), "+new contents\n")
+}
+
+func TestDiffStat(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".bashrc": "# bashrc\nalias ls='ls -F'\n",
+			".old":    "old\n",
+			".local/share/chezmoi": map[string]interface{}{
+				".chezmoiremove":      ".old\n",
+				"dot_bashrc":          "# bashrc\nalias ls='ls -G'\nexport EDITOR=vi\n",
+				"dot_binary":          "\x00\x01",
+				"dot_unchanged":       "unchanged\n",
+				"run_script":          "#!/bin/sh\n",
+				"symlink_dot_symlink": ".bashrc\n",
+			},
+			".unchanged": "unchanged\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	for _, tc := range []struct {
+		name        string
+		args        []string
+		include     []string
+		remove      bool
+		expectedStr string
+	}{
+		{
+			name: "all",
+			expectedStr: strings.Join([]string{
+				" .bashrc    | 3 ++-",
+				" .binary    | Bin 0 -> 2 bytes",
+				" .symlink   | 1 +",
+				" run_script | script",
+				" 3 files changed, 1 script to run, 3 insertions(+), 1 deletion(-)",
+			}, "\n") + "\n",
+		},
+		{
+			name:   "remove",
+			remove: true,
+			expectedStr: strings.Join([]string{
+				" .old       | 1 -",
+				" .bashrc    | 3 ++-",
+				" .binary    | Bin 0 -> 2 bytes",
+				" .symlink   | 1 +",
+				" run_script | script",
+				" 4 files changed, 1 script to run, 3 insertions(+), 2 deletions(-)",
+			}, "\n") + "\n",
+		},
+		{
+			name:    "include_files",
+			include: []string{"files"},
+			expectedStr: strings.Join([]string{
+				" .bashrc | 3 ++-",
+				" .binary | Bin 0 -> 2 bytes",
+				" 2 files changed, 2 insertions(+), 1 deletion(-)",
+			}, "\n") + "\n",
+		},
+		{
+			name: "args",
+			args: []string{"/home/user/.bashrc"},
+			expectedStr: strings.Join([]string{
+				" .bashrc | 3 ++-",
+				" 1 file changed, 2 insertions(+), 1 deletion(-)",
+			}, "\n") + "\n",
+		},
+		{
+			name:        "unchanged",
+			args:        []string{"/home/user/.unchanged"},
+			expectedStr: "",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stdout := &strings.Builder{}
+			c := newTestConfig(fs, withStdout(stdout), withRemove(tc.remove))
+			c.Diff.stat = true
+			if tc.include != nil {
+				c.include = tc.include
+			}
+			require.NoError(t, c.runDiffCmd(nil, tc.args))
+			assert.Equal(t, tc.expectedStr, stdout.String())
+		})
+	}
+}
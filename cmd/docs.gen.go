@@ -276,7 +276,7 @@ func init() {
 		"## How can I tell what dotfiles in my home directory aren't managed by chezmoi? Is there an easy way to have chezmoi manage a subset of them?\n" +
 		"\n" +
 		"`chezmoi unmanaged` will list everything not managed by chezmoi. You can add\n" +
-		"entire directories with `chezmoi add -r`.\n" +
+		"entire directories with `chezmoi add`.\n" +
 		"\n" +
 		"## How can I tell what dotfiles in my home directory are currently managed by chezmoi?\n" +
 		"\n" +
@@ -360,9 +360,10 @@ func init() {
 		"\n" +
 		"## I've made changes to both the destination state and the source state that I want to keep. How can I keep them both?\n" +
 		"\n" +
-		"`chezmoi merge` will open a merge tool to resolve differences between the source\n" +
-		"state, target state, and destination state. Copy the changes you want to keep in\n" +
-		"to the source state.\n" +
+		"`chezmoi merge` will open a merge tool to resolve differences between the\n" +
+		"destination state, the contents that chezmoi last applied, and the target state.\n" +
+		"After the merge tool exits, chezmoi offers to re-add the merged result to the\n" +
+		"source state.\n" +
 		"\n" +
 		"## Why does chezmoi convert all my template variables to lowercase?\n" +
 		"\n" +
@@ -526,6 +527,7 @@ func init() {
 		"  * [Use Bitwarden to keep your secrets](#use-bitwarden-to-keep-your-secrets)\n" +
 		"  * [Use gopass to keep your secrets](#use-gopass-to-keep-your-secrets)\n" +
 		"  * [Use gpg to keep your secrets](#use-gpg-to-keep-your-secrets)\n" +
+		"  * [Use age to keep your secrets](#use-age-to-keep-your-secrets)\n" +
 		"  * [Use KeePassXC to keep your secrets](#use-keepassxc-to-keep-your-secrets)\n" +
 		"  * [Use a keyring to keep your secrets](#use-a-keyring-to-keep-your-secrets)\n" +
 		"  * [Use LastPass to keep your secrets](#use-lastpass-to-keep-your-secrets)\n" +
@@ -845,8 +847,9 @@ func init() {
 		"    chezmoi apply --remove --dry-run --verbose\n" +
 		"\n" +
 		"`.chezmoiremove` is interpreted as a template, so you can remove different files\n" +
-		"on different machines. Negative matches (patterns prefixed with a `!`) or\n" +
-		"targets listed in `.chezmoiignore` will never be removed.\n" +
+		"on different machines. Negative matches (patterns prefixed with a `!`),\n" +
+		"targets listed in `.chezmoiignore`, targets in the source state, and anything\n" +
+		"outside the destination directory will never be removed.\n" +
 		"\n" +
 		"## Include a subdirectory from another repository, like Oh My Zsh\n" +
 		"\n" +
@@ -994,6 +997,33 @@ func init() {
 		"\n" +
 		"    gpg --armor --symmetric\n" +
 		"\n" +
+		"### Use age to keep your secrets\n" +
+		"\n" +
+		"chezmoi can encrypt files with [age](https://age-encryption.org) instead of gpg.\n" +
+		"Set `encryption.method` to `age` and specify your identity and recipient in\n" +
+		"your configuration file:\n" +
+		"\n" +
+		"    [encryption]\n" +
+		"      method = \"age\"\n" +
+		"    [age]\n" +
+		"      identity = \"/home/user/key.txt\"\n" +
+		"      recipient = \"age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p\"\n" +
+		"\n" +
+		"Add files to be encrypted with the `--encrypt` flag, for example:\n" +
+		"\n" +
+		"    chezmoi add --encrypt ~/.ssh/id_rsa\n" +
+		"\n" +
+		"chezmoi will encrypt the file with:\n" +
+		"\n" +
+		"    age --armor --recipient ${age.recipient}\n" +
+		"\n" +
+		"and decrypt it with:\n" +
+		"\n" +
+		"    age --decrypt --identity ${age.identity}\n" +
+		"\n" +
+		"To encrypt for several recipients, list them in a file and set\n" +
+		"`age.recipientsFile` to its path.\n" +
+		"\n" +
 		"### Use KeePassXC to keep your secrets\n" +
 		"\n" +
 		"chezmoi includes support for [KeePassXC](https://keepassxc.org) using the\n" +
@@ -1201,6 +1231,16 @@ func init() {
 		"executed in alphabetical order. Scripts that should only be run when their\n" +
 		"contents change have the prefix `run_once_`.\n" +
 		"\n" +
+		"Scripts are normally run interleaved with the updates to files, directories,\n" +
+		"and symlinks, in alphabetical order of their targets. Scripts with the prefix\n" +
+		"`run_before_`, for example `run_before_10-setup.sh`, are run before any other\n" +
+		"targets are updated, which is useful for creating mount points or installing\n" +
+		"tools that templates depend on. Scripts with the prefix `run_after_` are run\n" +
+		"after all other targets have been updated, which is useful for reloading\n" +
+		"services. `before_` and `after_` scripts are run in alphabetical order of their\n" +
+		"targets, wherever they are in the source directory, and can be combined with\n" +
+		"`once_`, for example `run_once_before_install-packages.sh`.\n" +
+		"\n" +
 		"Scripts break chezmoi's declarative approach, and as such should be used\n" +
 		"sparingly. Any script should be idempotent, even `run_once_` scripts.\n" +
 		"\n" +
@@ -1526,17 +1566,29 @@ func init() {
 		"  * [`-f`, `--follow`](#-f---follow)\n" +
 		"  * [`-n`, `--dry-run`](#-n---dry-run)\n" +
 		"  * [`-h`, `--help`](#-h---help)\n" +
+		"  * [`--no-persistent-state`](#--no-persistent-state)\n" +
+		"  * [`--no-prompt`](#--no-prompt)\n" +
 		"  * [`-r`. `--remove`](#-r---remove)\n" +
+		"  * [`--relative-to-dest`](#--relative-to-dest)\n" +
 		"  * [`-S`, `--source` *directory*](#-s---source-directory)\n" +
 		"  * [`-v`, `--verbose`](#-v---verbose)\n" +
 		"  * [`--version`](#--version)\n" +
 		"* [Configuration file](#configuration-file)\n" +
 		"  * [Configuration variables](#configuration-variables)\n" +
+		"  * [Multiple source directories](#multiple-source-directories)\n" +
+		"  * [Privilege elevation](#privilege-elevation)\n" +
+		"  * [Scoped directories](#scoped-directories)\n" +
+		"  * [Secret manager commands](#secret-manager-commands)\n" +
+		"  * [Skipped targets](#skipped-targets)\n" +
+		"  * [Target owners](#target-owners)\n" +
 		"* [Source state attributes](#source-state-attributes)\n" +
 		"* [Special files and directories](#special-files-and-directories)\n" +
 		"  * [`.chezmoi.<format>.tmpl`](#chezmoiformattmpl)\n" +
+		"  * [`.chezmoidata.<format>`](#chezmoidataformat)\n" +
+		"  * [`.chezmoidependencies`](#chezmoidependencies)\n" +
 		"  * [`.chezmoiignore`](#chezmoiignore)\n" +
 		"  * [`.chezmoiremove`](#chezmoiremove)\n" +
+		"  * [`.chezmoiroot`](#chezmoiroot)\n" +
 		"  * [`.chezmoitemplates`](#chezmoitemplates)\n" +
 		"  * [`.chezmoiversion`](#chezmoiversion)\n" +
 		"* [Commands](#commands)\n" +
@@ -1552,24 +1604,30 @@ func init() {
 		"  * [`docs` [*regexp*]](#docs-regexp)\n" +
 		"  * [`doctor`](#doctor)\n" +
 		"  * [`dump` [*targets*]](#dump-targets)\n" +
+		"  * [`dump-config`](#dump-config)\n" +
 		"  * [`edit` [*targets*]](#edit-targets)\n" +
 		"  * [`edit-config`](#edit-config)\n" +
 		"  * [`execute-template` [*templates*]](#execute-template-templates)\n" +
 		"  * [`forget` *targets*](#forget-targets)\n" +
+		"  * [`generate` `install.sh`](#generate-installsh)\n" +
 		"  * [`git` [*arguments*]](#git-arguments)\n" +
 		"  * [`help` *command*](#help-command)\n" +
 		"  * [`hg` [*arguments*]](#hg-arguments)\n" +
 		"  * [`init` [*repo*]](#init-repo)\n" +
 		"  * [`import` *filename*](#import-filename)\n" +
+		"  * [`lint`](#lint)\n" +
 		"  * [`manage` *targets*](#manage-targets)\n" +
-		"  * [`managed`](#managed)\n" +
+		"  * [`managed` [*targets*]](#managed-targets)\n" +
 		"  * [`merge` *targets*](#merge-targets)\n" +
 		"  * [`purge`](#purge)\n" +
+		"  * [`re-add` [*targets*]](#re-add-targets)\n" +
 		"  * [`remove` *targets*](#remove-targets)\n" +
 		"  * [`rm` *targets*](#rm-targets)\n" +
 		"  * [`secret`](#secret)\n" +
 		"  * [`source` [*args*]](#source-args)\n" +
 		"  * [`source-path` [*targets*]](#source-path-targets)\n" +
+		"  * [`state`](#state)\n" +
+		"  * [`status` [*targets*]](#status-targets)\n" +
 		"  * [`unmanage` *targets*](#unmanage-targets)\n" +
 		"  * [`unmanaged`](#unmanaged)\n" +
 		"  * [`update`](#update)\n" +
@@ -1580,19 +1638,28 @@ func init() {
 		"* [Template execution](#template-execution)\n" +
 		"* [Template variables](#template-variables)\n" +
 		"* [Template functions](#template-functions)\n" +
+		"  * [`awsSecretsManager` *name*](#awssecretsmanager-name)\n" +
+		"  * [`awsSecretsManagerRaw` *name*](#awssecretsmanagerraw-name)\n" +
 		"  * [`bitwarden` [*args*]](#bitwarden-args)\n" +
+		"  * [`commandVersion` *command* [*args*]](#commandversion-command-args)\n" +
 		"  * [`gopass` *gopass-name*](#gopass-gopass-name)\n" +
+		"  * [`includeTemplate` *name* [*data*]](#includetemplate-name-data)\n" +
 		"  * [`keepassxc` *entry*](#keepassxc-entry)\n" +
 		"  * [`keepassxcAttribute` *entry* *attribute*](#keepassxcattribute-entry-attribute)\n" +
 		"  * [`keyring` *service* *user*](#keyring-service-user)\n" +
 		"  * [`lastpass` *id*](#lastpass-id)\n" +
 		"  * [`lastpassRaw` *id*](#lastpassraw-id)\n" +
+		"  * [`lookupUserShell` *username*](#lookupusershell-username)\n" +
 		"  * [`onepassword` *uuid*](#onepassword-uuid)\n" +
 		"  * [`onepasswordDocument` *uuid*](#onepassworddocument-uuid)\n" +
+		"  * [`onepasswordItemFields` *item*](#onepassworditemfields-item)\n" +
 		"  * [`pass` *pass-name*](#pass-pass-name)\n" +
+		"  * [`promptBool` *prompt*](#promptbool-prompt)\n" +
+		"  * [`promptInt` *prompt*](#promptint-prompt)\n" +
 		"  * [`promptString` *prompt*](#promptstring-prompt)\n" +
 		"  * [`secret` [*args*]](#secret-args)\n" +
 		"  * [`secretJSON` [*args*]](#secretjson-args)\n" +
+		"  * [`semverAtLeast` *version* *minimum*](#semveratleast-version-minimum)\n" +
 		"  * [`vault` *key*](#vault-key)\n" +
 		"\n" +
 		"## Concepts\n" +
@@ -1623,6 +1690,23 @@ func init() {
 		"\n" +
 		"Command line flags override any values set in the configuration file.\n" +
 		"\n" +
+		"### `--allow-sudo`\n" +
+		"\n" +
+		"When chezmoi is run as root with `sudo`, use the config file, source directory,\n" +
+		"destination directory, and persistent state of the user who ran `sudo`, instead\n" +
+		"of root's. Files are still written with root's privileges, but files written in\n" +
+		"the user's home directory are owned by the user: new files belong to the user\n" +
+		"and existing files keep their owner.\n" +
+		"\n" +
+		"Without `--allow-sudo`, chezmoi refuses to run as root with `sudo` unless the\n" +
+		"destination directory is set explicitly with `--destination`, as it would\n" +
+		"otherwise silently use root's home directory and leave files owned by root that\n" +
+		"break later runs without `sudo`. When not run as root, chezmoi warns about a\n" +
+		"config file owned by root, for example from an earlier run with `sudo`, with the\n" +
+		"`chown` command to fix it. Commands that write the persistent state, except in\n" +
+		"dry run mode, replace a persistent state file owned by root with a copy owned by\n" +
+		"you if they can, and otherwise fail with the `chown` command to fix it.\n" +
+		"\n" +
 		"### `--color` *value*\n" +
 		"\n" +
 		"Colorize diffs, *value* can be `on`, `off`, `auto`, or any boolean-like value\n" +
@@ -1637,40 +1721,110 @@ func init() {
 		"\n" +
 		"### `--debug`\n" +
 		"\n" +
-		"Log information helpful for debugging.\n" +
+		"Log information helpful for debugging, including every individual operation on\n" +
+		"the filesystem.\n" +
 		"\n" +
 		"### `-D`, `--destination` *directory*\n" +
 		"\n" +
-		"Use *directory* as the destination directory.\n" +
+		"Use *directory* as the destination directory. The default is your home\n" +
+		"directory, or `$HOME` if your home directory cannot be looked up. If neither is\n" +
+		"available, for example in some minimal containers, then you must set the\n" +
+		"destination directory explicitly.\n" +
+		"\n" +
+		"All commands resolve targets against the destination directory. Relative\n" +
+		"*targets* are relative to the working directory, unless they do not exist there\n" +
+		"but do exist in, or are managed in, the destination directory. The\n" +
+		"`.chezmoi.homedir` template variable is always your home directory, while\n" +
+		"`.chezmoi.destDir` is the destination directory.\n" +
 		"\n" +
 		"### `-f`, `--follow`\n" +
 		"\n" +
 		"If the last part of a target is a symlink, deal with what the symlink\n" +
 		"references, rather than the symlink itself.\n" +
 		"\n" +
+		"Without `--follow`, directories in the destination directory that are symlinks\n" +
+		"to locations outside the destination directory are reported before any changes\n" +
+		"are made, and chezmoi asks for confirmation before writing through them. In dry\n" +
+		"run mode, for example with `chezmoi diff` or `chezmoi verify`, they are only\n" +
+		"reported.\n" +
+		"\n" +
 		"### `-n`, `--dry-run`\n" +
 		"\n" +
 		"Set dry run mode. In dry run mode, the destination directory is never modified.\n" +
 		"This is most useful in combination with the `-v` (verbose) flag to print changes\n" +
-		"that would be made without making them.\n" +
+		"that would be made without making them. Scripts are never run in dry run mode,\n" +
+		"and `run_once_` scripts are not recorded as run.\n" +
 		"\n" +
 		"### `-h`, `--help`\n" +
 		"\n" +
 		"Print help.\n" +
 		"\n" +
+		"### `--no-persistent-state`\n" +
+		"\n" +
+		"Do not read or write the persistent state, for example in containers or when\n" +
+		"the home directory is read-only. An empty persistent state is used instead and\n" +
+		"discarded when chezmoi exits, so `run_once_` scripts are run every time, and a\n" +
+		"warning is printed when applying a target state containing them. This can also\n" +
+		"be set with the `noPersistentState` configuration variable.\n" +
+		"\n" +
+		"Commands that only read the persistent state, like `diff` and `verify`,\n" +
+		"automatically continue without it, with a warning, if it cannot be opened.\n" +
+		"\n" +
+		"### `--no-prompt`\n" +
+		"\n" +
+		"Never prompt, and instead take the default choice of every prompt. Prompts for\n" +
+		"adding or applying a target default to `n`, and prompts for removing targets\n" +
+		"that have been removed from the source state default to `q`. The `purge` and\n" +
+		"`remove` commands have no default and fail unless `--force` is given. Prompts\n" +
+		"are written to stderr, and also take their default choice if stdin is closed.\n" +
+		"This can also be set with the `noPrompt` configuration variable.\n" +
+		"\n" +
 		"### `-r`. `--remove`\n" +
 		"\n" +
 		"Also remove targets according to `.chezmoiremove`.\n" +
 		"\n" +
+		"### `--relative-to-dest`\n" +
+		"\n" +
+		"Resolve relative *targets* against the destination directory instead of the\n" +
+		"current working directory. Without this flag, a relative target that neither\n" +
+		"exists nor is managed relative to the current working directory, but does exist\n" +
+		"or is managed relative to the destination directory, is resolved against the\n" +
+		"destination directory. If a relative target exists relative to both then the\n" +
+		"current working directory is preferred, with a note printed in verbose mode.\n" +
+		"\n" +
 		"### `-S`, `--source` *directory*\n" +
 		"\n" +
-		"Use *directory* as the source directory.\n" +
+		"Use *directory* as the source directory, overriding `sourceDir` in the config\n" +
+		"file. A relative *directory* is resolved against the current working directory,\n" +
+		"and *directory* must exist.\n" +
+		"\n" +
+		"If *directory* is neither the configured source directory nor one of\n" +
+		"`sourceDirs`, for example a scratch checkout of your dotfiles, then it is used\n" +
+		"as the only source directory, changes to it are never automatically committed\n" +
+		"or pushed, and the state of applying it, including which targets were applied\n" +
+		"and which `run_once_` scripts have been run, is recorded separately from the\n" +
+		"configured source directory's. This lets you try out work in progress with\n" +
+		"`chezmoi apply`, `diff`, `verify`, `cat`, or `archive` without affecting your\n" +
+		"configured source directory, for example:\n" +
+		"\n" +
+		"    chezmoi --source ~/src/dotfiles diff\n" +
 		"\n" +
 		"### `-v`, `--verbose`\n" +
 		"\n" +
-		"Set verbose mode. In verbose mode, chezmoi prints the changes that it is making\n" +
-		"as approximate shell commands, and any differences in files between the target\n" +
-		"state and the destination set are printed as unified diffs.\n" +
+		"Set verbose mode. In verbose mode, chezmoi prints a one line summary of each\n" +
+		"change that it makes, with paths relative to the destination directory, for\n" +
+		"example:\n" +
+		"\n" +
+		"    created .config/foo\n" +
+		"    updated .zshrc (contents, mode 0644→0600)\n" +
+		"    removed .old\n" +
+		"    ran script run_once_install.sh (2.3s, /run/user/1000/chezmoi/123456.install.sh)\n" +
+		"    failed script run_update.sh (0.1s, /run/user/1000/chezmoi/123457.update.sh, exit status 1)\n" +
+		"\n" +
+		"With `--dry-run`, changes are summarized as changes that would be made, for\n" +
+		"example `would update .zshrc (contents)`. Summaries are colored by action if\n" +
+		"color is enabled. Use `chezmoi diff` to see\n" +
+		"the differences in files, and `--debug` to log every individual operation.\n" +
 		"\n" +
 		"### `--version`\n" +
 		"\n" +
@@ -1688,43 +1842,231 @@ func init() {
 		"property file format, and [HCL](https://github.com/hashicorp/hcl). The basename\n" +
 		"of the config file is `chezmoi`, and the first config file found is used.\n" +
 		"\n" +
+		"TOML config files may use all the features of [TOML\n" +
+		"1.0](https://toml.io/en/v1.0.0), including dotted keys and arrays of mixed\n" +
+		"types. JSON config files may also contain `//` and `/* */` comments and trailing\n" +
+		"commas, as in JSONC and JSON5, and may have the extension `.jsonc` or `.json5`.\n" +
+		"Other JSON5 extensions, such as unquoted keys, are not supported.\n" +
+		"\n" +
 		"### Configuration variables\n" +
 		"\n" +
 		"The following configuration variables are available:\n" +
 		"\n" +
-		"| Variable                | Type     | Default value             | Description                                         |\n" +
-		"| ----------------------- | -------- | ------------------------- | --------------------------------------------------- |\n" +
-		"| `bitwarden.command`     | string   | `bw`                      | Bitwarden CLI command                               |\n" +
-		"| `cd.command`            | string   | *none*                    | Shell to run in `cd` command                        |\n" +
-		"| `color`                 | string   | `auto`                    | Colorize diffs                                      |\n" +
-		"| `data`                  | any      | *none*                    | Template data                                       |\n" +
-		"| `destDir`               | string   | `~`                       | Destination directory                               |\n" +
-		"| `diff.format`           | string   | `chezmoi`                 | Diff format, either `chezmoi` or `git`              |\n" +
-		"| `diff.pager`            | string   | *none*                    | Pager                                               |\n" +
-		"| `dryRun`                | bool     | `false`                   | Dry run mode                                        |\n" +
-		"| `follow`                | bool     | `false`                   | Follow symlinks                                     |\n" +
-		"| `genericSecret.command` | string   | *none*                    | Generic secret command                              |\n" +
-		"| `gopass.command`        | string   | `gopass`                  | gopass CLI command                                  |\n" +
-		"| `gpg.command`           | string   | `gpg`                     | GPG CLI command                                     |\n" +
-		"| `gpg.recipient`         | string   | *none*                    | GPG recipient                                       |\n" +
-		"| `gpg.symmetric`         | bool     | `false`                   | Use symmetric GPG encryption                        |\n" +
-		"| `keepassxc.args`        | []string | *none*                    | Extra args to KeePassXC CLI command                 |\n" +
-		"| `keepassxc.command`     | string   | `keepassxc-cli`           | KeePassXC CLI command                               |\n" +
-		"| `keepassxc.database`    | string   | *none*                    | KeePassXC database                                  |\n" +
-		"| `lastpass.command`      | string   | `lpass`                   | Lastpass CLI command                                |\n" +
-		"| `merge.args`            | []string | *none*                    | Extra args to 3-way merge command                   |\n" +
-		"| `merge.command`         | string   | `vimdiff`                 | 3-way merge command                                 |\n" +
-		"| `onepassword.command`   | string   | `op`                      | 1Password CLI command                               |\n" +
-		"| `pass.command`          | string   | `pass`                    | Pass CLI command                                    |\n" +
-		"| `remove`                | bool     | `false`                   | Remove targets                                      |\n" +
-		"| `sourceDir`             | string   | `~/.local/share/chezmoi`  | Source directory                                    |\n" +
-		"| `sourceVCS.autoCommit`  | bool     | `false`                   | Commit changes to the source state after any change |\n" +
-		"| `sourceVCS.autoPush`    | bool     | `false`                   | Push changes to the source state after any change   |\n" +
-		"| `sourceVCS.command`     | string   | `git`                     | Source version control system                       |\n" +
-		"| `template.options`      | []string | `[\"missingkey=error\"]`    | Template options                                    |\n" +
-		"| `umask`                 | int      | *from system*             | Umask                                               |\n" +
-		"| `vault.command`         | string   | `vault`                   | Vault CLI command                                   |\n" +
-		"| `verbose`               | bool     | `false`                   | Verbose mode                                        |\n" +
+		"| Variable                          | Type     | Default value             | Description                                         |\n" +
+		"| --------------------------------- | -------- | ------------------------- | --------------------------------------------------- |\n" +
+		"| `add.secretCheck`                 | bool     | `true`                    | Check added files for secrets in plaintext          |\n" +
+		"| `age.command`                     | string   | `age`                     | age CLI command                                     |\n" +
+		"| `age.identity`                    | string   | *none*                    | age identity file                                   |\n" +
+		"| `age.recipient`                   | string   | *none*                    | age recipient                                       |\n" +
+		"| `age.recipientsFile`              | string   | *none*                    | age recipients file                                 |\n" +
+		"| `apply.backup`                    | bool     | `false`                   | Back up targets before changing them                |\n" +
+		"| `apply.backupDir`                 | string   | *see `apply`*             | Directory that backups are stored in                |\n" +
+		"| `apply.backupKeep`                | int      | `10`                      | Number of backups to keep                           |\n" +
+		"| `apply.clearImmutable`            | bool     | `false`                   | Clear and restore the immutable flag of targets     |\n" +
+		"| `awsSecretsManager.command`       | string   | `aws`                     | AWS CLI command                                     |\n" +
+		"| `awsSecretsManager.profile`       | string   | `$AWS_PROFILE`            | AWS profile                                         |\n" +
+		"| `awsSecretsManager.region`        | string   | *see below*               | AWS region                                          |\n" +
+		"| `bitwarden.command`               | string   | `bw`                      | Bitwarden CLI command                               |\n" +
+		"| `bitwarden.serveURL`              | string   | *none*                    | URL of a running `bw serve`                         |\n" +
+		"| `cd.command`                      | string   | *none*                    | Shell to run in `cd` command                        |\n" +
+		"| `color`                           | string   | `auto`                    | Colorize diffs                                      |\n" +
+		"| `data`                            | any      | *none*                    | Template data                                       |\n" +
+		"| `dataMergeMode`                   | object   | *none*                    | Merge mode of each top-level template data key      |\n" +
+		"| `destDir`                         | string   | `~`                       | Destination directory                               |\n" +
+		"| `diff.format`                     | string   | `chezmoi`                 | Diff format, either `chezmoi` or `git`              |\n" +
+		"| `diff.pager`                      | string   | *none*                    | Pager                                               |\n" +
+		"| `dryRun`                          | bool     | `false`                   | Dry run mode                                        |\n" +
+		"| `edit.args`                       | []string | *none*                    | Extra args to edit command                          |\n" +
+		"| `edit.command`                    | string   | *see below*               | Edit command                                        |\n" +
+		"| `edit.watchTimeout`               | duration | `5m`                      | Time to watch for edits by editors that return      |\n" +
+		"| `elevation.args`                  | []string | *none*                    | Extra args to elevation command                     |\n" +
+		"| `elevation.command`               | string   | `sudo`                    | Elevation command                                   |\n" +
+		"| `elevation.targets`               | []string | *none*                    | Targets that require elevated privileges            |\n" +
+		"| `encryption.exclude`              | bool     | `false`                   | Exclude encrypted targets from `apply` and `diff`   |\n" +
+		"| `encryption.export`               | string   | `ciphertext`              | Export encrypted files as `ciphertext` or `skip`    |\n" +
+		"| `encryption.method`               | string   | `gpg`                     | Encrypt files with `gpg` or `age`                   |\n" +
+		"| `encryption.private`              | bool     | `true`                    | Make encrypted files private                        |\n" +
+		"| `follow`                          | bool     | `false`                   | Follow symlinks                                     |\n" +
+		"| `genericSecret.command`           | string   | *none*                    | Generic secret command                              |\n" +
+		"| `gopass.command`                  | string   | `gopass`                  | gopass CLI command                                  |\n" +
+		"| `gpg.command`                     | string   | `gpg`                     | GPG CLI command                                     |\n" +
+		"| `gpg.recipient`                   | string   | *none*                    | GPG recipient                                       |\n" +
+		"| `gpg.symmetric`                   | bool     | `false`                   | Use symmetric GPG encryption                        |\n" +
+		"| `keepassxc.args`                  | []string | *none*                    | Extra args to KeePassXC CLI command                 |\n" +
+		"| `keepassxc.command`               | string   | `keepassxc-cli`           | KeePassXC CLI command                               |\n" +
+		"| `keepassxc.database`              | string   | *none*                    | KeePassXC database                                  |\n" +
+		"| `lastpass.command`                | string   | `lpass`                   | Lastpass CLI command                                |\n" +
+		"| `merge.args`                      | []string | *none*                    | Args or arg templates to 3-way merge command        |\n" +
+		"| `merge.command`                   | string   | `vimdiff`                 | 3-way merge command                                 |\n" +
+		"| `noPersistentState`               | bool     | `false`                   | Do not read or write the persistent state           |\n" +
+		"| `noPrompt`                        | bool     | `false`                   | Never prompt, use default choices                   |\n" +
+		"| `onepassword.command`             | string   | `op`                      | 1Password CLI command                               |\n" +
+		"| `onepassword.connectHost`         | string   | *none*                    | 1Password Connect server URL                        |\n" +
+		"| `onepassword.connectToken`        | string   | *none*                    | 1Password Connect token                             |\n" +
+		"| `onepassword.serviceAccountToken` | string   | *none*                    | 1Password service account token                     |\n" +
+		"| `owners`                          | []object | *none*                    | Owners of targets                                   |\n" +
+		"| `pass.command`                    | string   | `pass`                    | Pass CLI command                                    |\n" +
+		"| `pathMap`                         | []object | *none*                    | Per-OS destinations of target directories           |\n" +
+		"| `remove`                          | bool     | `false`                   | Remove targets                                      |\n" +
+		"| `scopedDirs`                      | object   | *none*                    | Source subdirectories used only on some machines    |\n" +
+		"| `scripts.tempDir`                 | string   | *see below*               | Directory that scripts are run from                 |\n" +
+		"| `skipTargets`                     | []string | *none*                    | Targets skipped unless given explicitly             |\n" +
+		"| `sourceDir`                       | string   | `~/.local/share/chezmoi`  | Source directory                                    |\n" +
+		"| `sourceDirs`                      | []string | *none*                    | Source directories, in increasing order of priority |\n" +
+		"| `sourceVCS.autoCommit`            | bool     | `false`                   | Commit changes to the source state after any change |\n" +
+		"| `sourceVCS.autoPush`              | bool     | `false`                   | Push changes to the source state after any change   |\n" +
+		"| `sourceVCS.command`               | string   | `git`                     | Source version control system                       |\n" +
+		"| `sourceVCS.gitFiles`              | bool     | `false`                   | Maintain `.gitignore` and `.gitattributes`          |\n" +
+		"| `sourceVCS.textconv`              | string   | *none*                    | Command to diff encrypted files with                |\n" +
+		"| `stateFile`                       | string   | *see below*               | Persistent state file                               |\n" +
+		"| `symlink`                         | bool     | `false`                   | Apply plain files as symlinks to their source files |\n" +
+		"| `template.options`                | []string | `[\"missingkey=error\"]`    | Template options                                    |\n" +
+		"| `templateFuncs.disable`           | []string | *none*                    | Template functions to disable                       |\n" +
+		"| `templateGlobs`                   | []string | *none*                    | Source files that are always templates              |\n" +
+		"| `umask`                           | int      | *from system*             | Umask                                               |\n" +
+		"| `vault.command`                   | string   | `vault`                   | Vault CLI command                                   |\n" +
+		"| `verbose`                         | bool     | `false`                   | Verbose mode                                        |\n" +
+		"\n" +
+		"### Multiple source directories\n" +
+		"\n" +
+		"If `sourceDirs` is set then the source state is built from each of the listed\n" +
+		"source directories in turn, so a later directory can add to and override the\n" +
+		"targets of an earlier one, for example a private overlay on top of a public\n" +
+		"dotfiles repo. Directories that appear in more than one source directory have\n" +
+		"their contents merged. Special files, including `.chezmoidata.<format>` and\n" +
+		"`.chezmoiignore`, are read from every source directory.\n" +
+		"\n" +
+		"Commands that change the source state, like `add` and `chattr`, and commands\n" +
+		"that operate on the source directory, like `cd` and `git`, use `sourceDir`,\n" +
+		"which defaults to the last directory in `sourceDirs`. Use `--source` to select a\n" +
+		"different one. Commands that operate on existing targets, like `edit`, `forget`,\n" +
+		"and `source-path`, use the source directory that contains the target.\n" +
+		"\n" +
+		"    sourceDirs = [\"/home/user/.local/share/chezmoi\", \"/home/user/.local/share/chezmoi-work\"]\n" +
+		"\n" +
+		"### Path map\n" +
+		"\n" +
+		"Some applications keep their configuration in a different place on each\n" +
+		"operating system, for example `~/.config` on Linux, `~/Library/Application\n" +
+		"Support` on macOS, and `~/AppData/Roaming` on Windows. Each entry in `pathMap`\n" +
+		"maps the logical target `name` to the target it is deployed to on each\n" +
+		"operating system in `targets`, keyed by `.chezmoi.os`. Names and targets are\n" +
+		"relative to the destination directory. On operating systems that are not listed\n" +
+		"in `targets` the logical target is deployed unchanged.\n" +
+		"\n" +
+		"    [[pathMap]]\n" +
+		"        name = \".config\"\n" +
+		"        targets = { darwin = \"Library/Application Support\", windows = \"AppData/Roaming\" }\n" +
+		"\n" +
+		"With this configuration, `dot_config/foo/config.ini` in the source state is\n" +
+		"deployed to `~/Library/Application Support/foo/config.ini` on macOS. Commands\n" +
+		"that take targets, like `chezmoi managed`, `chezmoi source-path`, and `chezmoi\n" +
+		"edit`, use the mapped targets, and `chezmoi add` records targets inside a mapped\n" +
+		"target under their logical names, so `chezmoi add ~/Library/Application\n" +
+		"Support/bar` adds `dot_config/bar`. Logical targets that are mapped elsewhere,\n" +
+		"like `~/.config` on macOS, cannot be managed. It is an error for two entries in\n" +
+		"the source state to be deployed to the same target.\n" +
+		"\n" +
+		"`.chezmoiignore` and `.chezmoiremove` patterns match the mapped targets. The\n" +
+		"parent directory of each mapped target must already exist.\n" +
+		"\n" +
+		"### Privilege elevation\n" +
+		"\n" +
+		"Targets matching any of the patterns in `elevation.targets`, relative to the\n" +
+		"destination directory, are written, removed, and have their permissions and\n" +
+		"owners changed by running `chmod`, `chown`, `install`, `ln`, `mkdir`, `mv`, and\n" +
+		"`rm` with\n" +
+		"`elevation.command` and `elevation.args`, so that the rest of chezmoi does not\n" +
+		"need to run as root. Patterns use the same syntax as `.chezmoiignore`.\n" +
+		"\n" +
+		"Elevated targets are read without elevated privileges, so dry run mode and\n" +
+		"`chezmoi diff` never prompt for a password. If elevation fails for a target\n" +
+		"then it is skipped with a warning, the remaining targets are still applied, and\n" +
+		"`chezmoi apply` exits with an error. Privilege elevation is not supported on\n" +
+		"Windows.\n" +
+		"\n" +
+		"### Scoped directories\n" +
+		"\n" +
+		"Subdirectories at the root of the source directory whose names match a pattern\n" +
+		"in `scopedDirs` are scoped directories. A scoped directory is only used if its\n" +
+		"`condition`, a template executed with the usual template data and the name of\n" +
+		"the subdirectory in `.scopedDir`, evaluates to `true`, in which case its\n" +
+		"contents are merged into the root of the source state as if they were at the\n" +
+		"top level. Scoped directories whose conditions are not `true` are ignored\n" +
+		"entirely.\n" +
+		"\n" +
+		"Scoped directories can be nested, for example `os-linux/host-laptop`, in which\n" +
+		"case the nested scoped directory is only used if both conditions are `true`.\n" +
+		"\n" +
+		"Entries in scoped directories override entries with the same target outside\n" +
+		"scoped directories. When more than one scoped directory contains the same\n" +
+		"target, the one with the highest `priority` wins, then the most deeply nested\n" +
+		"one, then the one in the latest source directory, then the one whose name sorts\n" +
+		"last. `chezmoi managed\n" +
+		"--with-source-dir` and `chezmoi source-path` show which scoped directory each\n" +
+		"target comes from. Patterns use the same syntax as `.chezmoiignore`, and if a\n" +
+		"subdirectory matches more than one pattern then the first pattern in\n" +
+		"alphabetical order is used.\n" +
+		"\n" +
+		"    [scopedDirs.\"host-*\"]\n" +
+		"        condition = '{{ eq .scopedDir (print \"host-\" .chezmoi.hostname) }}'\n" +
+		"        priority = 2\n" +
+		"    [scopedDirs.\"os-*\"]\n" +
+		"        condition = '{{ eq .scopedDir (print \"os-\" .chezmoi.os) }}'\n" +
+		"        priority = 1\n" +
+		"\n" +
+		"### Secret manager commands\n" +
+		"\n" +
+		"The `command` of each secret manager, for example `bitwarden.command` or\n" +
+		"`onepassword.command`, can be either the name of a command in your `$PATH` or\n" +
+		"an absolute path. Commands are only looked up when they are first used by a\n" +
+		"template function or by the corresponding `chezmoi secret` command, so secret\n" +
+		"managers that you do not use need not be installed. If a command cannot be\n" +
+		"found then the error names the configuration variable to set. This is useful\n" +
+		"when applications that run chezmoi, like GUI editors on macOS, do not have the\n" +
+		"same `$PATH` as your shell. `chezmoi doctor` reports the path that each command\n" +
+		"resolves to.\n" +
+		"\n" +
+		"    [bitwarden]\n" +
+		"        command = \"/opt/homebrew/bin/bw\"\n" +
+		"\n" +
+		"### Skipped targets\n" +
+		"\n" +
+		"Targets matching any of the globs in `skipTargets` are still managed, but are\n" +
+		"skipped by `chezmoi apply`, `chezmoi diff`, and `chezmoi verify` unless they are\n" +
+		"given explicitly as arguments. This is useful for targets that applications\n" +
+		"rewrite frequently, which you want to be created on new machines but not\n" +
+		"overwritten or shown in diffs afterwards. Globs are relative to the destination\n" +
+		"directory, and may begin with `~/`. In verbose mode, chezmoi prints the number\n" +
+		"of targets skipped. Targets are checked against `skipTargets` before\n" +
+		"`--exclude`, and `skipTargets` does not affect `chezmoi archive` or `chezmoi\n" +
+		"managed`.\n" +
+		"\n" +
+		"    skipTargets = [\"~/.config/app/state.json\"]\n" +
+		"\n" +
+		"    [elevation]\n" +
+		"        targets = [\"etc/hosts\", \"etc/zsh/**\"]\n" +
+		"\n" +
+		"### Target owners\n" +
+		"\n" +
+		"Targets are normally owned by the user running chezmoi. Targets matching any of\n" +
+		"the patterns in the `targets` of an entry in `owners`, relative to the\n" +
+		"destination directory, are given to its `owner`, which is a user optionally\n" +
+		"followed by a colon and a group. Users and groups can be names or numeric IDs.\n" +
+		"If the group is omitted then the user's primary group is used. The first\n" +
+		"matching entry wins, and patterns use the same syntax as `.chezmoiignore`.\n" +
+		"\n" +
+		"    [[owners]]\n" +
+		"        targets = [\"etc/nginx\", \"etc/nginx/**\"]\n" +
+		"        owner = \"www-data:www-data\"\n" +
+		"\n" +
+		"Changing a target's owner requires running chezmoi as root or matching the\n" +
+		"target in `elevation.targets`. Otherwise chezmoi warns and leaves the owner\n" +
+		"unchanged, unless the target already has the right owner. Owners are only\n" +
+		"looked up when a target matches their patterns, and if an owner cannot be\n" +
+		"found then chezmoi warns and leaves its targets' owners unchanged. Changing a\n" +
+		"target's owner does not back it up. `chezmoi verify` reports targets whose owner differs, and `chezmoi\n" +
+		"archive` records the owners in tar archives.\n" +
 		"\n" +
 		"## Source state attributes\n" +
 		"\n" +
@@ -1738,11 +2080,19 @@ func init() {
 		"\n" +
 		"| Prefix       | Effect                                                                         |\n" +
 		"| ------------ | ------------------------------------------------------------------------------ |\n" +
-		"| `encrypted_` | Encrypt the file in the source state.                                          |\n" +
+		"| `after_`     | Run script after updating all other targets.                                   |\n" +
+		"| `before_`    | Run script before updating any other targets.                                  |\n" +
+		"| `link_`      | Symlink the target file to its source file instead of copying it.              |\n" +
+		"| `modify_`    | Treat the contents as a script that modifies the existing target file.         |\n" +
+		"| `create_`    | Only write the target file if it does not already exist.                       |\n" +
+		"| `encrypted_` | Encrypt the source file or directory. Implies `private_` by default.           |\n" +
 		"| `once_`      | Only run script once.                                                          |\n" +
+		"| `perm_NNNN_` | Set the permissions of the target file or directory to the octal mode `NNNN`.  |\n" +
 		"| `private_`   | Remove all group and world permissions from the target file or directory.      |\n" +
 		"| `empty_`     | Ensure the file exists, even if is empty. By default, empty files are removed. |\n" +
+		"|              | For directories, ensure the directory exists and is empty.                     |\n" +
 		"| `exact_`     | Remove anything not managed by chezmoi.                                        |\n" +
+		"| `concat_`    | Concatenate the files in the source directory into a single target file.       |\n" +
 		"| `executable_`| Add executable permissions to the target file.                                 |\n" +
 		"| `run_`       | Treat the contents as a script to run.                                         |\n" +
 		"| `symlink_`   | Create a symlink instead of a regular file.                                    |\n" +
@@ -1752,17 +2102,150 @@ func init() {
 		"| ------- | ---------------------------------------------------- |\n" +
 		"| `.tmpl` | Treat the contents of the source file as a template. |\n" +
 		"\n" +
-		"Order of prefixes is important, the order is `run_`, `exact_`, `private_`,\n" +
-		"`empty_`, `executable_`, `symlink_`, `once_`, `dot_`.\n" +
+		"Encrypted files usually contain secrets, so the target file of an `encrypted_`\n" +
+		"file is private even without the `private_` prefix. To disable this, set\n" +
+		"`encryption.private` to `false` in your config file.\n" +
+		"\n" +
+		"An `empty_` directory is created even though it has no entries, and applying\n" +
+		"it removes everything in the target directory, except for targets that match\n" +
+		"`.chezmoiignore`, as for an `exact_` directory without entries. Its source\n" +
+		"directory may only contain files beginning with a `.`, like a `.keep` file so\n" +
+		"that it is stored by git, and it is an error for it to contain anything else,\n" +
+		"including entries from other source directories. `chezmoi add` refuses to add\n" +
+		"targets inside an `empty_` directory.\n" +
+		"\n" +
+		"Earlier versions of chezmoi had no `empty_` attribute, so a source directory\n" +
+		"called, for example, `empty_dir` managed a target directory called `empty_dir`.\n" +
+		"It now manages an empty target directory called `dir`, and chezmoi fails with an\n" +
+		"error naming the source directory if it contains anything other than files\n" +
+		"beginning with a `.`, or if other source files add targets inside `dir`.\n" +
+		"Before upgrading, rename such source directories and their targets so that\n" +
+		"their names do not begin with `empty_`.\n" +
+		"\n" +
+		"When applying an `exact_` directory, chezmoi removes everything in the target\n" +
+		"directory that is not in the source state, except for targets that match\n" +
+		"`.chezmoiignore`. Unmanaged subdirectories that contain ignored targets are not\n" +
+		"removed, only their contents that are not ignored. With `--verbose`, ignored\n" +
+		"targets that are kept are reported as skipped.\n" +
+		"\n" +
+		"The target of a `link_` file is a symbolic link to the file in the source\n" +
+		"directory, so edits to the target are made directly to the source state. Only\n" +
+		"plain files can be linked: encrypted files and templates cannot have the\n" +
+		"`link_` prefix. Adding a target that is already a symbolic link to its source\n" +
+		"file adds the `link_` prefix to the source file. Adding or removing the `link_`\n" +
+		"prefix and running `chezmoi apply` replaces the regular file with a symbolic\n" +
+		"link or vice versa.\n" +
+		"\n" +
+		"A `create_` file sets the initial contents of a target file that is then\n" +
+		"managed by something else, for example an application that rewrites its own\n" +
+		"config file. If the target does not exist then it is created, otherwise it is\n" +
+		"left untouched and treated as up to date, so `chezmoi diff` shows nothing for\n" +
+		"it. The contents of a `create_` template or encrypted file are only evaluated\n" +
+		"when the target needs to be created. `create_` files cannot have the `link_`\n" +
+		"prefix.\n" +
+		"\n" +
+		"A `modify_` file is a script that modifies a target file that is partly\n" +
+		"managed by other tools. The script is run with the current contents of the\n" +
+		"target on its standard input, or with no input if the target does not exist,\n" +
+		"and writes the new contents of the target to its standard output, so it must\n" +
+		"not change anything itself. The target is only rewritten if the output differs\n" +
+		"from its current contents, and an empty output removes the target unless the\n" +
+		"file has the `empty_` prefix. The script is run like a `run_` script, including\n" +
+		"by `chezmoi diff` and `chezmoi apply --dry-run`, which show the change without\n" +
+		"making it. If the script fails then `chezmoi apply` stops with an error. A\n" +
+		"`modify_` file may be a template and may have the `create_`, `encrypted_`,\n" +
+		"`perm_`, `private_`, `empty_`, and `executable_` prefixes, which apply to the\n" +
+		"target, but it cannot be linked. `chezmoi re-add` skips `modify_` files, as\n" +
+		"does `chezmoi add` unless `--force` is given.\n" +
+		"\n" +
+		"The `perm_` prefix sets permissions that cannot be expressed with `private_`\n" +
+		"and `executable_`, for example `perm_0640_dot_netrc` or `perm_2775_shared`. The\n" +
+		"mode is four octal digits and may include the setuid (`4000`), setgid\n" +
+		"(`2000`), and sticky (`1000`) bits. Explicit permissions are applied exactly and\n" +
+		"are not masked by your umask, and they take precedence over the `private_` and\n" +
+		"`executable_` prefixes and over the implicit privacy of encrypted files. `chezmoi\n" +
+		"add` adds a `perm_` prefix when the target's permissions differ from those that\n" +
+		"`private_`, `executable_`, and your umask would give.\n" +
+		"\n" +
+		"Files whose names must not change, for example because other tools read them\n" +
+		"directly from the source directory, can be templates without the `.tmpl` suffix\n" +
+		"by listing them in the `templateGlobs` config variable. Each glob is matched\n" +
+		"against the path of the file in the source directory, for example\n" +
+		"`dot_config/tool/*.conf`, and matching regular files and scripts are treated as\n" +
+		"if they had the `.tmpl` suffix. Use `chezmoi add --template --no-suffix` to add\n" +
+		"such files.\n" +
+		"\n" +
+		"`run_` scripts are written to a temporary file, which is only readable by you,\n" +
+		"and run from there. The file is removed after the script has run, even if it\n" +
+		"fails or chezmoi is interrupted. The file is written to `scripts.tempDir` if it\n" +
+		"is set, otherwise to the `chezmoi` directory in `$XDG_RUNTIME_DIR` if it is set,\n" +
+		"otherwise to the system's temporary directory. Directories that do not exist are\n" +
+		"created with permissions `0700`. If scripts cannot be run from this directory,\n" +
+		"for example because it is on a filesystem mounted with `noexec`, then chezmoi\n" +
+		"automatically retries from `$XDG_CACHE_HOME/chezmoi/scripts`. In verbose mode,\n" +
+		"chezmoi prints the path of each temporary script file.\n" +
+		"\n" +
+		"`run_before_` scripts are run before any files, directories, or symlinks are\n" +
+		"updated, and `run_after_` scripts are run after all of them have been updated.\n" +
+		"Other scripts are run in alphabetical order of their targets along with the\n" +
+		"other targets. `run_before_` scripts whose directories do not exist yet are run\n" +
+		"from their closest existing parent directory. Scripts are run with the\n" +
+		"environment variable `CHEZMOI_DEST_DIR` set to the destination directory.\n" +
+		"\n" +
+		"A `concat_` directory in the source state is not a directory in the target\n" +
+		"state, but a regular file whose contents are the contents of each file in the\n" +
+		"source directory concatenated in lexical order of their source names, for\n" +
+		"example `private_dot_ssh/concat_config/10-base` and\n" +
+		"`private_dot_ssh/concat_config/20-work.tmpl` for `~/.ssh/config`. Each file may\n" +
+		"be a template or encrypted. The target file's permissions are taken from the\n" +
+		"directory's `perm_` and `private_` prefixes, and the target file is private if\n" +
+		"any file is encrypted, as for `encrypted_` files. Files whose names begin with a\n" +
+		"`.` are ignored and subdirectories are not allowed. Adding or removing a file\n" +
+		"changes the target file.\n" +
+		"\n" +
+		"An `encrypted_` directory in the source state contains a single file, `bundle`,\n" +
+		"which is an encrypted tar archive of the target directory's contents, so the\n" +
+		"names of the files in the directory are not stored in the source state in\n" +
+		"plaintext. chezmoi decrypts and unpacks the bundle when it reads the source\n" +
+		"state, and the target directory's contents are then applied and diffed like any\n" +
+		"other targets. Use `chezmoi add --encrypt` to create or update the bundle and\n" +
+		"`chezmoi edit` to edit its contents. The bundle only contains the names,\n" +
+		"permissions, and contents of its files, directories, and symlinks, in lexical\n" +
+		"order, so that it only changes when they change. Adding a target inside an\n" +
+		"encrypted directory updates the whole bundle, and targets inside encrypted\n" +
+		"directories cannot be changed separately by `chattr`, `forget`, `merge`, or\n" +
+		"`remove`. Encrypted directories are private unless `encryption.private` is\n" +
+		"`false`.\n" +
+		"\n" +
+		"Order of prefixes is important, the order is `run_`, `concat_`, `exact_`,\n" +
+		"`modify_`, `link_`, `create_`, `encrypted_`, `perm_`, `private_`, `empty_`,\n" +
+		"`executable_`, `symlink_`, `once_`, `before_` or `after_`, `dot_`. For\n" +
+		"directories, `encrypted_` comes before `exact_`.\n" +
+		"\n" +
+		"It is an error for a file, symlink, or script to have the same target as a\n" +
+		"directory that contains managed targets, for example `symlink_dot_config` and\n" +
+		"`dot_config/git`, or `dot_config` in a later source directory and\n" +
+		"`dot_config/git` in an earlier one, as the directory's contents would be\n" +
+		"silently removed from the target state.\n" +
+		"\n" +
+		"A source name's attributes must be written in this order and must not conflict,\n" +
+		"so that chezmoi writes back exactly the source name that it reads. For example,\n" +
+		"`perm_0600_private_foo` and `run_after_once_foo` are errors: `perm_` already\n" +
+		"sets the permissions, so the source name must be `perm_0600_foo`, and `once_`\n" +
+		"must come before `after_`, so the source name must be `run_once_after_foo`. The\n" +
+		"error names the source file and the expected source name. Prefixes that appear\n" +
+		"out of order are part of the target's name, and `chezmoi add` refuses to add\n" +
+		"targets whose names would be read back as different names, for example a file\n" +
+		"called `private_foo` or `foo.tmpl`.\n" +
 		"\n" +
 		"Different target types allow different prefixes and suffixes:\n" +
 		"\n" +
-		"| Target type   | Allowed prefixes                                          | Allowed suffixes |\n" +
-		"| ------------- | --------------------------------------------------------- | ---------------- |\n" +
-		"| Directory     | `exact_`, `private_`, `dot_`                              | *none*           |\n" +
-		"| Regular file  | `encrypted_`, `private_`, `empty_`, `executable_`, `dot_` | `.tmpl`          |\n" +
-		"| Script        | `run_`, `once_`                                           | `.tmpl`          |\n" +
-		"| Symbolic link | `symlink_`, `dot_`,                                       | `.tmpl`          |\n" +
+		"| Target type   | Allowed prefixes                                                                                  | Allowed suffixes |\n" +
+		"| ------------- | ------------------------------------------------------------------------------------------------- | ---------------- |\n" +
+		"| Directory     | `concat_`, `encrypted_`, `exact_`, `perm_`, `private_`, `empty_`, `dot_`                          | *none*           |\n" +
+		"| Regular file  | `modify_`, `link_`, `create_`, `encrypted_`, `perm_`, `private_`, `empty_`, `executable_`, `dot_` | `.tmpl`          |\n" +
+		"| Script        | `run_`, `once_`, `before_`, `after_`                                                              | `.tmpl`          |\n" +
+		"| Symbolic link | `symlink_`, `dot_`,                                                                               | `.tmpl`          |\n" +
 		"\n" +
 		"## Special files and directories\n" +
 		"\n" +
@@ -1773,13 +2256,66 @@ func init() {
 		"\n" +
 		"If a file called `.chezmoi.<format>.tmpl` exists then `chezmoi init` will use it\n" +
 		"to create an initial config file. *format* must be one of the the supported\n" +
-		"config file formats.\n" +
+		"config file formats. The template is executed with the `.chezmoi` template\n" +
+		"variables and the `promptBool`, `promptInt`, and `promptString` template\n" +
+		"functions, and the result is written to `chezmoi.<format>` in the config\n" +
+		"directory and used for the rest of `chezmoi init`, for example by `--apply`.\n" +
+		"\n" +
+		"When `chezmoi init` is run again, the config file is kept unless the template\n" +
+		"has changed since the config file was generated, in which case chezmoi asks\n" +
+		"whether to regenerate it.\n" +
 		"\n" +
 		"#### `.chezmoi.<format>.tmpl` examples\n" +
 		"\n" +
 		"    {{ $email := promptString \"email\" -}}\n" +
+		"    {{ $work := promptBool \"work machine\" -}}\n" +
 		"    data:\n" +
 		"        email: \"{{ $email }}\"\n" +
+		"        work: {{ $work }}\n" +
+		"\n" +
+		"### `.chezmoidata.<format>`\n" +
+		"\n" +
+		"If a file called `.chezmoidata.<format>` exists in the source state then it is\n" +
+		"interpreted as template data in the given format. *format* must be one of\n" +
+		"`json`, `toml`, or `yaml`. If more than one exists then they are merged in that\n" +
+		"order.\n" +
+		"\n" +
+		"#### `.chezmoidata.<format>` examples\n" +
+		"\n" +
+		"    editor:\n" +
+		"      name: vim\n" +
+		"      plugins:\n" +
+		"      - fzf\n" +
+		"\n" +
+		"### `.chezmoidependencies`\n" +
+		"\n" +
+		"If a file called `.chezmoidependencies` exists in the source state then each of\n" +
+		"its lines declares the prerequisites of a target, which are applied before the\n" +
+		"target itself. Each line contains a target name, a colon, and the target names\n" +
+		"of its prerequisites separated by spaces. Scripts are named by their target\n" +
+		"names, without their `run_`, `once_`, `before_`, and `after_` attributes.\n" +
+		"\n" +
+		"Targets without dependencies are applied in the usual order. When a target is\n" +
+		"about to be applied, its prerequisites that have not been applied yet are\n" +
+		"applied first, after their parent directories are created. A script that is a\n" +
+		"prerequisite is run when it is needed, even if it has the `before_` or `after_`\n" +
+		"attribute. When applying only some targets, prerequisites that are not among\n" +
+		"them are not applied.\n" +
+		"\n" +
+		"Comments are introduced with the `#` character and run until the end of the\n" +
+		"line. `.chezmoidependencies` is interpreted as a template, and\n" +
+		"`.chezmoidependencies` files in subdirectories use target names relative to\n" +
+		"that subdirectory. Target names that are not in the target state are ignored.\n" +
+		"\n" +
+		"It is an error for the dependencies to contain a cycle, which is printed, or for\n" +
+		"a directory to depend on one of its contents. With `--verbose`, `chezmoi apply`\n" +
+		"prints the order in which targets with dependencies are applied.\n" +
+		"\n" +
+		"#### `.chezmoidependencies` examples\n" +
+		"\n" +
+		"    # Install asdf, then its plugins, before .tool-versions is used\n" +
+		"    .tool-versions: install-asdf.sh\n" +
+		"    install-plugins.sh: install-asdf.sh .tool-versions\n" +
 		"\n" +
 		"### `.chezmoiignore`\n" +
 		"\n" +
@@ -1818,14 +2354,57 @@ func init() {
 		"### `.chezmoiremove`\n" +
 		"\n" +
 		"If a file called `.chezmoiremove` exists in the source state then it is\n" +
-		"interpreted as a list of targets to remove. `.chezmoiremove` is interpreted as a\n" +
-		"template.\n" +
+		"interpreted as a list of patterns of targets to remove when `chezmoi apply` is\n" +
+		"run with `--remove`. `.chezmoiremove` is interpreted as a template and has the\n" +
+		"same syntax as `.chezmoiignore`. Matching files, symlinks, and directories,\n" +
+		"including their contents, are removed with the same mutator as other changes,\n" +
+		"so `--dry-run` and `--verbose` show what would be removed without removing it.\n" +
+		"\n" +
+		"Patterns that do not match any targets are ignored. Targets that are ignored,\n" +
+		"that are in the target state, or that are outside the destination directory\n" +
+		"are never removed.\n" +
+		"\n" +
+		"#### `.chezmoiremove` examples\n" +
+		"\n" +
+		"    .old-config\n" +
+		"    .cache/oldapp/**\n" +
+		"    {{- if ne .chezmoi.os \"darwin\" }}\n" +
+		"    .hammerspoon\n" +
+		"    {{- end }}\n" +
+		"\n" +
+		"### `.chezmoiroot`\n" +
+		"\n" +
+		"If a file called `.chezmoiroot` exists at the top of the source directory then\n" +
+		"its contents are interpreted as a relative path to a subdirectory of the source\n" +
+		"directory that contains the source state. This is useful when your dotfiles are\n" +
+		"only part of a larger repo. The path must not refer to a directory outside the\n" +
+		"source directory.\n" +
+		"\n" +
+		"All other special files, for example `.chezmoiignore` and\n" +
+		"`.chezmoidata.<format>`, are read from the subdirectory, `source-path` and\n" +
+		"`.chezmoi.sourceDir` refer to the subdirectory, and new targets are added to the\n" +
+		"subdirectory. Version control commands, for example `update`, `cd`, `git`, and\n" +
+		"automatic commits, continue to run at the top of the source directory.\n" +
+		"\n" +
+		"#### `.chezmoiroot` examples\n" +
+		"\n" +
+		"    home\n" +
 		"\n" +
 		"### `.chezmoitemplates`\n" +
 		"\n" +
-		"If a directory called `.chezmoitemplates` exists, then all files in this\n" +
-		"directory are parsed as templates are available as templates with a name equal\n" +
-		"to the relative path of the file.\n" +
+		"If a directory called `.chezmoitemplates` exists at the root of the source\n" +
+		"directory, then all files in this directory, including those in subdirectories,\n" +
+		"are parsed as templates and are available as templates with a name equal to the\n" +
+		"relative path of the file, for example `shell/aliases`. Templates in\n" +
+		"`.chezmoitemplates` can use all template functions, and are loaded before any\n" +
+		"other templates are executed, so they can also be used in `.chezmoiignore` and\n" +
+		"`.chezmoiremove`. If there are multiple source directories, templates in later\n" +
+		"source directories override templates with the same name in earlier ones.\n" +
+		"\n" +
+		"Templates in `.chezmoitemplates` are executed with `template` or\n" +
+		"[`includeTemplate`](#includetemplate-name-data). As they are part of the target\n" +
+		"state of the templates that use them, changing a template in\n" +
+		"`.chezmoitemplates` changes the targets that use it.\n" +
 		"\n" +
 		"#### `.chezmoitemplates` examples\n" +
 		"\n" +
@@ -1839,6 +2418,21 @@ func init() {
 		"\n" +
 		"The target state of `.config` will be `bar`.\n" +
 		"\n" +
+		"Given:\n" +
+		"\n" +
+		"    .chezmoitemplates/shell/aliases\n" +
+		"    alias ll='ls -l'\n" +
+		"    {{ if eq .shell \"zsh\" }}alias -g L='| less'{{ end }}\n" +
+		"\n" +
+		"    dot_bashrc.tmpl\n" +
+		"    {{ includeTemplate \"shell/aliases\" (dict \"shell\" \"bash\") }}\n" +
+		"\n" +
+		"    dot_zshrc.tmpl\n" +
+		"    {{ includeTemplate \"shell/aliases\" (dict \"shell\" \"zsh\") }}\n" +
+		"\n" +
+		"The target state of `.bashrc` will contain only the `ll` alias, and the target\n" +
+		"state of `.zshrc` will contain both aliases.\n" +
+		"\n" +
 		"### `.chezmoiversion`\n" +
 		"\n" +
 		"If a file called `.chezmoiversion` exists, then its contents are interpreted as\n" +
@@ -1855,11 +2449,35 @@ func init() {
 		"\n" +
 		"## Commands\n" +
 		"\n" +
+		"Commands that take *targets* also accept glob patterns, which are expanded\n" +
+		"against the managed targets rather than the filesystem. Patterns use the syntax\n" +
+		"of [`doublestar.PathMatch`](https://pkg.go.dev/github.com/bmatcuk/doublestar?tab=doc#PathMatch)\n" +
+		"and should be quoted to prevent the shell from expanding them. A pattern that\n" +
+		"matches no managed targets is an error. Matching targets are sorted\n" +
+		"alphabetically.\n" +
+		"\n" +
 		"### `add` *targets*\n" +
 		"\n" +
 		"Add *targets* to the source state. If any target is already in the source state,\n" +
 		"then its source state is replaced with its current state in the destination\n" +
-		"directory. The `add` command accepts additional flags:\n" +
+		"directory.\n" +
+		"\n" +
+		"Before adding a file, chezmoi checks whether it is likely to contain secrets in\n" +
+		"plaintext, either because its path is one that usually contains secrets (for\n" +
+		"example `~/.netrc`, `~/.aws/credentials`, or `~/.ssh/id_rsa`) or because its\n" +
+		"contents contain an AWS access key ID, a private key, or a password. If so,\n" +
+		"chezmoi prints what it found, including line numbers, and prompts before adding\n" +
+		"the file. Consider using `--encrypt` or a template that reads the secret from\n" +
+		"your password manager instead. Files added with `--encrypt`, and files added as\n" +
+		"templates that already contain template actions, are not checked. The check can\n" +
+		"be disabled with `--no-secret-check` or by setting `add.secretCheck` to `false`\n" +
+		"in your config file.\n" +
+		"\n" +
+		"Any parent directories of *targets* that are not yet in the source state are\n" +
+		"added too, with attributes that match their current state, for example\n" +
+		"`private_` if they are only accessible by you, but never `exact_`.\n" +
+		"\n" +
+		"The `add` command accepts additional flags:\n" +
 		"\n" +
 		"#### `--autotemplate`\n" +
 		"\n" +
@@ -1867,25 +2485,60 @@ func init() {
 		"the `data` section of the config file. Longer subsitutions occur before shorter\n" +
 		"ones. This implies the `--template` option.\n" +
 		"\n" +
+		"#### `--create`\n" +
+		"\n" +
+		"Set the `create` attribute on added files, so that they are only written if\n" +
+		"their targets do not exist.\n" +
+		"\n" +
 		"#### `-e`, `--empty`\n" +
 		"\n" +
 		"Set the `empty` attribute on added files.\n" +
 		"\n" +
+		"#### `--encrypt`\n" +
+		"\n" +
+		"Encrypt files using the tool set by `encryption.method`, either GPG or age, and\n" +
+		"set the `encrypted` attribute on them. Unless\n" +
+		"`encryption.private` is `false`, the `private` attribute is also set.\n" +
+		"Directories are added as encrypted directories, whose contents are stored in a\n" +
+		"single encrypted bundle.\n" +
+		"\n" +
 		"#### `-f`, `--force`\n" +
 		"\n" +
-		"Add *targets*, even if doing so would cause a source template to be overwritten.\n" +
+		"Add *targets*, even if doing so would cause a source template or `modify_`\n" +
+		"script to be overwritten.\n" +
 		"\n" +
 		"#### `-x`, `--exact`\n" +
 		"\n" +
 		"Set the `exact` attribute on added directories.\n" +
 		"\n" +
-		"#### `-p`, `--prompt`\n" +
+		"#### `--no-secret-check`\n" +
+		"\n" +
+		"Do not check added files for secrets in plaintext.\n" +
+		"\n" +
+		"#### `--no-suffix`\n" +
 		"\n" +
-		"Interactively prompt before adding each file.\n" +
+		"With `--template`, add templates without the `.tmpl` suffix. The file's path in\n" +
+		"the source directory must match one of the globs in `templateGlobs`, otherwise\n" +
+		"it would not be treated as a template.\n" +
+		"\n" +
+		"#### `-i`, `--interactive`, `-p`, `--prompt`\n" +
+		"\n" +
+		"Interactively prompt before adding each file found in *targets*. Answer `y` to\n" +
+		"add the file, `n` to skip it, `q` to stop, keeping the files that were already\n" +
+		"added, or `a` to add it and all the remaining files without prompting.\n" +
+		"Directories are added, with the same flags, when the first file inside them is\n" +
+		"chosen, so directories that contain no chosen files, including empty\n" +
+		"directories, are not added. Other flags, like `--template` and `--encrypt`,\n" +
+		"apply to each file that is added. With\n" +
+		"`--dry-run`, chezmoi prompts but does not add anything.\n" +
 		"\n" +
 		"#### `-r`, `--recursive`\n" +
 		"\n" +
-		"Recursively add all files, directories, and symlinks.\n" +
+		"Recursively add all files, directories, and symlinks in directories. This is\n" +
+		"the default. With `--recursive=false`, only the directories themselves are\n" +
+		"added, each with a `.keep` file. Files and directories that are ignored by\n" +
+		"`.chezmoiignore` are skipped, and the contents of ignored directories are never\n" +
+		"added.\n" +
 		"\n" +
 		"#### `-T`, `--template`\n" +
 		"\n" +
@@ -1895,38 +2548,243 @@ func init() {
 		"\n" +
 		"    chezmoi add ~/.bashrc\n" +
 		"    chezmoi add ~/.gitconfig --template\n" +
-		"    chezmoi add ~/.vim --recursive\n" +
-		"    chezmoi add ~/.oh-my-zsh --exact --recursive\n" +
+		"    chezmoi add ~/.vim\n" +
+		"    chezmoi add ~/.oh-my-zsh --exact\n" +
+		"    chezmoi add ~/.config --recursive=false\n" +
+		"    chezmoi add ~/.config/fish --interactive\n" +
 		"\n" +
 		"### `apply` [*targets*]\n" +
 		"\n" +
 		"Ensure that *targets* are in the target state, updating them if necessary. If no\n" +
 		"targets are specified, the state of all targets are ensured.\n" +
 		"\n" +
+		"If all *targets* are absolute paths, or relative paths with\n" +
+		"`--relative-to-dest`, and none are globs, then only the parts of the source\n" +
+		"state that contain *targets* are read, which is faster for large source states.\n" +
+		"The same applies to `chezmoi diff` and `chezmoi verify`.\n" +
+		"\n" +
+		"Files larger than 16MB that are neither templates nor encrypted are streamed\n" +
+		"instead of being read into memory. An existing target of the same size is\n" +
+		"compared by hashing the contents of both, and is only rewritten if they differ.\n" +
+		"Such files are also streamed into archives by `chezmoi archive`, and `chezmoi\n" +
+		"diff` shows only that their contents changed.\n" +
+		"\n" +
+		"The progress of each apply is recorded in the persistent state, and cleared when\n" +
+		"the apply succeeds.\n" +
+		"\n" +
+		"When no targets are specified, the targets applied are also recorded in the\n" +
+		"persistent state, separately for each destination directory. The next time that\n" +
+		"all targets are applied, chezmoi offers to remove targets that were applied\n" +
+		"before but that have since been removed from the source state. Answering `n`\n" +
+		"keeps the target and stops tracking it. Targets that are ignored by\n" +
+		"`.chezmoiignore` are not treated as removed, and directories are only removed\n" +
+		"if they are empty. In dry run mode, and so in `chezmoi diff`, removed targets\n" +
+		"are shown without prompting.\n" +
+		"\n" +
+		"If `apply.backup` is `true`, the previous state of every target that is changed\n" +
+		"or removed is copied to a new subdirectory of `apply.backupDir`, named after\n" +
+		"the time that the apply started, with the same relative path and mode. Backups\n" +
+		"of private targets are never readable by group or others, and `apply.backupDir`\n" +
+		"is created private if it does not already exist. Only the most recent\n" +
+		"`apply.backupKeep` backups are kept, unless it is `0`, in which case all backups\n" +
+		"are kept. Only subdirectories of `apply.backupDir` named like backups are ever\n" +
+		"removed. The default backup directory is `chezmoi/backup` in `$XDG_CACHE_HOME`.\n" +
+		"\n" +
+		"Targets with the immutable flag set, with `chattr +i` on Linux or `chflags\n" +
+		"uchg` on macOS and BSD, cannot be modified, and chezmoi reports the command to\n" +
+		"clear the flag. If `apply.clearImmutable` is `true` then chezmoi instead clears\n" +
+		"the flag, modifies the target, and sets the flag again. Clearing the immutable\n" +
+		"flag on Linux requires root. Reading such targets, for example with `chezmoi\n" +
+		"diff` or `chezmoi verify`, is not affected.\n" +
+		"\n" +
+		"#### `--allow-scripts`\n" +
+		"\n" +
+		"Allow scripts from the repo given with `--remote` to run. Without this flag,\n" +
+		"`chezmoi apply --remote` fails before making any changes if the remote source\n" +
+		"state contains any scripts.\n" +
+		"\n" +
+		"#### `--branch` *branch*, `--depth` *depth*\n" +
+		"\n" +
+		"Clone *branch* of the repo given with `--remote`, and create a shallow clone\n" +
+		"with a history truncated to *depth* commits. Only supported by git.\n" +
+		"\n" +
+		"#### `--exclude` *types-or-pattern*\n" +
+		"\n" +
+		"Exclude entries as for [`archive`](#archive). This flag can be repeated.\n" +
+		"\n" +
+		"#### `--exclude-encrypted`\n" +
+		"\n" +
+		"Skip encrypted files and directories, without decrypting them, and print the\n" +
+		"number of targets skipped. This is useful on machines without the decryption\n" +
+		"key. Targets inside skipped encrypted directories are not pruned. This can also\n" +
+		"be set with the `encryption.exclude` configuration variable, and combines with\n" +
+		"`--exclude` and `--include`. Without it, failing to decrypt a file is an error.\n" +
+		"\n" +
+		"#### `-i`, `--include` *types*\n" +
+		"\n" +
+		"Only apply entries of type *types*, as for [`archive`](#archive). Directories\n" +
+		"that contain included entries are still created, so, for example, `chezmoi\n" +
+		"apply --include=files,symlinks` populates a new home directory without running\n" +
+		"any scripts, and `chezmoi apply --include=scripts` only runs scripts.\n" +
+		"\n" +
+		"#### `--log-file` *filename*\n" +
+		"\n" +
+		"Append a log of the operations performed to *filename*, which is created if it\n" +
+		"does not exist. Each operation is logged as soon as it is performed, so the log\n" +
+		"is complete up to the point of any crash. Entries record the time, the action,\n" +
+		"the target path, the old and new modes, the name and exit status of any script,\n" +
+		"and whether chezmoi is in dry run mode. File contents are never logged, only\n" +
+		"their sizes and SHA256 hashes.\n" +
+		"\n" +
+		"#### `--log-format` *format*\n" +
+		"\n" +
+		"Set the format of the log written with `--log-file`. The only supported format\n" +
+		"is `json`, which writes one JSON object per line.\n" +
+		"\n" +
+		"#### `--no-backup`\n" +
+		"\n" +
+		"Do not back up targets, even if `apply.backup` is set.\n" +
+		"\n" +
+		"#### `--no-prune`\n" +
+		"\n" +
+		"Do not remove targets that have been removed from the source state. They are\n" +
+		"still tracked, so they can be removed by a later apply.\n" +
+		"\n" +
+		"#### `--prune`\n" +
+		"\n" +
+		"Remove targets that have been removed from the source state without prompting.\n" +
+		"\n" +
+		"#### `--remote` *repo*\n" +
+		"\n" +
+		"Clone *repo* into a temporary directory and use it as the source directory\n" +
+		"instead of the configured source directories. The temporary directory is\n" +
+		"removed afterwards, even if an error occurs. The persistent state is not read\n" +
+		"or written, so `run_once_` scripts are always run. Because the remote repo is\n" +
+		"untrusted, the template functions that read secrets are disabled and scripts are\n" +
+		"not run unless `--trust` or `--allow-scripts` is also given.\n" +
+		"\n" +
+		"#### `--resume`\n" +
+		"\n" +
+		"Skip targets that were already applied by the previous apply, if it failed or\n" +
+		"was interrupted and neither the source state nor the template data have changed\n" +
+		"since. Resuming avoids decrypting files and checking scripts again. The progress\n" +
+		"of an interrupted apply is recorded every 100 targets, so up to the last 99\n" +
+		"targets that it applied are applied again.\n" +
+		"\n" +
+		"#### `--rewrite-symlinks`\n" +
+		"\n" +
+		"With `--to`, rewrite the targets of symlinks that are absolute paths inside the\n" +
+		"configured destination directory to the same paths inside *dir*.\n" +
+		"\n" +
+		"#### `--symlink`\n" +
+		"\n" +
+		"Apply plain files as symbolic links to their files in the source directory, as\n" +
+		"if they had the `link_` prefix, instead of copying them. Templates, encrypted\n" +
+		"files, and files that are private, executable, have explicit permissions, or\n" +
+		"are empty without the `empty_` prefix are still applied as regular files, as\n" +
+		"their targets' contents or permissions would differ from their source files.\n" +
+		"Applying with and without `--symlink` replaces regular files with symbolic\n" +
+		"links and vice versa, so `chezmoi apply --dry-run --verbose` shows the change.\n" +
+		"This can also be set with the `symlink` configuration variable.\n" +
+		"\n" +
+		"#### `--to` *dir*\n" +
+		"\n" +
+		"Apply the target state to *dir*, which is created if it does not exist, instead\n" +
+		"of the configured destination directory, for example to inspect a fresh home\n" +
+		"directory before switching to it. Scripts are not run, and the persistent state\n" +
+		"of each *dir*, including the progress of the apply, the applied targets, and\n" +
+		"which `run_once_` scripts have been run, is kept separately from the persistent\n" +
+		"state of the destination directory.\n" +
+		"\n" +
+		"#### `--trust`\n" +
+		"\n" +
+		"Trust the source repo without asking, if it was cloned from a repo that is not\n" +
+		"trusted, or the repo given with `--remote`. See `chezmoi init`.\n" +
+		"\n" +
+		"#### `--with-scripts`\n" +
+		"\n" +
+		"With `--to`, run scripts. Scripts can use the `CHEZMOI_DEST_DIR` environment\n" +
+		"variable to find *dir*.\n" +
+		"\n" +
 		"#### `apply` examples\n" +
 		"\n" +
 		"    chezmoi apply\n" +
 		"    chezmoi apply --dry-run --verbose\n" +
 		"    chezmoi apply ~/.bashrc\n" +
+		"    chezmoi apply --resume\n" +
+		"    chezmoi apply --no-backup\n" +
+		"    chezmoi apply --include=files,symlinks\n" +
+		"    chezmoi apply --log-file ~/chezmoi.log\n" +
+		"    chezmoi apply --remote https://github.com/user/dotfiles.git\n" +
+		"    chezmoi apply --to /tmp/home --rewrite-symlinks\n" +
 		"\n" +
 		"### `archive`\n" +
 		"\n" +
-		"Write a tar archive of the target state to stdout. This can be piped into `tar`\n" +
-		"to inspect the target state.\n" +
+		"Write a tar or zip archive of the target state to stdout. This can be piped into\n" +
+		"`tar` to inspect the target state. Files and directories in the archive have the same\n" +
+		"permissions, including the setgid and sticky bits, as `chezmoi apply` would give\n" +
+		"them, taking `umask` into account.\n" +
+		"\n" +
+		"Encrypted files are not decrypted. By default, their ciphertext is included with\n" +
+		"their source names, for example `.ssh/encrypted_private_id_rsa`. Set\n" +
+		"`encryption.export` to `skip` to omit them entirely.\n" +
+		"\n" +
+		"#### `--decrypt`\n" +
+		"\n" +
+		"Include the decrypted contents of encrypted files with their target names, for\n" +
+		"an intentional full export of the target state including secrets.\n" +
+		"\n" +
+		"#### `--exclude` *types-or-pattern*\n" +
+		"\n" +
+		"Exclude entries of type *types*, or targets matching *pattern* and everything\n" +
+		"inside them. The types are the same as for `--include`. To exclude a target\n" +
+		"whose name is a type, give its path, for example `./scripts`. This flag can be\n" +
+		"repeated.\n" +
+		"\n" +
+		"#### `-f`, `--format` *format*\n" +
+		"\n" +
+		"Write the archive in the given format. The accepted formats are `tar` (the\n" +
+		"default) and `zip`. Symlinks in zip archives are stored with their Unix mode\n" +
+		"bits and the link target as their contents.\n" +
+		"\n" +
+		"#### `-z`, `--gzip`\n" +
+		"\n" +
+		"Compress the tar archive with gzip. This cannot be used with `--format=zip`.\n" +
+		"\n" +
+		"#### `-i`, `--include` *types*\n" +
+		"\n" +
+		"Only include entries of type *types*. *types* is a comma-separated list of types\n" +
+		"of entry to include. Valid types are `dirs`, `files`, `symlinks`, and `scripts`,\n" +
+		"the first three of which can be abbreviated to `d`, `f`, and `s` respectively,\n" +
+		"and `all`, which is the default. Directories are included if they contain\n" +
+		"included entries, even if `dirs` is not included. Directories whose entries are\n" +
+		"all excluded are omitted.\n" +
+		"\n" +
+		"#### `-o`, `--output` *filename*\n" +
+		"\n" +
+		"Write the archive to *filename* instead of stdout. Archives written with\n" +
+		"`--decrypt` are only readable by the current user.\n" +
 		"\n" +
 		"#### `archive` examples\n" +
 		"\n" +
 		"    chezmoi archive | tar tvf -\n" +
+		"    chezmoi archive --decrypt > full.tar\n" +
+		"    chezmoi archive --include=files,symlinks > image.tar\n" +
+		"    chezmoi archive --format=zip --output=dotfiles.zip\n" +
+		"    chezmoi archive --gzip --output=dotfiles.tar.gz\n" +
 		"\n" +
 		"### `cat` targets\n" +
 		"\n" +
-		"Write the target state of *targets*  to stdout. *targets* must be files or\n" +
-		"symlinks. For files, the target file contents are written. For symlinks, the\n" +
-		"target target is written.\n" +
+		"Write the target state of *targets* to stdout, without reading or changing the\n" +
+		"destination directory. *targets* must be files or symlinks. For files, the\n" +
+		"target file contents are written, after executing templates and decrypting\n" +
+		"encrypted files. For symlinks, the link target is written, followed by a\n" +
+		"newline. This is useful for debugging templates.\n" +
 		"\n" +
 		"#### `cat` examples\n" +
 		"\n" +
 		"    chezmoi cat ~/.bashrc\n" +
+		"    chezmoi cat ~/.gitconfig ~/.ssh/config\n" +
 		"\n" +
 		"### `cd`\n" +
 		"\n" +
@@ -1952,6 +2810,7 @@ func init() {
 		"| `encrypted`  | *none*       |\n" +
 		"| `exact`      | *none*       |\n" +
 		"| `executable` | `x`          |\n" +
+		"| `link`       | `l`          |\n" +
 		"| `private`    | `p`          |\n" +
 		"| `template`   | `t`          |\n" +
 		"\n" +
@@ -1963,20 +2822,44 @@ func init() {
 		"    chezmoi chattr template ~/.bashrc\n" +
 		"    chezmoi chattr noempty ~/.profile\n" +
 		"    chezmoi chattr private,template ~/.netrc\n" +
+		"    chezmoi chattr link ~/.vimrc\n" +
 		"\n" +
 		"### `completion` *shell*\n" +
 		"\n" +
-		"Generate shell completion code for the specified shell (`bash`, `fish`, or\n" +
-		"`zsh`).\n" +
+		"Generate shell completion code for the specified shell (`bash`, `fish`,\n" +
+		"`powershell`, or `zsh`).\n" +
+		"\n" +
+		"The generated code calls chezmoi to complete the values of flags that accept a\n" +
+		"fixed set of values, for example `--color`, `--format`, and `--include`, so it\n" +
+		"does not need to be regenerated when chezmoi is upgraded.\n" +
+		"\n" +
+		"#### `-f`, `--force`\n" +
+		"\n" +
+		"With `--install`, overwrite an existing completion file even if it is different.\n" +
+		"\n" +
+		"#### `--install`\n" +
+		"\n" +
+		"Write the shell completion code to the conventional per-user location for\n" +
+		"*shell* and print what was done. An existing file with different contents is\n" +
+		"not overwritten unless `--force` is also given.\n" +
+		"\n" +
+		"| Shell        | Location                                                                                                 |\n" +
+		"| ------------ | -------------------------------------------------------------------------------------------------------- |\n" +
+		"| `bash`       | `$XDG_DATA_HOME/bash-completion/completions/chezmoi`                                                     |\n" +
+		"| `fish`       | `$XDG_CONFIG_HOME/fish/completions/chezmoi.fish`                                                         |\n" +
+		"| `powershell` | `chezmoi-completion.ps1` in the PowerShell profile directory, which must be dot-sourced from the profile |\n" +
+		"| `zsh`        | `~/.zsh/completions/_chezmoi`, which must be in `fpath`                                                  |\n" +
 		"\n" +
 		"#### `--output`, `-o` *filename*\n" +
 		"\n" +
-		"Write the shell completion code to *filename* instead of stdout.\n" +
+		"Write the shell completion code to *filename* instead of stdout, creating any\n" +
+		"parent directories.\n" +
 		"\n" +
 		"#### `completion` examples\n" +
 		"\n" +
 		"    chezmoi completion bash\n" +
 		"    chezmoi completion fish --output ~/.config/fish/completions/chezmoi.fish\n" +
+		"    chezmoi completion zsh --install\n" +
 		"\n" +
 		"### `data`\n" +
 		"\n" +
@@ -1988,10 +2871,26 @@ func init() {
 		"Print the computed template data in the given format. The accepted formats are\n" +
 		"`json` (JSON), `toml` (TOML), and `yaml` (YAML).\n" +
 		"\n" +
+		"#### `--origins`\n" +
+		"\n" +
+		"Replace each value in the template data with a map containing the value, as\n" +
+		"`value`, and where it came from, as `origin`. The origin is `default` for\n" +
+		"chezmoi's default data, or the path of the `.chezmoidata` file or config file\n" +
+		"that set the value.\n" +
+		"\n" +
+		"#### `--resolve` *key*\n" +
+		"\n" +
+		"Print every origin that defines *key*, for example `editor.font.size`, and its\n" +
+		"value, one per line in decreasing order of precedence. The origin whose value\n" +
+		"is used is marked with a `*`. No origin is marked if the value has been\n" +
+		"discarded because the top-level key's merge mode is `replace`.\n" +
+		"\n" +
 		"#### `data` examples\n" +
 		"\n" +
 		"    chezmoi data\n" +
 		"    chezmoi data --format=yaml\n" +
+		"    chezmoi data --origins\n" +
+		"    chezmoi data --resolve editor.font.size\n" +
 		"\n" +
 		"### `diff` [*targets*]\n" +
 		"\n" +
@@ -2001,6 +2900,19 @@ func init() {
 		"If a `diff.pager` command is set in the configuration file then the output will\n" +
 		"be piped into it.\n" +
 		"\n" +
+		"#### `--branch` *branch*, `--depth` *depth*\n" +
+		"\n" +
+		"Clone *branch* of the repo given with `--remote`, and create a shallow clone\n" +
+		"with a history truncated to *depth* commits. Only supported by git.\n" +
+		"\n" +
+		"#### `--exclude` *types-or-pattern*\n" +
+		"\n" +
+		"Exclude entries as for [`archive`](#archive). This flag can be repeated.\n" +
+		"\n" +
+		"#### `--exclude-encrypted`\n" +
+		"\n" +
+		"Skip encrypted targets, as for [`apply`](#apply-targets).\n" +
+		"\n" +
 		"#### `-f`, `--format` *format*\n" +
 		"\n" +
 		"Print the diff in *format*. The format can be set with the `diff.format`\n" +
@@ -2008,8 +2920,7 @@ func init() {
 		"\n" +
 		"##### `chezmoi`\n" +
 		"\n" +
-		"A mix of unified diffs and pseudo shell commands, including scripts, equivalent\n" +
-		"to `chezmoi apply --dry-run --verbose`.\n" +
+		"A mix of unified diffs and pseudo shell commands, including scripts.\n" +
 		"\n" +
 		"##### `git`\n" +
 		"\n" +
@@ -2017,15 +2928,59 @@ func init() {
 		"version 2.0.0 of chezmoi, `git` format diffs will become the default and include\n" +
 		"scripts and the `chezmoi` format will be removed.\n" +
 		"\n" +
+		"#### `-i`, `--include` *types*\n" +
+		"\n" +
+		"Only include entries of type *types* in the diff, as for\n" +
+		"[`archive`](#archive).\n" +
+		"\n" +
 		"#### `--no-pager`\n" +
 		"\n" +
 		"Do not use the pager.\n" +
 		"\n" +
+		"#### `--remote` *repo*\n" +
+		"\n" +
+		"Compute the target state from a temporary clone of *repo* instead of from the\n" +
+		"source directory, without reading the persistent state or changing the source\n" +
+		"directory. The temporary clone is removed afterwards, even if an error occurs.\n" +
+		"Scripts are never run. As for [`apply`](#apply-targets), the remote repo is\n" +
+		"untrusted, so the template functions that read secrets are disabled unless\n" +
+		"`--trust` is also given. `--remote` cannot be combined with `--revision`.\n" +
+		"\n" +
+		"#### `-r`, `--revision` *revision*\n" +
+		"\n" +
+		"Compute the target state from the source directory at *revision*, as understood\n" +
+		"by the source version control system, instead of from the working copy. The\n" +
+		"source directory at *revision* is extracted into a temporary directory that is\n" +
+		"removed afterwards. The template data are the same as for the working copy. For\n" +
+		"example, use `chezmoi diff --revision origin/master` to see what `chezmoi\n" +
+		"update` would change.\n" +
+		"\n" +
+		"#### `--stat`\n" +
+		"\n" +
+		"Instead of the full diff, print one line per changed target with the number of\n" +
+		"lines added and removed, followed by the totals, like `git diff --stat`. Binary\n" +
+		"files are marked `Bin` with their sizes before and after, and scripts that would\n" +
+		"be run are marked `script`. The lines fit the width of the terminal, or 80\n" +
+		"columns if the output is not a terminal. The summary is not piped into the\n" +
+		"pager and `--format` is ignored.\n" +
+		"\n" +
+		"#### `--symlink`\n" +
+		"\n" +
+		"Compare plain files as symbolic links, as for [`apply`](#apply-targets).\n" +
+		"\n" +
+		"#### `--trust`\n" +
+		"\n" +
+		"Trust the repo given with `--remote`, so that its templates can read secrets.\n" +
+		"\n" +
 		"#### `diff` examples\n" +
 		"\n" +
 		"    chezmoi diff\n" +
 		"    chezmoi diff ~/.bashrc\n" +
+		"    chezmoi diff --include=scripts\n" +
 		"    chezmoi diff --format=git\n" +
+		"    chezmoi diff --revision HEAD~3\n" +
+		"    chezmoi diff --stat\n" +
+		"    chezmoi diff --remote https://github.com/user/dotfiles.git --depth 1\n" +
 		"\n" +
 		"### `docs` [*regexp*]\n" +
 		"\n" +
@@ -2040,7 +2995,14 @@ func init() {
 		"\n" +
 		"### `doctor`\n" +
 		"\n" +
-		"Check for potential problems.\n" +
+		"Check for potential problems and print the result of each check, prefixed with\n" +
+		"`ok`, `warning`, or `ERROR`. The checks include whether the config file could\n" +
+		"be read and parsed, whether the source directory exists and is private, and\n" +
+		"whether the configured shell, editor, merge command, source VCS command, GnuPG\n" +
+		"command, and secret manager CLIs are installed, and their versions. It also\n" +
+		"checks that the config file and persistent state file are owned by you, or by\n" +
+		"the user who ran `sudo`. `chezmoi doctor` exits with status 1 if any check is an\n" +
+		"error.\n" +
 		"\n" +
 		"#### `doctor` examples\n" +
 		"\n" +
@@ -2056,34 +3018,81 @@ func init() {
 		"Print the target state in the given format. The accepted formats are `json`\n" +
 		"(JSON) and `yaml` (YAML).\n" +
 		"\n" +
+		"#### `--decrypt`\n" +
+		"\n" +
+		"Include the decrypted contents of encrypted files. Without this flag, encrypted\n" +
+		"files are handled the same way as by [`archive`](#archive).\n" +
+		"\n" +
+		"#### `--exclude` *types-or-pattern*\n" +
+		"\n" +
+		"Exclude entries as for [`archive`](#archive).\n" +
+		"\n" +
+		"#### `-i`, `--include` *types*\n" +
+		"\n" +
+		"Only include entries of type *types*, as for [`archive`](#archive). Excluded\n" +
+		"entries are omitted from the output.\n" +
+		"\n" +
 		"#### `dump` examples\n" +
 		"\n" +
 		"    chezmoi dump ~/.bashrc\n" +
 		"    chezmoi dump --format=yaml\n" +
 		"\n" +
+		"### `dump-config`\n" +
+		"\n" +
+		"Write the configuration, as read from the config file and set by command line\n" +
+		"flags, to stdout. The output can be used as a config file.\n" +
+		"\n" +
+		"#### `-f`, `--format` *format*\n" +
+		"\n" +
+		"Print the configuration in the given format. The accepted formats are `json`,\n" +
+		"`toml`, and `yaml`.\n" +
+		"\n" +
+		"#### `dump-config` examples\n" +
+		"\n" +
+		"    chezmoi dump-config\n" +
+		"    chezmoi dump-config --format=toml > chezmoi.toml\n" +
+		"\n" +
 		"### `edit` [*targets*]\n" +
 		"\n" +
-		"Edit the source state of *targets*, which must be files or symlinks. If no\n" +
-		"targets are given the the source directory itself is opened with `$EDITOR`. The\n" +
+		"Edit the source state of *targets*, which must be files, symlinks, or encrypted\n" +
+		"directories. Encrypted files and directories are decrypted to a private\n" +
+		"temporary directory, in `$XDG_RUNTIME_DIR` or `/dev/shm` if possible so that\n" +
+		"their plaintext is not written to disk, before they are opened, and encrypted\n" +
+		"again after the editor exits. Encrypted files whose plaintext did not change are\n" +
+		"not encrypted again, so their ciphertext does not change. Encrypted templates\n" +
+		"are decrypted but not executed, so the template itself is edited. The temporary\n" +
+		"directory is always removed afterwards. If no targets\n" +
+		"are given the the source directory itself is opened with `$EDITOR`. The\n" +
 		"`edit` command accepts additional arguments:\n" +
 		"\n" +
 		"#### `-a`, `--apply`\n" +
 		"\n" +
-		"Apply target immediately after editing. Ignored if there are no targets.\n" +
+		"Apply the edited targets once the editor exits successfully, as `chezmoi apply`\n" +
+		"*targets* would, without prompting unless `--prompt` is given. Only targets that\n" +
+		"would change are applied, and `--dry-run` is respected. Ignored if there are no\n" +
+		"targets.\n" +
 		"\n" +
 		"#### `-d`, `--diff`\n" +
 		"\n" +
-		"Print the difference between the target state and the actual state after\n" +
-		"editing.. Ignored if there are no targets.\n" +
+		"Print the difference between the target state and the actual state of the\n" +
+		"edited targets once the editor exits successfully. Without `--apply`, nothing is\n" +
+		"applied. Ignored if there are no targets.\n" +
+		"\n" +
+		"#### `--exclude` *pattern*\n" +
+		"\n" +
+		"Exclude targets matching *pattern*. This flag can be repeated.\n" +
 		"\n" +
 		"#### `-p`, `--prompt`\n" +
 		"\n" +
-		"Prompt before applying each target.. Ignored if there are no targets.\n" +
+		"Prompt before applying each target. Implies `--diff`. Ignored if there are no\n" +
+		"targets.\n" +
 		"\n" +
 		"#### `edit` examples\n" +
 		"\n" +
 		"    chezmoi edit ~/.bashrc\n" +
 		"    chezmoi edit ~/.bashrc --apply --prompt\n" +
+		"    chezmoi edit ~/.zshrc ~/.zprofile --apply\n" +
+		"    chezmoi edit ~/.config/zsh/'*.zsh'\n" +
 		"    chezmoi edit\n" +
 		"\n" +
 		"### `edit-config`\n" +
@@ -2116,20 +3125,86 @@ func init() {
 		"`promptString` is called with a *prompt* that does not match any of *pairs*,\n" +
 		"then it returns *prompt* unchanged.\n" +
 		"\n" +
+		"#### `--promptBool` *pairs*\n" +
+		"\n" +
+		"Simulate the `promptBool` function with a function that returns values from\n" +
+		"*pairs*, parsed with\n" +
+		"[`strconv.ParseBool`](https://pkg.go.dev/strconv?tab=doc#ParseBool). If\n" +
+		"`promptBool` is called with a *prompt* that does not match any of *pairs*, then\n" +
+		"it returns `false`.\n" +
+		"\n" +
+		"#### `--promptInt` *pairs*\n" +
+		"\n" +
+		"Simulate the `promptInt` function with a function that returns values from\n" +
+		"*pairs*. If `promptInt` is called with a *prompt* that does not match any of\n" +
+		"*pairs*, then it returns `0`.\n" +
+		"\n" +
+		"#### `--watch`\n" +
+		"\n" +
+		"Interpret *templates* as the filenames of templates, execute them, and execute\n" +
+		"them again whenever they, the templates in `.chezmoitemplates`, the data in the\n" +
+		"config file, or the `.chezmoidata.<format>` files change. If stdout is a\n" +
+		"terminal then the screen is cleared before each execution. Errors are printed\n" +
+		"instead of the output, followed by the lines of the template around the error\n" +
+		"with their line numbers. Press Ctrl-C to stop watching.\n" +
+		"\n" +
+		"#### `--cache-secrets`\n" +
+		"\n" +
+		"With `--watch`, retrieve each secret from its secret manager only once and reuse\n" +
+		"it when executing the templates again. This is the default. Use\n" +
+		"`--cache-secrets=false` to retrieve secrets again on every execution.\n" +
+		"\n" +
 		"#### `execute-template` examples\n" +
 		"\n" +
 		"    chezmoi execute-template '{{ .chezmoi.sourceDir }}'\n" +
 		"    chezmoi execute-template '{{ .chezmoi.os }}' / '{{ .chezmoi.arch }}'\n" +
 		"    echo '{{ .chezmoi | toJson }}' | chezmoi execute-template\n" +
 		"    chezmoi execute-template --init --promptString email=john@home.org < ~/.local/share/chezmoi/.chezmoi.toml.tmpl\n" +
+		"    chezmoi execute-template --watch ~/.local/share/chezmoi/dot_gitconfig.tmpl\n" +
 		"\n" +
 		"### `forget` *targets*\n" +
 		"\n" +
 		"Remove *targets* from the source state, i.e. stop managing them.\n" +
 		"\n" +
+		"#### `--exclude` *pattern*\n" +
+		"\n" +
+		"Exclude targets matching *pattern*. This flag can be repeated.\n" +
+		"\n" +
 		"#### `forget` examples\n" +
 		"\n" +
 		"    chezmoi forget ~/.bashrc\n" +
+		"    chezmoi forget ~/.config/zsh/'*.zsh' --exclude ~/.config/zsh/local.zsh\n" +
+		"\n" +
+		"### `generate` `install.sh`\n" +
+		"\n" +
+		"Generate a self-contained script that bootstraps a new machine: it downloads the\n" +
+		"latest chezmoi release for the machine's operating system and architecture\n" +
+		"using either `curl` or `wget`, verifies its SHA256 checksum, installs it, and\n" +
+		"runs `chezmoi init --apply` with your repo. chezmoi is installed in\n" +
+		"`$CHEZMOI_PREFIX/bin`, where `$CHEZMOI_PREFIX` defaults to `$HOME/.local`, and\n" +
+		"the version to install can be set with `$CHEZMOI_VERSION`.\n" +
+		"\n" +
+		"#### `--format` *format*\n" +
+		"\n" +
+		"Set the format of the generated script, either `sh` (the default) for a POSIX\n" +
+		"shell script, or `powershell` for a PowerShell script for Windows. The\n" +
+		"PowerShell script installs chezmoi in `$env:LOCALAPPDATA\\chezmoi\\bin` by\n" +
+		"default.\n" +
+		"\n" +
+		"#### `-o`, `--output` *filename*\n" +
+		"\n" +
+		"Write the script to *filename* instead of stdout.\n" +
+		"\n" +
+		"#### `--repo` *repo*\n" +
+		"\n" +
+		"Initialize chezmoi from *repo*. By default, the URL of the source directory's\n" +
+		"upstream remote is used.\n" +
+		"\n" +
+		"#### `generate` examples\n" +
+		"\n" +
+		"    chezmoi generate install.sh > install.sh\n" +
+		"    chezmoi generate install.sh --repo https://github.com/user/dotfiles.git\n" +
+		"    chezmoi generate install.sh --format=powershell -o install.ps1\n" +
 		"\n" +
 		"### `git` [*arguments*]\n" +
 		"\n" +
@@ -2165,10 +3240,55 @@ func init() {
 		"file is created using that file as a template. Finally, if the `--apply` flag is\n" +
 		"passed, `chezmoi apply` is run.\n" +
 		"\n" +
+		"If the source VCS is git, `chezmoi init` also offers to create a `.gitignore`\n" +
+		"and a `.gitattributes` in the source directory, unless they are already managed\n" +
+		"or `sourceVCS.gitFiles` is set, in which case they are created without\n" +
+		"asking. chezmoi only writes a block delimited by `# BEGIN chezmoi managed block`\n" +
+		"and `# END chezmoi managed block` lines, appending it if it is missing, and\n" +
+		"never changes anything outside it. The `.gitignore` block ignores files that\n" +
+		"should never be committed, like `.DS_Store`. The `.gitattributes` block marks\n" +
+		"encrypted files as binary. If `sourceVCS.textconv` is set, for example to `gpg\n" +
+		"--decrypt --quiet`, encrypted files are instead diffed with a git diff driver\n" +
+		"that runs it, which chezmoi configures in the source repo. Once the blocks\n" +
+		"exist, they are kept up to date by every command that changes the source\n" +
+		"directory.\n" +
+		"\n" +
+		"When *repo* is given and has not been trusted before, `chezmoi init` asks\n" +
+		"whether to trust it. Templates in an untrusted repo cannot call the template\n" +
+		"functions that read secrets or run arbitrary commands, like `keyring`, `pass`,\n" +
+		"and `commandVersion`, or that make network requests or read the environment,\n" +
+		"`getHostByName`, `env`, and `expandenv`, which return an error instead, and its\n" +
+		"scripts are not run. The answer is recorded for the repo's\n" +
+		"origin URL in the persistent state, and later commands that apply the target\n" +
+		"state ask again until the repo is trusted. Commands that only read the target\n" +
+		"state, like `chezmoi diff` and `chezmoi cat`, apply the same restrictions\n" +
+		"without asking. Trust can be revoked with `chezmoi\n" +
+		"state revoke-trust`.\n" +
+		"\n" +
+		"#### `--branch` *branch*\n" +
+		"\n" +
+		"Check out *branch* of *repo* instead of the default branch. Only supported by\n" +
+		"git.\n" +
+		"\n" +
+		"#### `--depth` *depth*\n" +
+		"\n" +
+		"Create a shallow clone of *repo* with a history truncated to *depth* commits.\n" +
+		"Only supported by git.\n" +
+		"\n" +
+		"#### `--log-file` *filename*, `--log-format` *format*\n" +
+		"\n" +
+		"Append a log of the operations performed by `--apply` to *filename*, as for\n" +
+		"`chezmoi apply`.\n" +
+		"\n" +
+		"#### `--trust`\n" +
+		"\n" +
+		"Trust *repo* without asking.\n" +
+		"\n" +
 		"#### `init` examples\n" +
 		"\n" +
 		"    chezmoi init https://github.com/user/dotfiles.git\n" +
 		"    chezmoi init https://github.com/user/dotfiles.git --apply\n" +
+		"    chezmoi init https://github.com/user/dotfiles.git --branch work --depth 1\n" +
 		"\n" +
 		"### `import` *filename*\n" +
 		"\n" +
@@ -2179,41 +3299,132 @@ func init() {
 		"\n" +
 		"The only supported archive format is `.tar.gz`.\n" +
 		"\n" +
+		"Alternatively, with `--repo`, import a subdirectory of a git repository. The\n" +
+		"repository is shallow cloned to a temporary directory, which is removed\n" +
+		"afterwards. The repository, subdirectory, branch, and imported commit are\n" +
+		"recorded in the persistent state so that the import can later be refreshed\n" +
+		"with `--update`.\n" +
+		"\n" +
+		"#### `--branch` *branch*, `--depth` *depth*\n" +
+		"\n" +
+		"Clone *branch* of the repo given with `--repo`, and create a shallow clone with\n" +
+		"a history truncated to *depth* commits. The default depth is 1.\n" +
+		"\n" +
 		"#### `--destination` *directory*\n" +
 		"\n" +
 		"Set the destination (in the source state) where the archive will be imported.\n" +
+		"Required with `--repo`.\n" +
 		"\n" +
 		"#### `-x`, `--exact`\n" +
 		"\n" +
 		"Set the `exact` attribute on all imported directories.\n" +
 		"\n" +
+		"#### `--exclude` *pattern*\n" +
+		"\n" +
+		"Do not import targets matching *pattern* when importing from a repo. This flag\n" +
+		"can be repeated.\n" +
+		"\n" +
+		"#### `--path` *path*\n" +
+		"\n" +
+		"Import only *path*, relative to the root of the repo given with `--repo`.\n" +
+		"\n" +
 		"#### `-r`, `--remove-destination`\n" +
 		"\n" +
 		"Remove destination (in the source state) before importing.\n" +
 		"\n" +
+		"#### `--repo` *repo*\n" +
+		"\n" +
+		"Import from a shallow clone of *repo* instead of from an archive file. `.git`\n" +
+		"directories are not imported.\n" +
+		"\n" +
 		"#### `--strip-components` *n*\n" +
 		"\n" +
 		"Strip *n* leading components from paths.\n" +
 		"\n" +
+		"#### `--update`\n" +
+		"\n" +
+		"Update every import recorded with `--repo` whose repo has new commits, and\n" +
+		"report which imports were updated and which were unchanged. The previous import\n" +
+		"is removed from the source state first, so files removed from the repo are\n" +
+		"removed from the source state.\n" +
+		"\n" +
 		"#### `import` examples\n" +
 		"\n" +
 		"    curl -s -L -o oh-my-zsh-master.tar.gz https://github.com/robbyrussell/oh-my-zsh/archive/master.tar.gz\n" +
 		"    chezmoi import --strip-components 1 --destination ~/.oh-my-zsh oh-my-zsh-master.tar.gz\n" +
+		"    chezmoi import --repo https://github.com/ohmyzsh/ohmyzsh.git --path plugins --destination ~/.oh-my-zsh/plugins --exact\n" +
+		"    chezmoi import --update\n" +
 		"\n" +
 		"### `manage` *targets*\n" +
 		"\n" +
 		"`manage` is an alias for `add` for symmetry with `unmanage`.\n" +
 		"\n" +
-		"### `managed`\n" +
+		"### `lint`\n" +
+		"\n" +
+		"Check the source state for problems without applying it, for example in\n" +
+		"continuous integration before pushing your dotfiles. `lint` reports all the\n" +
+		"problems it finds, with the file and line number where known, rather than\n" +
+		"stopping at the first. It checks that:\n" +
+		"\n" +
+		"* every template parses and executes,\n" +
+		"* every encrypted file can be decrypted,\n" +
+		"* attribute prefixes are in the correct order and well-formed,\n" +
+		"* patterns in `.chezmoiignore` and `.chezmoiremove` are valid,\n" +
+		"* `.chezmoidependencies` is well-formed and contains no cycles,\n" +
+		"* no two entries in the same source directory have the same target, and\n" +
+		"* the version of chezmoi satisfies `.chezmoiversion`.\n" +
+		"\n" +
+		"Secret manager template functions, for example `bitwarden` and `pass`, are not\n" +
+		"called. Instead, they return placeholder values, and templates that use them are\n" +
+		"allowed to access missing keys. `lint` exits with a non-zero status if any\n" +
+		"problems are found.\n" +
+		"\n" +
+		"#### `-f`, `--format` *format*\n" +
+		"\n" +
+		"Print the problems in the given *format*: `text` (the default), `json`, or\n" +
+		"`yaml`.\n" +
+		"\n" +
+		"#### `--no-decrypt`\n" +
+		"\n" +
+		"Do not check that encrypted files can be decrypted, for example if your\n" +
+		"private key is not available.\n" +
+		"\n" +
+		"#### `lint` examples\n" +
+		"\n" +
+		"    chezmoi lint\n" +
+		"    chezmoi lint --no-decrypt --format=json\n" +
+		"\n" +
+		"### `managed` [*targets*]\n" +
+		"\n" +
+		"List all managed entries in the destination directory in alphabetical order. If\n" +
+		"*targets* are given, then only the managed entries in *targets* are listed.\n" +
+		"\n" +
+		"#### `--exclude` *pattern*\n" +
+		"\n" +
+		"Exclude targets matching *pattern*. This flag can be repeated.\n" +
+		"\n" +
+		"#### `-f`, `--format` *format*\n" +
 		"\n" +
-		"List all managed entries in the destination directory in alphabetical order.\n" +
+		"Print the managed entries in the given format. The accepted formats are `text`\n" +
+		"(the default), which prints one target path per line, and `json` and `yaml`,\n" +
+		"which print a list of entries, each with its `path`, its `type` (`dir`, `file`,\n" +
+		"`script`, or `symlink`), its `mode` (for directories and files), whether it is a\n" +
+		"`template`, whether it is `encrypted`, and, with `--with-source-dir`, its\n" +
+		"`sourceDir`.\n" +
 		"\n" +
 		"#### `-i`, `--include` *types*\n" +
 		"\n" +
 		"Only list entries of type *types*. *types* is a comma-separated list of types of\n" +
-		"entry to include. Valid types are `dirs`, `files`, and `symlinks` which can be\n" +
-		"abbreviated to `d`, `f`, and `s` respectively. By default, `manage` will list\n" +
-		"entries of all types.\n" +
+		"entry to include. Valid types are `dirs`, `files`, `scripts`, and `symlinks`,\n" +
+		"and `dirs`, `files`, and `symlinks` can be abbreviated to `d`, `f`, and `s`\n" +
+		"respectively, and `all` includes all types. By default, `managed` will list\n" +
+		"directories, files, and symlinks. Types can also be excluded with `--exclude`.\n" +
+		"\n" +
+		"#### `--with-source-dir`\n" +
+		"\n" +
+		"Also print the source directory that contains each entry, separated from the\n" +
+		"entry by a tab. This is useful with [multiple source\n" +
+		"directories](#multiple-source-directories).\n" +
 		"\n" +
 		"#### `managed` examples\n" +
 		"\n" +
@@ -2222,15 +3433,38 @@ func init() {
 		"    chezmoi managed --include=files,symlinks\n" +
 		"    chezmoi managed -i d\n" +
 		"    chezmoi managed -i d,f\n" +
+		"    chezmoi managed --with-source-dir\n" +
+		"    chezmoi managed --include=files ~/.config\n" +
+		"    chezmoi managed --include=all --format=json\n" +
 		"\n" +
 		"### `merge` *targets*\n" +
 		"\n" +
-		"Perform a three-way merge between the destination state, the source state, and\n" +
-		"the target state. The merge tool is defined by the `merge.command` configuration\n" +
-		"variable, and defaults to `vimdiff`. If multiple targets are specified the merge\n" +
-		"tool is invoked for each target. If the target state cannot be computed (for\n" +
-		"example if source is a template containing errors or an encrypted file that\n" +
-		"cannot be decrypted) a two-way merge is performed instead.\n" +
+		"Perform a three-way merge between the destination state, the contents that\n" +
+		"chezmoi last applied to the target, and the target state. The merge tool is\n" +
+		"defined by the `merge.command` configuration variable, and defaults to\n" +
+		"`vimdiff`. If multiple targets are specified the merge tool is invoked for each\n" +
+		"target. `chezmoi apply` records the contents that it applies in the persistent\n" +
+		"state, except for encrypted files, templates, private files, and large files, so\n" +
+		"that secrets are never stored in plaintext. If no contents are recorded\n" +
+		"for a target then a two-way merge between the destination state and the target\n" +
+		"state is performed instead. If the target state cannot be computed (for example\n" +
+		"if source is a template containing errors or an encrypted file that cannot be\n" +
+		"decrypted) then the source state is used instead of the target state.\n" +
+		"\n" +
+		"By default, the merge tool is invoked with `merge.args` followed by the\n" +
+		"destination, the last applied contents, and the target state. If any of\n" +
+		"`merge.args` contain templates then the merge tool is invoked with just\n" +
+		"`merge.args`, each executed as a template with the fields `.Destination`,\n" +
+		"`.Base`, and `.Target`. Arguments that are empty after executing, like `{{ .Base\n" +
+		"}}` when no contents are recorded, are omitted.\n" +
+		"\n" +
+		"    [merge]\n" +
+		"        command = \"meld\"\n" +
+		"        args = [\"{{ .Destination }}\", \"{{ .Base }}\", \"{{ .Target }}\"]\n" +
+		"\n" +
+		"If the merged destination differs from the target state then chezmoi offers to\n" +
+		"re-add it to the source state, unless it is a template, encrypted, or generated\n" +
+		"by a `modify_` script.\n" +
 		"\n" +
 		"#### `merge` examples\n" +
 		"\n" +
@@ -2250,10 +3484,36 @@ func init() {
 		"    chezmoi purge\n" +
 		"    chezmoi purge --force\n" +
 		"\n" +
+		"### `re-add` [*targets*]\n" +
+		"\n" +
+		"Re-add all modified files in *targets*, or all managed files if no *targets*\n" +
+		"are given, to the source state. A file is modified if its contents in the\n" +
+		"destination directory differ from its target state, for example because you\n" +
+		"edited it directly instead of with `chezmoi edit`. Its source state is then\n" +
+		"replaced as if with `chezmoi add`.\n" +
+		"\n" +
+		"Templates and encrypted files are never re-added, as that would lose their\n" +
+		"template actions or encryption. Instead, chezmoi prints a warning for each one\n" +
+		"that has been modified.\n" +
+		"\n" +
+		"#### `--exclude` *pattern*\n" +
+		"\n" +
+		"Exclude targets matching *pattern*. This flag can be repeated.\n" +
+		"\n" +
+		"#### `re-add` examples\n" +
+		"\n" +
+		"    chezmoi re-add\n" +
+		"    chezmoi re-add ~/.bashrc\n" +
+		"    chezmoi re-add --dry-run --verbose\n" +
+		"\n" +
 		"### `remove` *targets*\n" +
 		"\n" +
 		"Remove *targets* from both the source state and the destination directory.\n" +
 		"\n" +
+		"#### `--exclude` *pattern*\n" +
+		"\n" +
+		"Exclude targets matching *pattern*. This flag can be repeated.\n" +
+		"\n" +
 		"#### `-f`, `--force`\n" +
 		"\n" +
 		"Remove without prompting.\n" +
@@ -2276,6 +3536,7 @@ func init() {
 		"\n" +
 		"#### `secret` examples\n" +
 		"\n" +
+		"    chezmoi secret aws-secrets-manager list-secrets\n" +
 		"    chezmoi secret bitwarden list items\n" +
 		"    chezmoi secret keyring set --service service --user user\n" +
 		"    chezmoi secret keyring get --service service --user user\n" +
@@ -2308,25 +3569,162 @@ func init() {
 		"    chezmoi source-path\n" +
 		"    chezmoi source-path ~/.bashrc\n" +
 		"\n" +
+		"### `state`\n" +
+		"\n" +
+		"Manipulate the persistent state. The persistent state is stored in the file set\n" +
+		"by the `stateFile` configuration variable or, by default, in\n" +
+		"`$XDG_STATE_HOME/chezmoi/chezmoistate.boltdb`, where `XDG_STATE_HOME` defaults\n" +
+		"to `~/.local/state`. Setting `stateFile` is useful when the config file is\n" +
+		"deployed to a read-only location.\n" +
+		"\n" +
+		"Earlier versions of chezmoi stored the persistent state in the same directory as\n" +
+		"the config file. If only this legacy file exists, then chezmoi copies it to the\n" +
+		"new location, checks the copy, prints a one-time notice, and uses the copy from\n" +
+		"then on. The legacy file is not removed. With `--dry-run` the legacy file is\n" +
+		"used and not copied.\n" +
+		"\n" +
+		"The following subcommands are available:\n" +
+		"\n" +
+		"* `delete-bucket`: delete a bucket and everything in it. For example, `chezmoi\n" +
+		"  state delete-bucket --bucket=script` forgets which `run_once_` scripts have\n" +
+		"  been run, so they are run again by the next `chezmoi apply`, without changing\n" +
+		"  the rest of the persistent state.\n" +
+		"* `dump`: write the contents of a bucket to stdout.\n" +
+		"* `orphans`: list the keys of script states that do not correspond to any\n" +
+		"  script in the current source state, for example because the script was\n" +
+		"  removed or renamed. Earlier versions of scripts that still exist are not\n" +
+		"  orphans.\n" +
+		"* `prune`: remove the script states listed by `orphans`, after prompting for\n" +
+		"  confirmation. With `--dry-run`, the states that would be removed are printed\n" +
+		"  instead.\n" +
+		"* `reset`: remove the persistent state file entirely, after prompting for\n" +
+		"  confirmation.\n" +
+		"* `revoke-trust` *repo*...: stop trusting each *repo*, so that its templates\n" +
+		"  cannot read secrets and its scripts are not run until it is trusted again.\n" +
+		"\n" +
+		"#### `-b`, `--bucket` *bucket*\n" +
+		"\n" +
+		"Operate on *bucket*. The default bucket is `script`, which records each\n" +
+		"`run_once_` script that has been run, including when it was run, the version of\n" +
+		"chezmoi that ran it, its exit status, its duration, and the SHA256 sum of its\n" +
+		"contents.\n" +
+		"\n" +
+		"#### `-f`, `--force`\n" +
+		"\n" +
+		"With `prune` and `reset`, remove without prompting.\n" +
+		"\n" +
+		"#### `-f`, `--format` *format*\n" +
+		"\n" +
+		"With `dump`, print the dump in the given format. The accepted formats are\n" +
+		"`json` (JSON), `toml` (TOML), and `yaml` (YAML).\n" +
+		"\n" +
+		"#### `state` examples\n" +
+		"\n" +
+		"    chezmoi state dump\n" +
+		"    chezmoi state dump --format=yaml\n" +
+		"    chezmoi state delete-bucket --bucket=script\n" +
+		"    chezmoi state orphans\n" +
+		"    chezmoi state prune --dry-run\n" +
+		"    chezmoi state revoke-trust https://github.com/user/dotfiles.git\n" +
+		"\n" +
+		"### `status` [*targets*]\n" +
+		"\n" +
+		"Print a summary of the changes that `chezmoi apply` would make to *targets*, or\n" +
+		"to all targets if none are given, similar to `git status --short`. Each line\n" +
+		"contains two status characters followed by the target name. Targets and scripts\n" +
+		"that are up to date are not printed.\n" +
+		"\n" +
+		"The first character is `M` if the target has been modified, or `D` if it has\n" +
+		"been deleted, since it was last applied, and a space otherwise. For scripts, it\n" +
+		"is `M` if a `run_once_` script has been modified since it was last successfully\n" +
+		"run. The second character is `A`, `M`, or `D` if applying the target would add,\n" +
+		"modify, or delete it, `R` if the script will be run, and a space otherwise.\n" +
+		"\n" +
+		"If any target would be changed or any script would be run then chezmoi exits\n" +
+		"with exit code 1, so `chezmoi status` can be used in shell prompts.\n" +
+		"\n" +
+		"#### `--source-drift`\n" +
+		"\n" +
+		"Instead of the status of targets, print the commit of the source directory that\n" +
+		"was last applied, the time it was applied, and whether the source directory had\n" +
+		"uncommitted changes at the time, followed by the current commit of the source\n" +
+		"directory, for example:\n" +
+		"\n" +
+		"    applied: 4b2c9e8f0d1a7c3e5f6a8b9c0d1e2f3a4b5c6d7e (dirty) at 2021-02-03T04:05:06Z\n" +
+		"    head:    9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b\n" +
+		"\n" +
+		"chezmoi exits with exit code 1 if the source directory has changed since it was\n" +
+		"last applied. The commit is recorded in the persistent state after each\n" +
+		"successful `chezmoi apply` of all targets, if the source directory is a working\n" +
+		"copy of the source VCS. It is also available in templates as\n" +
+		"`.chezmoi.lastAppliedCommit` and in the commit message template as\n" +
+		"`lastAppliedCommit`.\n" +
+		"\n" +
+		"#### `status` examples\n" +
+		"\n" +
+		"    chezmoi status\n" +
+		"    chezmoi status ~/.bashrc\n" +
+		"    chezmoi status --source-drift\n" +
+		"\n" +
 		"### `unmanage` *targets*\n" +
 		"\n" +
 		"`unmanage` is an alias for `forget` for symmetry with `manage`.\n" +
 		"\n" +
 		"### `unmanaged`\n" +
 		"\n" +
-		"List all unmanaged files in the destination directory.\n" +
+		"List all unmanaged files in the destination directory, for example files that\n" +
+		"were created by hand and never added. Targets that are ignored by\n" +
+		"`.chezmoiignore` and the source directory are skipped. Symlinks are not\n" +
+		"followed. By default, the contents of unmanaged directories are not listed,\n" +
+		"only the directories themselves.\n" +
+		"\n" +
+		"#### `-p`, `--path-style` `absolute`|`relative`\n" +
+		"\n" +
+		"Print paths either as absolute paths (the default) or relative to the\n" +
+		"destination directory.\n" +
+		"\n" +
+		"#### `-r`, `--recursive`\n" +
+		"\n" +
+		"List the contents of unmanaged directories too.\n" +
 		"\n" +
 		"#### `unmanaged` examples\n" +
 		"\n" +
 		"    chezmoi unmanaged\n" +
+		"    chezmoi unmanaged --path-style=relative\n" +
+		"    chezmoi unmanaged --recursive\n" +
 		"\n" +
 		"### `update`\n" +
 		"\n" +
 		"Pull changes from the source VCS and apply any changes.\n" +
 		"\n" +
+		"#### `--check`\n" +
+		"\n" +
+		"Fetch from the source directory's upstream and print a one-line summary of the\n" +
+		"number of new commits, followed by the new commits, without pulling or applying\n" +
+		"them. If upstream has new commits then chezmoi exits with exit code 2. Only\n" +
+		"supported by git.\n" +
+		"\n" +
+		"#### `--log-file` *filename*, `--log-format` *format*\n" +
+		"\n" +
+		"Append a log of the operations performed when applying changes to *filename*,\n" +
+		"as for `chezmoi apply`.\n" +
+		"\n" +
+		"#### `--poll` *interval*\n" +
+		"\n" +
+		"Check upstream for new commits every *interval*, for example `15m`, and pull and\n" +
+		"apply them when there are any, until interrupted. Each check is logged. If\n" +
+		"fetching or pulling fails, for example because the network is unavailable, then\n" +
+		"the check is retried after the next *interval*. If applying fails then polling\n" +
+		"stops. Only supported by git.\n" +
+		"\n" +
+		"With `--dry-run`, `--check` and `--poll` still fetch, so that they show the\n" +
+		"commits that would be pulled, but do not pull or apply them.\n" +
+		"\n" +
 		"#### `update` examples\n" +
 		"\n" +
 		"    chezmoi update\n" +
+		"    chezmoi update --check\n" +
+		"    chezmoi update --poll 15m\n" +
 		"\n" +
 		"### `upgrade`\n" +
 		"\n" +
@@ -2354,19 +3752,59 @@ func init() {
 		"\n" +
 		"Verify that all *targets* match their target state. chezmoi exits with code 0\n" +
 		"(success) if all targets match their target state, or 1 (failure) otherwise. If\n" +
-		"no targets are specified then all targets are checked.\n" +
+		"no targets are specified then all targets are checked. The targets whose\n" +
+		"contents, mode, or type differ are printed, one per line. Scripts are ignored.\n" +
+		"\n" +
+		"#### `--exclude` *types-or-pattern*\n" +
+		"\n" +
+		"Exclude entries as for [`archive`](#archive). This flag can be repeated.\n" +
+		"\n" +
+		"#### `--exclude-encrypted`\n" +
+		"\n" +
+		"Skip encrypted targets, as for [`apply`](#apply-targets).\n" +
+		"\n" +
+		"#### `-q`, `--quiet`\n" +
+		"\n" +
+		"Do not print the targets that differ.\n" +
+		"\n" +
+		"#### `--symlink`\n" +
+		"\n" +
+		"Verify plain files as symbolic links, as for [`apply`](#apply-targets).\n" +
 		"\n" +
 		"#### `verify` examples\n" +
 		"\n" +
 		"    chezmoi verify\n" +
 		"    chezmoi verify ~/.bashrc\n" +
+		"    chezmoi verify --quiet || chezmoi apply\n" +
 		"\n" +
 		"## Editor configuration\n" +
 		"\n" +
-		"The `edit` and `edit-config` commands use the editor specified by the `VISUAL`\n" +
-		"environment variable, the `EDITOR` environment variable, or `vi`, whichever is\n" +
+		"The `edit` and `edit-config` commands use the editor specified by the\n" +
+		"`edit.command` configuration variable, the `VISUAL` environment variable, the\n" +
+		"`EDITOR` environment variable, or `vi` (`notepad` on Windows), whichever is\n" +
 		"specified first.\n" +
 		"\n" +
+		"`VISUAL` and `EDITOR` are split into a command and its arguments like a shell\n" +
+		"would, so arguments and paths that contain spaces can be quoted, for example\n" +
+		"`\"C:\\Program Files\\Microsoft VS Code\\bin\\code.cmd\" --wait`. Backslashes\n" +
+		"escape the next character, except on Windows. `edit.command` is used as is,\n" +
+		"with the arguments in `edit.args`, and the environment is ignored:\n" +
+		"\n" +
+		"```toml\n" +
+		"[edit]\n" +
+		"    command = \"code\"\n" +
+		"    args = [\"--wait\"]\n" +
+		"```\n" +
+		"\n" +
+		"Some editors, typically GUI editors like `code` and `subl`, return immediately\n" +
+		"unless they are told to wait. When the editor returns successfully within a\n" +
+		"second, `chezmoi edit` assumes that it did not wait and instead watches the\n" +
+		"edited files for changes, re-encrypting encrypted files after each change, until\n" +
+		"no changes have been made for `edit.watchTimeout` or you press Ctrl-C. Only then\n" +
+		"does it apply or diff the changes. Passing the editor's own wait flag, for\n" +
+		"example with `edit.args` or in `VISUAL`, avoids watching, as does setting\n" +
+		"`edit.watchTimeout` to `0`.\n" +
+		"\n" +
 		"## Umask configuration\n" +
 		"\n" +
 		"By default, chezmoi uses your current umask as set by your operating system and\n" +
@@ -2410,22 +3848,69 @@ func init() {
 		"\n" +
 		"chezmoi provides the following automatically populated variables:\n" +
 		"\n" +
-		"| Variable                | Value                                                                                                                           |\n" +
-		"| ----------------------- | ------------------------------------------------------------------------------------------------------------------------------- |\n" +
-		"| `.chezmoi.arch`         | Architecture, e.g. `amd64`, `arm`, etc. as returned by [runtime.GOARCH](https://pkg.go.dev/runtime?tab=doc#pkg-constants).      |\n" +
-		"| `.chezmoi.fullHostname` | The full hostname of the machine chezmoi is running on.                                                                         |\n" +
-		"| `.chezmoi.group`        | The group of the user running chezmoi.                                                                                          |\n" +
-		"| `.chezmoi.homedir`      | The home directory of the user running chezmoi.                                                                                 |\n" +
-		"| `.chezmoi.hostname`     | The hostname of the machine chezmoi is running on, up to the first `.`.                                                         |\n" +
-		"| `.chezmoi.kernel`       | Contains information from `/proc/sys/kernel`. Linux only, useful for detecting specific kernels (i.e. Microsoft's WSL kernel).  |\n" +
-		"| `.chezmoi.os`           | Operating system, e.g. `darwin`, `linux`, etc. as returned by [runtime.GOOS](https://pkg.go.dev/runtime?tab=doc#pkg-constants). |\n" +
-		"| `.chezmoi.osRelease`    | The information from `/etc/os-release`, Linux only, run `chezmoi data` to see its output.                                       |\n" +
-		"| `.chezmoi.sourceDir`    | The source directory.                                                                                                           |\n" +
-		"| `.chezmoi.username`     | The username of the user running chezmoi.                                                                                       |\n" +
-		"\n" +
-		"Additional variables can be defined in the config file in the `data` section.\n" +
-		"Variable names must consist of a letter and be followed by zero or more letters\n" +
-		"and/or digits.\n" +
+		"| Variable                     | Value                                                                                                                           |\n" +
+		"| ---------------------------- | ------------------------------------------------------------------------------------------------------------------------------- |\n" +
+		"| `.chezmoi.arch`              | Architecture, e.g. `amd64`, `arm`, etc. as returned by [runtime.GOARCH](https://pkg.go.dev/runtime?tab=doc#pkg-constants).      |\n" +
+		"| `.chezmoi.configFile`        | The path of the config file, even if it does not exist, as set by `--config`.                                                   |\n" +
+		"| `.chezmoi.destDir`           | The absolute path of the destination directory, which differs from `.chezmoi.homedir` when set with `--destination`.            |\n" +
+		"| `.chezmoi.fullHostname`      | The full hostname of the machine chezmoi is running on.                                                                         |\n" +
+		"| `.chezmoi.group`             | The group of the user running chezmoi.                                                                                          |\n" +
+		"| `.chezmoi.homedir`           | The home directory of the user running chezmoi.                                                                                 |\n" +
+		"| `.chezmoi.hostname`          | The hostname of the machine chezmoi is running on, up to the first `.`.                                                         |\n" +
+		"| `.chezmoi.kernel`            | Kernel information from `/proc/sys/kernel` on Linux or `sysctl` on BSD and macOS, e.g. for detecting Microsoft's WSL kernel.    |\n" +
+		"| `.chezmoi.lastAppliedCommit` | The commit of the source directory that was last applied by `chezmoi apply`, or the empty string.                               |\n" +
+		"| `.chezmoi.locale.language`   | The language of the user's locale, e.g. `en`, or the empty string.                                                              |\n" +
+		"| `.chezmoi.locale.region`     | The region of the user's locale, e.g. `US`, or the empty string.                                                                |\n" +
+		"| `.chezmoi.os`                | Operating system, e.g. `darwin`, `linux`, etc. as returned by [runtime.GOOS](https://pkg.go.dev/runtime?tab=doc#pkg-constants). |\n" +
+		"| `.chezmoi.osRelease`         | The information from `/etc/os-release`, Linux only, run `chezmoi data` to see its output.                                       |\n" +
+		"| `.chezmoi.shell`             | The login shell of the user running chezmoi, e.g. `/bin/zsh`, or the empty string.                                              |\n" +
+		"| `.chezmoi.sourceDir`         | The source directory.                                                                                                           |\n" +
+		"| `.chezmoi.umask`             | The umask, in octal, e.g. `022`.                                                                                                |\n" +
+		"| `.chezmoi.username`          | The username of the user running chezmoi.                                                                                       |\n" +
+		"| `.chezmoi.version`           | The version of chezmoi as printed by `chezmoi --version`, e.g. `dev` for development builds.                                    |\n" +
+		"\n" +
+		"If the current user cannot be looked up, for example in minimal containers,\n" +
+		"then `.chezmoi.username` is taken from `$USER` or `$LOGNAME` and\n" +
+		"`.chezmoi.homedir` from `$HOME`. Variables whose values cannot be determined are\n" +
+		"not set, so only templates that use them fail.\n" +
+		"\n" +
+		"`.chezmoi.kernel` contains `osrelease`, `ostype`, and `version` where available.\n" +
+		"On BSD and macOS these are read from the `kern.osrelease`, `kern.ostype`, and\n" +
+		"`kern.version` sysctls, and `machine` is also set from `hw.machine`.\n" +
+		"\n" +
+		"`.chezmoi.shell` is the current user's shell in the user database, as reported\n" +
+		"by `getent passwd` or, on macOS, `dscl`, or `$SHELL` if the user is not found\n" +
+		"there. On Windows it is `$SHELL` if set, for example by MSYS2 or Cygwin,\n" +
+		"`powershell.exe` or `pwsh.exe` if chezmoi is run directly from PowerShell, and\n" +
+		"otherwise `%ComSpec%`, usually `cmd.exe`.\n" +
+		"\n" +
+		"`.chezmoi.locale` is parsed from `$LC_ALL` or, if that is not set, `$LANG`, for\n" +
+		"example `en_US.UTF-8` has the language `en` and the region `US`. On Windows, if\n" +
+		"neither is set, the user's preferred UI language is used. The `C` and `POSIX`\n" +
+		"locales have an empty language and region.\n" +
+		"\n" +
+		"`.chezmoi.osRelease` is read from `/etc/os-release` or, if that does not exist,\n" +
+		"`/usr/lib/os-release`. If neither exist then the `Distributor ID`,\n" +
+		"`Description`, `Release`, and `Codename` fields of `lsb_release -a` are used as\n" +
+		"`id` (in lowercase), `prettyName`, `versionID`, and `versionCodename`.\n" +
+		"\n" +
+		"Additional variables can be defined in `.chezmoidata.<format>` files in the\n" +
+		"source state and in the config file in the `data` section. Variable names must\n" +
+		"consist of a letter and be followed by zero or more letters and/or digits.\n" +
+		"\n" +
+		"Template data is merged recursively with the data from the config file taking\n" +
+		"precedence over the data from the source state, which in turn takes precedence\n" +
+		"over the automatically populated variables. Maps are merged key by key, and all\n" +
+		"other values, including lists, are replaced. Merging a map with a value that is\n" +
+		"not a map is an error. To replace a top-level key's value instead of merging\n" +
+		"it, set its merge mode to `replace` in the `dataMergeMode` section of the config\n" +
+		"file, for example:\n" +
+		"\n" +
+		"    [data.editor]\n" +
+		"        name = \"emacs\"\n" +
+		"\n" +
+		"    [dataMergeMode]\n" +
+		"        editor = \"replace\"\n" +
 		"\n" +
 		"## Template functions\n" +
 		"\n" +
@@ -2433,6 +3918,48 @@ func init() {
 		"template functions from `sprig`](http://masterminds.github.io/sprig/) are\n" +
 		"included. chezmoi provides some additional functions.\n" +
 		"\n" +
+		"Each of chezmoi's functions is also available with a `chezmoi_` prefix, for\n" +
+		"example `chezmoi_bitwarden`, which continues to work if a future version of\n" +
+		"sprig adds a function with the same name. chezmoi's functions take precedence\n" +
+		"over sprig's, and any sprig functions that they shadow are logged when chezmoi\n" +
+		"is run with `--debug`.\n" +
+		"\n" +
+		"Functions can be disabled with the `templateFuncs.disable` configuration\n" +
+		"variable, for example to stop templates in a shared source directory from\n" +
+		"reading the environment or the network. Calling a disabled function is a\n" +
+		"template error that names `templateFuncs.disable`. Disabling one of chezmoi's\n" +
+		"functions also disables its `chezmoi_` alias.\n" +
+		"\n" +
+		"```toml\n" +
+		"[templateFuncs]\n" +
+		"    disable = [\"env\", \"expandenv\", \"getHostByName\"]\n" +
+		"```\n" +
+		"\n" +
+		"### `awsSecretsManager` *name*\n" +
+		"\n" +
+		"`awsSecretsManager` returns the secret *name*, which may be a name or an ARN,\n" +
+		"from [AWS Secrets Manager](https://aws.amazon.com/secrets-manager/) using the\n" +
+		"[AWS CLI](https://aws.amazon.com/cli/) (`aws`), parsed as JSON. The region and\n" +
+		"profile are set by `awsSecretsManager.region` and `awsSecretsManager.profile`,\n" +
+		"which default to `$AWS_REGION` (or `$AWS_DEFAULT_REGION` if it is not set) and\n" +
+		"`$AWS_PROFILE` respectively. If neither is set then the AWS CLI's own defaults\n" +
+		"are used. Secrets are cached so calling `awsSecretsManager` multiple times with\n" +
+		"the same *name* will only invoke `aws` once.\n" +
+		"\n" +
+		"#### `awsSecretsManager` examples\n" +
+		"\n" +
+		"    password = {{ (awsSecretsManager \"workstation/github\").password }}\n" +
+		"\n" +
+		"### `awsSecretsManagerRaw` *name*\n" +
+		"\n" +
+		"`awsSecretsManagerRaw` returns the secret *name* from AWS Secrets Manager as a\n" +
+		"string, without parsing it. It is otherwise identical to `awsSecretsManager`.\n" +
+		"Binary secrets are returned decoded.\n" +
+		"\n" +
+		"#### `awsSecretsManagerRaw` examples\n" +
+		"\n" +
+		"    {{ awsSecretsManagerRaw \"workstation/ssh-key\" }}\n" +
+		"\n" +
 		"### `bitwarden` [*args*]\n" +
 		"\n" +
 		"`bitwarden` returns structured data retrieved from\n" +
@@ -2442,11 +3969,48 @@ func init() {
 		"cached so calling `bitwarden` multiple times with the same arguments will only\n" +
 		"invoke `bw` once.\n" +
 		"\n" +
+		"Each invocation of `bw` takes about a second. If `bitwarden.serveURL` is set\n" +
+		"then chezmoi instead gets items from the REST API of the `bw serve` already\n" +
+		"running at that URL, which requires `bw` version 1.18 or later. chezmoi never\n" +
+		"starts `bw serve` itself. The REST API of `bw serve` is unauthenticated, so\n" +
+		"anyone who can connect to it can read your unlocked vault: only listen on\n" +
+		"localhost and only on a machine that you do not share. Only calls with two\n" +
+		"arguments, an object type and an id or search term, use `bw serve`. Other calls,\n" +
+		"and all calls if `bw serve` cannot be reached, use `bw get` as usual. Calls to\n" +
+		"Bitwarden are made one at a time.\n" +
+		"\n" +
+		"    [bitwarden]\n" +
+		"        serveURL = \"http://localhost:8087\"\n" +
+		"\n" +
 		"#### `bitwarden` examples\n" +
 		"\n" +
 		"    username = {{ (bitwarden \"item\" \"example.com\").login.username }}\n" +
 		"    password = {{ (bitwarden \"item\" \"example.com\").login.password }}\n" +
 		"\n" +
+		"### `commandVersion` *command* [*args*]\n" +
+		"\n" +
+		"`commandVersion` runs *command* with *args*, or with `--version` if no *args*\n" +
+		"are given, and returns the first version in its output, for example `3.2.0` for\n" +
+		"`tmux 3.2a`. The version has the same type as the one returned by sprig's\n" +
+		"`semver` function, so it can be compared with its `Compare`, `GreaterThan`, and\n" +
+		"`LessThan` methods or with [`semverAtLeast`](#semveratleast-version-minimum),\n" +
+		"which compare versions numerically, so `3.10` is later than `3.9`. If *command*\n" +
+		"is not found then `commandVersion` returns nothing, which is false in an `if`\n" +
+		"action. It is an error if *command* fails or if its output does not contain a\n" +
+		"version. Versions are cached so calling `commandVersion` multiple times with the\n" +
+		"same *command* and *args* will only run *command* once. Because it can run any\n" +
+		"command, `commandVersion` is disabled in untrusted repos.\n" +
+		"\n" +
+		"#### `commandVersion` examples\n" +
+		"\n" +
+		"    {{ if semverAtLeast (commandVersion \"tmux\" \"-V\") \"3.2\" }}\n" +
+		"    set -g extended-keys on\n" +
+		"    {{ end }}\n" +
+		"\n" +
+		"    {{ with commandVersion \"git\" }}\n" +
+		"    # git {{ .String }}\n" +
+		"    {{ end }}\n" +
+		"\n" +
 		"### `gopass` *gopass-name*\n" +
 		"\n" +
 		"`gopass` returns passwords stored in [gopass](https://www.gopass.pw/) using the\n" +
@@ -2459,6 +4023,20 @@ func init() {
 		"\n" +
 		"    {{ gopass \"<pass-name>\" }}\n" +
 		"\n" +
+		"### `includeTemplate` *name* [*data*]\n" +
+		"\n" +
+		"`includeTemplate` returns the result of executing the template *name* from\n" +
+		"[`.chezmoitemplates`](#chezmoitemplates) with *data*. If *data* is not given\n" +
+		"then the template is executed with the template data, as for target templates,\n" +
+		"even when called from a template that was included with other data. Unlike the\n" +
+		"`template` action, the result is a string, so it can be passed to other template\n" +
+		"functions.\n" +
+		"\n" +
+		"#### `includeTemplate` examples\n" +
+		"\n" +
+		"    {{ includeTemplate \"shell/aliases\" . | trim }}\n" +
+		"    {{ includeTemplate \"gitconfig\" (dict \"email\" \"me@example.com\") }}\n" +
+		"\n" +
 		"### `keepassxc` *entry*\n" +
 		"\n" +
 		"`keepassxc` returns structured data retrieved from a\n" +
@@ -2530,6 +4108,20 @@ func init() {
 		"\n" +
 		"    {{ (index (lastpassRaw \"SSH Private Key\") 0).note }}\n" +
 		"\n" +
+		"### `lookupUserShell` *username*\n" +
+		"\n" +
+		"`lookupUserShell` returns the login shell of *username* from the user database,\n" +
+		"as reported by `getent passwd` or, on macOS, `dscl`, or the empty string if\n" +
+		"*username* is not found. On Windows, it returns the same as\n" +
+		"`.chezmoi.shell` if *username* is the current user and the empty string\n" +
+		"otherwise.\n" +
+		"\n" +
+		"#### `lookupUserShell` examples\n" +
+		"\n" +
+		"    {{ if eq (lookupUserShell \"admin\") \"/bin/zsh\" }}\n" +
+		"    # admin uses zsh\n" +
+		"    {{ end }}\n" +
+		"\n" +
 		"### `onepassword` *uuid*\n" +
 		"\n" +
 		"`onepassword` returns structured data from [1Password](https://1password.com/)\n" +
@@ -2539,16 +4131,29 @@ func init() {
 		"The output from `op` is cached so calling `onepassword` multiple times with the\n" +
 		"same *uuid* will only invoke `op` once.\n" +
 		"\n" +
+		"By default, `op` uses your interactive session. To render templates\n" +
+		"non-interactively, for example in CI or on a new machine, set either\n" +
+		"`onepassword.serviceAccountToken` to a service account token, or both\n" +
+		"`onepassword.connectHost` and `onepassword.connectToken` to use a [1Password\n" +
+		"Connect](https://support.1password.com/connect/) server. They are passed to `op`\n" +
+		"in the `OP_SERVICE_ACCOUNT_TOKEN`, `OP_CONNECT_HOST`, and `OP_CONNECT_TOKEN`\n" +
+		"environment variables respectively, and apply to all the `onepassword` template\n" +
+		"functions and to `chezmoi secret onepassword`.\n" +
+		"\n" +
 		"#### `onepassword` examples\n" +
 		"\n" +
 		"    {{ (onepassword \"<uuid>\").details.password }}\n" +
 		"\n" +
+		"    [onepassword]\n" +
+		"        serviceAccountToken = \"ops_...\"\n" +
+		"\n" +
 		"### `onepasswordDocument` *uuid*\n" +
 		"\n" +
 		"`onepassword` returns a document from [1Password](https://1password.com/)\n" +
 		"using the [1Password\n" +
 		"CLI](https://support.1password.com/command-line-getting-started/) (`op`). *uuid*\n" +
-		"is passed to `op get document <uuid>` and the output from `op` is returned.\n" +
+		"is passed to `op get document <uuid>` and the output from `op` is returned\n" +
+		"unchanged, so documents like certificates and keys can be embedded in files.\n" +
 		"The output from `op` is cached so calling `onepasswordDocument` multiple times with the\n" +
 		"same *uuid* will only invoke `op` once.\n" +
 		"\n" +
@@ -2556,6 +4161,25 @@ func init() {
 		"\n" +
 		"    {{- onepasswordDocument \"<uuid>\" -}}\n" +
 		"\n" +
+		"### `onepasswordItemFields` *item*\n" +
+		"\n" +
+		"`onepasswordItemFields` returns the fields of an item from\n" +
+		"[1Password](https://1password.com/) using version 2 of the [1Password\n" +
+		"CLI](https://support.1password.com/command-line-getting-started/) (`op`). *item*\n" +
+		"is passed to `op item get <item> --format json` and the fields in the output are\n" +
+		"returned as a map keyed by each field's label. Fields in sections are returned\n" +
+		"in nested maps keyed by the section's label. Fields without a label, or with the\n" +
+		"same label as another field in the same section, are keyed by their id instead,\n" +
+		"and a warning is logged if `--debug` is set. The output from\n" +
+		"`op` is cached so calling `onepasswordItemFields` multiple times with the same\n" +
+		"*item* will only invoke `op` once.\n" +
+		"\n" +
+		"#### `onepasswordItemFields` examples\n" +
+		"\n" +
+		"    {{ (onepasswordItemFields \"github\").credential.value }}\n" +
+		"    {{ (onepasswordItemFields \"github\").Recovery.code.value }}\n" +
+		"    {{ (onepasswordItemFields \"github\").notesPlain.value }}\n" +
+		"\n" +
 		"### `pass` *pass-name*\n" +
 		"\n" +
 		"`pass` returns passwords stored in [pass](https://www.passwordstore.org/) using\n" +
@@ -2568,6 +4192,33 @@ func init() {
 		"\n" +
 		"    {{ pass \"<pass-name>\" }}\n" +
 		"\n" +
+		"### `promptBool` *prompt*\n" +
+		"\n" +
+		"`promptBool` prompts the user with *prompt* and returns the user's response\n" +
+		"interpreted as a boolean. `y`, `yes`, and `on` are true, `n`, `no`, and `off`\n" +
+		"are false, as are the values accepted by\n" +
+		"[`strconv.ParseBool`](https://pkg.go.dev/strconv?tab=doc#ParseBool). chezmoi\n" +
+		"prompts again until the response is valid. It is only available when generating\n" +
+		"the initial config file.\n" +
+		"\n" +
+		"#### `promptBool` examples\n" +
+		"\n" +
+		"    {{ $work := promptBool \"work machine\" -}}\n" +
+		"    [data]\n" +
+		"        work = {{ $work }}\n" +
+		"\n" +
+		"### `promptInt` *prompt*\n" +
+		"\n" +
+		"`promptInt` prompts the user with *prompt* and returns the user's response\n" +
+		"interpreted as an integer. chezmoi prompts again until the response is valid. It\n" +
+		"is only available when generating the initial config file.\n" +
+		"\n" +
+		"#### `promptInt` examples\n" +
+		"\n" +
+		"    {{ $monitors := promptInt \"number of monitors\" -}}\n" +
+		"    [data]\n" +
+		"        monitors = {{ $monitors }}\n" +
+		"\n" +
 		"### `promptString` *prompt*\n" +
 		"\n" +
 		"`promptString` takes a single argument is a string prompted to the user, and the\n" +
@@ -2591,8 +4242,24 @@ func init() {
 		"\n" +
 		"`secretJSON` returns structured data from the generic secret command defined by\n" +
 		"the `genericSecret.command` configuration variable with *args*. The output is\n" +
-		"parsed as JSON. The output is cached so multiple calls to `secret` with the same\n" +
-		"*args* will only invoke the generic secret command once.\n" +
+		"parsed as JSON after trailing whitespace is removed, so there is no need to pipe\n" +
+		"it through `fromJson`. If the output is not valid JSON then the error includes\n" +
+		"the command that was run. The output is cached so multiple calls to\n" +
+		"`secretJSON` with the same *args* will only invoke the generic secret command\n" +
+		"once.\n" +
+		"\n" +
+		"### `semverAtLeast` *version* *minimum*\n" +
+		"\n" +
+		"`semverAtLeast` returns whether *version* is at least *minimum*. Each may be a\n" +
+		"version, as returned by [`commandVersion`](#commandversion-command-args) or\n" +
+		"sprig's `semver` function, or a string. The missing version returned by\n" +
+		"`commandVersion` for a command that is not found is never at least *minimum*.\n" +
+		"\n" +
+		"#### `semverAtLeast` examples\n" +
+		"\n" +
+		"    {{ if semverAtLeast (commandVersion \"nvim\") \"0.5\" }}\n" +
+		"    # use the built-in LSP client\n" +
+		"    {{ end }}\n" +
 		"\n" +
 		"### `vault` *key*\n" +
 		"\n" +
@@ -4,13 +4,11 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 	"regexp"
 	"strings"
 
 	"github.com/charmbracelet/glamour"
 	"github.com/spf13/cobra"
-	"golang.org/x/crypto/ssh/terminal"
 )
 
 var docsCmd = &cobra.Command{
@@ -59,12 +57,9 @@ func (c *Config) runDocsCmd(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	width := 80
-	if stdout, ok := c.Stdout.(*os.File); ok && terminal.IsTerminal(int(stdout.Fd())) {
-		width, _, err = terminal.GetSize(int(stdout.Fd()))
-		if err != nil {
-			return err
-		}
+	width, err := c.getStdoutWidth()
+	if err != nil {
+		return err
 	}
 
 	tr, err := glamour.NewTermRenderer(
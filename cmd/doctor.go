@@ -12,6 +12,9 @@ import (
 	"github.com/coreos/go-semver/semver"
 	"github.com/spf13/cobra"
 	shell "github.com/twpayne/go-shell"
+	vfs "github.com/twpayne/go-vfs"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
 )
 
 var doctorCmd = &cobra.Command{
@@ -46,6 +49,7 @@ type doctorCheckResult struct {
 type doctorBinaryCheck struct {
 	name          string
 	binaryName    string
+	configKey     string
 	path          string
 	minVersion    *semver.Version
 	mustSucceed   bool
@@ -54,15 +58,27 @@ type doctorBinaryCheck struct {
 	version       *semver.Version
 }
 
+// A doctorConfigFileCheck checks that the config file, if any, was read and
+// parsed without errors.
+type doctorConfigFileCheck struct {
+	fs   vfs.Stater
+	path string
+	err  error
+	info os.FileInfo
+}
+
 type doctorDirectoryCheck struct {
-	name         string
-	path         string
-	err          error
-	dontWantPerm os.FileMode
-	info         os.FileInfo
+	fs          vfs.Stater
+	name        string
+	path        string
+	err         error
+	wantPrivate bool
+	private     bool
+	info        os.FileInfo
 }
 
 type doctorFileCheck struct {
+	fs          vfs.Stater
 	name        string
 	path        string
 	canSkip     bool
@@ -70,6 +86,17 @@ type doctorFileCheck struct {
 	info        os.FileInfo
 }
 
+// A doctorOwnershipCheck checks that a file is owned by the user who runs
+// chezmoi, or by the user who ran chezmoi with sudo.
+type doctorOwnershipCheck struct {
+	fs          vfs.Stater
+	name        string
+	path        string
+	expectedUID int
+	uid         int
+	info        os.FileInfo
+}
+
 type doctorRuntimeCheck struct{}
 
 type doctorSuspiciousFilesCheck struct {
@@ -109,21 +136,47 @@ func (c *Config) runDoctorCmd(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	editorName, _ := c.getEditor()
+	editorName, _, err := c.getEditor()
+	if err != nil {
+		return err
+	}
 	editorCheck := &doctorBinaryCheck{
 		name:        "editor",
 		binaryName:  editorName,
 		mustSucceed: true,
 	}
 
+	expectedUID := c.userLookup.getEUID()
+	if c.sudoUser != nil {
+		expectedUID = c.sudoUser.uid
+	}
+
 	allOK := true
 	for _, dc := range []doctorCheck{
 		&doctorVersionCheck{},
 		&doctorRuntimeCheck{},
+		&doctorConfigFileCheck{
+			fs:   c.fs,
+			path: c.configFile,
+			err:  c.err,
+		},
+		&doctorOwnershipCheck{
+			fs:          c.fs,
+			name:        "configuration file",
+			path:        c.configFile,
+			expectedUID: expectedUID,
+		},
+		&doctorOwnershipCheck{
+			fs:          c.fs,
+			name:        "persistent state file",
+			path:        c.getPersistentStateFile(),
+			expectedUID: expectedUID,
+		},
 		&doctorDirectoryCheck{
-			name:         "source directory",
-			path:         c.SourceDir,
-			dontWantPerm: 0o77,
+			fs:          c.fs,
+			name:        "source directory",
+			path:        c.SourceDir,
+			wantPrivate: true,
 		},
 		&doctorSuspiciousFilesCheck{
 			path: c.SourceDir,
@@ -132,19 +185,17 @@ func (c *Config) runDoctorCmd(cmd *cobra.Command, args []string) error {
 			},
 		},
 		&doctorDirectoryCheck{
+			fs:   c.fs,
 			name: "destination directory",
 			path: c.DestDir,
 		},
-		&doctorFileCheck{
-			name: "configuration file",
-			path: c.configFile,
-		},
 		&doctorBinaryCheck{
 			name:        "shell",
 			binaryName:  shell,
 			mustSucceed: true,
 		},
 		&doctorFileCheck{
+			fs:      c.fs,
 			name:    "KeePassXC database",
 			path:    c.KeePassXC.Database,
 			canSkip: true,
@@ -155,34 +206,44 @@ func (c *Config) runDoctorCmd(cmd *cobra.Command, args []string) error {
 			binaryName: c.Merge.Command,
 		},
 		vcsCommandCheck,
-		gpgBinaryCheck,
+		&doctorBinaryCheck{
+			name:          gpgBinaryCheck.name,
+			binaryName:    c.GPG.Command,
+			versionArgs:   gpgBinaryCheck.versionArgs,
+			versionRegexp: gpgBinaryCheck.versionRegexp,
+		},
 		&doctorBinaryCheck{
 			name:          "1Password CLI",
 			binaryName:    c.Onepassword.Command,
+			configKey:     "onepassword.command",
 			versionArgs:   []string{"--version"},
 			versionRegexp: regexp.MustCompile(`^(\d+\.\d+\.\d+)`),
 		},
 		&doctorBinaryCheck{
 			name:          "Bitwarden CLI",
 			binaryName:    c.Bitwarden.Command,
+			configKey:     "bitwarden.command",
 			versionArgs:   []string{"--version"},
 			versionRegexp: regexp.MustCompile(`^(\d+\.\d+\.\d+)`),
 		},
 		&doctorBinaryCheck{
 			name:          "gopass CLI",
 			binaryName:    c.Gopass.Command,
+			configKey:     "gopass.command",
 			versionArgs:   []string{"--version"},
 			versionRegexp: regexp.MustCompile(`gopass\s+(\d+\.\d+\.\d+)`),
 		},
 		&doctorBinaryCheck{
 			name:          "KeePassXC CLI",
 			binaryName:    c.KeePassXC.Command,
+			configKey:     "keepassxc.command",
 			versionArgs:   []string{"--version"},
 			versionRegexp: regexp.MustCompile(`^(\d+\.\d+\.\d+)`),
 		},
 		&doctorBinaryCheck{
 			name:          "LastPass CLI",
 			binaryName:    c.Lastpass.Command,
+			configKey:     "lastpass.command",
 			versionArgs:   lastpassVersionArgs,
 			versionRegexp: lastpassVersionRegexp,
 			minVersion:    &lastpassMinVersion,
@@ -190,12 +251,14 @@ func (c *Config) runDoctorCmd(cmd *cobra.Command, args []string) error {
 		&doctorBinaryCheck{
 			name:          "pass CLI",
 			binaryName:    c.Pass.Command,
+			configKey:     "pass.command",
 			versionArgs:   []string{"version"},
 			versionRegexp: regexp.MustCompile(`(?m)=\s*v(\d+\.\d+\.\d+)`),
 		},
 		&doctorBinaryCheck{
 			name:          "Vault CLI",
 			binaryName:    c.Vault.Command,
+			configKey:     "vault.command",
 			versionArgs:   []string{"version"},
 			versionRegexp: regexp.MustCompile(`^Vault\s+v(\d+\.\d+\.\d+)`),
 		},
@@ -208,15 +271,15 @@ func (c *Config) runDoctorCmd(cmd *cobra.Command, args []string) error {
 			continue
 		}
 		dcr := runDoctorCheck(dc)
-		if !dcr.ok {
+		if dcr.prefix == errorPrefix {
 			allOK = false
 		}
 		if dcr.result != "" {
-			fmt.Printf("%7s: %s\n", dcr.prefix, dcr.result)
+			fmt.Fprintf(c.Stdout, "%7s: %s\n", dcr.prefix, dcr.result)
 		}
 	}
 	if !allOK {
-		os.Exit(1)
+		return exitCodeError(1)
 	}
 	return nil
 }
@@ -227,7 +290,10 @@ func runDoctorCheck(dc doctorCheck) doctorCheckResult {
 	}
 	ok, err := dc.Check()
 	if err != nil {
-		return doctorCheckResult{result: err.Error()}
+		return doctorCheckResult{
+			prefix: errorPrefix,
+			result: err.Error(),
+		}
 	}
 	var prefix string
 	switch {
@@ -281,6 +347,9 @@ func (c *doctorBinaryCheck) MustSucceed() bool {
 
 func (c *doctorBinaryCheck) Result() string {
 	if c.path == "" {
+		if c.configKey != "" {
+			return fmt.Sprintf("%s (%s, not found, set %s to its absolute path)", c.binaryName, c.name, c.configKey)
+		}
 		return fmt.Sprintf("%s (%s, not found)", c.binaryName, c.name)
 	}
 	s := fmt.Sprintf("%s (%s", c.path, c.name)
@@ -306,15 +375,59 @@ func (c *doctorBinaryCheck) getVersionFromOutput(output []byte) (*semver.Version
 	return semver.NewVersion(string(m[1]))
 }
 
+func (c *doctorConfigFileCheck) Check() (bool, error) {
+	if c.path == "" {
+		return false, nil
+	}
+	var err error
+	c.info, err = c.fs.Stat(c.path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return c.info != nil && c.err == nil, nil
+}
+
+func (c *doctorConfigFileCheck) Enabled() bool {
+	return true
+}
+
+func (c *doctorConfigFileCheck) MustSucceed() bool {
+	return c.err != nil
+}
+
+func (c *doctorConfigFileCheck) Result() string {
+	switch {
+	case c.err != nil:
+		return fmt.Sprintf("%s (configuration file, %v)", c.path, c.err)
+	case c.path == "":
+		return "not set (configuration file)"
+	case c.info == nil:
+		return fmt.Sprintf("%s (configuration file, not found)", c.path)
+	default:
+		return fmt.Sprintf("%s (configuration file)", c.path)
+	}
+}
+
+func (c *doctorConfigFileCheck) Skip() bool {
+	return false
+}
+
 func (c *doctorDirectoryCheck) Check() (bool, error) {
-	c.info, c.err = os.Stat(c.path)
+	c.info, c.err = c.fs.Stat(c.path)
 	if c.err != nil && os.IsNotExist(c.err) {
 		return false, nil
 	} else if c.err != nil {
 		return false, c.err
 	}
-	if c.info.Mode()&os.ModePerm&c.dontWantPerm != 0 {
-		return false, nil
+	if c.wantPrivate {
+		var err error
+		c.private, err = chezmoi.IsPrivate(c.fs, c.path, true)
+		if err != nil {
+			return false, err
+		}
+		if !c.private {
+			return false, nil
+		}
 	}
 	return true, nil
 }
@@ -333,6 +446,8 @@ func (c *doctorDirectoryCheck) Result() string {
 		return fmt.Sprintf("%s: (%s, not found)", c.path, c.name)
 	case c.err != nil:
 		return fmt.Sprintf("%s: (%s, %v)", c.path, c.name, c.err)
+	case c.wantPrivate && !c.private:
+		return fmt.Sprintf("%s (%s, perm %03o, not private)", c.path, c.name, c.info.Mode()&os.ModePerm)
 	default:
 		return fmt.Sprintf("%s (%s, perm %03o)", c.path, c.name, c.info.Mode()&os.ModePerm)
 	}
@@ -347,7 +462,7 @@ func (c *doctorFileCheck) Check() (bool, error) {
 		return false, nil
 	}
 	var err error
-	c.info, err = os.Stat(c.path)
+	c.info, err = c.fs.Stat(c.path)
 	if err != nil && os.IsNotExist(err) {
 		return false, nil
 	} else if err != nil {
@@ -375,6 +490,42 @@ func (c *doctorFileCheck) Skip() bool {
 	return c.canSkip && c.path == ""
 }
 
+func (c *doctorOwnershipCheck) Check() (bool, error) {
+	var err error
+	c.info, err = c.fs.Stat(c.path)
+	if err != nil {
+		return false, err
+	}
+	var ok bool
+	c.uid, _, ok = chezmoi.FileOwner(c.info)
+	return !ok || c.uid == c.expectedUID, nil
+}
+
+func (c *doctorOwnershipCheck) Enabled() bool {
+	return true
+}
+
+func (c *doctorOwnershipCheck) MustSucceed() bool {
+	return true
+}
+
+func (c *doctorOwnershipCheck) Result() string {
+	if c.uid != c.expectedUID {
+		return fmt.Sprintf("%s (%s, owned by uid %d instead of %d, run sudo chown %d %s)", c.path, c.name, c.uid, c.expectedUID, c.expectedUID, chezmoi.MaybeShellQuote(c.path))
+	}
+	return ""
+}
+
+// Skip skips the check if the file does not exist, or on systems where files
+// do not have numeric owners.
+func (c *doctorOwnershipCheck) Skip() bool {
+	if c.path == "" || c.expectedUID < 0 {
+		return true
+	}
+	_, err := c.fs.Stat(c.path)
+	return err != nil
+}
+
 func (doctorRuntimeCheck) Check() (bool, error) {
 	return true, nil
 }
@@ -0,0 +1,135 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+func TestDoctorDirectoryCheck(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".local/share/chezmoi": &vfst.Dir{Perm: 0o700},
+			"public":               &vfst.Dir{Perm: 0o755},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	for _, tc := range []struct {
+		name           string
+		check          *doctorDirectoryCheck
+		expectedPrefix string
+		expectedResult string
+	}{
+		{
+			name: "private",
+			check: &doctorDirectoryCheck{
+				fs:          fs,
+				name:        "source directory",
+				path:        "/home/user/.local/share/chezmoi",
+				wantPrivate: true,
+			},
+			expectedPrefix: okPrefix,
+			expectedResult: "/home/user/.local/share/chezmoi (source directory, perm 700)",
+		},
+		{
+			name: "not_private",
+			check: &doctorDirectoryCheck{
+				fs:          fs,
+				name:        "source directory",
+				path:        "/home/user/public",
+				wantPrivate: true,
+			},
+			expectedPrefix: errorPrefix,
+			expectedResult: "/home/user/public (source directory, perm 755, not private)",
+		},
+		{
+			name: "public",
+			check: &doctorDirectoryCheck{
+				fs:   fs,
+				name: "destination directory",
+				path: "/home/user/public",
+			},
+			expectedPrefix: okPrefix,
+			expectedResult: "/home/user/public (destination directory, perm 755)",
+		},
+		{
+			name: "not_found",
+			check: &doctorDirectoryCheck{
+				fs:   fs,
+				name: "destination directory",
+				path: "/home/user/missing",
+			},
+			expectedPrefix: errorPrefix,
+			expectedResult: "/home/user/missing: (destination directory, not found)",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dcr := runDoctorCheck(tc.check)
+			assert.Equal(t, tc.expectedPrefix, dcr.prefix)
+			assert.Equal(t, tc.expectedResult, dcr.result)
+		})
+	}
+}
+
+func TestDoctorOwnershipCheck(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/state/chezmoi/chezmoistate.boltdb": "",
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	euid := os.Geteuid()
+
+	for _, tc := range []struct {
+		name           string
+		path           string
+		expectedUID    int
+		expectedSkip   bool
+		expectedPrefix string
+		expectedResult string
+	}{
+		{
+			name:           "owned",
+			path:           "/home/user/.local/state/chezmoi/chezmoistate.boltdb",
+			expectedUID:    euid,
+			expectedPrefix: okPrefix,
+		},
+		{
+			name:           "not_owned",
+			path:           "/home/user/.local/state/chezmoi/chezmoistate.boltdb",
+			expectedUID:    euid + 1,
+			expectedPrefix: errorPrefix,
+			expectedResult: fmt.Sprintf("/home/user/.local/state/chezmoi/chezmoistate.boltdb (persistent state file, owned by uid %d instead of %d, run sudo chown %d /home/user/.local/state/chezmoi/chezmoistate.boltdb)", euid, euid+1, euid+1),
+		},
+		{
+			name:         "not_found",
+			path:         "/home/user/.config/chezmoi/chezmoi.toml",
+			expectedUID:  euid,
+			expectedSkip: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			check := &doctorOwnershipCheck{
+				fs:          fs,
+				name:        "persistent state file",
+				path:        tc.path,
+				expectedUID: tc.expectedUID,
+			}
+			assert.Equal(t, tc.expectedSkip, check.Skip())
+			if tc.expectedSkip {
+				return
+			}
+			dcr := runDoctorCheck(check)
+			assert.Equal(t, tc.expectedPrefix, dcr.prefix)
+			assert.Equal(t, tc.expectedResult, dcr.result)
+		})
+	}
+}
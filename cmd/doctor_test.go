@@ -1,12 +1,14 @@
 package cmd
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
 	"github.com/coreos/go-semver/semver"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
 )
 
 func TestDoctorBinaryCheck(t *testing.T) {
@@ -66,3 +68,73 @@ func TestDoctorBinaryCheck(t *testing.T) {
 		})
 	}
 }
+
+func TestDoctorBinaryCheckConfigKey(t *testing.T) {
+	check := &doctorBinaryCheck{
+		name:       "Vault CLI",
+		binaryName: "chezmoi-test-missing-vault",
+		configKey:  "vault.command",
+	}
+	ok, err := check.Check()
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "chezmoi-test-missing-vault (Vault CLI, not found, set vault.command to its absolute path)", check.Result())
+}
+
+func TestDoctorConfigFileCheck(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.config/chezmoi/chezmoi.toml": "",
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	for _, tc := range []struct {
+		name           string
+		check          *doctorConfigFileCheck
+		expectedPrefix string
+		expectedResult string
+	}{
+		{
+			name: "ok",
+			check: &doctorConfigFileCheck{
+				fs:   fs,
+				path: "/home/user/.config/chezmoi/chezmoi.toml",
+			},
+			expectedPrefix: okPrefix,
+			expectedResult: "/home/user/.config/chezmoi/chezmoi.toml (configuration file)",
+		},
+		{
+			name: "parse_error",
+			check: &doctorConfigFileCheck{
+				fs:   fs,
+				path: "/home/user/.config/chezmoi/chezmoi.toml",
+				err:  errors.New("unterminated array"),
+			},
+			expectedPrefix: errorPrefix,
+			expectedResult: "/home/user/.config/chezmoi/chezmoi.toml (configuration file, unterminated array)",
+		},
+		{
+			name: "not_found",
+			check: &doctorConfigFileCheck{
+				fs:   fs,
+				path: "/home/user/.config/chezmoi/chezmoi.yaml",
+			},
+			expectedPrefix: warningPrefix,
+			expectedResult: "/home/user/.config/chezmoi/chezmoi.yaml (configuration file, not found)",
+		},
+		{
+			name: "not_set",
+			check: &doctorConfigFileCheck{
+				fs: fs,
+			},
+			expectedPrefix: warningPrefix,
+			expectedResult: "not set (configuration file)",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dcr := runDoctorCheck(tc.check)
+			assert.Equal(t, tc.expectedPrefix, dcr.prefix)
+			assert.Equal(t, tc.expectedResult, dcr.result)
+		})
+	}
+}
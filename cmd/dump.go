@@ -2,14 +2,17 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
 )
 
 type dumpCmdConfig struct {
+	decrypt   bool
 	format    string
+	include   []string
 	recursive bool
 }
 
@@ -26,10 +29,13 @@ func init() {
 	rootCmd.AddCommand(dumpCmd)
 
 	persistentFlags := dumpCmd.PersistentFlags()
+	persistentFlags.BoolVar(&config.dump.decrypt, "decrypt", false, "include the decrypted contents of encrypted files")
+	persistentFlags.StringArrayVar(&config.exclude, "exclude", nil, "exclude entry types or targets matching pattern")
 	persistentFlags.StringVarP(&config.dump.format, "format", "f", "json", "format (JSON, TOML, or YAML)")
+	persistentFlags.StringSliceVarP(&config.dump.include, "include", "i", []string{"all"}, "include entry types")
 	persistentFlags.BoolVarP(&config.dump.recursive, "recursive", "r", true, "recursive")
-
-	markRemainingZshCompPositionalArgumentsAsFiles(dumpCmd, 1)
+	panicOnError(dumpCmd.RegisterFlagCompletionFunc("format", completeWords(formats())))
+	panicOnError(dumpCmd.RegisterFlagCompletionFunc("include", completeCommaSeparatedWords(entryTypeWords)))
 }
 
 func (c *Config) runDumpCmd(cmd *cobra.Command, args []string) error {
@@ -37,13 +43,22 @@ func (c *Config) runDumpCmd(cmd *cobra.Command, args []string) error {
 	if !ok {
 		return fmt.Errorf("%s: unknown format", c.dump.format)
 	}
+	encryptedMode, err := c.getEncryptedMode(c.dump.decrypt)
+	if err != nil {
+		return err
+	}
 	ts, err := c.getTargetState(nil)
 	if err != nil {
 		return err
 	}
+	include, err := c.getEntryFilter(ts, c.dump.include)
+	if err != nil {
+		return err
+	}
 	var concreteValue interface{}
 	if len(args) == 0 {
-		concreteValue, err = ts.ConcreteValue(c.dump.recursive)
+		ts.Filter(include)
+		concreteValue, err = ts.ConcreteValue(encryptedMode, c.dump.recursive)
 		if err != nil {
 			return err
 		}
@@ -54,7 +69,11 @@ func (c *Config) runDumpCmd(cmd *cobra.Command, args []string) error {
 		}
 		var concreteValues []interface{}
 		for _, entry := range entries {
-			entryConcreteValue, err := entry.ConcreteValue(ts.TargetIgnore.Match, ts.SourceDir, os.FileMode(c.Umask), c.dump.recursive)
+			entry = chezmoi.FilterEntry(entry, include)
+			if entry == nil {
+				continue
+			}
+			entryConcreteValue, err := entry.ConcreteValue(ts.TargetIgnore.Match, ts.SourceDir, ts.Umask, encryptedMode, c.dump.recursive)
 			if err != nil {
 				return err
 			}
@@ -42,8 +42,10 @@ func TestDumpCmd(t *testing.T) {
 					"type":       "file",
 					"sourcePath": filepath.Join("/", "home", "user", ".local", "share", "chezmoi", "dir", "file"),
 					"targetPath": filepath.Join("dir", "file"),
+					"create":     false,
 					"empty":      false,
 					"encrypted":  false,
+					"modify":     false,
 					"perm":       float64(0o644),
 					"template":   false,
 					"contents":   "contents",
@@ -60,3 +62,50 @@ func TestDumpCmd(t *testing.T) {
 	}
 	assert.Equal(t, expected, actual)
 }
+
+func TestDumpCmdExclude(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dir/file":        "contents",
+			"run_script":      "#!/bin/sh\n",
+			"symlink_symlink": "target",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	for _, tc := range []struct {
+		name                string
+		args                []string
+		expectedTargetPaths []interface{}
+	}{
+		{
+			name:                "all",
+			expectedTargetPaths: []interface{}{"dir", "symlink"},
+		},
+		{
+			name:                "args",
+			args:                []string{"/home/user/dir", "/home/user/script", "/home/user/symlink"},
+			expectedTargetPaths: []interface{}{"dir", "symlink"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			c := newTestConfig(
+				fs,
+				withDumpCmdConfig(dumpCmdConfig{
+					format: "json",
+				}),
+				withStdout(stdout),
+			)
+			c.exclude = []string{"scripts"}
+			require.NoError(t, c.runDumpCmd(nil, tc.args))
+			var actual []map[string]interface{}
+			require.NoError(t, json.NewDecoder(stdout).Decode(&actual))
+			var actualTargetPaths []interface{}
+			for _, value := range actual {
+				actualTargetPaths = append(actualTargetPaths, value["targetPath"])
+			}
+			assert.Equal(t, tc.expectedTargetPaths, actualTargetPaths)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+type dumpConfigCmdConfig struct {
+	format string
+}
+
+var dumpConfigCmd = &cobra.Command{
+	Use:     "dump-config",
+	Args:    cobra.NoArgs,
+	Short:   "Write the configuration to stdout",
+	Long:    mustGetLongHelp("dump-config"),
+	Example: getExample("dump-config"),
+	PreRunE: config.ensureNoError,
+	RunE:    config.runDumpConfigCmd,
+}
+
+func init() {
+	rootCmd.AddCommand(dumpConfigCmd)
+
+	persistentFlags := dumpConfigCmd.PersistentFlags()
+	persistentFlags.StringVarP(&config.dumpConfig.format, "format", "f", "json", "format (JSON, TOML, or YAML)")
+	panicOnError(dumpConfigCmd.RegisterFlagCompletionFunc("format", completeWords(formats())))
+}
+
+func (c *Config) runDumpConfigCmd(cmd *cobra.Command, args []string) error {
+	return c.dumpConfigSettings(viper.AllSettings())
+}
+
+// dumpConfigSettings writes settings to c.Stdout in the format
+// c.dumpConfig.format.
+func (c *Config) dumpConfigSettings(settings map[string]interface{}) error {
+	format, ok := formatMap[strings.ToLower(c.dumpConfig.format)]
+	if !ok {
+		return fmt.Errorf("%s: unknown format", c.dumpConfig.format)
+	}
+	return format(c.Stdout, settings)
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadConfig(t *testing.T) {
+	expected := map[string]interface{}{
+		"sourcedir": "/home/user/dotfiles",
+		"sourcevcs": map[string]interface{}{
+			"autocommit": true,
+		},
+		"data": map[string]interface{}{
+			"email":  "user@example.com",
+			"mixed":  []interface{}{"a", 1.0},
+			"nested": map[string]interface{}{"key": "value"},
+		},
+	}
+	for _, tc := range []struct {
+		ext  string
+		data string
+	}{
+		{
+			ext: "json",
+			data: strings.Join([]string{
+				`{`,
+				`  "sourceDir": "/home/user/dotfiles",`,
+				`  "sourceVCS": {"autoCommit": true},`,
+				`  "data": {`,
+				`    "email": "user@example.com",`,
+				`    "mixed": ["a", 1],`,
+				`    "nested": {"key": "value"}`,
+				`  }`,
+				`}`,
+			}, "\n"),
+		},
+		{
+			ext: "jsonc",
+			data: strings.Join([]string{
+				`// chezmoi config`,
+				`{`,
+				`  "sourceDir": "/home/user/dotfiles",`,
+				`  "sourceVCS": {"autoCommit": true,}, /* commit automatically */`,
+				`  "data": {`,
+				`    "email": "user@example.com",`,
+				`    "mixed": ["a", 1,],`,
+				`    "nested": {"key": "value"},`,
+				`  },`,
+				`}`,
+			}, "\n"),
+		},
+		{
+			ext: "json5",
+			data: strings.Join([]string{
+				`{`,
+				`  "sourceDir": "/home/user/dotfiles", // source directory`,
+				`  "sourceVCS": {"autoCommit": true},`,
+				`  "data": {"email": "user@example.com", "mixed": ["a", 1], "nested": {"key": "value"},},`,
+				`}`,
+			}, "\n"),
+		},
+		{
+			ext: "toml",
+			data: strings.Join([]string{
+				`sourceDir = "/home/user/dotfiles"`,
+				`sourceVCS.autoCommit = true`,
+				`[data]`,
+				`  email = "user@example.com"`,
+				`  mixed = ["a", 1]`,
+				`  nested.key = "value"`,
+			}, "\n"),
+		},
+		{
+			ext: "yaml",
+			data: strings.Join([]string{
+				`sourceDir: /home/user/dotfiles`,
+				`sourceVCS:`,
+				`  autoCommit: true`,
+				`data:`,
+				`  email: user@example.com`,
+				`  mixed: [a, 1]`,
+				`  nested:`,
+				`    key: value`,
+			}, "\n"),
+		},
+	} {
+		t.Run(tc.ext, func(t *testing.T) {
+			v := viper.New()
+			require.NoError(t, readConfig(v, tc.ext, []byte(tc.data)))
+			assertJSONEqual(t, expected, v.AllSettings())
+		})
+	}
+}
+
+func TestReadConfigUnsupported(t *testing.T) {
+	assert.EqualError(t, readConfig(viper.New(), "ini5", nil), `Unsupported Config Type "ini5"`)
+}
+
+func TestDumpConfigRoundTrip(t *testing.T) {
+	v := viper.New()
+	require.NoError(t, readConfig(v, "toml", []byte(strings.Join([]string{
+		`sourceDir = "/home/user/dotfiles"`,
+		`umask = 0o22`,
+		`sourceVCS.autoCommit = true`,
+		`[data]`,
+		`  email = "user@example.com"`,
+		`  mixed = ["a", 1, true]`,
+		`  nested.key = "value"`,
+	}, "\n"))))
+	settings := v.AllSettings()
+	var expectedConfig Config
+	require.NoError(t, v.Unmarshal(&expectedConfig))
+
+	for _, format := range formats() {
+		t.Run(format, func(t *testing.T) {
+			stdout := &strings.Builder{}
+			c := newConfig(withStdout(stdout))
+			c.dumpConfig.format = format
+			require.NoError(t, c.dumpConfigSettings(settings))
+
+			actualViper := viper.New()
+			require.NoError(t, readConfig(actualViper, format, []byte(stdout.String())))
+			assertJSONEqual(t, settings, actualViper.AllSettings())
+			var actualConfig Config
+			require.NoError(t, actualViper.Unmarshal(&actualConfig))
+			assert.Equal(t, expectedConfig.SourceDir, actualConfig.SourceDir)
+			assert.Equal(t, expectedConfig.Umask, actualConfig.Umask)
+			assert.Equal(t, expectedConfig.SourceVCS.AutoCommit, actualConfig.SourceVCS.AutoCommit)
+		})
+	}
+}
+
+// assertJSONEqual asserts that expected and actual are equal when encoded as
+// JSON, ignoring differences between numeric types.
+func assertJSONEqual(t *testing.T, expected, actual interface{}) {
+	t.Helper()
+	expectedJSON, err := json.Marshal(expected)
+	require.NoError(t, err)
+	actualJSON, err := json.Marshal(actual)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(expectedJSON), string(actualJSON))
+}
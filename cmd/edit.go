@@ -1,10 +1,13 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"time"
 
 	"github.com/google/renameio"
 	"github.com/spf13/cobra"
@@ -23,21 +26,33 @@ var editCmd = &cobra.Command{
 	PostRunE: config.autoCommitAndAutoPush,
 }
 
+const (
+	// editNonBlockingThreshold is the time within which an editor that
+	// returns successfully is assumed not to have waited for the files to be
+	// edited, for example because it opened them in an existing window.
+	editNonBlockingThreshold = time.Second
+	// editWatchInterval is the interval at which files are checked for
+	// changes when the editor does not wait for them to be edited.
+	editWatchInterval = 250 * time.Millisecond
+)
+
 type editCmdConfig struct {
-	apply  bool
-	diff   bool
-	prompt bool
+	Command      string
+	Args         []string
+	WatchTimeout time.Duration
+	apply        bool
+	diff         bool
+	prompt       bool
 }
 
 func init() {
 	rootCmd.AddCommand(editCmd)
 
 	persistentFlags := editCmd.PersistentFlags()
-	persistentFlags.BoolVarP(&config.edit.apply, "apply", "a", false, "apply edit after editing")
-	persistentFlags.BoolVarP(&config.edit.diff, "diff", "d", false, "print diff after editing")
-	persistentFlags.BoolVarP(&config.edit.prompt, "prompt", "p", false, "prompt before applying (implies --diff)")
-
-	markRemainingZshCompPositionalArgumentsAsFiles(editCmd, 1)
+	persistentFlags.BoolVarP(&config.Edit.apply, "apply", "a", false, "apply edit after editing")
+	persistentFlags.BoolVarP(&config.Edit.diff, "diff", "d", false, "print diff after editing")
+	persistentFlags.BoolVarP(&config.Edit.prompt, "prompt", "p", false, "prompt before applying (implies --diff)")
+	persistentFlags.StringArrayVar(&config.exclude, "exclude", nil, "exclude targets matching pattern")
 }
 
 type encryptedFile struct {
@@ -45,24 +60,31 @@ type encryptedFile struct {
 	file           *chezmoi.File
 	ciphertextPath string
 	plaintextPath  string
+	plaintext      []byte
+}
+
+type encryptedDir struct {
+	index         int
+	dir           *chezmoi.Dir
+	plaintextPath string
 }
 
 func (c *Config) runEditCmd(cmd *cobra.Command, args []string) error {
 	if len(args) == 0 {
-		if c.edit.apply {
+		if c.Edit.apply {
 			cmd.Printf("warning: --apply is currently ignored when edit is run with no arguments\n")
 		}
-		if c.edit.diff {
+		if c.Edit.diff {
 			cmd.Printf("warning: --diff is currently ignored when edit is run with no arguments\n")
 		}
-		if c.edit.prompt {
+		if c.Edit.prompt {
 			cmd.Printf("warning: --prompt is currently ignored when edit is run with no arguments\n")
 		}
 		return c.runEditor(c.SourceDir)
 	}
 
-	if c.edit.prompt {
-		c.edit.diff = true
+	if c.Edit.prompt {
+		c.Edit.diff = true
 	}
 
 	ts, err := c.getTargetState(&chezmoi.PopulateOptions{
@@ -76,33 +98,52 @@ func (c *Config) runEditCmd(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	if err := checkNotInEncryptedDirs(ts, entries); err != nil {
+		return err
+	}
 
 	// Build a list of source file names to pass to the editor. Check that each
-	// is either a file or a symlink. If the entry is an encrypted file then
-	// remember it.
+	// is either a file, a symlink, or an encrypted directory. If the entry is
+	// encrypted then remember it.
 	argv := make([]string, len(entries))
 	var encryptedFiles []encryptedFile
+	var encryptedDirs []encryptedDir
 	for i, entry := range entries {
-		argv[i] = filepath.Join(c.SourceDir, entry.SourceName())
-		if file, ok := entry.(*chezmoi.File); ok {
-			if file.Encrypted {
+		argv[i] = ts.SourcePath(entry)
+		switch entry := entry.(type) {
+		case *chezmoi.File:
+			if entry.Encrypted {
 				ef := encryptedFile{
 					index:          i,
-					file:           file,
+					file:           entry,
 					ciphertextPath: argv[i],
 				}
 				encryptedFiles = append(encryptedFiles, ef)
 			}
-		} else if _, ok := entry.(*chezmoi.Symlink); !ok {
-			return fmt.Errorf("%s: not a file or symlink", args[i])
+		case *chezmoi.Dir:
+			if !entry.Encrypted {
+				return fmt.Errorf("%s: not a file, symlink, or encrypted directory", args[i])
+			}
+			encryptedDirs = append(encryptedDirs, encryptedDir{
+				index: i,
+				dir:   entry,
+			})
+		case *chezmoi.Symlink:
+		default:
+			return fmt.Errorf("%s: not a file, symlink, or encrypted directory", args[i])
 		}
 	}
 
-	// If any of the files are encrypted, create a temporary directory to store
-	// the plaintext contents, decrypt each of them, and update argv to point to
-	// the plaintext file.
-	if len(encryptedFiles) != 0 {
-		tempDir, err := ioutil.TempDir("", "chezmoi")
+	// If any of the files or directories are encrypted, create a temporary
+	// directory to store the plaintext contents, decrypt each of them, and
+	// update argv to point to the plaintext file or directory. Templates are
+	// decrypted but not executed, so their template text is edited.
+	if len(encryptedFiles) != 0 || len(encryptedDirs) != 0 {
+		editTempDir, err := c.getEditTempDir()
+		if err != nil {
+			return err
+		}
+		tempDir, err := ioutil.TempDir(editTempDir, "chezmoi")
 		if err != nil {
 			return err
 		}
@@ -120,25 +161,121 @@ func (c *Config) runEditCmd(cmd *cobra.Command, args []string) error {
 			if err := renameio.WriteFile(ef.plaintextPath, plaintext, 0o600&^os.FileMode(c.Umask)); err != nil {
 				return err
 			}
+			ef.plaintext = plaintext
 			argv[ef.index] = ef.plaintextPath
 		}
+		// Encrypted directories are unpacked by applying them to the
+		// temporary directory.
+		unpackOptions := chezmoi.ApplyOptions{
+			DestDir: tempDir,
+			Ignore:  ts.TargetIgnore.Match,
+			Umask:   ts.Umask,
+		}
+		for i := range encryptedDirs {
+			ed := &encryptedDirs[i]
+			ed.plaintextPath = filepath.Join(tempDir, ed.dir.TargetName())
+			if err := os.MkdirAll(filepath.Dir(ed.plaintextPath), 0o700&^os.FileMode(c.Umask)); err != nil {
+				return err
+			}
+			if err := ed.dir.Apply(vfs.OSFS, chezmoi.NewFSMutator(vfs.OSFS), false, &unpackOptions); err != nil {
+				return err
+			}
+			argv[ed.index] = ed.plaintextPath
+		}
 	}
 
-	if err := c.runEditor(argv...); err != nil {
+	editorName, editorArgs, err := c.getEditor()
+	if err != nil {
+		return err
+	}
+	editorStart := time.Now()
+	if err := c.run("", editorName, append(editorArgs, argv...)...); err != nil {
 		return err
 	}
+	editorReturnedImmediately := time.Since(editorStart) < editNonBlockingThreshold
 
-	// Re-encrypt any encrypted files.
-	for _, ef := range encryptedFiles {
+	// Encrypted files are only re-encrypted if their plaintext changed, as
+	// encrypting the same plaintext again usually gives different ciphertext.
+	reencrypt := func(ef *encryptedFile) error {
 		plaintext, err := ioutil.ReadFile(ef.plaintextPath)
 		if err != nil {
 			return err
 		}
-		ciphertext, err := ts.GPG.Encrypt(ef.plaintextPath, plaintext)
+		if bytes.Equal(plaintext, ef.plaintext) {
+			return nil
+		}
+		ciphertext, err := ts.Encryption.Encrypt(plaintext)
+		if err != nil {
+			return err
+		}
+		currCiphertext, err := c.fs.ReadFile(ef.ciphertextPath)
+		if err != nil {
+			return err
+		}
+		if err := c.mutator.WriteFile(ef.ciphertextPath, ciphertext, 0o644, currCiphertext); err != nil {
+			return err
+		}
+		ef.plaintext = plaintext
+		return nil
+	}
+
+	rebundle := func(ed *encryptedDir) error {
+		return ts.UpdateEncryptedDir(vfs.OSFS, ed.dir, ed.plaintextPath, c.mutator)
+	}
+
+	// If the editor returned without waiting for the files to be edited then
+	// watch them for changes, re-encrypting encrypted files and directories
+	// after each change, until they have not changed for the watch timeout or
+	// the user interrupts. Only the addition and removal of entries in
+	// encrypted directories are noticed, but they are re-encrypted again
+	// afterwards.
+	if !c.DryRun && c.Edit.WatchTimeout > 0 && editorReturnedImmediately {
+		encryptedFilesByIndex := make(map[int]*encryptedFile)
+		for i := range encryptedFiles {
+			encryptedFilesByIndex[encryptedFiles[i].index] = &encryptedFiles[i]
+		}
+		encryptedDirsByIndex := make(map[int]*encryptedDir)
+		for i := range encryptedDirs {
+			encryptedDirsByIndex[encryptedDirs[i].index] = &encryptedDirs[i]
+		}
+		fmt.Fprintf(c.Stderr, "%s returned immediately, watching for changes until none are made for %s, press Ctrl-C to finish\n", editorName, c.Edit.WatchTimeout)
+		// Ctrl-C stops watching. The signal is only caught while watching,
+		// and the goroutine waiting for it ends when watching ends.
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-interrupt:
+				close(stop)
+			case <-done:
+			}
+		}()
+		err := watchFiles(argv, editWatchInterval, c.Edit.WatchTimeout, stop, func(i int) error {
+			if ef, ok := encryptedFilesByIndex[i]; ok {
+				return reencrypt(ef)
+			}
+			if ed, ok := encryptedDirsByIndex[i]; ok {
+				return rebundle(ed)
+			}
+			return nil
+		})
+		signal.Stop(interrupt)
+		close(done)
 		if err != nil {
 			return err
 		}
-		if err := renameio.WriteFile(ef.ciphertextPath, ciphertext, 0o644); err != nil {
+	}
+
+	// Re-encrypt any encrypted files and directories.
+	for i := range encryptedFiles {
+		if err := reencrypt(&encryptedFiles[i]); err != nil {
+			return err
+		}
+	}
+	for i := range encryptedDirs {
+		if err := rebundle(&encryptedDirs[i]); err != nil {
 			return err
 		}
 	}
@@ -154,6 +291,8 @@ func (c *Config) runEditCmd(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Print the diff of each entry, if requested, and choose the entries to
+	// apply. Only entries whose targets would change are applied.
 	readOnlyFS := vfs.NewReadOnlyFS(c.fs)
 	applyOptions := chezmoi.ApplyOptions{
 		DestDir:           ts.DestDir,
@@ -164,35 +303,121 @@ func (c *Config) runEditCmd(cmd *cobra.Command, args []string) error {
 		Umask:             ts.Umask,
 		Verbose:           c.Verbose,
 	}
-	for i, entry := range entries {
+	var applyArgs []string
+FOR:
+	for _, entry := range entries {
 		anyMutator := chezmoi.NewAnyMutator(chezmoi.NullMutator{})
 		var mutator chezmoi.Mutator = anyMutator
-		if c.edit.diff {
+		if c.Edit.diff {
 			mutator = chezmoi.NewVerboseMutator(c.Stdout, mutator, c.colored, c.maxDiffDataSize)
 		}
 		if err := entry.Apply(readOnlyFS, mutator, c.Follow, &applyOptions); err != nil {
 			return err
 		}
-		if c.edit.apply && anyMutator.Mutated() {
-			if c.edit.prompt {
-				choice, err := c.prompt(fmt.Sprintf("Apply %s", args[i]), "ynqa")
-				if err != nil {
-					return err
-				}
-				switch choice {
-				case 'y':
-				case 'n':
-					continue
-				case 'q':
-					return nil
-				case 'a':
-					c.edit.prompt = false
-				}
+		if !c.Edit.apply || !anyMutator.Mutated() {
+			continue
+		}
+		targetPath := filepath.Join(ts.DestDir, entry.TargetName())
+		if c.Edit.prompt {
+			choice, err := c.prompt(fmt.Sprintf("Apply %s", targetPath), "ynqa", 'n')
+			if err != nil {
+				return err
+			}
+			switch choice {
+			case 'y':
+			case 'n':
+				continue
+			case 'q':
+				break FOR
+			case 'a':
+				c.Edit.prompt = false
+			}
+		}
+		applyArgs = append(applyArgs, targetPath)
+	}
+	if len(applyArgs) == 0 {
+		return nil
+	}
+
+	// Apply the chosen entries in the same way as apply, so that the
+	// persistent state is updated.
+	persistentState, err := c.getPersistentState(nil)
+	if err != nil {
+		return err
+	}
+	defer persistentState.Close()
+	return c.applyTargetStateArgs(ts, applyArgs, persistentState)
+}
+
+// getEditTempDir returns the directory in which edit creates temporary
+// directories for the plaintext of encrypted files and directories. It prefers
+// directories that are usually on a tmpfs, so that plaintext is not written to
+// disk: the XDG runtime directory, then /dev/shm. If neither exists then it
+// returns the empty string, meaning the system temporary directory.
+func (c *Config) getEditTempDir() (string, error) {
+	if c.bds.RuntimeDir != "" {
+		tempDir, err := c.fs.RawPath(filepath.Join(c.bds.RuntimeDir, "chezmoi"))
+		if err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(tempDir, 0o700); err != nil {
+			return "", err
+		}
+		return tempDir, nil
+	}
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		return "/dev/shm", nil
+	}
+	return "", nil
+}
+
+// watchFiles checks paths for changes every interval, calling changed with the
+// index of each path that changes, until no path has changed for idleTimeout
+// or stop is closed. Paths that do not exist, for example because an editor is
+// replacing them, are checked again at the next interval.
+func watchFiles(paths []string, interval, idleTimeout time.Duration, stop <-chan struct{}, changed func(int) error) error {
+	infos := make([]os.FileInfo, len(paths))
+	for i, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		infos[i] = info
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	idle := time.NewTimer(idleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-idle.C:
+			return nil
+		case <-ticker.C:
+		}
+		for i, path := range paths {
+			info, err := os.Stat(path)
+			switch {
+			case os.IsNotExist(err):
+				continue
+			case err != nil:
+				return err
+			case infos[i] != nil && info.ModTime().Equal(infos[i].ModTime()) && info.Size() == infos[i].Size():
+				continue
 			}
-			if err := entry.Apply(readOnlyFS, c.mutator, c.Follow, &applyOptions); err != nil {
+			infos[i] = info
+			if err := changed(i); err != nil {
 				return err
 			}
+			if !idle.Stop() {
+				select {
+				case <-idle.C:
+				default:
+				}
+			}
+			idle.Reset(idleTimeout)
 		}
 	}
-	return nil
 }
@@ -0,0 +1,305 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+func TestEditEncryptedDir(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	// fakeAge "encrypts" and "decrypts" its standard input with rot13.
+	fakeAge := filepath.Join(tempDir, "age")
+	require.NoError(t, ioutil.WriteFile(fakeAge, []byte("#!/bin/sh\ntr a-zA-Z n-za-mN-ZA-M\n"), 0o755))
+	// fakeEditor adds a file to the directory that it is editing.
+	fakeEditor := filepath.Join(tempDir, "editor")
+	require.NoError(t, ioutil.WriteFile(fakeEditor, []byte("#!/bin/sh\necho new > \"$1/new\"\n"), 0o755))
+
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.gnupg": &vfst.Dir{
+			Perm: 0o700,
+			Entries: map[string]interface{}{
+				"gpg.conf": "use-agent\n",
+			},
+		},
+		"/home/user/.local/share/chezmoi": &vfst.Dir{Perm: 0o700},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	newConfig := func(options ...configOption) *Config {
+		c := newTestConfig(fs, options...)
+		c.Encryption.Method = "age"
+		c.Age.Command = fakeAge
+		c.Age.Identity = "/home/user/key.txt"
+		c.Age.Recipient = "age1recipient"
+		c.Edit.Command = fakeEditor
+		return c
+	}
+
+	c := newConfig()
+	c.Add.options.Encrypt = true
+	require.NoError(t, c.runAddCmd(nil, []string{"/home/user/.gnupg"}))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.local/share/chezmoi/encrypted_private_dot_gnupg/bundle",
+			vfst.TestModeIsRegular,
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/encrypted_private_dot_gnupg/gpg.conf",
+			vfst.TestDoesNotExist,
+		),
+	)
+
+	// diff compares the unpacked contents.
+	require.NoError(t, fs.WriteFile("/home/user/.gnupg/gpg.conf", []byte("no-use-agent\n"), 0o644))
+	stdout := &bytes.Buffer{}
+	c = newConfig(withStdout(stdout))
+	c.Diff.NoPager = true
+	require.NoError(t, c.runDiffCmd(nil, nil))
+	assert.Contains(t, stdout.String(), "-no-use-agent\n")
+	assert.Contains(t, stdout.String(), "+use-agent\n")
+
+	// edit unpacks the directory, and bundles it again after editing.
+	c = newConfig(withStdout(&bytes.Buffer{}))
+	require.NoError(t, c.runEditCmd(nil, []string{"/home/user/.gnupg"}))
+	stdout.Reset()
+	c = newConfig(withStdout(stdout))
+	require.NoError(t, c.runCatCmd(nil, []string{"/home/user/.gnupg/new"}))
+	assert.Equal(t, "new\n", stdout.String())
+
+	// Targets inside encrypted directories cannot be forgotten separately.
+	c = newConfig()
+	assert.EqualError(t, c.runForgetCmd(nil, []string{"/home/user/.gnupg/gpg.conf"}), "/home/user/.gnupg/gpg.conf: inside encrypted directory /home/user/.gnupg")
+}
+
+func TestEditApplyAndDiff(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		apply         bool
+		diff          bool
+		editorStatus  int
+		expectedErr   bool
+		expectedDiff  bool
+		expectedApply bool
+	}{
+		{
+			name:          "apply",
+			apply:         true,
+			expectedApply: true,
+		},
+		{
+			name:         "diff",
+			diff:         true,
+			expectedDiff: true,
+		},
+		{
+			name:          "apply_diff",
+			apply:         true,
+			diff:          true,
+			expectedDiff:  true,
+			expectedApply: true,
+		},
+		{
+			name:         "editor_fails",
+			apply:        true,
+			diff:         true,
+			editorStatus: 1,
+			expectedErr:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+				"/home/user": map[string]interface{}{
+					".bashrc": "# contents of .bashrc\n",
+					".local/share/chezmoi": map[string]interface{}{
+						"dot_bashrc":  "# contents of .bashrc\n",
+						"dot_profile": "# contents of .profile\n",
+						"dot_zshrc":   "# contents of .zshrc\n",
+					},
+					".profile": "# contents of .profile\n",
+					".zshrc":   "# contents of .zshrc\n",
+				},
+			})
+			require.NoError(t, err)
+			defer cleanup()
+
+			// fakeEditor appends a line to each of the files that it edits,
+			// which are inside fs, and then exits with the test's status.
+			root, err := fs.RawPath("/")
+			require.NoError(t, err)
+			fakeEditor := filepath.Join(root, "editor")
+			require.NoError(t, ioutil.WriteFile(fakeEditor, []byte(strings.Join([]string{
+				"#!/bin/sh",
+				`for f; do echo "# edited" >> "` + root + `$f"; done`,
+				"exit " + strconv.Itoa(tc.editorStatus),
+			}, "\n")), 0o755))
+
+			stdout := &bytes.Buffer{}
+			c := newTestConfig(fs, withStdout(stdout))
+			c.Edit.Command = fakeEditor
+			c.Edit.apply = tc.apply
+			c.Edit.diff = tc.diff
+			err = c.runEditCmd(nil, []string{"/home/user/.bashrc", "/home/user/.zshrc"})
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if tc.expectedDiff {
+				assert.Contains(t, stdout.String(), "+# edited\n")
+			} else {
+				assert.NotContains(t, stdout.String(), "+# edited\n")
+			}
+			var tests []interface{}
+			for _, name := range []string{".bashrc", ".zshrc"} {
+				expectedContents := "# contents of " + name + "\n"
+				if tc.expectedApply {
+					expectedContents += "# edited\n"
+				}
+				tests = append(tests, vfst.TestPath("/home/user/"+name,
+					vfst.TestContentsString(expectedContents),
+				))
+			}
+			tests = append(tests, vfst.TestPath("/home/user/.profile",
+				vfst.TestContentsString("# contents of .profile\n"),
+			))
+			vfst.RunTests(t, fs, "", tests...)
+		})
+	}
+}
+
+func TestEditWatchesEditorThatReturnsImmediately(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	// fakeAge "encrypts" and "decrypts" its standard input with rot13.
+	fakeAge := filepath.Join(tempDir, "age")
+	require.NoError(t, ioutil.WriteFile(fakeAge, []byte("#!/bin/sh\ntr a-zA-Z n-za-mN-ZA-M\n"), 0o755))
+	// fakeEditor returns immediately and edits the file in the background.
+	fakeEditor := filepath.Join(tempDir, "editor")
+	require.NoError(t, ioutil.WriteFile(fakeEditor, []byte("#!/bin/sh\n( sleep 0.5; echo edited >> \"$1\" ) >/dev/null 2>&1 &\n"), 0o755))
+
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".local/share/chezmoi": &vfst.Dir{Perm: 0o700},
+			".netrc":               "machine\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	newConfig := func(options ...configOption) *Config {
+		c := newTestConfig(fs, options...)
+		c.Encryption.Method = "age"
+		c.Age.Command = fakeAge
+		c.Age.Identity = "/home/user/key.txt"
+		c.Age.Recipient = "age1recipient"
+		c.Edit.Command = fakeEditor
+		return c
+	}
+
+	c := newConfig()
+	c.Add.options.Encrypt = true
+	require.NoError(t, c.runAddCmd(nil, []string{"/home/user/.netrc"}))
+
+	stderr := &bytes.Buffer{}
+	c = newConfig(withStderr(stderr), withEditWatchTimeout(2*time.Second))
+	require.NoError(t, c.runEditCmd(nil, []string{"/home/user/.netrc"}))
+	assert.Contains(t, stderr.String(), "returned immediately, watching for changes")
+
+	stdout := &bytes.Buffer{}
+	require.NoError(t, newConfig(withStdout(stdout)).runCatCmd(nil, []string{"/home/user/.netrc"}))
+	assert.Equal(t, "machine\nedited\n", stdout.String())
+}
+
+func TestEditEncryptedFile(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	// fakeAge "encrypts" and "decrypts" its standard input with rot13.
+	fakeAge := filepath.Join(tempDir, "age")
+	require.NoError(t, ioutil.WriteFile(fakeAge, []byte("#!/bin/sh\ntr a-zA-Z n-za-mN-ZA-M\n"), 0o755))
+	// fakeEditor copies the file that it is editing to seen, and then runs
+	// the command in $EDIT, if any.
+	seen := filepath.Join(tempDir, "seen")
+	fakeEditor := filepath.Join(tempDir, "editor")
+	require.NoError(t, ioutil.WriteFile(fakeEditor, []byte("#!/bin/sh\ncp \"$1\" "+seen+"\neval \"$EDIT\"\n"), 0o755))
+
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".local/share/chezmoi": &vfst.Dir{Perm: 0o700},
+			".netrc":               "{{ .chezmoi.os }}\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	newConfig := func() *Config {
+		c := newTestConfig(fs, withStdout(&bytes.Buffer{}))
+		c.Encryption.Method = "age"
+		c.Age.Command = fakeAge
+		c.Age.Identity = "/home/user/key.txt"
+		c.Age.Recipient = "age1recipient"
+		c.Edit.Command = fakeEditor
+		return c
+	}
+
+	c := newConfig()
+	c.Add.options.Encrypt = true
+	require.NoError(t, c.runAddCmd(nil, []string{"/home/user/.netrc"}))
+	require.NoError(t, newConfig().runChattrCmd(nil, []string{"+template", "/home/user/.netrc"}))
+	ciphertextPath, err := fs.RawPath("/home/user/.local/share/chezmoi/encrypted_private_dot_netrc.tmpl")
+	require.NoError(t, err)
+	ciphertext, err := ioutil.ReadFile(ciphertextPath)
+	require.NoError(t, err)
+
+	// The ciphertext is not rewritten if the plaintext does not change. The
+	// editor is given the template text, not its output.
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(ciphertextPath, mtime, mtime))
+	require.NoError(t, newConfig().runEditCmd(nil, []string{"/home/user/.netrc"}))
+	seenContents, err := ioutil.ReadFile(seen)
+	require.NoError(t, err)
+	assert.Equal(t, "{{ .chezmoi.os }}\n", string(seenContents))
+	info, err := os.Stat(ciphertextPath)
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(mtime))
+
+	// Changed plaintext is encrypted again.
+	require.NoError(t, os.Setenv("EDIT", `echo edited >> "$1"`))
+	defer os.Unsetenv("EDIT")
+	require.NoError(t, newConfig().runEditCmd(nil, []string{"/home/user/.netrc"}))
+	newCiphertext, err := ioutil.ReadFile(ciphertextPath)
+	require.NoError(t, err)
+	assert.Equal(t, string(ciphertext)+"rqvgrq\n", string(newCiphertext))
+
+	// The plaintext is removed even if the editor fails.
+	require.NoError(t, os.Setenv("EDIT", "exit 1"))
+	assert.Error(t, newConfig().runEditCmd(nil, []string{"/home/user/.netrc"}))
+	newCiphertext2, err := ioutil.ReadFile(ciphertextPath)
+	require.NoError(t, err)
+	assert.Equal(t, newCiphertext, newCiphertext2)
+	infos, err := fs.ReadDir("/home/user/.run/chezmoi")
+	require.NoError(t, err)
+	assert.Empty(t, infos)
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/renameio"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchFiles(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	paths := []string{
+		filepath.Join(tempDir, "a"),
+		filepath.Join(tempDir, "b"),
+	}
+	for _, path := range paths {
+		require.NoError(t, ioutil.WriteFile(path, []byte("# old\n"), 0o600))
+	}
+
+	t.Run("idle_timeout", func(t *testing.T) {
+		var changed []int
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			assert.NoError(t, renameio.WriteFile(paths[1], []byte("# new\n"), 0o600))
+		}()
+		require.NoError(t, watchFiles(paths, 10*time.Millisecond, 250*time.Millisecond, nil, func(i int) error {
+			changed = append(changed, i)
+			return nil
+		}))
+		assert.Equal(t, []int{1}, changed)
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		stop := make(chan struct{})
+		close(stop)
+		require.NoError(t, watchFiles(paths, 10*time.Millisecond, time.Hour, stop, func(i int) error {
+			t.Errorf("unexpected change to %s", paths[i])
+			return nil
+		}))
+	})
+}
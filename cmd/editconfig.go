@@ -7,7 +7,6 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	vfs "github.com/twpayne/go-vfs"
-	vfsafero "github.com/twpayne/go-vfsafero"
 )
 
 var editConfigCommand = &cobra.Command{
@@ -34,9 +33,7 @@ func (c *Config) runEditConfigCmd(cmd *cobra.Command, args []string) error {
 
 	// Warn the user of any errors reading the config file.
 	v := viper.New()
-	v.SetFs(vfsafero.NewAferoFS(c.fs))
-	v.SetConfigFile(c.configFile)
-	err := v.ReadInConfig()
+	err := readConfigFile(v, c.fs, c.configFile)
 	if err == nil {
 		err = v.Unmarshal(&Config{})
 	}
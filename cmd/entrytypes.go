@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+// An entryTypeSet is a set of types of entry.
+type entryTypeSet int
+
+// Types of entry.
+const (
+	entryTypeDirs entryTypeSet = 1 << iota
+	entryTypeFiles
+	entryTypeSymlinks
+	entryTypeScripts
+
+	entryTypesAll = entryTypeDirs | entryTypeFiles | entryTypeSymlinks | entryTypeScripts
+)
+
+// entryTypeNames maps the names of types of entry, and their abbreviations, to
+// entryTypeSets.
+var entryTypeNames = map[string]entryTypeSet{
+	"all":      entryTypesAll,
+	"dirs":     entryTypeDirs,
+	"d":        entryTypeDirs,
+	"files":    entryTypeFiles,
+	"f":        entryTypeFiles,
+	"scripts":  entryTypeScripts,
+	"symlinks": entryTypeSymlinks,
+	"s":        entryTypeSymlinks,
+}
+
+// entryTypeWords are the names of types of entry offered as completions.
+var entryTypeWords = []string{"all", "dirs", "files", "scripts", "symlinks"}
+
+// parseEntryTypeSet parses names into an entryTypeSet.
+func parseEntryTypeSet(names []string) (entryTypeSet, error) {
+	var ets entryTypeSet
+	for _, name := range names {
+		et, ok := entryTypeNames[name]
+		if !ok {
+			return 0, fmt.Errorf("%s: unknown entry type", name)
+		}
+		ets |= et
+	}
+	return ets, nil
+}
+
+// includes returns whether entry's type is in ets.
+func (ets entryTypeSet) includes(entry chezmoi.Entry) bool {
+	switch entry.(type) {
+	case *chezmoi.Dir:
+		return ets&entryTypeDirs != 0
+	case *chezmoi.File:
+		return ets&entryTypeFiles != 0
+	case *chezmoi.Symlink:
+		return ets&entryTypeSymlinks != 0
+	case *chezmoi.Script:
+		return ets&entryTypeScripts != 0
+	default:
+		return false
+	}
+}
+
+// filtersEntries returns whether the entry types in include, or c.exclude,
+// exclude any entries. Filtering copies directories, so it is skipped if not.
+func (c *Config) filtersEntries(include []string) bool {
+	if len(c.exclude) != 0 {
+		return true
+	}
+	if len(include) == 0 {
+		return false
+	}
+	// Unknown entry types are reported by getEntryFilter.
+	includeTypes, err := parseEntryTypeSet(include)
+	return err != nil || includeTypes != entryTypesAll
+}
+
+// getEntryFilter returns a function that returns whether an entry should be
+// included, given the entry types in include, or all types if include is
+// empty. Values of --exclude that are entry types exclude entries of that type,
+// and all other values exclude targets matching them and everything inside
+// them.
+func (c *Config) getEntryFilter(ts *chezmoi.TargetState, include []string) (func(chezmoi.Entry) bool, error) {
+	includeTypes := entryTypesAll
+	if len(include) != 0 {
+		var err error
+		if includeTypes, err = parseEntryTypeSet(include); err != nil {
+			return nil, err
+		}
+	}
+	var excludeTypes entryTypeSet
+	for _, exclude := range c.exclude {
+		excludeTypes |= entryTypeNames[exclude]
+	}
+	excluded, err := c.getExcluded(ts)
+	if err != nil {
+		return nil, err
+	}
+	return func(entry chezmoi.Entry) bool {
+		if !includeTypes.includes(entry) || excludeTypes.includes(entry) {
+			return false
+		}
+		for targetName := entry.TargetName(); targetName != "."; targetName = filepath.Dir(targetName) {
+			if excluded(targetName) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
@@ -1,17 +1,39 @@
 package cmd
 
 import (
+	"fmt"
 	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	vfs "github.com/twpayne/go-vfs"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
+// executeTemplateWatchInterval is the interval at which execute-template
+// --watch checks for changes.
+const executeTemplateWatchInterval = 250 * time.Millisecond
+
+// executeTemplateErrorRegexp matches the template name and line number in
+// template errors.
+var executeTemplateErrorRegexp = regexp.MustCompile(`template: (.*?):(\d+):`)
+
 type executeTemplateCmdConfig struct {
 	init         bool
 	output       string
+	promptBool   map[string]string
+	promptInt    map[string]int
 	promptString map[string]string
+	watch        bool
+	cacheSecrets bool
 }
 
 var executeTemplateCmd = &cobra.Command{
@@ -29,17 +51,58 @@ func init() {
 	persistentFlags := executeTemplateCmd.PersistentFlags()
 	persistentFlags.BoolVarP(&config.executeTemplate.init, "init", "i", false, "simulate chezmoi init")
 	persistentFlags.StringVarP(&config.executeTemplate.output, "output", "o", "", "output filename")
+	persistentFlags.StringToStringVar(&config.executeTemplate.promptBool, "promptBool", nil, "simulate promptBool")
+	persistentFlags.StringToIntVar(&config.executeTemplate.promptInt, "promptInt", nil, "simulate promptInt")
 	persistentFlags.StringToStringVarP(&config.executeTemplate.promptString, "promptString", "p", nil, "simulate promptString")
+	persistentFlags.BoolVar(&config.executeTemplate.watch, "watch", false, "execute template files whenever they change")
+	persistentFlags.BoolVar(&config.executeTemplate.cacheSecrets, "cache-secrets", true, "with --watch, retrieve secrets only once")
 }
 
 func (c *Config) runExecuteTemplateCmd(cmd *cobra.Command, args []string) error {
 	if c.executeTemplate.init {
-		c.templateFuncs["promptString"] = func(prompt string) string {
+		promptString := func(prompt string) string {
 			if value, ok := c.executeTemplate.promptString[prompt]; ok {
 				return value
 			}
 			return prompt
 		}
+		promptBool := func(prompt string) bool {
+			if value, ok := c.executeTemplate.promptBool[prompt]; ok {
+				b, err := strconv.ParseBool(value)
+				panicOnError(err)
+				return b
+			}
+			return false
+		}
+		promptInt := func(prompt string) int64 {
+			if value, ok := c.executeTemplate.promptInt[prompt]; ok {
+				return int64(value)
+			}
+			return 0
+		}
+		for name, f := range map[string]interface{}{
+			"promptBool":   promptBool,
+			"promptInt":    promptInt,
+			"promptString": promptString,
+		} {
+			c.templateFuncs[name] = f
+			c.templateFuncs[chezmoiTemplateFuncPrefix+name] = f
+		}
+	}
+
+	if c.executeTemplate.watch {
+		if len(args) == 0 {
+			return fmt.Errorf("--watch requires template files")
+		}
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		defer signal.Stop(interrupt)
+		stop := make(chan struct{})
+		go func() {
+			<-interrupt
+			close(stop)
+		}()
+		return c.watchExecuteTemplateFiles(args, executeTemplateWatchInterval, stop)
 	}
 
 	ts, err := c.getTargetState(nil)
@@ -72,9 +135,210 @@ func (c *Config) runExecuteTemplateCmd(cmd *cobra.Command, args []string) error
 		}
 	}
 
+	return c.writeExecuteTemplateOutput(output.String())
+}
+
+// writeExecuteTemplateOutput writes output to the output file, or to stdout if
+// there is none.
+func (c *Config) writeExecuteTemplateOutput(output string) error {
 	if c.executeTemplate.output == "" {
-		_, err = c.Stdout.Write([]byte(output.String()))
+		_, err := c.Stdout.Write([]byte(output))
 		return err
 	}
-	return c.fs.WriteFile(c.executeTemplate.output, []byte(output.String()), 0o666)
+	return c.fs.WriteFile(c.executeTemplate.output, []byte(output), 0o666)
+}
+
+// watchExecuteTemplateFiles executes the template files paths, and executes
+// them again whenever they, the templates in .chezmoitemplates, the config
+// file, or the .chezmoidata files change, checking every interval until stop
+// is closed. Errors executing the templates are printed instead of returned.
+func (c *Config) watchExecuteTemplateFiles(paths []string, interval time.Duration, stop <-chan struct{}) error {
+	clearScreen := false
+	if stdout, ok := c.Stdout.(*os.File); ok && c.executeTemplate.output == "" {
+		clearScreen = terminal.IsTerminal(int(stdout.Fd()))
+	}
+
+	executed := false
+	prevState := ""
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		state, err := c.getExecuteTemplateWatchState(paths)
+		if err != nil {
+			return err
+		}
+		if !executed || state != prevState {
+			if err := c.executeTemplateFilesAgain(paths, executed, clearScreen); err != nil {
+				return err
+			}
+			executed = true
+			prevState = state
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// executeTemplateFilesAgain executes the template files paths and writes the
+// result, or the error. If reload is true then the data in the config file is
+// read again first, but the rest of the config is not.
+func (c *Config) executeTemplateFilesAgain(paths []string, reload, clearScreen bool) error {
+	if clearScreen {
+		if _, err := fmt.Fprint(c.Stdout, "\x1b[H\x1b[2J"); err != nil {
+			return err
+		}
+	}
+	if !c.executeTemplate.cacheSecrets {
+		clearSecretCaches()
+	}
+	var err error
+	if reload {
+		var data map[string]interface{}
+		switch data, err = c.readConfigFileData(); {
+		case os.IsNotExist(err):
+			c.Data, err = nil, nil
+		case err == nil:
+			c.Data = data
+		default:
+			err = fmt.Errorf("%s: %w", c.configFile, err)
+		}
+	}
+	if err == nil {
+		var output string
+		if output, err = c.executeTemplateFiles(paths); err == nil {
+			return c.writeExecuteTemplateOutput(output)
+		}
+	}
+	_, err = fmt.Fprint(c.Stdout, formatExecuteTemplateError(c.fs, paths, err))
+	return err
+}
+
+// executeTemplateFiles returns the result of executing the template files
+// paths with a freshly populated target state.
+func (c *Config) executeTemplateFiles(paths []string) (string, error) {
+	ts, err := c.getTargetState(nil)
+	if err != nil {
+		return "", err
+	}
+	output := &strings.Builder{}
+	for _, path := range paths {
+		data, err := c.fs.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		result, err := ts.ExecuteTemplateData(path, data)
+		if err != nil {
+			return "", err
+		}
+		if _, err := output.Write(result); err != nil {
+			return "", err
+		}
+	}
+	return output.String(), nil
+}
+
+// getExecuteTemplateWatchState returns a string that changes whenever the
+// files that the template files paths depend on change.
+func (c *Config) getExecuteTemplateWatchState(paths []string) (string, error) {
+	watchPaths := append([]string{}, paths...)
+	if c.configFile != "" {
+		watchPaths = append(watchPaths, c.configFile)
+	}
+	sourceRoots, err := c.getSourceRoots(c.SourceDir)
+	if err != nil {
+		return "", err
+	}
+	for _, sourceRoot := range sourceRoots {
+		for _, format := range formats() {
+			watchPaths = append(watchPaths, filepath.Join(sourceRoot, dataName+"."+format))
+		}
+		templatesDir := filepath.Join(sourceRoot, templatesDirName)
+		if err := vfs.Walk(c.fs, templatesDir, func(path string, info os.FileInfo, err error) error {
+			switch {
+			case os.IsNotExist(err):
+				return nil
+			case err != nil:
+				return err
+			case info.Mode().IsRegular():
+				watchPaths = append(watchPaths, path)
+			}
+			return nil
+		}); err != nil {
+			return "", err
+		}
+	}
+	sort.Strings(watchPaths)
+
+	sb := &strings.Builder{}
+	for _, path := range watchPaths {
+		info, err := c.fs.Stat(path)
+		switch {
+		case os.IsNotExist(err):
+			continue
+		case err != nil:
+			return "", err
+		}
+		fmt.Fprintf(sb, "%s %d %d\n", path, info.ModTime().UnixNano(), info.Size())
+	}
+	return sb.String(), nil
+}
+
+// readConfigFileData returns the data in the config file.
+func (c *Config) readConfigFileData() (map[string]interface{}, error) {
+	v := viper.New()
+	if err := readConfigFile(v, c.fs, c.configFile); err != nil {
+		return nil, err
+	}
+	var config struct {
+		Data map[string]interface{}
+	}
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, err
+	}
+	if err := validateKeys(config.Data, identifierRegexp); err != nil {
+		return nil, err
+	}
+	return config.Data, nil
+}
+
+// formatExecuteTemplateError returns err followed, if it refers to a line in
+// one of the template files paths, by that line and its neighbours with their
+// line numbers.
+func formatExecuteTemplateError(fs vfs.FS, paths []string, err error) string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "error: %v\n", err)
+	match := executeTemplateErrorRegexp.FindStringSubmatch(err.Error())
+	if match == nil {
+		return sb.String()
+	}
+	isPath := false
+	for _, path := range paths {
+		if path == match[1] {
+			isPath = true
+			break
+		}
+	}
+	if !isPath {
+		return sb.String()
+	}
+	data, readErr := fs.ReadFile(match[1])
+	if readErr != nil {
+		return sb.String()
+	}
+	lineNumber, _ := strconv.Atoi(match[2])
+	lines := strings.Split(string(data), "\n")
+	for i := lineNumber - 2; i <= lineNumber; i++ {
+		if i < 0 || i >= len(lines) {
+			continue
+		}
+		marker := " "
+		if i == lineNumber-1 {
+			marker = ">"
+		}
+		fmt.Fprintf(sb, "%s %4d | %s\n", marker, i+1, lines[i])
+	}
+	return sb.String()
 }
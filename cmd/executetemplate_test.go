@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+// A syncBuffer is a bytes.Buffer that can be written and read concurrently.
+type syncBuffer struct {
+	sync.Mutex
+	b bytes.Buffer
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.b.String()
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.b.Write(p)
+}
+
+func TestExecuteTemplateCmdWatch(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.config/chezmoi/chezmoi.toml":                "[data]\n  x = \"1\"\n",
+		"/home/user/.local/share/chezmoi/.chezmoitemplates/part": "a",
+		"/home/user/template.tmpl":                               "{{ template \"part\" . }}-{{ .x }}\n",
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	stdout := &syncBuffer{}
+	c := newTestConfig(fs, withStdout(stdout), withData(map[string]interface{}{
+		"x": "1",
+	}))
+	c.configFile = "/home/user/.config/chezmoi/chezmoi.toml"
+	c.executeTemplate.cacheSecrets = true
+
+	stop := make(chan struct{})
+	errCh := make(chan error)
+	go func() {
+		errCh <- c.watchExecuteTemplateFiles([]string{"/home/user/template.tmpl"}, 10*time.Millisecond, stop)
+	}()
+
+	waitForOutput := func(s string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !strings.Contains(stdout.String(), s) {
+			if time.Now().After(deadline) {
+				require.FailNow(t, "timeout waiting for output", "expected %q in %q", s, stdout.String())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Changes to shared templates, the config file's data, and the template
+	// itself are picked up.
+	waitForOutput("a-1\n")
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/.chezmoitemplates/part", []byte("bb"), 0o666))
+	waitForOutput("bb-1\n")
+	require.NoError(t, fs.WriteFile("/home/user/.config/chezmoi/chezmoi.toml", []byte("[data]\n  x = \"22\"\n"), 0o666))
+	waitForOutput("bb-22\n")
+	require.NoError(t, fs.WriteFile("/home/user/template.tmpl", []byte("ok\n{{ nosuchfunc }}\n"), 0o666))
+	waitForOutput(">    2 | {{ nosuchfunc }}\n")
+	assert.Contains(t, stdout.String(), "error: template: /home/user/template.tmpl:2: function \"nosuchfunc\" not defined\n")
+	assert.Contains(t, stdout.String(), "     1 | ok\n")
+
+	close(stop)
+	assert.NoError(t, <-errCh)
+}
@@ -1,8 +1,6 @@
 package cmd
 
 import (
-	"path/filepath"
-
 	"github.com/spf13/cobra"
 )
 
@@ -21,7 +19,8 @@ var forgetCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(forgetCmd)
 
-	markRemainingZshCompPositionalArgumentsAsFiles(forgetCmd, 1)
+	persistentFlags := forgetCmd.PersistentFlags()
+	persistentFlags.StringArrayVar(&config.exclude, "exclude", nil, "exclude targets matching pattern")
 }
 
 func (c *Config) runForgetCmd(cmd *cobra.Command, args []string) error {
@@ -33,8 +32,11 @@ func (c *Config) runForgetCmd(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	if err := checkNotInEncryptedDirs(ts, entries); err != nil {
+		return err
+	}
 	for _, entry := range entries {
-		if err := c.mutator.RemoveAll(filepath.Join(c.SourceDir, entry.SourceName())); err != nil {
+		if err := c.mutator.RemoveAll(ts.SourcePath(entry)); err != nil {
 			return err
 		}
 	}
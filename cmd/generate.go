@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+var generateFormats = []string{"sh", "powershell"}
+
+var generateAssets = map[string]string{
+	"sh":         "assets/templates/install.sh.tmpl",
+	"powershell": "assets/templates/install.ps1.tmpl",
+}
+
+type generateCmdConfig struct {
+	format string
+	output string
+	repo   string
+}
+
+var generateCmd = &cobra.Command{
+	Use:       "generate install.sh",
+	Args:      cobra.ExactArgs(1),
+	Short:     "Generate a script that installs chezmoi and initializes it from your repo",
+	Long:      mustGetLongHelp("generate"),
+	Example:   getExample("generate"),
+	ValidArgs: []string{"install.sh"},
+	PreRunE:   config.ensureNoError,
+	RunE:      config.runGenerateCmd,
+}
+
+func init() {
+	rootCmd.AddCommand(generateCmd)
+
+	persistentFlags := generateCmd.PersistentFlags()
+	persistentFlags.StringVar(&config.generate.format, "format", "sh", "format ("+strings.Join(generateFormats, ", ")+")")
+	persistentFlags.StringVarP(&config.generate.output, "output", "o", "", "output filename")
+	persistentFlags.StringVar(&config.generate.repo, "repo", "", "repo to initialize from")
+	panicOnError(generateCmd.MarkPersistentFlagFilename("output"))
+	panicOnError(generateCmd.RegisterFlagCompletionFunc("format", completeWords(generateFormats)))
+}
+
+func (c *Config) runGenerateCmd(cmd *cobra.Command, args []string) error {
+	if args[0] != "install.sh" {
+		return fmt.Errorf("%s: unsupported file", args[0])
+	}
+	asset, ok := generateAssets[c.generate.format]
+	if !ok {
+		return fmt.Errorf("%s: unsupported format", c.generate.format)
+	}
+
+	repo := c.generate.repo
+	if repo == "" {
+		var err error
+		repo, err = c.getRemoteURL()
+		if err != nil {
+			return err
+		}
+	}
+	// The repo is embedded in comments, so it must not contain newlines.
+	if strings.ContainsAny(repo, "\r\n") {
+		return fmt.Errorf("%q: invalid repo", repo)
+	}
+
+	output, err := generateInstallScript(asset, repo)
+	if err != nil {
+		return err
+	}
+
+	if c.generate.output == "" {
+		_, err = c.Stdout.Write(output)
+		return err
+	}
+	return c.fs.WriteFile(c.generate.output, output, 0o777)
+}
+
+// getRemoteURL returns the URL of the source directory's upstream repo.
+func (c *Config) getRemoteURL() (string, error) {
+	vcs, err := c.getVCS()
+	if err != nil {
+		return "", err
+	}
+	if vcs.RemoteURLArgs() == nil {
+		return "", fmt.Errorf("%s: remote URL not supported, use --repo", c.SourceVCS.Command)
+	}
+	output, err := c.output(c.SourceDir, c.SourceVCS.Command, vcs.RemoteURLArgs()...)
+	if err != nil {
+		return "", fmt.Errorf("cannot determine repo, use --repo: %w", err)
+	}
+	remoteURL := strings.TrimSpace(string(output))
+	if remoteURL == "" {
+		return "", fmt.Errorf("cannot determine repo, use --repo")
+	}
+	return remoteURL, nil
+}
+
+// generateInstallScript returns the install script generated from the template
+// asset for repo.
+func generateInstallScript(asset, repo string) ([]byte, error) {
+	text, err := getAsset(asset)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(asset).Funcs(template.FuncMap{
+		"powershellQuote": powershellQuote,
+		"shellQuote":      chezmoi.MaybeShellQuote,
+	}).Parse(string(text))
+	if err != nil {
+		return nil, err
+	}
+	sb := &strings.Builder{}
+	if err := tmpl.Execute(sb, struct {
+		Repo string
+	}{
+		Repo: repo,
+	}); err != nil {
+		return nil, err
+	}
+	return []byte(sb.String()), nil
+}
+
+// powershellQuote returns s as a PowerShell single-quoted string.
+func powershellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
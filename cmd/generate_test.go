@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+func TestGenerateCmd(t *testing.T) {
+	for _, tc := range []struct {
+		format     string
+		goldenFile string
+	}{
+		{
+			format:     "sh",
+			goldenFile: "install.sh.golden",
+		},
+		{
+			format:     "powershell",
+			goldenFile: "install.ps1.golden",
+		},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+				"/home/user": &vfst.Dir{Perm: 0o755},
+			})
+			require.NoError(t, err)
+			defer cleanup()
+			stdout := &bytes.Buffer{}
+			c := newTestConfig(fs, withStdout(stdout))
+			c.generate.format = tc.format
+			c.generate.repo = "https://github.com/user/dotfiles.git"
+			require.NoError(t, c.runGenerateCmd(nil, []string{"install.sh"}))
+
+			goldenPath := filepath.Join("testdata", "generate", tc.goldenFile)
+			if *updateGolden {
+				require.NoError(t, ioutil.WriteFile(goldenPath, stdout.Bytes(), 0o666))
+			}
+			expected, err := ioutil.ReadFile(goldenPath)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), stdout.String())
+		})
+	}
+}
+
+func TestGenerateCmdErrors(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	c := newTestConfig(fs)
+	c.generate.format = "sh"
+	c.generate.repo = "https://github.com/user/dotfiles.git"
+	assert.Error(t, c.runGenerateCmd(nil, []string{"install.bat"}))
+	c.generate.format = "cmd"
+	assert.Error(t, c.runGenerateCmd(nil, []string{"install.sh"}))
+	c.generate.format = "sh"
+	c.generate.repo = "repo\nrm -rf /"
+	assert.Error(t, c.runGenerateCmd(nil, []string{"install.sh"}))
+}
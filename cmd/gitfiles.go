@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+// gitFilesBeginMarker and gitFilesEndMarker delimit the block that chezmoi
+// maintains in the source directory's .gitignore and .gitattributes.
+const (
+	gitFilesBeginMarker = "# BEGIN chezmoi managed block"
+	gitFilesEndMarker   = "# END chezmoi managed block"
+)
+
+// gitEncryptedDiffDriver is the name of the git diff driver used to show
+// readable diffs of encrypted files.
+const gitEncryptedDiffDriver = "chezmoi-encrypted"
+
+// gitIgnorePatterns are files that should never be committed to the source
+// repo.
+var gitIgnorePatterns = []string{
+	".DS_Store",
+	"._*",
+	"Thumbs.db",
+	"chezmoistate.boltdb",
+}
+
+// isGit returns whether the source VCS is git.
+func (c *Config) isGit() bool {
+	return filepath.Base(c.SourceVCS.Command) == "git"
+}
+
+// getGitFileBlocks returns the managed blocks of the files in the source
+// directory, keyed by filename.
+func (c *Config) getGitFileBlocks() map[string][]string {
+	attribute := "binary"
+	if c.SourceVCS.Textconv != "" {
+		attribute = "-text -merge diff=" + gitEncryptedDiffDriver
+	}
+	encryptedSourcePatterns := chezmoi.EncryptedSourcePatterns()
+	gitAttributesBlock := make([]string, 0, len(encryptedSourcePatterns))
+	for _, pattern := range encryptedSourcePatterns {
+		gitAttributesBlock = append(gitAttributesBlock, pattern+" "+attribute)
+	}
+	return map[string][]string{
+		".gitattributes": gitAttributesBlock,
+		".gitignore":     gitIgnorePatterns,
+	}
+}
+
+// hasGitFiles returns whether any file in the source directory contains a
+// managed block.
+func (c *Config) hasGitFiles() (bool, error) {
+	for filename := range c.getGitFileBlocks() {
+		contents, err := c.fs.ReadFile(filepath.Join(c.SourceDir, filename))
+		switch {
+		case os.IsNotExist(err):
+			continue
+		case err != nil:
+			return false, err
+		}
+		if _, _, ok := findManagedBlock(contents); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// updateGitFiles creates or updates the managed blocks in the source
+// directory's .gitignore and .gitattributes, and configures the diff driver
+// for encrypted files if sourceVCS.textconv is set. Content outside the
+// managed blocks is never changed.
+func (c *Config) updateGitFiles() error {
+	for filename, block := range c.getGitFileBlocks() {
+		path := filepath.Join(c.SourceDir, filename)
+		contents, err := c.fs.ReadFile(path)
+		switch {
+		case os.IsNotExist(err):
+			contents = nil
+		case err != nil:
+			return err
+		}
+		newContents := replaceManagedBlock(contents, block)
+		if bytes.Equal(newContents, contents) {
+			continue
+		}
+		if err := c.mutator.WriteFile(path, newContents, 0o666&^os.FileMode(c.Umask), contents); err != nil {
+			return err
+		}
+	}
+	if c.SourceVCS.Textconv == "" {
+		return nil
+	}
+	key := "diff." + gitEncryptedDiffDriver + ".textconv"
+	// git config --get fails if key is not set.
+	if output, err := c.output(c.SourceDir, c.SourceVCS.Command, "config", "--get", key); err == nil && strings.TrimSpace(string(output)) == c.SourceVCS.Textconv {
+		return nil
+	}
+	return c.run(c.SourceDir, c.SourceVCS.Command, "config", key, c.SourceVCS.Textconv)
+}
+
+// maintainGitFiles updates the managed blocks in the source directory if
+// sourceVCS.gitFiles is set or if they already exist.
+func (c *Config) maintainGitFiles() error {
+	if !c.isGit() {
+		return nil
+	}
+	if !c.SourceVCS.GitFiles {
+		ok, err := c.hasGitFiles()
+		if err != nil || !ok {
+			return err
+		}
+	}
+	return c.updateGitFiles()
+}
+
+// findManagedBlock returns the offsets of the start of the begin marker line
+// and the end of the end marker line in contents, and whether both were
+// found.
+func findManagedBlock(contents []byte) (int, int, bool) {
+	begin := findLine(contents, gitFilesBeginMarker, 0)
+	if begin == -1 {
+		return 0, 0, false
+	}
+	end := findLine(contents, gitFilesEndMarker, begin)
+	if end == -1 {
+		return 0, 0, false
+	}
+	end += len(gitFilesEndMarker)
+	if end < len(contents) && contents[end] == '\r' {
+		end++
+	}
+	if end < len(contents) && contents[end] == '\n' {
+		end++
+	}
+	return begin, end, true
+}
+
+// findLine returns the offset of the first line in contents at or after
+// offset that is equal to line, or -1 if there is no such line.
+func findLine(contents []byte, line string, offset int) int {
+	for offset < len(contents) {
+		lineEnd := bytes.IndexByte(contents[offset:], '\n')
+		if lineEnd == -1 {
+			lineEnd = len(contents) - offset
+		}
+		if string(bytes.TrimRight(contents[offset:offset+lineEnd], "\r")) == line {
+			return offset
+		}
+		offset += lineEnd + 1
+	}
+	return -1
+}
+
+// replaceManagedBlock returns contents with its managed block replaced by
+// lines. If contents does not contain a managed block then one is appended.
+func replaceManagedBlock(contents []byte, lines []string) []byte {
+	block := &bytes.Buffer{}
+	block.WriteString(gitFilesBeginMarker + "\n")
+	block.WriteString("# This block is maintained by chezmoi. Changes to it will be overwritten.\n")
+	for _, line := range lines {
+		block.WriteString(line + "\n")
+	}
+	block.WriteString(gitFilesEndMarker + "\n")
+
+	result := &bytes.Buffer{}
+	if begin, end, ok := findManagedBlock(contents); ok {
+		result.Write(contents[:begin])
+		result.Write(block.Bytes())
+		result.Write(contents[end:])
+		return result.Bytes()
+	}
+	result.Write(contents)
+	if len(contents) != 0 {
+		if contents[len(contents)-1] != '\n' {
+			result.WriteByte('\n')
+		}
+		result.WriteByte('\n')
+	}
+	result.Write(block.Bytes())
+	return result.Bytes()
+}
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+func TestReplaceManagedBlock(t *testing.T) {
+	block := strings.Join([]string{
+		gitFilesBeginMarker,
+		"# This block is maintained by chezmoi. Changes to it will be overwritten.",
+		"foo",
+		gitFilesEndMarker,
+	}, "\n") + "\n"
+	for _, tc := range []struct {
+		name     string
+		contents string
+		expected string
+	}{
+		{
+			name:     "empty",
+			expected: block,
+		},
+		{
+			name:     "append",
+			contents: "user\n",
+			expected: "user\n\n" + block,
+		},
+		{
+			name:     "append_no_newline",
+			contents: "user",
+			expected: "user\n\n" + block,
+		},
+		{
+			name:     "replace",
+			contents: "before\n" + gitFilesBeginMarker + "\nold\n" + gitFilesEndMarker + "\nafter\n",
+			expected: "before\n" + block + "after\n",
+		},
+		{
+			name:     "replace_crlf",
+			contents: "before\r\n" + gitFilesBeginMarker + "\r\nold\r\n" + gitFilesEndMarker + "\r\nafter\r\n",
+			expected: "before\r\n" + block + "after\r\n",
+		},
+		{
+			name:     "up_to_date",
+			contents: "before\n" + block + "after\n",
+			expected: "before\n" + block + "after\n",
+		},
+		{
+			name:     "unterminated",
+			contents: gitFilesBeginMarker + "\nuser\n",
+			expected: gitFilesBeginMarker + "\nuser\n\n" + block,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, string(replaceManagedBlock([]byte(tc.contents), []string{"foo"})))
+		})
+	}
+}
+
+func TestMaintainGitFiles(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi/.gitignore": "user\n",
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	c := newTestConfig(fs)
+	require.NoError(t, c.maintainGitFiles())
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.local/share/chezmoi/.gitignore",
+			vfst.TestContentsString("user\n"),
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/.gitattributes",
+			vfst.TestDoesNotExist,
+		),
+	)
+
+	c = newTestConfig(fs)
+	c.SourceVCS.GitFiles = true
+	require.NoError(t, c.maintainGitFiles())
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.local/share/chezmoi/.gitignore",
+			vfst.TestContentsString(strings.Join([]string{
+				"user",
+				"",
+				gitFilesBeginMarker,
+				"# This block is maintained by chezmoi. Changes to it will be overwritten.",
+				".DS_Store",
+				"._*",
+				"Thumbs.db",
+				"chezmoistate.boltdb",
+				gitFilesEndMarker,
+			}, "\n")+"\n"),
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/.gitattributes",
+			vfst.TestContentsString(strings.Join([]string{
+				gitFilesBeginMarker,
+				"# This block is maintained by chezmoi. Changes to it will be overwritten.",
+				"encrypted_* binary",
+				"create_encrypted_* binary",
+				"link_encrypted_* binary",
+				"link_create_encrypted_* binary",
+				"modify_encrypted_* binary",
+				"modify_create_encrypted_* binary",
+				"modify_link_encrypted_* binary",
+				"modify_link_create_encrypted_* binary",
+				"**/encrypted_*/bundle binary",
+				"**/concat_encrypted_*/bundle binary",
+				gitFilesEndMarker,
+			}, "\n")+"\n"),
+		),
+	)
+
+	// Once the managed blocks exist they are maintained without
+	// sourceVCS.gitFiles.
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/.gitattributes", []byte("*.sh text\n"+gitFilesBeginMarker+"\nold\n"+gitFilesEndMarker+"\n"), 0o644))
+	c = newTestConfig(fs)
+	require.NoError(t, c.maintainGitFiles())
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.local/share/chezmoi/.gitattributes",
+			vfst.TestContentsString(strings.Join([]string{
+				"*.sh text",
+				gitFilesBeginMarker,
+				"# This block is maintained by chezmoi. Changes to it will be overwritten.",
+				"encrypted_* binary",
+				"create_encrypted_* binary",
+				"link_encrypted_* binary",
+				"link_create_encrypted_* binary",
+				"modify_encrypted_* binary",
+				"modify_create_encrypted_* binary",
+				"modify_link_encrypted_* binary",
+				"modify_link_create_encrypted_* binary",
+				"**/encrypted_*/bundle binary",
+				"**/concat_encrypted_*/bundle binary",
+				gitFilesEndMarker,
+			}, "\n")+"\n"),
+		),
+	)
+}
+
+func TestInitGitFilesPrompt(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		stdin      string
+		expectFile bool
+	}{
+		{
+			name:       "yes",
+			stdin:      "y\n",
+			expectFile: true,
+		},
+		{
+			name:  "no",
+			stdin: "n\n",
+		},
+		{
+			name: "eof",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+				"/home/user/.local/share/chezmoi": &vfst.Dir{Perm: 0o700},
+			})
+			require.NoError(t, err)
+			defer cleanup()
+
+			stderr := &bytes.Buffer{}
+			c := newTestConfig(fs, withStdin(strings.NewReader(tc.stdin)), withStderr(stderr))
+			require.NoError(t, c.initGitFiles())
+			assert.Contains(t, stderr.String(), "Create and maintain .gitignore and .gitattributes in the source directory [y,n]? ")
+			if tc.expectFile {
+				vfst.RunTests(t, fs, "",
+					vfst.TestPath("/home/user/.local/share/chezmoi/.gitignore",
+						vfst.TestModeIsRegular,
+					),
+				)
+			} else {
+				vfst.RunTests(t, fs, "",
+					vfst.TestPath("/home/user/.local/share/chezmoi/.gitignore",
+						vfst.TestDoesNotExist,
+					),
+				)
+			}
+		})
+	}
+}
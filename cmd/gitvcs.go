@@ -1,7 +1,10 @@
 package cmd
 
 import (
+	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/twpayne/chezmoi/internal/git"
 )
@@ -14,6 +17,14 @@ func (gitVCS) AddArgs(path string) []string {
 	return []string{"add", path}
 }
 
+func (gitVCS) AheadBehindArgs() []string {
+	return []string{"rev-list", "--left-right", "--count", "HEAD...@{upstream}"}
+}
+
+func (gitVCS) ArchiveArgs(revision string) []string {
+	return []string{"archive", "--format=tar", revision}
+}
+
 func (gitVCS) CloneArgs(repo, dir string) []string {
 	return []string{"clone", repo, dir}
 }
@@ -22,10 +33,38 @@ func (gitVCS) CommitArgs(message string) []string {
 	return []string{"commit", "--message", message}
 }
 
+func (gitVCS) FetchArgs() []string {
+	return []string{"fetch", "--quiet"}
+}
+
+func (gitVCS) HeadArgs() []string {
+	return []string{"rev-parse", "HEAD"}
+}
+
+func (gitVCS) IncomingArgs() []string {
+	return []string{"log", "--oneline", "HEAD..@{upstream}"}
+}
+
 func (gitVCS) InitArgs() []string {
 	return []string{"init"}
 }
 
+func (gitVCS) ParseAheadBehindOutput(output []byte) (int, int, error) {
+	fields := strings.Fields(string(output))
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("%q: cannot parse ahead/behind counts", output)
+	}
+	ahead, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	behind, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return ahead, behind, nil
+}
+
 func (gitVCS) ParseStatusOutput(output []byte) (interface{}, error) {
 	return git.ParseStatusPorcelainV2(output)
 }
@@ -38,6 +77,10 @@ func (gitVCS) PushArgs() []string {
 	return []string{"push"}
 }
 
+func (gitVCS) RemoteURLArgs() []string {
+	return []string{"config", "--get", "remote.origin.url"}
+}
+
 func (gitVCS) StatusArgs() []string {
 	return []string{"status", "--porcelain=v2"}
 }
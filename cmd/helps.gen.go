@@ -13,7 +13,24 @@ var helps = map[string]help{
 			"Description:\n" +
 			"  Add *targets* to the source state. If any target is already in the source\n" +
 			"  state, then its source state is replaced with its current state in the\n" +
-			"  destination directory. The `add` command accepts additional flags:\n" +
+			"  destination directory.\n" +
+			"\n" +
+			"  Before adding a file, chezmoi checks whether it is likely to contain secrets\n" +
+			"  in plaintext, either because its path is one that usually contains secrets\n" +
+			"  (for example `~/.netrc`, `~/.aws/credentials`, or `~/.ssh/id_rsa`) or because\n" +
+			"  its contents contain an AWS access key ID, a private key, or a password. If\n" +
+			"  so, chezmoi prints what it found, including line numbers, and prompts before\n" +
+			"  adding the file. Consider using `--encrypt` or a template that reads the secret\n" +
+			"  from your password manager instead. Files added with `--encrypt`, and files\n" +
+			"  added as templates that already contain template actions, are not checked. The\n" +
+			"  check can be disabled with `--no-secret-check` or by setting `add.secretCheck` to\n" +
+			"  `false` in your config file.\n" +
+			"\n" +
+			"  Any parent directories of *targets* that are not yet in the source state are\n" +
+			"  added too, with attributes that match their current state, for example\n" +
+			"  `private_` if they are only accessible by you, but never `exact_`.\n" +
+			"\n" +
+			"  The `add` command accepts additional flags:\n" +
 			"\n" +
 			"  `--autotemplate`\n" +
 			"\n" +
@@ -21,26 +38,59 @@ var helps = map[string]help{
 			"  from the `data` section of the config file. Longer subsitutions occur before\n" +
 			"  shorter ones. This implies the `--template` option.\n" +
 			"\n" +
+			"  `--create`\n" +
+			"\n" +
+			"  Set the `create` attribute on added files, so that they are only written if\n" +
+			"  their targets do not exist.\n" +
+			"\n" +
 			"  `-e`, `--empty`\n" +
 			"\n" +
 			"  Set the `empty` attribute on added files.\n" +
 			"\n" +
+			"  `--encrypt`\n" +
+			"\n" +
+			"  Encrypt files using the tool set by `encryption.method`, either GPG or age,\n" +
+			"  and set the `encrypted` attribute on them. Unless `encryption.private` is\n" +
+			"  `false`, the `private` attribute is also set. Directories are added as\n" +
+			"  encrypted directories, whose contents are stored in a single encrypted bundle.\n" +
+			"\n" +
 			"  `-f`, `--force`\n" +
 			"\n" +
-			"  Add *targets*, even if doing so would cause a source template to be\n" +
-			"  overwritten.\n" +
+			"  Add *targets*, even if doing so would cause a source template or `modify_`\n" +
+			"  script to be overwritten.\n" +
 			"\n" +
 			"  `-x`, `--exact`\n" +
 			"\n" +
 			"  Set the `exact` attribute on added directories.\n" +
 			"\n" +
-			"  `-p`, `--prompt`\n" +
+			"  `--no-secret-check`\n" +
+			"\n" +
+			"  Do not check added files for secrets in plaintext.\n" +
+			"\n" +
+			"  `--no-suffix`\n" +
 			"\n" +
-			"  Interactively prompt before adding each file.\n" +
+			"  With `--template`, add templates without the `.tmpl` suffix. The file's path in\n" +
+			"  the source directory must match one of the globs in `templateGlobs`, otherwise\n" +
+			"  it would not be treated as a template.\n" +
+			"\n" +
+			"  `-i`, `--interactive`, `-p`, `--prompt`\n" +
+			"\n" +
+			"  Interactively prompt before adding each file found in *targets*. Answer `y` to\n" +
+			"  add the file, `n` to skip it, `q` to stop, keeping the files that were already\n" +
+			"  added, or `a` to add it and all the remaining files without prompting.\n" +
+			"  Directories are added, with the same flags, when the first file inside them is\n" +
+			"  chosen, so directories that contain no chosen files, including empty\n" +
+			"  directories, are not added. Other flags, like `--template` and `--encrypt`, apply\n" +
+			"  to each file that is added. With `--dry-run`, chezmoi prompts but does not add\n" +
+			"  anything.\n" +
 			"\n" +
 			"  `-r`, `--recursive`\n" +
 			"\n" +
-			"  Recursively add all files, directories, and symlinks.\n" +
+			"  Recursively add all files, directories, and symlinks in directories. This is\n" +
+			"  the default. With `--recursive=false`, only the directories themselves are\n" +
+			"  added, each with a `.keep` file. Files and directories that are ignored by\n" +
+			"  `.chezmoiignore` are skipped, and the contents of ignored directories are\n" +
+			"  never added.\n" +
 			"\n" +
 			"  `-T`, `--template`\n" +
 			"\n" +
@@ -48,35 +98,242 @@ var helps = map[string]help{
 		example: "" +
 			"  chezmoi add ~/.bashrc\n" +
 			"  chezmoi add ~/.gitconfig --template\n" +
-			"  chezmoi add ~/.vim --recursive\n" +
-			"  chezmoi add ~/.oh-my-zsh --exact --recursive",
+			"  chezmoi add ~/.vim\n" +
+			"  chezmoi add ~/.oh-my-zsh --exact\n" +
+			"  chezmoi add ~/.config --recursive=false\n" +
+			"  chezmoi add ~/.config/fish --interactive",
 	},
 	"apply": {
 		long: "" +
 			"Description:\n" +
 			"  Ensure that *targets* are in the target state, updating them if necessary. If\n" +
-			"  no targets are specified, the state of all targets are ensured.",
+			"  no targets are specified, the state of all targets are ensured.\n" +
+			"\n" +
+			"  If all *targets* are absolute paths, or relative paths with `--relative-to-dest`,\n" +
+			"  and none are globs, then only the parts of the source state that contain\n" +
+			"  *targets* are read, which is faster for large source states. The same applies\n" +
+			"  to `chezmoi diff` and `chezmoi verify`.\n" +
+			"\n" +
+			"  Files larger than 16MB that are neither templates nor encrypted are streamed\n" +
+			"  instead of being read into memory. An existing target of the same size is\n" +
+			"  compared by hashing the contents of both, and is only rewritten if they\n" +
+			"  differ. Such files are also streamed into archives by `chezmoi archive`, and\n" +
+			"  `chezmoi diff` shows only that their contents changed.\n" +
+			"\n" +
+			"  The progress of each apply is recorded in the persistent state, and cleared\n" +
+			"  when the apply succeeds.\n" +
+			"\n" +
+			"  When no targets are specified, the targets applied are also recorded in the\n" +
+			"  persistent state, separately for each destination directory. The next time\n" +
+			"  that all targets are applied, chezmoi offers to remove targets that were\n" +
+			"  applied before but that have since been removed from the source state.\n" +
+			"  Answering `n` keeps the target and stops tracking it. Targets that are ignored\n" +
+			"  by `.chezmoiignore` are not treated as removed, and directories are only\n" +
+			"  removed if they are empty. In dry run mode, and so in `chezmoi diff`, removed\n" +
+			"  targets are shown without prompting.\n" +
+			"\n" +
+			"  If `apply.backup` is `true`, the previous state of every target that is\n" +
+			"  changed or removed is copied to a new subdirectory of `apply.backupDir`, named\n" +
+			"  after the time that the apply started, with the same relative path and mode.\n" +
+			"  Backups of private targets are never readable by group or others, and\n" +
+			"  `apply.backupDir` is created private if it does not already exist. Only the\n" +
+			"  most recent `apply.backupKeep` backups are kept, unless it is `0`, in which\n" +
+			"  case all backups are kept. Only subdirectories of `apply.backupDir` named like\n" +
+			"  backups are ever removed. The default backup directory is `chezmoi/backup` in\n" +
+			"  `$XDG_CACHE_HOME`.\n" +
+			"\n" +
+			"  Targets with the immutable flag set, with `chattr +i` on Linux or `chflags\n" +
+			"  uchg` on macOS and BSD, cannot be modified, and chezmoi reports the command to\n" +
+			"  clear the flag. If `apply.clearImmutable` is `true` then chezmoi instead\n" +
+			"  clears the flag, modifies the target, and sets the flag again. Clearing the\n" +
+			"  immutable flag on Linux requires root. Reading such targets, for example with\n" +
+			"  `chezmoi diff` or `chezmoi verify`, is not affected.\n" +
+			"\n" +
+			"  `--allow-scripts`\n" +
+			"\n" +
+			"  Allow scripts from the repo given with `--remote` to run. Without this flag,\n" +
+			"  `chezmoi apply --remote` fails before making any changes if the remote source\n" +
+			"  state contains any scripts.\n" +
+			"\n" +
+			"  `--branch` *branch*, `--depth` *depth*\n" +
+			"\n" +
+			"  Clone *branch* of the repo given with `--remote`, and create a shallow clone\n" +
+			"  with a history truncated to *depth* commits. Only supported by git.\n" +
+			"\n" +
+			"  `--exclude` *types-or-pattern*\n" +
+			"\n" +
+			"  Exclude entries as for archive. This flag can be repeated.\n" +
+			"\n" +
+			"  `--exclude-encrypted`\n" +
+			"\n" +
+			"  Skip encrypted files and directories, without decrypting them, and print the\n" +
+			"  number of targets skipped. This is useful on machines without the decryption\n" +
+			"  key. Targets inside skipped encrypted directories are not pruned. This can\n" +
+			"  also be set with the `encryption.exclude` configuration variable, and combines\n" +
+			"  with `--exclude` and `--include`. Without it, failing to decrypt a file is an\n" +
+			"  error.\n" +
+			"\n" +
+			"  `-i`, `--include` *types*\n" +
+			"\n" +
+			"  Only apply entries of type *types*, as for archive. Directories that contain\n" +
+			"  included entries are still created, so, for example, `chezmoi apply --\n" +
+			"  include=files,symlinks` populates a new home directory without running any\n" +
+			"  scripts, and `chezmoi apply --include=scripts` only runs scripts.\n" +
+			"\n" +
+			"  `--log-file` *filename*\n" +
+			"\n" +
+			"  Append a log of the operations performed to *filename*, which is created if it\n" +
+			"  does not exist. Each operation is logged as soon as it is performed, so the\n" +
+			"  log is complete up to the point of any crash. Entries record the time, the\n" +
+			"  action, the target path, the old and new modes, the name and exit status of\n" +
+			"  any script, and whether chezmoi is in dry run mode. File contents are never\n" +
+			"  logged, only their sizes and SHA256 hashes.\n" +
+			"\n" +
+			"  `--log-format` *format*\n" +
+			"\n" +
+			"  Set the format of the log written with `--log-file`. The only supported format is\n" +
+			"  `json`, which writes one JSON object per line.\n" +
+			"\n" +
+			"  `--no-backup`\n" +
+			"\n" +
+			"  Do not back up targets, even if `apply.backup` is set.\n" +
+			"\n" +
+			"  `--no-prune`\n" +
+			"\n" +
+			"  Do not remove targets that have been removed from the source state. They are\n" +
+			"  still tracked, so they can be removed by a later apply.\n" +
+			"\n" +
+			"  `--prune`\n" +
+			"\n" +
+			"  Remove targets that have been removed from the source state without prompting.\n" +
+			"\n" +
+			"  `--remote` *repo*\n" +
+			"\n" +
+			"  Clone *repo* into a temporary directory and use it as the source directory\n" +
+			"  instead of the configured source directories. The temporary directory is\n" +
+			"  removed afterwards, even if an error occurs. The persistent state is not read\n" +
+			"  or written, so `run_once_` scripts are always run. Because the remote repo is\n" +
+			"  untrusted, the template functions that read secrets are disabled and scripts\n" +
+			"  are not run unless `--trust` or `--allow-scripts` is also given.\n" +
+			"\n" +
+			"  `--resume`\n" +
+			"\n" +
+			"  Skip targets that were already applied by the previous apply, if it failed or\n" +
+			"  was interrupted and neither the source state nor the template data have\n" +
+			"  changed since. Resuming avoids decrypting files and checking scripts again.\n" +
+			"  The progress of an interrupted apply is recorded every 100 targets, so up to\n" +
+			"  the last 99 targets that it applied are applied again.\n" +
+			"\n" +
+			"  `--rewrite-symlinks`\n" +
+			"\n" +
+			"  With `--to`, rewrite the targets of symlinks that are absolute paths inside the\n" +
+			"  configured destination directory to the same paths inside *dir*.\n" +
+			"\n" +
+			"  `--symlink`\n" +
+			"\n" +
+			"  Apply plain files as symbolic links to their files in the source directory, as\n" +
+			"  if they had the `link_` prefix, instead of copying them. Templates, encrypted\n" +
+			"  files, and files that are private, executable, have explicit permissions, or\n" +
+			"  are empty without the `empty_` prefix are still applied as regular files, as\n" +
+			"  their targets' contents or permissions would differ from their source files.\n" +
+			"  Applying with and without `--symlink` replaces regular files with symbolic links\n" +
+			"  and vice versa, so `chezmoi apply --dry-run --verbose` shows the change. This can\n" +
+			"  also be set with the `symlink` configuration variable.\n" +
+			"\n" +
+			"  `--to` *dir*\n" +
+			"\n" +
+			"  Apply the target state to *dir*, which is created if it does not exist,\n" +
+			"  instead of the configured destination directory, for example to inspect a\n" +
+			"  fresh home directory before switching to it. Scripts are not run, and the\n" +
+			"  persistent state of each *dir*, including the progress of the apply, the\n" +
+			"  applied targets, and which `run_once_` scripts have been run, is kept\n" +
+			"  separately from the persistent state of the destination directory.\n" +
+			"\n" +
+			"  `--trust`\n" +
+			"\n" +
+			"  Trust the source repo without asking, if it was cloned from a repo that is not\n" +
+			"  trusted, or the repo given with `--remote`. See `chezmoi init`.\n" +
+			"\n" +
+			"  `--with-scripts`\n" +
+			"\n" +
+			"  With `--to`, run scripts. Scripts can use the `CHEZMOI_DEST_DIR` environment\n" +
+			"  variable to find *dir*.",
 		example: "" +
 			"  chezmoi apply\n" +
 			"  chezmoi apply --dry-run --verbose\n" +
-			"  chezmoi apply ~/.bashrc",
+			"  chezmoi apply ~/.bashrc\n" +
+			"  chezmoi apply --resume\n" +
+			"  chezmoi apply --no-backup\n" +
+			"  chezmoi apply --include=files,symlinks\n" +
+			"  chezmoi apply --log-file ~/chezmoi.log\n" +
+			"  chezmoi apply --remote https://github.com/user/dotfiles.git\n" +
+			"  chezmoi apply --to /tmp/home --rewrite-symlinks",
 	},
 	"archive": {
 		long: "" +
 			"Description:\n" +
-			"  Write a tar archive of the target state to stdout. This can be piped into\n" +
-			"  `tar` to inspect the target state.",
+			"  Write a tar or zip archive of the target state to stdout. This can be piped\n" +
+			"  into `tar` to inspect the target state. Files and directories in the archive\n" +
+			"  have the same permissions, including the setgid and sticky bits, as `chezmoi\n" +
+			"  apply` would give them, taking `umask` into account.\n" +
+			"\n" +
+			"  Encrypted files are not decrypted. By default, their ciphertext is included\n" +
+			"  with their source names, for example `.ssh/encrypted_private_id_rsa`. Set\n" +
+			"  `encryption.export` to `skip` to omit them entirely.\n" +
+			"\n" +
+			"  `--decrypt`\n" +
+			"\n" +
+			"  Include the decrypted contents of encrypted files with their target names, for\n" +
+			"  an intentional full export of the target state including secrets.\n" +
+			"\n" +
+			"  `--exclude` *types-or-pattern*\n" +
+			"\n" +
+			"  Exclude entries of type *types*, or targets matching *pattern* and everything\n" +
+			"  inside them. The types are the same as for `--include`. To exclude a target\n" +
+			"  whose name is a type, give its path, for example `./scripts`. This flag can be\n" +
+			"  repeated.\n" +
+			"\n" +
+			"  `-f`, `--format` *format*\n" +
+			"\n" +
+			"  Write the archive in the given format. The accepted formats are `tar` (the\n" +
+			"  default) and `zip`. Symlinks in zip archives are stored with their Unix mode\n" +
+			"  bits and the link target as their contents.\n" +
+			"\n" +
+			"  `-z`, `--gzip`\n" +
+			"\n" +
+			"  Compress the tar archive with gzip. This cannot be used with `--format=zip`.\n" +
+			"\n" +
+			"  `-i`, `--include` *types*\n" +
+			"\n" +
+			"  Only include entries of type *types*. *types* is a comma-separated list of\n" +
+			"  types of entry to include. Valid types are `dirs`, `files`, `symlinks`, and\n" +
+			"  `scripts`, the first three of which can be abbreviated to `d`, `f`, and `s`\n" +
+			"  respectively, and `all`, which is the default. Directories are included if\n" +
+			"  they contain included entries, even if `dirs` is not included. Directories\n" +
+			"  whose entries are all excluded are omitted.\n" +
+			"\n" +
+			"  `-o`, `--output` *filename*\n" +
+			"\n" +
+			"  Write the archive to *filename* instead of stdout. Archives written with `--\n" +
+			"  decrypt` are only readable by the current user.",
 		example: "" +
-			"  chezmoi archive | tar tvf -",
+			"  chezmoi archive | tar tvf -\n" +
+			"  chezmoi archive --decrypt > full.tar\n" +
+			"  chezmoi archive --include=files,symlinks > image.tar\n" +
+			"  chezmoi archive --format=zip --output=dotfiles.zip\n" +
+			"  chezmoi archive --gzip --output=dotfiles.tar.gz",
 	},
 	"cat": {
 		long: "" +
 			"Description:\n" +
-			"  Write the target state of *targets*  to stdout. *targets* must be files or\n" +
-			"  symlinks. For files, the target file contents are written. For symlinks, the\n" +
-			"  target target is written.",
+			"  Write the target state of *targets* to stdout, without reading or changing the\n" +
+			"  destination directory. *targets* must be files or symlinks. For files, the\n" +
+			"  target file contents are written, after executing templates and decrypting\n" +
+			"  encrypted files. For symlinks, the link target is written, followed by a\n" +
+			"  newline. This is useful for debugging templates.",
 		example: "" +
-			"  chezmoi cat ~/.bashrc",
+			"  chezmoi cat ~/.bashrc\n" +
+			"  chezmoi cat ~/.gitconfig ~/.ssh/config",
 	},
 	"cd": {
 		long: "" +
@@ -103,6 +360,7 @@ var helps = map[string]help{
 			"    encrypted  | none\n" +
 			"    exact      | none\n" +
 			"    executable | x\n" +
+			"    link       | l\n" +
 			"    private    | p\n" +
 			"    template   | t\n" +
 			"\n" +
@@ -111,20 +369,48 @@ var helps = map[string]help{
 		example: "" +
 			"  chezmoi chattr template ~/.bashrc\n" +
 			"  chezmoi chattr noempty ~/.profile\n" +
-			"  chezmoi chattr private,template ~/.netrc",
+			"  chezmoi chattr private,template ~/.netrc\n" +
+			"  chezmoi chattr link ~/.vimrc",
 	},
 	"completion": {
 		long: "" +
 			"Description:\n" +
-			"  Generate shell completion code for the specified shell (`bash`, `fish`, or\n" +
-			"  `zsh`).\n" +
+			"  Generate shell completion code for the specified shell (`bash`, `fish`,\n" +
+			"  `powershell`, or `zsh`).\n" +
+			"\n" +
+			"  The generated code calls chezmoi to complete the values of flags that accept a\n" +
+			"  fixed set of values, for example `--color`, `--format`, and `--include`, so it does\n" +
+			"  not need to be regenerated when chezmoi is upgraded.\n" +
+			"\n" +
+			"  `-f`, `--force`\n" +
+			"\n" +
+			"  With `--install`, overwrite an existing completion file even if it is different.\n" +
+			"\n" +
+			"  `--install`\n" +
+			"\n" +
+			"  Write the shell completion code to the conventional per-user location for\n" +
+			"  *shell* and print what was done. An existing file with different contents is\n" +
+			"  not overwritten unless `--force` is also given.\n" +
+			"\n" +
+			"      SHELL    |                      LOCATION\n" +
+			"  -------------+-----------------------------------------------------\n" +
+			"    bash       | $XDG_DATA_HOME/bash-completion/completions/chezmoi\n" +
+			"    fish       | $XDG_CONFIG_HOME/fish/completions/chezmoi.fish\n" +
+			"    powershell | chezmoi-completion.ps1 in the\n" +
+			"               | PowerShell profile directory,\n" +
+			"               | which must be dot-sourced from\n" +
+			"               | the profile\n" +
+			"    zsh        | ~/.zsh/completions/_chezmoi,\n" +
+			"               | which must be in fpath\n" +
 			"\n" +
 			"  `--output`, `-o` *filename*\n" +
 			"\n" +
-			"  Write the shell completion code to *filename* instead of stdout.",
+			"  Write the shell completion code to *filename* instead of stdout, creating any\n" +
+			"  parent directories.",
 		example: "" +
 			"  chezmoi completion bash\n" +
-			"  chezmoi completion fish --output ~/.config/fish/completions/chezmoi.fish",
+			"  chezmoi completion fish --output ~/.config/fish/completions/chezmoi.fish\n" +
+			"  chezmoi completion zsh --install",
 	},
 	"data": {
 		long: "" +
@@ -135,10 +421,26 @@ var helps = map[string]help{
 			"  `-f`, `--format` *format*\n" +
 			"\n" +
 			"  Print the computed template data in the given format. The accepted formats are\n" +
-			"  `json` (JSON), `toml` (TOML), and `yaml` (YAML).",
+			"  `json` (JSON), `toml` (TOML), and `yaml` (YAML).\n" +
+			"\n" +
+			"  `--origins`\n" +
+			"\n" +
+			"  Replace each value in the template data with a map containing the value, as\n" +
+			"  `value`, and where it came from, as `origin`. The origin is `default` for\n" +
+			"  chezmoi's default data, or the path of the `.chezmoidata` file or config file\n" +
+			"  that set the value.\n" +
+			"\n" +
+			"  `--resolve` *key*\n" +
+			"\n" +
+			"  Print every origin that defines *key*, for example `editor.font.size`, and its\n" +
+			"  value, one per line in decreasing order of precedence. The origin whose value\n" +
+			"  is used is marked with a `*`. No origin is marked if the value has been\n" +
+			"  discarded because the top-level key's merge mode is `replace`.",
 		example: "" +
 			"  chezmoi data\n" +
-			"  chezmoi data --format=yaml",
+			"  chezmoi data --format=yaml\n" +
+			"  chezmoi data --origins\n" +
+			"  chezmoi data --resolve editor.font.size",
 	},
 	"diff": {
 		long: "" +
@@ -149,6 +451,19 @@ var helps = map[string]help{
 			"  If a `diff.pager` command is set in the configuration file then the output\n" +
 			"  will be piped into it.\n" +
 			"\n" +
+			"  `--branch` *branch*, `--depth` *depth*\n" +
+			"\n" +
+			"  Clone *branch* of the repo given with `--remote`, and create a shallow clone\n" +
+			"  with a history truncated to *depth* commits. Only supported by git.\n" +
+			"\n" +
+			"  `--exclude` *types-or-pattern*\n" +
+			"\n" +
+			"  Exclude entries as for archive. This flag can be repeated.\n" +
+			"\n" +
+			"  `--exclude-encrypted`\n" +
+			"\n" +
+			"  Skip encrypted targets, as for apply.\n" +
+			"\n" +
 			"  `-f`, `--format` *format*\n" +
 			"\n" +
 			"  Print the diff in *format*. The format can be set with the `diff.format`\n" +
@@ -156,8 +471,7 @@ var helps = map[string]help{
 			"\n" +
 			"  ##### `chezmoi`\n" +
 			"\n" +
-			"  A mix of unified diffs and pseudo shell commands, including scripts,\n" +
-			"  equivalent to `chezmoi apply --dry-run --verbose`.\n" +
+			"  A mix of unified diffs and pseudo shell commands, including scripts.\n" +
 			"\n" +
 			"  ##### `git`\n" +
 			"\n" +
@@ -165,13 +479,56 @@ var helps = map[string]help{
 			"  version 2.0.0 of chezmoi, `git` format diffs will become the default and\n" +
 			"  include scripts and the `chezmoi` format will be removed.\n" +
 			"\n" +
+			"  `-i`, `--include` *types*\n" +
+			"\n" +
+			"  Only include entries of type *types* in the diff, as for archive.\n" +
+			"\n" +
 			"  `--no-pager`\n" +
 			"\n" +
-			"  Do not use the pager.",
+			"  Do not use the pager.\n" +
+			"\n" +
+			"  `--remote` *repo*\n" +
+			"\n" +
+			"  Compute the target state from a temporary clone of *repo* instead of from the\n" +
+			"  source directory, without reading the persistent state or changing the source\n" +
+			"  directory. The temporary clone is removed afterwards, even if an error occurs.\n" +
+			"  Scripts are never run. As for apply, the remote repo is untrusted, so the\n" +
+			"  template functions that read secrets are disabled unless `--trust` is also\n" +
+			"  given. `--remote` cannot be combined with `--revision`.\n" +
+			"\n" +
+			"  `-r`, `--revision` *revision*\n" +
+			"\n" +
+			"  Compute the target state from the source directory at *revision*, as\n" +
+			"  understood by the source version control system, instead of from the working\n" +
+			"  copy. The source directory at *revision* is extracted into a temporary\n" +
+			"  directory that is removed afterwards. The template data are the same as for\n" +
+			"  the working copy. For example, use `chezmoi diff --revision origin/master` to\n" +
+			"  see what `chezmoi update` would change.\n" +
+			"\n" +
+			"  `--stat`\n" +
+			"\n" +
+			"  Instead of the full diff, print one line per changed target with the number of\n" +
+			"  lines added and removed, followed by the totals, like `git diff --stat`. Binary\n" +
+			"  files are marked `Bin` with their sizes before and after, and scripts that\n" +
+			"  would be run are marked `script`. The lines fit the width of the terminal, or\n" +
+			"  80 columns if the output is not a terminal. The summary is not piped into the\n" +
+			"  pager and `--format` is ignored.\n" +
+			"\n" +
+			"  `--symlink`\n" +
+			"\n" +
+			"  Compare plain files as symbolic links, as for apply.\n" +
+			"\n" +
+			"  `--trust`\n" +
+			"\n" +
+			"  Trust the repo given with `--remote`, so that its templates can read secrets.",
 		example: "" +
 			"  chezmoi diff\n" +
 			"  chezmoi diff ~/.bashrc\n" +
-			"  chezmoi diff --format=git",
+			"  chezmoi diff --include=scripts\n" +
+			"  chezmoi diff --format=git\n" +
+			"  chezmoi diff --revision HEAD~3\n" +
+			"  chezmoi diff --stat\n" +
+			"  chezmoi diff --remote https://github.com/user/dotfiles.git --depth 1",
 	},
 	"docs": {
 		long: "" +
@@ -186,7 +543,14 @@ var helps = map[string]help{
 	"doctor": {
 		long: "" +
 			"Description:\n" +
-			"  Check for potential problems.",
+			"  Check for potential problems and print the result of each check, prefixed with\n" +
+			"  `ok`, `warning`, or `ERROR`. The checks include whether the config file could\n" +
+			"  be read and parsed, whether the source directory exists and is private, and\n" +
+			"  whether the configured shell, editor, merge command, source VCS command, GnuPG\n" +
+			"  command, and secret manager CLIs are installed, and their versions. It also\n" +
+			"  checks that the config file and persistent state file are owned by you, or by\n" +
+			"  the user who ran `sudo`. `chezmoi doctor` exits with status 1 if any check is\n" +
+			"  an error.",
 		example: "" +
 			"  chezmoi doctor",
 	},
@@ -199,33 +563,81 @@ var helps = map[string]help{
 			"  `-f`, `--format` *format*\n" +
 			"\n" +
 			"  Print the target state in the given format. The accepted formats are `json`\n" +
-			"  (JSON) and `yaml` (YAML).",
+			"  (JSON) and `yaml` (YAML).\n" +
+			"\n" +
+			"  `--decrypt`\n" +
+			"\n" +
+			"  Include the decrypted contents of encrypted files. Without this flag,\n" +
+			"  encrypted files are handled the same way as by archive.\n" +
+			"\n" +
+			"  `--exclude` *types-or-pattern*\n" +
+			"\n" +
+			"  Exclude entries as for archive.\n" +
+			"\n" +
+			"  `-i`, `--include` *types*\n" +
+			"\n" +
+			"  Only include entries of type *types*, as for archive. Excluded entries are\n" +
+			"  omitted from the output.",
 		example: "" +
 			"  chezmoi dump ~/.bashrc\n" +
 			"  chezmoi dump --format=yaml",
 	},
+	"dump-config": {
+		long: "" +
+			"Description:\n" +
+			"  Write the configuration, as read from the config file and set by command line\n" +
+			"  flags, to stdout. The output can be used as a config file.\n" +
+			"\n" +
+			"  `-f`, `--format` *format*\n" +
+			"\n" +
+			"  Print the configuration in the given format. The accepted formats are `json`,\n" +
+			"  `toml`, and `yaml`.\n" +
+			"\n" +
+			"  `dump-config` examples\n" +
+			"\n" +
+			"    chezmoi dump-config\n" +
+			"    chezmoi dump-config --format=toml > chezmoi.toml",
+	},
 	"edit": {
 		long: "" +
 			"Description:\n" +
-			"  Edit the source state of *targets*, which must be files or symlinks. If no\n" +
-			"  targets are given the the source directory itself is opened with `$EDITOR`.\n" +
-			"  The `edit` command accepts additional arguments:\n" +
+			"  Edit the source state of *targets*, which must be files, symlinks, or\n" +
+			"  encrypted directories. Encrypted files and directories are decrypted to a\n" +
+			"  private temporary directory, in `$XDG_RUNTIME_DIR` or `/dev/shm` if possible\n" +
+			"  so that their plaintext is not written to disk, before they are opened, and\n" +
+			"  encrypted again after the editor exits. Encrypted files whose plaintext did\n" +
+			"  not change are not encrypted again, so their ciphertext does not change.\n" +
+			"  Encrypted templates are decrypted but not executed, so the template itself is\n" +
+			"  edited. The temporary directory is always removed afterwards. If no targets\n" +
+			"  are given the the source directory itself is opened with `$EDITOR`. The `edit`\n" +
+			"  command accepts additional arguments:\n" +
 			"\n" +
 			"  `-a`, `--apply`\n" +
 			"\n" +
-			"  Apply target immediately after editing. Ignored if there are no targets.\n" +
+			"  Apply the edited targets once the editor exits successfully, as `chezmoi\n" +
+			"  apply` *targets* would, without prompting unless `--prompt` is given. Only\n" +
+			"  targets that would change are applied, and `--dry-run` is respected. Ignored if\n" +
+			"  there are no targets.\n" +
 			"\n" +
 			"  `-d`, `--diff`\n" +
 			"\n" +
-			"  Print the difference between the target state and the actual state after\n" +
-			"  editing.. Ignored if there are no targets.\n" +
+			"  Print the difference between the target state and the actual state of the\n" +
+			"  edited targets once the editor exits successfully. Without `--apply`, nothing is\n" +
+			"  applied. Ignored if there are no targets.\n" +
+			"\n" +
+			"  `--exclude` *pattern*\n" +
+			"\n" +
+			"  Exclude targets matching *pattern*. This flag can be repeated.\n" +
 			"\n" +
 			"  `-p`, `--prompt`\n" +
 			"\n" +
-			"  Prompt before applying each target.. Ignored if there are no targets.",
+			"  Prompt before applying each target. Implies `--diff`. Ignored if there are no\n" +
+			"  targets.",
 		example: "" +
 			"  chezmoi edit ~/.bashrc\n" +
 			"  chezmoi edit ~/.bashrc --apply --prompt\n" +
+			"  chezmoi edit ~/.zshrc ~/.zprofile --apply\n" +
+			"  chezmoi edit ~/.config/zsh/'*.zsh'\n" +
 			"  chezmoi edit",
 	},
 	"edit-config": {
@@ -260,20 +672,84 @@ var helps = map[string]help{
 			"  `promptString` is called with a *prompt* that does not match any of *pairs*,\n" +
 			"  then it returns *prompt* unchanged.\n" +
 			"\n" +
+			"  `--promptBool` *pairs*\n" +
+			"\n" +
+			"  Simulate the `promptBool` function with a function that returns values from\n" +
+			"  *pairs*, parsed with strconv.ParseBool\n" +
+			"  https://pkg.go.dev/strconv?tab=doc#ParseBool. If `promptBool` is called with a\n" +
+			"  *prompt* that does not match any of *pairs*, then it returns `false`.\n" +
+			"\n" +
+			"  `--promptInt` *pairs*\n" +
+			"\n" +
+			"  Simulate the `promptInt` function with a function that returns values from\n" +
+			"  *pairs*. If `promptInt` is called with a *prompt* that does not match any of\n" +
+			"  *pairs*, then it returns `0`.\n" +
+			"\n" +
+			"  `--watch`\n" +
+			"\n" +
+			"  Interpret *templates* as the filenames of templates, execute them, and execute\n" +
+			"  them again whenever they, the templates in `.chezmoitemplates`, the data in\n" +
+			"  the config file, or the `.chezmoidata.<format>` files change. If stdout is a\n" +
+			"  terminal then the screen is cleared before each execution. Errors are printed\n" +
+			"  instead of the output, followed by the lines of the template around the error\n" +
+			"  with their line numbers. Press Ctrl-C to stop watching.\n" +
+			"\n" +
+			"  `--cache-secrets`\n" +
+			"\n" +
+			"  With `--watch`, retrieve each secret from its secret manager only once and reuse\n" +
+			"  it when executing the templates again. This is the default. Use `--cache-\n" +
+			"  secrets=false` to retrieve secrets again on every execution.\n" +
+			"\n" +
 			"  `execute-template` examples\n" +
 			"\n" +
 			"    chezmoi execute-template '{{ .chezmoi.sourceDir }}'\n" +
 			"    chezmoi execute-template '{{ .chezmoi.os }}' / '{{ .chezmoi.arch }}'\n" +
 			"    echo '{{ .chezmoi | toJson }}' | chezmoi execute-template\n" +
 			"    chezmoi execute-template --init --promptString email=john@home.org <\n" +
-			"  ~/.local/share/chezmoi/.chezmoi.toml.tmpl",
+			"  ~/.local/share/chezmoi/.chezmoi.toml.tmpl\n" +
+			"    chezmoi execute-template --watch ~/.local/share/chezmoi/dot_gitconfig.tmpl",
 	},
 	"forget": {
 		long: "" +
 			"Description:\n" +
-			"  Remove *targets* from the source state, i.e. stop managing them.",
+			"  Remove *targets* from the source state, i.e. stop managing them.\n" +
+			"\n" +
+			"  `--exclude` *pattern*\n" +
+			"\n" +
+			"  Exclude targets matching *pattern*. This flag can be repeated.",
+		example: "" +
+			"  chezmoi forget ~/.bashrc\n" +
+			"  chezmoi forget ~/.config/zsh/'*.zsh' --exclude ~/.config/zsh/local.zsh",
+	},
+	"generate": {
+		long: "" +
+			"Description:\n" +
+			"  Generate a self-contained script that bootstraps a new machine: it downloads\n" +
+			"  the latest chezmoi release for the machine's operating system and architecture\n" +
+			"  using either `curl` or `wget`, verifies its SHA256 checksum, installs it, and\n" +
+			"  runs `chezmoi init --apply` with your repo. chezmoi is installed in\n" +
+			"  `$CHEZMOI_PREFIX/bin`, where `$CHEZMOI_PREFIX` defaults to `$HOME/.local`, and\n" +
+			"  the version to install can be set with `$CHEZMOI_VERSION`.\n" +
+			"\n" +
+			"  `--format` *format*\n" +
+			"\n" +
+			"  Set the format of the generated script, either `sh` (the default) for a POSIX\n" +
+			"  shell script, or `powershell` for a PowerShell script for Windows. The\n" +
+			"  PowerShell script installs chezmoi in `$env:LOCALAPPDATA\\chezmoi\\bin` by\n" +
+			"  default.\n" +
+			"\n" +
+			"  `-o`, `--output` *filename*\n" +
+			"\n" +
+			"  Write the script to *filename* instead of stdout.\n" +
+			"\n" +
+			"  `--repo` *repo*\n" +
+			"\n" +
+			"  Initialize chezmoi from *repo*. By default, the URL of the source directory's\n" +
+			"  upstream remote is used.",
 		example: "" +
-			"  chezmoi forget ~/.bashrc",
+			"  chezmoi generate install.sh > install.sh\n" +
+			"  chezmoi generate install.sh --repo https://github.com/user/dotfiles.git\n" +
+			"  chezmoi generate install.sh --format=powershell -o install.ps1",
 	},
 	"git": {
 		long: "" +
@@ -308,25 +784,61 @@ var helps = map[string]help{
 			"\n" +
 			"  The only supported archive format is `.tar.gz`.\n" +
 			"\n" +
+			"  Alternatively, with `--repo`, import a subdirectory of a git repository. The\n" +
+			"  repository is shallow cloned to a temporary directory, which is removed\n" +
+			"  afterwards. The repository, subdirectory, branch, and imported commit are\n" +
+			"  recorded in the persistent state so that the import can later be refreshed\n" +
+			"  with `--update`.\n" +
+			"\n" +
+			"  `--branch` *branch*, `--depth` *depth*\n" +
+			"\n" +
+			"  Clone *branch* of the repo given with `--repo`, and create a shallow clone with\n" +
+			"  a history truncated to *depth* commits. The default depth is 1.\n" +
+			"\n" +
 			"  `--destination` *directory*\n" +
 			"\n" +
 			"  Set the destination (in the source state) where the archive will be imported.\n" +
+			"  Required with `--repo`.\n" +
 			"\n" +
 			"  `-x`, `--exact`\n" +
 			"\n" +
 			"  Set the `exact` attribute on all imported directories.\n" +
 			"\n" +
+			"  `--exclude` *pattern*\n" +
+			"\n" +
+			"  Do not import targets matching *pattern* when importing from a repo. This flag\n" +
+			"  can be repeated.\n" +
+			"\n" +
+			"  `--path` *path*\n" +
+			"\n" +
+			"  Import only *path*, relative to the root of the repo given with `--repo`.\n" +
+			"\n" +
 			"  `-r`, `--remove-destination`\n" +
 			"\n" +
 			"  Remove destination (in the source state) before importing.\n" +
 			"\n" +
+			"  `--repo` *repo*\n" +
+			"\n" +
+			"  Import from a shallow clone of *repo* instead of from an archive file. `.git`\n" +
+			"  directories are not imported.\n" +
+			"\n" +
 			"  `--strip-components` *n*\n" +
 			"\n" +
-			"  Strip *n* leading components from paths.",
+			"  Strip *n* leading components from paths.\n" +
+			"\n" +
+			"  `--update`\n" +
+			"\n" +
+			"  Update every import recorded with `--repo` whose repo has new commits, and\n" +
+			"  report which imports were updated and which were unchanged. The previous\n" +
+			"  import is removed from the source state first, so files removed from the repo\n" +
+			"  are removed from the source state.",
 		example: "" +
 			"  curl -s -L -o oh-my-zsh-master.tar.gz https://github.com/robbyrussell/oh-my-\n" +
 			"zsh/archive/master.tar.gz\n" +
-			"  chezmoi import --strip-components 1 --destination ~/.oh-my-zsh oh-my-zsh-master.tar.gz",
+			"  chezmoi import --strip-components 1 --destination ~/.oh-my-zsh oh-my-zsh-master.tar.gz\n" +
+			"  chezmoi import --repo https://github.com/ohmyzsh/ohmyzsh.git --path plugins --\n" +
+			"destination ~/.oh-my-zsh/plugins --exact\n" +
+			"  chezmoi import --update",
 	},
 	"init": {
 		long: "" +
@@ -337,10 +849,88 @@ var helps = map[string]help{
 			"  If a file called `.chezmoi.format.tmpl` exists, where `format` is one of the\n" +
 			"  supported file formats (e.g. `json`, `toml`, or `yaml`) then a new\n" +
 			"  configuration file is created using that file as a template. Finally, if the `--\n" +
-			"  apply` flag is passed, `chezmoi apply` is run.",
+			"  apply` flag is passed, `chezmoi apply` is run.\n" +
+			"\n" +
+			"  If the source VCS is git, `chezmoi init` also offers to create a `.gitignore`\n" +
+			"  and a `.gitattributes` in the source directory, unless they are already\n" +
+			"  managed or `sourceVCS.gitFiles` is set, in which case they are created without\n" +
+			"  asking. chezmoi only writes a block delimited by `# BEGIN chezmoi managed\n" +
+			"  block` and `# END chezmoi managed block` lines, appending it if it is missing,\n" +
+			"  and never changes anything outside it. The `.gitignore` block ignores files\n" +
+			"  that should never be committed, like `.DS_Store`. The `.gitattributes` block\n" +
+			"  marks encrypted files as binary. If `sourceVCS.textconv` is set, for example\n" +
+			"  to `gpg --decrypt --quiet`, encrypted files are instead diffed with a git diff\n" +
+			"  driver that runs it, which chezmoi configures in the source repo. Once the\n" +
+			"  blocks exist, they are kept up to date by every command that changes the\n" +
+			"  source directory.\n" +
+			"\n" +
+			"  When *repo* is given and has not been trusted before, `chezmoi init` asks\n" +
+			"  whether to trust it. Templates in an untrusted repo cannot call the template\n" +
+			"  functions that read secrets or run arbitrary commands, like `keyring`, `pass`,\n" +
+			"  and `commandVersion`, or that make network requests or read the environment,\n" +
+			"  `getHostByName`, `env`, and `expandenv`, which return an error instead, and\n" +
+			"  its scripts are not run. The answer is recorded for the repo's origin URL in\n" +
+			"  the persistent state, and later commands that apply the target state ask again\n" +
+			"  until the repo is trusted. Commands that only read the target state, like\n" +
+			"  `chezmoi diff` and `chezmoi cat`, apply the same restrictions without asking.\n" +
+			"  Trust can be revoked with `chezmoi state revoke-trust`.\n" +
+			"\n" +
+			"  `--branch` *branch*\n" +
+			"\n" +
+			"  Check out *branch* of *repo* instead of the default branch. Only supported by\n" +
+			"  git.\n" +
+			"\n" +
+			"  `--depth` *depth*\n" +
+			"\n" +
+			"  Create a shallow clone of *repo* with a history truncated to *depth* commits.\n" +
+			"  Only supported by git.\n" +
+			"\n" +
+			"  `--log-file` *filename*, `--log-format` *format*\n" +
+			"\n" +
+			"  Append a log of the operations performed by `--apply` to *filename*, as for\n" +
+			"  `chezmoi apply`.\n" +
+			"\n" +
+			"  `--trust`\n" +
+			"\n" +
+			"  Trust *repo* without asking.",
 		example: "" +
 			"  chezmoi init https://github.com/user/dotfiles.git\n" +
-			"  chezmoi init https://github.com/user/dotfiles.git --apply",
+			"  chezmoi init https://github.com/user/dotfiles.git --apply\n" +
+			"  chezmoi init https://github.com/user/dotfiles.git --branch work --depth 1",
+	},
+	"lint": {
+		long: "" +
+			"Description:\n" +
+			"  Check the source state for problems without applying it, for example in\n" +
+			"  continuous integration before pushing your dotfiles. `lint` reports all the\n" +
+			"  problems it finds, with the file and line number where known, rather than\n" +
+			"  stopping at the first. It checks that:\n" +
+			"\n" +
+			"  • every template parses and executes,\n" +
+			"  • every encrypted file can be decrypted,\n" +
+			"  • attribute prefixes are in the correct order and well-formed,\n" +
+			"  • patterns in `.chezmoiignore` and `.chezmoiremove` are valid,\n" +
+			"  • `.chezmoidependencies` is well-formed and contains no cycles,\n" +
+			"  • no two entries in the same source directory have the same target, and\n" +
+			"  • the version of chezmoi satisfies `.chezmoiversion`.\n" +
+			"\n" +
+			"  Secret manager template functions, for example `bitwarden` and `pass`, are not\n" +
+			"  called. Instead, they return placeholder values, and templates that use them\n" +
+			"  are allowed to access missing keys. `lint` exits with a non-zero status if any\n" +
+			"  problems are found.\n" +
+			"\n" +
+			"  `-f`, `--format` *format*\n" +
+			"\n" +
+			"  Print the problems in the given *format*: `text` (the default), `json`, or\n" +
+			"  `yaml`.\n" +
+			"\n" +
+			"  `--no-decrypt`\n" +
+			"\n" +
+			"  Do not check that encrypted files can be decrypted, for example if your\n" +
+			"  private key is not available.",
+		example: "" +
+			"  chezmoi lint\n" +
+			"  chezmoi lint --no-decrypt --format=json",
 	},
 	"manage": {
 		long: "" +
@@ -351,30 +941,74 @@ var helps = map[string]help{
 		long: "" +
 			"Description:\n" +
 			"  List all managed entries in the destination directory in alphabetical order.\n" +
+			"  If *targets* are given, then only the managed entries in *targets* are listed.\n" +
+			"\n" +
+			"  `--exclude` *pattern*\n" +
+			"\n" +
+			"  Exclude targets matching *pattern*. This flag can be repeated.\n" +
+			"\n" +
+			"  `-f`, `--format` *format*\n" +
+			"\n" +
+			"  Print the managed entries in the given format. The accepted formats are `text`\n" +
+			"  (the default), which prints one target path per line, and `json` and `yaml`,\n" +
+			"  which print a list of entries, each with its `path`, its `type` (`dir`,\n" +
+			"  `file`, `script`, or `symlink`), its `mode` (for directories and files),\n" +
+			"  whether it is a `template`, whether it is `encrypted`, and, with `--with-source-\n" +
+			"  dir`, its `sourceDir`.\n" +
 			"\n" +
 			"  `-i`, `--include` *types*\n" +
 			"\n" +
 			"  Only list entries of type *types*. *types* is a comma-separated list of types\n" +
-			"  of entry to include. Valid types are `dirs`, `files`, and `symlinks` which can\n" +
-			"  be abbreviated to `d`, `f`, and `s` respectively. By default, `manage` will\n" +
-			"  list entries of all types.",
+			"  of entry to include. Valid types are `dirs`, `files`, `scripts`, and\n" +
+			"  `symlinks`, and `dirs`, `files`, and `symlinks` can be abbreviated to `d`,\n" +
+			"  `f`, and `s` respectively, and `all` includes all types. By default, `managed`\n" +
+			"  will list directories, files, and symlinks. Types can also be excluded with `--\n" +
+			"  exclude`.\n" +
+			"\n" +
+			"  `--with-source-dir`\n" +
+			"\n" +
+			"  Also print the source directory that contains each entry, separated from the\n" +
+			"  entry by a tab. This is useful with multiple source directories.",
 		example: "" +
 			"  chezmoi managed\n" +
 			"  chezmoi managed --include=files\n" +
 			"  chezmoi managed --include=files,symlinks\n" +
 			"  chezmoi managed -i d\n" +
-			"  chezmoi managed -i d,f",
+			"  chezmoi managed -i d,f\n" +
+			"  chezmoi managed --with-source-dir\n" +
+			"  chezmoi managed --include=files ~/.config\n" +
+			"  chezmoi managed --include=all --format=json",
 	},
 	"merge": {
 		long: "" +
 			"Description:\n" +
-			"  Perform a three-way merge between the destination state, the source state, and\n" +
-			"  the target state. The merge tool is defined by the `merge.command`\n" +
-			"  configuration variable, and defaults to `vimdiff`. If multiple targets are\n" +
-			"  specified the merge tool is invoked for each target. If the target state\n" +
-			"  cannot be computed (for example if source is a template containing errors or\n" +
-			"  an encrypted file that cannot be decrypted) a two-way merge is performed\n" +
-			"  instead.",
+			"  Perform a three-way merge between the destination state, the contents that\n" +
+			"  chezmoi last applied to the target, and the target state. The merge tool is\n" +
+			"  defined by the `merge.command` configuration variable, and defaults to\n" +
+			"  `vimdiff`. If multiple targets are specified the merge tool is invoked for\n" +
+			"  each target. `chezmoi apply` records the contents that it applies in the\n" +
+			"  persistent state, except for encrypted files, templates, private files, and\n" +
+			"  large files, so that secrets are never stored in plaintext. If no contents are\n" +
+			"  recorded for a target then a two-way merge between the destination state and\n" +
+			"  the target state is performed instead. If the target state cannot be computed\n" +
+			"  (for example if source is a template containing errors or an encrypted file\n" +
+			"  that cannot be decrypted) then the source state is used instead of the target\n" +
+			"  state.\n" +
+			"\n" +
+			"  By default, the merge tool is invoked with `merge.args` followed by the\n" +
+			"  destination, the last applied contents, and the target state. If any of\n" +
+			"  `merge.args` contain templates then the merge tool is invoked with just\n" +
+			"  `merge.args`, each executed as a template with the fields `.Destination`,\n" +
+			"  `.Base`, and `.Target`. Arguments that are empty after executing, like `{{\n" +
+			"  .Base }}` when no contents are recorded, are omitted.\n" +
+			"\n" +
+			"    [merge]\n" +
+			"        command = \"meld\"\n" +
+			"        args = [\"{{ .Destination }}\", \"{{ .Base }}\", \"{{ .Target }}\"]\n" +
+			"\n" +
+			"  If the merged destination differs from the target state then chezmoi offers to\n" +
+			"  re-add it to the source state, unless it is a template, encrypted, or generated\n" +
+			"  by a `modify_` script.",
 		example: "" +
 			"  chezmoi merge ~/.bashrc",
 	},
@@ -391,11 +1025,38 @@ var helps = map[string]help{
 			"  chezmoi purge\n" +
 			"  chezmoi purge --force",
 	},
+	"re-add": {
+		long: "" +
+			"Description:\n" +
+			"  Re-add all modified files in *targets*, or all managed files if no *targets*\n" +
+			"  are given, to the source state. A file is modified if its contents in the\n" +
+			"  destination directory differ from its target state, for example because you\n" +
+			"  edited it directly instead of with `chezmoi edit`. Its source state is then\n" +
+			"  replaced as if with `chezmoi add`.\n" +
+			"\n" +
+			"  Templates and encrypted files are never re-added, as that would lose their\n" +
+			"  template actions or encryption. Instead, chezmoi prints a warning for each one\n" +
+			"  that has been modified.\n" +
+			"\n" +
+			"  `--exclude` *pattern*\n" +
+			"\n" +
+			"  Exclude targets matching *pattern*. This flag can be repeated.\n" +
+			"\n" +
+			"  `re-add` examples\n" +
+			"\n" +
+			"    chezmoi re-add\n" +
+			"    chezmoi re-add ~/.bashrc\n" +
+			"    chezmoi re-add --dry-run --verbose",
+	},
 	"remove": {
 		long: "" +
 			"Description:\n" +
 			"  Remove *targets* from both the source state and the destination directory.\n" +
 			"\n" +
+			"  `--exclude` *pattern*\n" +
+			"\n" +
+			"  Exclude targets matching *pattern*. This flag can be repeated.\n" +
+			"\n" +
 			"  `-f`, `--force`\n" +
 			"\n" +
 			"  Remove without prompting.",
@@ -418,6 +1079,7 @@ var helps = map[string]help{
 			"\n" +
 			"    chezmoi secret help",
 		example: "" +
+			"  chezmoi secret aws-secrets-manager list-secrets\n" +
 			"  chezmoi secret bitwarden list items\n" +
 			"  chezmoi secret keyring set --service service --user user\n" +
 			"  chezmoi secret keyring get --service service --user user\n" +
@@ -450,6 +1112,103 @@ var helps = map[string]help{
 			"    chezmoi source-path\n" +
 			"    chezmoi source-path ~/.bashrc",
 	},
+	"state": {
+		long: "" +
+			"Description:\n" +
+			"  Manipulate the persistent state. The persistent state is stored in the file\n" +
+			"  set by the `stateFile` configuration variable or, by default, in\n" +
+			"  `$XDG_STATE_HOME/chezmoi/chezmoistate.boltdb`, where `XDG_STATE_HOME` defaults\n" +
+			"  to `~/.local/state`. Setting `stateFile` is useful when the config file is\n" +
+			"  deployed to a read-only location.\n" +
+			"\n" +
+			"  Earlier versions of chezmoi stored the persistent state in the same directory\n" +
+			"  as the config file. If only this legacy file exists, then chezmoi copies it to\n" +
+			"  the new location, checks the copy, prints a one-time notice, and uses the copy\n" +
+			"  from then on. The legacy file is not removed. With `--dry-run` the legacy file is\n" +
+			"  used and not copied.\n" +
+			"\n" +
+			"  The following subcommands are available:\n" +
+			"\n" +
+			"  • `delete-bucket`: delete a bucket and everything in it. For example, `chezmoi\n" +
+			"  state delete-bucket --bucket=script` forgets which `run_once_` scripts have\n" +
+			"  been run, so they are run again by the next `chezmoi apply`, without changing\n" +
+			"  the rest of the persistent state.\n" +
+			"  • `dump`: write the contents of a bucket to stdout.\n" +
+			"  • `orphans`: list the keys of script states that do not correspond to any\n" +
+			"  script in the current source state, for example because the script was\n" +
+			"  removed or renamed. Earlier versions of scripts that still exist are not\n" +
+			"  orphans.\n" +
+			"  • `prune`: remove the script states listed by `orphans`, after prompting for\n" +
+			"  confirmation. With `--dry-run`, the states that would be removed are printed\n" +
+			"  instead.\n" +
+			"  • `reset`: remove the persistent state file entirely, after prompting for\n" +
+			"  confirmation.\n" +
+			"  • `revoke-trust` *repo*...: stop trusting each *repo*, so that its templates\n" +
+			"  cannot read secrets and its scripts are not run until it is trusted again.\n" +
+			"\n" +
+			"  `-b`, `--bucket` *bucket*\n" +
+			"\n" +
+			"  Operate on *bucket*. The default bucket is `script`, which records each\n" +
+			"  `run_once_` script that has been run, including when it was run, the version\n" +
+			"  of chezmoi that ran it, its exit status, its duration, and the SHA256 sum of\n" +
+			"  its contents.\n" +
+			"\n" +
+			"  `-f`, `--force`\n" +
+			"\n" +
+			"  With `prune` and `reset`, remove without prompting.\n" +
+			"\n" +
+			"  `-f`, `--format` *format*\n" +
+			"\n" +
+			"  With `dump`, print the dump in the given format. The accepted formats are\n" +
+			"  `json` (JSON), `toml` (TOML), and `yaml` (YAML).",
+		example: "" +
+			"  chezmoi state dump\n" +
+			"  chezmoi state dump --format=yaml\n" +
+			"  chezmoi state delete-bucket --bucket=script\n" +
+			"  chezmoi state orphans\n" +
+			"  chezmoi state prune --dry-run\n" +
+			"  chezmoi state revoke-trust https://github.com/user/dotfiles.git",
+	},
+	"status": {
+		long: "" +
+			"Description:\n" +
+			"  Print a summary of the changes that `chezmoi apply` would make to *targets*,\n" +
+			"  or to all targets if none are given, similar to `git status --short`. Each line\n" +
+			"  contains two status characters followed by the target name. Targets and\n" +
+			"  scripts that are up to date are not printed.\n" +
+			"\n" +
+			"  The first character is `M` if the target has been modified, or `D` if it has\n" +
+			"  been deleted, since it was last applied, and a space otherwise. For scripts,\n" +
+			"  it is `M` if a `run_once_` script has been modified since it was last\n" +
+			"  successfully run. The second character is `A`, `M`, or `D` if applying the\n" +
+			"  target would add, modify, or delete it, `R` if the script will be run, and a\n" +
+			"  space otherwise.\n" +
+			"\n" +
+			"  If any target would be changed or any script would be run then chezmoi exits\n" +
+			"  with exit code 1, so `chezmoi status` can be used in shell prompts.\n" +
+			"\n" +
+			"  `--source-drift`\n" +
+			"\n" +
+			"  Instead of the status of targets, print the commit of the source directory\n" +
+			"  that was last applied, the time it was applied, and whether the source\n" +
+			"  directory had uncommitted changes at the time, followed by the current commit\n" +
+			"  of the source directory, for example:\n" +
+			"\n" +
+			"    applied: 4b2c9e8f0d1a7c3e5f6a8b9c0d1e2f3a4b5c6d7e (dirty) at 2021-02-\n" +
+			"  03T04:05:06Z\n" +
+			"    head:    9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b\n" +
+			"\n" +
+			"  chezmoi exits with exit code 1 if the source directory has changed since it\n" +
+			"  was last applied. The commit is recorded in the persistent state after each\n" +
+			"  successful `chezmoi apply` of all targets, if the source directory is a\n" +
+			"  working copy of the source VCS. It is also available in templates as\n" +
+			"  `.chezmoi.lastAppliedCommit` and in the commit message template as\n" +
+			"  `lastAppliedCommit`.",
+		example: "" +
+			"  chezmoi status\n" +
+			"  chezmoi status ~/.bashrc\n" +
+			"  chezmoi status --source-drift",
+	},
 	"unmanage": {
 		long: "" +
 			"Description:\n" +
@@ -458,16 +1217,56 @@ var helps = map[string]help{
 	"unmanaged": {
 		long: "" +
 			"Description:\n" +
-			"  List all unmanaged files in the destination directory.",
+			"  List all unmanaged files in the destination directory, for example files that\n" +
+			"  were created by hand and never added. Targets that are ignored by\n" +
+			"  `.chezmoiignore` and the source directory are skipped. Symlinks are not\n" +
+			"  followed. By default, the contents of unmanaged directories are not listed,\n" +
+			"  only the directories themselves.\n" +
+			"\n" +
+			"  `-p`, `--path-style` `absolute`|`relative`\n" +
+			"\n" +
+			"  Print paths either as absolute paths (the default) or relative to the\n" +
+			"  destination directory.\n" +
+			"\n" +
+			"  `-r`, `--recursive`\n" +
+			"\n" +
+			"  List the contents of unmanaged directories too.",
 		example: "" +
-			"  chezmoi unmanaged",
+			"  chezmoi unmanaged\n" +
+			"  chezmoi unmanaged --path-style=relative\n" +
+			"  chezmoi unmanaged --recursive",
 	},
 	"update": {
 		long: "" +
 			"Description:\n" +
-			"  Pull changes from the source VCS and apply any changes.",
+			"  Pull changes from the source VCS and apply any changes.\n" +
+			"\n" +
+			"  `--check`\n" +
+			"\n" +
+			"  Fetch from the source directory's upstream and print a one-line summary of the\n" +
+			"  number of new commits, followed by the new commits, without pulling or\n" +
+			"  applying them. If upstream has new commits then chezmoi exits with exit code\n" +
+			"  2. Only supported by git.\n" +
+			"\n" +
+			"  `--log-file` *filename*, `--log-format` *format*\n" +
+			"\n" +
+			"  Append a log of the operations performed when applying changes to *filename*,\n" +
+			"  as for `chezmoi apply`.\n" +
+			"\n" +
+			"  `--poll` *interval*\n" +
+			"\n" +
+			"  Check upstream for new commits every *interval*, for example `15m`, and pull\n" +
+			"  and apply them when there are any, until interrupted. Each check is logged. If\n" +
+			"  fetching or pulling fails, for example because the network is unavailable,\n" +
+			"  then the check is retried after the next *interval*. If applying fails then\n" +
+			"  polling stops. Only supported by git.\n" +
+			"\n" +
+			"  With `--dry-run`, `--check` and `--poll` still fetch, so that they show the commits\n" +
+			"  that would be pulled, but do not pull or apply them.",
 		example: "" +
-			"  chezmoi update",
+			"  chezmoi update\n" +
+			"  chezmoi update --check\n" +
+			"  chezmoi update --poll 15m",
 	},
 	"upgrade": {
 		long: "" +
@@ -495,9 +1294,27 @@ var helps = map[string]help{
 			"Description:\n" +
 			"  Verify that all *targets* match their target state. chezmoi exits with code 0\n" +
 			"  (success) if all targets match their target state, or 1 (failure) otherwise.\n" +
-			"  If no targets are specified then all targets are checked.",
+			"  If no targets are specified then all targets are checked. The targets whose\n" +
+			"  contents, mode, or type differ are printed, one per line. Scripts are ignored.\n" +
+			"\n" +
+			"  `--exclude` *types-or-pattern*\n" +
+			"\n" +
+			"  Exclude entries as for archive. This flag can be repeated.\n" +
+			"\n" +
+			"  `--exclude-encrypted`\n" +
+			"\n" +
+			"  Skip encrypted targets, as for apply.\n" +
+			"\n" +
+			"  `-q`, `--quiet`\n" +
+			"\n" +
+			"  Do not print the targets that differ.\n" +
+			"\n" +
+			"  `--symlink`\n" +
+			"\n" +
+			"  Verify plain files as symbolic links, as for apply.",
 		example: "" +
 			"  chezmoi verify\n" +
-			"  chezmoi verify ~/.bashrc",
+			"  chezmoi verify ~/.bashrc\n" +
+			"  chezmoi verify --quiet || chezmoi apply",
 	},
 }
@@ -10,6 +10,17 @@ func (hgVCS) AddArgs(path string) []string {
 	return nil
 }
 
+func (hgVCS) AheadBehindArgs() []string {
+	return nil
+}
+
+// ArchiveArgs archives revision without hg's default <repo>-<hash>/ prefix,
+// decode filters, or .hg_archival.txt, so that the archive has the same layout
+// as the source directory.
+func (hgVCS) ArchiveArgs(revision string) []string {
+	return []string{"archive", "--rev", revision, "--type", "tar", "--prefix", ".", "--no-decode", "-X", ".hg_archival.txt", "-"}
+}
+
 func (hgVCS) CloneArgs(repo, dir string) []string {
 	return []string{"clone", repo, dir}
 }
@@ -18,10 +29,26 @@ func (hgVCS) CommitArgs(message string) []string {
 	return nil
 }
 
+func (hgVCS) FetchArgs() []string {
+	return nil
+}
+
+func (hgVCS) HeadArgs() []string {
+	return []string{"log", "--rev", ".", "--template", "{node}"}
+}
+
+func (hgVCS) IncomingArgs() []string {
+	return nil
+}
+
 func (hgVCS) InitArgs() []string {
 	return []string{"init"}
 }
 
+func (hgVCS) ParseAheadBehindOutput(output []byte) (int, int, error) {
+	return 0, 0, nil
+}
+
 func (hgVCS) ParseStatusOutput(output []byte) (interface{}, error) {
 	return nil, nil
 }
@@ -34,6 +61,10 @@ func (hgVCS) PushArgs() []string {
 	return nil
 }
 
+func (hgVCS) RemoteURLArgs() []string {
+	return []string{"paths", "default"}
+}
+
 func (hgVCS) StatusArgs() []string {
 	return nil
 }
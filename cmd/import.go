@@ -2,15 +2,20 @@ package cmd
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/bzip2"
 	"compress/gzip"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
+	vfs "github.com/twpayne/go-vfs"
 
 	"github.com/twpayne/chezmoi/internal/chezmoi"
 )
@@ -18,7 +23,7 @@ import (
 var _importCmd = &cobra.Command{
 	Use:     "import [filename]",
 	Args:    cobra.MaximumNArgs(1),
-	Short:   "Import a tar archive into the source state",
+	Short:   "Import a tar archive or a git repository into the source state",
 	Long:    mustGetLongHelp("import"),
 	Example: getExample("import"),
 	PreRunE: config.ensureNoError,
@@ -27,22 +32,74 @@ var _importCmd = &cobra.Command{
 
 type importCmdConfig struct {
 	removeDestination bool
+	repo              string
+	path              string
+	update            bool
 	importTAROptions  chezmoi.ImportTAROptions
 }
 
+// A repoImport records an import of a subdirectory of a repository.
+type repoImport struct {
+	Repo    string   `json:"repo"`
+	Path    string   `json:"path"`
+	Branch  string   `json:"branch,omitempty"`
+	Exact   bool     `json:"exact"`
+	Exclude []string `json:"exclude,omitempty"`
+	Commit  string   `json:"commit"`
+}
+
 func init() {
 	rootCmd.AddCommand(_importCmd)
 
 	persistentFlags := _importCmd.PersistentFlags()
 	persistentFlags.StringVarP(&config._import.importTAROptions.DestinationDir, "destination", "d", "", "destination prefix")
 	persistentFlags.BoolVarP(&config._import.importTAROptions.Exact, "exact", "x", false, "import directories exactly")
+	persistentFlags.StringArrayVar(&config.exclude, "exclude", nil, "exclude targets matching pattern")
 	persistentFlags.IntVar(&config._import.importTAROptions.StripComponents, "strip-components", 0, "strip components")
 	persistentFlags.BoolVarP(&config._import.removeDestination, "remove-destination", "r", false, "remove destination before import")
+	persistentFlags.StringVar(&config._import.repo, "repo", "", "import from a shallow clone of repo")
+	persistentFlags.StringVar(&config._import.path, "path", "", "subdirectory of repo to import")
+	persistentFlags.BoolVar(&config._import.update, "update", false, "update all imports from repos")
+	addCloneFlags(_importCmd)
 
-	panicOnError(_importCmd.MarkZshCompPositionalArgumentFile(1, "*.tar", "*.tar.bz2", "*.tar.gz", "*.tgz"))
+	_importCmd.ValidArgsFunction = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"tar", "tar.bz2", "tar.gz", "tgz"}, cobra.ShellCompDirectiveFilterFileExt
+	}
 }
 
 func (c *Config) runImportCmd(cmd *cobra.Command, args []string) error {
+	switch {
+	case c._import.update:
+		if len(args) != 0 || c._import.repo != "" {
+			return fmt.Errorf("--update cannot be used with a filename or --repo")
+		}
+		return c.updateRepoImports()
+	case c._import.repo != "":
+		if len(args) != 0 {
+			return fmt.Errorf("--repo cannot be used with a filename")
+		}
+		if c._import.importTAROptions.DestinationDir == "" {
+			return fmt.Errorf("--repo requires --destination")
+		}
+		destDir, err := filepath.Abs(c._import.importTAROptions.DestinationDir)
+		if err != nil {
+			return err
+		}
+		persistentState, err := c.getPersistentState(nil)
+		if err != nil {
+			return err
+		}
+		defer persistentState.Close()
+		_, err = c.importRepo(persistentState, destDir, &repoImport{
+			Repo:    c._import.repo,
+			Path:    c._import.path,
+			Branch:  c.clone.branch,
+			Exact:   c._import.importTAROptions.Exact,
+			Exclude: c.exclude,
+		})
+		return err
+	}
+
 	ts, err := c.getTargetState(nil)
 	if err != nil {
 		return err
@@ -72,17 +129,224 @@ func (c *Config) runImportCmd(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("%s: unknown format", arg)
 		}
 	}
+	importTAROptions := c._import.importTAROptions
+	if importTAROptions.DestinationDir == "" {
+		importTAROptions.DestinationDir = ts.DestDir
+	} else if importTAROptions.DestinationDir, err = c.getTargetPath(ts, importTAROptions.DestinationDir); err != nil {
+		return err
+	}
 	if c._import.removeDestination {
-		entry, err := ts.Get(c.fs, c._import.importTAROptions.DestinationDir)
+		if err := c.removeImportDestination(ts, importTAROptions.DestinationDir); err != nil {
+			return err
+		}
+	}
+	return ts.ImportTAR(tar.NewReader(r), importTAROptions, c.mutator)
+}
+
+// importRepo imports ri.Path from a shallow clone of ri.Repo into destDir and
+// records the import, including the imported commit, in persistentState. If
+// ri.Commit is already the latest commit then nothing is imported. It returns
+// the latest commit.
+func (c *Config) importRepo(persistentState chezmoi.PersistentState, destDir string, ri *repoImport) (string, error) {
+	if c.clone.depth == 0 {
+		c.clone.depth = 1
+	}
+	c.clone.branch = ri.Branch
+	c.exclude = ri.Exclude
+	cloneDir, err := c.makeTempClone(ri.Repo, "chezmoi-import")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = c.fs.RemoveAll(cloneDir)
+	}()
+
+	commit, err := c.getCloneCommit(cloneDir)
+	if err != nil {
+		return "", err
+	}
+	if commit == ri.Commit {
+		return commit, nil
+	}
+
+	ts, err := c.getTargetState(nil)
+	if err != nil {
+		return "", err
+	}
+	if c._import.removeDestination || ri.Commit != "" {
+		// Remove the previous import so that files removed from the repo are
+		// removed from the source state, and repopulate the target state.
+		if err := c.removeImportDestination(ts, destDir); err != nil {
+			return "", err
+		}
+		if ts, err = c.getTargetState(nil); err != nil {
+			return "", err
+		}
+	}
+	b := &bytes.Buffer{}
+	if err := c.writeRepoTAR(b, filepath.Join(cloneDir, ri.Path), ts, destDir); err != nil {
+		return "", err
+	}
+	if err := ts.ImportTAR(tar.NewReader(b), chezmoi.ImportTAROptions{
+		DestinationDir: destDir,
+		Exact:          ri.Exact,
+	}, c.mutator); err != nil {
+		return "", err
+	}
+
+	if c.DryRun {
+		return commit, nil
+	}
+	ri.Commit = commit
+	value, err := json.Marshal(ri)
+	if err != nil {
+		return "", err
+	}
+	return commit, persistentState.Set(c.repoImportBucket, []byte(destDir), value)
+}
+
+// getCloneCommit returns the commit checked out in cloneDir.
+func (c *Config) getCloneCommit(cloneDir string) (string, error) {
+	rawCloneDir, err := c.fs.RawPath(cloneDir)
+	if err != nil {
+		return "", err
+	}
+	//nolint:gosec
+	cmd := exec.Command(c.SourceVCS.Command, "rev-parse", "HEAD")
+	cmd.Dir = rawCloneDir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSpace(output)), nil
+}
+
+// removeImportDestination removes the source state of destDir, if any.
+func (c *Config) removeImportDestination(ts *chezmoi.TargetState, destDir string) error {
+	entry, err := ts.Get(c.fs, destDir)
+	switch {
+	case err == nil:
+		return c.mutator.RemoveAll(ts.SourcePath(entry))
+	case os.IsNotExist(err):
+		return nil
+	default:
+		return err
+	}
+}
+
+// updateRepoImports updates all recorded imports from repos to their latest
+// commits.
+func (c *Config) updateRepoImports() error {
+	persistentState, err := c.getPersistentState(nil)
+	if err != nil {
+		return err
+	}
+	defer persistentState.Close()
+
+	repoImports := make(map[string]*repoImport)
+	if err := persistentState.ForEach(c.repoImportBucket, func(k, v []byte) error {
+		var ri repoImport
+		if err := json.Unmarshal(v, &ri); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		repoImports[string(k)] = &ri
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	destDirs := make([]string, 0, len(repoImports))
+	for destDir := range repoImports {
+		destDirs = append(destDirs, destDir)
+	}
+	sort.Strings(destDirs)
+	for _, destDir := range destDirs {
+		ri := repoImports[destDir]
+		oldCommit := ri.Commit
+		newCommit, err := c.importRepo(persistentState, destDir, ri)
+		if err != nil {
+			return fmt.Errorf("%s: %w", destDir, err)
+		}
+		if newCommit == oldCommit {
+			fmt.Fprintf(c.Stdout, "%s: unchanged at %s\n", destDir, shortCommit(oldCommit))
+		} else {
+			fmt.Fprintf(c.Stdout, "%s: updated from %s to %s\n", destDir, shortCommit(oldCommit), shortCommit(newCommit))
+		}
+	}
+	return nil
+}
+
+// writeRepoTAR writes a tar archive of dir to w, omitting .git directories and
+// targets in destDir excluded by c.exclude.
+func (c *Config) writeRepoTAR(w io.Writer, dir string, ts *chezmoi.TargetState, destDir string) error {
+	excluded := func(string) bool { return false }
+	if len(c.exclude) != 0 {
+		var err error
+		excluded, err = c.getExcluded(ts)
+		if err != nil {
+			return err
+		}
+	}
+	tw := tar.NewWriter(w)
+	if err := vfs.Walk(c.fs, dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Name() == ".git" {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if targetName, err := filepath.Rel(ts.DestDir, filepath.Join(destDir, relPath)); err == nil && excluded(targetName) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		header := &tar.Header{
+			Name: filepath.ToSlash(relPath),
+			Mode: int64(info.Mode().Perm()),
+		}
+		var contents []byte
 		switch {
-		case err == nil:
-			if err := c.mutator.RemoveAll(filepath.Join(c.SourceDir, entry.SourceName())); err != nil {
+		case info.IsDir():
+			header.Typeflag = tar.TypeDir
+		case info.Mode().IsRegular():
+			header.Typeflag = tar.TypeReg
+			contents, err = c.fs.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			header.Size = int64(len(contents))
+		case info.Mode()&os.ModeType == os.ModeSymlink:
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname, err = c.fs.Readlink(path)
+			if err != nil {
 				return err
 			}
-		case os.IsNotExist(err):
 		default:
+			return fmt.Errorf("%s: unsupported file type", path)
+		}
+		if err := tw.WriteHeader(header); err != nil {
 			return err
 		}
+		_, err = tw.Write(contents)
+		return err
+	}); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// shortCommit returns the abbreviated form of commit.
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
 	}
-	return ts.ImportTAR(tar.NewReader(r), c._import.importTAROptions, c.mutator)
+	return commit
 }
@@ -0,0 +1,108 @@
+// +build !windows
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+func TestImportCmdRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in $PATH")
+	}
+	repoDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(repoDir))
+	}()
+	require.NoError(t, os.MkdirAll(filepath.Join(repoDir, "plugins", "sub"), 0o755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, "README"), []byte("# readme\n"), 0o644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, "plugins", "foo.sh"), []byte("#!/bin/sh\n"), 0o755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, "plugins", "sub", "bar"), []byte("bar\n"), 0o644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, "plugins", "skip"), []byte("skip\n"), 0o644))
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=chezmoi", "-c", "user.email=chezmoi@example.com"}, args...)...)
+		cmd.Dir = repoDir
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+	git("init", "--quiet")
+	git("add", ".")
+	git("commit", "--quiet", "--message", "initial")
+
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	c := newTestConfig(fs, withStderr(ioutil.Discard))
+	c._import.repo = repoDir
+	c._import.path = "plugins"
+	c._import.importTAROptions.DestinationDir = "/home/user/.plugins"
+	c._import.importTAROptions.Exact = true
+	c.exclude = []string{"/home/user/.plugins/skip"}
+	require.NoError(t, c.runImportCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.local/share/chezmoi/exact_dot_plugins/executable_foo.sh",
+			vfst.TestContentsString("#!/bin/sh\n"),
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/exact_dot_plugins/exact_sub/bar",
+			vfst.TestContentsString("bar\n"),
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/exact_dot_plugins/.git",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/exact_dot_plugins/skip",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/README",
+			vfst.TestDoesNotExist,
+		),
+	)
+
+	stdout := &bytes.Buffer{}
+	c = newTestConfig(fs, withStdout(stdout), withStderr(ioutil.Discard))
+	c._import.update = true
+	require.NoError(t, c.runImportCmd(nil, nil))
+	assert.True(t, strings.HasPrefix(stdout.String(), "/home/user/.plugins: unchanged at "))
+
+	require.NoError(t, os.Remove(filepath.Join(repoDir, "plugins", "sub", "bar")))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, "plugins", "baz"), []byte("baz\n"), 0o644))
+	git("add", "--all", ".")
+	git("commit", "--quiet", "--message", "update")
+
+	stdout.Reset()
+	c = newTestConfig(fs, withStdout(stdout), withStderr(ioutil.Discard))
+	c._import.update = true
+	require.NoError(t, c.runImportCmd(nil, nil))
+	assert.True(t, strings.HasPrefix(stdout.String(), "/home/user/.plugins: updated from "))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.local/share/chezmoi/exact_dot_plugins/baz",
+			vfst.TestContentsString("baz\n"),
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/exact_dot_plugins/exact_sub/bar",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/exact_dot_plugins/skip",
+			vfst.TestDoesNotExist,
+		),
+	)
+
+	infos, err := fs.ReadDir(os.TempDir())
+	if err == nil {
+		for _, info := range infos {
+			assert.False(t, strings.HasPrefix(info.Name(), "chezmoi-import"))
+		}
+	}
+}
@@ -3,9 +3,13 @@ package cmd
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"text/template"
 
@@ -30,11 +34,31 @@ type initCmdConfig struct {
 	apply bool
 }
 
+// configTemplateSHA256Key is the key in the config state bucket of the SHA256
+// of the config file template that the config file was last generated from.
+var configTemplateSHA256Key = []byte("configTemplateSHA256")
+
+// A cloneConfig configures how commands clone repositories.
+type cloneConfig struct {
+	branch string
+	depth  int
+}
+
 func init() {
 	rootCmd.AddCommand(initCmd)
 
 	persistentFlags := initCmd.PersistentFlags()
 	persistentFlags.BoolVar(&config.init.apply, "apply", false, "update destination directory")
+	addApplyLogFlags(initCmd)
+	addCloneFlags(initCmd)
+	addTrustFlag(initCmd)
+}
+
+// addCloneFlags adds the --branch and --depth flags to cmd.
+func addCloneFlags(cmd *cobra.Command) {
+	persistentFlags := cmd.PersistentFlags()
+	persistentFlags.StringVar(&config.clone.branch, "branch", "", "clone branch")
+	persistentFlags.IntVar(&config.clone.depth, "depth", 0, "clone depth")
 }
 
 func (c *Config) runInitCmd(cmd *cobra.Command, args []string) error {
@@ -52,6 +76,14 @@ func (c *Config) runInitCmd(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// The persistent state can only be opened once, so it is shared between
+	// the trust check, the config file template, and the apply.
+	persistentState, err := c.getPersistentState(nil)
+	if err != nil {
+		return err
+	}
+	defer persistentState.Close()
+
 	switch len(args) {
 	case 0: // init
 		var initArgs []string
@@ -71,9 +103,9 @@ func (c *Config) runInitCmd(cmd *cobra.Command, args []string) error {
 			return err
 		}
 	case 1: // clone
-		cloneArgs := vcs.CloneArgs(args[0], rawSourceDir)
-		if cloneArgs == nil {
-			return fmt.Errorf("%s: cloning not supported", c.SourceVCS.Command)
+		cloneArgs, err := c.getCloneArgs(vcs, args[0], rawSourceDir)
+		if err != nil {
+			return err
 		}
 		if err := c.run("", c.SourceVCS.Command, cloneArgs...); err != nil {
 			return err
@@ -91,17 +123,26 @@ func (c *Config) runInitCmd(cmd *cobra.Command, args []string) error {
 				}
 			}
 		}
+		// Trust is stored for the repo's origin, which is the same as the
+		// repo given unless the VCS rewrites it.
+		repo, err := c.getRemoteURL()
+		if err != nil {
+			repo = args[0]
+		}
+		if err := c.ensureTrust(repo, persistentState); err != nil {
+			return err
+		}
+	}
+
+	if err := c.createConfigFile(persistentState); err != nil {
+		return err
 	}
 
-	if err := c.createConfigFile(); err != nil {
+	if err := c.initGitFiles(); err != nil {
 		return err
 	}
 
 	if c.init.apply {
-		persistentState, err := c.getPersistentState(nil)
-		if err != nil {
-			return err
-		}
 		if err := c.applyArgs(nil, persistentState); err != nil {
 			return err
 		}
@@ -110,7 +151,32 @@ func (c *Config) runInitCmd(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func (c *Config) createConfigFile() error {
+// initGitFiles maintains the source directory's .gitignore and
+// .gitattributes, offering to create them if they are not already managed.
+func (c *Config) initGitFiles() error {
+	if !c.isGit() {
+		return nil
+	}
+	if !c.SourceVCS.GitFiles {
+		ok, err := c.hasGitFiles()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			choice, err := c.prompt("Create and maintain .gitignore and .gitattributes in the source directory", "yn", 'n')
+			if err != nil || choice != 'y' {
+				return err
+			}
+		}
+	}
+	return c.updateGitFiles()
+}
+
+// createConfigFile generates the config file from the config file template in
+// the source directory, if any, and reads it. If the config file already exists
+// then it is only regenerated if the template has changed since it was last
+// generated and the user agrees.
+func (c *Config) createConfigFile(persistentState chezmoi.PersistentState) error {
 	filename, ext, data, err := c.findConfigTemplate()
 	if err != nil {
 		return err
@@ -121,11 +187,40 @@ func (c *Config) createConfigFile() error {
 		return nil
 	}
 
+	configPath := filepath.Join(filepath.Dir(getDefaultConfigFile(c.bds)), filename)
+	templateSHA256 := sha256.Sum256([]byte(data))
+	switch _, err := c.fs.Stat(configPath); {
+	case err == nil:
+		lastTemplateSHA256, err := persistentState.Get(c.configStateBucket, configTemplateSHA256Key)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(lastTemplateSHA256, templateSHA256[:]) {
+			return nil
+		}
+		choice, err := c.prompt(fmt.Sprintf("The config file template has changed since %s was generated, regenerate it", configPath), "yn", 'n')
+		if err != nil {
+			return err
+		}
+		if choice != 'y' {
+			return nil
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+
 	funcMap := make(template.FuncMap)
 	for key, value := range c.templateFuncs {
 		funcMap[key] = value
 	}
-	funcMap["promptString"] = c.promptString
+	for name, f := range map[string]interface{}{
+		"promptBool":   c.promptBool,
+		"promptInt":    c.promptInt,
+		"promptString": c.promptString,
+	} {
+		funcMap[name] = f
+		funcMap[chezmoiTemplateFuncPrefix+name] = f
+	}
 	t, err := template.New(filename).Funcs(funcMap).Parse(data)
 	if err != nil {
 		return err
@@ -143,26 +238,32 @@ func (c *Config) createConfigFile() error {
 		return err
 	}
 
-	configDir := filepath.Join(c.bds.ConfigHome, "chezmoi")
-	if err := vfs.MkdirAll(c.mutator, configDir, 0o777&^os.FileMode(c.Umask)); err != nil {
+	if err := vfs.MkdirAll(c.mutator, filepath.Dir(configPath), 0o777&^os.FileMode(c.Umask)); err != nil {
 		return err
 	}
 
-	configPath := filepath.Join(configDir, filename)
 	if err := c.mutator.WriteFile(configPath, contents.Bytes(), 0o600&^os.FileMode(c.Umask), nil); err != nil {
 		return err
 	}
+	if !c.DryRun {
+		if err := persistentState.Set(c.configStateBucket, configTemplateSHA256Key, templateSHA256[:]); err != nil {
+			return err
+		}
+	}
 
-	viper.SetConfigType(ext)
-	if err := viper.ReadConfig(contents); err != nil {
+	if err := readConfig(viper.GetViper(), ext, contents.Bytes()); err != nil {
 		return err
 	}
 	return viper.Unmarshal(c)
 }
 
 func (c *Config) findConfigTemplate() (string, string, string, error) {
-	for _, ext := range viper.SupportedExts {
-		contents, err := c.fs.ReadFile(filepath.Join(c.SourceDir, ".chezmoi."+ext+chezmoi.TemplateSuffix))
+	sourceRoot, err := c.getSourceRoot(c.SourceDir)
+	if err != nil {
+		return "", "", "", err
+	}
+	for _, ext := range configFileExtensions {
+		contents, err := c.fs.ReadFile(filepath.Join(sourceRoot, ".chezmoi."+ext+chezmoi.TemplateSuffix))
 		switch {
 		case os.IsNotExist(err):
 			continue
@@ -174,9 +275,74 @@ func (c *Config) findConfigTemplate() (string, string, string, error) {
 	return "", "", "", nil
 }
 
-func (c *Config) promptString(field string) string {
+// getCloneArgs returns the arguments to clone repo into dir, including the
+// branch and depth, if set.
+func (c *Config) getCloneArgs(vcs VCS, repo, dir string) ([]string, error) {
+	cloneArgs := vcs.CloneArgs(repo, dir)
+	if cloneArgs == nil {
+		return nil, fmt.Errorf("%s: cloning not supported", c.SourceVCS.Command)
+	}
+	if c.clone.branch == "" && c.clone.depth == 0 {
+		return cloneArgs, nil
+	}
+	if filepath.Base(c.SourceVCS.Command) != "git" {
+		return nil, fmt.Errorf("%s: cloning a branch or with a depth not supported", c.SourceVCS.Command)
+	}
+	var options []string
+	if c.clone.branch != "" {
+		options = append(options, "--branch", c.clone.branch)
+	}
+	if c.clone.depth != 0 {
+		options = append(options, "--depth", strconv.Itoa(c.clone.depth))
+	}
+	// The options must come before the repository and directory.
+	return append(append(cloneArgs[:1:1], options...), cloneArgs[1:]...), nil
+}
+
+// readPromptLine prints field as a prompt and returns the next line read from
+// c.Stdin, without surrounding whitespace.
+func (c *Config) readPromptLine(field string) (string, error) {
 	fmt.Fprintf(c.Stdout, "%s? ", field)
-	value, err := bufio.NewReader(c.Stdin).ReadString('\n')
+	// Reuse the same reader as c.prompt so that input buffered by one prompt
+	// is not lost to the next.
+	if c.stdinReader == nil {
+		c.stdinReader = bufio.NewReader(c.Stdin)
+	}
+	value, err := c.stdinReader.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && value != "") {
+		return "", err
+	}
+	return strings.TrimSpace(value), nil
+}
+
+func (c *Config) promptBool(field string) bool {
+	for {
+		value, err := c.readPromptLine(field)
+		panicOnError(err)
+		switch strings.ToLower(value) {
+		case "y", "yes", "on":
+			return true
+		case "n", "no", "off":
+			return false
+		}
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+}
+
+func (c *Config) promptInt(field string) int64 {
+	for {
+		value, err := c.readPromptLine(field)
+		panicOnError(err)
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	}
+}
+
+func (c *Config) promptString(field string) string {
+	value, err := c.readPromptLine(field)
 	panicOnError(err)
-	return strings.TrimSpace(value)
+	return value
 }
@@ -11,6 +11,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/twpayne/go-vfs/vfst"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
 )
 
 func TestPromptStringIgnoreWindowsNewline(t *testing.T) {
@@ -29,7 +31,7 @@ func TestPromptStringIgnoreWindowsNewline(t *testing.T) {
 		withStdin(bytes.NewBufferString("home\r\n")),
 	)
 
-	require.NoError(t, c.createConfigFile())
+	require.NoError(t, c.createConfigFile(chezmoi.NewMemoryPersistentState()))
 
 	vfst.RunTests(t, fs, "",
 		vfst.TestPath("/home/user/.config/chezmoi/chezmoi.toml",
@@ -67,7 +69,7 @@ func TestCreateConfigFile(t *testing.T) {
 		withStdin(bytes.NewBufferString("john.smith@company.com \n")),
 	)
 
-	require.NoError(t, c.createConfigFile())
+	require.NoError(t, c.createConfigFile(chezmoi.NewMemoryPersistentState()))
 
 	vfst.RunTests(t, fs, "",
 		vfst.TestPath("/home/user/.config/chezmoi/chezmoi.yaml",
@@ -89,6 +91,87 @@ func TestCreateConfigFile(t *testing.T) {
 	}, c.Data)
 }
 
+func TestCreateConfigFilePromptFuncs(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi/.chezmoi.toml.tmpl": strings.Join([]string{
+			`{{ $email := promptString "email" -}}`,
+			`{{ $work := promptBool "work" -}}`,
+			`{{ $monitors := promptInt "monitors" -}}`,
+			`[data]`,
+			`  email = "{{ $email }}"`,
+			`  work = {{ $work }}`,
+			`  monitors = {{ $monitors }}`,
+		}, "\n"),
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	// Invalid responses to promptBool and promptInt are prompted for again.
+	c := newTestConfig(
+		fs,
+		withStdin(bytes.NewBufferString("john.smith@company.com\nmaybe\nyes\ntwo\n2")),
+		withStdout(&bytes.Buffer{}),
+	)
+	require.NoError(t, c.createConfigFile(chezmoi.NewMemoryPersistentState()))
+
+	assert.Equal(t, map[string]interface{}{
+		"email":    "john.smith@company.com",
+		"work":     true,
+		"monitors": int64(2),
+	}, c.Data)
+}
+
+func TestCreateConfigFileRegenerate(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi/.chezmoi.toml.tmpl": strings.Join([]string{
+			`{{ $email := promptString "email" -}}`,
+			`[data]`,
+			`  email = "{{ $email }}"`,
+		}, "\n"),
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	persistentState := chezmoi.NewMemoryPersistentState()
+
+	c := newTestConfig(fs, withStdin(strings.NewReader("first@company.com\n")), withStdout(&bytes.Buffer{}))
+	require.NoError(t, c.createConfigFile(persistentState))
+	vfst.RunTests(t, fs, "first",
+		vfst.TestPath("/home/user/.config/chezmoi/chezmoi.toml",
+			vfst.TestContentsString("[data]\n  email = \"first@company.com\""),
+		),
+	)
+
+	// The config file is not regenerated, and so nothing is prompted for,
+	// if the template is unchanged.
+	c = newTestConfig(fs, withStdin(strings.NewReader("")))
+	require.NoError(t, c.createConfigFile(persistentState))
+
+	// The user is asked whether to regenerate the config file if the template
+	// has changed.
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/.chezmoi.toml.tmpl", []byte(strings.Join([]string{
+		`{{ $email := promptString "email" -}}`,
+		`[data]`,
+		`  email = "{{ $email }}"`,
+		`  changed = true`,
+	}, "\n")), 0o644))
+	c = newTestConfig(fs, withStdin(strings.NewReader("n\n")), withStderr(&bytes.Buffer{}))
+	require.NoError(t, c.createConfigFile(persistentState))
+	vfst.RunTests(t, fs, "declined",
+		vfst.TestPath("/home/user/.config/chezmoi/chezmoi.toml",
+			vfst.TestContentsString("[data]\n  email = \"first@company.com\""),
+		),
+	)
+
+	c = newTestConfig(fs, withStdin(strings.NewReader("y\nsecond@company.com\n")), withStdout(&bytes.Buffer{}), withStderr(&bytes.Buffer{}))
+	require.NoError(t, c.createConfigFile(persistentState))
+	vfst.RunTests(t, fs, "regenerated",
+		vfst.TestPath("/home/user/.config/chezmoi/chezmoi.toml",
+			vfst.TestContentsString("[data]\n  email = \"second@company.com\"\n  changed = true"),
+		),
+	)
+	assert.Equal(t, "second@company.com", c.Data["email"])
+}
+
 func TestInit(t *testing.T) {
 	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
 		"/home/user": &vfst.Dir{Perm: 0o755},
@@ -96,7 +179,7 @@ func TestInit(t *testing.T) {
 	require.NoError(t, err)
 	defer cleanup()
 
-	c := newTestConfig(fs)
+	c := newTestConfig(fs, withStdin(strings.NewReader("n\n")))
 	require.NoError(t, c.runInitCmd(nil, nil))
 	vfst.RunTests(t, fs, "",
 		vfst.TestPath("/home/user/.local/share/chezmoi",
@@ -118,7 +201,8 @@ func TestInitRepo(t *testing.T) {
 	require.NoError(t, err)
 	defer cleanup()
 
-	c := newTestConfig(fs)
+	c := newTestConfig(fs, withStdin(strings.NewReader("n\n")))
+	c.trust.trust = true
 	wd, err := os.Getwd()
 	require.NoError(t, err)
 	require.NoError(t, c.runInitCmd(nil, []string{filepath.Join(wd, "testdata/gitrepo")}))
@@ -140,5 +224,9 @@ func TestInitRepo(t *testing.T) {
 			vfst.TestModeIsRegular,
 			vfst.TestContentsString(lines("# contents of chezmoi.toml\n")),
 		),
+		vfst.TestPath("/home/user/.local/state/chezmoi/chezmoistate.boltdb",
+			vfst.TestModeIsRegular,
+		),
 	)
+	assert.Equal(t, "", c.trust.untrustedRepo)
 }
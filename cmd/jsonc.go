@@ -0,0 +1,82 @@
+package cmd
+
+// stripJSONComments returns data with the comments and trailing commas allowed
+// by JSONC and JSON5 removed, so that it can be decoded as strict JSON.
+// Comments are replaced by spaces, keeping newlines, so the line and column of
+// any syntax error are unchanged.
+func stripJSONComments(data []byte) []byte {
+	result := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		switch {
+		case data[i] == '"':
+			j := i + 1
+			for ; j < len(data) && data[j] != '"'; j++ {
+				if data[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(data) {
+				j = len(data) - 1
+			}
+			result = append(result, data[i:j+1]...)
+			i = j
+		case data[i] == '/' && i+1 < len(data) && data[i+1] == '/':
+			for ; i < len(data) && data[i] != '\n'; i++ {
+				result = append(result, ' ')
+			}
+			if i < len(data) {
+				result = append(result, '\n')
+			}
+		case data[i] == '/' && i+1 < len(data) && data[i+1] == '*':
+			result = append(result, ' ', ' ')
+			for i += 2; i < len(data) && !(data[i] == '*' && i+1 < len(data) && data[i+1] == '/'); i++ {
+				if data[i] == '\n' {
+					result = append(result, '\n')
+				} else {
+					result = append(result, ' ')
+				}
+			}
+			if i < len(data) {
+				result = append(result, ' ', ' ')
+				i++
+			}
+		default:
+			result = append(result, data[i])
+		}
+	}
+	return stripJSONTrailingCommas(result)
+}
+
+// stripJSONTrailingCommas replaces commas that are followed by only whitespace
+// before the end of an array or object in data, which must not contain
+// comments, with spaces.
+func stripJSONTrailingCommas(data []byte) []byte {
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '"':
+			for i++; i < len(data) && data[i] != '"'; i++ {
+				if data[i] == '\\' {
+					i++
+				}
+			}
+		case ',':
+			j := i + 1
+			for ; j < len(data) && isJSONWhitespace(data[j]); j++ {
+			}
+			if j < len(data) && (data[j] == ']' || data[j] == '}') {
+				data[i] = ' '
+			}
+		}
+	}
+	return data
+}
+
+// isJSONWhitespace returns whether b is whitespace in JSON.
+func isJSONWhitespace(b byte) bool {
+	switch b {
+	case ' ', '\t', '\n', '\r':
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStripJSONComments(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{
+			name:     "empty",
+			data:     "",
+			expected: "",
+		},
+		{
+			name:     "json",
+			data:     `{"a": [1, 2], "b": "c"}`,
+			expected: `{"a": [1, 2], "b": "c"}`,
+		},
+		{
+			name:     "line_comment",
+			data:     "{\n  // comment\n  \"a\": 1 // comment\n}",
+			expected: "{\n            \n  \"a\": 1           \n}",
+		},
+		{
+			name:     "block_comment",
+			data:     "{/* a\nb */\"a\": 1}",
+			expected: "{    \n    \"a\": 1}",
+		},
+		{
+			name:     "trailing_commas",
+			data:     "{\"a\": [1, 2,\n], \"b\": {\"c\": 3,},}",
+			expected: "{\"a\": [1, 2 \n], \"b\": {\"c\": 3 } }",
+		},
+		{
+			name:     "trailing_comma_before_comment",
+			data:     "[1, // comment\n]",
+			expected: "[1            \n]",
+		},
+		{
+			name:     "strings",
+			data:     `{"a // b": "c /* d */ e,]", "f": "\"//\"",}`,
+			expected: `{"a // b": "c /* d */ e,]", "f": "\"//\"" }`,
+		},
+		{
+			name:     "unterminated_string",
+			data:     `"a // b`,
+			expected: `"a // b`,
+		},
+		{
+			name:     "unterminated_block_comment",
+			data:     `1 /* a`,
+			expected: `1     `,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := string(stripJSONComments([]byte(tc.data)))
+			assert.Equal(t, tc.expected, actual)
+			assert.Equal(t, len(tc.data), len(actual))
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	vfs "github.com/twpayne/go-vfs"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+var lintCmd = &cobra.Command{
+	Use:     "lint",
+	Args:    cobra.NoArgs,
+	Short:   "Check the source state for problems without applying it",
+	Long:    mustGetLongHelp("lint"),
+	Example: getExample("lint"),
+	PreRunE: config.ensureNoError,
+	RunE:    config.runLintCmd,
+}
+
+type lintCmdConfig struct {
+	format    string
+	noDecrypt bool
+}
+
+// A lintProblem is a problem found in the source state.
+type lintProblem struct {
+	Path    string `json:"path" yaml:"path"`
+	Line    int    `json:"line,omitempty" yaml:"line,omitempty"`
+	Message string `json:"message" yaml:"message"`
+}
+
+// A lintPlaceholder is the value returned by secret template functions when
+// linting. Any field of a lintPlaceholder is also a lintPlaceholder, so
+// templates can access the fields of secrets without knowing their structure.
+type lintPlaceholder map[string]lintPlaceholder
+
+var lintFormats = []string{"json", "text", "yaml"}
+
+var templateErrorLineRegexp = regexp.MustCompile(`\A(\d+)(?::\d+)?: `)
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+
+	persistentFlags := lintCmd.PersistentFlags()
+	persistentFlags.StringVarP(&config.lint.format, "format", "f", config.lint.format, "format (JSON, text, or YAML)")
+	persistentFlags.BoolVar(&config.lint.noDecrypt, "no-decrypt", false, "do not check that encrypted files can be decrypted")
+	panicOnError(lintCmd.RegisterFlagCompletionFunc("format", completeWords(lintFormats)))
+}
+
+func (c *Config) runLintCmd(cmd *cobra.Command, args []string) error {
+	format := strings.ToLower(c.lint.format)
+	if format != "text" {
+		if _, ok := formatMap[format]; !ok || format == "toml" {
+			return fmt.Errorf("%s: unknown format", c.lint.format)
+		}
+	}
+
+	problems, err := c.lintSourceState()
+	if err != nil {
+		return err
+	}
+
+	if format == "text" {
+		for _, problem := range problems {
+			if problem.Line == 0 {
+				fmt.Fprintf(c.Stdout, "%s: %s\n", problem.Path, problem.Message)
+			} else {
+				fmt.Fprintf(c.Stdout, "%s:%d: %s\n", problem.Path, problem.Line, problem.Message)
+			}
+		}
+	} else {
+		if problems == nil {
+			problems = []lintProblem{}
+		}
+		if err := formatMap[format](c.Stdout, problems); err != nil {
+			return err
+		}
+	}
+
+	if len(problems) != 0 {
+		return fmt.Errorf("%d problem(s) found", len(problems))
+	}
+	return nil
+}
+
+// lintSourceState returns all the problems in the source state. Secret template
+// functions return placeholders instead of calling secret managers.
+func (c *Config) lintSourceState() ([]lintProblem, error) {
+	var problems []lintProblem
+	reportError := func(path string, line int, err error) {
+		problems = append(problems, c.newLintProblem(path, line, err))
+	}
+
+	fs := vfs.NewReadOnlyFS(c.fs)
+	templateFuncs := c.lintTemplateFuncs()
+	populateOptions := &chezmoi.PopulateOptions{
+		ExecuteTemplates: true,
+		ReportError:      reportError,
+	}
+	ts, err := c.newTargetState(c.SourceDir, chezmoi.WithTemplateFuncs(templateFuncs))
+	if err != nil {
+		return nil, err
+	}
+	if err := ts.Populate(fs, populateOptions); err != nil {
+		return nil, err
+	}
+	if Version != nil && ts.MinVersion != nil && Version.LessThan(*ts.MinVersion) {
+		reportError(filepath.Join(c.SourceDir, ".chezmoiversion"), 0, fmt.Errorf("chezmoi version %s too old, source state requires at least %s", Version, ts.MinVersion))
+	}
+
+	// Templates that use secrets often access fields of the secrets, which
+	// do not exist in the placeholders, so evaluate them again with missing
+	// keys allowed.
+	secretFuncRegexp := regexp.MustCompile(`\b(?:` + strings.Join(c.secretFuncNames, "|") + `)\b`)
+	var lenientTS *chezmoi.TargetState
+	evaluateWithSecrets := func(entry chezmoi.Entry) error {
+		if lenientTS == nil {
+			var err error
+			lenientTS, err = c.newTargetState(
+				c.SourceDir,
+				chezmoi.WithTemplateFuncs(templateFuncs),
+				chezmoi.WithTemplateOptions(append(append([]string{}, c.Template.Options...), "missingkey=zero")),
+			)
+			if err != nil {
+				return err
+			}
+			// Problems in the source state itself were already reported
+			// when populating ts.
+			if err := lenientTS.Populate(fs, &chezmoi.PopulateOptions{
+				ExecuteTemplates: true,
+				ReportError:      func(string, int, error) {},
+			}); err != nil {
+				return err
+			}
+		}
+		lenientEntry, err := lenientTS.Get(fs, filepath.Join(lenientTS.DestDir, entry.TargetName()))
+		if err != nil {
+			return err
+		}
+		return lenientEntry.Evaluate(lenientTS.TargetIgnore.Match)
+	}
+
+	var lintEntries func(map[string]chezmoi.Entry)
+	lintEntries = func(entries map[string]chezmoi.Entry) {
+		for _, entry := range entries {
+			if dir, ok := entry.(*chezmoi.Dir); ok {
+				lintEntries(dir.Entries)
+				continue
+			}
+			if file, ok := entry.(*chezmoi.File); ok && file.Encrypted && c.lint.noDecrypt {
+				continue
+			}
+			err := entry.Evaluate(ts.TargetIgnore.Match)
+			if err == nil {
+				continue
+			}
+			sourcePath := ts.SourcePath(entry)
+			if contents, readErr := fs.ReadFile(sourcePath); readErr == nil && len(c.secretFuncNames) != 0 && secretFuncRegexp.Match(contents) {
+				err = evaluateWithSecrets(entry)
+			}
+			if err != nil {
+				reportError(sourcePath, 0, err)
+			}
+		}
+	}
+	lintEntries(ts.Entries)
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Path != problems[j].Path {
+			return problems[i].Path < problems[j].Path
+		}
+		return problems[i].Line < problems[j].Line
+	})
+	return problems, nil
+}
+
+// lintTemplateFuncs returns c's template functions with the secret template
+// functions replaced by functions with the same signatures that return
+// placeholders.
+func (c *Config) lintTemplateFuncs() template.FuncMap {
+	templateFuncs := make(template.FuncMap, len(c.templateFuncs))
+	for key, value := range c.templateFuncs {
+		templateFuncs[key] = value
+	}
+	for _, key := range c.secretFuncNames {
+		funcType := reflect.TypeOf(c.templateFuncs[key])
+		templateFuncs[key] = reflect.MakeFunc(funcType, func([]reflect.Value) []reflect.Value {
+			results := make([]reflect.Value, 0, funcType.NumOut())
+			for i := 0; i < funcType.NumOut(); i++ {
+				results = append(results, lintPlaceholderValue(funcType.Out(i)))
+			}
+			return results
+		}).Interface()
+	}
+	return templateFuncs
+}
+
+// newLintProblem returns a new lintProblem for err at line in path. If line is
+// zero and err is a template error then the line is taken from err.
+func (c *Config) newLintProblem(path string, line int, err error) lintProblem {
+	message := err.Error()
+	if templatePrefix := "template: " + path + ":"; strings.HasPrefix(message, templatePrefix) {
+		message = strings.TrimPrefix(message, templatePrefix)
+		if m := templateErrorLineRegexp.FindStringSubmatch(message); m != nil {
+			line, _ = strconv.Atoi(m[1])
+			message = strings.TrimPrefix(message, m[0])
+		}
+	} else {
+		message = strings.TrimPrefix(message, path+": ")
+	}
+	if relPath, err := filepath.Rel(c.SourceDir, path); err == nil && !strings.HasPrefix(relPath, "..") {
+		path = relPath
+	}
+	return lintProblem{
+		Path:    path,
+		Line:    line,
+		Message: message,
+	}
+}
+
+// String implements fmt.Stringer.
+func (lintPlaceholder) String() string {
+	return "placeholder"
+}
+
+// lintPlaceholderValue returns a placeholder value of type t.
+func lintPlaceholderValue(t reflect.Type) reflect.Value {
+	switch t.Kind() {
+	case reflect.String:
+		return reflect.ValueOf("placeholder").Convert(t)
+	case reflect.Interface:
+		if reflect.TypeOf(lintPlaceholder{}).Implements(t) {
+			return reflect.ValueOf(lintPlaceholder{}).Convert(t)
+		}
+	case reflect.Map:
+		return reflect.MakeMap(t)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return reflect.ValueOf([]byte("placeholder")).Convert(t)
+		}
+		slice := reflect.MakeSlice(t, 1, 1)
+		slice.Index(0).Set(lintPlaceholderValue(t.Elem()))
+		return slice
+	}
+	return reflect.Zero(t)
+}
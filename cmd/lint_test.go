@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+func TestLintCmd(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		root     interface{}
+		expected []string
+	}{
+		{
+			name: "ok",
+			root: map[string]interface{}{
+				"/home/user/.local/share/chezmoi": map[string]interface{}{
+					".chezmoiignore":     "*.txt\n",
+					"dot_bashrc":         "# bashrc\n",
+					"dot_gitconfig.tmpl": "[user]\n\temail = {{ .email }}\n",
+					"private_dot_netrc.tmpl": strings.Join([]string{
+						`machine example.com`,
+						`login {{ (bitwarden "item" "example.com").login.username }}`,
+						`password {{ pass "example.com" }}`,
+					}, "\n"),
+					"run_once_install.sh": "#!/bin/sh\n",
+				},
+			},
+		},
+		{
+			name: "problems",
+			root: map[string]interface{}{
+				"/home/user/.local/share/chezmoi": map[string]interface{}{
+					".chezmoidependencies":    "a: b\nb a\nb: a\n",
+					".chezmoiignore":          "[\n",
+					".chezmoiversion":         "3.0.0\n",
+					"dot_foo":                 "# foo\n",
+					"private_dot_foo":         "# foo\n",
+					"dot_parse_error.tmpl":    "ok\n{{ if }}\n",
+					"dot_exec_error.tmpl":     "{{ .missing }}\n",
+					"private_encrypted_file":  "# file\n",
+					"dot_secret_missing.tmpl": "{{ pass }}\n",
+				},
+			},
+			expected: []string{
+				".chezmoidependencies: dependency cycle: a -> b -> a",
+				".chezmoidependencies:2: b a: missing colon",
+				".chezmoiignore:1: [: syntax error in pattern",
+				".chezmoiversion: chezmoi version 2.0.0 too old, source state requires at least 3.0.0",
+				"dot_exec_error.tmpl:1: executing \"/home/user/.local/share/chezmoi/dot_exec_error.tmpl\" at <.missing>: map has no entry for key \"missing\"",
+				"dot_parse_error.tmpl:2: missing value for if",
+				"dot_secret_missing.tmpl:1: executing \"/home/user/.local/share/chezmoi/dot_secret_missing.tmpl\" at <pass>: wrong number of args for pass: want 1 got 0",
+				"private_dot_foo: same target as dot_foo",
+				"private_encrypted_file: target name encrypted_file starts with encrypted_, check the order of attributes",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(tc.root)
+			require.NoError(t, err)
+			defer cleanup()
+			defer func(version *semver.Version) {
+				Version = version
+			}(Version)
+			Version = semver.New("2.0.0")
+			stdout := &bytes.Buffer{}
+			c := newTestConfig(
+				fs,
+				withData(map[string]interface{}{
+					"email": "user@example.com",
+				}),
+				withStdout(stdout),
+			)
+			c.addSecretTemplateFunc("bitwarden", c.bitwardenFunc)
+			c.addSecretTemplateFunc("pass", c.passFunc)
+			err = c.runLintCmd(nil, nil)
+			if tc.expected == nil {
+				assert.NoError(t, err)
+				assert.Empty(t, stdout.String())
+			} else {
+				assert.Error(t, err)
+				assert.Equal(t, strings.Join(tc.expected, "\n")+"\n", stdout.String())
+			}
+		})
+	}
+}
+
+func TestLintCmdJSON(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi/dot_foo.tmpl": "ok\n{{ if }}\n",
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	stdout := &bytes.Buffer{}
+	c := newTestConfig(
+		fs,
+		withStdout(stdout),
+	)
+	c.lint.format = "json"
+	assert.EqualError(t, c.runLintCmd(nil, nil), "1 problem(s) found")
+	var problems []lintProblem
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &problems))
+	assert.Equal(t, []lintProblem{
+		{
+			Path:    "dot_foo.tmpl",
+			Line:    2,
+			Message: "missing value for if",
+		},
+	}, problems)
+}
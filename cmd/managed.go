@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/spf13/cobra"
 
@@ -11,8 +13,7 @@ import (
 )
 
 var managedCmd = &cobra.Command{
-	Use:     "managed",
-	Args:    cobra.NoArgs,
+	Use:     "managed [targets...]",
 	Short:   "List the managed files in the destination directory",
 	Long:    mustGetLongHelp("managed"),
 	Example: getExample("managed"),
@@ -20,64 +21,133 @@ var managedCmd = &cobra.Command{
 	RunE:    config.runManagedCmd,
 }
 
+var (
+	managedIncludeTypes = []string{"dirs", "files", "symlinks"}
+	managedFormats      = []string{"json", "text", "yaml"}
+)
+
 type managedCmdConfig struct {
-	include []string
+	format        string
+	include       []string
+	withSourceDir bool
+}
+
+// A managedEntry describes a managed entry in structured output.
+type managedEntry struct {
+	Path      string `json:"path" yaml:"path"`
+	Type      string `json:"type" yaml:"type"`
+	Mode      string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	Template  bool   `json:"template" yaml:"template"`
+	Encrypted bool   `json:"encrypted" yaml:"encrypted"`
+	SourceDir string `json:"sourceDir,omitempty" yaml:"sourceDir,omitempty"`
 }
 
 func init() {
 	rootCmd.AddCommand(managedCmd)
 
 	persistentFlags := managedCmd.PersistentFlags()
-	persistentFlags.StringSliceVarP(&config.managed.include, "include", "i", []string{"dirs", "files", "symlinks"}, "include")
+	persistentFlags.StringVarP(&config.managed.format, "format", "f", config.managed.format, "format (JSON, text, or YAML)")
+	persistentFlags.StringSliceVarP(&config.managed.include, "include", "i", managedIncludeTypes, "include")
+	persistentFlags.StringArrayVar(&config.exclude, "exclude", nil, "exclude entry types or targets matching pattern")
+	persistentFlags.BoolVar(&config.managed.withSourceDir, "with-source-dir", false, "print the source directory of each target")
+	panicOnError(managedCmd.RegisterFlagCompletionFunc("format", completeWords(managedFormats)))
+	panicOnError(managedCmd.RegisterFlagCompletionFunc("include", completeCommaSeparatedWords(entryTypeWords)))
 }
 
 func (c *Config) runManagedCmd(cmd *cobra.Command, args []string) error {
+	format := strings.ToLower(c.managed.format)
+	if format != "text" {
+		if _, ok := formatMap[format]; !ok || format == "toml" {
+			return fmt.Errorf("%s: unknown format", c.managed.format)
+		}
+	}
+
 	ts, err := c.getTargetState(nil)
 	if err != nil {
 		return err
 	}
 
-	var (
-		includeDirs     = false
-		includeFiles    = false
-		includeSymlinks = false
-	)
-	for _, what := range c.managed.include {
-		switch what {
-		case "dirs", "d":
-			includeDirs = true
-		case "files", "f":
-			includeFiles = true
-		case "symlinks", "s":
-			includeSymlinks = true
-		default:
-			return fmt.Errorf("unrecognized include: %q", what)
-		}
+	include, err := c.getEntryFilter(ts, c.managed.include)
+	if err != nil {
+		return err
 	}
 
-	allEntries := ts.AllEntries()
+	entries := ts.Entries
+	if len(args) != 0 {
+		argEntries, err := c.getEntries(ts, args)
+		if err != nil {
+			return err
+		}
+		entries = entryMap(argEntries)
+	}
+	var allEntries []chezmoi.Entry
+	walkEntries(entries, func(entry chezmoi.Entry) {
+		allEntries = append(allEntries, entry)
+	})
 
 	targetNames := make([]string, 0, len(allEntries))
+	entriesByTargetName := make(map[string]chezmoi.Entry, len(allEntries))
 	for _, entry := range allEntries {
-		if _, ok := entry.(*chezmoi.Dir); ok && !includeDirs {
-			continue
-		}
-		if _, ok := entry.(*chezmoi.File); ok && !includeFiles {
+		if !include(entry) {
 			continue
 		}
-		if _, ok := entry.(*chezmoi.Symlink); ok && !includeSymlinks {
+		if _, ok := entriesByTargetName[entry.TargetName()]; ok {
 			continue
 		}
 		targetNames = append(targetNames, entry.TargetName())
+		entriesByTargetName[entry.TargetName()] = entry
 	}
 
 	sort.Strings(targetNames)
+	managedEntries := []managedEntry{}
 	for _, targetName := range targetNames {
 		if ts.TargetIgnore.Match(targetName) {
 			continue
 		}
-		fmt.Fprintln(c.Stdout, filepath.Join(ts.DestDir, targetName))
+		entry := entriesByTargetName[targetName]
+		targetPath := filepath.Join(ts.DestDir, targetName)
+		var sourceDir string
+		if c.managed.withSourceDir {
+			sourceDir = filepath.Join(ts.EntrySourceDir(entry), ts.ScopedDir(entry))
+		}
+		switch {
+		case format != "text":
+			managedEntries = append(managedEntries, newManagedEntry(entry, targetPath, sourceDir, ts.Umask))
+		case c.managed.withSourceDir:
+			fmt.Fprintf(c.Stdout, "%s\t%s\n", targetPath, sourceDir)
+		default:
+			fmt.Fprintln(c.Stdout, targetPath)
+		}
 	}
 
+	if format != "text" {
+		return formatMap[format](c.Stdout, managedEntries)
+	}
 	return nil
 }
+
+// newManagedEntry returns a new managedEntry describing entry, with target path
+// targetPath and source directory sourceDir.
+func newManagedEntry(entry chezmoi.Entry, targetPath, sourceDir string, umask os.FileMode) managedEntry {
+	me := managedEntry{
+		Path:      targetPath,
+		SourceDir: sourceDir,
+	}
+	switch entry := entry.(type) {
+	case *chezmoi.Dir:
+		me.Type = "dir"
+		me.Mode = fmt.Sprintf("%03o", entry.Perm&^umask)
+	case *chezmoi.File:
+		me.Type = "file"
+		me.Mode = fmt.Sprintf("%03o", entry.Perm&^umask)
+		me.Template = entry.Template
+		me.Encrypted = entry.Encrypted
+	case *chezmoi.Script:
+		me.Type = "script"
+		me.Template = entry.Template
+	case *chezmoi.Symlink:
+		me.Type = "symlink"
+		me.Template = entry.Template
+	}
+	return me
+}
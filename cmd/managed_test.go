@@ -3,7 +3,9 @@ package cmd
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -114,6 +116,261 @@ func posixify(path string) string {
 
 func withManaged(managed managedCmdConfig) configOption {
 	return func(c *Config) {
+		if managed.format == "" {
+			managed.format = "text"
+		}
 		c.managed = managed
 	}
 }
+
+func TestManagedCmdWithSourceDir(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/public": map[string]interface{}{
+			"dot_bashrc":  "# public\n",
+			"dot_profile": "# public\n",
+		},
+		"/home/user/work": map[string]interface{}{
+			"dot_profile": "# work\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	stdout := &bytes.Buffer{}
+	c := newTestConfig(
+		fs,
+		withStdout(stdout),
+		withManaged(managedCmdConfig{
+			include:       managedIncludeTypes,
+			withSourceDir: true,
+		}),
+	)
+	c.SourceDir = "/home/user/work"
+	c.SourceDirs = []string{"/home/user/public", "/home/user/work"}
+	assert.NoError(t, c.runManagedCmd(nil, nil))
+	assert.Equal(t, strings.Join([]string{
+		filepath.Join("/home/user", ".bashrc") + "\t/home/user/public",
+		filepath.Join("/home/user", ".profile") + "\t/home/user/work",
+	}, "\n")+"\n", stdout.String())
+}
+
+func TestManagedCmdScopedDirs(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_bashrc": "# unscoped\n",
+			"dot_zshrc":  "# unscoped\n",
+			"host-laptop": map[string]interface{}{
+				"dot_zshrc": "# laptop\n",
+			},
+			"host-server": map[string]interface{}{
+				"dot_profile": "# server\n",
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	stdout := &bytes.Buffer{}
+	c := newTestConfig(
+		fs,
+		withStdout(stdout),
+		withManaged(managedCmdConfig{
+			include:       managedIncludeTypes,
+			withSourceDir: true,
+		}),
+	)
+	c.ScopedDirs = map[string]scopedDirConfig{
+		"host-*": {
+			Condition: `{{ eq .scopedDir "host-laptop" }}`,
+		},
+	}
+	assert.NoError(t, c.runManagedCmd(nil, nil))
+	assert.Equal(t, strings.Join([]string{
+		filepath.Join("/home/user", ".bashrc") + "\t/home/user/.local/share/chezmoi",
+		filepath.Join("/home/user", ".zshrc") + "\t" + filepath.Join("/home/user/.local/share/chezmoi", "host-laptop"),
+	}, "\n")+"\n", stdout.String())
+}
+
+func TestManagedCmdPathMap(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_bashrc":         "# contents of .bashrc\n",
+			"dot_config/foo.ini": "# contents of foo.ini\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	stdout := &bytes.Buffer{}
+	c := newTestConfig(
+		fs,
+		withStdout(stdout),
+		withManaged(managedCmdConfig{
+			include: []string{"files"},
+		}),
+	)
+	c.PathMap = []pathMapConfig{
+		{
+			Name: ".config",
+			Targets: map[string]string{
+				runtime.GOOS: "Library/Application Support",
+			},
+		},
+	}
+	assert.NoError(t, c.runManagedCmd(nil, nil))
+	assert.Equal(t, strings.Join([]string{
+		filepath.Join("/home/user", ".bashrc"),
+		filepath.Join("/home/user", "Library", "Application Support", "foo.ini"),
+	}, "\n")+"\n", stdout.String())
+
+	ts, err := c.getTargetState(nil)
+	require.NoError(t, err)
+	entries, err := c.getEntries(ts, []string{"/home/user/Library/Application Support/foo.ini"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, filepath.Join("/home/user/.local/share/chezmoi", "dot_config", "foo.ini"), ts.SourcePath(entries[0]))
+}
+
+func TestManagedCmdArgs(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_bashrc":                "# contents of .bashrc\n",
+			"dot_config/foo.ini":        "# contents of foo.ini\n",
+			"dot_config/bar/baz.ini":    "# contents of baz.ini\n",
+			"dot_config/symlink_qux":    "foo.ini\n",
+			"dot_local/share/dot_keep":  "",
+			"run_once_install.sh":       "#!/bin/sh\n",
+			"dot_config/run_setup.tmpl": "#!/bin/sh\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	for _, tc := range []struct {
+		name     string
+		include  []string
+		args     []string
+		expected []string
+	}{
+		{
+			name: "dir",
+			args: []string{"/home/user/.config"},
+			expected: []string{
+				"/home/user/.config",
+				"/home/user/.config/bar",
+				"/home/user/.config/bar/baz.ini",
+				"/home/user/.config/foo.ini",
+				"/home/user/.config/qux",
+			},
+		},
+		{
+			name:    "dir_files",
+			include: []string{"files"},
+			args:    []string{"/home/user/.config"},
+			expected: []string{
+				"/home/user/.config/bar/baz.ini",
+				"/home/user/.config/foo.ini",
+			},
+		},
+		{
+			name:    "scripts",
+			include: []string{"scripts"},
+			expected: []string{
+				"/home/user/.config/setup",
+				"/home/user/install.sh",
+			},
+		},
+		{
+			name:    "dir_scripts",
+			include: []string{"scripts"},
+			args:    []string{"/home/user/.config"},
+			expected: []string{
+				"/home/user/.config/setup",
+			},
+		},
+		{
+			name: "overlapping",
+			args: []string{"/home/user/.config/bar", "/home/user/.config/bar/baz.ini"},
+			expected: []string{
+				"/home/user/.config/bar",
+				"/home/user/.config/bar/baz.ini",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			include := tc.include
+			if include == nil {
+				include = managedIncludeTypes
+			}
+			c := newTestConfig(
+				fs,
+				withStdout(stdout),
+				withManaged(managedCmdConfig{
+					include: include,
+				}),
+			)
+			require.NoError(t, c.runManagedCmd(nil, tc.args))
+			posixTargetNames, err := extractPOSIXTargetNames(stdout.Bytes())
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, posixTargetNames)
+		})
+	}
+}
+
+func TestManagedCmdFormat(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"private_dot_ssh/encrypted_private_id_rsa": "",
+			"dot_bashrc.tmpl":                          "# contents of .bashrc\n",
+			"symlink_dot_vimrc":                        ".config/vimrc\n",
+			"run_install.sh":                           "#!/bin/sh\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	stdout := &bytes.Buffer{}
+	c := newTestConfig(
+		fs,
+		withStdout(stdout),
+		withManaged(managedCmdConfig{
+			format:  "json",
+			include: []string{"all"},
+		}),
+	)
+	require.NoError(t, c.runManagedCmd(nil, nil))
+	var actual []managedEntry
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &actual))
+	for i := range actual {
+		actual[i].Path = posixify(actual[i].Path)
+	}
+	expected := []managedEntry{
+		{
+			Path:     "/home/user/.bashrc",
+			Type:     "file",
+			Mode:     "644",
+			Template: true,
+		},
+		{
+			Path: "/home/user/.ssh",
+			Type: "dir",
+			Mode: "700",
+		},
+		{
+			Path:      "/home/user/.ssh/id_rsa",
+			Type:      "file",
+			Mode:      "600",
+			Encrypted: true,
+		},
+		{
+			Path: "/home/user/.vimrc",
+			Type: "symlink",
+		},
+		{
+			Path: "/home/user/install.sh",
+			Type: "script",
+		},
+	}
+	assert.Equal(t, expected, actual)
+
+	c.managed.format = "toml"
+	assert.EqualError(t, c.runManagedCmd(nil, nil), "toml: unknown format")
+}
@@ -5,20 +5,24 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"text/template"
 
 	"github.com/spf13/cobra"
+	bolt "go.etcd.io/bbolt"
 
 	"github.com/twpayne/chezmoi/internal/chezmoi"
 )
 
 var mergeCmd = &cobra.Command{
-	Use:     "merge targets...",
-	Args:    cobra.MinimumNArgs(1),
-	Short:   "Perform a three-way merge between the destination state, the source state, and the target state",
-	Long:    mustGetLongHelp("merge"),
-	Example: getExample("merge"),
-	PreRunE: config.ensureNoError,
-	RunE:    config.runMergeCmd,
+	Use:      "merge targets...",
+	Args:     cobra.MinimumNArgs(1),
+	Short:    "Perform a three-way merge between the destination state, the last applied state, and the target state",
+	Long:     mustGetLongHelp("merge"),
+	Example:  getExample("merge"),
+	PreRunE:  config.ensureNoError,
+	RunE:     config.runMergeCmd,
+	PostRunE: config.autoCommitAndAutoPush,
 }
 
 type mergeConfig struct {
@@ -26,13 +30,26 @@ type mergeConfig struct {
 	Args    []string
 }
 
+// mergeArgsData is the data passed to merge.args templates.
+type mergeArgsData struct {
+	Destination string
+	Base        string
+	Target      string
+}
+
 func init() {
 	rootCmd.AddCommand(mergeCmd)
-
-	markRemainingZshCompPositionalArgumentsAsFiles(mergeCmd, 1)
 }
 
 func (c *Config) runMergeCmd(cmd *cobra.Command, args []string) error {
+	persistentState, err := c.getPersistentState(&bolt.Options{
+		ReadOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer persistentState.Close()
+
 	ts, err := c.getTargetState(nil)
 	if err != nil {
 		return err
@@ -42,6 +59,9 @@ func (c *Config) runMergeCmd(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	if err := checkNotInEncryptedDirs(ts, entries); err != nil {
+		return err
+	}
 
 	// Create a temporary directory to store the target state and ensure that it
 	// is removed afterwards. We cannot use fs as it lacks TempDir
@@ -53,7 +73,7 @@ func (c *Config) runMergeCmd(cmd *cobra.Command, args []string) error {
 	defer os.RemoveAll(tempDir)
 
 	for i, entry := range entries {
-		if err := c.runMergeCommand(cmd, args[i], entry, tempDir); err != nil {
+		if err := c.runMergeCommand(ts, args[i], entry, tempDir, persistentState); err != nil {
 			return err
 		}
 	}
@@ -61,37 +81,164 @@ func (c *Config) runMergeCmd(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func (c *Config) runMergeCommand(cmd *cobra.Command, arg string, entry chezmoi.Entry, tempDir string) error {
+func (c *Config) runMergeCommand(ts *chezmoi.TargetState, arg string, entry chezmoi.Entry, tempDir string, persistentState chezmoi.PersistentState) error {
 	file, ok := entry.(*chezmoi.File)
 	if !ok {
 		return fmt.Errorf("%s: not a file", arg)
 	}
+	targetPath := filepath.Join(ts.DestDir, file.TargetName())
+
+	rawTargetPath, err := c.fs.RawPath(targetPath)
+	if err != nil {
+		return err
+	}
+	rawSourcePath, err := c.fs.RawPath(ts.SourcePath(entry))
+	if err != nil {
+		return err
+	}
+	data := mergeArgsData{
+		Destination: rawTargetPath,
+		Target:      rawSourcePath,
+	}
 
-	// By default, perform a two-way merge between the destination state and the
-	// source state.
-	args := append(
-		append([]string{}, c.Merge.Args...),
-		filepath.Join(c.DestDir, file.TargetName()),
-		filepath.Join(c.SourceDir, file.SourceName()),
-	)
-
-	// Try to evaluate the target state. If this succeeds, perform a three-way
-	// merge between the destination state, the source state, and the target
-	// state. Target state evaluation might fail if the source state contains
-	// template errors or cannot be decrypted.
-	if contents, err := file.Contents(); err != nil {
-		cmd.Printf("warning: %s: cannot evaluate target state: %v\n", arg, err)
+	// Try to evaluate the target state. If this fails, for example if the
+	// source state contains template errors or cannot be decrypted, then merge
+	// with the source state instead.
+	contents, err := file.Contents()
+	if err != nil {
+		fmt.Fprintf(c.Stderr, "warning: %s: cannot evaluate target state: %v\n", arg, err)
 	} else {
-		targetStatePath := filepath.Join(tempDir, filepath.Base(file.TargetName()))
-		if err := ioutil.WriteFile(targetStatePath, contents, 0o600); err != nil {
+		data.Target = filepath.Join(tempDir, filepath.Base(file.TargetName()))
+		if err := ioutil.WriteFile(data.Target, contents, 0o600); err != nil {
 			return err
 		}
-		args = append(args, targetStatePath)
 	}
 
+	// Perform a three-way merge with the contents that were last applied as the
+	// common ancestor if they were recorded, otherwise a two-way merge.
+	base, err := persistentState.Get(c.lastWrittenBucket, []byte(targetPath))
+	if err != nil {
+		return err
+	}
+	if base != nil {
+		baseDir := filepath.Join(tempDir, "base")
+		if err := os.MkdirAll(baseDir, 0o700); err != nil {
+			return err
+		}
+		data.Base = filepath.Join(baseDir, filepath.Base(file.TargetName()))
+		if err := ioutil.WriteFile(data.Base, base, 0o600); err != nil {
+			return err
+		}
+	}
+
+	args, err := c.getMergeArgs(data)
+	if err != nil {
+		return err
+	}
 	if err := c.run("", c.Merge.Command, args...); err != nil {
 		return fmt.Errorf("%s: %w", arg, err)
 	}
 
-	return nil
+	return c.offerReAddMerged(ts, file, targetPath)
+}
+
+// getMergeArgs returns the arguments to the merge command. If merge.args
+// contains templates then each argument is executed with data and empty
+// arguments, like a missing base, are omitted. Otherwise merge.args are
+// followed by the destination, the base if there is one, and the target.
+func (c *Config) getMergeArgs(data mergeArgsData) ([]string, error) {
+	isTemplate := false
+	for _, arg := range c.Merge.Args {
+		if strings.Contains(arg, "{{") {
+			isTemplate = true
+			break
+		}
+	}
+	if !isTemplate {
+		args := append([]string{}, c.Merge.Args...)
+		args = append(args, data.Destination)
+		if data.Base != "" {
+			args = append(args, data.Base)
+		}
+		return append(args, data.Target), nil
+	}
+	args := make([]string, 0, len(c.Merge.Args))
+	for i, arg := range c.Merge.Args {
+		tmpl, err := template.New(fmt.Sprintf("merge.args[%d]", i)).Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, err
+		}
+		sb := &strings.Builder{}
+		if err := tmpl.Execute(sb, data); err != nil {
+			return nil, err
+		}
+		if sb.Len() != 0 {
+			args = append(args, sb.String())
+		}
+	}
+	return args, nil
+}
+
+// offerReAddMerged prompts to re-add the result of merging file to the source
+// state if it differs from file's target state.
+func (c *Config) offerReAddMerged(ts *chezmoi.TargetState, file *chezmoi.File, targetPath string) error {
+	changed, err := c.reAddChanged(file, targetPath)
+	if err != nil || !changed {
+		return err
+	}
+	if reason := reAddUnsupportedReason(file); reason != "" {
+		fmt.Fprintf(c.Stderr, "warning: %s: merged, but not re-added because %s\n", targetPath, reason)
+		return nil
+	}
+	choice, err := c.prompt(fmt.Sprintf("Re-add merged %s to the source state", targetPath), "yn", 'n')
+	if err != nil || choice != 'y' {
+		return err
+	}
+	return ts.Add(c.fs, chezmoi.AddOptions{
+		Create: file.Create,
+		Empty:  file.Empty,
+	}, targetPath, nil, c.Follow, c.mutator)
+}
+
+// recordLastWritten records the contents of the regular files that entries
+// were applied to, or that all entries in ts were applied to if entries is
+// empty, so that merge can use them as the common ancestor. The contents of
+// encrypted files, templates, which may contain secrets, private files, and
+// large files are not recorded. All contents are recorded in a single update.
+func (c *Config) recordLastWritten(ts *chezmoi.TargetState, entries []chezmoi.Entry, persistentState chezmoi.PersistentState) error {
+	var allEntries []chezmoi.Entry
+	if len(entries) == 0 {
+		allEntries = ts.AllEntries()
+	} else {
+		for _, entry := range entries {
+			allEntries = entry.AppendAllEntries(allEntries)
+		}
+	}
+	values := make(map[string][]byte)
+	for _, entry := range allEntries {
+		file, ok := entry.(*chezmoi.File)
+		if !ok || ts.TargetIgnore.Match(file.TargetName()) {
+			continue
+		}
+		targetPath := filepath.Join(ts.DestDir, file.TargetName())
+		if file.Encrypted || file.Template || file.Perm&0o77 == 0 {
+			values[targetPath] = nil
+			continue
+		}
+		info, err := c.fs.Lstat(targetPath)
+		switch {
+		case err == nil && info.Mode().IsRegular() && (ts.LargeFileSize == 0 || info.Size() <= ts.LargeFileSize):
+		case err == nil || os.IsNotExist(err):
+			values[targetPath] = nil
+			continue
+		default:
+			return err
+		}
+		contents, err := c.fs.ReadFile(targetPath)
+		if err != nil {
+			return err
+		}
+		values[targetPath] = contents
+	}
+	return persistentState.Update(c.lastWrittenBucket, values)
 }
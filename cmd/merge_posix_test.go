@@ -0,0 +1,163 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+func TestMergeCmd(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	// fakeMerge logs the contents of its arguments and writes the merged
+	// result to the first.
+	mergeLog := filepath.Join(tempDir, "merge.log")
+	fakeMerge := filepath.Join(tempDir, "merge")
+	require.NoError(t, ioutil.WriteFile(fakeMerge, []byte("#!/bin/sh\n"+
+		"for arg; do cat \"$arg\"; done > "+mergeLog+"\n"+
+		"echo merged > \"$1\"\n"), 0o755))
+
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_applied":     "applied\n",
+			"dot_not_applied": "target\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	require.NoError(t, newTestConfig(fs).runApplyCmd(nil, []string{"/home/user/.applied"}))
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/dot_applied", []byte("target\n"), 0o644))
+	require.NoError(t, fs.WriteFile("/home/user/.applied", []byte("destination\n"), 0o644))
+	require.NoError(t, fs.WriteFile("/home/user/.not_applied", []byte("destination\n"), 0o644))
+
+	// The merge command inherits stdin, so answers to prompts are passed in a
+	// pipe, which it leaves unread, rather than a buffer, which would be
+	// copied to it.
+	var pipes []*os.File
+	defer func() {
+		for _, pipe := range pipes {
+			assert.NoError(t, pipe.Close())
+		}
+	}()
+	newMergeConfig := func(stdin string) *Config {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		_, err = w.WriteString(stdin)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		pipes = append(pipes, r)
+		c := newTestConfig(fs, withStdin(r), withStdout(&bytes.Buffer{}), withStderr(&bytes.Buffer{}))
+		c.Merge.Command = fakeMerge
+		c.Merge.Args = []string{"{{ .Destination }}", "{{ .Base }}", "{{ .Target }}"}
+		return c
+	}
+
+	// The last applied contents are the common ancestor, and the merged result
+	// is re-added to the source state.
+	require.NoError(t, newMergeConfig("y\n").runMergeCmd(nil, []string{"/home/user/.applied"}))
+	log, err := ioutil.ReadFile(mergeLog)
+	require.NoError(t, err)
+	assert.Equal(t, "destination\napplied\ntarget\n", string(log))
+
+	// Without a recorded base, the merge is two-way and the merged result is
+	// not re-added unless confirmed.
+	require.NoError(t, newMergeConfig("n\n").runMergeCmd(nil, []string{"/home/user/.not_applied"}))
+	log, err = ioutil.ReadFile(mergeLog)
+	require.NoError(t, err)
+	assert.Equal(t, "destination\ntarget\n", string(log))
+
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.local/share/chezmoi/dot_applied",
+			vfst.TestContentsString("merged\n"),
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/dot_not_applied",
+			vfst.TestContentsString("target\n"),
+		),
+		vfst.TestPath("/home/user/.not_applied",
+			vfst.TestContentsString("merged\n"),
+		),
+	)
+}
+
+func TestRecordLastWritten(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_plain":          "plain\n",
+			"dot_template.tmpl":  "{{ \"template\" }}\n",
+			"private_dot_secret": "secret\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	c := newTestConfig(fs)
+	require.NoError(t, c.runApplyCmd(nil, nil))
+
+	persistentState, err := c.getPersistentState(nil)
+	require.NoError(t, err)
+	defer persistentState.Close()
+	for targetPath, expected := range map[string][]byte{
+		"/home/user/.plain":    []byte("plain\n"),
+		"/home/user/.template": nil,
+		"/home/user/.secret":   nil,
+	} {
+		actual, err := persistentState.Get(c.lastWrittenBucket, []byte(targetPath))
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual, targetPath)
+	}
+}
+
+func TestGetMergeArgs(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		args         []string
+		data         mergeArgsData
+		expectedArgs []string
+	}{
+		{
+			name:         "three_way",
+			args:         []string{"-d"},
+			data:         mergeArgsData{Destination: "dest", Base: "base", Target: "target"},
+			expectedArgs: []string{"-d", "dest", "base", "target"},
+		},
+		{
+			name:         "two_way",
+			args:         []string{"-d"},
+			data:         mergeArgsData{Destination: "dest", Target: "target"},
+			expectedArgs: []string{"-d", "dest", "target"},
+		},
+		{
+			name:         "template",
+			args:         []string{"{{ .Target }}", "--base={{ .Base }}", "{{ .Destination }}"},
+			data:         mergeArgsData{Destination: "dest", Base: "base", Target: "target"},
+			expectedArgs: []string{"target", "--base=base", "dest"},
+		},
+		{
+			name:         "template_two_way",
+			args:         []string{"{{ .Destination }}", "{{ .Base }}", "{{ .Target }}"},
+			data:         mergeArgsData{Destination: "dest", Target: "target"},
+			expectedArgs: []string{"dest", "target"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestConfig(nil)
+			c.Merge.Args = tc.args
+			args, err := c.getMergeArgs(tc.data)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedArgs, args)
+		})
+	}
+}
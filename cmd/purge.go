@@ -40,6 +40,9 @@ func (c *Config) runPurgeCmd(cmd *cobra.Command, args []string) error {
 		}
 	}
 	paths = append(paths, c.configFile, c.getPersistentStateFile())
+	if legacyPersistentStateFile := c.getLegacyPersistentStateFile(); legacyPersistentStateFile != "" {
+		paths = append(paths, legacyPersistentStateFile)
+	}
 
 	// Remove all paths that exist.
 PATH:
@@ -52,7 +55,7 @@ PATH:
 			return err
 		}
 		if !c.purge.force {
-			choice, err := c.prompt(fmt.Sprintf("Remove %s", path), "ynqa")
+			choice, err := c.prompt(fmt.Sprintf("Remove %s", path), "ynqa", 0)
 			if err != nil {
 				return err
 			}
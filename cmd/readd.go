@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+var reAddCmd = &cobra.Command{
+	Use:      "re-add [targets...]",
+	Short:    "Re-add modified files to the source state",
+	Long:     mustGetLongHelp("re-add"),
+	Example:  getExample("re-add"),
+	PreRunE:  config.ensureNoError,
+	RunE:     config.runReAddCmd,
+	PostRunE: config.autoCommitAndAutoPush,
+}
+
+func init() {
+	rootCmd.AddCommand(reAddCmd)
+
+	persistentFlags := reAddCmd.PersistentFlags()
+	persistentFlags.StringArrayVar(&config.exclude, "exclude", nil, "exclude targets matching pattern")
+}
+
+func (c *Config) runReAddCmd(cmd *cobra.Command, args []string) error {
+	ts, err := c.getTargetState(nil)
+	if err != nil {
+		return err
+	}
+
+	var allEntries []chezmoi.Entry
+	if len(args) == 0 {
+		excluded, err := c.getExcluded(ts)
+		if err != nil {
+			return err
+		}
+		for _, entry := range ts.AllEntries() {
+			if !excluded(entry.TargetName()) {
+				allEntries = append(allEntries, entry)
+			}
+		}
+	} else {
+		argEntries, err := c.getEntries(ts, args)
+		if err != nil {
+			return err
+		}
+		walkEntries(entryMap(argEntries), func(entry chezmoi.Entry) {
+			allEntries = append(allEntries, entry)
+		})
+	}
+
+	var files []*chezmoi.File
+	for _, entry := range allEntries {
+		if file, ok := entry.(*chezmoi.File); ok && !ts.TargetIgnore.Match(file.TargetName()) {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].TargetName() < files[j].TargetName()
+	})
+
+	for _, file := range files {
+		targetPath := filepath.Join(ts.DestDir, file.TargetName())
+		changed, err := c.reAddChanged(file, targetPath)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			continue
+		}
+		if reason := reAddUnsupportedReason(file); reason != "" {
+			fmt.Fprintf(c.Stderr, "warning: %s: modified, but not re-added because %s\n", targetPath, reason)
+			continue
+		}
+		addOptions := chezmoi.AddOptions{
+			Create: file.Create,
+			Empty:  file.Empty,
+		}
+		if err := ts.Add(c.fs, addOptions, targetPath, nil, c.Follow, c.mutator); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reAddUnsupportedReason returns why file cannot be re-added, or the empty
+// string if it can. Templates, encrypted files, and modify scripts cannot be
+// regenerated from their targets without losing information, so they must be
+// updated by hand.
+func reAddUnsupportedReason(file *chezmoi.File) string {
+	switch {
+	case file.Template:
+		return "it is a template"
+	case file.Encrypted:
+		return "it is encrypted"
+	case file.Modify:
+		return "it is generated by a modify script"
+	default:
+		return ""
+	}
+}
+
+// reAddChanged returns whether the regular file at targetPath differs from
+// file's target state. Targets that are missing or that are no longer regular
+// files are not considered changed.
+func (c *Config) reAddChanged(file *chezmoi.File, targetPath string) (bool, error) {
+	var info os.FileInfo
+	var err error
+	if c.Follow {
+		info, err = c.fs.Stat(targetPath)
+	} else {
+		info, err = c.fs.Lstat(targetPath)
+	}
+	switch {
+	case os.IsNotExist(err):
+		return false, nil
+	case err != nil:
+		return false, err
+	case !info.Mode().IsRegular():
+		return false, nil
+	}
+	targetContents, err := c.fs.ReadFile(targetPath)
+	if err != nil {
+		return false, err
+	}
+	contents, err := file.Contents()
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(targetContents, contents), nil
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+func TestReAddCmd(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		args           []string
+		dryRun         bool
+		tests          []vfst.Test
+		expectedStderr []string
+	}{
+		{
+			name: "all",
+			tests: []vfst.Test{
+				vfst.TestPath("/home/user/.local/share/chezmoi/dot_bashrc",
+					vfst.TestContentsString("# new .bashrc\n"),
+				),
+				vfst.TestPath("/home/user/.local/share/chezmoi/dot_dir/file",
+					vfst.TestContentsString("# new file\n"),
+				),
+				vfst.TestPath("/home/user/.local/share/chezmoi/dot_unchanged",
+					vfst.TestContentsString("# unchanged\n"),
+				),
+				vfst.TestPath("/home/user/.local/share/chezmoi/dot_gitconfig.tmpl",
+					vfst.TestContentsString("# {{ \"template\" }}\n"),
+				),
+			},
+			expectedStderr: []string{
+				".gitconfig: modified, but not re-added because it is a template",
+			},
+		},
+		{
+			name: "args",
+			args: []string{"/home/user/.dir"},
+			tests: []vfst.Test{
+				vfst.TestPath("/home/user/.local/share/chezmoi/dot_bashrc",
+					vfst.TestContentsString("# old .bashrc\n"),
+				),
+				vfst.TestPath("/home/user/.local/share/chezmoi/dot_dir/file",
+					vfst.TestContentsString("# new file\n"),
+				),
+			},
+		},
+		{
+			name:   "dry_run",
+			dryRun: true,
+			tests: []vfst.Test{
+				vfst.TestPath("/home/user/.local/share/chezmoi/dot_bashrc",
+					vfst.TestContentsString("# old .bashrc\n"),
+				),
+				vfst.TestPath("/home/user/.local/share/chezmoi/dot_dir/file",
+					vfst.TestContentsString("# old file\n"),
+				),
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+				"/home/user": map[string]interface{}{
+					".bashrc":    "# new .bashrc\n",
+					".dir/file":  "# new file\n",
+					".gitconfig": "# edited\n",
+					".unchanged": "# unchanged\n",
+					".local/share/chezmoi": map[string]interface{}{
+						"dot_bashrc":         "# old .bashrc\n",
+						"dot_dir/file":       "# old file\n",
+						"dot_gitconfig.tmpl": "# {{ \"template\" }}\n",
+						"dot_missing":        "# missing\n",
+						"dot_unchanged":      "# unchanged\n",
+					},
+				},
+			})
+			require.NoError(t, err)
+			defer cleanup()
+			stderr := &bytes.Buffer{}
+			options := []configOption{withStderr(stderr)}
+			if tc.dryRun {
+				options = append(options, withDryRun(true), withMutator(chezmoi.NullMutator{}))
+			}
+			c := newTestConfig(fs, options...)
+			require.NoError(t, c.runReAddCmd(nil, tc.args))
+			vfst.RunTests(t, fs, "", tc.tests)
+			for _, expectedStderr := range tc.expectedStderr {
+				assert.Contains(t, stderr.String(), expectedStderr)
+			}
+		})
+	}
+}
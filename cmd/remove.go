@@ -29,8 +29,7 @@ func init() {
 
 	persistentFlags := removeCmd.PersistentFlags()
 	persistentFlags.BoolVarP(&config.remove.force, "force", "f", false, "remove without prompting")
-
-	markRemainingZshCompPositionalArgumentsAsFiles(removeCmd, 1)
+	persistentFlags.StringArrayVar(&config.exclude, "exclude", nil, "exclude targets matching pattern")
 }
 
 func (c *Config) runRemoveCmd(cmd *cobra.Command, args []string) error {
@@ -42,11 +41,14 @@ func (c *Config) runRemoveCmd(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return nil
 	}
+	if err := checkNotInEncryptedDirs(ts, entries); err != nil {
+		return err
+	}
 	for _, entry := range entries {
-		destDirPath := filepath.Join(c.DestDir, entry.TargetName())
-		sourceDirPath := filepath.Join(c.SourceDir, entry.SourceName())
+		destDirPath := filepath.Join(ts.DestDir, entry.TargetName())
+		sourceDirPath := ts.SourcePath(entry)
 		if !c.remove.force {
-			choice, err := c.prompt(fmt.Sprintf("Remove %s and %s", destDirPath, sourceDirPath), "ynqa")
+			choice, err := c.prompt(fmt.Sprintf("Remove %s and %s", destDirPath, sourceDirPath), "ynqa", 0)
 			if err != nil {
 				return err
 			}
@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -19,6 +22,19 @@ import (
 
 var config = newConfig()
 
+// colorValues are the values accepted by --color, in addition to any boolean
+// value accepted by strconv.ParseBool, and functions that return whether output
+// to stdout should be colored.
+var colorValues = map[string]func(stdout io.Writer) bool{
+	"auto": isColorTerminal,
+	"off": func(io.Writer) bool {
+		return false
+	},
+	"on": func(io.Writer) bool {
+		return true
+	},
+}
+
 // Version information.
 var (
 	VersionStr string
@@ -37,26 +53,32 @@ var rootCmd = &cobra.Command{
 }
 
 func init() {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		printErrorAndExit(err)
-	}
+	// If the home directory cannot be determined then commands fail later,
+	// unless the destination directory is set explicitly.
+	homeDir, err := config.userLookup.getHomeDir()
+	config.homeDirErr = err
 
-	config.bds, err = xdg.NewBaseDirectorySpecification()
-	if err != nil {
-		printErrorAndExit(err)
-	}
+	config.bds = xdg.NewTestBaseDirectorySpecification(homeDir, os.Getenv)
+	config.stateHome = getStateHome(homeDir, os.Getenv)
 
 	persistentFlags := rootCmd.PersistentFlags()
 
 	persistentFlags.StringVarP(&config.configFile, "config", "c", getDefaultConfigFile(config.bds), "config file")
 
+	persistentFlags.BoolVar(&config.allowSudo, "allow-sudo", false, "when run with sudo, use the invoking user's files")
+
 	persistentFlags.BoolVarP(&config.DryRun, "dry-run", "n", false, "dry run")
 	panicOnError(viper.BindPFlag("dry-run", persistentFlags.Lookup("dry-run")))
 
 	persistentFlags.BoolVar(&config.Follow, "follow", false, "follow symlinks")
 	panicOnError(viper.BindPFlag("follow", persistentFlags.Lookup("follow")))
 
+	persistentFlags.BoolVar(&config.NoPersistentState, "no-persistent-state", false, "do not read or write the persistent state")
+	panicOnError(viper.BindPFlag("no-persistent-state", persistentFlags.Lookup("no-persistent-state")))
+
+	persistentFlags.BoolVar(&config.NoPrompt, "no-prompt", false, "never prompt, use default choices")
+	panicOnError(viper.BindPFlag("no-prompt", persistentFlags.Lookup("no-prompt")))
+
 	persistentFlags.BoolVar(&config.Remove, "remove", false, "remove targets")
 	panicOnError(viper.BindPFlag("remove", persistentFlags.Lookup("remove")))
 
@@ -66,24 +88,37 @@ func init() {
 	persistentFlags.StringVarP(&config.DestDir, "destination", "D", homeDir, "destination directory")
 	panicOnError(viper.BindPFlag("destination", persistentFlags.Lookup("destination")))
 
+	persistentFlags.BoolVar(&config.relativeToDest, "relative-to-dest", false, "resolve relative targets against the destination directory")
+
 	persistentFlags.BoolVarP(&config.Verbose, "verbose", "v", false, "verbose")
 	panicOnError(viper.BindPFlag("verbose", persistentFlags.Lookup("verbose")))
 
 	persistentFlags.StringVar(&config.Color, "color", "auto", "colorize diffs")
 	panicOnError(viper.BindPFlag("color", persistentFlags.Lookup("color")))
+	panicOnError(rootCmd.RegisterFlagCompletionFunc("color", completeWords(colorWords())))
 
 	persistentFlags.BoolVar(&config.Debug, "debug", false, "write debug logs")
 	panicOnError(viper.BindPFlag("debug", persistentFlags.Lookup("debug")))
 
 	cobra.OnInitialize(func() {
+		if err := config.useSudoUser(rootCmd.PersistentFlags()); err != nil {
+			printErrorAndExit(err)
+		}
+		if err := config.warnOwnership(vfs.OSFS, config.configFile); err != nil {
+			printErrorAndExit(err)
+		}
 		_, err := os.Stat(config.configFile)
 		switch {
 		case err == nil:
-			viper.SetConfigFile(config.configFile)
-			config.err = viper.ReadInConfig()
+			sourceDir := config.SourceDir
+			config.err = readConfigFile(viper.GetViper(), vfs.OSFS, config.configFile)
 			if config.err == nil {
 				config.err = viper.Unmarshal(&config)
 			}
+			// --source takes precedence over sourceDir in the config file.
+			if rootCmd.PersistentFlags().Changed("source") {
+				config.SourceDir = sourceDir
+			}
 			if config.err == nil {
 				config.err = config.validateData()
 			}
@@ -135,31 +170,20 @@ func Execute() {
 	rootCmd.Version = strings.Join(versionComponents, ", ")
 
 	if err := rootCmd.Execute(); err != nil {
+		var exitCodeErr exitCodeError
+		if errors.As(err, &exitCodeErr) {
+			os.Exit(int(exitCodeErr))
+		}
 		printErrorAndExit(err)
 	}
 }
 
 func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error {
-	if colored, err := strconv.ParseBool(c.Color); err == nil {
-		c.colored = colored
-	} else {
-		switch c.Color {
-		case "on":
-			c.colored = true
-		case "off":
-			c.colored = false
-		case "auto":
-			if _, ok := os.LookupEnv("NO_COLOR"); ok {
-				c.colored = false
-			} else if stdout, ok := c.Stdout.(*os.File); ok {
-				c.colored = terminal.IsTerminal(int(stdout.Fd()))
-			} else {
-				c.colored = false
-			}
-		default:
-			return fmt.Errorf("invalid --color value: %s", c.Color)
-		}
+	colored, err := parseColor(c.Color, c.Stdout)
+	if err != nil {
+		return err
 	}
+	c.colored = colored
 
 	if c.colored {
 		if err := enableVirtualTerminalProcessingOnWindows(c.Stdout); err != nil {
@@ -167,16 +191,110 @@ func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error
 		}
 	}
 
+	if c.Debug {
+		c.logShadowedTemplateFuncs()
+	}
+	if err := c.disableTemplateFuncs(); err != nil {
+		return err
+	}
+
+	if err := c.checkSudo(cmd.Flags()); err != nil {
+		return err
+	}
+
+	if c.DestDir == "" && c.homeDirErr != nil {
+		return fmt.Errorf("%w, set the destination directory with --destination", c.homeDirErr)
+	}
+	// Make the destination directory absolute so that every command resolves
+	// targets against the same directory.
+	if c.DestDir != "" {
+		destDir, err := filepath.Abs(c.DestDir)
+		if err != nil {
+			return err
+		}
+		c.DestDir = destDir
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	c.workingDir = workingDir
+
 	c.fs = vfs.OSFS
 	c.mutator = chezmoi.NewFSMutator(config.fs)
 	if c.DryRun {
 		c.mutator = chezmoi.NullMutator{}
+	} else if len(c.Elevation.Targets) != 0 {
+		elevate, err := c.getElevate()
+		if err != nil {
+			return err
+		}
+		c.mutator = chezmoi.NewElevatingMutator(c.mutator, c.fs, c.Elevation.Command, c.Elevation.Args, elevate, c.Stdin)
+	}
+	if !c.DryRun && c.sudoUser != nil && c.allowSudo {
+		// Writes keep root's privileges, but files written in the invoking
+		// user's home directory belong to them.
+		c.mutator = chezmoi.NewChownMutator(c.mutator, c.fs, c.sudoUser.homeDir, c.sudoUser.uid, c.sudoUser.gid)
+	}
+	if !c.DryRun {
+		c.mutator = chezmoi.NewImmutableMutator(c.mutator, c.fs, c.Apply.ClearImmutable)
+	}
+	if c.applyLog.file != "" {
+		if c.applyLog.format != "json" {
+			return fmt.Errorf("invalid --log-format value: %s", c.applyLog.format)
+		}
+		// The log file is deliberately left open until chezmoi exits. Each
+		// entry is written directly to the file, so a crash still leaves the
+		// entries written so far.
+		//nolint:gosec
+		logFile, err := os.OpenFile(c.applyLog.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		c.applyLog.mutator = chezmoi.NewLogMutator(logFile, c.mutator, vfs.NewReadOnlyFS(c.fs), c.DryRun)
+		c.mutator = c.applyLog.mutator
 	}
 	if c.Debug {
 		c.mutator = chezmoi.NewDebugMutator(c.mutator)
 	}
 	if c.Verbose {
-		c.mutator = chezmoi.NewVerboseMutator(c.Stdout, c.mutator, c.colored, c.maxDiffDataSize)
+		destDir := c.DestDir
+		if destDir != "" {
+			destDir, err = filepath.Abs(c.DestDir)
+			if err != nil {
+				return err
+			}
+		}
+		c.mutator = chezmoi.NewSummaryMutator(c.Stdout, c.mutator, vfs.NewReadOnlyFS(c.fs), c.colored, destDir, c.DryRun)
+	}
+
+	if cmd.Flags().Changed("source") {
+		configSourceDir := getDefaultSourceDir(c.bds)
+		if viper.IsSet("sourceDir") {
+			configSourceDir = viper.GetString("sourceDir")
+		}
+		if err := c.useSourceDirFlag(configSourceDir); err != nil {
+			return err
+		}
+	}
+
+	if len(c.SourceDirs) != 0 {
+		// Unless the source directory is set explicitly, changes are made in
+		// the source directory with the highest priority.
+		if !cmd.Flags().Changed("source") && !viper.IsSet("sourceDir") {
+			c.SourceDir = c.SourceDirs[len(c.SourceDirs)-1]
+		}
+		found := false
+		for _, sourceDir := range c.SourceDirs {
+			if sourceDir == c.SourceDir {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: not in sourceDirs", c.SourceDir)
+		}
 	}
 
 	info, err := c.fs.Stat(c.SourceDir)
@@ -199,18 +317,42 @@ func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error
 	return c.snapFix()
 }
 
-func getExample(command string) string {
-	return helps[command].example
+// colorWords returns the sorted values accepted by --color.
+func colorWords() []string {
+	words := []string{"false", "true"}
+	for value := range colorValues {
+		words = append(words, value)
+	}
+	sort.Strings(words)
+	return words
 }
 
-func markRemainingZshCompPositionalArgumentsAsFiles(cmd *cobra.Command, from int) {
-	// As far as I can tell, there is no way to mark all remaining positional
-	// arguments as files. Marking the first eight positional arguments as files
-	// should be enough for everybody.
-	// FIXME mark all remaining positional arguments as files
-	for i := 0; i < 8; i++ {
-		panicOnError(cmd.MarkZshCompPositionalArgumentFile(from + i))
+// isColorTerminal returns whether stdout is a terminal and the NO_COLOR
+// environment variable is not set.
+func isColorTerminal(stdout io.Writer) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
 	}
+	if stdoutFile, ok := stdout.(*os.File); ok {
+		return terminal.IsTerminal(int(stdoutFile.Fd()))
+	}
+	return false
+}
+
+// parseColor returns whether output to stdout should be colored according to
+// the --color value value.
+func parseColor(value string, stdout io.Writer) (bool, error) {
+	if colored, err := strconv.ParseBool(value); err == nil {
+		return colored, nil
+	}
+	if colorFunc, ok := colorValues[value]; ok {
+		return colorFunc(stdout), nil
+	}
+	return false, fmt.Errorf("invalid --color value: %s", value)
+}
+
+func getExample(command string) string {
+	return helps[command].example
 }
 
 func mustGetLongHelp(command string) string {
@@ -1,6 +1,11 @@
 package cmd
 
-import "github.com/spf13/cobra"
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+)
 
 var secretCmd = &cobra.Command{
 	Use:     "secret",
@@ -10,6 +15,47 @@ var secretCmd = &cobra.Command{
 	Example: getExample("secret"),
 }
 
+// secretCommandPaths caches the paths of secret manager commands.
+var secretCommandPaths = make(map[string]string)
+
 func init() {
 	rootCmd.AddCommand(secretCmd)
 }
+
+// getSecretCommandPath returns the path of command, looking it up in $PATH
+// unless it contains a path separator. Commands are only looked up when they
+// are first used, so that secret managers that are not used need not be
+// installed. configKey is the configuration variable that sets command, which
+// is suggested when command cannot be found, for example because it is not in
+// the $PATH of GUI applications.
+func getSecretCommandPath(configKey, command string) (string, error) {
+	if path, ok := secretCommandPaths[command]; ok {
+		return path, nil
+	}
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return "", fmt.Errorf("%w, set %s to its absolute path", err, configKey)
+	}
+	secretCommandPaths[command] = path
+	return path, nil
+}
+
+// clearSecretCaches forgets the results of all secret template functions, so
+// that they retrieve secrets from their secret managers again.
+func clearSecretCaches() {
+	awsSecretsManagerCache = make(map[string]map[string]interface{})
+	awsSecretsManagerRawCache = make(map[string]string)
+	bitwardenCache = make(map[string]interface{})
+	gopassCache = make(map[string]string)
+	keePassXCCache = make(map[string]map[string]string)
+	keePassXCAttributeCache = make(map[keePassXCAttributeCacheKey]string)
+	keyringCache = make(map[keyringKey]string)
+	lastPassCache = make(map[string][]map[string]interface{})
+	onepasswordCache = make(map[string]interface{})
+	onepasswordDocumentCache = make(map[string]string)
+	onepasswordItemFieldsCache = make(map[string]map[string]interface{})
+	passCache = make(map[string]string)
+	secretCache = make(map[string]string)
+	secretJSONCache = make(map[string]interface{})
+	vaultCache = make(map[string]interface{})
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSecretCommandPathNotFound(t *testing.T) {
+	c := newConfig()
+	c.Vault.Command = "chezmoi-test-missing-vault"
+
+	_, err := getSecretCommandPath("vault.command", c.Vault.Command)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "chezmoi-test-missing-vault")
+	assert.Contains(t, err.Error(), "set vault.command to its absolute path")
+
+	// The passthrough command and the template function report the same
+	// error.
+	err = c.runVaultCmd(nil, []string{"status"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "set vault.command to its absolute path")
+	func() {
+		defer func() {
+			err, ok := recover().(error)
+			require.True(t, ok)
+			assert.Contains(t, err.Error(), "vault: ")
+			assert.Contains(t, err.Error(), "set vault.command to its absolute path")
+		}()
+		c.vaultFunc("secret/missing")
+	}()
+}
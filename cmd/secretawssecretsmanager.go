@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+var awsSecretsManagerCmd = &cobra.Command{
+	Use:     "aws-secrets-manager [args...]",
+	Short:   "Execute the AWS CLI (aws) secretsmanager command",
+	PreRunE: config.ensureNoError,
+	RunE:    config.runAWSSecretsManagerCmd,
+}
+
+type awsSecretsManagerCmdConfig struct {
+	Command string
+	Region  string
+	Profile string
+}
+
+var (
+	awsSecretsManagerCache    = make(map[string]map[string]interface{})
+	awsSecretsManagerRawCache = make(map[string]string)
+)
+
+func init() {
+	config.AWSSecretsManager.Command = "aws"
+	config.AWSSecretsManager.Region = os.Getenv("AWS_REGION")
+	if config.AWSSecretsManager.Region == "" {
+		config.AWSSecretsManager.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	config.AWSSecretsManager.Profile = os.Getenv("AWS_PROFILE")
+	config.addSecretTemplateFunc("awsSecretsManager", config.awsSecretsManagerFunc)
+	config.addSecretTemplateFunc("awsSecretsManagerRaw", config.awsSecretsManagerRawFunc)
+
+	secretCmd.AddCommand(awsSecretsManagerCmd)
+}
+
+func (c *Config) runAWSSecretsManagerCmd(cmd *cobra.Command, args []string) error {
+	return c.run("", c.AWSSecretsManager.Command, append([]string{"secretsmanager"}, args...)...)
+}
+
+func (c *Config) awsSecretsManagerFunc(name string) map[string]interface{} {
+	if data, ok := awsSecretsManagerCache[name]; ok {
+		return data
+	}
+	raw := c.awsSecretsManagerRawFunc(name)
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		panic(fmt.Errorf("awsSecretsManager: %s: %w", name, err))
+	}
+	awsSecretsManagerCache[name] = data
+	return data
+}
+
+func (c *Config) awsSecretsManagerRawFunc(name string) string {
+	if secret, ok := awsSecretsManagerRawCache[name]; ok {
+		return secret
+	}
+	args := c.awsSecretsManagerGetSecretValueArgs(name)
+	cmd := exec.Command(c.AWSSecretsManager.Command, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	output, err := c.mutator.IdempotentCmdOutput(cmd)
+	if err != nil {
+		panic(fmt.Errorf("awsSecretsManagerRaw: %s %s: %w\n%s", c.AWSSecretsManager.Command, chezmoi.ShellQuoteArgs(args), err, output))
+	}
+	secret, err := awsSecretsManagerParseSecretValue(output)
+	if err != nil {
+		panic(fmt.Errorf("awsSecretsManagerRaw: %s: %w", name, err))
+	}
+	awsSecretsManagerRawCache[name] = secret
+	return secret
+}
+
+// awsSecretsManagerGetSecretValueArgs returns the arguments to the AWS CLI to
+// get the value of the secret name.
+func (c *Config) awsSecretsManagerGetSecretValueArgs(name string) []string {
+	args := []string{"secretsmanager", "get-secret-value", "--secret-id", name, "--output", "json"}
+	if c.AWSSecretsManager.Region != "" {
+		args = append(args, "--region", c.AWSSecretsManager.Region)
+	}
+	if c.AWSSecretsManager.Profile != "" {
+		args = append(args, "--profile", c.AWSSecretsManager.Profile)
+	}
+	return args
+}
+
+// awsSecretsManagerParseSecretValue returns the secret in output, the output of
+// aws secretsmanager get-secret-value. Binary secrets are returned decoded.
+func awsSecretsManagerParseSecretValue(output []byte) (string, error) {
+	var secretValue struct {
+		SecretString *string
+		SecretBinary *string
+	}
+	if err := json.Unmarshal(output, &secretValue); err != nil {
+		return "", err
+	}
+	switch {
+	case secretValue.SecretString != nil:
+		return *secretValue.SecretString, nil
+	case secretValue.SecretBinary != nil:
+		secretBinary, err := base64.StdEncoding.DecodeString(*secretValue.SecretBinary)
+		if err != nil {
+			return "", err
+		}
+		return string(secretBinary), nil
+	default:
+		return "", errors.New("no SecretString or SecretBinary")
+	}
+}
@@ -0,0 +1,44 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+func TestAWSSecretsManagerFunc(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	command := filepath.Join(tempDir, "aws")
+	require.NoError(t, ioutil.WriteFile(command, []byte(""+
+		"#!/bin/sh\n"+
+		"echo \"$@\" >> "+filepath.Join(tempDir, "calls")+"\n"+
+		"echo '{\"Name\":\"test/secret\",\"SecretString\":\"{\\\"username\\\":\\\"user\\\"}\"}'\n",
+	), 0o755))
+
+	c := newConfig(withMutator(chezmoi.NullMutator{}))
+	c.AWSSecretsManager = awsSecretsManagerCmdConfig{
+		Command: command,
+		Region:  "eu-central-1",
+		Profile: "work",
+	}
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, map[string]interface{}{"username": "user"}, c.awsSecretsManagerFunc("test/secret"))
+	}
+	assert.Equal(t, `{"username":"user"}`, c.awsSecretsManagerRawFunc("test/secret"))
+	calls, err := ioutil.ReadFile(filepath.Join(tempDir, "calls"))
+	require.NoError(t, err)
+	assert.Equal(t, "secretsmanager get-secret-value --secret-id test/secret --output json --region eu-central-1 --profile work\n", string(calls))
+}
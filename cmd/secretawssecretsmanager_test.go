@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAWSSecretsManagerParseSecretValue(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		output      string
+		expected    string
+		expectedErr bool
+	}{
+		{
+			name:     "string",
+			output:   `{"Name":"secret","SecretString":"{\"password\":\"hunter2\"}"}`,
+			expected: `{"password":"hunter2"}`,
+		},
+		{
+			name:     "binary",
+			output:   `{"Name":"secret","SecretBinary":"aHVudGVyMg=="}`,
+			expected: "hunter2",
+		},
+		{
+			name:        "missing",
+			output:      `{"Name":"secret"}`,
+			expectedErr: true,
+		},
+		{
+			name:        "invalid",
+			output:      `not JSON`,
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := awsSecretsManagerParseSecretValue([]byte(tc.output))
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
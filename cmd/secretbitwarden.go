@@ -2,10 +2,15 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 
 	"github.com/spf13/cobra"
 
@@ -20,28 +25,73 @@ var bitwardenCmd = &cobra.Command{
 }
 
 type bitwardenCmdConfig struct {
-	Command string
+	Command  string
+	ServeURL string
 }
 
-var bitwardenCache = make(map[string]interface{})
+// A bitwardenServeResponse is a response from the REST API of bw serve.
+type bitwardenServeResponse struct {
+	Success bool
+	Message string
+	Data    json.RawMessage
+}
+
+// A bitwardenServeResponseError is an error returned by the REST API of bw
+// serve.
+type bitwardenServeResponseError struct {
+	message string
+}
+
+func (e *bitwardenServeResponseError) Error() string {
+	return e.message
+}
+
+var (
+	bitwardenCache = make(map[string]interface{})
+	// bitwardenMutex serializes calls to Bitwarden, so parallel template
+	// execution does not run several instances of bw at once.
+	bitwardenMutex sync.Mutex
+)
 
 func init() {
 	config.Bitwarden.Command = "bw"
-	config.addTemplateFunc("bitwarden", config.bitwardenFunc)
+	config.addSecretTemplateFunc("bitwarden", config.bitwardenFunc)
 
 	secretCmd.AddCommand(bitwardenCmd)
 }
 
 func (c *Config) runBitwardenCmd(cmd *cobra.Command, args []string) error {
-	return c.run("", c.Bitwarden.Command, args...)
+	name, err := getSecretCommandPath("bitwarden.command", c.Bitwarden.Command)
+	if err != nil {
+		return err
+	}
+	return c.run("", name, args...)
 }
 
 func (c *Config) bitwardenFunc(args ...string) interface{} {
+	bitwardenMutex.Lock()
+	defer bitwardenMutex.Unlock()
 	key := strings.Join(args, "\x00")
 	if data, ok := bitwardenCache[key]; ok {
 		return data
 	}
-	name := c.Bitwarden.Command
+	if c.Bitwarden.ServeURL != "" && isBitwardenServeArgs(args) {
+		serveURL := strings.TrimSuffix(c.Bitwarden.ServeURL, "/")
+		if data, err := bitwardenServeGet(serveURL, args[0], args[1]); err != nil {
+			var responseErr *bitwardenServeResponseError
+			if errors.As(err, &responseErr) {
+				panic(fmt.Errorf("bitwarden: %s: %w", strings.Join(args, " "), err))
+			}
+			c.bitwardenLogf("bitwarden: bw serve unavailable, using %s: %v", c.Bitwarden.Command, err)
+		} else {
+			bitwardenCache[key] = data
+			return data
+		}
+	}
+	name, err := getSecretCommandPath("bitwarden.command", c.Bitwarden.Command)
+	if err != nil {
+		panic(fmt.Errorf("bitwarden: %w", err))
+	}
 	args = append([]string{"get"}, args...)
 	cmd := exec.Command(name, args...)
 	cmd.Stdin = os.Stdin
@@ -57,3 +107,47 @@ func (c *Config) bitwardenFunc(args ...string) interface{} {
 	bitwardenCache[key] = data
 	return data
 }
+
+// bitwardenLogf logs a message in debug mode.
+func (c *Config) bitwardenLogf(format string, args ...interface{}) {
+	if c.Debug {
+		log.Printf(format, args...)
+	}
+}
+
+// bitwardenServeGet gets the object of type object identified by id from the
+// REST API of bw serve at serveURL.
+func bitwardenServeGet(serveURL, object, id string) (interface{}, error) {
+	resp, err := http.Get(serveURL + "/object/" + url.PathEscape(object) + "/" + url.PathEscape(id))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var response bitwardenServeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("%s: %w", resp.Status, err)
+	}
+	if !response.Success {
+		return nil, &bitwardenServeResponseError{message: response.Message}
+	}
+	var data interface{}
+	if err := json.Unmarshal(response.Data, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// isBitwardenServeArgs returns whether args can be passed to the REST API of
+// bw serve, which only supports getting an object by type and id or search
+// term.
+func isBitwardenServeArgs(args []string) bool {
+	if len(args) != 2 {
+		return false
+	}
+	for _, arg := range args {
+		if arg == "" || strings.HasPrefix(arg, "-") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitwardenServe(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		switch r.URL.Path {
+		case "/object/item/serve.example.com":
+			_, _ = w.Write([]byte(`{"success":true,"data":{"object":"item","login":{"username":"user"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"success":false,"message":"Not found."}`))
+		}
+	}))
+	defer server.Close()
+
+	c := newConfig()
+	c.Bitwarden.Command = "false"
+	c.Bitwarden.ServeURL = server.URL + "/"
+	expected := map[string]interface{}{
+		"object": "item",
+		"login": map[string]interface{}{
+			"username": "user",
+		},
+	}
+	assert.Equal(t, expected, c.bitwardenFunc("item", "serve.example.com"))
+	assert.Equal(t, expected, c.bitwardenFunc("item", "serve.example.com"))
+	func() {
+		defer func() {
+			err, ok := recover().(error)
+			require.True(t, ok)
+			assert.EqualError(t, err, "bitwarden: item missing.example.com: Not found.")
+		}()
+		c.bitwardenFunc("item", "missing.example.com")
+	}()
+	assert.Equal(t, []string{
+		"/object/item/serve.example.com",
+		"/object/item/missing.example.com",
+	}, paths)
+}
+
+func TestIsBitwardenServeArgs(t *testing.T) {
+	for _, tc := range []struct {
+		args     []string
+		expected bool
+	}{
+		{args: []string{"item", "example.com"}, expected: true},
+		{args: []string{"item"}},
+		{args: []string{"item", "example.com", "--raw"}},
+		{args: []string{"--raw", "example.com"}},
+		{args: []string{"item", ""}},
+	} {
+		assert.Equal(t, tc.expected, isBitwardenServeArgs(tc.args), tc.args)
+	}
+}
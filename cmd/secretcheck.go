@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bmatcuk/doublestar"
+)
+
+// A secretPattern is a pattern that matches a line that likely contains a
+// secret.
+type secretPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// A secretFinding is a likely secret found in a file. line is zero if the file
+// was identified by its path rather than its contents.
+type secretFinding struct {
+	name string
+	line int
+}
+
+var (
+	secretPatterns = []secretPattern{
+		{
+			name: "AWS access key ID",
+			re:   regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+		},
+		{
+			name: "private key",
+			re:   regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----`),
+		},
+		{
+			name: "password",
+			re:   regexp.MustCompile(`(?i)\b(?:passwd|password|secret)\s*[:=]\s*\S`),
+		},
+	}
+
+	// sensitivePathPatterns match the paths, relative to the destination
+	// directory, of files that usually contain secrets.
+	sensitivePathPatterns = []string{
+		"**/.aws/credentials",
+		"**/.netrc",
+		"**/.ssh/id_{dsa,ecdsa,ed25519,rsa}",
+	}
+
+	templateActionRegexp = regexp.MustCompile(`{{.*}}`)
+)
+
+func (f secretFinding) String() string {
+	if f.line == 0 {
+		return f.name
+	}
+	return fmt.Sprintf("%s on line %d", f.name, f.line)
+}
+
+// findSecrets returns the likely secrets in the file at targetName with
+// contents.
+func findSecrets(targetName string, contents []byte) []secretFinding {
+	var findings []secretFinding
+	for _, pattern := range sensitivePathPatterns {
+		if ok, _ := doublestar.Match(pattern, filepath.ToSlash(targetName)); ok {
+			findings = append(findings, secretFinding{
+				name: "sensitive path",
+			})
+			break
+		}
+	}
+	s := bufio.NewScanner(bytes.NewReader(contents))
+	for line := 1; s.Scan(); line++ {
+		for _, pattern := range secretPatterns {
+			if pattern.re.Match(s.Bytes()) {
+				findings = append(findings, secretFinding{
+					name: pattern.name,
+					line: line,
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// confirmNoSecrets checks the file at path for likely secrets and, if any are
+// found, prompts the user whether to add it anyway. It returns true if path
+// should be added.
+func (c *Config) confirmNoSecrets(path, targetName string) (bool, error) {
+	if !c.Add.SecretCheck || c.Add.noSecretCheck || c.Add.options.Encrypt {
+		return true, nil
+	}
+	var info os.FileInfo
+	var err error
+	if c.Follow {
+		info, err = c.fs.Stat(path)
+	} else {
+		info, err = c.fs.Lstat(path)
+	}
+	if err != nil || info.IsDir() {
+		// Errors are reported when the file is added.
+		return true, nil
+	}
+	contents, err := c.fs.ReadFile(path)
+	if err != nil {
+		return true, nil
+	}
+	// Templates that use template functions are assumed to get their secrets
+	// from elsewhere, for example a password manager.
+	if c.Add.options.Template && templateActionRegexp.Match(contents) {
+		return true, nil
+	}
+	findings := findSecrets(targetName, contents)
+	if len(findings) == 0 {
+		return true, nil
+	}
+	descriptions := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		descriptions = append(descriptions, finding.String())
+	}
+	fmt.Fprintf(c.Stderr, "warning: %s: may contain secrets in plaintext: %s\n", path, strings.Join(descriptions, ", "))
+	fmt.Fprintf(c.Stderr, "warning: consider using --encrypt or a template that reads secrets from your password manager\n")
+	choice, err := c.prompt(fmt.Sprintf("Add %s anyway", path), "yn", 'n')
+	if err != nil {
+		return false, err
+	}
+	return choice == 'y', nil
+}
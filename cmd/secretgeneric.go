@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"unicode"
 
 	"github.com/spf13/cobra"
 
@@ -30,8 +31,8 @@ var (
 )
 
 func init() {
-	config.addTemplateFunc("secret", config.secretFunc)
-	config.addTemplateFunc("secretJSON", config.secretJSONFunc)
+	config.addSecretTemplateFunc("secret", config.secretFunc)
+	config.addSecretTemplateFunc("secretJSON", config.secretJSONFunc)
 
 	secretCmd.AddCommand(genericSecretCmd)
 }
@@ -71,6 +72,7 @@ func (c *Config) secretJSONFunc(args ...string) interface{} {
 	if err != nil {
 		panic(fmt.Errorf("secretJSON: %s %s: %w\n%s", name, chezmoi.ShellQuoteArgs(args), err, output))
 	}
+	output = bytes.TrimRightFunc(output, unicode.IsSpace)
 	var value interface{}
 	if err := json.Unmarshal(output, &value); err != nil {
 		panic(fmt.Errorf("secretJSON: %s %s: %w\n%s", name, chezmoi.ShellQuoteArgs(args), err, output))
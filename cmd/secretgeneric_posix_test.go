@@ -21,3 +21,12 @@ func getSecretJSONTestConfig() (*Config, []string) {
 		}),
 	), []string{`+{"date":"%Y-%M-%DT%H:%M:%SZ"}`}
 }
+
+func getSecretJSONInvalidTestConfig() (*Config, []string) {
+	return newConfig(
+		withMutator(chezmoi.NullMutator{}),
+		withGenericSecretCmdConfig(genericSecretCmdConfig{
+			Command: "echo",
+		}),
+	), []string{"not json"}
+}
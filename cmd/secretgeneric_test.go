@@ -5,6 +5,9 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
 )
 
 func TestSecretFunc(t *testing.T) {
@@ -32,3 +35,16 @@ func TestSecretJSONFunc(t *testing.T) {
 	time.Sleep(1100 * time.Millisecond)
 	assert.Equal(t, value, c.secretJSONFunc(args...))
 }
+
+func TestSecretJSONFuncInvalidJSON(t *testing.T) {
+	t.Parallel()
+
+	c, args := getSecretJSONInvalidTestConfig()
+
+	defer func() {
+		err, ok := recover().(error)
+		require.True(t, ok)
+		assert.Contains(t, err.Error(), "secretJSON: "+c.GenericSecret.Command+" "+chezmoi.ShellQuoteArgs(args)+": ")
+	}()
+	c.secretJSONFunc(args...)
+}
@@ -25,3 +25,13 @@ func getSecretJSONTestConfig() (*Config, []string) {
 		),
 		[]string{"-NoProfile", "-NonInteractive", "-Command", "Get-Date | ConvertTo-Json"}
 }
+
+func getSecretJSONInvalidTestConfig() (*Config, []string) {
+	return newConfig(
+			withMutator(chezmoi.NullMutator{}),
+			withGenericSecretCmdConfig(genericSecretCmdConfig{
+				Command: "powershell.exe",
+			}),
+		),
+		[]string{"-NoProfile", "-NonInteractive", "-Command", "Write-Output 'not json'"}
+}
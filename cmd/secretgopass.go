@@ -27,18 +27,25 @@ func init() {
 	secretCmd.AddCommand(gopassCmd)
 
 	config.Gopass.Command = "gopass"
-	config.addTemplateFunc("gopass", config.gopassFunc)
+	config.addSecretTemplateFunc("gopass", config.gopassFunc)
 }
 
 func (c *Config) runSecretGopassCmd(cmd *cobra.Command, args []string) error {
-	return c.run("", c.Pass.Command, args...)
+	name, err := getSecretCommandPath("gopass.command", c.Gopass.Command)
+	if err != nil {
+		return err
+	}
+	return c.run("", name, args...)
 }
 
 func (c *Config) gopassFunc(id string) string {
 	if s, ok := gopassCache[id]; ok {
 		return s
 	}
-	name := c.Gopass.Command
+	name, err := getSecretCommandPath("gopass.command", c.Gopass.Command)
+	if err != nil {
+		panic(fmt.Errorf("gopass: %w", err))
+	}
 	args := []string{"show", id}
 	cmd := exec.Command(name, args...)
 	output, err := c.mutator.IdempotentCmdOutput(cmd)
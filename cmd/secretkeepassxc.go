@@ -46,21 +46,25 @@ var (
 
 func init() {
 	config.KeePassXC.Command = "keepassxc-cli"
-	config.addTemplateFunc("keepassxc", config.keePassXCFunc)
-	config.addTemplateFunc("keepassxcAttribute", config.keePassXCAttributeFunc)
+	config.addSecretTemplateFunc("keepassxc", config.keePassXCFunc)
+	config.addSecretTemplateFunc("keepassxcAttribute", config.keePassXCAttributeFunc)
 
 	secretCmd.AddCommand(keePassXCCmd)
 }
 
 func (c *Config) runKeePassXCCmd(cmd *cobra.Command, args []string) error {
-	return c.run("", c.KeePassXC.Command, args...)
+	name, err := getSecretCommandPath("keepassxc.command", c.KeePassXC.Command)
+	if err != nil {
+		return err
+	}
+	return c.run("", name, args...)
 }
 
 func (c *Config) getKeePassXCVersion() *semver.Version {
 	if keePassXCVersion != nil {
 		return keePassXCVersion
 	}
-	name := c.KeePassXC.Command
+	name := c.getKeePassXCCommandPath()
 	args := []string{"--version"}
 	cmd := exec.Command(name, args...)
 	output, err := c.mutator.IdempotentCmdOutput(cmd)
@@ -81,7 +85,7 @@ func (c *Config) keePassXCFunc(entry string) map[string]string {
 	if c.KeePassXC.Database == "" {
 		panic(errors.New("keepassxc: keepassxc.database not set"))
 	}
-	name := c.KeePassXC.Command
+	name := c.getKeePassXCCommandPath()
 	args := []string{"show"}
 	if c.getKeePassXCVersion().Compare(keePassXCNeedShowProtectedArgVersion) >= 0 {
 		args = append(args, "--show-protected")
@@ -111,7 +115,7 @@ func (c *Config) keePassXCAttributeFunc(entry, attribute string) string {
 	if c.KeePassXC.Database == "" {
 		panic(errors.New("keepassxc: keepassxc.database not set"))
 	}
-	name := c.KeePassXC.Command
+	name := c.getKeePassXCCommandPath()
 	args := []string{"show", "--attributes", attribute, "--quiet"}
 	if c.getKeePassXCVersion().Compare(keePassXCNeedShowProtectedArgVersion) >= 0 {
 		args = append(args, "--show-protected")
@@ -127,6 +131,16 @@ func (c *Config) keePassXCAttributeFunc(entry, attribute string) string {
 	return outputStr
 }
 
+// getKeePassXCCommandPath returns the path of the KeePassXC CLI. It panics if
+// it cannot be found.
+func (c *Config) getKeePassXCCommandPath() string {
+	name, err := getSecretCommandPath("keepassxc.command", c.KeePassXC.Command)
+	if err != nil {
+		panic(fmt.Errorf("keepassxc: %w", err))
+	}
+	return name
+}
+
 func (c *Config) runKeePassXCCLICommand(name string, args []string) ([]byte, error) {
 	if keePassXCPassword == "" {
 		fmt.Printf("Insert password to unlock %s: ", c.KeePassXC.Database)
@@ -37,7 +37,7 @@ func init() {
 	persistentFlags.StringVar(&config.keyring.user, "user", "", "user")
 	panicOnError(keyringCmd.MarkPersistentFlagRequired("user"))
 
-	config.addTemplateFunc("keyring", config.keyringFunc)
+	config.addSecretTemplateFunc("keyring", config.keyringFunc)
 }
 
 func (*Config) keyringFunc(service, user string) string {
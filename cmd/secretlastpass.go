@@ -42,18 +42,25 @@ var lastPassCache = make(map[string][]map[string]interface{})
 
 func init() {
 	config.Lastpass.Command = "lpass"
-	config.addTemplateFunc("lastpass", config.lastpassFunc)
-	config.addTemplateFunc("lastpassRaw", config.lastpassRawFunc)
+	config.addSecretTemplateFunc("lastpass", config.lastpassFunc)
+	config.addSecretTemplateFunc("lastpassRaw", config.lastpassRawFunc)
 
 	secretCmd.AddCommand(lastpassCmd)
 }
 
 func (c *Config) runLastpassCmd(cmd *cobra.Command, args []string) error {
-	return c.run("", c.Lastpass.Command, args...)
+	name, err := getSecretCommandPath("lastpass.command", c.Lastpass.Command)
+	if err != nil {
+		return err
+	}
+	return c.run("", name, args...)
 }
 
 func (c *Config) lastpassOutput(args ...string) ([]byte, error) {
-	name := c.Lastpass.Command
+	name, err := getSecretCommandPath("lastpass.command", c.Lastpass.Command)
+	if err != nil {
+		return nil, fmt.Errorf("lastpass: %w", err)
+	}
 	cmd := exec.Command(name, args...)
 	cmd.Stdin = os.Stdin
 	cmd.Stderr = os.Stderr
@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
 
@@ -19,42 +21,58 @@ var onepasswordCmd = &cobra.Command{
 }
 
 type onepasswordCmdConfig struct {
-	Command string
+	Command             string
+	ServiceAccountToken string
+	ConnectHost         string
+	ConnectToken        string
+}
+
+// An onepasswordItem is an item output by 1Password CLI v2.
+type onepasswordItem struct {
+	Fields []map[string]interface{} `json:"fields"`
 }
 
 var (
-	onepasswordCache         = make(map[string]interface{})
-	onepasswordDocumentCache = make(map[string]string)
+	onepasswordCache           = make(map[string]interface{})
+	onepasswordDocumentCache   = make(map[string]string)
+	onepasswordItemFieldsCache = make(map[string]map[string]interface{})
 )
 
 func init() {
 	config.Onepassword.Command = "op"
-	config.addTemplateFunc("onepassword", config.onepasswordFunc)
-	config.addTemplateFunc("onepasswordDocument", config.onepasswordDocumentFunc)
+	config.addSecretTemplateFunc("onepassword", config.onepasswordFunc)
+	config.addSecretTemplateFunc("onepasswordDocument", config.onepasswordDocumentFunc)
+	config.addSecretTemplateFunc("onepasswordItemFields", config.onepasswordItemFieldsFunc)
 
 	secretCmd.AddCommand(onepasswordCmd)
 }
 
 func (c *Config) runOnepasswordCmd(cmd *cobra.Command, args []string) error {
-	return c.run("", c.Onepassword.Command, args...)
+	env, err := c.Onepassword.env()
+	if err != nil {
+		return err
+	}
+	name, err := getSecretCommandPath("onepassword.command", c.Onepassword.Command)
+	if err != nil {
+		return err
+	}
+	opCmd := exec.Command(name, args...)
+	opCmd.Env = env
+	opCmd.Stdin = c.Stdin
+	opCmd.Stdout = c.Stdout
+	opCmd.Stderr = c.Stdout
+	return c.mutator.RunCmd(opCmd)
 }
 
 func (c *Config) onepasswordFunc(item string) interface{} {
 	if data, ok := onepasswordCache[item]; ok {
 		return data
 	}
-	name := c.Onepassword.Command
 	args := []string{"get", "item", item}
-	cmd := exec.Command(name, args...)
-	cmd.Stdin = os.Stdin
-	cmd.Stderr = os.Stderr
-	output, err := c.mutator.IdempotentCmdOutput(cmd)
-	if err != nil {
-		panic(fmt.Errorf("onepassword: %s %s: %w\n%s", name, chezmoi.ShellQuoteArgs(args), err, output))
-	}
+	output := c.onepasswordOutput("onepassword", args)
 	var data interface{}
 	if err := json.Unmarshal(output, &data); err != nil {
-		panic(fmt.Errorf("onepassword: %s %s: %w\n%s", name, chezmoi.ShellQuoteArgs(args), err, output))
+		panic(fmt.Errorf("onepassword: %s %s: %w\n%s", c.Onepassword.Command, chezmoi.ShellQuoteArgs(args), err, output))
 	}
 	onepasswordCache[item] = data
 	return data
@@ -64,15 +82,161 @@ func (c *Config) onepasswordDocumentFunc(item string) interface{} {
 	if output, ok := onepasswordDocumentCache[item]; ok {
 		return output
 	}
+	output := c.onepasswordOutput("onepasswordDocument", []string{"get", "document", item})
+	onepasswordDocumentCache[item] = string(output)
+	return string(output)
+}
+
+func (c *Config) onepasswordItemFieldsFunc(item string) map[string]interface{} {
+	if itemFields, ok := onepasswordItemFieldsCache[item]; ok {
+		return itemFields
+	}
 	name := c.Onepassword.Command
-	args := []string{"get", "document", item}
+	args := []string{"item", "get", item, "--format", "json"}
+	output := c.onepasswordOutput("onepasswordItemFields", args)
+	warnf := func(string, ...interface{}) {}
+	if c.Debug {
+		warnf = log.Printf
+	}
+	itemFields, err := onepasswordParseItemFields(output, warnf)
+	if err != nil {
+		panic(fmt.Errorf("onepasswordItemFields: %s %s: %w\n%s", name, chezmoi.ShellQuoteArgs(args), err, output))
+	}
+	onepasswordItemFieldsCache[item] = itemFields
+	return itemFields
+}
+
+// onepasswordOutput returns the output of op with args, authenticated as
+// configured. It panics with an error prefixed with funcName on failure.
+func (c *Config) onepasswordOutput(funcName string, args []string) []byte {
+	env, err := c.Onepassword.env()
+	if err != nil {
+		panic(fmt.Errorf("%s: %w", funcName, err))
+	}
+	name, err := getSecretCommandPath("onepassword.command", c.Onepassword.Command)
+	if err != nil {
+		panic(fmt.Errorf("%s: %w", funcName, err))
+	}
 	cmd := exec.Command(name, args...)
+	cmd.Env = env
 	cmd.Stdin = os.Stdin
 	cmd.Stderr = os.Stderr
 	output, err := c.mutator.IdempotentCmdOutput(cmd)
 	if err != nil {
-		panic(fmt.Errorf("onepassword: %s %s: %w\n%s", name, chezmoi.ShellQuoteArgs(args), err, output))
+		panic(fmt.Errorf("%s: %s %s: %w\n%s", funcName, name, chezmoi.ShellQuoteArgs(args), err, output))
 	}
-	onepasswordDocumentCache[item] = string(output)
-	return string(output)
+	return output
+}
+
+// env returns the environment for op. If a service account token or a
+// 1Password Connect server is configured then it is passed to op in the
+// environment, so op runs without an interactive session. Otherwise, op uses
+// chezmoi's environment unchanged.
+func (oc onepasswordCmdConfig) env() ([]string, error) {
+	connect := oc.ConnectHost != "" || oc.ConnectToken != ""
+	switch {
+	case connect && (oc.ConnectHost == "" || oc.ConnectToken == ""):
+		return nil, errors.New("onepassword.connectHost and onepassword.connectToken must be set together")
+	case connect && oc.ServiceAccountToken != "":
+		return nil, errors.New("onepassword.serviceAccountToken cannot be used with onepassword.connectHost")
+	case connect:
+		return append(os.Environ(),
+			"OP_CONNECT_HOST="+oc.ConnectHost,
+			"OP_CONNECT_TOKEN="+oc.ConnectToken,
+		), nil
+	case oc.ServiceAccountToken != "":
+		return append(os.Environ(), "OP_SERVICE_ACCOUNT_TOKEN="+oc.ServiceAccountToken), nil
+	default:
+		return nil, nil
+	}
+}
+
+// onepasswordParseItemFields parses the output of op item get --format json
+// and returns its fields keyed by label. Fields in sections are in nested maps
+// keyed by the section's label. Fields without a label, or with the same label
+// as another field in the same section, are keyed by id instead and warnf is
+// called. Labels take priority over ids, so a field whose id is the label of
+// another field is ignored and warnf is called.
+func onepasswordParseItemFields(output []byte, warnf func(string, ...interface{})) (map[string]interface{}, error) {
+	var item onepasswordItem
+	if err := json.Unmarshal(output, &item); err != nil {
+		return nil, err
+	}
+
+	itemFields := make(map[string]interface{})
+	sections := make(map[string]map[string]interface{})
+	sectionFields := func(field map[string]interface{}) map[string]interface{} {
+		sectionLabel := onepasswordSectionLabel(field)
+		if sectionLabel == "" {
+			return itemFields
+		}
+		fields, ok := sections[sectionLabel]
+		if !ok {
+			if _, ok := itemFields[sectionLabel]; ok {
+				warnf("onepasswordItemFields: section %s replaces field with the same label", sectionLabel)
+			}
+			fields = make(map[string]interface{})
+			sections[sectionLabel] = fields
+			itemFields[sectionLabel] = fields
+		}
+		return fields
+	}
+
+	type sectionFieldLabel struct {
+		sectionLabel string
+		label        string
+	}
+	labelCounts := make(map[sectionFieldLabel]int)
+	for _, field := range item.Fields {
+		label, _ := field["label"].(string)
+		if label == "" {
+			continue
+		}
+		key := sectionFieldLabel{
+			sectionLabel: onepasswordSectionLabel(field),
+			label:        label,
+		}
+		labelCounts[key]++
+		if labelCounts[key] == 2 {
+			warnf("onepasswordItemFields: duplicate field label %s, using field ids", label)
+		}
+	}
+
+	// Add fields by label before fields by id so that labels take priority.
+	var idFields []map[string]interface{}
+	for _, field := range item.Fields {
+		label, _ := field["label"].(string)
+		if label == "" || labelCounts[sectionFieldLabel{
+			sectionLabel: onepasswordSectionLabel(field),
+			label:        label,
+		}] > 1 {
+			idFields = append(idFields, field)
+			continue
+		}
+		sectionFields(field)[label] = field
+	}
+	for _, field := range idFields {
+		id, _ := field["id"].(string)
+		if id == "" {
+			continue
+		}
+		fields := sectionFields(field)
+		if _, ok := fields[id]; ok {
+			warnf("onepasswordItemFields: field id %s is the label of another field, ignoring field", id)
+			continue
+		}
+		fields[id] = field
+	}
+	return itemFields, nil
+}
+
+// onepasswordSectionLabel returns the label of the section that field is in,
+// or the empty string if field is not in a section.
+func onepasswordSectionLabel(field map[string]interface{}) string {
+	section, ok := field["section"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	sectionLabel, _ := section["label"].(string)
+	return sectionLabel
 }
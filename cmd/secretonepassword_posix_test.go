@@ -0,0 +1,42 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+func TestOnepasswordDocumentFuncServiceAccount(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	command := filepath.Join(tempDir, "op")
+	require.NoError(t, ioutil.WriteFile(command, []byte(""+
+		"#!/bin/sh\n"+
+		"echo \"$OP_SERVICE_ACCOUNT_TOKEN $@\" >> "+filepath.Join(tempDir, "calls")+"\n"+
+		"printf -- '-----BEGIN CERTIFICATE-----\\n'\n",
+	), 0o755))
+
+	c := newConfig(withMutator(chezmoi.NullMutator{}))
+	c.Onepassword = onepasswordCmdConfig{
+		Command:             command,
+		ServiceAccountToken: "ops_token",
+	}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "-----BEGIN CERTIFICATE-----\n", c.onepasswordDocumentFunc("uuid"))
+	}
+	calls, err := ioutil.ReadFile(filepath.Join(tempDir, "calls"))
+	require.NoError(t, err)
+	assert.Equal(t, "ops_token get document uuid\n", string(calls))
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_onepasswordParseItemFields(t *testing.T) {
+	output := []byte(`{
+		"id": "uuid",
+		"title": "github",
+		"sections": [
+			{"id": "s1", "label": "Recovery"}
+		],
+		"fields": [
+			{"id": "username", "type": "STRING", "label": "username", "value": "user"},
+			{"id": "credential", "type": "CONCEALED", "label": "credential", "value": "old"},
+			{"id": "abc123", "type": "CONCEALED", "label": "credential", "value": "new"},
+			{"id": "def456", "section": {"id": "s1", "label": "Recovery"}, "type": "STRING", "label": "code", "value": "1234"},
+			{"id": "notesPlain", "type": "STRING", "purpose": "NOTES", "label": ""}
+		]
+	}`)
+	var warnings []string
+	warnf := func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+	itemFields, err := onepasswordParseItemFields(output, warnf)
+	require.NoError(t, err)
+
+	usernameField := map[string]interface{}{"id": "username", "type": "STRING", "label": "username", "value": "user"}
+	oldCredentialField := map[string]interface{}{"id": "credential", "type": "CONCEALED", "label": "credential", "value": "old"}
+	newCredentialField := map[string]interface{}{"id": "abc123", "type": "CONCEALED", "label": "credential", "value": "new"}
+	codeField := map[string]interface{}{
+		"id": "def456",
+		"section": map[string]interface{}{
+			"id":    "s1",
+			"label": "Recovery",
+		},
+		"type":  "STRING",
+		"label": "code",
+		"value": "1234",
+	}
+	assert.Equal(t, map[string]interface{}{
+		"username":   usernameField,
+		"credential": oldCredentialField,
+		"abc123":     newCredentialField,
+		"notesPlain": map[string]interface{}{"id": "notesPlain", "type": "STRING", "purpose": "NOTES", "label": ""},
+		"Recovery": map[string]interface{}{
+			"code": codeField,
+		},
+	}, itemFields)
+	assert.Equal(t, []string{
+		"onepasswordItemFields: duplicate field label credential, using field ids",
+	}, warnings)
+}
+
+func Test_onepasswordCmdConfigEnv(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		oc          onepasswordCmdConfig
+		expectedEnv []string
+		expectedErr bool
+	}{
+		{
+			name: "interactive",
+		},
+		{
+			name: "service_account",
+			oc: onepasswordCmdConfig{
+				ServiceAccountToken: "ops_token",
+			},
+			expectedEnv: []string{"OP_SERVICE_ACCOUNT_TOKEN=ops_token"},
+		},
+		{
+			name: "connect",
+			oc: onepasswordCmdConfig{
+				ConnectHost:  "https://connect.example.com",
+				ConnectToken: "connect_token",
+			},
+			expectedEnv: []string{"OP_CONNECT_HOST=https://connect.example.com", "OP_CONNECT_TOKEN=connect_token"},
+		},
+		{
+			name: "connect_without_token",
+			oc: onepasswordCmdConfig{
+				ConnectHost: "https://connect.example.com",
+			},
+			expectedErr: true,
+		},
+		{
+			name: "connect_and_service_account",
+			oc: onepasswordCmdConfig{
+				ServiceAccountToken: "ops_token",
+				ConnectHost:         "https://connect.example.com",
+				ConnectToken:        "connect_token",
+			},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env, err := tc.oc.env()
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tc.expectedEnv == nil {
+				assert.Nil(t, env)
+				return
+			}
+			assert.Equal(t, tc.expectedEnv, env[len(env)-len(tc.expectedEnv):])
+		})
+	}
+}
@@ -27,18 +27,25 @@ func init() {
 	secretCmd.AddCommand(passCmd)
 
 	config.Pass.Command = "pass"
-	config.addTemplateFunc("pass", config.passFunc)
+	config.addSecretTemplateFunc("pass", config.passFunc)
 }
 
 func (c *Config) runSecretPassCmd(cmd *cobra.Command, args []string) error {
-	return c.run("", c.Pass.Command, args...)
+	name, err := getSecretCommandPath("pass.command", c.Pass.Command)
+	if err != nil {
+		return err
+	}
+	return c.run("", name, args...)
 }
 
 func (c *Config) passFunc(id string) string {
 	if s, ok := passCache[id]; ok {
 		return s
 	}
-	name := c.Pass.Command
+	name, err := getSecretCommandPath("pass.command", c.Pass.Command)
+	if err != nil {
+		panic(fmt.Errorf("pass: %w", err))
+	}
 	args := []string{"show", id}
 	cmd := exec.Command(name, args...)
 	output, err := c.mutator.IdempotentCmdOutput(cmd)
@@ -26,20 +26,27 @@ var vaultCache = make(map[string]interface{})
 
 func init() {
 	config.Vault.Command = "vault"
-	config.addTemplateFunc("vault", config.vaultFunc)
+	config.addSecretTemplateFunc("vault", config.vaultFunc)
 
 	secretCmd.AddCommand(vaultCmd)
 }
 
 func (c *Config) runVaultCmd(cmd *cobra.Command, args []string) error {
-	return c.run("", c.Vault.Command, args...)
+	name, err := getSecretCommandPath("vault.command", c.Vault.Command)
+	if err != nil {
+		return err
+	}
+	return c.run("", name, args...)
 }
 
 func (c *Config) vaultFunc(key string) interface{} {
 	if data, ok := vaultCache[key]; ok {
 		return data
 	}
-	name := c.Vault.Command
+	name, err := getSecretCommandPath("vault.command", c.Vault.Command)
+	if err != nil {
+		panic(fmt.Errorf("vault: %w", err))
+	}
 	args := []string{"kv", "get", "-format=json", key}
 	cmd := exec.Command(name, args...)
 	cmd.Stdin = os.Stdin
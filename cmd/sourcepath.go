@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"path/filepath"
 
 	"github.com/spf13/cobra"
 )
@@ -18,8 +17,6 @@ var sourcePathCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(sourcePathCmd)
-
-	markRemainingZshCompPositionalArgumentsAsFiles(sourcePathCmd, 1)
 }
 
 func (c *Config) runSourcePathCmd(cmd *cobra.Command, args []string) error {
@@ -36,7 +33,7 @@ func (c *Config) runSourcePathCmd(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	for _, entry := range entries {
-		if _, err := fmt.Println(filepath.Join(ts.SourceDir, entry.SourceName())); err != nil {
+		if _, err := fmt.Println(ts.SourcePath(entry)); err != nil {
 			return err
 		}
 	}
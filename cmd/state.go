@@ -0,0 +1,299 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+var stateCmd = &cobra.Command{
+	Use:     "state",
+	Args:    cobra.NoArgs,
+	Short:   "Manipulate the persistent state",
+	Long:    mustGetLongHelp("state"),
+	Example: getExample("state"),
+}
+
+var stateDeleteBucketCmd = &cobra.Command{
+	Use:     "delete-bucket",
+	Args:    cobra.NoArgs,
+	Short:   "Delete a bucket from the persistent state",
+	PreRunE: config.ensureNoError,
+	RunE:    config.runStateDeleteBucketCmd,
+}
+
+var stateDumpCmd = &cobra.Command{
+	Use:     "dump",
+	Args:    cobra.NoArgs,
+	Short:   "Write a dump of the persistent state to stdout",
+	PreRunE: config.ensureNoError,
+	RunE:    config.runStateDumpCmd,
+}
+
+var stateOrphansCmd = &cobra.Command{
+	Use:     "orphans",
+	Args:    cobra.NoArgs,
+	Short:   "List script states that do not correspond to any script",
+	PreRunE: config.ensureNoError,
+	RunE:    config.runStateOrphansCmd,
+}
+
+var statePruneCmd = &cobra.Command{
+	Use:     "prune",
+	Args:    cobra.NoArgs,
+	Short:   "Remove script states that do not correspond to any script",
+	PreRunE: config.ensureNoError,
+	RunE:    config.runStatePruneCmd,
+}
+
+var stateResetCmd = &cobra.Command{
+	Use:     "reset",
+	Args:    cobra.NoArgs,
+	Short:   "Remove the persistent state",
+	PreRunE: config.ensureNoError,
+	RunE:    config.runStateResetCmd,
+}
+
+var stateRevokeTrustCmd = &cobra.Command{
+	Use:     "revoke-trust repo...",
+	Args:    cobra.MinimumNArgs(1),
+	Short:   "Revoke trust in repos",
+	PreRunE: config.ensureNoError,
+	RunE:    config.runStateRevokeTrustCmd,
+}
+
+type stateCmdConfig struct {
+	bucket string
+	force  bool
+	format string
+}
+
+type scriptStateDumpValue struct {
+	Name           string    `json:"name" yaml:"name"`
+	ExecutedAt     time.Time `json:"executedAt" yaml:"executedAt"`
+	Version        string    `json:"version,omitempty" yaml:"version,omitempty"`
+	ExitStatus     int       `json:"exitStatus" yaml:"exitStatus"`
+	Duration       string    `json:"duration" yaml:"duration"`
+	ContentsSHA256 string    `json:"contentsSHA256,omitempty" yaml:"contentsSHA256,omitempty"`
+}
+
+func init() {
+	rootCmd.AddCommand(stateCmd)
+
+	persistentFlags := stateCmd.PersistentFlags()
+	persistentFlags.StringVarP(&config.state.bucket, "bucket", "b", string(config.scriptStateBucket), "bucket")
+
+	stateCmd.AddCommand(stateDeleteBucketCmd)
+
+	stateCmd.AddCommand(stateDumpCmd)
+
+	stateDumpPersistentFlags := stateDumpCmd.PersistentFlags()
+	stateDumpPersistentFlags.StringVarP(&config.state.format, "format", "f", "json", "format (JSON, TOML, or YAML)")
+	panicOnError(stateDumpCmd.RegisterFlagCompletionFunc("format", completeWords(formats())))
+
+	stateCmd.AddCommand(stateOrphansCmd)
+
+	stateCmd.AddCommand(statePruneCmd)
+
+	statePrunePersistentFlags := statePruneCmd.PersistentFlags()
+	statePrunePersistentFlags.BoolVarP(&config.state.force, "force", "f", false, "remove without prompting")
+
+	stateCmd.AddCommand(stateResetCmd)
+
+	stateResetPersistentFlags := stateResetCmd.PersistentFlags()
+	stateResetPersistentFlags.BoolVarP(&config.state.force, "force", "f", false, "remove without prompting")
+
+	stateCmd.AddCommand(stateRevokeTrustCmd)
+}
+
+func (c *Config) runStateDeleteBucketCmd(cmd *cobra.Command, args []string) error {
+	persistentState, err := c.getPersistentState(nil)
+	if err != nil {
+		return err
+	}
+	defer persistentState.Close()
+
+	if c.DryRun {
+		return nil
+	}
+	return persistentState.DeleteBucket([]byte(c.state.bucket))
+}
+
+func (c *Config) runStateDumpCmd(cmd *cobra.Command, args []string) error {
+	format, ok := formatMap[strings.ToLower(c.state.format)]
+	if !ok {
+		return fmt.Errorf("%s: unknown format", c.state.format)
+	}
+	persistentState, err := c.getPersistentState(&bolt.Options{
+		ReadOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer persistentState.Close()
+
+	bucket := []byte(c.state.bucket)
+	dump := make(map[string]interface{})
+	if err := persistentState.ForEach(bucket, func(k, v []byte) error {
+		dump[string(k)] = c.stateDumpValue(bucket, v)
+		return nil
+	}); err != nil {
+		return err
+	}
+	return format(c.Stdout, dump)
+}
+
+func (c *Config) runStateOrphansCmd(cmd *cobra.Command, args []string) error {
+	persistentState, err := c.getPersistentState(&bolt.Options{
+		ReadOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer persistentState.Close()
+
+	orphanedKeys, err := c.getOrphanedScriptStateKeys(persistentState)
+	if err != nil {
+		return err
+	}
+	for _, key := range orphanedKeys {
+		fmt.Fprintln(c.Stdout, key)
+	}
+	return nil
+}
+
+func (c *Config) runStatePruneCmd(cmd *cobra.Command, args []string) error {
+	persistentState, err := c.getPersistentState(nil)
+	if err != nil {
+		return err
+	}
+	defer persistentState.Close()
+
+	orphanedKeys, err := c.getOrphanedScriptStateKeys(persistentState)
+	if err != nil {
+		return err
+	}
+	if len(orphanedKeys) == 0 {
+		return nil
+	}
+	if c.DryRun {
+		for _, key := range orphanedKeys {
+			fmt.Fprintf(c.Stdout, "would remove %s\n", key)
+		}
+		return nil
+	}
+	if !c.state.force {
+		choice, err := c.prompt(fmt.Sprintf("Remove %d orphaned script states", len(orphanedKeys)), "yn", 0)
+		if err != nil {
+			return err
+		}
+		if choice != 'y' {
+			return nil
+		}
+	}
+	for _, key := range orphanedKeys {
+		if c.Verbose {
+			fmt.Fprintf(c.Stdout, "remove %s\n", key)
+		}
+		if err := persistentState.Delete(c.scriptStateBucket, []byte(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getOrphanedScriptStateKeys returns the sorted keys in the script state bucket
+// of persistentState that do not correspond to any script in the target state.
+// Keys are matched using the target names that the script runner records, so
+// scripts with templated names are matched after their names are evaluated.
+func (c *Config) getOrphanedScriptStateKeys(persistentState chezmoi.PersistentState) ([]string, error) {
+	ts, err := c.getTargetState(nil)
+	if err != nil {
+		return nil, err
+	}
+	scriptTargetNames := make(map[string]struct{})
+	findScript(ts.Entries, func(script *chezmoi.Script) bool {
+		scriptTargetNames[script.TargetName()] = struct{}{}
+		return false
+	})
+
+	var orphanedKeys []string
+	if err := persistentState.ForEach(c.scriptStateBucket, func(k, v []byte) error {
+		if targetName, ok := chezmoi.ScriptStateKeyTargetName(k); ok {
+			if _, ok := scriptTargetNames[targetName]; ok {
+				return nil
+			}
+		}
+		orphanedKeys = append(orphanedKeys, string(k))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Strings(orphanedKeys)
+	return orphanedKeys, nil
+}
+
+func (c *Config) runStateResetCmd(cmd *cobra.Command, args []string) error {
+	persistentStateFile := c.getPersistentStateFile()
+	switch _, err := c.fs.Stat(persistentStateFile); {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return err
+	}
+	if !c.state.force {
+		choice, err := c.prompt(fmt.Sprintf("Remove %s", persistentStateFile), "yn", 0)
+		if err != nil {
+			return err
+		}
+		if choice != 'y' {
+			return nil
+		}
+	}
+	return c.mutator.RemoveAll(persistentStateFile)
+}
+
+func (c *Config) runStateRevokeTrustCmd(cmd *cobra.Command, args []string) error {
+	persistentState, err := c.getPersistentState(nil)
+	if err != nil {
+		return err
+	}
+	defer persistentState.Close()
+
+	for _, repo := range args {
+		if err := c.setRepoTrust(repo, false, persistentState); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stateDumpValue returns a human-readable representation of value in bucket.
+func (c *Config) stateDumpValue(bucket, value []byte) interface{} {
+	if string(bucket) == string(c.scriptStateBucket) {
+		var scriptState chezmoi.ScriptState
+		if err := json.Unmarshal(value, &scriptState); err == nil {
+			return &scriptStateDumpValue{
+				Name:           scriptState.Name,
+				ExecutedAt:     scriptState.ExecutedAt,
+				Version:        scriptState.Version,
+				ExitStatus:     scriptState.ExitStatus,
+				Duration:       scriptState.Duration.String(),
+				ContentsSHA256: scriptState.ContentsSHA256,
+			}
+		}
+	}
+	var jsonValue interface{}
+	if err := json.Unmarshal(value, &jsonValue); err == nil {
+		return jsonValue
+	}
+	return string(value)
+}
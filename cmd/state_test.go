@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+func TestStateOrphansAndPrune(t *testing.T) {
+	contents := "#!/bin/sh\n"
+	contentsSHA256 := sha256.Sum256([]byte(contents))
+	oldContentsSHA256 := sha256.Sum256([]byte("#!/bin/sh\necho old\n"))
+	currentKey := "dir/install.sh:" + hex.EncodeToString(contentsSHA256[:])
+	oldVersionKey := "dir/install.sh:" + hex.EncodeToString(oldContentsSHA256[:])
+	orphanedKey := "dir/removed.sh:" + hex.EncodeToString(contentsSHA256[:])
+	invalidKey := "invalid"
+	allKeys := []string{currentKey, invalidKey, oldVersionKey, orphanedKey}
+	sort.Strings(allKeys)
+
+	for _, tc := range []struct {
+		name       string
+		dryRun     bool
+		force      bool
+		stdin      string
+		wantStdout string
+		wantKeys   []string
+	}{
+		{
+			name:       "dry_run",
+			dryRun:     true,
+			wantStdout: "would remove " + orphanedKey + "\nwould remove " + invalidKey + "\n",
+			wantKeys:   allKeys,
+		},
+		{
+			name:       "force",
+			force:      true,
+			wantStdout: "remove " + orphanedKey + "\nremove " + invalidKey + "\n",
+			wantKeys:   []string{currentKey, oldVersionKey},
+		},
+		{
+			name:     "prompt_no",
+			stdin:    "n\n",
+			wantKeys: allKeys,
+		},
+		{
+			name:       "prompt_yes",
+			stdin:      "y\n",
+			wantStdout: "remove " + orphanedKey + "\nremove " + invalidKey + "\n",
+			wantKeys:   []string{currentKey, oldVersionKey},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+				"/home/user/.config/chezmoi":                              &vfst.Dir{Perm: 0o755},
+				"/home/user/.local/share/chezmoi/dir/run_once_install.sh": contents,
+			})
+			require.NoError(t, err)
+			defer cleanup()
+
+			persistentStateFile := "/home/user/.local/state/chezmoi/chezmoistate.boltdb"
+			persistentState, err := chezmoi.NewBoltPersistentState(fs, persistentStateFile, vfst.DefaultUmask, nil)
+			require.NoError(t, err)
+			for _, key := range allKeys {
+				require.NoError(t, persistentState.Set([]byte("script"), []byte(key), []byte("{}")))
+			}
+			require.NoError(t, persistentState.Close())
+
+			stdout := &bytes.Buffer{}
+			c := newTestConfig(fs, withStdout(stdout))
+			require.NoError(t, c.runStateOrphansCmd(nil, nil))
+			assert.Equal(t, orphanedKey+"\n"+invalidKey+"\n", stdout.String())
+
+			stdout.Reset()
+			c = newTestConfig(fs, withDryRun(tc.dryRun), withStdin(strings.NewReader(tc.stdin)), withStdout(stdout))
+			c.state.force = tc.force
+			require.NoError(t, c.runStatePruneCmd(nil, nil))
+			assert.Equal(t, tc.wantStdout, stdout.String())
+
+			persistentState, err = chezmoi.NewBoltPersistentState(fs, persistentStateFile, vfst.DefaultUmask, nil)
+			require.NoError(t, err)
+			defer persistentState.Close()
+			var gotKeys []string
+			require.NoError(t, persistentState.ForEach([]byte("script"), func(k, v []byte) error {
+				gotKeys = append(gotKeys, string(k))
+				return nil
+			}))
+			sort.Strings(tc.wantKeys)
+			assert.Equal(t, tc.wantKeys, gotKeys)
+		})
+	}
+}
+
+func TestStateDeleteBucketAndReset(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	persistentStateFile := "/home/user/.local/state/chezmoi/chezmoistate.boltdb"
+	persistentState, err := chezmoi.NewBoltPersistentState(fs, persistentStateFile, vfst.DefaultUmask, nil)
+	require.NoError(t, err)
+	require.NoError(t, persistentState.Set([]byte("script"), []byte("key"), []byte("{}")))
+	require.NoError(t, persistentState.Set([]byte("trust"), []byte("key"), []byte("{}")))
+	require.NoError(t, persistentState.Close())
+
+	get := func(bucket string) []byte {
+		persistentState, err := chezmoi.NewBoltPersistentState(fs, persistentStateFile, vfst.DefaultUmask, nil)
+		require.NoError(t, err)
+		defer persistentState.Close()
+		value, err := persistentState.Get([]byte(bucket), []byte("key"))
+		require.NoError(t, err)
+		return value
+	}
+
+	c := newTestConfig(fs, withDryRun(true))
+	c.state.bucket = "script"
+	require.NoError(t, c.runStateDeleteBucketCmd(nil, nil))
+	assert.Equal(t, []byte("{}"), get("script"))
+
+	c = newTestConfig(fs)
+	c.state.bucket = "script"
+	require.NoError(t, c.runStateDeleteBucketCmd(nil, nil))
+	assert.Nil(t, get("script"))
+	assert.Equal(t, []byte("{}"), get("trust"))
+
+	c = newTestConfig(fs, withStdin(strings.NewReader("n\n")))
+	require.NoError(t, c.runStateResetCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath(persistentStateFile,
+			vfst.TestModeIsRegular,
+		),
+	)
+
+	c = newTestConfig(fs, withStdin(strings.NewReader("y\n")))
+	require.NoError(t, c.runStateResetCmd(nil, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath(persistentStateFile,
+			vfst.TestDoesNotExist,
+		),
+	)
+
+	c = newTestConfig(fs)
+	c.state.force = true
+	require.NoError(t, c.runStateResetCmd(nil, nil))
+}
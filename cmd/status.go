@@ -0,0 +1,350 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	vfs "github.com/twpayne/go-vfs"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+var statusCmd = &cobra.Command{
+	Use:     "status [targets...]",
+	Short:   "Show the status of targets",
+	Long:    mustGetLongHelp("status"),
+	Example: getExample("status"),
+	PreRunE: config.ensureNoError,
+	RunE:    config.runStatusCmd,
+}
+
+type statusCmdConfig struct {
+	sourceDrift bool
+}
+
+// A destState is the state of a target in the destination directory, recorded
+// when it is applied so that later changes to it can be detected.
+type destState struct {
+	Mode           os.FileMode `json:"mode"`
+	ContentsSHA256 string      `json:"contentsSHA256,omitempty"`
+	Linkname       string      `json:"linkname,omitempty"`
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	persistentFlags := statusCmd.PersistentFlags()
+	persistentFlags.BoolVar(&config.status.sourceDrift, "source-drift", false, "show the last applied commit of the source directory")
+}
+
+func (c *Config) runStatusCmd(cmd *cobra.Command, args []string) error {
+	if c.status.sourceDrift {
+		return c.runStatusSourceDrift()
+	}
+
+	ts, err := c.getTargetState(nil)
+	if err != nil {
+		return err
+	}
+
+	persistentState, err := c.getPersistentState(&bolt.Options{
+		ReadOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer persistentState.Close()
+
+	entries := ts.Entries
+	if len(args) != 0 {
+		argEntries, err := c.getEntries(ts, args)
+		if err != nil {
+			return err
+		}
+		entries = make(map[string]chezmoi.Entry, len(argEntries))
+		for _, entry := range argEntries {
+			entries[entry.TargetName()] = entry
+		}
+	}
+
+	statuses := make(map[string][]byte)
+	if err := c.addTargetStatuses(ts, entries, persistentState, statuses); err != nil {
+		return err
+	}
+	if err := c.addScriptStatuses(ts, entries, persistentState, statuses); err != nil {
+		return err
+	}
+
+	targetNames := make([]string, 0, len(statuses))
+	for targetName := range statuses {
+		targetNames = append(targetNames, targetName)
+	}
+	sort.Strings(targetNames)
+	pending := false
+	for _, targetName := range targetNames {
+		xy := statuses[targetName]
+		if xy[1] != ' ' {
+			pending = true
+		}
+		fmt.Fprintf(c.Stdout, "%s %s\n", xy, targetName)
+	}
+	if pending {
+		return exitCodeError(1)
+	}
+	return nil
+}
+
+// runStatusSourceDrift prints the commit of the source directory that was last
+// applied, whether the source directory had uncommitted changes when it was
+// applied, and the current commit of the source directory. It exits with
+// status 1 if they differ.
+func (c *Config) runStatusSourceDrift() error {
+	appliedSource, err := c.getAppliedSource()
+	if err != nil {
+		return err
+	}
+	head, dirty, err := c.getSourceHead()
+	if err != nil {
+		return err
+	}
+	if head == "" {
+		return fmt.Errorf("%s: not a %s working copy", c.SourceDir, c.SourceVCS.Command)
+	}
+	drift := true
+	if appliedSource == nil {
+		fmt.Fprintf(c.Stdout, "applied: never\n")
+	} else {
+		dirtyStr := ""
+		if appliedSource.Dirty {
+			dirtyStr = " (dirty)"
+		}
+		fmt.Fprintf(c.Stdout, "applied: %s%s at %s\n", appliedSource.Commit, dirtyStr, appliedSource.Time.Format(time.RFC3339))
+		drift = appliedSource.Commit != head || appliedSource.Dirty || dirty
+	}
+	dirtyStr := ""
+	if dirty {
+		dirtyStr = " (dirty)"
+	}
+	fmt.Fprintf(c.Stdout, "head:    %s%s\n", head, dirtyStr)
+	if drift {
+		return exitCodeError(1)
+	}
+	return nil
+}
+
+// addTargetStatuses adds the status of each target in entries, except
+// scripts, to statuses. The first status character is M if the target has
+// been modified since it was last applied and D if it has been deleted. The
+// second status character is A, M, or D if applying the target would add,
+// modify, or delete it.
+func (c *Config) addTargetStatuses(ts *chezmoi.TargetState, entries map[string]chezmoi.Entry, persistentState chezmoi.PersistentState, statuses map[string][]byte) error {
+	fs := vfs.NewReadOnlyFS(c.fs)
+	statusMutator := chezmoi.NewStatusMutator(chezmoi.NullMutator{}, fs)
+	applyOptions := &chezmoi.ApplyOptions{
+		DestDir:         ts.DestDir,
+		DryRun:          true,
+		Ignore:          ts.TargetIgnore.Match,
+		PersistentState: persistentState,
+		Stdout:          ioutil.Discard,
+		Umask:           ts.Umask,
+	}
+	var allEntries []chezmoi.Entry
+	for _, entry := range entries {
+		if err := chezmoi.ApplyEntry(entry, fs, statusMutator, c.Follow, applyOptions); err != nil {
+			return err
+		}
+		allEntries = entry.AppendAllEntries(allEntries)
+	}
+	for targetPath, status := range statusMutator.Statuses() {
+		targetName, err := filepath.Rel(ts.DestDir, targetPath)
+		if err != nil {
+			return err
+		}
+		statuses[targetName] = []byte{' ', status}
+	}
+
+	for _, entry := range allEntries {
+		targetName := entry.TargetName()
+		if ts.TargetIgnore.Match(targetName) {
+			continue
+		}
+		modified, err := c.getDestModified(filepath.Join(ts.DestDir, targetName), persistentState)
+		if err != nil {
+			return err
+		}
+		if modified == ' ' {
+			continue
+		}
+		xy, ok := statuses[targetName]
+		if !ok {
+			xy = []byte{' ', ' '}
+			statuses[targetName] = xy
+		}
+		xy[0] = modified
+	}
+	return nil
+}
+
+// addScriptStatuses adds the status of all scripts in entries to statuses. The
+// first status character is M if a run_once_ script has been modified since it
+// was last successfully run. The second status character is R if the script
+// will be run.
+func (c *Config) addScriptStatuses(ts *chezmoi.TargetState, entries map[string]chezmoi.Entry, persistentState chezmoi.PersistentState, statuses map[string][]byte) error {
+	for _, entry := range entries {
+		if ts.TargetIgnore.Match(entry.TargetName()) {
+			continue
+		}
+		switch entry := entry.(type) {
+		case *chezmoi.Dir:
+			if err := c.addScriptStatuses(ts, entry.Entries, persistentState, statuses); err != nil {
+				return err
+			}
+		case *chezmoi.Script:
+			status, err := entry.Status(persistentState, c.scriptStateBucket)
+			if err != nil {
+				return err
+			}
+			switch status {
+			case chezmoi.ScriptStatusUpToDate:
+			case chezmoi.ScriptStatusChanged:
+				statuses[entry.TargetName()] = []byte("MR")
+			default:
+				statuses[entry.TargetName()] = []byte(" R")
+			}
+		}
+	}
+	return nil
+}
+
+// getDestModified returns M if the target at targetPath has been modified
+// since it was last applied, D if it has been deleted, and a space otherwise.
+func (c *Config) getDestModified(targetPath string, persistentState chezmoi.PersistentState) (byte, error) {
+	data, err := persistentState.Get(c.destStateBucket, []byte(targetPath))
+	if err != nil || data == nil {
+		return ' ', err
+	}
+	var appliedState destState
+	if err := json.Unmarshal(data, &appliedState); err != nil {
+		return ' ', nil
+	}
+	state, err := c.getDestState(targetPath)
+	switch {
+	case err != nil:
+		return ' ', err
+	case state == nil:
+		return chezmoi.StatusDeleted, nil
+	case *state != appliedState:
+		return chezmoi.StatusModified, nil
+	default:
+		return ' ', nil
+	}
+}
+
+// getDestState returns the state of the target at targetPath, or nil if it
+// does not exist.
+func (c *Config) getDestState(targetPath string) (*destState, error) {
+	info, err := c.fs.Lstat(targetPath)
+	switch {
+	case os.IsNotExist(err):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	state := &destState{
+		Mode: info.Mode(),
+	}
+	switch {
+	case info.Mode().IsRegular():
+		// Files are hashed in chunks so that large files are not read into
+		// memory.
+		contentsSHA256, err := chezmoi.HashFile(c.fs, targetPath)
+		if err != nil {
+			return nil, err
+		}
+		state.ContentsSHA256 = hex.EncodeToString(contentsSHA256)
+	case info.Mode()&os.ModeType == os.ModeSymlink:
+		state.Linkname, err = c.fs.Readlink(targetPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+// recordDestStates records the state of the targets of entries, or of all
+// entries in ts if entries is empty, in persistentState, except for scripts and
+// ignored targets. The contents of files in appliedTargetNames are already
+// known, so their targets are not read again. All states are recorded in a
+// single update.
+func (c *Config) recordDestStates(ts *chezmoi.TargetState, entries []chezmoi.Entry, appliedTargetNames map[string]struct{}, persistentState chezmoi.PersistentState) error {
+	var allEntries []chezmoi.Entry
+	if len(entries) == 0 {
+		allEntries = ts.AllEntries()
+	} else {
+		for _, entry := range entries {
+			allEntries = entry.AppendAllEntries(allEntries)
+		}
+	}
+	values := make(map[string][]byte, len(allEntries))
+	for _, entry := range allEntries {
+		targetName := entry.TargetName()
+		if _, ok := entry.(*chezmoi.Script); ok || ts.TargetIgnore.Match(targetName) {
+			continue
+		}
+		targetPath := filepath.Join(ts.DestDir, targetName)
+		state, err := c.getAppliedDestState(entry, targetPath, appliedTargetNames)
+		if err != nil {
+			return err
+		}
+		if state == nil {
+			values[targetPath] = nil
+			continue
+		}
+		data, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		values[targetPath] = data
+	}
+	return persistentState.Update(c.destStateBucket, values)
+}
+
+// getAppliedDestState returns the state of the target of entry at targetPath,
+// like getDestState, but without reading the target if entry is a file in
+// appliedTargetNames whose applied contents are known.
+func (c *Config) getAppliedDestState(entry chezmoi.Entry, targetPath string, appliedTargetNames map[string]struct{}) (*destState, error) {
+	file, ok := entry.(*chezmoi.File)
+	if !ok {
+		return c.getDestState(targetPath)
+	}
+	if _, ok := appliedTargetNames[file.TargetName()]; !ok {
+		return c.getDestState(targetPath)
+	}
+	contents, ok := file.AppliedContents()
+	if !ok {
+		return c.getDestState(targetPath)
+	}
+	info, err := c.fs.Lstat(targetPath)
+	switch {
+	case os.IsNotExist(err):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	case !info.Mode().IsRegular():
+		return c.getDestState(targetPath)
+	}
+	contentsSHA256 := sha256.Sum256(contents)
+	return &destState{
+		Mode:           info.Mode(),
+		ContentsSHA256: hex.EncodeToString(contentsSHA256[:]),
+	}, nil
+}
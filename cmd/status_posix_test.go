@@ -0,0 +1,95 @@
+// +build !windows
+
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+func TestStatus(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".local/share/chezmoi": map[string]interface{}{
+				"dot_a": "a\n",
+				"dot_b": "b\n",
+				"dot_d": "d\n",
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	c := newTestConfig(fs)
+	require.NoError(t, c.runApplyCmd(nil, nil))
+
+	stdout := &strings.Builder{}
+	c = newTestConfig(fs, withStdout(stdout))
+	require.NoError(t, c.runStatusCmd(nil, nil))
+	assert.Equal(t, "", stdout.String())
+
+	require.NoError(t, fs.WriteFile("/home/user/.a", []byte("local\n"), 0o644))
+	require.NoError(t, fs.Remove("/home/user/.b"))
+	require.NoError(t, fs.Chmod("/home/user/.d", 0o600))
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/dot_c", []byte("c\n"), 0o644))
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/dot_d", []byte("new\n"), 0o644))
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/run_foo", []byte("#!/bin/sh\n"), 0o755))
+
+	stdout.Reset()
+	assert.Equal(t, exitCodeError(1), c.runStatusCmd(nil, nil))
+	assert.Equal(t, strings.Join([]string{
+		"MM .a",
+		"DA .b",
+		" A .c",
+		"MM .d",
+		" R foo",
+	}, "\n")+"\n", stdout.String())
+
+	stdout.Reset()
+	assert.Equal(t, exitCodeError(1), c.runStatusCmd(nil, []string{"/home/user/.b"}))
+	assert.Equal(t, "DA .b\n", stdout.String())
+
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/dot_a", []byte("local\n"), 0o644))
+	stdout.Reset()
+	require.NoError(t, c.runStatusCmd(nil, []string{"/home/user/.a"}))
+	assert.Equal(t, "M  .a\n", stdout.String())
+}
+
+func TestStatusLargeFile(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": &vfst.Dir{Perm: 0o700},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	// The file is sparse, so it is large without using disk space.
+	f, err := fs.OpenFile("/home/user/.local/share/chezmoi/dot_large", os.O_WRONLY|os.O_CREATE, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("end\n"), chezmoi.DefaultLargeFileSize)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	c := newTestConfig(fs)
+	require.NoError(t, c.runApplyCmd(nil, nil))
+
+	stdout := &strings.Builder{}
+	c = newTestConfig(fs, withStdout(stdout))
+	require.NoError(t, c.runStatusCmd(nil, nil))
+	assert.Equal(t, "", stdout.String())
+
+	f, err = fs.OpenFile("/home/user/.large", os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("END\n"), chezmoi.DefaultLargeFileSize)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	stdout.Reset()
+	assert.Equal(t, exitCodeError(1), c.runStatusCmd(nil, nil))
+	assert.Equal(t, "MM .large\n", stdout.String())
+}
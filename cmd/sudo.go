@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/pflag"
+	vfs "github.com/twpayne/go-vfs"
+	xdg "github.com/twpayne/go-xdg/v3"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+// A sudoUser is the user who ran chezmoi as root with sudo.
+type sudoUser struct {
+	username string
+	homeDir  string
+	uid      int
+	gid      int
+}
+
+// getEUID returns the effective user ID, or -1 if it is not known, as on
+// Windows.
+func (ul userLookup) getEUID() int {
+	if ul.geteuid == nil {
+		return -1
+	}
+	return ul.geteuid()
+}
+
+// getSudoUser returns the user who ran chezmoi with sudo, or nil if chezmoi is
+// not running as root or was not run with sudo.
+func (ul userLookup) getSudoUser() (*sudoUser, error) {
+	if ul.getEUID() != 0 {
+		return nil, nil
+	}
+	username := ul.getenv("SUDO_USER")
+	if username == "" || username == "root" {
+		return nil, nil
+	}
+	u, err := ul.lookupUser(username)
+	if err != nil {
+		return nil, fmt.Errorf("SUDO_USER %s: %w", username, err)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return nil, fmt.Errorf("SUDO_USER %s: invalid uid %q", username, u.Uid)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return nil, fmt.Errorf("SUDO_USER %s: invalid gid %q", username, u.Gid)
+	}
+	return &sudoUser{
+		username: username,
+		homeDir:  u.HomeDir,
+		uid:      uid,
+		gid:      gid,
+	}, nil
+}
+
+// useSudoUser records the user who ran chezmoi with sudo, if any. With
+// --allow-sudo, the config file, source directory, destination directory, and
+// state directory default to the invoking user's instead of root's.
+func (c *Config) useSudoUser(flags *pflag.FlagSet) error {
+	sudoUser, err := c.userLookup.getSudoUser()
+	if err != nil || sudoUser == nil {
+		return err
+	}
+	c.sudoUser = sudoUser
+	if !c.allowSudo {
+		return nil
+	}
+	c.homeDirErr = nil
+	c.bds = xdg.NewTestBaseDirectorySpecification(sudoUser.homeDir, c.userLookup.getenv)
+	c.stateHome = getStateHome(sudoUser.homeDir, c.userLookup.getenv)
+	if !flags.Changed("config") {
+		c.configFile = getDefaultConfigFile(c.bds)
+	}
+	if !flags.Changed("source") {
+		c.SourceDir = getDefaultSourceDir(c.bds)
+	}
+	if !flags.Changed("destination") {
+		c.DestDir = sudoUser.homeDir
+	}
+	return nil
+}
+
+// checkSudo returns an error if chezmoi was run with sudo without either
+// --allow-sudo or an explicit destination directory, as it would otherwise
+// use root's files and leave files owned by root behind.
+func (c *Config) checkSudo(flags *pflag.FlagSet) error {
+	if c.sudoUser == nil || c.allowSudo || flags.Changed("destination") {
+		return nil
+	}
+	return fmt.Errorf("running as root with sudo would use %s as the destination directory and create files owned by root, use --allow-sudo to use %s's files or run chezmoi without sudo", c.DestDir, c.sudoUser.username)
+}
+
+// giveToSudoUser returns a function that gives path, and any of its parent
+// directories that do not exist yet, to the user who ran chezmoi with
+// --allow-sudo once they have been created. Only paths inside the user's home
+// directory are given to them.
+func (c *Config) giveToSudoUser(path string) func() error {
+	if c.sudoUser == nil || !c.allowSudo {
+		return func() error {
+			return nil
+		}
+	}
+	var newPaths []string
+	for p := path; isInsideAny(p, []string{c.sudoUser.homeDir}); p = filepath.Dir(p) {
+		if _, err := c.fs.Lstat(p); err == nil {
+			break
+		}
+		newPaths = append(newPaths, p)
+	}
+	return func() error {
+		for _, p := range newPaths {
+			if err := c.fs.Lchown(p, c.sudoUser.uid, c.sudoUser.gid); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// rootOwned returns whether path is a regular file owned by root when chezmoi
+// is not running as root, for example because an earlier chezmoi was run with
+// sudo.
+func (c *Config) rootOwned(fs vfs.FS, path string) (os.FileInfo, bool, error) {
+	if c.userLookup.getEUID() <= 0 {
+		return nil, false, nil
+	}
+	info, err := fs.Lstat(path)
+	switch {
+	case os.IsNotExist(err):
+		return nil, false, nil
+	case err != nil:
+		return nil, false, err
+	case !info.Mode().IsRegular():
+		return nil, false, nil
+	}
+	if uid, _, ok := chezmoi.FileOwner(info); !ok || uid != 0 {
+		return nil, false, nil
+	}
+	return info, true, nil
+}
+
+// warnOwnership warns if the regular file at path is owned by root. It does
+// not change anything, so it is safe to call from every command.
+func (c *Config) warnOwnership(fs vfs.FS, path string) error {
+	if _, ok, err := c.rootOwned(fs, path); err != nil || !ok {
+		return err
+	}
+	fmt.Fprintf(c.Stderr, "warning: %s: owned by root, run sudo chown %d %s\n", path, c.userLookup.getEUID(), chezmoi.MaybeShellQuote(path))
+	return nil
+}
+
+// repairOwnership replaces the regular file at path with a copy owned by the
+// current user if it is owned by root, for example because an earlier chezmoi
+// was run with sudo. It does nothing when running as root.
+func (c *Config) repairOwnership(fs vfs.FS, path string) error {
+	info, ok, err := c.rootOwned(fs, path)
+	if err != nil || !ok {
+		return err
+	}
+	chownHint := fmt.Sprintf("run sudo chown %d %s", c.userLookup.getEUID(), chezmoi.MaybeShellQuote(path))
+	contents, err := fs.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%s: owned by root, %s: %w", path, chownHint, err)
+	}
+	tempPath := path + ".chezmoi-repair"
+	if err := fs.WriteFile(tempPath, contents, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("%s: owned by root, %s: %w", path, chownHint, err)
+	}
+	if err := fs.Rename(tempPath, path); err != nil {
+		_ = fs.Remove(tempPath)
+		return fmt.Errorf("%s: owned by root, %s: %w", path, chownHint, err)
+	}
+	fmt.Fprintf(c.Stderr, "warning: %s: was owned by root, replaced with a copy owned by you\n", path)
+	return nil
+}
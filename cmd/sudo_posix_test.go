@@ -0,0 +1,186 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+func newSudoUserLookup(euid int, env map[string]string) userLookup {
+	return userLookup{
+		getenv: func(key string) string {
+			return env[key]
+		},
+		geteuid: func() int {
+			return euid
+		},
+		lookupUser: func(username string) (*user.User, error) {
+			if username != "user" {
+				return nil, errors.New("unknown user")
+			}
+			return &user.User{
+				Uid:      "1000",
+				Gid:      "1000",
+				Username: "user",
+				HomeDir:  "/home/user",
+			}, nil
+		},
+	}
+}
+
+func TestGetSudoUser(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		euid             int
+		env              map[string]string
+		expectedSudoUser *sudoUser
+		expectedErr      bool
+	}{
+		{
+			name: "not_root",
+			euid: 1000,
+			env:  map[string]string{"SUDO_USER": "user"},
+		},
+		{
+			name: "root_without_sudo",
+			euid: 0,
+		},
+		{
+			name: "sudo_from_root",
+			euid: 0,
+			env:  map[string]string{"SUDO_USER": "root"},
+		},
+		{
+			name: "sudo",
+			euid: 0,
+			env:  map[string]string{"SUDO_USER": "user"},
+			expectedSudoUser: &sudoUser{
+				username: "user",
+				homeDir:  "/home/user",
+				uid:      1000,
+				gid:      1000,
+			},
+		},
+		{
+			name:        "unknown_user",
+			euid:        0,
+			env:         map[string]string{"SUDO_USER": "unknown"},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actualSudoUser, err := newSudoUserLookup(tc.euid, tc.env).getSudoUser()
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedSudoUser, actualSudoUser)
+			}
+		})
+	}
+}
+
+func TestUseSudoUser(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/root": &vfst.Dir{Perm: 0o700},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	newFlags := func(args ...string) *pflag.FlagSet {
+		flags := pflag.NewFlagSet("chezmoi", pflag.ContinueOnError)
+		flags.String("config", "", "")
+		flags.String("destination", "", "")
+		flags.String("source", "", "")
+		require.NoError(t, flags.Parse(args))
+		return flags
+	}
+	newSudoConfig := func(allowSudo bool) *Config {
+		c := newTestConfig(fs, withUserLookup(newSudoUserLookup(0, map[string]string{"SUDO_USER": "user"})))
+		c.allowSudo = allowSudo
+		c.configFile = "/root/.config/chezmoi/chezmoi.toml"
+		c.DestDir = "/root"
+		c.SourceDir = "/root/.local/share/chezmoi"
+		return c
+	}
+
+	// Without --allow-sudo, root's files are kept but chezmoi refuses to run
+	// unless the destination directory is given explicitly.
+	c := newSudoConfig(false)
+	flags := newFlags()
+	require.NoError(t, c.useSudoUser(flags))
+	assert.Equal(t, "/root", c.DestDir)
+	assert.EqualError(t, c.checkSudo(flags), "running as root with sudo would use /root as the destination directory and create files owned by root, use --allow-sudo to use user's files or run chezmoi without sudo")
+	flags = newFlags("--destination", "/")
+	require.NoError(t, c.useSudoUser(flags))
+	assert.NoError(t, c.checkSudo(flags))
+
+	// With --allow-sudo, the invoking user's files are used, unless they are
+	// given explicitly.
+	c = newSudoConfig(true)
+	flags = newFlags("--source", "/srv/chezmoi")
+	c.SourceDir = "/srv/chezmoi"
+	require.NoError(t, c.useSudoUser(flags))
+	require.NoError(t, c.checkSudo(flags))
+	assert.Equal(t, "/home/user", c.DestDir)
+	assert.Equal(t, "/home/user/.config/chezmoi/chezmoi.toml", c.configFile)
+	assert.Equal(t, "/srv/chezmoi", c.SourceDir)
+	assert.Equal(t, "/home/user/.local/state/chezmoi/chezmoistate.boltdb", c.getDefaultPersistentStateFile())
+}
+
+func TestRepairOwnership(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("creating files owned by root requires root")
+	}
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/state/chezmoi/chezmoistate.boltdb": &vfst.File{
+			Perm:     0o600,
+			Contents: []byte("state"),
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	path := "/home/user/.local/state/chezmoi/chezmoistate.boltdb"
+
+	// Running as root, nothing is repaired.
+	stderr := &strings.Builder{}
+	c := newTestConfig(fs, withStderr(stderr), withUserLookup(newSudoUserLookup(0, nil)))
+	require.NoError(t, c.repairOwnership(fs, path))
+	assert.Empty(t, stderr.String())
+
+	// Running as another user, warning only reports the problem.
+	c = newTestConfig(fs, withStderr(stderr), withUserLookup(newSudoUserLookup(1000, nil)))
+	require.NoError(t, c.warnOwnership(fs, path))
+	assert.Equal(t, "warning: "+path+": owned by root, run sudo chown 1000 "+path+"\n", stderr.String())
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath(path+".chezmoi-repair",
+			vfst.TestDoesNotExist,
+		),
+	)
+
+	// Running as another user, the file is replaced by a copy. The copy is
+	// owned by root here because the test runs as root.
+	stderr.Reset()
+	require.NoError(t, c.repairOwnership(fs, path))
+	assert.Equal(t, "warning: "+path+": was owned by root, replaced with a copy owned by you\n", stderr.String())
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath(path,
+			vfst.TestModeIsRegular,
+			vfst.TestModePerm(0o600),
+			vfst.TestContentsString("state"),
+		),
+		vfst.TestPath(path+".chezmoi-repair",
+			vfst.TestDoesNotExist,
+		),
+	)
+}
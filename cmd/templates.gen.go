@@ -28,4 +28,181 @@ func init() {
 		"{{- range .Untracked -}}\n" +
 		"{{ fail \"untracked files\" }}\n" +
 		"{{- end -}}\n")
+	assets["assets/templates/install.ps1.tmpl"] = []byte("" +
+		"# Code generated by chezmoi generate install.sh --format=powershell. DO NOT EDIT.\n" +
+		"#\n" +
+		"# Install chezmoi and initialize it from {{ .Repo }}.\n" +
+		"#\n" +
+		"# Environment variables:\n" +
+		"#   CHEZMOI_PREFIX   install prefix, chezmoi is installed in $env:CHEZMOI_PREFIX\\bin\n" +
+		"#                    (default: $env:LOCALAPPDATA\\chezmoi)\n" +
+		"#   CHEZMOI_VERSION  version of chezmoi to install (default: latest)\n" +
+		"\n" +
+		"$ErrorActionPreference = 'Stop'\n" +
+		"\n" +
+		"$Repo = {{ powershellQuote .Repo }}\n" +
+		"$Prefix = if ($env:CHEZMOI_PREFIX) { $env:CHEZMOI_PREFIX } else { Join-Path $env:LOCALAPPDATA 'chezmoi' }\n" +
+		"$BinDir = Join-Path $Prefix 'bin'\n" +
+		"$Version = if ($env:CHEZMOI_VERSION) { $env:CHEZMOI_VERSION } else { 'latest' }\n" +
+		"$GitHubURL = 'https://github.com/twpayne/chezmoi'\n" +
+		"\n" +
+		"switch ($env:PROCESSOR_ARCHITECTURE) {\n" +
+		"    'AMD64' { $Arch = 'amd64' }\n" +
+		"    'x86' { $Arch = 'i386' }\n" +
+		"    'ARM64' { $Arch = 'arm64' }\n" +
+		"    default { throw \"$($env:PROCESSOR_ARCHITECTURE): unsupported architecture\" }\n" +
+		"}\n" +
+		"\n" +
+		"$TempDir = Join-Path ([System.IO.Path]::GetTempPath()) ([System.IO.Path]::GetRandomFileName())\n" +
+		"New-Item -ItemType Directory -Path $TempDir | Out-Null\n" +
+		"try {\n" +
+		"    [Net.ServicePointManager]::SecurityProtocol = [Net.SecurityProtocolType]::Tls12\n" +
+		"\n" +
+		"    if ($Version -eq 'latest') {\n" +
+		"        $Release = Invoke-RestMethod -UseBasicParsing -Uri 'https://api.github.com/repos/twpayne/chezmoi/releases/latest'\n" +
+		"        $Version = $Release.tag_name\n" +
+		"    }\n" +
+		"    $Version = $Version -replace '^v', ''\n" +
+		"\n" +
+		"    $Archive = \"chezmoi_${Version}_windows_${Arch}.zip\"\n" +
+		"    $Checksums = \"chezmoi_${Version}_checksums.txt\"\n" +
+		"    Write-Host \"install.ps1: downloading $Archive\"\n" +
+		"    Invoke-WebRequest -UseBasicParsing -Uri \"$GitHubURL/releases/download/v$Version/$Archive\" -OutFile (Join-Path $TempDir $Archive)\n" +
+		"    Invoke-WebRequest -UseBasicParsing -Uri \"$GitHubURL/releases/download/v$Version/$Checksums\" -OutFile (Join-Path $TempDir $Checksums)\n" +
+		"\n" +
+		"    $Want = Get-Content (Join-Path $TempDir $Checksums) |\n" +
+		"        Where-Object { $_ -match \" $([regex]::Escape($Archive))`$\" } |\n" +
+		"        ForEach-Object { ($_ -split ' ')[0] }\n" +
+		"    if (-not $Want) {\n" +
+		"        throw \"${Archive}: checksum not found\"\n" +
+		"    }\n" +
+		"    $Got = (Get-FileHash -Algorithm SHA256 -Path (Join-Path $TempDir $Archive)).Hash.ToLower()\n" +
+		"    if ($Want -ne $Got) {\n" +
+		"        throw \"${Archive}: checksum mismatch, want $Want, got $Got\"\n" +
+		"    }\n" +
+		"\n" +
+		"    Expand-Archive -Path (Join-Path $TempDir $Archive) -DestinationPath $TempDir\n" +
+		"    New-Item -ItemType Directory -Force -Path $BinDir | Out-Null\n" +
+		"    Copy-Item -Force -Path (Join-Path $TempDir 'chezmoi.exe') -Destination $BinDir\n" +
+		"    Write-Host \"install.ps1: installed $(Join-Path $BinDir 'chezmoi.exe')\"\n" +
+		"} finally {\n" +
+		"    Remove-Item -Recurse -Force -Path $TempDir\n" +
+		"}\n" +
+		"\n" +
+		"& (Join-Path $BinDir 'chezmoi.exe') init --apply $Repo\n" +
+		"if ($LASTEXITCODE -ne 0) {\n" +
+		"    exit $LASTEXITCODE\n" +
+		"}\n" +
+		"\n")
+	assets["assets/templates/install.sh.tmpl"] = []byte("" +
+		"#!/bin/sh\n" +
+		"# Code generated by chezmoi generate install.sh. DO NOT EDIT.\n" +
+		"#\n" +
+		"# Install chezmoi and initialize it from {{ .Repo }}.\n" +
+		"#\n" +
+		"# Environment variables:\n" +
+		"#   CHEZMOI_PREFIX   install prefix, chezmoi is installed in $CHEZMOI_PREFIX/bin\n" +
+		"#                    (default: $HOME/.local)\n" +
+		"#   CHEZMOI_VERSION  version of chezmoi to install (default: latest)\n" +
+		"\n" +
+		"set -e\n" +
+		"\n" +
+		"REPO={{ shellQuote .Repo }}\n" +
+		"PREFIX=\"${CHEZMOI_PREFIX:-$HOME/.local}\"\n" +
+		"BINDIR=\"${PREFIX}/bin\"\n" +
+		"VERSION=\"${CHEZMOI_VERSION:-latest}\"\n" +
+		"GITHUB_URL=https://github.com/twpayne/chezmoi\n" +
+		"\n" +
+		"log() {\n" +
+		"\techo \"install.sh: $*\" 1>&2\n" +
+		"}\n" +
+		"\n" +
+		"fail() {\n" +
+		"\tlog \"$@\"\n" +
+		"\texit 1\n" +
+		"}\n" +
+		"\n" +
+		"is_command() {\n" +
+		"\tcommand -v \"$1\" >/dev/null 2>&1\n" +
+		"}\n" +
+		"\n" +
+		"# http_get writes the contents of the URL $1 to the file $2.\n" +
+		"http_get() {\n" +
+		"\tif is_command curl; then\n" +
+		"\t\tcurl --fail --location --silent --show-error --output \"$2\" \"$1\"\n" +
+		"\telif is_command wget; then\n" +
+		"\t\twget --quiet --output-document=\"$2\" \"$1\"\n" +
+		"\telse\n" +
+		"\t\tfail \"curl or wget is required\"\n" +
+		"\tfi\n" +
+		"}\n" +
+		"\n" +
+		"sha256() {\n" +
+		"\tif is_command sha256sum; then\n" +
+		"\t\tsha256sum \"$1\" | cut -d ' ' -f 1\n" +
+		"\telif is_command shasum; then\n" +
+		"\t\tshasum -a 256 \"$1\" | cut -d ' ' -f 1\n" +
+		"\telif is_command openssl; then\n" +
+		"\t\topenssl dgst -sha256 \"$1\" | sed 's/.*= //'\n" +
+		"\telse\n" +
+		"\t\tfail \"sha256sum, shasum, or openssl is required\"\n" +
+		"\tfi\n" +
+		"}\n" +
+		"\n" +
+		"get_os() {\n" +
+		"\tos=$(uname -s | tr '[:upper:]' '[:lower:]')\n" +
+		"\tcase \"${os}\" in\n" +
+		"\tdarwin | freebsd | linux | openbsd) echo \"${os}\" ;;\n" +
+		"\t*) fail \"${os}: unsupported operating system\" ;;\n" +
+		"\tesac\n" +
+		"}\n" +
+		"\n" +
+		"get_arch() {\n" +
+		"\tarch=$(uname -m)\n" +
+		"\tcase \"${arch}\" in\n" +
+		"\tx86_64 | amd64) echo amd64 ;;\n" +
+		"\ti386 | i686 | x86) echo i386 ;;\n" +
+		"\taarch64 | arm64) echo arm64 ;;\n" +
+		"\tarmv*) echo arm ;;\n" +
+		"\tppc64) echo ppc64 ;;\n" +
+		"\tppc64le) echo ppc64le ;;\n" +
+		"\t*) fail \"${arch}: unsupported architecture\" ;;\n" +
+		"\tesac\n" +
+		"}\n" +
+		"\n" +
+		"main() {\n" +
+		"\tos=$(get_os)\n" +
+		"\tarch=$(get_arch)\n" +
+		"\n" +
+		"\ttmpdir=$(mktemp -d)\n" +
+		"\ttrap 'rm -rf \"${tmpdir}\"' EXIT\n" +
+		"\n" +
+		"\tif [ \"${VERSION}\" = latest ]; then\n" +
+		"\t\thttp_get \"https://api.github.com/repos/twpayne/chezmoi/releases/latest\" \"${tmpdir}/release.json\"\n" +
+		"\t\tVERSION=$(sed -n 's/.*\"tag_name\": *\"v\\{0,1\\}\\([^\"]*\\)\".*/\\1/p' \"${tmpdir}/release.json\")\n" +
+		"\t\t[ -n \"${VERSION}\" ] || fail \"cannot determine latest version\"\n" +
+		"\tfi\n" +
+		"\tVERSION=\"${VERSION#v}\"\n" +
+		"\n" +
+		"\tarchive=\"chezmoi_${VERSION}_${os}_${arch}.tar.gz\"\n" +
+		"\tchecksums=\"chezmoi_${VERSION}_checksums.txt\"\n" +
+		"\tlog \"downloading ${archive}\"\n" +
+		"\thttp_get \"${GITHUB_URL}/releases/download/v${VERSION}/${archive}\" \"${tmpdir}/${archive}\"\n" +
+		"\thttp_get \"${GITHUB_URL}/releases/download/v${VERSION}/${checksums}\" \"${tmpdir}/${checksums}\"\n" +
+		"\n" +
+		"\twant=$(grep \" ${archive}\\$\" \"${tmpdir}/${checksums}\" | cut -d ' ' -f 1)\n" +
+		"\t[ -n \"${want}\" ] || fail \"${archive}: checksum not found\"\n" +
+		"\tgot=$(sha256 \"${tmpdir}/${archive}\")\n" +
+		"\t[ \"${want}\" = \"${got}\" ] || fail \"${archive}: checksum mismatch, want ${want}, got ${got}\"\n" +
+		"\n" +
+		"\t(cd \"${tmpdir}\" && tar -xzf \"${archive}\" chezmoi)\n" +
+		"\tmkdir -p \"${BINDIR}\"\n" +
+		"\tinstall -m 755 \"${tmpdir}/chezmoi\" \"${BINDIR}/chezmoi\"\n" +
+		"\tlog \"installed ${BINDIR}/chezmoi\"\n" +
+		"\n" +
+		"\t\"${BINDIR}/chezmoi\" init --apply \"${REPO}\"\n" +
+		"}\n" +
+		"\n" +
+		"main \"$@\"\n" +
+		"\n")
 }
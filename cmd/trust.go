@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/spf13/cobra"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+// untrustedSprigFuncNames are the sprig template functions that are disabled,
+// like the secret template functions, in untrusted repos. getHostByName makes
+// DNS requests, which can leak data, and env and expandenv read the
+// environment.
+var untrustedSprigFuncNames = []string{"env", "expandenv", "getHostByName"}
+
+// A trustConfig records whether the source repo is trusted.
+type trustConfig struct {
+	trust         bool
+	checked       bool
+	untrustedRepo string
+}
+
+// A repoTrust is the trust of a repo stored in the persistent state.
+type repoTrust struct {
+	Trusted bool      `json:"trusted"`
+	Time    time.Time `json:"time"`
+}
+
+// addTrustFlag adds the --trust flag to cmd.
+func addTrustFlag(cmd *cobra.Command) {
+	persistentFlags := cmd.PersistentFlags()
+	persistentFlags.BoolVar(&config.trust.trust, "trust", false, "trust the source repo without prompting")
+}
+
+// getRepoTrust returns the trust of repo stored in persistentState, or nil if
+// none is stored.
+func (c *Config) getRepoTrust(repo string, persistentState chezmoi.PersistentState) (*repoTrust, error) {
+	data, err := persistentState.Get(c.trustBucket, []byte(repo))
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var trust repoTrust
+	if err := json.Unmarshal(data, &trust); err != nil {
+		return nil, fmt.Errorf("%s: %w", repo, err)
+	}
+	return &trust, nil
+}
+
+// setRepoTrust stores the trust of repo in persistentState.
+func (c *Config) setRepoTrust(repo string, trusted bool, persistentState chezmoi.PersistentState) error {
+	data, err := json.Marshal(&repoTrust{
+		Trusted: trusted,
+		Time:    time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	return persistentState.Set(c.trustBucket, []byte(repo), data)
+}
+
+// ensureTrust checks that repo is trusted, prompting the user if it has not
+// been trusted before and --trust is not set. If repo is not trusted then the
+// source state is restricted.
+func (c *Config) ensureTrust(repo string, persistentState chezmoi.PersistentState) error {
+	c.trust.checked = true
+	trust, err := c.getRepoTrust(repo, persistentState)
+	if err != nil {
+		return err
+	}
+	if trust != nil && trust.Trusted {
+		return nil
+	}
+	trusted := c.trust.trust
+	if !trusted {
+		choice, err := c.prompt(fmt.Sprintf("Trust %s to read secrets in templates and run scripts", repo), "yn", 'n')
+		if err != nil {
+			return err
+		}
+		trusted = choice == 'y'
+	}
+	if !trusted {
+		c.restrictSourceState(repo)
+	}
+	if c.DryRun {
+		return nil
+	}
+	return c.setRepoTrust(repo, trusted, persistentState)
+}
+
+// checkTrust checks that the source directory is trusted, using the persistent
+// state that is already open or opening it to read otherwise. Source
+// directories cloned with --remote are checked by the commands that clone
+// them, which restrict them unless --trust is set.
+func (c *Config) checkTrust() error {
+	if c.trust.checked || c.remote.url != "" {
+		return nil
+	}
+	persistentState := c.persistentState
+	if persistentState == nil {
+		var err error
+		persistentState, err = c.openPersistentState(&bolt.Options{
+			ReadOnly: true,
+		})
+		if err != nil {
+			return err
+		}
+		defer persistentState.Close()
+		persistentState = &sharedPersistentState{
+			PersistentState: persistentState,
+			c:               c,
+			readOnly:        true,
+		}
+	}
+	return c.checkSourceDirTrust(persistentState)
+}
+
+// checkSourceDirTrust checks that the source directory is trusted, if any
+// repo is untrusted. If persistentState is only read then the answer cannot be
+// recorded, so the source state is restricted without prompting unless --trust
+// is set.
+func (c *Config) checkSourceDirTrust(persistentState chezmoi.PersistentState) error {
+	if c.trust.checked {
+		return nil
+	}
+	c.trust.checked = true
+	untrusted := false
+	if err := persistentState.ForEach(c.trustBucket, func(k, v []byte) error {
+		var trust repoTrust
+		if err := json.Unmarshal(v, &trust); err == nil && !trust.Trusted {
+			untrusted = true
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if !untrusted {
+		return nil
+	}
+	// A source directory without a remote cannot have been cloned from an
+	// untrusted repo.
+	repo, err := c.getRemoteURL()
+	if err != nil {
+		return nil
+	}
+	trust, err := c.getRepoTrust(repo, persistentState)
+	if err != nil || trust == nil || trust.Trusted {
+		return err
+	}
+	if s, ok := persistentState.(*sharedPersistentState); ok && s.readOnly {
+		if !c.trust.trust {
+			c.restrictSourceState(repo)
+		}
+		return nil
+	}
+	return c.ensureTrust(repo, persistentState)
+}
+
+// restrictSourceState disables the template functions that read secrets,
+// make network requests, or read the environment, and prevents scripts from
+// running, because repo is not trusted.
+func (c *Config) restrictSourceState(repo string) {
+	fmt.Fprintf(c.Stderr, "warning: %s is not trusted, secret, network, and environment template functions are disabled and scripts will not be run\n", repo)
+	c.trust.untrustedRepo = repo
+	funcNames := make([]string, 0, len(c.secretFuncNames)+len(untrustedSprigFuncNames))
+	funcNames = append(funcNames, c.secretFuncNames...)
+	funcNames = append(funcNames, untrustedSprigFuncNames...)
+	for _, key := range funcNames {
+		key := key
+		funcType := reflect.TypeOf(c.templateFuncs[key])
+		c.templateFuncs[key] = reflect.MakeFunc(funcType, func([]reflect.Value) []reflect.Value {
+			// text/template returns panics in functions as errors.
+			panic(fmt.Errorf("%s: disabled because %s is not trusted, use --trust to trust it", key, repo))
+		}).Interface()
+	}
+}
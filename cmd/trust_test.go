@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+func TestEnsureTrust(t *testing.T) {
+	const repo = "https://github.com/user/dotfiles.git"
+	for _, tc := range []struct {
+		name             string
+		stdin            string
+		trust            bool
+		stored           bool
+		storedTrusted    bool
+		expectedPrompted bool
+		expectedTrusted  bool
+	}{
+		{
+			name:             "prompt_yes",
+			stdin:            "y\n",
+			expectedPrompted: true,
+			expectedTrusted:  true,
+		},
+		{
+			name:             "prompt_no",
+			stdin:            "n\n",
+			expectedPrompted: true,
+		},
+		{
+			name:            "flag",
+			trust:           true,
+			expectedTrusted: true,
+		},
+		{
+			name:            "trusted",
+			stored:          true,
+			storedTrusted:   true,
+			expectedTrusted: true,
+		},
+		{
+			name:             "untrusted",
+			stdin:            "n\n",
+			stored:           true,
+			expectedPrompted: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+				"/home/user": &vfst.Dir{Perm: 0o755},
+			})
+			require.NoError(t, err)
+			defer cleanup()
+
+			stderr := &strings.Builder{}
+			c := newTestConfig(fs, withStdin(strings.NewReader(tc.stdin)), withStderr(stderr))
+			c.trust.trust = tc.trust
+			persistentState := chezmoi.NewMemoryPersistentState()
+			if tc.stored {
+				require.NoError(t, c.setRepoTrust(repo, tc.storedTrusted, persistentState))
+			}
+
+			require.NoError(t, c.ensureTrust(repo, persistentState))
+			assert.Equal(t, tc.expectedPrompted, strings.Contains(stderr.String(), "Trust "+repo))
+			if tc.expectedTrusted {
+				assert.Equal(t, "", c.trust.untrustedRepo)
+			} else {
+				assert.Equal(t, repo, c.trust.untrustedRepo)
+			}
+			trust, err := c.getRepoTrust(repo, persistentState)
+			require.NoError(t, err)
+			require.NotNil(t, trust)
+			assert.Equal(t, tc.expectedTrusted, trust.Trusted)
+		})
+	}
+}
+
+func TestApplyUntrusted(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".local/share/chezmoi": map[string]interface{}{
+				"dot_foo":         "bar\n",
+				"run_fail":        "#!/bin/sh\nexit 1\n",
+				"dot_secret.tmpl": `{{ pass "secret" }}`,
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	stderr := &strings.Builder{}
+	c := newTestConfig(fs, withStdin(strings.NewReader("n\n")), withStderr(stderr))
+	c.addSecretTemplateFunc("pass", c.passFunc)
+	persistentState := chezmoi.NewMemoryPersistentState()
+	require.NoError(t, c.ensureTrust("https://github.com/user/dotfiles.git", persistentState))
+
+	err = c.applyArgs(nil, persistentState)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pass: disabled because https://github.com/user/dotfiles.git is not trusted")
+
+	require.NoError(t, fs.Remove("/home/user/.local/share/chezmoi/dot_secret.tmpl"))
+	require.NoError(t, c.applyArgs(nil, persistentState))
+	assert.Contains(t, stderr.String(), "warning: fail: not running script from untrusted https://github.com/user/dotfiles.git\n")
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.foo",
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("bar\n"),
+		),
+	)
+}
+
+func TestCatUntrusted(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in $PATH")
+	}
+	repo := "https://github.com/user/dotfiles.git"
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_secret.tmpl": `{{ pass "secret" }}`,
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	sourceDir, err := fs.RawPath("/home/user/.local/share/chezmoi")
+	require.NoError(t, err)
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"remote", "add", "origin", repo},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = sourceDir
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+
+	c := newTestConfig(fs)
+	persistentState, err := c.getPersistentState(nil)
+	require.NoError(t, err)
+	require.NoError(t, c.setRepoTrust(repo, false, persistentState))
+	require.NoError(t, persistentState.Close())
+
+	// Commands that only read the persistent state restrict the source state
+	// without prompting.
+	stderr := &strings.Builder{}
+	c = newTestConfig(fs, withStderr(stderr))
+	c.addSecretTemplateFunc("pass", c.passFunc)
+	err = c.runCatCmd(nil, []string{"/home/user/.secret"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pass: disabled because "+repo+" is not trusted")
+	assert.Contains(t, stderr.String(), "warning: "+repo+" is not trusted")
+}
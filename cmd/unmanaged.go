@@ -20,29 +20,74 @@ var unmanagedCmd = &cobra.Command{
 	RunE:    config.runUnmanagedCmd,
 }
 
+var unmanagedPathStyles = []string{"absolute", "relative"}
+
+type unmanagedCmdConfig struct {
+	pathStyle string
+	recursive bool
+}
+
 func init() {
 	rootCmd.AddCommand(unmanagedCmd)
+
+	persistentFlags := unmanagedCmd.PersistentFlags()
+	persistentFlags.StringVarP(&config.unmanaged.pathStyle, "path-style", "p", config.unmanaged.pathStyle, "path style ("+strings.Join(unmanagedPathStyles, ", ")+")")
+	persistentFlags.BoolVarP(&config.unmanaged.recursive, "recursive", "r", false, "list the contents of unmanaged directories")
+	panicOnError(unmanagedCmd.RegisterFlagCompletionFunc("path-style", completeWords(unmanagedPathStyles)))
 }
 
 func (c *Config) runUnmanagedCmd(cmd *cobra.Command, args []string) error {
+	var relative bool
+	switch strings.ToLower(c.unmanaged.pathStyle) {
+	case "absolute":
+	case "relative":
+		relative = true
+	default:
+		return fmt.Errorf("%s: unknown path style", c.unmanaged.pathStyle)
+	}
+
 	ts, err := c.getTargetState(nil)
 	if err != nil {
 		return err
 	}
-	return vfs.Walk(c.fs, c.DestDir, func(path string, info os.FileInfo, err error) error {
+
+	sourceDirs := make(map[string]bool)
+	sourceDirs[ts.SourceDir] = true
+	for _, sourceDir := range ts.SourceDirs {
+		sourceDirs[sourceDir] = true
+	}
+
+	// vfs.Walk uses Lstat, so symlinks in the destination directory are not
+	// followed.
+	return vfs.Walk(c.fs, ts.DestDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if path == c.DestDir {
+		if path == ts.DestDir {
+			return nil
+		}
+		if sourceDirs[path] {
+			return filepath.SkipDir
+		}
+		targetName, err := filepath.Rel(ts.DestDir, path)
+		if err != nil {
+			return err
+		}
+		if ts.TargetIgnore.Match(targetName) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry, _ := ts.Get(c.fs, path); entry != nil {
 			return nil
 		}
-		entry, _ := ts.Get(c.fs, path)
-		managed := entry != nil
-		ignored := ts.TargetIgnore.Match(strings.TrimPrefix(path, c.DestDir+"/"))
-		if !managed && !ignored {
-			fmt.Println(path)
+		if relative {
+			fmt.Fprintln(c.Stdout, targetName)
+		} else {
+			fmt.Fprintln(c.Stdout, path)
 		}
-		if info.IsDir() && (!managed || ignored) {
+		if info.IsDir() && !c.unmanaged.recursive {
 			return filepath.SkipDir
 		}
 		return nil
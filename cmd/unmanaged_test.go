@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+func TestUnmanagedCmd(t *testing.T) {
+	for _, tc := range []struct {
+		name                string
+		unmanaged           unmanagedCmdConfig
+		expectedTargetNames []string
+	}{
+		{
+			name: "default",
+			unmanaged: unmanagedCmdConfig{
+				pathStyle: "absolute",
+			},
+			expectedTargetNames: []string{
+				"/home/user/.local",
+				"/home/user/.unmanaged",
+				"/home/user/dir/unmanaged",
+				"/home/user/symlink",
+				"/home/user/unmanaged_dir",
+			},
+		},
+		{
+			name: "relative",
+			unmanaged: unmanagedCmdConfig{
+				pathStyle: "relative",
+			},
+			expectedTargetNames: []string{
+				".local",
+				".unmanaged",
+				"dir/unmanaged",
+				"symlink",
+				"unmanaged_dir",
+			},
+		},
+		{
+			name: "recursive",
+			unmanaged: unmanagedCmdConfig{
+				pathStyle: "absolute",
+				recursive: true,
+			},
+			expectedTargetNames: []string{
+				"/home/user/.local",
+				"/home/user/.local/share",
+				"/home/user/.unmanaged",
+				"/home/user/dir/unmanaged",
+				"/home/user/symlink",
+				"/home/user/unmanaged_dir",
+				"/home/user/unmanaged_dir/file",
+				"/home/user/unmanaged_dir/subdir",
+				"/home/user/unmanaged_dir/subdir/file",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+				"/home/user": map[string]interface{}{
+					".bashrc":    "# contents of .bashrc\n",
+					".ignored":   "",
+					".unmanaged": "",
+					"dir": map[string]interface{}{
+						"managed":   "",
+						"unmanaged": "",
+					},
+					"symlink": &vfst.Symlink{Target: "unmanaged_dir"},
+					"unmanaged_dir": map[string]interface{}{
+						"file":        "",
+						"subdir/file": "",
+					},
+				},
+				"/home/user/.local/share/chezmoi": map[string]interface{}{
+					".chezmoiignore": ".ignored\n",
+					"dot_bashrc":     "# contents of .bashrc\n",
+					"dir/managed":    "",
+				},
+			})
+			require.NoError(t, err)
+			defer cleanup()
+			stdout := &bytes.Buffer{}
+			c := newTestConfig(
+				fs,
+				withStdout(stdout),
+			)
+			c.unmanaged = tc.unmanaged
+			assert.NoError(t, c.runUnmanagedCmd(nil, nil))
+			posixTargetNames, err := extractPOSIXTargetNames(stdout.Bytes())
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedTargetNames, posixTargetNames)
+		})
+	}
+}
+
+func TestUnmanagedCmdInvalidPathStyle(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	c := newTestConfig(fs)
+	c.unmanaged.pathStyle = "invalid"
+	assert.Error(t, c.runUnmanagedCmd(nil, nil))
+}
@@ -1,14 +1,24 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
+// updateCheckBehindExitCode is the exit code of update --check when the
+// source directory is behind its upstream.
+const updateCheckBehindExitCode = 2
+
 type updateCmdConfig struct {
 	apply bool
+	check bool
+	poll  time.Duration
 }
 
 var updateCmd = &cobra.Command{
@@ -26,9 +36,145 @@ func init() {
 
 	persistentFlags := updateCmd.PersistentFlags()
 	persistentFlags.BoolVarP(&config.update.apply, "apply", "a", true, "apply after pulling")
+	persistentFlags.BoolVar(&config.update.check, "check", false, "only check if upstream has new commits")
+	persistentFlags.DurationVar(&config.update.poll, "poll", 0, "update repeatedly at interval")
+	addApplyLogFlags(updateCmd)
 }
 
 func (c *Config) runUpdateCmd(cmd *cobra.Command, args []string) error {
+	switch {
+	case c.update.check && c.update.poll != 0:
+		return fmt.Errorf("--check and --poll cannot be used together")
+	case c.update.check:
+		behind, err := c.checkUpstream()
+		if err != nil {
+			return err
+		}
+		if behind != 0 {
+			return exitCodeError(updateCheckBehindExitCode)
+		}
+		return nil
+	case c.update.poll != 0:
+		if c.update.poll < time.Second {
+			return fmt.Errorf("%s: poll interval too short", c.update.poll)
+		}
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		defer signal.Stop(interrupt)
+		stop := make(chan struct{})
+		go func() {
+			<-interrupt
+			close(stop)
+		}()
+		return c.pollUpdates(c.update.poll, stop)
+	default:
+		return c.pullAndApply()
+	}
+}
+
+// checkUpstream fetches from the source directory's upstream and prints a
+// one-line summary of how far behind it the source directory is, followed by
+// the incoming commits. It returns the number of incoming commits.
+func (c *Config) checkUpstream() (int, error) {
+	vcs, err := c.getVCS()
+	if err != nil {
+		return 0, err
+	}
+	if vcs.FetchArgs() == nil || vcs.AheadBehindArgs() == nil {
+		return 0, fmt.Errorf("%s: check not supported", c.SourceVCS.Command)
+	}
+
+	// Fetching only updates remote-tracking refs, so it is run even in dry
+	// run mode.
+	if _, err := c.output(c.SourceDir, c.SourceVCS.Command, vcs.FetchArgs()...); err != nil {
+		return 0, &upstreamError{op: "fetch", err: err}
+	}
+	output, err := c.output(c.SourceDir, c.SourceVCS.Command, vcs.AheadBehindArgs()...)
+	if err != nil {
+		return 0, err
+	}
+	ahead, behind, err := vcs.ParseAheadBehindOutput(output)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case behind == 0:
+		fmt.Fprintf(c.Stdout, "up to date\n")
+	case ahead == 0:
+		fmt.Fprintf(c.Stdout, "%d new commit(s) upstream\n", behind)
+	default:
+		fmt.Fprintf(c.Stdout, "%d new commit(s) upstream, %d local commit(s) not pushed\n", behind, ahead)
+	}
+	if behind != 0 && vcs.IncomingArgs() != nil {
+		incoming, err := c.output(c.SourceDir, c.SourceVCS.Command, vcs.IncomingArgs()...)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := c.Stdout.Write(incoming); err != nil {
+			return 0, err
+		}
+	}
+	return behind, nil
+}
+
+// An upstreamError is returned when fetching or pulling from upstream fails.
+type upstreamError struct {
+	op  string
+	err error
+}
+
+func (e *upstreamError) Error() string {
+	return fmt.Sprintf("%s: %v", e.op, e.err)
+}
+
+// Unwrap returns e's underlying error.
+func (e *upstreamError) Unwrap() error {
+	return e.err
+}
+
+// pollUpdates checks upstream for new commits every interval, pulling and
+// applying them when there are any, until stop is closed. Failures to fetch or
+// pull, for example because the network is unavailable, are logged and retried
+// at the next interval. Failures to apply stop polling.
+func (c *Config) pollUpdates(interval time.Duration, stop <-chan struct{}) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		fmt.Fprintf(c.Stdout, "%s: checking for updates\n", time.Now().Format(time.RFC3339))
+		behind, err := c.checkUpstream()
+		switch {
+		case err != nil:
+			if !isUpstreamError(err) {
+				return err
+			}
+			fmt.Fprintf(c.Stderr, "%v, retrying in %s\n", err, interval)
+		case behind != 0:
+			if err := c.pullAndApply(); err != nil {
+				if !isUpstreamError(err) {
+					return err
+				}
+				fmt.Fprintf(c.Stderr, "%v, retrying in %s\n", err, interval)
+			}
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// isUpstreamError returns whether err is because fetching or pulling from
+// upstream failed.
+func isUpstreamError(err error) bool {
+	var upstreamErr *upstreamError
+	return errors.As(err, &upstreamErr)
+}
+
+// pullAndApply pulls changes from upstream and, if c.update.apply is set,
+// applies them.
+func (c *Config) pullAndApply() error {
 	vcs, err := c.getVCS()
 	if err != nil {
 		return err
@@ -51,7 +197,7 @@ func (c *Config) runUpdateCmd(cmd *cobra.Command, args []string) error {
 	}
 
 	if err := c.run(c.SourceDir, c.SourceVCS.Command, pullArgs...); err != nil {
-		return err
+		return &upstreamError{op: "pull", err: err}
 	}
 
 	if c.update.apply {
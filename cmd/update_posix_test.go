@@ -0,0 +1,163 @@
+// +build !windows
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+func TestUpdateCheckAndPoll(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in $PATH")
+	}
+	repoDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(repoDir))
+	}()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, "dot_foo"), []byte("old\n"), 0o644))
+	git := func(dir string, args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=chezmoi", "-c", "user.email=chezmoi@example.com"}, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+	git(repoDir, "init", "--quiet")
+	git(repoDir, "add", ".")
+	git(repoDir, "commit", "--quiet", "--message", "old")
+
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	rawSourceDir, err := fs.RawPath("/home/user/.local/share/chezmoi")
+	require.NoError(t, err)
+	git("", "clone", "--quiet", repoDir, rawSourceDir)
+
+	stdout := &bytes.Buffer{}
+	c := newTestConfig(fs, withStdout(stdout))
+	c.update.check = true
+	assert.NoError(t, c.runUpdateCmd(nil, nil))
+	assert.Equal(t, "up to date\n", stdout.String())
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, "dot_foo"), []byte("new\n"), 0o644))
+	git(repoDir, "commit", "--quiet", "--all", "--message", "new")
+
+	stdout.Reset()
+	assert.Equal(t, exitCodeError(updateCheckBehindExitCode), c.runUpdateCmd(nil, nil))
+	assert.Regexp(t, regexp.MustCompile(`\A1 new commit\(s\) upstream\n[0-9a-f]+ new\n\z`), stdout.String())
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.local/share/chezmoi/dot_foo",
+			vfst.TestContentsString("old\n"),
+		),
+	)
+
+	stop := make(chan struct{})
+	close(stop)
+	stdout.Reset()
+	c = newTestConfig(fs, withStdout(stdout))
+	c.update.apply = true
+	require.NoError(t, c.pollUpdates(time.Hour, stop))
+	assert.Contains(t, stdout.String(), "checking for updates\n1 new commit(s) upstream\n")
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.foo",
+			vfst.TestContentsString("new\n"),
+		),
+	)
+
+	git(rawSourceDir, "remote", "set-url", "origin", filepath.Join(repoDir, "nonexistent"))
+	stderr := &bytes.Buffer{}
+	c = newTestConfig(fs, withStdout(ioutil.Discard), withStderr(stderr))
+	require.NoError(t, c.pollUpdates(time.Hour, stop))
+	assert.Contains(t, stderr.String(), "fetch: ")
+	assert.Contains(t, stderr.String(), "retrying in ")
+}
+
+func TestUpdatePollRetriesPull(t *testing.T) {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git not found in $PATH")
+	}
+	repoDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(repoDir))
+	}()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, "dot_foo"), []byte("old\n"), 0o644))
+	git := func(dir string, args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=chezmoi", "-c", "user.email=chezmoi@example.com"}, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+	git(repoDir, "init", "--quiet")
+	git(repoDir, "add", ".")
+	git(repoDir, "commit", "--quiet", "--message", "old")
+
+	// The wrapper fails the first pull, as if the network were unavailable.
+	binDir, err := ioutil.TempDir("", "chezmoi")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(binDir))
+	}()
+	pulled := filepath.Join(binDir, "pulled")
+	wrapper := filepath.Join(binDir, "git")
+	require.NoError(t, ioutil.WriteFile(wrapper, []byte(strings.Join([]string{
+		"#!/bin/sh",
+		"if [ \"$1\" = pull ] && [ ! -e " + pulled + " ]; then",
+		"  touch " + pulled,
+		"  echo 'fatal: unable to access remote' >&2",
+		"  exit 1",
+		"fi",
+		"exec " + gitPath + " \"$@\"",
+		"",
+	}, "\n")), 0o755))
+
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	rawSourceDir, err := fs.RawPath("/home/user/.local/share/chezmoi")
+	require.NoError(t, err)
+	git("", "clone", "--quiet", repoDir, rawSourceDir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, "dot_foo"), []byte("new\n"), 0o644))
+	git(repoDir, "commit", "--quiet", "--all", "--message", "new")
+
+	stderr := &bytes.Buffer{}
+	c := newTestConfig(fs, withStdout(ioutil.Discard), withStderr(stderr))
+	c.SourceVCS.Command = wrapper
+	c.update.apply = true
+	stop := make(chan struct{})
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.pollUpdates(10*time.Millisecond, stop)
+	}()
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if data, err := fs.ReadFile("/home/user/.foo"); err == nil && string(data) == "new\n" {
+			break
+		}
+	}
+	close(stop)
+	require.NoError(t, <-errCh)
+	assert.Contains(t, stderr.String(), "pull: ")
+	assert.Contains(t, stderr.String(), "retrying in ")
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.foo",
+			vfst.TestContentsString("new\n"),
+		),
+	)
+}
@@ -44,6 +44,13 @@ const (
 )
 
 var (
+	upgradeMethods = []string{
+		methodReplaceExecutable,
+		methodSnapRefresh,
+		methodUpgradePackage,
+		methodSudoPrefix + methodUpgradePackage,
+	}
+
 	packageTypeByID = map[string]string{
 		"amzn":     packageTypeRPM,
 		"arch":     packageTypeAUR,
@@ -96,6 +103,7 @@ func init() {
 	persistentFlags.StringVarP(&config.upgrade.method, "method", "m", "", "set method")
 	persistentFlags.StringVarP(&config.upgrade.owner, "owner", "o", "twpayne", "set owner")
 	persistentFlags.StringVarP(&config.upgrade.repo, "repo", "r", "chezmoi", "set repo")
+	panicOnError(upgradeCmd.RegisterFlagCompletionFunc("method", completeWords(upgradeMethods)))
 }
 
 func (c *Config) runUpgradeCmd(cmd *cobra.Command, args []string) error {
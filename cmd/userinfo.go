@@ -0,0 +1,58 @@
+package cmd
+
+import "strings"
+
+func init() {
+	config.addTemplateFunc("lookupUserShell", config.lookupUserShellTemplateFunc)
+}
+
+// lookupUserShellTemplateFunc returns username's login shell, or the empty
+// string if it cannot be determined.
+func (c *Config) lookupUserShellTemplateFunc(username string) string {
+	return c.userLookup.lookupShell(username)
+}
+
+// getLocale returns the current user's locale split into its language and
+// region, which are empty if they cannot be determined. The locale is taken
+// from $LC_ALL, then $LANG, and then from the operating system.
+func (ul userLookup) getLocale() map[string]interface{} {
+	locale := ul.getenv("LC_ALL")
+	if locale == "" {
+		locale = ul.getenv("LANG")
+	}
+	if locale == "" {
+		locale = systemLocale()
+	}
+	language, region := parseLocale(locale)
+	return map[string]interface{}{
+		"language": language,
+		"region":   region,
+	}
+}
+
+// parseLocale returns the language and region of locale, which is either a
+// POSIX locale of the form language[_region][.codeset][@modifier], for example
+// en_US.UTF-8, or a language tag of the form language[-script][-region], for
+// example zh-Hans-CN. The C and POSIX locales have no language or region.
+func parseLocale(locale string) (string, string) {
+	if i := strings.IndexAny(locale, ".@"); i != -1 {
+		locale = locale[:i]
+	}
+	if locale == "C" || locale == "POSIX" {
+		return "", ""
+	}
+	fields := strings.FieldsFunc(locale, func(r rune) bool {
+		return r == '_' || r == '-'
+	})
+	if len(fields) == 0 {
+		return "", ""
+	}
+	language := strings.ToLower(fields[0])
+	for _, field := range fields[1:] {
+		// Regions are two letters or three digits, scripts are four letters.
+		if len(field) == 2 || len(field) == 3 && strings.Trim(field, "0123456789") == "" {
+			return language, strings.ToUpper(field)
+		}
+	}
+	return language, ""
+}
@@ -0,0 +1,57 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"runtime"
+	"strings"
+)
+
+// getShell returns the current user's login shell from the user database,
+// falling back to $SHELL. It returns the empty string if the shell cannot be
+// determined.
+func (ul userLookup) getShell() string {
+	if username := ul.getUsername(); username != "" {
+		if shell := ul.lookupShell(username); shell != "" {
+			return shell
+		}
+	}
+	return ul.getenv("SHELL")
+}
+
+// lookupShell returns username's login shell from the user database, or the
+// empty string if username is not found. The user database is queried with
+// dscl on macOS and getent elsewhere, so that users from directory services
+// like LDAP are found too.
+func (ul userLookup) lookupShell(username string) string {
+	if runtime.GOOS == "darwin" {
+		output, err := ul.commandOutput("dscl", ".", "-read", "/Users/"+username, "UserShell")
+		if err != nil {
+			return ""
+		}
+		// The output has the form "UserShell: shell".
+		for _, line := range strings.Split(string(output), "\n") {
+			if shell := strings.TrimPrefix(line, "UserShell:"); shell != line {
+				return strings.TrimSpace(shell)
+			}
+		}
+		return ""
+	}
+	output, err := ul.commandOutput("getent", "passwd", username)
+	if err != nil {
+		return ""
+	}
+	// Entries have the form name:password:uid:gid:gecos:home:shell.
+	fields := strings.Split(strings.TrimSuffix(string(output), "\n"), ":")
+	if len(fields) != 7 || fields[0] != username {
+		return ""
+	}
+	return fields[6]
+}
+
+// systemLocale returns the empty string, as POSIX systems only set the locale
+// in the environment.
+func systemLocale() string {
+	return ""
+}
@@ -0,0 +1,122 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"errors"
+	"os/user"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+// fakeUserDatabase returns a function that answers getent passwd and dscl
+// queries from entries, which map usernames to their passwd entries.
+func fakeUserDatabase(entries map[string]string) func(string, ...string) ([]byte, error) {
+	return func(name string, args ...string) ([]byte, error) {
+		var username string
+		switch {
+		case name == "getent" && len(args) == 2 && args[0] == "passwd":
+			username = args[1]
+		case name == "dscl" && len(args) == 4 && strings.HasPrefix(args[2], "/Users/"):
+			username = strings.TrimPrefix(args[2], "/Users/")
+		default:
+			return nil, errors.New("unexpected command")
+		}
+		entry, ok := entries[username]
+		if !ok {
+			return nil, errors.New("exit status 2")
+		}
+		if name == "dscl" {
+			fields := strings.Split(entry, ":")
+			if len(fields) != 7 {
+				return nil, nil
+			}
+			return []byte("UserShell: " + fields[6] + "\n"), nil
+		}
+		return []byte(entry + "\n"), nil
+	}
+}
+
+func TestGetShell(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	commandOutput := fakeUserDatabase(map[string]string{
+		"root":   "root:x:0:0:root:/root:/bin/bash",
+		"user":   "user:x:1000:1000:User:/home/user:/usr/bin/zsh",
+		"broken": "broken",
+	})
+	newUserLookup := func(username string, env map[string]string) userLookup {
+		return userLookup{
+			currentUser: func() (*user.User, error) {
+				if username == "" {
+					return nil, errors.New("lookup failed")
+				}
+				return &user.User{Username: username}, nil
+			},
+			homeDir: func() (string, error) {
+				return "/home/user", nil
+			},
+			getenv: func(key string) string {
+				return env[key]
+			},
+			commandOutput: commandOutput,
+		}
+	}
+
+	env := map[string]string{
+		"SHELL": "/bin/sh",
+	}
+	assert.Equal(t, "/usr/bin/zsh", newUserLookup("user", env).getShell())
+	assert.Equal(t, "/bin/sh", newUserLookup("other", env).getShell())
+	assert.Equal(t, "/bin/sh", newUserLookup("", env).getShell())
+	assert.Equal(t, "", newUserLookup("", nil).getShell())
+
+	c := newTestConfig(fs, withUserLookup(newUserLookup("user", env)))
+	assert.Equal(t, "/bin/bash", c.lookupUserShellTemplateFunc("root"))
+	assert.Equal(t, "", c.lookupUserShellTemplateFunc("broken"))
+	assert.Equal(t, "", c.lookupUserShellTemplateFunc("missing"))
+
+	data, err := c.getDefaultData()
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/bin/zsh", data["shell"])
+}
+
+func TestGetShellNoUserDatabase(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	c := newTestConfig(fs, withUserLookup(userLookup{
+		currentUser: func() (*user.User, error) {
+			return nil, errors.New("lookup failed")
+		},
+		homeDir: func() (string, error) {
+			return "/home/user", nil
+		},
+		getenv: func(string) string {
+			return ""
+		},
+		commandOutput: func(string, ...string) ([]byte, error) {
+			return nil, errors.New("not found")
+		},
+	}))
+	assert.Equal(t, "", c.lookupUserShellTemplateFunc("user"))
+	data, err := c.getDefaultData()
+	require.NoError(t, err)
+	assert.Equal(t, "", data["shell"])
+	assert.Equal(t, map[string]interface{}{
+		"language": "",
+		"region":   "",
+	}, data["locale"])
+}
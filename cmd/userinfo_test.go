@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLocale(t *testing.T) {
+	for _, tc := range []struct {
+		locale           string
+		expectedLanguage string
+		expectedRegion   string
+	}{
+		{
+			locale: "",
+		},
+		{
+			locale: "C",
+		},
+		{
+			locale: "C.UTF-8",
+		},
+		{
+			locale: "POSIX",
+		},
+		{
+			locale:           "en",
+			expectedLanguage: "en",
+		},
+		{
+			locale:           "en_US.UTF-8",
+			expectedLanguage: "en",
+			expectedRegion:   "US",
+		},
+		{
+			locale:           "de_DE@euro",
+			expectedLanguage: "de",
+			expectedRegion:   "DE",
+		},
+		{
+			locale:           "en-GB",
+			expectedLanguage: "en",
+			expectedRegion:   "GB",
+		},
+		{
+			locale:           "zh-Hans-CN",
+			expectedLanguage: "zh",
+			expectedRegion:   "CN",
+		},
+		{
+			locale:           "es-419",
+			expectedLanguage: "es",
+			expectedRegion:   "419",
+		},
+	} {
+		t.Run(tc.locale, func(t *testing.T) {
+			language, region := parseLocale(tc.locale)
+			assert.Equal(t, tc.expectedLanguage, language)
+			assert.Equal(t, tc.expectedRegion, region)
+		})
+	}
+}
+
+func TestGetLocale(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		env      map[string]string
+		expected map[string]interface{}
+	}{
+		{
+			name: "lang",
+			env: map[string]string{
+				"LANG": "fr_CA.UTF-8",
+			},
+			expected: map[string]interface{}{
+				"language": "fr",
+				"region":   "CA",
+			},
+		},
+		{
+			name: "lc_all_overrides_lang",
+			env: map[string]string{
+				"LANG":   "fr_CA.UTF-8",
+				"LC_ALL": "en_US.UTF-8",
+			},
+			expected: map[string]interface{}{
+				"language": "en",
+				"region":   "US",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ul := userLookup{
+				getenv: func(key string) string {
+					return tc.env[key]
+				},
+			}
+			assert.Equal(t, tc.expected, ul.getLocale())
+		})
+	}
+}
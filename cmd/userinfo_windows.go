@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// userPreferredUILanguages returns the user's preferred UI languages as
+// language tags. It is a variable so that tests can replace it.
+var userPreferredUILanguages = func() ([]string, error) {
+	return windows.GetUserPreferredUILanguages(windows.MUI_LANGUAGE_NAME)
+}
+
+// parentProcessName returns the executable name of the parent process. It is a
+// variable so that tests can replace it.
+var parentProcessName = func() (string, error) {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return "", err
+	}
+	defer windows.CloseHandle(snapshot)
+	entries := make(map[uint32]windows.ProcessEntry32)
+	entry := windows.ProcessEntry32{Size: uint32(unsafe.Sizeof(windows.ProcessEntry32{}))}
+	for err = windows.Process32First(snapshot, &entry); err == nil; err = windows.Process32Next(snapshot, &entry) {
+		entries[entry.ProcessID] = entry
+	}
+	self, ok := entries[uint32(os.Getpid())]
+	if !ok {
+		return "", errors.New("current process not found")
+	}
+	parent, ok := entries[self.ParentProcessID]
+	if !ok {
+		return "", errors.New("parent process not found")
+	}
+	return windows.UTF16ToString(parent.ExeFile[:]), nil
+}
+
+// getShell returns the current user's shell. $SHELL is used if it is set, for
+// example by MSYS2 or Cygwin. Otherwise, if chezmoi was run from PowerShell
+// then PowerShell is used, and otherwise $ComSpec, which is normally cmd.exe.
+// $PSModulePath cannot be used to detect PowerShell as it is set system-wide.
+func (ul userLookup) getShell() string {
+	if shell := ul.getenv("SHELL"); shell != "" {
+		return shell
+	}
+	if name, err := parentProcessName(); err == nil {
+		for _, powerShell := range []string{"powershell.exe", "pwsh.exe"} {
+			if strings.EqualFold(name, powerShell) {
+				return powerShell
+			}
+		}
+	}
+	if comSpec := ul.getenv("ComSpec"); comSpec != "" {
+		return comSpec
+	}
+	return "cmd.exe"
+}
+
+// lookupShell returns username's shell if username is the current user, with
+// or without their domain, and the empty string otherwise, as Windows does not
+// record users' shells.
+func (ul userLookup) lookupShell(username string) string {
+	currentUsername := ul.getUsername()
+	if currentUsername == "" {
+		return ""
+	}
+	if strings.EqualFold(username, currentUsername) || strings.EqualFold(username, currentUsername[strings.LastIndex(currentUsername, `\`)+1:]) {
+		return ul.getShell()
+	}
+	return ""
+}
+
+// systemLocale returns the user's preferred UI language, or the empty string if
+// it cannot be determined.
+func systemLocale() string {
+	languages, err := userPreferredUILanguages()
+	if err != nil || len(languages) == 0 {
+		return ""
+	}
+	return languages[0]
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"errors"
+	"os/user"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetShell(t *testing.T) {
+	oldParentProcessName := parentProcessName
+	defer func() {
+		parentProcessName = oldParentProcessName
+	}()
+
+	for _, tc := range []struct {
+		name     string
+		env      map[string]string
+		parent   string
+		expected string
+	}{
+		{
+			name: "msys2",
+			env: map[string]string{
+				"SHELL": "/usr/bin/bash",
+			},
+			parent:   "bash.exe",
+			expected: "/usr/bin/bash",
+		},
+		{
+			name: "powershell",
+			env: map[string]string{
+				"ComSpec":      `C:\Windows\system32\cmd.exe`,
+				"PSModulePath": `C:\Program Files\WindowsPowerShell\Modules`,
+			},
+			parent:   "powershell.exe",
+			expected: "powershell.exe",
+		},
+		{
+			name: "pwsh",
+			env: map[string]string{
+				"ComSpec": `C:\Windows\system32\cmd.exe`,
+			},
+			parent:   "PWSH.EXE",
+			expected: "pwsh.exe",
+		},
+		{
+			name: "cmd",
+			env: map[string]string{
+				"ComSpec":      `C:\Windows\system32\cmd.exe`,
+				"PSModulePath": `C:\Program Files\WindowsPowerShell\Modules`,
+			},
+			parent:   "cmd.exe",
+			expected: `C:\Windows\system32\cmd.exe`,
+		},
+		{
+			name:     "none",
+			expected: "cmd.exe",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			parentProcessName = func() (string, error) {
+				if tc.parent == "" {
+					return "", errors.New("parent process not found")
+				}
+				return tc.parent, nil
+			}
+			ul := userLookup{
+				currentUser: func() (*user.User, error) {
+					return &user.User{Username: `DOMAIN\user`}, nil
+				},
+				getenv: func(key string) string {
+					return tc.env[key]
+				},
+			}
+			assert.Equal(t, tc.expected, ul.getShell())
+			assert.Equal(t, tc.expected, ul.lookupShell("user"))
+			assert.Equal(t, tc.expected, ul.lookupShell(`DOMAIN\user`))
+			assert.Equal(t, "", ul.lookupShell("other"))
+		})
+	}
+}
+
+func TestSystemLocale(t *testing.T) {
+	oldUserPreferredUILanguages := userPreferredUILanguages
+	defer func() {
+		userPreferredUILanguages = oldUserPreferredUILanguages
+	}()
+
+	userPreferredUILanguages = func() ([]string, error) {
+		return []string{"pt-BR", "en-US"}, nil
+	}
+	ul := userLookup{
+		getenv: func(string) string {
+			return ""
+		},
+	}
+	assert.Equal(t, map[string]interface{}{
+		"language": "pt",
+		"region":   "BR",
+	}, ul.getLocale())
+
+	userPreferredUILanguages = func() ([]string, error) {
+		return nil, errors.New("not supported")
+	}
+	assert.Equal(t, map[string]interface{}{
+		"language": "",
+		"region":   "",
+	}, ul.getLocale())
+}
@@ -5,12 +5,19 @@ import "regexp"
 // A VCS is a version control system.
 type VCS interface {
 	AddArgs(string) []string
+	AheadBehindArgs() []string
+	ArchiveArgs(string) []string
 	CloneArgs(string, string) []string
 	CommitArgs(string) []string
+	FetchArgs() []string
+	HeadArgs() []string
+	IncomingArgs() []string
 	InitArgs() []string
+	ParseAheadBehindOutput([]byte) (int, int, error)
 	ParseStatusOutput([]byte) (interface{}, error)
 	PullArgs() []string
 	PushArgs() []string
+	RemoteURLArgs() []string
 	StatusArgs() []string
 	VersionArgs() []string
 	VersionRegexp() *regexp.Regexp
@@ -1,9 +1,12 @@
 package cmd
 
 import (
-	"os"
+	"fmt"
+	"path/filepath"
+	"sort"
 
 	"github.com/spf13/cobra"
+	vfs "github.com/twpayne/go-vfs"
 	bolt "go.etcd.io/bbolt"
 
 	"github.com/twpayne/chezmoi/internal/chezmoi"
@@ -18,15 +21,32 @@ var verifyCmd = &cobra.Command{
 	RunE:    config.runVerifyCmd,
 }
 
+type verifyCmdConfig struct {
+	quiet bool
+}
+
 func init() {
 	rootCmd.AddCommand(verifyCmd)
 
-	markRemainingZshCompPositionalArgumentsAsFiles(verifyCmd, 1)
+	persistentFlags := verifyCmd.PersistentFlags()
+	persistentFlags.StringArrayVar(&config.exclude, "exclude", nil, "exclude entry types or targets matching pattern")
+	persistentFlags.BoolVar(&config.excludeEncrypted, "exclude-encrypted", false, "exclude encrypted targets")
+	persistentFlags.BoolVarP(&config.verify.quiet, "quiet", "q", false, "do not list targets that differ")
+	persistentFlags.BoolVar(&config.symlink, "symlink", false, "apply plain files as symlinks to their source files")
 }
 
 func (c *Config) runVerifyCmd(cmd *cobra.Command, args []string) error {
-	mutator := chezmoi.NewAnyMutator(chezmoi.NullMutator{})
-	c.mutator = mutator
+	// verify opens the persistent state read-only, so nothing that apply
+	// records, such as run_once_ scripts and the one-time warning about
+	// encrypted files becoming private, can be written. A dry run records
+	// nothing and runs no scripts.
+	c.DryRun = true
+	c.Verbose = false // Only list targets that differ.
+
+	// Scripts have no state in the destination directory, so the
+	// StatusMutator, which only records changes to paths, ignores them.
+	statusMutator := chezmoi.NewStatusMutator(chezmoi.NullMutator{}, vfs.NewReadOnlyFS(c.fs))
+	c.mutator = statusMutator
 
 	persistentState, err := c.getPersistentState(&bolt.Options{
 		ReadOnly: true,
@@ -39,8 +59,28 @@ func (c *Config) runVerifyCmd(cmd *cobra.Command, args []string) error {
 	if err := c.applyArgs(args, persistentState); err != nil {
 		return err
 	}
-	if mutator.Mutated() {
-		os.Exit(1)
+
+	statuses := statusMutator.Statuses()
+	if len(statuses) == 0 {
+		return nil
+	}
+	if !c.verify.quiet {
+		destDir, err := filepath.Abs(c.DestDir)
+		if err != nil {
+			return err
+		}
+		targetNames := make([]string, 0, len(statuses))
+		for targetPath := range statuses {
+			targetName, err := filepath.Rel(destDir, targetPath)
+			if err != nil {
+				return err
+			}
+			targetNames = append(targetNames, targetName)
+		}
+		sort.Strings(targetNames)
+		for _, targetName := range targetNames {
+			fmt.Fprintln(c.Stdout, targetName)
+		}
 	}
-	return nil
+	return exitCodeError(1)
 }
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+func TestVerifyCmd(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		root           interface{}
+		args           []string
+		quiet          bool
+		expectedStdout string
+		expectedErr    error
+	}{
+		{
+			name: "match",
+			root: map[string]interface{}{
+				"/home/user/.bashrc": "# contents of .bashrc\n",
+				"/home/user/.local/share/chezmoi": map[string]interface{}{
+					"dot_bashrc": "# contents of .bashrc\n",
+					"run_script": "#!/bin/sh\n",
+				},
+			},
+		},
+		{
+			name: "differ",
+			root: map[string]interface{}{
+				"/home/user/.bashrc":  "# old contents of .bashrc\n",
+				"/home/user/.profile": "# contents of .profile\n",
+				"/home/user/.local/share/chezmoi": map[string]interface{}{
+					"dot_bashrc":             "# contents of .bashrc\n",
+					"dot_inputrc":            "# contents of .inputrc\n",
+					"executable_dot_profile": "# contents of .profile\n",
+				},
+			},
+			expectedStdout: ".bashrc\n.inputrc\n.profile\n",
+			expectedErr:    exitCodeError(1),
+		},
+		{
+			name: "differ_quiet",
+			root: map[string]interface{}{
+				"/home/user/.local/share/chezmoi": map[string]interface{}{
+					"dot_bashrc": "# contents of .bashrc\n",
+				},
+			},
+			quiet:       true,
+			expectedErr: exitCodeError(1),
+		},
+		{
+			name: "args",
+			root: map[string]interface{}{
+				"/home/user/.bashrc": "# contents of .bashrc\n",
+				"/home/user/.local/share/chezmoi": map[string]interface{}{
+					"dot_bashrc":  "# contents of .bashrc\n",
+					"dot_inputrc": "# contents of .inputrc\n",
+				},
+			},
+			args: []string{"/home/user/.bashrc"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(tc.root)
+			assert.NoError(t, err)
+			defer cleanup()
+			stdout := &bytes.Buffer{}
+			c := newTestConfig(fs, withStdout(stdout))
+			c.verify.quiet = tc.quiet
+			assert.Equal(t, tc.expectedErr, c.runVerifyCmd(nil, tc.args))
+			assert.Equal(t, tc.expectedStdout, stdout.String())
+			vfst.RunTests(t, fs, "",
+				vfst.TestPath("/home/user/.inputrc",
+					vfst.TestDoesNotExist,
+				),
+			)
+		})
+	}
+}
+
+func TestVerifyEncryptedPrivate(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.bashrc": "# contents of .bashrc\n",
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_bashrc":    "# contents of .bashrc\n",
+			"encrypted_foo": "ciphertext",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	// verify neither writes the read-only persistent state nor uses up the
+	// warning that encrypted files are now private.
+	stderr := &bytes.Buffer{}
+	c := newTestConfig(fs, withStderr(stderr))
+	c.excludeEncrypted = true
+	assert.NoError(t, c.runVerifyCmd(nil, nil))
+	assert.NotContains(t, stderr.String(), "encrypted files are now private")
+
+	stderr.Reset()
+	c = newTestConfig(fs, withStderr(stderr))
+	c.excludeEncrypted = true
+	require.NoError(t, c.runApplyCmd(nil, nil))
+	assert.Contains(t, stderr.String(), "encrypted files are now private")
+}
@@ -40,6 +40,12 @@ __chezmoi_handle_go_custom_completion()
 {
     __chezmoi_debug "${FUNCNAME[0]}: cur is ${cur}, words[*] is ${words[*]}, #words[@] is ${#words[@]}"
 
+    local shellCompDirectiveError=1
+    local shellCompDirectiveNoSpace=2
+    local shellCompDirectiveNoFileComp=4
+    local shellCompDirectiveFilterFileExt=8
+    local shellCompDirectiveFilterDirs=16
+
     local out requestComp lastParam lastChar comp directive args
 
     # Prepare the command to request completions for the program.
@@ -73,24 +79,50 @@ __chezmoi_handle_go_custom_completion()
     __chezmoi_debug "${FUNCNAME[0]}: the completion directive is: ${directive}"
     __chezmoi_debug "${FUNCNAME[0]}: the completions are: ${out[*]}"
 
-    if [ $((directive & 1)) -ne 0 ]; then
+    if [ $((directive & shellCompDirectiveError)) -ne 0 ]; then
         # Error code.  No completion.
         __chezmoi_debug "${FUNCNAME[0]}: received error from custom completion go code"
         return
     else
-        if [ $((directive & 2)) -ne 0 ]; then
+        if [ $((directive & shellCompDirectiveNoSpace)) -ne 0 ]; then
             if [[ $(type -t compopt) = "builtin" ]]; then
                 __chezmoi_debug "${FUNCNAME[0]}: activating no space"
                 compopt -o nospace
             fi
         fi
-        if [ $((directive & 4)) -ne 0 ]; then
+        if [ $((directive & shellCompDirectiveNoFileComp)) -ne 0 ]; then
             if [[ $(type -t compopt) = "builtin" ]]; then
                 __chezmoi_debug "${FUNCNAME[0]}: activating no file completion"
                 compopt +o default
             fi
         fi
+    fi
 
+    if [ $((directive & shellCompDirectiveFilterFileExt)) -ne 0 ]; then
+        # File extension filtering
+        local fullFilter filter filteringCmd
+        # Do not use quotes around the $out variable or else newline
+        # characters will be kept.
+        for filter in ${out[*]}; do
+            fullFilter+="$filter|"
+        done
+
+        filteringCmd="_filedir $fullFilter"
+        __chezmoi_debug "File filtering command: $filteringCmd"
+        $filteringCmd
+    elif [ $((directive & shellCompDirectiveFilterDirs)) -ne 0 ]; then
+        # File completion for directories only
+        local subDir
+        # Use printf to strip any trailing newline
+        subdir=$(printf "%s" "${out[0]}")
+        if [ -n "$subdir" ]; then
+            __chezmoi_debug "Listing directories in $subdir"
+            __chezmoi_handle_subdirs_in_dir_flag "$subdir"
+        else
+            __chezmoi_debug "Listing directories in ."
+            _filedir -d
+        fi
+    else
         while IFS='' read -r comp; do
             COMPREPLY+=("$comp")
         done < <(compgen -W "${out[*]}" -- "$cur")
@@ -159,10 +191,9 @@ __chezmoi_handle_reply()
     local completions
     completions=("${commands[@]}")
     if [[ ${#must_have_one_noun[@]} -ne 0 ]]; then
-        completions=("${must_have_one_noun[@]}")
+        completions+=("${must_have_one_noun[@]}")
     elif [[ -n "${has_completion_function}" ]]; then
         # if a go completion function is provided, defer to that function
-        completions=()
         __chezmoi_handle_go_custom_completion
     fi
     if [[ ${#must_have_one_flag[@]} -ne 0 ]]; then
@@ -338,6 +369,7 @@ _chezmoi_add()
 
     flags+=("--autotemplate")
     flags+=("-a")
+    flags+=("--create")
     flags+=("--empty")
     flags+=("-e")
     flags+=("--encrypt")
@@ -345,14 +377,21 @@ _chezmoi_add()
     flags+=("-x")
     flags+=("--force")
     flags+=("-f")
+    flags+=("--interactive")
+    flags+=("-i")
+    flags+=("--no-secret-check")
+    flags+=("--no-suffix")
     flags+=("--prompt")
     flags+=("-p")
     flags+=("--recursive")
     flags+=("-r")
     flags+=("--template")
     flags+=("-T")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -363,6 +402,9 @@ _chezmoi_add()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -389,8 +431,44 @@ _chezmoi_apply()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--allow-scripts")
+    flags+=("--branch=")
+    two_word_flags+=("--branch")
+    flags+=("--depth=")
+    two_word_flags+=("--depth")
+    flags+=("--exclude=")
+    two_word_flags+=("--exclude")
+    flags+=("--exclude-encrypted")
+    flags+=("--include=")
+    two_word_flags+=("--include")
+    flags_with_completion+=("--include")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    two_word_flags+=("-i")
+    flags_with_completion+=("-i")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--log-file=")
+    two_word_flags+=("--log-file")
+    flags+=("--log-format=")
+    two_word_flags+=("--log-format")
+    flags_with_completion+=("--log-format")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--no-backup")
+    flags+=("--no-prune")
+    flags+=("--prune")
+    flags+=("--remote=")
+    two_word_flags+=("--remote")
+    flags+=("--resume")
+    flags+=("--rewrite-symlinks")
+    flags+=("--symlink")
+    flags+=("--to=")
+    two_word_flags+=("--to")
+    flags+=("--trust")
+    flags+=("--with-scripts")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -401,6 +479,9 @@ _chezmoi_apply()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -427,8 +508,37 @@ _chezmoi_archive()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--decrypt")
+    flags+=("--exclude=")
+    two_word_flags+=("--exclude")
+    flags+=("--format=")
+    two_word_flags+=("--format")
+    flags_with_completion+=("--format")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    two_word_flags+=("-f")
+    flags_with_completion+=("-f")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--gzip")
+    flags+=("-z")
+    flags+=("--include=")
+    two_word_flags+=("--include")
+    flags_with_completion+=("--include")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    two_word_flags+=("-i")
+    flags_with_completion+=("-i")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--output=")
+    two_word_flags+=("--output")
+    flags_with_completion+=("--output")
+    flags_completion+=("_filedir")
+    two_word_flags+=("-o")
+    flags_with_completion+=("-o")
+    flags_completion+=("_filedir")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -439,6 +549,9 @@ _chezmoi_archive()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -465,8 +578,11 @@ _chezmoi_cat()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -477,6 +593,9 @@ _chezmoi_cat()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -503,8 +622,11 @@ _chezmoi_cd()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -515,6 +637,9 @@ _chezmoi_cd()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -541,8 +666,11 @@ _chezmoi_chattr()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -553,6 +681,9 @@ _chezmoi_chattr()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -562,6 +693,7 @@ _chezmoi_chattr()
 
     must_have_one_flag=()
     must_have_one_noun=()
+    has_completion_function=1
     noun_aliases=()
 }
 
@@ -579,9 +711,13 @@ _chezmoi_completion()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--force")
+    flags+=("-f")
     flags+=("--help")
     flags+=("-h")
     local_nonpersistent_flags+=("--help")
+    local_nonpersistent_flags+=("-h")
+    flags+=("--install")
     flags+=("--output=")
     two_word_flags+=("--output")
     flags_with_completion+=("--output")
@@ -589,8 +725,11 @@ _chezmoi_completion()
     two_word_flags+=("-o")
     flags_with_completion+=("-o")
     flags_completion+=("_filedir")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -601,6 +740,9 @@ _chezmoi_completion()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -612,6 +754,7 @@ _chezmoi_completion()
     must_have_one_noun=()
     must_have_one_noun+=("bash")
     must_have_one_noun+=("fish")
+    must_have_one_noun+=("powershell")
     must_have_one_noun+=("zsh")
     noun_aliases=()
 }
@@ -632,9 +775,19 @@ _chezmoi_data()
 
     flags+=("--format=")
     two_word_flags+=("--format")
+    flags_with_completion+=("--format")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     two_word_flags+=("-f")
+    flags_with_completion+=("-f")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--origins")
+    flags+=("--resolve=")
+    two_word_flags+=("--resolve")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -645,6 +798,9 @@ _chezmoi_data()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -671,12 +827,42 @@ _chezmoi_diff()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--allow-scripts")
+    flags+=("--branch=")
+    two_word_flags+=("--branch")
+    flags+=("--depth=")
+    two_word_flags+=("--depth")
+    flags+=("--exclude=")
+    two_word_flags+=("--exclude")
+    flags+=("--exclude-encrypted")
     flags+=("--format=")
     two_word_flags+=("--format")
+    flags_with_completion+=("--format")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     two_word_flags+=("-f")
+    flags_with_completion+=("-f")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--include=")
+    two_word_flags+=("--include")
+    flags_with_completion+=("--include")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    two_word_flags+=("-i")
+    flags_with_completion+=("-i")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--no-pager")
+    flags+=("--remote=")
+    two_word_flags+=("--remote")
+    flags+=("--revision=")
+    two_word_flags+=("--revision")
+    two_word_flags+=("-r")
+    flags+=("--stat")
+    flags+=("--symlink")
+    flags+=("--trust")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -687,6 +873,9 @@ _chezmoi_diff()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -713,8 +902,11 @@ _chezmoi_docs()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -725,6 +917,9 @@ _chezmoi_docs()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -751,8 +946,11 @@ _chezmoi_doctor()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -763,6 +961,9 @@ _chezmoi_doctor()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -789,13 +990,81 @@ _chezmoi_dump()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--decrypt")
+    flags+=("--exclude=")
+    two_word_flags+=("--exclude")
     flags+=("--format=")
     two_word_flags+=("--format")
+    flags_with_completion+=("--format")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     two_word_flags+=("-f")
+    flags_with_completion+=("-f")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--include=")
+    two_word_flags+=("--include")
+    flags_with_completion+=("--include")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    two_word_flags+=("-i")
+    flags_with_completion+=("-i")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--recursive")
     flags+=("-r")
+    flags+=("--allow-sudo")
+    flags+=("--color=")
+    two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--config=")
+    two_word_flags+=("--config")
+    two_word_flags+=("-c")
+    flags+=("--debug")
+    flags+=("--destination=")
+    two_word_flags+=("--destination")
+    two_word_flags+=("-D")
+    flags+=("--dry-run")
+    flags+=("-n")
+    flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
+    flags+=("--remove")
+    flags+=("--source=")
+    two_word_flags+=("--source")
+    two_word_flags+=("-S")
+    flags+=("--verbose")
+    flags+=("-v")
+
+    must_have_one_flag=()
+    must_have_one_noun=()
+    noun_aliases=()
+}
+
+_chezmoi_dump-config()
+{
+    last_command="chezmoi_dump-config"
+
+    command_aliases=()
+
+    commands=()
+
+    flags=()
+    two_word_flags=()
+    local_nonpersistent_flags=()
+    flags_with_completion=()
+    flags_completion=()
+
+    flags+=("--format=")
+    two_word_flags+=("--format")
+    flags_with_completion+=("--format")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    two_word_flags+=("-f")
+    flags_with_completion+=("-f")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -806,6 +1075,9 @@ _chezmoi_dump()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -836,10 +1108,15 @@ _chezmoi_edit()
     flags+=("-a")
     flags+=("--diff")
     flags+=("-d")
+    flags+=("--exclude=")
+    two_word_flags+=("--exclude")
     flags+=("--prompt")
     flags+=("-p")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -850,6 +1127,9 @@ _chezmoi_edit()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -876,8 +1156,11 @@ _chezmoi_edit-config()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -888,6 +1171,9 @@ _chezmoi_edit-config()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -914,16 +1200,25 @@ _chezmoi_execute-template()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--cache-secrets")
     flags+=("--init")
     flags+=("-i")
     flags+=("--output=")
     two_word_flags+=("--output")
     two_word_flags+=("-o")
+    flags+=("--promptBool=")
+    two_word_flags+=("--promptBool")
+    flags+=("--promptInt=")
+    two_word_flags+=("--promptInt")
     flags+=("--promptString=")
     two_word_flags+=("--promptString")
     two_word_flags+=("-p")
+    flags+=("--watch")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -934,6 +1229,9 @@ _chezmoi_execute-template()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -960,8 +1258,13 @@ _chezmoi_forget()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--exclude=")
+    two_word_flags+=("--exclude")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -972,6 +1275,9 @@ _chezmoi_forget()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -984,9 +1290,9 @@ _chezmoi_forget()
     noun_aliases=()
 }
 
-_chezmoi_git()
+_chezmoi_generate()
 {
-    last_command="chezmoi_git"
+    last_command="chezmoi_generate"
 
     command_aliases=()
 
@@ -998,8 +1304,24 @@ _chezmoi_git()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--format=")
+    two_word_flags+=("--format")
+    flags_with_completion+=("--format")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--output=")
+    two_word_flags+=("--output")
+    flags_with_completion+=("--output")
+    flags_completion+=("_filedir")
+    two_word_flags+=("-o")
+    flags_with_completion+=("-o")
+    flags_completion+=("_filedir")
+    flags+=("--repo=")
+    two_word_flags+=("--repo")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1010,6 +1332,9 @@ _chezmoi_git()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1019,12 +1344,13 @@ _chezmoi_git()
 
     must_have_one_flag=()
     must_have_one_noun=()
+    must_have_one_noun+=("install.sh")
     noun_aliases=()
 }
 
-_chezmoi_hg()
+_chezmoi_git()
 {
-    last_command="chezmoi_hg"
+    last_command="chezmoi_git"
 
     command_aliases=()
 
@@ -1036,8 +1362,11 @@ _chezmoi_hg()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1048,6 +1377,9 @@ _chezmoi_hg()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1060,9 +1392,9 @@ _chezmoi_hg()
     noun_aliases=()
 }
 
-_chezmoi_import()
+_chezmoi_help()
 {
-    last_command="chezmoi_import"
+    last_command="chezmoi_help"
 
     command_aliases=()
 
@@ -1074,14 +1406,11 @@ _chezmoi_import()
     flags_with_completion=()
     flags_completion=()
 
-    flags+=("--exact")
-    flags+=("-x")
-    flags+=("--remove-destination")
-    flags+=("-r")
-    flags+=("--strip-components=")
-    two_word_flags+=("--strip-components")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1092,6 +1421,9 @@ _chezmoi_import()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1104,9 +1436,9 @@ _chezmoi_import()
     noun_aliases=()
 }
 
-_chezmoi_init()
+_chezmoi_hg()
 {
-    last_command="chezmoi_init"
+    last_command="chezmoi_hg"
 
     command_aliases=()
 
@@ -1118,9 +1450,11 @@ _chezmoi_init()
     flags_with_completion=()
     flags_completion=()
 
-    flags+=("--apply")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1131,6 +1465,9 @@ _chezmoi_init()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1143,9 +1480,9 @@ _chezmoi_init()
     noun_aliases=()
 }
 
-_chezmoi_managed()
+_chezmoi_import()
 {
-    last_command="chezmoi_managed"
+    last_command="chezmoi_import"
 
     command_aliases=()
 
@@ -1157,11 +1494,28 @@ _chezmoi_managed()
     flags_with_completion=()
     flags_completion=()
 
-    flags+=("--include=")
-    two_word_flags+=("--include")
-    two_word_flags+=("-i")
+    flags+=("--branch=")
+    two_word_flags+=("--branch")
+    flags+=("--depth=")
+    two_word_flags+=("--depth")
+    flags+=("--exact")
+    flags+=("-x")
+    flags+=("--exclude=")
+    two_word_flags+=("--exclude")
+    flags+=("--path=")
+    two_word_flags+=("--path")
+    flags+=("--remove-destination")
+    flags+=("-r")
+    flags+=("--repo=")
+    two_word_flags+=("--repo")
+    flags+=("--strip-components=")
+    two_word_flags+=("--strip-components")
+    flags+=("--update")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1172,6 +1526,9 @@ _chezmoi_managed()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1181,12 +1538,13 @@ _chezmoi_managed()
 
     must_have_one_flag=()
     must_have_one_noun=()
+    has_completion_function=1
     noun_aliases=()
 }
 
-_chezmoi_merge()
+_chezmoi_init()
 {
-    last_command="chezmoi_merge"
+    last_command="chezmoi_init"
 
     command_aliases=()
 
@@ -1198,8 +1556,23 @@ _chezmoi_merge()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--apply")
+    flags+=("--branch=")
+    two_word_flags+=("--branch")
+    flags+=("--depth=")
+    two_word_flags+=("--depth")
+    flags+=("--log-file=")
+    two_word_flags+=("--log-file")
+    flags+=("--log-format=")
+    two_word_flags+=("--log-format")
+    flags_with_completion+=("--log-format")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--trust")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1210,6 +1583,9 @@ _chezmoi_merge()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1222,9 +1598,9 @@ _chezmoi_merge()
     noun_aliases=()
 }
 
-_chezmoi_purge()
+_chezmoi_lint()
 {
-    last_command="chezmoi_purge"
+    last_command="chezmoi_lint"
 
     command_aliases=()
 
@@ -1236,10 +1612,19 @@ _chezmoi_purge()
     flags_with_completion=()
     flags_completion=()
 
-    flags+=("--force")
-    flags+=("-f")
+    flags+=("--format=")
+    two_word_flags+=("--format")
+    flags_with_completion+=("--format")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    two_word_flags+=("-f")
+    flags_with_completion+=("-f")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--no-decrypt")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1250,6 +1635,9 @@ _chezmoi_purge()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1262,9 +1650,9 @@ _chezmoi_purge()
     noun_aliases=()
 }
 
-_chezmoi_remove()
+_chezmoi_managed()
 {
-    last_command="chezmoi_remove"
+    last_command="chezmoi_managed"
 
     command_aliases=()
 
@@ -1276,10 +1664,28 @@ _chezmoi_remove()
     flags_with_completion=()
     flags_completion=()
 
-    flags+=("--force")
-    flags+=("-f")
+    flags+=("--exclude=")
+    two_word_flags+=("--exclude")
+    flags+=("--format=")
+    two_word_flags+=("--format")
+    flags_with_completion+=("--format")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    two_word_flags+=("-f")
+    flags_with_completion+=("-f")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--include=")
+    two_word_flags+=("--include")
+    flags_with_completion+=("--include")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    two_word_flags+=("-i")
+    flags_with_completion+=("-i")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--with-source-dir")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1290,6 +1696,9 @@ _chezmoi_remove()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1302,9 +1711,9 @@ _chezmoi_remove()
     noun_aliases=()
 }
 
-_chezmoi_secret_bitwarden()
+_chezmoi_merge()
 {
-    last_command="chezmoi_secret_bitwarden"
+    last_command="chezmoi_merge"
 
     command_aliases=()
 
@@ -1316,8 +1725,11 @@ _chezmoi_secret_bitwarden()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1328,6 +1740,9 @@ _chezmoi_secret_bitwarden()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1340,9 +1755,9 @@ _chezmoi_secret_bitwarden()
     noun_aliases=()
 }
 
-_chezmoi_secret_generic()
+_chezmoi_purge()
 {
-    last_command="chezmoi_secret_generic"
+    last_command="chezmoi_purge"
 
     command_aliases=()
 
@@ -1354,8 +1769,13 @@ _chezmoi_secret_generic()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--force")
+    flags+=("-f")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1366,6 +1786,9 @@ _chezmoi_secret_generic()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1378,9 +1801,9 @@ _chezmoi_secret_generic()
     noun_aliases=()
 }
 
-_chezmoi_secret_gopass()
+_chezmoi_re-add()
 {
-    last_command="chezmoi_secret_gopass"
+    last_command="chezmoi_re-add"
 
     command_aliases=()
 
@@ -1392,8 +1815,13 @@ _chezmoi_secret_gopass()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--exclude=")
+    two_word_flags+=("--exclude")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1404,6 +1832,9 @@ _chezmoi_secret_gopass()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1416,9 +1847,9 @@ _chezmoi_secret_gopass()
     noun_aliases=()
 }
 
-_chezmoi_secret_keepassxc()
+_chezmoi_remove()
 {
-    last_command="chezmoi_secret_keepassxc"
+    last_command="chezmoi_remove"
 
     command_aliases=()
 
@@ -1430,8 +1861,15 @@ _chezmoi_secret_keepassxc()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--exclude=")
+    two_word_flags+=("--exclude")
+    flags+=("--force")
+    flags+=("-f")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1442,6 +1880,9 @@ _chezmoi_secret_keepassxc()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1454,9 +1895,9 @@ _chezmoi_secret_keepassxc()
     noun_aliases=()
 }
 
-_chezmoi_secret_keyring_get()
+_chezmoi_secret_aws-secrets-manager()
 {
-    last_command="chezmoi_secret_keyring_get"
+    last_command="chezmoi_secret_aws-secrets-manager"
 
     command_aliases=()
 
@@ -1468,8 +1909,11 @@ _chezmoi_secret_keyring_get()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1480,14 +1924,13 @@ _chezmoi_secret_keyring_get()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
-    flags+=("--service=")
-    two_word_flags+=("--service")
     flags+=("--source=")
     two_word_flags+=("--source")
     two_word_flags+=("-S")
-    flags+=("--user=")
-    two_word_flags+=("--user")
     flags+=("--verbose")
     flags+=("-v")
 
@@ -1496,9 +1939,9 @@ _chezmoi_secret_keyring_get()
     noun_aliases=()
 }
 
-_chezmoi_secret_keyring_set()
+_chezmoi_secret_bitwarden()
 {
-    last_command="chezmoi_secret_keyring_set"
+    last_command="chezmoi_secret_bitwarden"
 
     command_aliases=()
 
@@ -1510,10 +1953,11 @@ _chezmoi_secret_keyring_set()
     flags_with_completion=()
     flags_completion=()
 
-    flags+=("--password=")
-    two_word_flags+=("--password")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1524,14 +1968,13 @@ _chezmoi_secret_keyring_set()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
-    flags+=("--service=")
-    two_word_flags+=("--service")
     flags+=("--source=")
     two_word_flags+=("--source")
     two_word_flags+=("-S")
-    flags+=("--user=")
-    two_word_flags+=("--user")
     flags+=("--verbose")
     flags+=("-v")
 
@@ -1540,15 +1983,13 @@ _chezmoi_secret_keyring_set()
     noun_aliases=()
 }
 
-_chezmoi_secret_keyring()
+_chezmoi_secret_generic()
 {
-    last_command="chezmoi_secret_keyring"
+    last_command="chezmoi_secret_generic"
 
     command_aliases=()
 
     commands=()
-    commands+=("get")
-    commands+=("set")
 
     flags=()
     two_word_flags=()
@@ -1556,12 +1997,11 @@ _chezmoi_secret_keyring()
     flags_with_completion=()
     flags_completion=()
 
-    flags+=("--service=")
-    two_word_flags+=("--service")
-    flags+=("--user=")
-    two_word_flags+=("--user")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1572,6 +2012,9 @@ _chezmoi_secret_keyring()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1580,15 +2023,13 @@ _chezmoi_secret_keyring()
     flags+=("-v")
 
     must_have_one_flag=()
-    must_have_one_flag+=("--service=")
-    must_have_one_flag+=("--user=")
     must_have_one_noun=()
     noun_aliases=()
 }
 
-_chezmoi_secret_lastpass()
+_chezmoi_secret_gopass()
 {
-    last_command="chezmoi_secret_lastpass"
+    last_command="chezmoi_secret_gopass"
 
     command_aliases=()
 
@@ -1600,8 +2041,11 @@ _chezmoi_secret_lastpass()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1612,6 +2056,9 @@ _chezmoi_secret_lastpass()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1624,9 +2071,9 @@ _chezmoi_secret_lastpass()
     noun_aliases=()
 }
 
-_chezmoi_secret_onepassword()
+_chezmoi_secret_keepassxc()
 {
-    last_command="chezmoi_secret_onepassword"
+    last_command="chezmoi_secret_keepassxc"
 
     command_aliases=()
 
@@ -1638,8 +2085,11 @@ _chezmoi_secret_onepassword()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1650,6 +2100,9 @@ _chezmoi_secret_onepassword()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1662,9 +2115,9 @@ _chezmoi_secret_onepassword()
     noun_aliases=()
 }
 
-_chezmoi_secret_pass()
+_chezmoi_secret_keyring_get()
 {
-    last_command="chezmoi_secret_pass"
+    last_command="chezmoi_secret_keyring_get"
 
     command_aliases=()
 
@@ -1676,8 +2129,11 @@ _chezmoi_secret_pass()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1688,10 +2144,17 @@ _chezmoi_secret_pass()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
+    flags+=("--service=")
+    two_word_flags+=("--service")
     flags+=("--source=")
     two_word_flags+=("--source")
     two_word_flags+=("-S")
+    flags+=("--user=")
+    two_word_flags+=("--user")
     flags+=("--verbose")
     flags+=("-v")
 
@@ -1700,9 +2163,9 @@ _chezmoi_secret_pass()
     noun_aliases=()
 }
 
-_chezmoi_secret_vault()
+_chezmoi_secret_keyring_set()
 {
-    last_command="chezmoi_secret_vault"
+    last_command="chezmoi_secret_keyring_set"
 
     command_aliases=()
 
@@ -1714,8 +2177,13 @@ _chezmoi_secret_vault()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--password=")
+    two_word_flags+=("--password")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1726,10 +2194,17 @@ _chezmoi_secret_vault()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
+    flags+=("--service=")
+    two_word_flags+=("--service")
     flags+=("--source=")
     two_word_flags+=("--source")
     two_word_flags+=("-S")
+    flags+=("--user=")
+    two_word_flags+=("--user")
     flags+=("--verbose")
     flags+=("-v")
 
@@ -1738,22 +2213,15 @@ _chezmoi_secret_vault()
     noun_aliases=()
 }
 
-_chezmoi_secret()
+_chezmoi_secret_keyring()
 {
-    last_command="chezmoi_secret"
+    last_command="chezmoi_secret_keyring"
 
     command_aliases=()
 
     commands=()
-    commands+=("bitwarden")
-    commands+=("generic")
-    commands+=("gopass")
-    commands+=("keepassxc")
-    commands+=("keyring")
-    commands+=("lastpass")
-    commands+=("onepassword")
-    commands+=("pass")
-    commands+=("vault")
+    commands+=("get")
+    commands+=("set")
 
     flags=()
     two_word_flags=()
@@ -1761,8 +2229,15 @@ _chezmoi_secret()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--service=")
+    two_word_flags+=("--service")
+    flags+=("--user=")
+    two_word_flags+=("--user")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1773,6 +2248,9 @@ _chezmoi_secret()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1781,13 +2259,15 @@ _chezmoi_secret()
     flags+=("-v")
 
     must_have_one_flag=()
+    must_have_one_flag+=("--service=")
+    must_have_one_flag+=("--user=")
     must_have_one_noun=()
     noun_aliases=()
 }
 
-_chezmoi_source()
+_chezmoi_secret_lastpass()
 {
-    last_command="chezmoi_source"
+    last_command="chezmoi_secret_lastpass"
 
     command_aliases=()
 
@@ -1799,8 +2279,11 @@ _chezmoi_source()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1811,6 +2294,9 @@ _chezmoi_source()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1823,9 +2309,9 @@ _chezmoi_source()
     noun_aliases=()
 }
 
-_chezmoi_source-path()
+_chezmoi_secret_onepassword()
 {
-    last_command="chezmoi_source-path"
+    last_command="chezmoi_secret_onepassword"
 
     command_aliases=()
 
@@ -1837,8 +2323,11 @@ _chezmoi_source-path()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1849,6 +2338,9 @@ _chezmoi_source-path()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1861,9 +2353,9 @@ _chezmoi_source-path()
     noun_aliases=()
 }
 
-_chezmoi_unmanaged()
+_chezmoi_secret_pass()
 {
-    last_command="chezmoi_unmanaged"
+    last_command="chezmoi_secret_pass"
 
     command_aliases=()
 
@@ -1875,8 +2367,641 @@ _chezmoi_unmanaged()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--allow-sudo")
+    flags+=("--color=")
+    two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--config=")
+    two_word_flags+=("--config")
+    two_word_flags+=("-c")
+    flags+=("--debug")
+    flags+=("--destination=")
+    two_word_flags+=("--destination")
+    two_word_flags+=("-D")
+    flags+=("--dry-run")
+    flags+=("-n")
+    flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
+    flags+=("--remove")
+    flags+=("--source=")
+    two_word_flags+=("--source")
+    two_word_flags+=("-S")
+    flags+=("--verbose")
+    flags+=("-v")
+
+    must_have_one_flag=()
+    must_have_one_noun=()
+    noun_aliases=()
+}
+
+_chezmoi_secret_vault()
+{
+    last_command="chezmoi_secret_vault"
+
+    command_aliases=()
+
+    commands=()
+
+    flags=()
+    two_word_flags=()
+    local_nonpersistent_flags=()
+    flags_with_completion=()
+    flags_completion=()
+
+    flags+=("--allow-sudo")
+    flags+=("--color=")
+    two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--config=")
+    two_word_flags+=("--config")
+    two_word_flags+=("-c")
+    flags+=("--debug")
+    flags+=("--destination=")
+    two_word_flags+=("--destination")
+    two_word_flags+=("-D")
+    flags+=("--dry-run")
+    flags+=("-n")
+    flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
+    flags+=("--remove")
+    flags+=("--source=")
+    two_word_flags+=("--source")
+    two_word_flags+=("-S")
+    flags+=("--verbose")
+    flags+=("-v")
+
+    must_have_one_flag=()
+    must_have_one_noun=()
+    noun_aliases=()
+}
+
+_chezmoi_secret()
+{
+    last_command="chezmoi_secret"
+
+    command_aliases=()
+
+    commands=()
+    commands+=("aws-secrets-manager")
+    commands+=("bitwarden")
+    commands+=("generic")
+    commands+=("gopass")
+    commands+=("keepassxc")
+    commands+=("keyring")
+    commands+=("lastpass")
+    commands+=("onepassword")
+    commands+=("pass")
+    commands+=("vault")
+
+    flags=()
+    two_word_flags=()
+    local_nonpersistent_flags=()
+    flags_with_completion=()
+    flags_completion=()
+
+    flags+=("--allow-sudo")
+    flags+=("--color=")
+    two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--config=")
+    two_word_flags+=("--config")
+    two_word_flags+=("-c")
+    flags+=("--debug")
+    flags+=("--destination=")
+    two_word_flags+=("--destination")
+    two_word_flags+=("-D")
+    flags+=("--dry-run")
+    flags+=("-n")
+    flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
+    flags+=("--remove")
+    flags+=("--source=")
+    two_word_flags+=("--source")
+    two_word_flags+=("-S")
+    flags+=("--verbose")
+    flags+=("-v")
+
+    must_have_one_flag=()
+    must_have_one_noun=()
+    noun_aliases=()
+}
+
+_chezmoi_source()
+{
+    last_command="chezmoi_source"
+
+    command_aliases=()
+
+    commands=()
+
+    flags=()
+    two_word_flags=()
+    local_nonpersistent_flags=()
+    flags_with_completion=()
+    flags_completion=()
+
+    flags+=("--allow-sudo")
+    flags+=("--color=")
+    two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--config=")
+    two_word_flags+=("--config")
+    two_word_flags+=("-c")
+    flags+=("--debug")
+    flags+=("--destination=")
+    two_word_flags+=("--destination")
+    two_word_flags+=("-D")
+    flags+=("--dry-run")
+    flags+=("-n")
+    flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
+    flags+=("--remove")
+    flags+=("--source=")
+    two_word_flags+=("--source")
+    two_word_flags+=("-S")
+    flags+=("--verbose")
+    flags+=("-v")
+
+    must_have_one_flag=()
+    must_have_one_noun=()
+    noun_aliases=()
+}
+
+_chezmoi_source-path()
+{
+    last_command="chezmoi_source-path"
+
+    command_aliases=()
+
+    commands=()
+
+    flags=()
+    two_word_flags=()
+    local_nonpersistent_flags=()
+    flags_with_completion=()
+    flags_completion=()
+
+    flags+=("--allow-sudo")
+    flags+=("--color=")
+    two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--config=")
+    two_word_flags+=("--config")
+    two_word_flags+=("-c")
+    flags+=("--debug")
+    flags+=("--destination=")
+    two_word_flags+=("--destination")
+    two_word_flags+=("-D")
+    flags+=("--dry-run")
+    flags+=("-n")
+    flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
+    flags+=("--remove")
+    flags+=("--source=")
+    two_word_flags+=("--source")
+    two_word_flags+=("-S")
+    flags+=("--verbose")
+    flags+=("-v")
+
+    must_have_one_flag=()
+    must_have_one_noun=()
+    noun_aliases=()
+}
+
+_chezmoi_state_delete-bucket()
+{
+    last_command="chezmoi_state_delete-bucket"
+
+    command_aliases=()
+
+    commands=()
+
+    flags=()
+    two_word_flags=()
+    local_nonpersistent_flags=()
+    flags_with_completion=()
+    flags_completion=()
+
+    flags+=("--allow-sudo")
+    flags+=("--bucket=")
+    two_word_flags+=("--bucket")
+    two_word_flags+=("-b")
+    flags+=("--color=")
+    two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--config=")
+    two_word_flags+=("--config")
+    two_word_flags+=("-c")
+    flags+=("--debug")
+    flags+=("--destination=")
+    two_word_flags+=("--destination")
+    two_word_flags+=("-D")
+    flags+=("--dry-run")
+    flags+=("-n")
+    flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
+    flags+=("--remove")
+    flags+=("--source=")
+    two_word_flags+=("--source")
+    two_word_flags+=("-S")
+    flags+=("--verbose")
+    flags+=("-v")
+
+    must_have_one_flag=()
+    must_have_one_noun=()
+    noun_aliases=()
+}
+
+_chezmoi_state_dump()
+{
+    last_command="chezmoi_state_dump"
+
+    command_aliases=()
+
+    commands=()
+
+    flags=()
+    two_word_flags=()
+    local_nonpersistent_flags=()
+    flags_with_completion=()
+    flags_completion=()
+
+    flags+=("--format=")
+    two_word_flags+=("--format")
+    flags_with_completion+=("--format")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    two_word_flags+=("-f")
+    flags_with_completion+=("-f")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--allow-sudo")
+    flags+=("--bucket=")
+    two_word_flags+=("--bucket")
+    two_word_flags+=("-b")
+    flags+=("--color=")
+    two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--config=")
+    two_word_flags+=("--config")
+    two_word_flags+=("-c")
+    flags+=("--debug")
+    flags+=("--destination=")
+    two_word_flags+=("--destination")
+    two_word_flags+=("-D")
+    flags+=("--dry-run")
+    flags+=("-n")
+    flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
+    flags+=("--remove")
+    flags+=("--source=")
+    two_word_flags+=("--source")
+    two_word_flags+=("-S")
+    flags+=("--verbose")
+    flags+=("-v")
+
+    must_have_one_flag=()
+    must_have_one_noun=()
+    noun_aliases=()
+}
+
+_chezmoi_state_orphans()
+{
+    last_command="chezmoi_state_orphans"
+
+    command_aliases=()
+
+    commands=()
+
+    flags=()
+    two_word_flags=()
+    local_nonpersistent_flags=()
+    flags_with_completion=()
+    flags_completion=()
+
+    flags+=("--allow-sudo")
+    flags+=("--bucket=")
+    two_word_flags+=("--bucket")
+    two_word_flags+=("-b")
+    flags+=("--color=")
+    two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--config=")
+    two_word_flags+=("--config")
+    two_word_flags+=("-c")
+    flags+=("--debug")
+    flags+=("--destination=")
+    two_word_flags+=("--destination")
+    two_word_flags+=("-D")
+    flags+=("--dry-run")
+    flags+=("-n")
+    flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
+    flags+=("--remove")
+    flags+=("--source=")
+    two_word_flags+=("--source")
+    two_word_flags+=("-S")
+    flags+=("--verbose")
+    flags+=("-v")
+
+    must_have_one_flag=()
+    must_have_one_noun=()
+    noun_aliases=()
+}
+
+_chezmoi_state_prune()
+{
+    last_command="chezmoi_state_prune"
+
+    command_aliases=()
+
+    commands=()
+
+    flags=()
+    two_word_flags=()
+    local_nonpersistent_flags=()
+    flags_with_completion=()
+    flags_completion=()
+
+    flags+=("--force")
+    flags+=("-f")
+    flags+=("--allow-sudo")
+    flags+=("--bucket=")
+    two_word_flags+=("--bucket")
+    two_word_flags+=("-b")
+    flags+=("--color=")
+    two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--config=")
+    two_word_flags+=("--config")
+    two_word_flags+=("-c")
+    flags+=("--debug")
+    flags+=("--destination=")
+    two_word_flags+=("--destination")
+    two_word_flags+=("-D")
+    flags+=("--dry-run")
+    flags+=("-n")
+    flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
+    flags+=("--remove")
+    flags+=("--source=")
+    two_word_flags+=("--source")
+    two_word_flags+=("-S")
+    flags+=("--verbose")
+    flags+=("-v")
+
+    must_have_one_flag=()
+    must_have_one_noun=()
+    noun_aliases=()
+}
+
+_chezmoi_state_reset()
+{
+    last_command="chezmoi_state_reset"
+
+    command_aliases=()
+
+    commands=()
+
+    flags=()
+    two_word_flags=()
+    local_nonpersistent_flags=()
+    flags_with_completion=()
+    flags_completion=()
+
+    flags+=("--force")
+    flags+=("-f")
+    flags+=("--allow-sudo")
+    flags+=("--bucket=")
+    two_word_flags+=("--bucket")
+    two_word_flags+=("-b")
+    flags+=("--color=")
+    two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--config=")
+    two_word_flags+=("--config")
+    two_word_flags+=("-c")
+    flags+=("--debug")
+    flags+=("--destination=")
+    two_word_flags+=("--destination")
+    two_word_flags+=("-D")
+    flags+=("--dry-run")
+    flags+=("-n")
+    flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
+    flags+=("--remove")
+    flags+=("--source=")
+    two_word_flags+=("--source")
+    two_word_flags+=("-S")
+    flags+=("--verbose")
+    flags+=("-v")
+
+    must_have_one_flag=()
+    must_have_one_noun=()
+    noun_aliases=()
+}
+
+_chezmoi_state_revoke-trust()
+{
+    last_command="chezmoi_state_revoke-trust"
+
+    command_aliases=()
+
+    commands=()
+
+    flags=()
+    two_word_flags=()
+    local_nonpersistent_flags=()
+    flags_with_completion=()
+    flags_completion=()
+
+    flags+=("--allow-sudo")
+    flags+=("--bucket=")
+    two_word_flags+=("--bucket")
+    two_word_flags+=("-b")
+    flags+=("--color=")
+    two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--config=")
+    two_word_flags+=("--config")
+    two_word_flags+=("-c")
+    flags+=("--debug")
+    flags+=("--destination=")
+    two_word_flags+=("--destination")
+    two_word_flags+=("-D")
+    flags+=("--dry-run")
+    flags+=("-n")
+    flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
+    flags+=("--remove")
+    flags+=("--source=")
+    two_word_flags+=("--source")
+    two_word_flags+=("-S")
+    flags+=("--verbose")
+    flags+=("-v")
+
+    must_have_one_flag=()
+    must_have_one_noun=()
+    noun_aliases=()
+}
+
+_chezmoi_state()
+{
+    last_command="chezmoi_state"
+
+    command_aliases=()
+
+    commands=()
+    commands+=("delete-bucket")
+    commands+=("dump")
+    commands+=("orphans")
+    commands+=("prune")
+    commands+=("reset")
+    commands+=("revoke-trust")
+
+    flags=()
+    two_word_flags=()
+    local_nonpersistent_flags=()
+    flags_with_completion=()
+    flags_completion=()
+
+    flags+=("--bucket=")
+    two_word_flags+=("--bucket")
+    two_word_flags+=("-b")
+    flags+=("--allow-sudo")
+    flags+=("--color=")
+    two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--config=")
+    two_word_flags+=("--config")
+    two_word_flags+=("-c")
+    flags+=("--debug")
+    flags+=("--destination=")
+    two_word_flags+=("--destination")
+    two_word_flags+=("-D")
+    flags+=("--dry-run")
+    flags+=("-n")
+    flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
+    flags+=("--remove")
+    flags+=("--source=")
+    two_word_flags+=("--source")
+    two_word_flags+=("-S")
+    flags+=("--verbose")
+    flags+=("-v")
+
+    must_have_one_flag=()
+    must_have_one_noun=()
+    noun_aliases=()
+}
+
+_chezmoi_status()
+{
+    last_command="chezmoi_status"
+
+    command_aliases=()
+
+    commands=()
+
+    flags=()
+    two_word_flags=()
+    local_nonpersistent_flags=()
+    flags_with_completion=()
+    flags_completion=()
+
+    flags+=("--source-drift")
+    flags+=("--allow-sudo")
+    flags+=("--color=")
+    two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--config=")
+    two_word_flags+=("--config")
+    two_word_flags+=("-c")
+    flags+=("--debug")
+    flags+=("--destination=")
+    two_word_flags+=("--destination")
+    two_word_flags+=("-D")
+    flags+=("--dry-run")
+    flags+=("-n")
+    flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
+    flags+=("--remove")
+    flags+=("--source=")
+    two_word_flags+=("--source")
+    two_word_flags+=("-S")
+    flags+=("--verbose")
+    flags+=("-v")
+
+    must_have_one_flag=()
+    must_have_one_noun=()
+    noun_aliases=()
+}
+
+_chezmoi_unmanaged()
+{
+    last_command="chezmoi_unmanaged"
+
+    command_aliases=()
+
+    commands=()
+
+    flags=()
+    two_word_flags=()
+    local_nonpersistent_flags=()
+    flags_with_completion=()
+    flags_completion=()
+
+    flags+=("--path-style=")
+    two_word_flags+=("--path-style")
+    flags_with_completion+=("--path-style")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    two_word_flags+=("-p")
+    flags_with_completion+=("-p")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--recursive")
+    flags+=("-r")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1887,6 +3012,9 @@ _chezmoi_unmanaged()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1915,8 +3043,20 @@ _chezmoi_update()
 
     flags+=("--apply")
     flags+=("-a")
+    flags+=("--check")
+    flags+=("--log-file=")
+    two_word_flags+=("--log-file")
+    flags+=("--log-format=")
+    two_word_flags+=("--log-format")
+    flags_with_completion+=("--log-format")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
+    flags+=("--poll=")
+    two_word_flags+=("--poll")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1927,6 +3067,9 @@ _chezmoi_update()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -1957,15 +3100,22 @@ _chezmoi_upgrade()
     flags+=("-f")
     flags+=("--method=")
     two_word_flags+=("--method")
+    flags_with_completion+=("--method")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     two_word_flags+=("-m")
+    flags_with_completion+=("-m")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--owner=")
     two_word_flags+=("--owner")
     two_word_flags+=("-o")
     flags+=("--repo=")
     two_word_flags+=("--repo")
     two_word_flags+=("-r")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -1976,6 +3126,9 @@ _chezmoi_upgrade()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -2002,8 +3155,17 @@ _chezmoi_verify()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--exclude=")
+    two_word_flags+=("--exclude")
+    flags+=("--exclude-encrypted")
+    flags+=("--quiet")
+    flags+=("-q")
+    flags+=("--symlink")
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -2014,6 +3176,9 @@ _chezmoi_verify()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -2049,6 +3214,7 @@ _chezmoi_root_command()
     commands+=("docs")
     commands+=("doctor")
     commands+=("dump")
+    commands+=("dump-config")
     commands+=("edit")
     commands+=("edit-config")
     commands+=("execute-template")
@@ -2057,13 +3223,17 @@ _chezmoi_root_command()
         command_aliases+=("unmanage")
         aliashash["unmanage"]="forget"
     fi
+    commands+=("generate")
     commands+=("git")
+    commands+=("help")
     commands+=("hg")
     commands+=("import")
     commands+=("init")
+    commands+=("lint")
     commands+=("managed")
     commands+=("merge")
     commands+=("purge")
+    commands+=("re-add")
     commands+=("remove")
     if [[ -z "${BASH_VERSION}" || "${BASH_VERSINFO[0]}" -gt 3 ]]; then
         command_aliases+=("rm")
@@ -2072,6 +3242,8 @@ _chezmoi_root_command()
     commands+=("secret")
     commands+=("source")
     commands+=("source-path")
+    commands+=("state")
+    commands+=("status")
     commands+=("unmanaged")
     commands+=("update")
     commands+=("upgrade")
@@ -2083,8 +3255,11 @@ _chezmoi_root_command()
     flags_with_completion=()
     flags_completion=()
 
+    flags+=("--allow-sudo")
     flags+=("--color=")
     two_word_flags+=("--color")
+    flags_with_completion+=("--color")
+    flags_completion+=("__chezmoi_handle_go_custom_completion")
     flags+=("--config=")
     two_word_flags+=("--config")
     two_word_flags+=("-c")
@@ -2095,6 +3270,9 @@ _chezmoi_root_command()
     flags+=("--dry-run")
     flags+=("-n")
     flags+=("--follow")
+    flags+=("--no-persistent-state")
+    flags+=("--no-prompt")
+    flags+=("--relative-to-dest")
     flags+=("--remove")
     flags+=("--source=")
     two_word_flags+=("--source")
@@ -0,0 +1,49 @@
+package chezmoi
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// Age interfaces with age.
+type Age struct {
+	Command        string
+	Identity       string
+	Recipient      string
+	RecipientsFile string
+}
+
+// Decrypt decrypts ciphertext with a's identity.
+func (a *Age) Decrypt(ciphertext []byte) ([]byte, error) {
+	if a.Identity == "" {
+		return nil, errors.New("age.identity not set")
+	}
+	return a.run(ciphertext, "--decrypt", "--identity", a.Identity)
+}
+
+// Encrypt encrypts plaintext for a's recipients.
+func (a *Age) Encrypt(plaintext []byte) ([]byte, error) {
+	args := []string{"--armor"}
+	if a.Recipient != "" {
+		args = append(args, "--recipient", a.Recipient)
+	}
+	if a.RecipientsFile != "" {
+		args = append(args, "--recipients-file", a.RecipientsFile)
+	}
+	if len(args) == 1 {
+		return nil, errors.New("neither age.recipient nor age.recipientsFile set")
+	}
+	return a.run(plaintext, args...)
+}
+
+// run runs a's command with args, passing input on its standard input, and
+// returns its standard output.
+func (a *Age) run(input []byte, args ...string) ([]byte, error) {
+	//nolint:gosec
+	cmd := exec.Command(a.Command, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = os.Stderr
+	return cmd.Output()
+}
@@ -0,0 +1,22 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ Encryption = &Age{}
+	_ Encryption = &GPG{}
+)
+
+func TestAgeMissingKeys(t *testing.T) {
+	a := &Age{
+		Command: "age",
+	}
+	_, err := a.Decrypt([]byte("ciphertext"))
+	assert.EqualError(t, err, "age.identity not set")
+	_, err = a.Encrypt([]byte("plaintext"))
+	assert.EqualError(t, err, "neither age.recipient nor age.recipientsFile set")
+}
@@ -1,6 +1,7 @@
 package chezmoi
 
 import (
+	"io"
 	"os"
 	"os/exec"
 )
@@ -31,6 +32,12 @@ func (m *AnyMutator) IdempotentCmdOutput(cmd *exec.Cmd) ([]byte, error) {
 	return m.m.IdempotentCmdOutput(cmd)
 }
 
+// Lchown implements Mutator.Lchown.
+func (m *AnyMutator) Lchown(name string, uid, gid int) error {
+	m.mutated = true
+	return m.m.Lchown(name, uid, gid)
+}
+
 // Mkdir implements Mutator.Mkdir.
 func (m *AnyMutator) Mkdir(name string, perm os.FileMode) error {
 	m.mutated = true
@@ -71,6 +78,12 @@ func (m *AnyMutator) WriteFile(name string, data []byte, perm os.FileMode, currD
 	return m.m.WriteFile(name, data, perm, currData)
 }
 
+// WriteFileFrom implements Mutator.WriteFileFrom.
+func (m *AnyMutator) WriteFileFrom(name string, r io.Reader, size int64, perm os.FileMode) error {
+	m.mutated = true
+	return m.m.WriteFileFrom(name, r, size, perm)
+}
+
 // WriteSymlink implements Mutator.WriteSymlink.
 func (m *AnyMutator) WriteSymlink(oldname, newname string) error {
 	m.mutated = true
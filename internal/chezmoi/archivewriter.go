@@ -0,0 +1,128 @@
+package chezmoi
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// An archiveWriter writes entries to an archive.
+type archiveWriter interface {
+	writeDir(name string, perm os.FileMode) error
+	writeFile(name string, contents []byte, perm os.FileMode) error
+	writeFileFrom(name string, r io.Reader, size int64, perm os.FileMode) error
+	writeSymlink(name, linkname string) error
+}
+
+// A tarArchiveWriter writes entries to a tar archive. If owner is set then
+// entries with owners are owned by them in the archive.
+type tarArchiveWriter struct {
+	w              *tar.Writer
+	headerTemplate *tar.Header
+	owner          func(string) *Owner
+}
+
+// A zipArchiveWriter writes entries to a zip archive.
+type zipArchiveWriter struct {
+	w              *zip.Writer
+	headerTemplate *tar.Header
+}
+
+func (w *tarArchiveWriter) writeDir(name string, perm os.FileMode) error {
+	header := w.newHeader(name)
+	header.Typeflag = tar.TypeDir
+	header.Name = name
+	header.Mode = int64(fileModeToUnixPerm(perm))
+	return w.w.WriteHeader(&header)
+}
+
+func (w *tarArchiveWriter) writeFile(name string, contents []byte, perm os.FileMode) error {
+	return w.writeFileFrom(name, bytes.NewReader(contents), int64(len(contents)), perm)
+}
+
+// writeFileFrom writes a file with the size bytes read from r.
+func (w *tarArchiveWriter) writeFileFrom(name string, r io.Reader, size int64, perm os.FileMode) error {
+	header := w.newHeader(name)
+	header.Typeflag = tar.TypeReg
+	header.Name = name
+	header.Size = size
+	header.Mode = int64(fileModeToUnixPerm(perm))
+	if err := w.w.WriteHeader(&header); err != nil {
+		return err
+	}
+	_, err := io.CopyN(w.w, r, size)
+	return err
+}
+
+func (w *tarArchiveWriter) writeSymlink(name, linkname string) error {
+	header := w.newHeader(name)
+	header.Typeflag = tar.TypeSymlink
+	header.Name = name
+	header.Linkname = linkname
+	return w.w.WriteHeader(&header)
+}
+
+// newHeader returns a new tar header for name, owned by name's owner, if any,
+// or else by the owner in w's header template.
+func (w *tarArchiveWriter) newHeader(name string) tar.Header {
+	header := *w.headerTemplate
+	if w.owner == nil {
+		return header
+	}
+	if owner := w.owner(name); owner != nil {
+		header.Uid = owner.UID
+		header.Gid = owner.GID
+		header.Uname = owner.Username
+		header.Gname = owner.Groupname
+	}
+	return header
+}
+
+func (w *zipArchiveWriter) writeDir(name string, perm os.FileMode) error {
+	fileHeader := w.newFileHeader(name+"/", os.ModeDir|perm, zip.Store)
+	_, err := w.w.CreateHeader(fileHeader)
+	return err
+}
+
+func (w *zipArchiveWriter) writeFile(name string, contents []byte, perm os.FileMode) error {
+	return w.writeFileFrom(name, bytes.NewReader(contents), int64(len(contents)), perm)
+}
+
+// writeFileFrom writes a file with the size bytes read from r.
+func (w *zipArchiveWriter) writeFileFrom(name string, r io.Reader, size int64, perm os.FileMode) error {
+	fileHeader := w.newFileHeader(name, perm, zip.Deflate)
+	fileHeader.UncompressedSize64 = uint64(size)
+	fw, err := w.w.CreateHeader(fileHeader)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(fw, r, size)
+	return err
+}
+
+// writeSymlink writes a symlink using the zip convention of Unix mode bits with
+// the link target as the contents.
+func (w *zipArchiveWriter) writeSymlink(name, linkname string) error {
+	fileHeader := w.newFileHeader(name, os.ModeSymlink|0o777, zip.Store)
+	fw, err := w.w.CreateHeader(fileHeader)
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write([]byte(linkname))
+	return err
+}
+
+// newFileHeader returns a new zip file header for name, with its modification
+// time taken from w's header template.
+func (w *zipArchiveWriter) newFileHeader(name string, mode os.FileMode, method uint16) *zip.FileHeader {
+	fileHeader := &zip.FileHeader{
+		Name:     filepath.ToSlash(name),
+		Method:   method,
+		Modified: w.headerTemplate.ModTime,
+	}
+	fileHeader.SetMode(mode)
+	return fileHeader
+}
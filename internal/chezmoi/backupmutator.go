@@ -0,0 +1,265 @@
+package chezmoi
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	vfs "github.com/twpayne/go-vfs"
+)
+
+// A BackupMutator wraps a Mutator and, before each action that changes or
+// removes a path in the destination directory, copies the path's previous
+// state to a backup directory. Each path is backed up at most once.
+type BackupMutator struct {
+	m         Mutator
+	fs        vfs.FS
+	destDir   string
+	backupDir string
+	runDir    string
+	private   func(string) bool
+	backedUp  map[string]bool
+	created   bool
+}
+
+// NewBackupMutator returns a new BackupMutator that backs up paths in destDir
+// to the directory runName in backupDir. Backups are read from and written to
+// fs. The backup directory is created with mode 0700 when the first path is
+// backed up. Backups of paths for which private returns true have their group
+// and world permissions removed.
+func NewBackupMutator(m Mutator, fs vfs.FS, destDir, backupDir, runName string, private func(string) bool) *BackupMutator {
+	return &BackupMutator{
+		m:         m,
+		fs:        fs,
+		destDir:   destDir,
+		backupDir: backupDir,
+		runDir:    filepath.Join(backupDir, runName),
+		private:   private,
+		backedUp:  make(map[string]bool),
+	}
+}
+
+// Chmod implements Mutator.Chmod.
+func (m *BackupMutator) Chmod(name string, mode os.FileMode) error {
+	if err := m.backup(name, false); err != nil {
+		return err
+	}
+	return m.m.Chmod(name, mode)
+}
+
+// Created returns whether m has created its backup directory.
+func (m *BackupMutator) Created() bool {
+	return m.created
+}
+
+// IdempotentCmdOutput implements Mutator.IdempotentCmdOutput.
+func (m *BackupMutator) IdempotentCmdOutput(cmd *exec.Cmd) ([]byte, error) {
+	return m.m.IdempotentCmdOutput(cmd)
+}
+
+// Lchown implements Mutator.Lchown. Changing a target's owner does not change
+// its contents or mode, so it is not backed up.
+func (m *BackupMutator) Lchown(name string, uid, gid int) error {
+	return m.m.Lchown(name, uid, gid)
+}
+
+// Mkdir implements Mutator.Mkdir.
+func (m *BackupMutator) Mkdir(name string, perm os.FileMode) error {
+	return m.m.Mkdir(name, perm)
+}
+
+// RemoveAll implements Mutator.RemoveAll.
+func (m *BackupMutator) RemoveAll(name string) error {
+	if err := m.backup(name, true); err != nil {
+		return err
+	}
+	return m.m.RemoveAll(name)
+}
+
+// Rename implements Mutator.Rename.
+func (m *BackupMutator) Rename(oldpath, newpath string) error {
+	if err := m.backup(oldpath, true); err != nil {
+		return err
+	}
+	if err := m.backup(newpath, true); err != nil {
+		return err
+	}
+	return m.m.Rename(oldpath, newpath)
+}
+
+// RunCmd implements Mutator.RunCmd.
+func (m *BackupMutator) RunCmd(cmd *exec.Cmd) error {
+	return m.m.RunCmd(cmd)
+}
+
+// Stat implements Mutator.Stat.
+func (m *BackupMutator) Stat(name string) (os.FileInfo, error) {
+	return m.m.Stat(name)
+}
+
+// WriteFile implements Mutator.WriteFile.
+func (m *BackupMutator) WriteFile(name string, data []byte, perm os.FileMode, currData []byte) error {
+	if err := m.backup(name, true); err != nil {
+		return err
+	}
+	return m.m.WriteFile(name, data, perm, currData)
+}
+
+// WriteFileFrom implements Mutator.WriteFileFrom.
+func (m *BackupMutator) WriteFileFrom(name string, r io.Reader, size int64, perm os.FileMode) error {
+	if err := m.backup(name, true); err != nil {
+		return err
+	}
+	return m.m.WriteFileFrom(name, r, size, perm)
+}
+
+// WriteSymlink implements Mutator.WriteSymlink.
+func (m *BackupMutator) WriteSymlink(oldname, newname string) error {
+	if err := m.backup(newname, true); err != nil {
+		return err
+	}
+	return m.m.WriteSymlink(oldname, newname)
+}
+
+// backup backs up name, if it is in the destination directory and has not
+// already been backed up. If recursive is true then the contents of
+// directories are backed up too.
+func (m *BackupMutator) backup(name string, recursive bool) error {
+	relPath, ok := m.relPath(name)
+	if !ok || m.done(name, recursive) {
+		return nil
+	}
+	info, err := m.fs.Lstat(name)
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return err
+	}
+	if err := m.createRunDir(); err != nil {
+		return err
+	}
+	backupPath := filepath.Join(m.runDir, relPath)
+	if err := vfs.MkdirAll(m.fs, filepath.Dir(backupPath), 0o700); err != nil {
+		return err
+	}
+	if err := m.copy(name, backupPath, info, recursive, m.private != nil && m.private(name)); err != nil {
+		return err
+	}
+	// A directory that was not backed up recursively may still have its
+	// contents backed up later.
+	m.backedUp[name] = recursive || !info.IsDir()
+	return nil
+}
+
+// copy copies src, which has info, to dst. Existing backups are never
+// overwritten, as they record an earlier state.
+func (m *BackupMutator) copy(src, dst string, info os.FileInfo, recursive, private bool) error {
+	perm := info.Mode() & os.ModePerm
+	if private {
+		perm &^= 0o077
+	}
+	dstInfo, err := m.fs.Lstat(dst)
+	switch {
+	case err == nil && (!dstInfo.IsDir() || !info.IsDir()):
+		return nil
+	case err != nil && !os.IsNotExist(err):
+		return err
+	}
+	switch {
+	case info.Mode().IsRegular():
+		// Copy the file in chunks, as it may be too large to hold in memory.
+		if err := copyFile(m.fs, src, dst, perm&0o600); err != nil {
+			return err
+		}
+		return m.fs.Chmod(dst, perm)
+	case info.IsDir():
+		if dstInfo == nil {
+			if err := m.fs.Mkdir(dst, 0o700); err != nil {
+				return err
+			}
+		}
+		if recursive {
+			infos, err := m.fs.ReadDir(src)
+			if err != nil {
+				return err
+			}
+			for _, info := range infos {
+				if err := m.copy(filepath.Join(src, info.Name()), filepath.Join(dst, info.Name()), info, true, private); err != nil {
+					return err
+				}
+			}
+		}
+		if dstInfo != nil {
+			return nil
+		}
+		return m.fs.Chmod(dst, perm)
+	case info.Mode()&os.ModeType == os.ModeSymlink:
+		linkname, err := m.fs.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return m.fs.Symlink(linkname, dst)
+	default:
+		// Other file types, for example named pipes, have no contents to back
+		// up.
+		return nil
+	}
+}
+
+// createRunDir creates the directory for this run's backups, if it has not
+// already been created.
+func (m *BackupMutator) createRunDir() error {
+	if m.created {
+		return nil
+	}
+	// Only set the permissions of the backup directory if we create it, so
+	// that the user can choose to share an existing directory.
+	switch _, err := m.fs.Stat(m.backupDir); {
+	case os.IsNotExist(err):
+		if err := vfs.MkdirAll(m.fs, m.backupDir, 0o700); err != nil {
+			return err
+		}
+		if err := m.fs.Chmod(m.backupDir, 0o700); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	}
+	if err := m.fs.Mkdir(m.runDir, 0o700); err != nil {
+		return err
+	}
+	m.created = true
+	return nil
+}
+
+// done returns whether name, or a directory containing name that was backed
+// up recursively, has already been backed up. If recursive is true then a
+// directory must have been backed up with its contents.
+func (m *BackupMutator) done(name string, recursive bool) bool {
+	if full, ok := m.backedUp[name]; ok && (full || !recursive) {
+		return true
+	}
+	for dir := filepath.Dir(name); dir != m.destDir && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if m.backedUp[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// relPath returns name relative to the destination directory and whether name
+// should be backed up. Paths outside the destination directory and in the
+// backup directory are never backed up.
+func (m *BackupMutator) relPath(name string) (string, bool) {
+	if name == m.backupDir || strings.HasPrefix(name, m.backupDir+string(filepath.Separator)) {
+		return "", false
+	}
+	prefix := m.destDir + string(filepath.Separator)
+	if !strings.HasPrefix(name, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(name, prefix), true
+}
@@ -0,0 +1,102 @@
+// +build !windows
+
+package chezmoi
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+var _ Mutator = &BackupMutator{}
+
+func TestBackupMutator(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".bashrc": &vfst.File{
+				Perm:     0o644,
+				Contents: []byte("# old\n"),
+			},
+			".netrc": &vfst.File{
+				Perm:     0o644,
+				Contents: []byte("secret\n"),
+			},
+			".old": map[string]interface{}{
+				"foo":  "foo\n",
+				"link": &vfst.Symlink{Target: "foo"},
+			},
+			".cache/backup": &vfst.Dir{Perm: 0o755},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	private := func(name string) bool {
+		return name == "/home/user/.netrc"
+	}
+	m := NewBackupMutator(NewFSMutator(fs), fs, "/home/user", "/home/user/.cache/backup", "run", private)
+	require.NoError(t, m.WriteFile("/home/user/.bashrc", []byte("# new\n"), 0o644, []byte("# old\n")))
+	require.NoError(t, m.WriteFile("/home/user/.bashrc", []byte("# newer\n"), 0o644, []byte("# new\n")))
+	require.NoError(t, m.WriteFile("/home/user/.netrc", []byte("secret\n"), 0o600, []byte("secret\n")))
+	require.NoError(t, m.RemoveAll("/home/user/.old"))
+	require.NoError(t, m.WriteFile("/home/user/.new", []byte("new\n"), 0o644, nil))
+	require.NoError(t, m.WriteFile("/home/user/.cache/backup/foo", []byte("foo\n"), 0o644, nil))
+	require.True(t, m.Created())
+
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.cache/backup",
+			vfst.TestIsDir,
+			vfst.TestModePerm(0o755),
+		),
+		vfst.TestPath("/home/user/.cache/backup/run",
+			vfst.TestIsDir,
+			vfst.TestModePerm(0o700),
+		),
+		vfst.TestPath("/home/user/.cache/backup/run/.bashrc",
+			vfst.TestModeIsRegular,
+			vfst.TestModePerm(0o644),
+			vfst.TestContentsString("# old\n"),
+		),
+		vfst.TestPath("/home/user/.cache/backup/run/.netrc",
+			vfst.TestModeIsRegular,
+			vfst.TestModePerm(0o600),
+			vfst.TestContentsString("secret\n"),
+		),
+		vfst.TestPath("/home/user/.cache/backup/run/.old/foo",
+			vfst.TestContentsString("foo\n"),
+		),
+		vfst.TestPath("/home/user/.cache/backup/run/.old/link",
+			vfst.TestModeType(os.ModeSymlink),
+			vfst.TestSymlinkTarget("foo"),
+		),
+		vfst.TestPath("/home/user/.cache/backup/run/.new",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.cache/backup/run/.cache",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.old",
+			vfst.TestDoesNotExist,
+		),
+	)
+}
+
+func TestBackupMutatorLchown(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.bashrc": "# contents of .bashrc\n",
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	m := NewBackupMutator(NewFSMutator(fs), fs, "/home/user", "/home/user/.cache/backup", "run", nil)
+	require.NoError(t, m.Lchown("/home/user/.bashrc", os.Getuid(), os.Getgid()))
+	require.False(t, m.Created())
+
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.cache/backup",
+			vfst.TestDoesNotExist,
+		),
+	)
+}
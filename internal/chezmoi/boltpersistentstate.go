@@ -1,6 +1,7 @@
 package chezmoi
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 
@@ -67,6 +68,36 @@ func (b *BoltPersistentState) Delete(bucket, key []byte) error {
 	})
 }
 
+// DeleteBucket deletes bucket and all the keys and values in it. If bucket does
+// not exist then DeleteBucket does nothing.
+func (b *BoltPersistentState) DeleteBucket(bucket []byte) error {
+	if b.db == nil {
+		return nil
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(bucket); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+		return nil
+	})
+}
+
+// ForEach calls fn for each key and value in bucket. If bucket does not exist
+// then ForEach does nothing. The slices passed to fn are only valid until fn
+// returns.
+func (b *BoltPersistentState) ForEach(bucket []byte, fn func(k, v []byte) error) error {
+	if b.db == nil {
+		return nil
+	}
+	return b.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(fn)
+	})
+}
+
 // Get returns the value associated with key in bucket.
 func (b *BoltPersistentState) Get(bucket, key []byte) ([]byte, error) {
 	var value []byte
@@ -104,6 +135,37 @@ func (b *BoltPersistentState) Set(bucket, key, value []byte) error {
 	})
 }
 
+// Update sets the values associated with the keys of values in bucket in a
+// single transaction. Keys whose values are nil are deleted. bucket will be
+// created if it does not already exist.
+func (b *BoltPersistentState) Update(bucket []byte, values map[string][]byte) error {
+	if len(values) == 0 {
+		return nil
+	}
+	if b.db == nil {
+		if err := b.openDB(); err != nil {
+			return err
+		}
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		for key, value := range values {
+			if value == nil {
+				err = b.Delete([]byte(key))
+			} else {
+				err = b.Put([]byte(key), value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (b *BoltPersistentState) openDB() error {
 	if err := vfs.MkdirAll(b.fs, filepath.Dir(b.path), 0o777&^b.umask); err != nil {
 		return err
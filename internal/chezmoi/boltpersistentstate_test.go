@@ -71,6 +71,27 @@ func TestBoltPersistentState(t *testing.T) {
 	actualValue, err = b.Get(bucket, key)
 	require.NoError(t, err)
 	assert.Equal(t, []byte(nil), actualValue)
+
+	require.NoError(t, b.Update(bucket, map[string][]byte{
+		"key":  value,
+		"key2": nil,
+	}))
+	actualValue, err = b.Get(bucket, key)
+	require.NoError(t, err)
+	assert.Equal(t, value, actualValue)
+	require.NoError(t, b.Update(bucket, map[string][]byte{
+		"key": nil,
+	}))
+	actualValue, err = b.Get(bucket, key)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(nil), actualValue)
+
+	require.NoError(t, b.Set(bucket, key, value))
+	require.NoError(t, b.DeleteBucket(bucket))
+	actualValue, err = b.Get(bucket, key)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(nil), actualValue)
+	require.NoError(t, b.DeleteBucket(bucket))
 }
 
 func TestBoltPersistentStateReadOnly(t *testing.T) {
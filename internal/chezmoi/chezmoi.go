@@ -1,12 +1,14 @@
 package chezmoi
 
 import (
-	"archive/tar"
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
 	vfs "github.com/twpayne/go-vfs"
@@ -14,48 +16,268 @@ import (
 
 // Suffixes and prefixes.
 const (
+	afterPrefix      = "after_"
+	beforePrefix     = "before_"
+	concatPrefix     = "concat_"
+	createPrefix     = "create_"
 	dotPrefix        = "dot_"
 	emptyPrefix      = "empty_"
 	encryptedPrefix  = "encrypted_"
 	exactPrefix      = "exact_"
 	executablePrefix = "executable_"
+	linkPrefix       = "link_"
+	modifyPrefix     = "modify_"
 	oncePrefix       = "once_"
+	permPrefix       = "perm_"
 	privatePrefix    = "private_"
 	runPrefix        = "run_"
 	symlinkPrefix    = "symlink_"
 	TemplateSuffix   = ".tmpl"
 )
 
+// attributePrefixes are all the prefixes that encode attributes in source
+// names.
+var attributePrefixes = []string{
+	afterPrefix,
+	beforePrefix,
+	concatPrefix,
+	createPrefix,
+	dotPrefix,
+	emptyPrefix,
+	encryptedPrefix,
+	exactPrefix,
+	executablePrefix,
+	linkPrefix,
+	modifyPrefix,
+	oncePrefix,
+	permPrefix,
+	privatePrefix,
+	runPrefix,
+	symlinkPrefix,
+}
+
+// permMask is the mask of the permission bits of an os.FileMode, including the
+// setuid, setgid, and sticky bits.
+const permMask = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
 // A PersistentState is an interface to a persistent state.
 type PersistentState interface {
 	Close() error
 	Delete(bucket, key []byte) error
+	DeleteBucket(bucket []byte) error
+	ForEach(bucket []byte, fn func(k, v []byte) error) error
 	Get(bucket, key []byte) ([]byte, error)
 	Set(bucket, key, value []byte) error
+	Update(bucket []byte, values map[string][]byte) error
 }
 
 // An ApplyOptions is a big ball of mud for things that affect Entry.Apply.
 type ApplyOptions struct {
+	Completed         func(string) error
 	DestDir           string
 	DryRun            bool
+	ElevationFailed   func(string, *ElevationError) error
 	Ignore            func(string) bool
+	Include           func(Entry) bool
+	LogScript         func(string, int) error
 	PersistentState   PersistentState
 	Remove            bool
 	ScriptStateBucket []byte
+	Skip              func(string) bool
 	Stdout            io.Writer
 	Umask             os.FileMode
 	Verbose           bool
+	Version           string
+	// Owner, if set, returns the owner of the target with the given name, or
+	// nil if it keeps its current owner. Targets are given to their owners
+	// after they are applied.
+	Owner func(string) *Owner
+	// CanChangeOwner, if set, returns whether the target with the given name
+	// can be given to owner. It is only called for targets that are not
+	// already owned by owner.
+	CanChangeOwner func(string, *Owner) bool
+	// RewriteLinkname, if set, returns the target of the symlink that is
+	// written for each symlink_ entry with linkname.
+	RewriteLinkname func(string) string
+	// ScriptEnv is added to the environment of scripts.
+	ScriptEnv []string
+	// ScriptTempDirs are the directories in which scripts are written before
+	// they are run, in order of preference. The next directory is only used
+	// if scripts cannot be run from the previous one, for example because it
+	// is mounted noexec. If empty, the system temporary directory is used.
+	ScriptTempDirs []string
+	// skipOrderedScripts is set while applying entries between the before_
+	// and after_ scripts, which are run separately.
+	skipOrderedScripts bool
+	// order, if set, applies entries' prerequisites before them.
+	order *applyOrder
+}
+
+// ApplyEntry applies entry, skipping it if applyOptions.Skip returns true for
+// it or if applyOptions.Include is set and excludes it, and calling
+// applyOptions.Completed once it has been applied. Directories are applied if
+// they contain any included entries, so that their parents are created. If
+// applying entry fails because elevation failed and
+// applyOptions.ElevationFailed is set then it is called instead of returning
+// the error, so that only entry is skipped. Entry's target is given to its
+// owner, if any, after it is applied. Entry's prerequisites, if any, are
+// applied first, and each entry is only applied once.
+func ApplyEntry(entry Entry, fs vfs.FS, mutator Mutator, follow bool, applyOptions *ApplyOptions) error {
+	if script, ok := entry.(*Script); ok && applyOptions.skipOrderedScripts && (script.Before || script.After) {
+		return nil
+	}
+	if applyOptions.Skip != nil && applyOptions.Skip(entry.TargetName()) {
+		return nil
+	}
+	if applyOptions.Include != nil && FilterEntry(entry, applyOptions.Include) == nil {
+		return nil
+	}
+	if order := applyOptions.order; order != nil {
+		if order.started[entry] {
+			return nil
+		}
+		order.started[entry] = true
+		if err := order.applyPrerequisites(entry, fs, mutator, follow, applyOptions); err != nil {
+			return err
+		}
+	}
+	err := entry.Apply(fs, mutator, follow, applyOptions)
+	if err == nil {
+		err = applyOwner(entry, fs, mutator, applyOptions)
+	}
+	if err != nil {
+		var elevationErr *ElevationError
+		if errors.As(err, &elevationErr) && applyOptions.ElevationFailed != nil {
+			return applyOptions.ElevationFailed(entry.TargetName(), elevationErr)
+		}
+		return err
+	}
+	if applyOptions.Completed != nil {
+		return applyOptions.Completed(entry.TargetName())
+	}
+	return nil
+}
+
+// ApplyEntries applies entries in three phases. First, all scripts in entries
+// with the before_ attribute are run, then everything else is applied, and
+// finally all scripts with the after_ attribute are run. Scripts in each phase
+// run in order of their target names.
+func ApplyEntries(entries []Entry, fs vfs.FS, mutator Mutator, follow bool, applyOptions *ApplyOptions) error {
+	var beforeScripts, afterScripts []*Script
+	for _, entry := range entries {
+		beforeScripts, afterScripts = appendOrderedScripts(beforeScripts, afterScripts, entry)
+	}
+	for _, script := range sortedScripts(beforeScripts) {
+		if err := ApplyEntry(script, fs, mutator, follow, applyOptions); err != nil {
+			return err
+		}
+	}
+	duringApplyOptions := *applyOptions
+	duringApplyOptions.skipOrderedScripts = true
+	for _, entry := range entries {
+		if err := ApplyEntry(entry, fs, mutator, follow, &duringApplyOptions); err != nil {
+			return err
+		}
+	}
+	for _, script := range sortedScripts(afterScripts) {
+		if err := ApplyEntry(script, fs, mutator, follow, applyOptions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncryptedSourcePatterns returns glob patterns that match the source names of
+// all encrypted files and the bundles of all encrypted directories. They are
+// generated from every combination of the attributes that may precede the
+// encrypted_ prefix, so they stay in step with the attribute parsers.
+func EncryptedSourcePatterns() []string {
+	var patterns []string
+	for _, modify := range []bool{false, true} {
+		for _, link := range []bool{false, true} {
+			for _, create := range []bool{false, true} {
+				patterns = append(patterns, FileAttributes{
+					Name:      "*",
+					Mode:      0o666,
+					Create:    create,
+					Encrypted: true,
+					Link:      link,
+					Modify:    modify,
+				}.SourceName())
+			}
+		}
+	}
+	for _, concat := range []bool{false, true} {
+		dirSourceName := DirAttributes{
+			Name:      "*",
+			Concat:    concat,
+			Encrypted: true,
+			Perm:      0o777,
+		}.SourceName()
+		patterns = append(patterns, "**/"+dirSourceName+"/"+encryptedDirBundleName)
+	}
+	return patterns
+}
+
+// FilterEntry returns entry without the entries for which include returns
+// false, or nil if nothing remains. A directory is kept if it is included or if
+// it contains any included entries, even if it is not included itself.
+// Filtered directories are copies, so entry is never modified.
+func FilterEntry(entry Entry, include func(Entry) bool) Entry {
+	dir, ok := entry.(*Dir)
+	switch {
+	case !ok || len(dir.Entries) == 0:
+		if include(entry) {
+			return entry
+		}
+		return nil
+	default:
+		entries := FilterEntries(dir.Entries, include)
+		if len(entries) == 0 && !include(entry) {
+			return nil
+		}
+		filteredDir := *dir
+		filteredDir.Entries = entries
+		return &filteredDir
+	}
+}
+
+// FilterEntries returns the result of calling FilterEntry on each of entries.
+func FilterEntries(entries map[string]Entry, include func(Entry) bool) map[string]Entry {
+	filteredEntries := make(map[string]Entry, len(entries))
+	for name, entry := range entries {
+		if filteredEntry := FilterEntry(entry, include); filteredEntry != nil {
+			filteredEntries[name] = filteredEntry
+		}
+	}
+	return filteredEntries
 }
 
+// An EncryptedMode determines how encrypted files are exported by archive and
+// dump.
+type EncryptedMode int
+
+// Encrypted modes.
+const (
+	// EncryptedModeCiphertext exports encrypted files' ciphertext with their
+	// source names.
+	EncryptedModeCiphertext EncryptedMode = iota
+	// EncryptedModeSkip omits encrypted files.
+	EncryptedModeSkip
+	// EncryptedModeDecrypt exports encrypted files' decrypted contents.
+	EncryptedModeDecrypt
+)
+
 // An Entry is either a Dir, a File, or a Symlink.
 type Entry interface {
 	AppendAllEntries(allEntries []Entry) []Entry
 	Apply(fs vfs.FS, mutator Mutator, follow bool, applyOptions *ApplyOptions) error
-	ConcreteValue(ignore func(string) bool, sourceDir string, umask os.FileMode, recursive bool) (interface{}, error)
+	ConcreteValue(ignore func(string) bool, sourceDir string, umask os.FileMode, encryptedMode EncryptedMode, recursive bool) (interface{}, error)
 	Evaluate(ignore func(string) bool) error
 	SourceName() string
 	TargetName() string
-	archive(w *tar.Writer, ignore func(string) bool, headerTemplate *tar.Header, umask os.FileMode) error
+	archive(w archiveWriter, ignore func(string) bool, umask os.FileMode, encryptedMode EncryptedMode) error
+	sourceDirectory() string
 }
 
 type parsedSourceFilePath struct {
@@ -64,6 +286,119 @@ type parsedSourceFilePath struct {
 	scriptAttributes *ScriptAttributes
 }
 
+// name returns the name of the entry parsed from psfp.
+func (psfp parsedSourceFilePath) name() string {
+	if psfp.scriptAttributes != nil {
+		return psfp.scriptAttributes.Name
+	}
+	return psfp.fileAttributes.Name
+}
+
+// appendOrderedScripts appends the scripts with the before_ and after_
+// attributes in entry to beforeScripts and afterScripts respectively.
+func appendOrderedScripts(beforeScripts, afterScripts []*Script, entry Entry) ([]*Script, []*Script) {
+	switch entry := entry.(type) {
+	case *Dir:
+		for _, name := range sortedEntryNames(entry.Entries) {
+			beforeScripts, afterScripts = appendOrderedScripts(beforeScripts, afterScripts, entry.Entries[name])
+		}
+	case *Script:
+		switch {
+		case entry.Before:
+			beforeScripts = append(beforeScripts, entry)
+		case entry.After:
+			afterScripts = append(afterScripts, entry)
+		}
+	}
+	return beforeScripts, afterScripts
+}
+
+// attributePrefix returns the attribute prefix that name starts with, or the
+// empty string if name does not start with an attribute prefix. Target names
+// that start with an attribute prefix usually indicate that the attributes in
+// the source name are in the wrong order or malformed.
+func attributePrefix(name string) string {
+	for _, prefix := range attributePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
+
+// checkCanonicalSourceName returns an error if sourceName, the base name of an
+// entry in the source state, is not canonicalSourceName, the source name that
+// its parsed attributes are written as. Such source names contain attributes
+// that conflict or are in the wrong order, which would otherwise be silently
+// dropped or reordered.
+func checkCanonicalSourceName(sourceName, canonicalSourceName string) error {
+	if sourceName != canonicalSourceName {
+		return fmt.Errorf("invalid attributes, expected %s", canonicalSourceName)
+	}
+	return nil
+}
+
+// checkEmptySourceDir returns an error if the source directory at path, which
+// has the empty_ attribute and the target name targetName, contains anything
+// other than files and directories beginning with a dot, like .keep files.
+func checkEmptySourceDir(fs vfs.FS, path, targetName string) error {
+	infos, err := fs.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if !strings.HasPrefix(info.Name(), ".") {
+			return emptyDirContainsError(path, targetName, info.Name())
+		}
+	}
+	return nil
+}
+
+// emptyDirContainsError returns the error for the source directory at path,
+// which has the empty_ attribute and the target name targetName, containing
+// name. Source directories whose names begin with empty_ had no attribute in
+// earlier versions, so the error explains the attribute.
+func emptyDirContainsError(path, targetName, name string) error {
+	return fmt.Errorf("%s: contains %s, but the empty_ prefix makes target %s an empty directory", path, name, targetName)
+}
+
+// checkNotReplacingDir returns an error if the entry called name in entries is
+// a directory that contains entries, which would be removed from the target
+// state by replacing it with the entry from the source file at path.
+func checkNotReplacingDir(entries map[string]Entry, name, path string) error {
+	if dir, ok := entries[name].(*Dir); ok && len(dir.Entries) != 0 {
+		return fmt.Errorf("%s: replaces directory %s, which contains managed targets", path, dir.TargetName())
+	}
+	return nil
+}
+
+// checkRepresentableName returns an error if the target name targetName, whose
+// base name is name, would be parsed from sourceName as a different name, for
+// example because name starts with an attribute prefix.
+func checkRepresentableName(targetName, name, sourceName, parsedName string) error {
+	if parsedName != name {
+		return fmt.Errorf("%s: cannot be added, source name %s would be parsed as %s", targetName, sourceName, parsedName)
+	}
+	return nil
+}
+
+// chmodExplicitPerm ensures that the permissions of path are exactly perm,
+// including the setuid, setgid, and sticky bits.
+func chmodExplicitPerm(mutator Mutator, path string, perm os.FileMode) error {
+	info, err := mutator.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		// The mutator did not create path, for example in a dry run.
+		return nil
+	case err != nil:
+		return err
+	case info.Mode()&permMask == perm&permMask:
+		return nil
+	default:
+		return mutator.Chmod(path, perm&permMask)
+	}
+}
+
 // dirNames returns the dir names from dirAttributes.
 func dirNames(dirAttributes []DirAttributes) []string {
 	dns := make([]string, len(dirAttributes))
@@ -73,6 +408,22 @@ func dirNames(dirAttributes []DirAttributes) []string {
 	return dns
 }
 
+// fileModeToUnixPerm returns the Unix permission bits of mode, including the
+// setuid, setgid, and sticky bits.
+func fileModeToUnixPerm(mode os.FileMode) uint32 {
+	perm := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		perm |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= 0o1000
+	}
+	return perm
+}
+
 // isEmpty returns true if b should be considered empty.
 func isEmpty(b []byte) bool {
 	return len(bytes.TrimSpace(b)) == 0
@@ -107,6 +458,22 @@ func parseSourceFilePath(path string) parsedSourceFilePath {
 	}
 }
 
+// permAttribute returns the perm_ attribute for perm.
+func permAttribute(perm os.FileMode) string {
+	return fmt.Sprintf("%s%04o_", permPrefix, fileModeToUnixPerm(perm))
+}
+
+// sourcePath returns the path of entry in the source state. Entries populated
+// from a source directory other than defaultSourceDir record which one they
+// came from.
+func sourcePath(entry Entry, defaultSourceDir string) string {
+	sourceDir := entry.sourceDirectory()
+	if sourceDir == "" {
+		sourceDir = defaultSourceDir
+	}
+	return filepath.Join(sourceDir, entry.SourceName())
+}
+
 // sortedEntryNames returns a sorted slice of all entry names.
 func sortedEntryNames(entries map[string]Entry) []string {
 	entryNames := []string{}
@@ -117,6 +484,65 @@ func sortedEntryNames(entries map[string]Entry) []string {
 	return entryNames
 }
 
+// trimPermAttribute returns the permissions in the perm_ attribute at the start
+// of name, if any, and name with the attribute removed. The permissions are
+// three or four octal digits.
+func trimPermAttribute(name string) (os.FileMode, string, bool) {
+	if !strings.HasPrefix(name, permPrefix) {
+		return 0, name, false
+	}
+	rest := strings.TrimPrefix(name, permPrefix)
+	i := strings.IndexByte(rest, '_')
+	if i < 3 || i > 4 || i == len(rest)-1 {
+		return 0, name, false
+	}
+	perm, err := strconv.ParseUint(rest[:i], 8, 32)
+	if err != nil {
+		return 0, name, false
+	}
+	return unixPermToFileMode(uint32(perm)), rest[i+1:], true
+}
+
+// unixPermToFileMode returns the os.FileMode with the Unix permission bits
+// perm, including the setuid, setgid, and sticky bits.
+func unixPermToFileMode(perm uint32) os.FileMode {
+	mode := os.FileMode(perm & 0o777)
+	if perm&0o4000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if perm&0o2000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if perm&0o1000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// replacePathPrefix returns path with its longest prefix that is a key in m
+// replaced by the corresponding value. Prefixes only match whole path
+// components.
+func replacePathPrefix(m map[string]string, path string) string {
+	longestPrefix := ""
+	for prefix := range m {
+		if len(prefix) > len(longestPrefix) && (path == prefix || strings.HasPrefix(path, prefix+string(filepath.Separator))) {
+			longestPrefix = prefix
+		}
+	}
+	if longestPrefix == "" {
+		return path
+	}
+	return m[longestPrefix] + path[len(longestPrefix):]
+}
+
+// sortedScripts returns scripts sorted by target name.
+func sortedScripts(scripts []*Script) []*Script {
+	sort.Slice(scripts, func(i, j int) bool {
+		return scripts[i].targetName < scripts[j].targetName
+	})
+	return scripts
+}
+
 func splitPathList(path string) []string {
 	if strings.HasPrefix(path, string(filepath.Separator)) {
 		path = strings.TrimPrefix(path, string(filepath.Separator))
@@ -2,9 +2,12 @@ package chezmoi
 
 import (
 	"errors"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestReturnTemplateError(t *testing.T) {
@@ -30,3 +33,70 @@ func TestReturnTemplateError(t *testing.T) {
 		})
 	}
 }
+
+func TestFilterEntry(t *testing.T) {
+	dir := &Dir{
+		targetName: "dir",
+		Entries: map[string]Entry{
+			"file": &File{
+				targetName: "dir/file",
+			},
+			"subdir": &Dir{
+				targetName: "dir/subdir",
+				Entries: map[string]Entry{
+					"file": &File{
+						targetName: "dir/subdir/file",
+					},
+				},
+			},
+		},
+	}
+	for _, tc := range []struct {
+		name            string
+		include         func(Entry) bool
+		expectedEntries []string
+	}{
+		{
+			name: "dirs",
+			include: func(entry Entry) bool {
+				_, ok := entry.(*Dir)
+				return ok
+			},
+			expectedEntries: []string{"subdir"},
+		},
+		{
+			name: "files",
+			include: func(entry Entry) bool {
+				_, ok := entry.(*File)
+				return ok
+			},
+			expectedEntries: []string{"file", "subdir"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			filteredDir, ok := FilterEntry(dir, tc.include).(*Dir)
+			require.True(t, ok)
+			var entries []string
+			for name := range filteredDir.Entries {
+				entries = append(entries, name)
+			}
+			sort.Strings(entries)
+			assert.Equal(t, tc.expectedEntries, entries)
+			assert.Equal(t, 2, len(dir.Entries))
+		})
+	}
+}
+
+func TestEncryptedSourcePatterns(t *testing.T) {
+	for _, pattern := range EncryptedSourcePatterns() {
+		sourceName := strings.Replace(strings.TrimPrefix(pattern, "**/"), "*", "name", -1)
+		if strings.HasSuffix(sourceName, "/"+encryptedDirBundleName) {
+			dirSourceName := strings.TrimSuffix(sourceName, "/"+encryptedDirBundleName)
+			assert.True(t, ParseDirAttributes(dirSourceName).Encrypted, pattern)
+			assert.Equal(t, "name", ParseDirAttributes(dirSourceName).Name, pattern)
+		} else {
+			assert.True(t, ParseFileAttributes(sourceName).Encrypted, pattern)
+			assert.Equal(t, "name", ParseFileAttributes(sourceName).Name, pattern)
+		}
+	}
+}
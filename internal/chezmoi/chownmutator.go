@@ -0,0 +1,127 @@
+package chezmoi
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	vfs "github.com/twpayne/go-vfs"
+)
+
+// A ChownMutator wraps a Mutator and gives the files that it writes inside a
+// directory to a user, so that running as root, for example with sudo, does
+// not leave files owned by root in the user's home directory. New files are
+// owned by the user and existing files keep their owner, even if they are
+// replaced.
+type ChownMutator struct {
+	m   Mutator
+	fs  vfs.FS
+	dir string
+	uid int
+	gid int
+}
+
+// NewChownMutator returns a new ChownMutator that wraps m and gives files
+// inside dir in fs to uid and gid.
+func NewChownMutator(m Mutator, fs vfs.FS, dir string, uid, gid int) *ChownMutator {
+	return &ChownMutator{
+		m:   m,
+		fs:  fs,
+		dir: dir,
+		uid: uid,
+		gid: gid,
+	}
+}
+
+// Chmod implements Mutator.Chmod.
+func (m *ChownMutator) Chmod(name string, mode os.FileMode) error {
+	return m.m.Chmod(name, mode)
+}
+
+// IdempotentCmdOutput implements Mutator.IdempotentCmdOutput.
+func (m *ChownMutator) IdempotentCmdOutput(cmd *exec.Cmd) ([]byte, error) {
+	return m.m.IdempotentCmdOutput(cmd)
+}
+
+// Lchown implements Mutator.Lchown.
+func (m *ChownMutator) Lchown(name string, uid, gid int) error {
+	return m.m.Lchown(name, uid, gid)
+}
+
+// Mkdir implements Mutator.Mkdir.
+func (m *ChownMutator) Mkdir(name string, perm os.FileMode) error {
+	return m.chown(name, func() error {
+		return m.m.Mkdir(name, perm)
+	})
+}
+
+// RemoveAll implements Mutator.RemoveAll.
+func (m *ChownMutator) RemoveAll(name string) error {
+	return m.m.RemoveAll(name)
+}
+
+// Rename implements Mutator.Rename.
+func (m *ChownMutator) Rename(oldpath, newpath string) error {
+	return m.m.Rename(oldpath, newpath)
+}
+
+// RunCmd implements Mutator.RunCmd.
+func (m *ChownMutator) RunCmd(cmd *exec.Cmd) error {
+	return m.m.RunCmd(cmd)
+}
+
+// Stat implements Mutator.Stat.
+func (m *ChownMutator) Stat(name string) (os.FileInfo, error) {
+	return m.m.Stat(name)
+}
+
+// WriteFile implements Mutator.WriteFile.
+func (m *ChownMutator) WriteFile(name string, data []byte, perm os.FileMode, currData []byte) error {
+	return m.chown(name, func() error {
+		return m.m.WriteFile(name, data, perm, currData)
+	})
+}
+
+// WriteFileFrom implements Mutator.WriteFileFrom.
+func (m *ChownMutator) WriteFileFrom(name string, r io.Reader, size int64, perm os.FileMode) error {
+	return m.chown(name, func() error {
+		return m.m.WriteFileFrom(name, r, size, perm)
+	})
+}
+
+// WriteSymlink implements Mutator.WriteSymlink.
+func (m *ChownMutator) WriteSymlink(oldname, newname string) error {
+	return m.chown(newname, func() error {
+		return m.m.WriteSymlink(oldname, newname)
+	})
+}
+
+// chown calls write, which writes name, and then sets the owner of name to the
+// owner of the file it replaced, if any, or else to m's user, if name is
+// inside m.dir.
+func (m *ChownMutator) chown(name string, write func() error) error {
+	if !m.contains(name) {
+		return write()
+	}
+	uid, gid := m.uid, m.gid
+	if info, err := m.fs.Lstat(name); err == nil {
+		if ownerUID, ownerGID, ok := FileOwner(info); ok {
+			uid, gid = ownerUID, ownerGID
+		}
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	return m.fs.Lchown(name, uid, gid)
+}
+
+// contains returns whether name is inside m.dir.
+func (m *ChownMutator) contains(name string) bool {
+	relPath, err := filepath.Rel(m.dir, name)
+	if err != nil {
+		return false
+	}
+	return relPath != "." && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator))
+}
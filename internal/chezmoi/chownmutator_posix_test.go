@@ -0,0 +1,48 @@
+// +build !windows
+
+package chezmoi
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+var _ Mutator = &ChownMutator{}
+
+func TestChownMutator(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing owners requires root")
+	}
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/etc/hosts":         "127.0.0.1 localhost\n",
+		"/home/user/.bashrc": "# old\n",
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	require.NoError(t, fs.Lchown("/home/user/.bashrc", 2000, 2000))
+
+	m := NewChownMutator(NewFSMutator(fs), fs, "/home/user", 1000, 1000)
+	require.NoError(t, m.Mkdir("/home/user/.config", 0o755))
+	require.NoError(t, m.WriteFile("/home/user/.config/foo", []byte("foo\n"), 0o644, nil))
+	require.NoError(t, m.WriteSymlink(".config/foo", "/home/user/.foo"))
+	require.NoError(t, m.WriteFile("/home/user/.bashrc", []byte("# new\n"), 0o644, []byte("# old\n")))
+	require.NoError(t, m.WriteFile("/etc/hosts", []byte("::1 localhost\n"), 0o644, nil))
+
+	for path, expectedUID := range map[string]int{
+		"/home/user/.config":     1000,
+		"/home/user/.config/foo": 1000,
+		"/home/user/.foo":        1000,
+		"/home/user/.bashrc":     2000,
+		"/etc/hosts":             0,
+	} {
+		info, err := fs.Lstat(path)
+		require.NoError(t, err)
+		uid, _, ok := FileOwner(info)
+		require.True(t, ok)
+		assert.Equal(t, expectedUID, uid, path)
+	}
+}
@@ -1,6 +1,7 @@
 package chezmoi
 
 import (
+	"io"
 	"log"
 	"os"
 	"os/exec"
@@ -38,6 +39,13 @@ func (m *DebugMutator) IdempotentCmdOutput(cmd *exec.Cmd) ([]byte, error) {
 	return output, err
 }
 
+// Lchown implements Mutator.Lchown.
+func (m *DebugMutator) Lchown(name string, uid, gid int) error {
+	return Debugf("Lchown(%q, %d, %d)", []interface{}{name, uid, gid}, func() error {
+		return m.m.Lchown(name, uid, gid)
+	})
+}
+
 // Mkdir implements Mutator.Mkdir.
 func (m *DebugMutator) Mkdir(name string, perm os.FileMode) error {
 	return Debugf("Mkdir(%q, 0%o)", []interface{}{name, perm}, func() error {
@@ -85,6 +93,13 @@ func (m *DebugMutator) WriteFile(name string, data []byte, perm os.FileMode, cur
 	})
 }
 
+// WriteFileFrom implements Mutator.WriteFileFrom.
+func (m *DebugMutator) WriteFileFrom(name string, r io.Reader, size int64, perm os.FileMode) error {
+	return Debugf("WriteFileFrom(%q, _, %d, 0%o)", []interface{}{name, size, perm}, func() error {
+		return m.m.WriteFileFrom(name, r, size, perm)
+	})
+}
+
 // WriteSymlink implements Mutator.WriteSymlink.
 func (m *DebugMutator) WriteSymlink(oldname, newname string) error {
 	return Debugf("WriteSymlink(%q, %q)", []interface{}{oldname, newname}, func() error {
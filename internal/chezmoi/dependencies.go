@@ -0,0 +1,319 @@
+package chezmoi
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	vfs "github.com/twpayne/go-vfs"
+)
+
+// An applyOrder applies the prerequisites of entries, declared in
+// .chezmoidependencies, before the entries themselves.
+type applyOrder struct {
+	prerequisites map[Entry][]Entry
+	parents       map[Entry]*Dir
+	started       map[Entry]bool
+}
+
+// addDependencies adds the dependencies in the .chezmoidependencies file at
+// path, whose target name is relPath, to ts.Dependencies. Each non-empty line
+// is a target name followed by a colon and the target names of its
+// prerequisites, relative to the file's directory.
+func (ts *TargetState) addDependencies(fs vfs.FS, path, relPath string, options *PopulateOptions) error {
+	data, err := ts.executeTemplate(fs, path)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(relPath)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		if index := strings.IndexRune(text, '#'); index != -1 {
+			text = text[:index]
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		index := strings.IndexRune(text, ':')
+		if index == -1 {
+			err := fmt.Errorf("%s: missing colon", text)
+			if options == nil || options.ReportError == nil {
+				return fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			options.ReportError(path, line, err)
+			continue
+		}
+		targetName := filepath.Join(dir, strings.TrimSpace(text[:index]))
+		for _, name := range strings.Fields(text[index+1:]) {
+			ts.Dependencies[targetName] = append(ts.Dependencies[targetName], filepath.Join(dir, name))
+		}
+		if ts.dependencyPaths == nil {
+			ts.dependencyPaths = make(map[string]string)
+		}
+		ts.dependencyPaths[targetName] = path
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// checkDependencies returns an error if a target depends on something that it
+// contains, or if the dependencies contain a cycle, in which case the error
+// includes the cycle's path.
+func (ts *TargetState) checkDependencies(options *PopulateOptions) error {
+	targetNames := make([]string, 0, len(ts.Dependencies))
+	for targetName := range ts.Dependencies {
+		targetNames = append(targetNames, targetName)
+	}
+	sort.Strings(targetNames)
+
+	reportError := func(targetName string, err error) error {
+		if options == nil || options.ReportError == nil {
+			return fmt.Errorf("%s: %w", ts.dependencyPaths[targetName], err)
+		}
+		options.ReportError(ts.dependencyPaths[targetName], 0, err)
+		return nil
+	}
+
+	for _, targetName := range targetNames {
+		for _, prerequisite := range ts.Dependencies[targetName] {
+			if isInsideTargetName(prerequisite, targetName) {
+				if err := reportError(targetName, fmt.Errorf("%s: depends on %s, which it contains", targetName, prerequisite)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// Find cycles with a depth-first search, remembering the path to the
+	// current target so that it can be printed.
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	states := make(map[string]int)
+	var path []string
+	var visit func(string) []string
+	visit = func(targetName string) []string {
+		switch states[targetName] {
+		case visiting:
+			for i, name := range path {
+				if name == targetName {
+					return append(append([]string{}, path[i:]...), targetName)
+				}
+			}
+		case visited:
+			return nil
+		}
+		states[targetName] = visiting
+		path = append(path, targetName)
+		for _, prerequisite := range ts.Dependencies[targetName] {
+			if cycle := visit(prerequisite); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		states[targetName] = visited
+		return nil
+	}
+	for _, targetName := range targetNames {
+		if cycle := visit(targetName); cycle != nil {
+			return reportError(cycle[0], fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> ")))
+		}
+	}
+	return nil
+}
+
+// newApplyOrder returns the applyOrder for applying entries, or nil if none of
+// them have any dependencies. Prerequisites that are not entries or inside
+// entries are ignored, as are prerequisites that are not in ts, for example
+// because they are ignored on this machine.
+func (ts *TargetState) newApplyOrder(entries []Entry) *applyOrder {
+	if len(ts.Dependencies) == 0 {
+		return nil
+	}
+	parents := make(map[Entry]*Dir)
+	var addParents func(*Dir)
+	addParents = func(dir *Dir) {
+		for _, entry := range dir.Entries {
+			parents[entry] = dir
+			if subdir, ok := entry.(*Dir); ok {
+				addParents(subdir)
+			}
+		}
+	}
+	for _, entry := range ts.Entries {
+		if dir, ok := entry.(*Dir); ok {
+			addParents(dir)
+		}
+	}
+
+	applying := make(map[Entry]bool, len(entries))
+	for _, entry := range entries {
+		applying[entry] = true
+	}
+	isApplied := func(entry Entry) bool {
+		for {
+			if applying[entry] {
+				return true
+			}
+			parent, ok := parents[entry]
+			if !ok {
+				return false
+			}
+			entry = parent
+		}
+	}
+
+	prerequisites := make(map[Entry][]Entry)
+	for targetName, prerequisiteNames := range ts.Dependencies {
+		entry, err := ts.findEntry(targetName)
+		if err != nil || !isApplied(entry) {
+			continue
+		}
+		for _, prerequisiteName := range prerequisiteNames {
+			if isInsideTargetName(targetName, prerequisiteName) {
+				// Parent directories are always applied first.
+				continue
+			}
+			prerequisite, err := ts.findEntry(prerequisiteName)
+			if err != nil || !isApplied(prerequisite) {
+				continue
+			}
+			prerequisites[entry] = append(prerequisites[entry], prerequisite)
+		}
+	}
+	if len(prerequisites) == 0 {
+		return nil
+	}
+	for _, entryPrerequisites := range prerequisites {
+		sort.Slice(entryPrerequisites, func(i, j int) bool {
+			return entryPrerequisites[i].TargetName() < entryPrerequisites[j].TargetName()
+		})
+	}
+	return &applyOrder{
+		prerequisites: prerequisites,
+		parents:       parents,
+		started:       make(map[Entry]bool),
+	}
+}
+
+// applyPrerequisites applies entry's prerequisites that have not already been
+// applied, after their parent directories.
+func (o *applyOrder) applyPrerequisites(entry Entry, fs vfs.FS, mutator Mutator, follow bool, applyOptions *ApplyOptions) error {
+	for _, prerequisite := range o.prerequisites[entry] {
+		if o.started[prerequisite] {
+			continue
+		}
+		if err := o.applyParents(prerequisite, fs, mutator, follow, applyOptions); err != nil {
+			return err
+		}
+		// Scripts that are prerequisites are run even if they have the
+		// before_ or after_ attribute, but directories' own before_ and
+		// after_ scripts are still run separately.
+		_, isScript := prerequisite.(*Script)
+		prerequisiteApplyOptions := *applyOptions
+		prerequisiteApplyOptions.skipOrderedScripts = !isScript
+		if err := ApplyEntry(prerequisite, fs, mutator, follow, &prerequisiteApplyOptions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyParents creates the parent directories of entry that have not already
+// been applied, without their contents.
+func (o *applyOrder) applyParents(entry Entry, fs vfs.FS, mutator Mutator, follow bool, applyOptions *ApplyOptions) error {
+	var parents []*Dir
+	for parent := o.parents[entry]; parent != nil && !o.started[parent]; parent = o.parents[parent] {
+		parents = append(parents, parent)
+	}
+	for i := len(parents) - 1; i >= 0; i-- {
+		dir := *parents[i]
+		dir.Entries = nil
+		dir.Exact = false
+		if err := dir.Apply(fs, mutator, follow, applyOptions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// order returns the target names of the entries with dependencies in the
+// order in which they are applied when applying entries, for verbose output.
+func (o *applyOrder) order(entries []Entry) []string {
+	involved := make(map[Entry]bool)
+	for entry, prerequisites := range o.prerequisites {
+		involved[entry] = true
+		for _, prerequisite := range prerequisites {
+			involved[prerequisite] = true
+		}
+	}
+
+	// Walk the entries in the order that ApplyEntries applies them, pulling
+	// in prerequisites before the entries that depend on them.
+	var order []string
+	visited := make(map[Entry]bool)
+	var visit func(Entry, bool)
+	visit = func(entry Entry, skipOrderedScripts bool) {
+		if script, ok := entry.(*Script); ok && skipOrderedScripts && (script.Before || script.After) {
+			return
+		}
+		if visited[entry] {
+			return
+		}
+		visited[entry] = true
+		for _, prerequisite := range o.prerequisites[entry] {
+			_, isScript := prerequisite.(*Script)
+			visit(prerequisite, !isScript)
+		}
+		if involved[entry] {
+			order = append(order, entry.TargetName())
+		}
+		if dir, ok := entry.(*Dir); ok {
+			for _, name := range sortedEntryNames(dir.Entries) {
+				visit(dir.Entries[name], true)
+			}
+		}
+	}
+	var beforeScripts, afterScripts []*Script
+	for _, entry := range entries {
+		beforeScripts, afterScripts = appendOrderedScripts(beforeScripts, afterScripts, entry)
+	}
+	for _, script := range sortedScripts(beforeScripts) {
+		visit(script, false)
+	}
+	for _, entry := range entries {
+		visit(entry, true)
+	}
+	for _, script := range sortedScripts(afterScripts) {
+		visit(script, false)
+	}
+	return order
+}
+
+// writeOrder writes the order in which entries with dependencies are applied
+// to w.
+func (o *applyOrder) writeOrder(w io.Writer, entries []Entry) error {
+	if _, err := fmt.Fprintf(w, "applying in dependency order:\n"); err != nil {
+		return err
+	}
+	for _, targetName := range o.order(entries) {
+		if _, err := fmt.Fprintf(w, "  %s\n", targetName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isInsideTargetName returns whether targetName is inside dirName.
+func isInsideTargetName(targetName, dirName string) bool {
+	return strings.HasPrefix(targetName, dirName+string(filepath.Separator))
+}
@@ -0,0 +1,348 @@
+package chezmoi
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	vfs "github.com/twpayne/go-vfs"
+)
+
+// A DiffStat is the number of lines added to and removed from a single target.
+type DiffStat struct {
+	Path     string
+	Added    int
+	Removed  int
+	Binary   bool
+	FromSize int64
+	ToSize   int64
+	Script   bool
+}
+
+// A DiffStatMutator wraps a Mutator and records the number of lines that each
+// action it would execute adds and removes, like git diff --stat.
+type DiffStatMutator struct {
+	m           Mutator
+	fs          vfs.FS
+	prefix      string
+	stats       []*DiffStat
+	statsByPath map[string]*DiffStat
+	dirs        map[string]bool
+}
+
+// NewDiffStatMutator returns a new DiffStatMutator. The previous state of each
+// target is read from fs and prefix is trimmed from paths.
+func NewDiffStatMutator(m Mutator, fs vfs.FS, prefix string) *DiffStatMutator {
+	return &DiffStatMutator{
+		m:           m,
+		fs:          fs,
+		prefix:      prefix,
+		statsByPath: make(map[string]*DiffStat),
+		dirs:        make(map[string]bool),
+	}
+}
+
+// Chmod implements Mutator.Chmod. Directories are not recorded.
+func (m *DiffStatMutator) Chmod(name string, mode os.FileMode) error {
+	isDir := m.isDir(name)
+	if err := m.m.Chmod(name, mode); err != nil {
+		return err
+	}
+	if !isDir {
+		m.stat(name)
+	}
+	return nil
+}
+
+// IdempotentCmdOutput implements Mutator.IdempotentCmdOutput.
+func (m *DiffStatMutator) IdempotentCmdOutput(cmd *exec.Cmd) ([]byte, error) {
+	return m.m.IdempotentCmdOutput(cmd)
+}
+
+// Lchown implements Mutator.Lchown. Directories are not recorded.
+func (m *DiffStatMutator) Lchown(name string, uid, gid int) error {
+	isDir := m.isDir(name)
+	if err := m.m.Lchown(name, uid, gid); err != nil {
+		return err
+	}
+	if !isDir {
+		m.stat(name)
+	}
+	return nil
+}
+
+// Mkdir implements Mutator.Mkdir. Directories are not recorded.
+func (m *DiffStatMutator) Mkdir(name string, perm os.FileMode) error {
+	if err := m.m.Mkdir(name, perm); err != nil {
+		return err
+	}
+	m.dirs[name] = true
+	return nil
+}
+
+// RemoveAll implements Mutator.RemoveAll.
+func (m *DiffStatMutator) RemoveAll(name string) error {
+	if err := m.m.RemoveAll(name); err != nil {
+		return err
+	}
+	m.removeCurrent(m.stat(name), name)
+	return nil
+}
+
+// Rename implements Mutator.Rename.
+func (m *DiffStatMutator) Rename(oldpath, newpath string) error {
+	if err := m.m.Rename(oldpath, newpath); err != nil {
+		return err
+	}
+	m.stat(oldpath)
+	return nil
+}
+
+// RunCmd implements Mutator.RunCmd.
+func (m *DiffStatMutator) RunCmd(cmd *exec.Cmd) error {
+	return m.m.RunCmd(cmd)
+}
+
+// Stat implements Mutator.Stat.
+func (m *DiffStatMutator) Stat(name string) (os.FileInfo, error) {
+	return m.m.Stat(name)
+}
+
+// Stats returns the recorded changes, in the order in which they were first
+// made.
+func (m *DiffStatMutator) Stats() []*DiffStat {
+	return m.stats
+}
+
+// Summarize implements Summarizer.Summarize. Only scripts that would be run
+// are recorded.
+func (m *DiffStatMutator) Summarize(action, name, details string) {
+	if action != wouldRunScriptAction {
+		return
+	}
+	m.stat(name).Script = true
+}
+
+// WriteFile implements Mutator.WriteFile.
+func (m *DiffStatMutator) WriteFile(name string, data []byte, perm os.FileMode, currData []byte) error {
+	if err := m.m.WriteFile(name, data, perm, currData); err != nil {
+		return err
+	}
+	ds := m.stat(name)
+	if ds.Binary || isBinary(currData) || isBinary(data) {
+		ds.Binary = true
+		ds.FromSize += int64(len(currData))
+		ds.ToSize += int64(len(data))
+		return nil
+	}
+	for _, chunk := range diffChunks(string(currData), string(data)) {
+		switch chunk.Type() {
+		case diff.Add:
+			ds.Added += countLines(chunk.Content())
+		case diff.Delete:
+			ds.Removed += countLines(chunk.Content())
+		}
+	}
+	return nil
+}
+
+// WriteFileFrom implements Mutator.WriteFileFrom. The file is always treated
+// as binary.
+func (m *DiffStatMutator) WriteFileFrom(name string, r io.Reader, size int64, perm os.FileMode) error {
+	var fromSize int64
+	if info, err := m.fs.Lstat(name); err == nil && info.Mode().IsRegular() {
+		fromSize = info.Size()
+	}
+	if err := m.m.WriteFileFrom(name, r, size, perm); err != nil {
+		return err
+	}
+	ds := m.stat(name)
+	ds.Binary = true
+	ds.FromSize += fromSize
+	ds.ToSize += size
+	return nil
+}
+
+// WriteSymlink implements Mutator.WriteSymlink. The symlink's target counts as
+// a single line, as in git.
+func (m *DiffStatMutator) WriteSymlink(oldname, newname string) error {
+	ds := m.stat(newname)
+	m.removeCurrent(ds, newname)
+	if err := m.m.WriteSymlink(oldname, newname); err != nil {
+		return err
+	}
+	ds.Added++
+	return nil
+}
+
+// WriteStat writes m's stats to w like git diff --stat, with lines that are at
+// most width columns wide where possible.
+func (m *DiffStatMutator) WriteStat(w io.Writer, width int) error {
+	if len(m.stats) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(m.stats))
+	nameWidth := 0
+	maxChanges := 0
+	for _, ds := range m.stats {
+		names = append(names, ds.Path)
+		if n := len([]rune(ds.Path)); n > nameWidth {
+			nameWidth = n
+		}
+		if changes := ds.Added + ds.Removed; !ds.Binary && !ds.Script && changes > maxChanges {
+			maxChanges = changes
+		}
+	}
+	countWidth := len(strconv.Itoa(maxChanges))
+
+	// Long names are truncated from the left so that the graph has room,
+	// as in git.
+	if maxNameWidth := width / 2; nameWidth > maxNameWidth && maxNameWidth > len("...") {
+		for i, name := range names {
+			if runes := []rune(name); len(runes) > maxNameWidth {
+				names[i] = "..." + string(runes[len(runes)-maxNameWidth+len("..."):])
+			}
+		}
+		nameWidth = maxNameWidth
+	}
+
+	graphWidth := width - len(" ") - nameWidth - len(" | ") - countWidth - len(" ")
+	if graphWidth < 1 {
+		graphWidth = 1
+	}
+	if graphWidth > maxChanges {
+		graphWidth = maxChanges
+	}
+
+	files, scripts, added, removed := 0, 0, 0, 0
+	for i, ds := range m.stats {
+		var stat string
+		switch {
+		case ds.Script:
+			scripts++
+			stat = "script"
+		case ds.Binary:
+			files++
+			stat = fmt.Sprintf("Bin %d -> %d bytes", ds.FromSize, ds.ToSize)
+		default:
+			files++
+			added += ds.Added
+			removed += ds.Removed
+			stat = fmt.Sprintf("%*d", countWidth, ds.Added+ds.Removed)
+			if graph := diffStatGraph(ds.Added, ds.Removed, maxChanges, graphWidth); graph != "" {
+				stat += " " + graph
+			}
+		}
+		if _, err := fmt.Fprintf(w, " %-*s | %s\n", nameWidth, names[i], stat); err != nil {
+			return err
+		}
+	}
+
+	totals := []string{pluralize(files, "file") + " changed"}
+	if scripts != 0 {
+		totals = append(totals, pluralize(scripts, "script")+" to run")
+	}
+	if added != 0 || removed == 0 {
+		totals = append(totals, pluralize(added, "insertion")+"(+)")
+	}
+	if removed != 0 || added == 0 {
+		totals = append(totals, pluralize(removed, "deletion")+"(-)")
+	}
+	_, err := fmt.Fprintf(w, " %s\n", strings.Join(totals, ", "))
+	return err
+}
+
+// isDir returns whether the target at name is a directory, either already or
+// because m made it.
+func (m *DiffStatMutator) isDir(name string) bool {
+	if m.dirs[name] {
+		return true
+	}
+	info, err := m.fs.Lstat(name)
+	return err == nil && info.IsDir()
+}
+
+// removeCurrent records the removal of the current contents of the target at
+// name in ds.
+func (m *DiffStatMutator) removeCurrent(ds *DiffStat, name string) {
+	info, err := m.fs.Lstat(name)
+	if err != nil {
+		return
+	}
+	switch {
+	case info.Mode().IsRegular():
+		contents, err := m.fs.ReadFile(name)
+		if err != nil {
+			return
+		}
+		if isBinary(contents) {
+			ds.Binary = true
+			ds.FromSize += int64(len(contents))
+			return
+		}
+		ds.Removed += countLines(string(contents))
+	case info.Mode()&os.ModeType == os.ModeSymlink:
+		ds.Removed++
+	}
+}
+
+// stat returns the DiffStat for the target at name, creating it if needed.
+func (m *DiffStatMutator) stat(name string) *DiffStat {
+	path := strings.TrimPrefix(name, m.prefix)
+	if ds, ok := m.statsByPath[path]; ok {
+		return ds
+	}
+	ds := &DiffStat{
+		Path: path,
+	}
+	m.stats = append(m.stats, ds)
+	m.statsByPath[path] = ds
+	return ds
+}
+
+// countLines returns the number of lines in s, counting a final line without
+// a trailing newline.
+func countLines(s string) int {
+	n := strings.Count(s, "\n")
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		n++
+	}
+	return n
+}
+
+// diffStatGraph returns a graph of added and removed lines, scaled so that
+// maxChanges fits in width columns. Non-zero counts always get at least one
+// column.
+func diffStatGraph(added, removed, maxChanges, width int) string {
+	if maxChanges > width {
+		added = scaleDiffStat(added, maxChanges, width)
+		removed = scaleDiffStat(removed, maxChanges, width)
+	}
+	return strings.Repeat("+", added) + strings.Repeat("-", removed)
+}
+
+// scaleDiffStat scales n from a maximum of maxChanges to a maximum of width,
+// rounding to the nearest column.
+func scaleDiffStat(n, maxChanges, width int) int {
+	if n == 0 {
+		return 0
+	}
+	scaled := (2*n*width + maxChanges) / (2 * maxChanges)
+	if scaled == 0 {
+		scaled = 1
+	}
+	return scaled
+}
+
+// pluralize returns n followed by noun, pluralized if n is not one.
+func pluralize(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return strconv.Itoa(n) + " " + noun + "s"
+}
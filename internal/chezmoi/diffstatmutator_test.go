@@ -0,0 +1,81 @@
+package chezmoi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+var (
+	_ Mutator    = &DiffStatMutator{}
+	_ Summarizer = &DiffStatMutator{}
+)
+
+func TestDiffStatMutator(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".bashrc": "# bashrc\n",
+			".dir":    &vfst.Dir{Perm: 0o755},
+			".link":   &vfst.Symlink{Target: ".bashrc"},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	m := NewDiffStatMutator(NullMutator{}, fs, "/home/user/")
+	require.NoError(t, m.Chmod("/home/user/.dir", 0o700))
+	require.NoError(t, m.Lchown("/home/user/.dir", 0, 0))
+	require.NoError(t, m.Mkdir("/home/user/.new", 0o755))
+	require.NoError(t, m.Chmod("/home/user/.new", 0o700))
+	require.NoError(t, m.WriteFile("/home/user/.bashrc", []byte("# bashrc\nexport EDITOR=vi\n"), 0o644, []byte("# bashrc\n")))
+	require.NoError(t, m.WriteFile("/home/user/.long", []byte(strings.Repeat("line\n", 100)), 0o644, nil))
+	require.NoError(t, m.WriteSymlink(".zshrc", "/home/user/.link"))
+	require.NoError(t, m.RemoveAll("/home/user/.bashrc"))
+	m.Summarize(wouldRunScriptAction, "run_once_install.sh", "not yet run")
+	m.Summarize("skipped", "/home/user/.cache", "ignored")
+
+	assert.Equal(t, []*DiffStat{
+		{Path: ".bashrc", Added: 1, Removed: 1},
+		{Path: ".long", Added: 100},
+		{Path: ".link", Added: 1, Removed: 1},
+		{Path: "run_once_install.sh", Script: true},
+	}, m.Stats())
+
+	for _, tc := range []struct {
+		name        string
+		width       int
+		expectedStr string
+	}{
+		{
+			name:  "scaled",
+			width: 40,
+			expectedStr: strings.Join([]string{
+				" .bashrc             |   2 +-",
+				" .long               | 100 +++++++++++++",
+				" .link               |   2 +-",
+				" run_once_install.sh | script",
+				" 3 files changed, 1 script to run, 102 insertions(+), 2 deletions(-)",
+			}, "\n") + "\n",
+		},
+		{
+			name:  "truncated",
+			width: 20,
+			expectedStr: strings.Join([]string{
+				" .bashrc    |   2 +-",
+				" .long      | 100 ++",
+				" .link      |   2 +-",
+				" ...tall.sh | script",
+				" 3 files changed, 1 script to run, 102 insertions(+), 2 deletions(-)",
+			}, "\n") + "\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sb := &strings.Builder{}
+			require.NoError(t, m.WriteStat(sb, tc.width))
+			assert.Equal(t, tc.expectedStr, sb.String())
+		})
+	}
+}
@@ -1,7 +1,8 @@
 package chezmoi
 
 import (
-	"archive/tar"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,18 +12,32 @@ import (
 
 // DirAttributes holds attributes parsed from a source directory name.
 type DirAttributes struct {
-	Name  string
-	Exact bool
-	Perm  os.FileMode
+	Name         string
+	Concat       bool
+	Empty        bool
+	Encrypted    bool
+	Exact        bool
+	ExplicitPerm bool
+	Perm         os.FileMode
 }
 
 // A Dir represents the target state of a directory.
 type Dir struct {
+	sourceDir  string
 	sourceName string
 	targetName string
-	Exact      bool
-	Perm       os.FileMode
-	Entries    map[string]Entry
+	// Empty is set if the directory must be empty, in which case Exact is
+	// also set.
+	Empty        bool
+	Encrypted    bool
+	Exact        bool
+	ExplicitPerm bool
+	Perm         os.FileMode
+	Entries      map[string]Entry
+	// bundle is the plaintext of an encrypted directory's bundle, from which
+	// its entries are populated.
+	bundle             []byte
+	evaluateCiphertext func() ([]byte, error)
 }
 
 type dirConcreteValue struct {
@@ -38,34 +53,70 @@ type dirConcreteValue struct {
 func ParseDirAttributes(sourceName string) DirAttributes {
 	name := sourceName
 	perm := os.FileMode(0o777)
+	concat := false
+	if strings.HasPrefix(name, concatPrefix) {
+		name = strings.TrimPrefix(name, concatPrefix)
+		concat = true
+	}
+	encrypted := false
+	if strings.HasPrefix(name, encryptedPrefix) {
+		name = strings.TrimPrefix(name, encryptedPrefix)
+		encrypted = true
+	}
 	exact := false
 	if strings.HasPrefix(name, exactPrefix) {
 		name = strings.TrimPrefix(name, exactPrefix)
 		exact = true
 	}
+	explicitPerm, name, ok := trimPermAttribute(name)
+	if ok {
+		perm = explicitPerm
+	}
 	if strings.HasPrefix(name, privatePrefix) {
 		name = strings.TrimPrefix(name, privatePrefix)
-		perm &= 0o700
+		if !ok {
+			perm &= 0o700
+		}
+	}
+	empty := false
+	if strings.HasPrefix(name, emptyPrefix) {
+		name = strings.TrimPrefix(name, emptyPrefix)
+		empty = true
 	}
 	if strings.HasPrefix(name, dotPrefix) {
 		name = "." + strings.TrimPrefix(name, dotPrefix)
 	}
 	return DirAttributes{
-		Name:  name,
-		Exact: exact,
-		Perm:  perm,
+		Name:         name,
+		Concat:       concat,
+		Empty:        empty,
+		Encrypted:    encrypted,
+		Exact:        exact,
+		ExplicitPerm: ok,
+		Perm:         perm,
 	}
 }
 
 // SourceName returns da's source name.
 func (da DirAttributes) SourceName() string {
 	sourceName := ""
+	if da.Concat {
+		sourceName += concatPrefix
+	}
+	if da.Encrypted {
+		sourceName += encryptedPrefix
+	}
 	if da.Exact {
 		sourceName += exactPrefix
 	}
-	if da.Perm&os.FileMode(0o77) == os.FileMode(0) {
+	if da.ExplicitPerm {
+		sourceName += permAttribute(da.Perm & permMask)
+	} else if da.Perm&os.FileMode(0o77) == os.FileMode(0) {
 		sourceName += privatePrefix
 	}
+	if da.Empty {
+		sourceName += emptyPrefix
+	}
 	if strings.HasPrefix(da.Name, ".") {
 		sourceName += dotPrefix + strings.TrimPrefix(da.Name, ".")
 	} else {
@@ -109,8 +160,8 @@ func (d *Dir) Apply(fs vfs.FS, mutator Mutator, follow bool, applyOptions *Apply
 	}
 	switch {
 	case err == nil && info.IsDir():
-		if info.Mode().Perm() != d.Perm&^applyOptions.Umask {
-			if err := mutator.Chmod(targetPath, d.Perm&^applyOptions.Umask); err != nil {
+		if info.Mode()&permMask != d.targetPerm(applyOptions.Umask) {
+			if err := mutator.Chmod(targetPath, d.targetPerm(applyOptions.Umask)); err != nil {
 				return err
 			}
 		}
@@ -120,14 +171,19 @@ func (d *Dir) Apply(fs vfs.FS, mutator Mutator, follow bool, applyOptions *Apply
 		}
 		fallthrough
 	case os.IsNotExist(err):
-		if err := mutator.Mkdir(targetPath, d.Perm&^applyOptions.Umask); err != nil {
+		if err := mutator.Mkdir(targetPath, d.targetPerm(applyOptions.Umask)); err != nil {
 			return err
 		}
+		if d.ExplicitPerm {
+			if err := chmodExplicitPerm(mutator, targetPath, d.Perm); err != nil {
+				return err
+			}
+		}
 	default:
 		return err
 	}
 	for _, entryName := range sortedEntryNames(d.Entries) {
-		if err := d.Entries[entryName].Apply(fs, mutator, follow, applyOptions); err != nil {
+		if err := ApplyEntry(d.Entries[entryName], fs, mutator, follow, applyOptions); err != nil {
 			return err
 		}
 	}
@@ -139,10 +195,7 @@ func (d *Dir) Apply(fs vfs.FS, mutator Mutator, follow bool, applyOptions *Apply
 		for _, info := range infos {
 			name := info.Name()
 			if _, ok := d.Entries[name]; !ok {
-				if applyOptions.Ignore(filepath.Join(d.targetName, name)) {
-					continue
-				}
-				if err := mutator.RemoveAll(filepath.Join(targetPath, name)); err != nil {
+				if err := removeAllUnignored(fs, mutator, filepath.Join(targetPath, name), filepath.Join(d.targetName, name), applyOptions); err != nil {
 					return err
 				}
 			}
@@ -151,15 +204,73 @@ func (d *Dir) Apply(fs vfs.FS, mutator Mutator, follow bool, applyOptions *Apply
 	return nil
 }
 
+// errFoundIgnored is returned to stop walking when an ignored target is found.
+var errFoundIgnored = errors.New("found ignored target")
+
+// removeAllUnignored removes the target at targetPath, whose target name is
+// targetName, and everything inside it, except for ignored targets and their
+// parent directories. Ignored targets are reported in verbose mode.
+func removeAllUnignored(fs vfs.FS, mutator Mutator, targetPath, targetName string, applyOptions *ApplyOptions) error {
+	if applyOptions.Ignore(targetName) {
+		return reportSkippedIgnored(mutator, targetPath, applyOptions)
+	}
+	// Most targets do not contain any ignored targets, so they are removed
+	// all at once.
+	if err := vfs.Walk(fs, targetPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(targetPath, path)
+		if err != nil {
+			return err
+		}
+		if relPath != "." && applyOptions.Ignore(filepath.Join(targetName, relPath)) {
+			return errFoundIgnored
+		}
+		return nil
+	}); err == nil {
+		return mutator.RemoveAll(targetPath)
+	} else if !errors.Is(err, errFoundIgnored) {
+		return err
+	}
+	infos, err := fs.ReadDir(targetPath)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		name := info.Name()
+		if err := removeAllUnignored(fs, mutator, filepath.Join(targetPath, name), filepath.Join(targetName, name), applyOptions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reportSkippedIgnored reports, in verbose mode, that the ignored target at
+// targetPath was not removed.
+func reportSkippedIgnored(mutator Mutator, targetPath string, applyOptions *ApplyOptions) error {
+	if !applyOptions.Verbose {
+		return nil
+	}
+	if summarizer, ok := mutator.(Summarizer); ok {
+		summarizer.Summarize("skipped", targetPath, "ignored")
+		return nil
+	}
+	_, err := fmt.Fprintf(applyOptions.Stdout, "skipped %s (ignored)\n", targetPath)
+	return err
+}
+
 // ConcreteValue implements Entry.ConcreteValue.
-func (d *Dir) ConcreteValue(ignore func(string) bool, sourceDir string, umask os.FileMode, recursive bool) (interface{}, error) {
+func (d *Dir) ConcreteValue(ignore func(string) bool, sourceDir string, umask os.FileMode, encryptedMode EncryptedMode, recursive bool) (interface{}, error) {
 	if ignore(d.targetName) {
 		return nil, nil
 	}
 	var entryConcreteValues []interface{}
-	if recursive {
+	// The entries of encrypted directories are only exported when they are
+	// decrypted, so that their names are not leaked.
+	if recursive && (!d.Encrypted || encryptedMode == EncryptedModeDecrypt) {
 		for _, entryName := range sortedEntryNames(d.Entries) {
-			entryConcreteValue, err := d.Entries[entryName].ConcreteValue(ignore, sourceDir, umask, recursive)
+			entryConcreteValue, err := d.Entries[entryName].ConcreteValue(ignore, sourceDir, umask, encryptedMode, recursive)
 			if err != nil {
 				return nil, err
 			}
@@ -170,10 +281,10 @@ func (d *Dir) ConcreteValue(ignore func(string) bool, sourceDir string, umask os
 	}
 	return &dirConcreteValue{
 		Type:       "dir",
-		SourcePath: filepath.Join(sourceDir, d.SourceName()),
+		SourcePath: sourcePath(d, sourceDir),
 		TargetPath: d.TargetName(),
 		Exact:      d.Exact,
-		Perm:       int(d.Perm &^ umask),
+		Perm:       int(fileModeToUnixPerm(d.targetPerm(umask))),
 		Entries:    entryConcreteValues,
 	}, nil
 }
@@ -201,25 +312,38 @@ func (d *Dir) SourceName() string {
 	return d.sourceName
 }
 
+// sourceDirectory implements Entry.sourceDirectory.
+func (d *Dir) sourceDirectory() string {
+	return d.sourceDir
+}
+
 // TargetName implements Entry.TargetName.
 func (d *Dir) TargetName() string {
 	return d.targetName
 }
 
+// targetPerm returns d's target permissions with umask applied. Explicit
+// permissions are not subject to umask.
+func (d *Dir) targetPerm(umask os.FileMode) os.FileMode {
+	if d.ExplicitPerm {
+		return d.Perm
+	}
+	return d.Perm &^ umask
+}
+
 // archive writes d to w.
-func (d *Dir) archive(w *tar.Writer, ignore func(string) bool, headerTemplate *tar.Header, umask os.FileMode) error {
+func (d *Dir) archive(w archiveWriter, ignore func(string) bool, umask os.FileMode, encryptedMode EncryptedMode) error {
 	if ignore(d.targetName) {
 		return nil
 	}
-	header := *headerTemplate
-	header.Typeflag = tar.TypeDir
-	header.Name = d.targetName
-	header.Mode = int64(d.Perm &^ umask)
-	if err := w.WriteHeader(&header); err != nil {
+	if d.Encrypted && encryptedMode != EncryptedModeDecrypt {
+		return d.archiveCiphertext(w, umask, encryptedMode)
+	}
+	if err := w.writeDir(d.targetName, d.targetPerm(umask)); err != nil {
 		return err
 	}
 	for _, entryName := range sortedEntryNames(d.Entries) {
-		if err := d.Entries[entryName].archive(w, ignore, headerTemplate, umask); err != nil {
+		if err := d.Entries[entryName].archive(w, ignore, umask, encryptedMode); err != nil {
 			return err
 		}
 	}
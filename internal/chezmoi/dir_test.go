@@ -1,6 +1,7 @@
 package chezmoi
 
 import (
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -47,6 +48,14 @@ func TestDirAttributes(t *testing.T) {
 				Perm: 0o700,
 			},
 		},
+		{
+			sourceName: "concat_private_config",
+			da: DirAttributes{
+				Name:   "config",
+				Concat: true,
+				Perm:   0o700,
+			},
+		},
 		{
 			sourceName: "exact_private_dot_foo",
 			da: DirAttributes{
@@ -55,6 +64,31 @@ func TestDirAttributes(t *testing.T) {
 				Perm:  0o700,
 			},
 		},
+		{
+			sourceName: "private_empty_dot_cache",
+			da: DirAttributes{
+				Name:  ".cache",
+				Empty: true,
+				Perm:  0o700,
+			},
+		},
+		{
+			sourceName: "perm_2775_foo",
+			da: DirAttributes{
+				Name:         "foo",
+				ExplicitPerm: true,
+				Perm:         os.ModeSetgid | 0o775,
+			},
+		},
+		{
+			sourceName: "exact_perm_1777_dot_foo",
+			da: DirAttributes{
+				Name:         ".foo",
+				Exact:        true,
+				ExplicitPerm: true,
+				Perm:         os.ModeSticky | 0o777,
+			},
+		},
 	} {
 		t.Run(tc.sourceName, func(t *testing.T) {
 			assert.Equal(t, tc.da, ParseDirAttributes(tc.sourceName))
@@ -62,3 +96,44 @@ func TestDirAttributes(t *testing.T) {
 		})
 	}
 }
+
+func TestDirAttributesRoundTrip(t *testing.T) {
+	// Prefixes in the order that SourceName writes them.
+	prefixes := []string{
+		concatPrefix,
+		exactPrefix,
+		"perm_0750_",
+		privatePrefix,
+		emptyPrefix,
+		dotPrefix,
+	}
+	for i := 0; i < 1<<len(prefixes); i++ {
+		sourceName := ""
+		for j, prefix := range prefixes {
+			if i&(1<<j) != 0 {
+				sourceName += prefix
+			}
+		}
+		sourceName += "foo"
+		perm := i&(1<<2) != 0
+		private := i&(1<<3) != 0
+		t.Run(sourceName, func(t *testing.T) {
+			err := checkCanonicalSourceName(sourceName, ParseDirAttributes(sourceName).SourceName())
+			if perm && private {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	for _, sourceName := range []string{
+		"perm_755_foo",
+		"perm_0750_private_dot_foo",
+		"perm_0700_private_foo",
+	} {
+		t.Run(sourceName, func(t *testing.T) {
+			assert.Error(t, checkCanonicalSourceName(sourceName, ParseDirAttributes(sourceName).SourceName()))
+		})
+	}
+}
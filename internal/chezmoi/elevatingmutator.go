@@ -0,0 +1,208 @@
+package chezmoi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+
+	vfs "github.com/twpayne/go-vfs"
+)
+
+// An ElevationError is returned when an action that requires elevated
+// privileges fails.
+type ElevationError struct {
+	Path string
+	Err  error
+}
+
+func (e *ElevationError) Error() string {
+	return fmt.Sprintf("%s: elevation failed: %v", e.Path, e.Err)
+}
+
+// Unwrap returns e's underlying error.
+func (e *ElevationError) Unwrap() error {
+	return e.Err
+}
+
+// A rawPath is a path that must be translated to a real path before being
+// passed to a command.
+type rawPath string
+
+// An ElevatingMutator wraps a Mutator and executes actions on paths that
+// require elevated privileges by running commands prefixed with an elevation
+// command, for example sudo.
+type ElevatingMutator struct {
+	m       Mutator
+	fs      vfs.FS
+	command string
+	args    []string
+	elevate func(string) bool
+	stdin   io.Reader
+}
+
+// NewElevatingMutator returns a new ElevatingMutator that executes actions on
+// the paths for which elevate returns true by running command with args. Paths
+// are translated to real paths with fs.
+func NewElevatingMutator(m Mutator, fs vfs.FS, command string, args []string, elevate func(string) bool, stdin io.Reader) *ElevatingMutator {
+	return &ElevatingMutator{
+		m:       m,
+		fs:      fs,
+		command: command,
+		args:    args,
+		elevate: elevate,
+		stdin:   stdin,
+	}
+}
+
+// Chmod implements Mutator.Chmod.
+func (m *ElevatingMutator) Chmod(name string, mode os.FileMode) error {
+	if !m.elevate(name) {
+		return m.m.Chmod(name, mode)
+	}
+	return m.run(name, "chmod", formatPerm(mode), rawPath(name))
+}
+
+// IdempotentCmdOutput implements Mutator.IdempotentCmdOutput.
+func (m *ElevatingMutator) IdempotentCmdOutput(cmd *exec.Cmd) ([]byte, error) {
+	return m.m.IdempotentCmdOutput(cmd)
+}
+
+// Lchown implements Mutator.Lchown.
+func (m *ElevatingMutator) Lchown(name string, uid, gid int) error {
+	if !m.elevate(name) {
+		return m.m.Lchown(name, uid, gid)
+	}
+	return m.run(name, "chown", "-h", strconv.Itoa(uid)+":"+strconv.Itoa(gid), rawPath(name))
+}
+
+// Mkdir implements Mutator.Mkdir.
+func (m *ElevatingMutator) Mkdir(name string, perm os.FileMode) error {
+	if !m.elevate(name) {
+		return m.m.Mkdir(name, perm)
+	}
+	return m.run(name, "mkdir", "-m", formatPerm(perm), rawPath(name))
+}
+
+// RemoveAll implements Mutator.RemoveAll.
+func (m *ElevatingMutator) RemoveAll(name string) error {
+	if !m.elevate(name) {
+		return m.m.RemoveAll(name)
+	}
+	return m.run(name, "rm", "-rf", rawPath(name))
+}
+
+// Rename implements Mutator.Rename.
+func (m *ElevatingMutator) Rename(oldpath, newpath string) error {
+	if !m.elevate(oldpath) && !m.elevate(newpath) {
+		return m.m.Rename(oldpath, newpath)
+	}
+	return m.run(newpath, "mv", "-f", rawPath(oldpath), rawPath(newpath))
+}
+
+// RunCmd implements Mutator.RunCmd.
+func (m *ElevatingMutator) RunCmd(cmd *exec.Cmd) error {
+	return m.m.RunCmd(cmd)
+}
+
+// Stat implements Mutator.Stat.
+func (m *ElevatingMutator) Stat(name string) (os.FileInfo, error) {
+	return m.m.Stat(name)
+}
+
+// WriteFile implements Mutator.WriteFile.
+func (m *ElevatingMutator) WriteFile(name string, data []byte, perm os.FileMode, currData []byte) error {
+	if !m.elevate(name) {
+		return m.m.WriteFile(name, data, perm, currData)
+	}
+	// Write the contents to a temporary file owned by the current user, and
+	// then install it with elevated privileges.
+	tempFile, err := ioutil.TempFile("", "chezmoi-elevate")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tempFile.Name())
+	}()
+	_, err = tempFile.Write(data)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return m.run(name, "install", "-m", formatPerm(perm), tempFile.Name(), rawPath(name))
+}
+
+// WriteFileFrom implements Mutator.WriteFileFrom.
+func (m *ElevatingMutator) WriteFileFrom(name string, r io.Reader, size int64, perm os.FileMode) error {
+	if !m.elevate(name) {
+		return m.m.WriteFileFrom(name, r, size, perm)
+	}
+	tempFile, err := ioutil.TempFile("", "chezmoi-elevate")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tempFile.Name())
+	}()
+	_, err = io.Copy(tempFile, r)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return m.run(name, "install", "-m", formatPerm(perm), tempFile.Name(), rawPath(name))
+}
+
+// WriteSymlink implements Mutator.WriteSymlink.
+func (m *ElevatingMutator) WriteSymlink(oldname, newname string) error {
+	if !m.elevate(newname) {
+		return m.m.WriteSymlink(oldname, newname)
+	}
+	return m.run(newname, "ln", "-sfn", oldname, rawPath(newname))
+}
+
+// run runs name with args with elevated privileges. Arguments created with
+// rawPath are translated to real paths. If the command fails then an
+// *ElevationError for path is returned.
+func (m *ElevatingMutator) run(path, name string, args ...interface{}) error {
+	argv := append([]string{}, m.args...)
+	argv = append(argv, name)
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case rawPath:
+			p, err := m.fs.RawPath(string(arg))
+			if err != nil {
+				return err
+			}
+			argv = append(argv, p)
+		case string:
+			argv = append(argv, arg)
+		}
+	}
+	//nolint:gosec
+	cmd := exec.Command(m.command, argv...)
+	cmd.Stdin = m.stdin
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if output = bytes.TrimSpace(output); len(output) != 0 {
+			err = fmt.Errorf("%s: %w", output, err)
+		}
+		return &ElevationError{
+			Path: path,
+			Err:  err,
+		}
+	}
+	return nil
+}
+
+// formatPerm returns perm's permission bits, including the setuid, setgid, and
+// sticky bits, as an octal string suitable for chmod, for example "644".
+func formatPerm(perm os.FileMode) string {
+	return strconv.FormatUint(uint64(fileModeToUnixPerm(perm)), 8)
+}
@@ -0,0 +1,84 @@
+// +build !windows
+
+package chezmoi
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+var _ Mutator = &ElevatingMutator{}
+
+func TestElevatingMutator(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/etc": map[string]interface{}{
+			"hosts": &vfst.File{
+				Perm:     0o644,
+				Contents: []byte("# old hosts\n"),
+			},
+			"old": "# old\n",
+		},
+		"/home/user": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	elevate := func(name string) bool {
+		return filepath.Dir(name) == "/etc"
+	}
+	// env runs its arguments as a command, so it stands in for sudo.
+	m := NewElevatingMutator(NewFSMutator(fs), fs, "env", nil, elevate, nil)
+	require.NoError(t, m.WriteFile("/etc/hosts", []byte("# hosts\n"), 0o600, nil))
+	require.NoError(t, m.Mkdir("/etc/foo", 0o700))
+	require.NoError(t, m.Chmod("/etc/foo", 0o755))
+	require.NoError(t, m.WriteSymlink("hosts", "/etc/bar"))
+	require.NoError(t, m.Rename("/etc/old", "/etc/new"))
+	require.NoError(t, m.WriteFile("/home/user/.bashrc", []byte("# .bashrc\n"), 0o644, nil))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/etc/hosts",
+			vfst.TestModeIsRegular,
+			vfst.TestModePerm(0o600),
+			vfst.TestContentsString("# hosts\n"),
+		),
+		vfst.TestPath("/etc/foo",
+			vfst.TestIsDir,
+			vfst.TestModePerm(0o755),
+		),
+		vfst.TestPath("/etc/bar",
+			vfst.TestModeType(os.ModeSymlink),
+			vfst.TestSymlinkTarget("hosts"),
+		),
+		vfst.TestPath("/etc/old",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/etc/new",
+			vfst.TestContentsString("# old\n"),
+		),
+		vfst.TestPath("/home/user/.bashrc",
+			vfst.TestContentsString("# .bashrc\n"),
+		),
+	)
+	require.NoError(t, m.RemoveAll("/etc/foo"))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/etc/foo",
+			vfst.TestDoesNotExist,
+		),
+	)
+
+	m = NewElevatingMutator(NewFSMutator(fs), fs, "false", nil, elevate, nil)
+	err = m.WriteFile("/etc/hosts", []byte("# new hosts\n"), 0o644, nil)
+	var elevationErr *ElevationError
+	require.True(t, errors.As(err, &elevationErr))
+	assert.Equal(t, "/etc/hosts", elevationErr.Path)
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/etc/hosts",
+			vfst.TestContentsString("# hosts\n"),
+		),
+	)
+}
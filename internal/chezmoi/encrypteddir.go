@@ -0,0 +1,296 @@
+package chezmoi
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	vfs "github.com/twpayne/go-vfs"
+)
+
+// encryptedDirBundleName is the name of the file in an encrypted source
+// directory that contains the encrypted bundle of the directory's contents.
+const encryptedDirBundleName = "bundle"
+
+// bundleModTime is the modification time of every entry in a bundle, so that
+// bundles of the same contents are identical.
+var bundleModTime = time.Unix(0, 0)
+
+// EncryptedDir returns the encrypted directory that contains entry, or nil if
+// entry is not inside an encrypted directory.
+func (ts *TargetState) EncryptedDir(entry Entry) *Dir {
+	targetName, ok := ts.unmapTargetName(entry.TargetName())
+	if !ok {
+		return nil
+	}
+	return ts.encryptedDirOf(targetName)
+}
+
+// UpdateEncryptedDir replaces the contents of the encrypted directory dir with
+// the contents of the directory at path in fs. The bundle in the source state
+// is only rewritten if the contents have changed, as encrypting the same
+// contents again results in different ciphertext.
+func (ts *TargetState) UpdateEncryptedDir(fs vfs.FS, dir *Dir, path string, mutator Mutator) error {
+	bundle, err := ts.newEncryptedDirBundle(fs, path, dir.targetName)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(bundle, dir.bundle) {
+		return nil
+	}
+	dir.Entries = make(map[string]Entry)
+	if err := dir.unbundle(bundle); err != nil {
+		return err
+	}
+	ciphertext, err := ts.Encryption.Encrypt(bundle)
+	if err != nil {
+		return err
+	}
+	dir.bundle = bundle
+	dir.evaluateCiphertext = func() ([]byte, error) {
+		return ciphertext, nil
+	}
+	return mutator.WriteFile(filepath.Join(ts.SourcePath(dir), encryptedDirBundleName), ciphertext, 0o666&^ts.Umask, nil)
+}
+
+// addEncryptedDir adds the directory at targetPath as an encrypted directory,
+// or updates its contents if it is already an encrypted directory. The
+// attributes of existing encrypted directories are not changed.
+func (ts *TargetState) addEncryptedDir(fs vfs.FS, targetName, targetPath string, entries map[string]Entry, parentDirSourceName string, exact bool, perm os.FileMode, explicitPerm bool, mutator Mutator) error {
+	name := filepath.Base(targetName)
+	if entry, ok := entries[name]; ok && ts.EntrySourceDir(entry) == ts.SourceDir {
+		dir, ok := entry.(*Dir)
+		if !ok || !dir.Encrypted {
+			return fmt.Errorf("%s: already added and not an encrypted directory", targetName)
+		}
+		return ts.UpdateEncryptedDir(fs, dir, targetPath, mutator)
+	}
+	sourceName := DirAttributes{
+		Name:         name,
+		Encrypted:    true,
+		Exact:        exact,
+		ExplicitPerm: explicitPerm,
+		Perm:         perm,
+	}.SourceName()
+	if err := checkRepresentableName(targetName, name, sourceName, ParseDirAttributes(sourceName).Name); err != nil {
+		return err
+	}
+	if parentDirSourceName != "" {
+		sourceName = filepath.Join(parentDirSourceName, sourceName)
+	}
+	dir := newDir(sourceName, ts.mapTargetName(targetName), exact, perm)
+	dir.Encrypted = true
+	dir.ExplicitPerm = explicitPerm
+	if err := mutator.Mkdir(filepath.Join(ts.SourceDir, sourceName), 0o777&^ts.Umask); err != nil {
+		return err
+	}
+	entries[name] = dir
+	return ts.UpdateEncryptedDir(fs, dir, targetPath, mutator)
+}
+
+// encryptedDirOf returns the encrypted directory that contains the target
+// with the logical name targetName, or nil if there is none.
+func (ts *TargetState) encryptedDirOf(targetName string) *Dir {
+	components := splitPathList(targetName)
+	entries := ts.Entries
+	for _, component := range components[:len(components)-1] {
+		dir, ok := entries[component].(*Dir)
+		if !ok {
+			return nil
+		}
+		if dir.Encrypted {
+			return dir
+		}
+		entries = dir.Entries
+	}
+	return nil
+}
+
+// newEncryptedDir returns a new encrypted directory populated from the bundle
+// in the source directory at path. If noDecrypt is true then the bundle is not
+// decrypted and the directory has no entries.
+func (ts *TargetState) newEncryptedDir(fs vfs.FS, path, sourceName, targetName, entrySourceDir string, da DirAttributes, noDecrypt bool) (*Dir, error) {
+	bundlePath := filepath.Join(path, encryptedDirBundleName)
+	ciphertext, err := fs.ReadFile(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	perm := da.Perm
+	// As for encrypted files, the contents of encrypted directories are
+	// secrets.
+	if ts.EncryptedPrivate && !da.ExplicitPerm {
+		perm &^= 0o77
+	}
+	dir := newDir(sourceName, targetName, da.Exact, perm)
+	dir.sourceDir = entrySourceDir
+	dir.Encrypted = true
+	dir.ExplicitPerm = da.ExplicitPerm
+	dir.evaluateCiphertext = func() ([]byte, error) {
+		return ciphertext, nil
+	}
+	if noDecrypt {
+		return dir, nil
+	}
+	bundle, err := ts.Encryption.Decrypt(ciphertext)
+	if err != nil {
+		return nil, &DecryptionError{Path: bundlePath, Err: err}
+	}
+	if err := dir.unbundle(bundle); err != nil {
+		return nil, fmt.Errorf("%s: %w", bundlePath, err)
+	}
+	dir.bundle = bundle
+	return dir, nil
+}
+
+// newEncryptedDirBundle returns a bundle of the contents of the directory at
+// dirPath in fs, excluding targets that are ignored. The bundle is a tar
+// archive whose entries are in lexical order and contain only names,
+// permissions, and contents, so that the same contents always result in the
+// same bundle.
+func (ts *TargetState) newEncryptedDirBundle(fs vfs.FS, dirPath, targetName string) ([]byte, error) {
+	b := &bytes.Buffer{}
+	w := tar.NewWriter(b)
+	if err := vfs.Walk(fs, dirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dirPath, path)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+		if ts.TargetIgnore.Match(filepath.Join(targetName, relPath)) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		header := &tar.Header{
+			Name:    filepath.ToSlash(relPath),
+			Mode:    int64(fileModeToUnixPerm(info.Mode())),
+			ModTime: bundleModTime,
+		}
+		switch {
+		case info.IsDir():
+			header.Typeflag = tar.TypeDir
+			header.Name += "/"
+			return w.WriteHeader(header)
+		case info.Mode().IsRegular():
+			contents, err := fs.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			header.Typeflag = tar.TypeReg
+			header.Size = int64(len(contents))
+			if err := w.WriteHeader(header); err != nil {
+				return err
+			}
+			_, err = w.Write(contents)
+			return err
+		case info.Mode()&os.ModeType == os.ModeSymlink:
+			linkname, err := fs.Readlink(path)
+			if err != nil {
+				return err
+			}
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = linkname
+			return w.WriteHeader(header)
+		case info.Mode()&(os.ModeSocket|os.ModeNamedPipe) != 0:
+			// Sockets and named pipes, like gpg-agent's, are created by
+			// running programs and are not part of the directory's contents.
+			return nil
+		default:
+			return fmt.Errorf("%s: not a regular file, directory, or symlink", path)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// archiveCiphertext writes d's bundle to w under d's source name, unless
+// encryptedMode is EncryptedModeSkip.
+func (d *Dir) archiveCiphertext(w archiveWriter, umask os.FileMode, encryptedMode EncryptedMode) error {
+	if encryptedMode == EncryptedModeSkip || d.evaluateCiphertext == nil {
+		return nil
+	}
+	ciphertext, err := d.evaluateCiphertext()
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(filepath.Dir(d.targetName), filepath.Base(d.sourceName))
+	if err := w.writeDir(name, d.targetPerm(umask)); err != nil {
+		return err
+	}
+	return w.writeFile(filepath.Join(name, encryptedDirBundleName), ciphertext, 0o666&^umask)
+}
+
+// unbundle adds the entries in bundle to d. Entries inside an encrypted
+// directory have the encrypted directory's source name.
+func (d *Dir) unbundle(bundle []byte) error {
+	r := tar.NewReader(bytes.NewReader(bundle))
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		name := path.Clean(header.Name)
+		if path.IsAbs(name) || name == "." || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("%s: invalid name", header.Name)
+		}
+		components := strings.Split(name, "/")
+		entries := d.Entries
+		for _, component := range components[:len(components)-1] {
+			dir, ok := entries[component].(*Dir)
+			if !ok {
+				return fmt.Errorf("%s: parent directory missing", header.Name)
+			}
+			entries = dir.Entries
+		}
+		base := components[len(components)-1]
+		targetName := filepath.Join(d.targetName, filepath.FromSlash(name))
+		perm := os.FileMode(header.Mode) & os.ModePerm
+		switch header.Typeflag {
+		case tar.TypeDir:
+			dir := newDir(d.sourceName, targetName, d.Exact, perm)
+			dir.sourceDir = d.sourceDir
+			entries[base] = dir
+		case tar.TypeReg:
+			contents, err := ioutil.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			entries[base] = &File{
+				sourceDir:  d.sourceDir,
+				sourceName: d.sourceName,
+				targetName: targetName,
+				Empty:      len(contents) == 0,
+				Perm:       perm,
+				contents:   contents,
+			}
+		case tar.TypeSymlink:
+			entries[base] = &Symlink{
+				sourceDir:  d.sourceDir,
+				sourceName: d.sourceName,
+				targetName: targetName,
+				linkname:   header.Linkname,
+			}
+		default:
+			return fmt.Errorf("%s: unsupported type %q", header.Name, header.Typeflag)
+		}
+	}
+}
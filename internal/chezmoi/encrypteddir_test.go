@@ -0,0 +1,220 @@
+package chezmoi
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	vfs "github.com/twpayne/go-vfs"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+// xorEncryption is an Encryption that inverts every bit.
+type xorEncryption struct{}
+
+func (xorEncryption) Decrypt(ciphertext []byte) ([]byte, error) {
+	return xorEncryption{}.Encrypt(ciphertext)
+}
+
+func (xorEncryption) Encrypt(plaintext []byte) ([]byte, error) {
+	ciphertext := make([]byte, len(plaintext))
+	for i, b := range plaintext {
+		ciphertext[i] = ^b
+	}
+	return ciphertext, nil
+}
+
+func newEncryptedDirTestTargetState(t *testing.T, fs vfs.FS) *TargetState {
+	t.Helper()
+	ts := NewTargetState(
+		WithDestDir("/home/user"),
+		WithEncryptedPrivate(true),
+		WithEncryption(xorEncryption{}),
+		WithSourceDir("/home/user/.local/share/chezmoi"),
+		WithUmask(0o22),
+	)
+	require.NoError(t, ts.Populate(fs, nil))
+	return ts
+}
+
+func TestEncryptedDir(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".gnupg": &vfst.Dir{
+				Perm: 0o700,
+				Entries: map[string]interface{}{
+					"gpg.conf":           "use-agent\n",
+					"private-keys-v1.d":  &vfst.Dir{Perm: 0o700, Entries: map[string]interface{}{"key": &vfst.File{Perm: 0o600, Contents: []byte("secret\n")}}},
+					"pubring.kbx":        &vfst.Symlink{Target: "pubring.kbx~"},
+					"trustdb.gpg":        "",
+					"random_seed.ignore": "random\n",
+				},
+			},
+			".local/share/chezmoi/.chezmoiignore": ".gnupg/random_seed.ignore\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	ts := newEncryptedDirTestTargetState(t, fs)
+	require.NoError(t, ts.Add(fs, AddOptions{Encrypt: true}, "/home/user/.gnupg", nil, false, NewFSMutator(fs)))
+
+	// The bundle does not leak the names of the files in the directory.
+	bundlePath := "/home/user/.local/share/chezmoi/encrypted_private_dot_gnupg/bundle"
+	ciphertext, err := fs.ReadFile(bundlePath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(ciphertext), "gpg.conf")
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.local/share/chezmoi/encrypted_private_dot_gnupg",
+			vfst.TestIsDir,
+		),
+	)
+
+	// The bundle is a tar archive of the contents of the directory, without
+	// ignored files.
+	bundle, err := xorEncryption{}.Decrypt(ciphertext)
+	require.NoError(t, err)
+	r := tar.NewReader(bytes.NewReader(bundle))
+	var names []string
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, header.Name)
+		assert.Equal(t, bundleModTime, header.ModTime)
+	}
+	assert.Equal(t, []string{
+		"gpg.conf",
+		"private-keys-v1.d/",
+		"private-keys-v1.d/key",
+		"pubring.kbx",
+		"trustdb.gpg",
+	}, names)
+
+	// Adding the directory again, or a target inside it, does not change the
+	// bundle unless the contents have changed.
+	ts = newEncryptedDirTestTargetState(t, fs)
+	sb := &strings.Builder{}
+	logMutator := NewLogMutator(sb, NewFSMutator(fs), fs, false)
+	require.NoError(t, ts.Add(fs, AddOptions{}, "/home/user/.gnupg", nil, false, logMutator))
+	require.NoError(t, ts.Add(fs, AddOptions{}, "/home/user/.gnupg/gpg.conf", nil, false, logMutator))
+	assert.Equal(t, "", sb.String())
+	require.NoError(t, fs.WriteFile("/home/user/.gnupg/gpg.conf", []byte("no-use-agent\n"), 0o644))
+	require.NoError(t, ts.Add(fs, AddOptions{}, "/home/user/.gnupg/gpg.conf", nil, false, logMutator))
+	assert.Contains(t, sb.String(), bundlePath)
+
+	// The entries of the encrypted directory are populated from the bundle.
+	ts = newEncryptedDirTestTargetState(t, fs)
+	dir, ok := ts.Entries[".gnupg"].(*Dir)
+	require.True(t, ok)
+	assert.True(t, dir.Encrypted)
+	assert.Equal(t, "encrypted_private_dot_gnupg", dir.SourceName())
+	file, ok := dir.Entries["gpg.conf"].(*File)
+	require.True(t, ok)
+	contents, err := file.Contents()
+	require.NoError(t, err)
+	assert.Equal(t, "no-use-agent\n", string(contents))
+	assert.Equal(t, dir, ts.EncryptedDir(file))
+	assert.Nil(t, ts.EncryptedDir(dir))
+
+	// Applying the encrypted directory recreates its contents.
+	require.NoError(t, fs.RemoveAll("/home/user/.gnupg"))
+	require.NoError(t, ts.Apply(fs, NewFSMutator(fs), false, &ApplyOptions{
+		DestDir:           ts.DestDir,
+		Ignore:            ts.TargetIgnore.Match,
+		ScriptStateBucket: []byte("script"),
+		Stdout:            ioutil.Discard,
+		Umask:             ts.Umask,
+	}))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.gnupg",
+			vfst.TestIsDir,
+			vfst.TestModePerm(0o700),
+		),
+		vfst.TestPath("/home/user/.gnupg/gpg.conf",
+			vfst.TestModeIsRegular,
+			vfst.TestModePerm(0o644),
+			vfst.TestContentsString("no-use-agent\n"),
+		),
+		vfst.TestPath("/home/user/.gnupg/private-keys-v1.d",
+			vfst.TestIsDir,
+			vfst.TestModePerm(0o700),
+		),
+		vfst.TestPath("/home/user/.gnupg/private-keys-v1.d/key",
+			vfst.TestModeIsRegular,
+			vfst.TestModePerm(0o600),
+			vfst.TestContentsString("secret\n"),
+		),
+		vfst.TestPath("/home/user/.gnupg/pubring.kbx",
+			vfst.TestModeType(os.ModeSymlink),
+			vfst.TestSymlinkTarget("pubring.kbx~"),
+		),
+		vfst.TestPath("/home/user/.gnupg/trustdb.gpg",
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString(""),
+		),
+		vfst.TestPath("/home/user/.gnupg/random_seed.ignore",
+			vfst.TestDoesNotExist,
+		),
+	)
+}
+
+func TestEncryptedDirArchive(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.gnupg/gpg.conf":      "use-agent\n",
+		"/home/user/.local/share/chezmoi": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	ts := newEncryptedDirTestTargetState(t, fs)
+	require.NoError(t, ts.Add(fs, AddOptions{Encrypt: true}, "/home/user/.gnupg", nil, false, NewFSMutator(fs)))
+	ts = newEncryptedDirTestTargetState(t, fs)
+
+	for _, tc := range []struct {
+		name          string
+		encryptedMode EncryptedMode
+		expectedNames []string
+	}{
+		{
+			name:          "ciphertext",
+			encryptedMode: EncryptedModeCiphertext,
+			expectedNames: []string{"encrypted_private_dot_gnupg", "encrypted_private_dot_gnupg/bundle"},
+		},
+		{
+			name:          "skip",
+			encryptedMode: EncryptedModeSkip,
+		},
+		{
+			name:          "decrypt",
+			encryptedMode: EncryptedModeDecrypt,
+			expectedNames: []string{".gnupg", ".gnupg/gpg.conf"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			w := tar.NewWriter(b)
+			require.NoError(t, ts.ArchiveTAR(w, 0o22, tc.encryptedMode))
+			require.NoError(t, w.Close())
+			r := tar.NewReader(b)
+			var names []string
+			for {
+				header, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				names = append(names, header.Name)
+			}
+			assert.Equal(t, tc.expectedNames, names)
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package chezmoi
+
+import "fmt"
+
+// An Encryption encrypts and decrypts data.
+type Encryption interface {
+	Decrypt(ciphertext []byte) ([]byte, error)
+	Encrypt(plaintext []byte) ([]byte, error)
+}
+
+// A DecryptionError is returned when the source file at Path cannot be
+// decrypted, for example because the key is not available.
+type DecryptionError struct {
+	Path string
+	Err  error
+}
+
+func (e *DecryptionError) Error() string {
+	return fmt.Sprintf("%s: decryption failed: %v", e.Path, e.Err)
+}
+
+// Unwrap returns e's underlying error.
+func (e *DecryptionError) Unwrap() error {
+	return e.Err
+}
@@ -1,9 +1,9 @@
 package chezmoi
 
 import (
-	"archive/tar"
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -13,32 +13,47 @@ import (
 
 // A FileAttributes holds attributes parsed from a source file name.
 type FileAttributes struct {
-	Name      string
-	Mode      os.FileMode
-	Empty     bool
-	Encrypted bool
-	Template  bool
+	Name         string
+	Mode         os.FileMode
+	Create       bool
+	Empty        bool
+	Encrypted    bool
+	ExplicitPerm bool
+	Link         bool
+	Modify       bool
+	Template     bool
 }
 
 // A File represents the target state of a file.
 type File struct {
-	sourceName       string
-	targetName       string
-	Empty            bool
-	Encrypted        bool
-	Perm             os.FileMode
-	Template         bool
-	contents         []byte
-	contentsErr      error
-	evaluateContents func() ([]byte, error)
+	sourceDir          string
+	sourceName         string
+	targetName         string
+	Create             bool
+	Empty              bool
+	Encrypted          bool
+	ExplicitPerm       bool
+	Modify             bool
+	Perm               os.FileMode
+	Template           bool
+	contents           []byte
+	contentsErr        error
+	evaluateCiphertext func() ([]byte, error)
+	evaluateContents   func() ([]byte, error)
+	// openContents, if set, opens the contents of a file that is too large to
+	// hold in memory, which are size bytes long.
+	openContents func() (io.ReadCloser, error)
+	size         int64
 }
 
 type fileConcreteValue struct {
 	Type       string `json:"type" yaml:"type"`
 	SourcePath string `json:"sourcePath" yaml:"sourcePath"`
 	TargetPath string `json:"targetPath" yaml:"targetPath"`
+	Create     bool   `json:"create" yaml:"create"`
 	Empty      bool   `json:"empty" yaml:"empty"`
 	Encrypted  bool   `json:"encrypted" yaml:"encrypted"`
+	Modify     bool   `json:"modify" yaml:"modify"`
 	Perm       int    `json:"perm" yaml:"perm"`
 	Template   bool   `json:"template" yaml:"template"`
 	Contents   string `json:"contents" yaml:"contents"`
@@ -48,18 +63,36 @@ type fileConcreteValue struct {
 func ParseFileAttributes(sourceName string) FileAttributes {
 	name := sourceName
 	mode := os.FileMode(0o666)
+	create := false
 	empty := false
 	encrypted := false
+	explicitPerm := false
+	link := false
+	modify := false
 	template := false
 	if strings.HasPrefix(name, symlinkPrefix) {
 		name = strings.TrimPrefix(name, symlinkPrefix)
 		mode |= os.ModeSymlink
 	} else {
+		if strings.HasPrefix(name, modifyPrefix) {
+			name = strings.TrimPrefix(name, modifyPrefix)
+			modify = true
+		}
+		if strings.HasPrefix(name, linkPrefix) {
+			name = strings.TrimPrefix(name, linkPrefix)
+			link = true
+		}
+		if strings.HasPrefix(name, createPrefix) {
+			name = strings.TrimPrefix(name, createPrefix)
+			create = true
+		}
 		private := false
 		if strings.HasPrefix(name, encryptedPrefix) {
 			name = strings.TrimPrefix(name, encryptedPrefix)
 			encrypted = true
 		}
+		var perm os.FileMode
+		perm, name, explicitPerm = trimPermAttribute(name)
 		if strings.HasPrefix(name, privatePrefix) {
 			name = strings.TrimPrefix(name, privatePrefix)
 			private = true
@@ -72,7 +105,10 @@ func ParseFileAttributes(sourceName string) FileAttributes {
 			name = strings.TrimPrefix(name, executablePrefix)
 			mode |= 0o111
 		}
-		if private {
+		switch {
+		case explicitPerm:
+			mode = perm
+		case private:
 			mode &= 0o700
 		}
 	}
@@ -84,11 +120,15 @@ func ParseFileAttributes(sourceName string) FileAttributes {
 		template = true
 	}
 	return FileAttributes{
-		Name:      name,
-		Mode:      mode,
-		Empty:     empty,
-		Encrypted: encrypted,
-		Template:  template,
+		Name:         name,
+		Mode:         mode,
+		Create:       create,
+		Empty:        empty,
+		Encrypted:    encrypted,
+		ExplicitPerm: explicitPerm,
+		Link:         link,
+		Modify:       modify,
+		Template:     template,
 	}
 }
 
@@ -97,16 +137,27 @@ func (fa FileAttributes) SourceName() string {
 	sourceName := ""
 	switch fa.Mode & os.ModeType {
 	case 0:
+		if fa.Modify {
+			sourceName += modifyPrefix
+		}
+		if fa.Link {
+			sourceName += linkPrefix
+		}
+		if fa.Create {
+			sourceName += createPrefix
+		}
 		if fa.Encrypted {
 			sourceName += encryptedPrefix
 		}
-		if fa.Mode.Perm()&os.FileMode(0o77) == os.FileMode(0) {
+		if fa.ExplicitPerm {
+			sourceName += permAttribute(fa.Mode & permMask)
+		} else if fa.Mode.Perm()&os.FileMode(0o77) == os.FileMode(0) {
 			sourceName += privatePrefix
 		}
 		if fa.Empty {
 			sourceName += emptyPrefix
 		}
-		if fa.Mode.Perm()&os.FileMode(0o111) != os.FileMode(0) {
+		if !fa.ExplicitPerm && fa.Mode.Perm()&os.FileMode(0o111) != os.FileMode(0) {
 			sourceName += executablePrefix
 		}
 	case os.ModeSymlink:
@@ -125,6 +176,28 @@ func (fa FileAttributes) SourceName() string {
 	return sourceName
 }
 
+// isLinkable returns whether the regular file with attributes fa whose source
+// file has info can be deployed as a symlink to its source file without
+// changing its target's contents or permissions. Encrypted files and templates
+// are evaluated, files with special permissions would get the source file's
+// permissions, empty files are removed unless they have the empty_ attribute,
+// files with the create_ attribute must not be replaced once they exist, and
+// modify_ scripts are run.
+func isLinkable(fa FileAttributes, info os.FileInfo) bool {
+	switch {
+	case fa.Mode&os.ModeType != 0:
+		return false
+	case fa.Create || fa.Encrypted || fa.Modify || fa.Template || fa.ExplicitPerm:
+		return false
+	case fa.Mode.Perm()&0o77 == 0 || fa.Mode.Perm()&0o111 != 0:
+		return false
+	case info.Size() == 0 && !fa.Empty:
+		return false
+	default:
+		return true
+	}
+}
+
 // AppendAllEntries appends all f to allEntries.
 func (f *File) AppendAllEntries(allEntries []Entry) []Entry {
 	return append(allEntries, f)
@@ -135,6 +208,17 @@ func (f *File) Apply(fs vfs.FS, mutator Mutator, follow bool, applyOptions *Appl
 	if applyOptions.Ignore(f.targetName) {
 		return nil
 	}
+	if f.Create {
+		// Files with the create_ attribute are only written if their target
+		// does not exist, so their contents are not even evaluated if it does.
+		exists, err := targetExists(fs, filepath.Join(applyOptions.DestDir, f.targetName), follow)
+		if err != nil || exists {
+			return err
+		}
+	}
+	if f.openContents != nil {
+		return f.applyFrom(fs, mutator, follow, applyOptions)
+	}
 	contents, err := f.Contents()
 	if err != nil {
 		return err
@@ -159,8 +243,8 @@ func (f *File) Apply(fs vfs.FS, mutator Mutator, follow bool, applyOptions *Appl
 		if !bytes.Equal(currData, contents) {
 			break
 		}
-		if info.Mode().Perm() != f.Perm&^applyOptions.Umask {
-			if err := mutator.Chmod(targetPath, f.Perm&^applyOptions.Umask); err != nil {
+		if info.Mode()&permMask != f.targetPerm(applyOptions.Umask) {
+			if err := mutator.Chmod(targetPath, f.targetPerm(applyOptions.Umask)); err != nil {
 				return err
 			}
 		}
@@ -176,25 +260,126 @@ func (f *File) Apply(fs vfs.FS, mutator Mutator, follow bool, applyOptions *Appl
 	if isEmpty(contents) && !f.Empty {
 		return nil
 	}
-	return mutator.WriteFile(targetPath, contents, f.Perm&^applyOptions.Umask, currData)
+	if err := mutator.WriteFile(targetPath, contents, f.targetPerm(applyOptions.Umask), currData); err != nil {
+		return err
+	}
+	if !f.ExplicitPerm {
+		return nil
+	}
+	// Files are created subject to the process's umask, which also clears the
+	// setuid, setgid, and sticky bits on some systems, so ensure that explicit
+	// permissions are set exactly.
+	return chmodExplicitPerm(mutator, targetPath, f.Perm)
+}
+
+// applyFrom ensures that the state of targetPath in fs matches f, streaming f's
+// contents instead of reading them into memory. The contents of an existing
+// target with the same size are compared by their hashes.
+func (f *File) applyFrom(fs vfs.FS, mutator Mutator, follow bool, applyOptions *ApplyOptions) error {
+	targetPath := filepath.Join(applyOptions.DestDir, f.targetName)
+	var info os.FileInfo
+	var err error
+	if follow {
+		info, err = fs.Stat(targetPath)
+	} else {
+		info, err = fs.Lstat(targetPath)
+	}
+	switch {
+	case err == nil && info.Mode().IsRegular():
+		if info.Size() != f.size {
+			break
+		}
+		same, err := f.sameContents(fs, targetPath)
+		if err != nil {
+			return err
+		}
+		if !same {
+			break
+		}
+		if info.Mode()&permMask != f.targetPerm(applyOptions.Umask) {
+			if err := mutator.Chmod(targetPath, f.targetPerm(applyOptions.Umask)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case err == nil:
+		if err := mutator.RemoveAll(targetPath); err != nil {
+			return err
+		}
+	case os.IsNotExist(err):
+	default:
+		return err
+	}
+	r, err := f.openContents()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := mutator.WriteFileFrom(targetPath, r, f.size, f.targetPerm(applyOptions.Umask)); err != nil {
+		return err
+	}
+	if !f.ExplicitPerm {
+		return nil
+	}
+	return chmodExplicitPerm(mutator, targetPath, f.Perm)
+}
+
+// targetExists returns whether targetPath exists in fs, following a final
+// symlink if follow is set.
+func targetExists(fs vfs.FS, targetPath string, follow bool) (bool, error) {
+	var err error
+	if follow {
+		_, err = fs.Stat(targetPath)
+	} else {
+		_, err = fs.Lstat(targetPath)
+	}
+	switch {
+	case err == nil:
+		return true, nil
+	case os.IsNotExist(err):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// sameContents returns whether targetPath in fs has the same contents as f,
+// comparing their hashes.
+func (f *File) sameContents(fs vfs.FS, targetPath string) (bool, error) {
+	targetHash, err := HashFile(fs, targetPath)
+	if err != nil {
+		return false, err
+	}
+	r, err := f.openContents()
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	hash, err := hashReader(r)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(hash, targetHash), nil
 }
 
 // ConcreteValue implements Entry.ConcreteValue.
-func (f *File) ConcreteValue(ignore func(string) bool, sourceDir string, umask os.FileMode, recursive bool) (interface{}, error) {
+func (f *File) ConcreteValue(ignore func(string) bool, sourceDir string, umask os.FileMode, encryptedMode EncryptedMode, recursive bool) (interface{}, error) {
 	if ignore(f.targetName) {
 		return nil, nil
 	}
-	contents, err := f.Contents()
-	if err != nil {
+	targetName, contents, ok, err := f.exportedContents(encryptedMode)
+	if err != nil || !ok {
 		return nil, err
 	}
 	return &fileConcreteValue{
 		Type:       "file",
-		SourcePath: filepath.Join(sourceDir, f.SourceName()),
-		TargetPath: f.TargetName(),
+		SourcePath: sourcePath(f, sourceDir),
+		TargetPath: targetName,
+		Create:     f.Create,
 		Empty:      f.Empty,
 		Encrypted:  f.Encrypted,
-		Perm:       int(f.Perm &^ umask),
+		Modify:     f.Modify,
+		Perm:       int(fileModeToUnixPerm(f.targetPerm(umask))),
 		Template:   f.Template,
 		Contents:   string(contents),
 	}, nil
@@ -209,9 +394,41 @@ func (f *File) Contents() ([]byte, error) {
 	return f.contents, f.contentsErr
 }
 
+// AppliedContents returns the contents of f's target once f has been applied
+// without error, and whether they are known without reading the target. They
+// are not known for files with the create_ attribute, which are not written if
+// their target exists, for large files, which are not held in memory, or if
+// f's contents have not been evaluated.
+func (f *File) AppliedContents() ([]byte, bool) {
+	if f.Create || f.openContents != nil || f.evaluateContents != nil || f.contentsErr != nil {
+		return nil, false
+	}
+	return f.contents, true
+}
+
+// exportedContents returns the target name and contents with which f is
+// exported with encryptedMode, and false if f should not be exported at all.
+// Unless encryptedMode is EncryptedModeDecrypt, encrypted files are never
+// decrypted.
+func (f *File) exportedContents(encryptedMode EncryptedMode) (string, []byte, bool, error) {
+	if !f.Encrypted || encryptedMode == EncryptedModeDecrypt {
+		contents, err := f.Contents()
+		return f.targetName, contents, true, err
+	}
+	if encryptedMode == EncryptedModeSkip || f.evaluateCiphertext == nil {
+		return "", nil, false, nil
+	}
+	ciphertext, err := f.evaluateCiphertext()
+	if err != nil {
+		return "", nil, false, err
+	}
+	targetName := filepath.Join(filepath.Dir(f.targetName), filepath.Base(f.sourceName))
+	return targetName, ciphertext, true, nil
+}
+
 // Evaluate evaluates f's contents.
 func (f *File) Evaluate(ignore func(string) bool) error {
-	if ignore(f.targetName) {
+	if ignore(f.targetName) || f.openContents != nil {
 		return nil
 	}
 	_, err := f.Contents()
@@ -233,31 +450,44 @@ func (f *File) SourceName() string {
 	return f.sourceName
 }
 
+// sourceDirectory implements Entry.sourceDirectory.
+func (f *File) sourceDirectory() string {
+	return f.sourceDir
+}
+
 // TargetName implements Entry.TargetName.
 func (f *File) TargetName() string {
 	return f.targetName
 }
 
+// targetPerm returns f's target permissions with umask applied. Explicit
+// permissions are not subject to umask.
+func (f *File) targetPerm(umask os.FileMode) os.FileMode {
+	if f.ExplicitPerm {
+		return f.Perm
+	}
+	return f.Perm &^ umask
+}
+
 // archive writes f to w.
-func (f *File) archive(w *tar.Writer, ignore func(string) bool, headerTemplate *tar.Header, umask os.FileMode) error {
+func (f *File) archive(w archiveWriter, ignore func(string) bool, umask os.FileMode, encryptedMode EncryptedMode) error {
 	if ignore(f.targetName) {
 		return nil
 	}
-	contents, err := f.Contents()
-	if err != nil {
+	if f.openContents != nil {
+		r, err := f.openContents()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		return w.writeFileFrom(f.targetName, r, f.size, f.targetPerm(umask))
+	}
+	targetName, contents, ok, err := f.exportedContents(encryptedMode)
+	if err != nil || !ok {
 		return err
 	}
 	if len(contents) == 0 && !f.Empty {
 		return nil
 	}
-	header := *headerTemplate
-	header.Typeflag = tar.TypeReg
-	header.Name = f.targetName
-	header.Size = int64(len(contents))
-	header.Mode = int64(f.Perm &^ umask)
-	if err := w.WriteHeader(&header); err != nil {
-		return nil
-	}
-	_, err = w.Write(contents)
-	return err
+	return w.writeFile(targetName, contents, f.targetPerm(umask))
 }
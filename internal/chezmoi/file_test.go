@@ -106,6 +106,49 @@ func TestFileAttributes(t *testing.T) {
 				Template: true,
 			},
 		},
+		{
+			sourceName: "link_dot_foo",
+			fa: FileAttributes{
+				Name: ".foo",
+				Mode: 0o666,
+				Link: true,
+			},
+		},
+		{
+			sourceName: "link_executable_foo",
+			fa: FileAttributes{
+				Name: "foo",
+				Mode: 0o777,
+				Link: true,
+			},
+		},
+		{
+			sourceName: "create_dot_foo",
+			fa: FileAttributes{
+				Name:   ".foo",
+				Mode:   0o666,
+				Create: true,
+			},
+		},
+		{
+			sourceName: "create_encrypted_private_dot_foo.tmpl",
+			fa: FileAttributes{
+				Name:      ".foo",
+				Mode:      0o600,
+				Create:    true,
+				Encrypted: true,
+				Template:  true,
+			},
+		},
+		{
+			sourceName: "modify_private_dot_foo.tmpl",
+			fa: FileAttributes{
+				Name:     ".foo",
+				Mode:     0o600,
+				Modify:   true,
+				Template: true,
+			},
+		},
 		{
 			sourceName: "encrypted_private_dot_secret_file",
 			fa: FileAttributes{
@@ -114,6 +157,32 @@ func TestFileAttributes(t *testing.T) {
 				Encrypted: true,
 			},
 		},
+		{
+			sourceName: "perm_0640_dot_foo",
+			fa: FileAttributes{
+				Name:         ".foo",
+				Mode:         0o640,
+				ExplicitPerm: true,
+			},
+		},
+		{
+			sourceName: "encrypted_perm_4750_empty_foo.tmpl",
+			fa: FileAttributes{
+				Name:         "foo",
+				Mode:         os.ModeSetuid | 0o750,
+				Empty:        true,
+				Encrypted:    true,
+				ExplicitPerm: true,
+				Template:     true,
+			},
+		},
+		{
+			sourceName: "perm_01_foo",
+			fa: FileAttributes{
+				Name: "perm_01_foo",
+				Mode: 0o666,
+			},
+		},
 	} {
 		t.Run(tc.sourceName, func(t *testing.T) {
 			assert.Equal(t, tc.fa, ParseFileAttributes(tc.sourceName))
@@ -121,3 +190,51 @@ func TestFileAttributes(t *testing.T) {
 		})
 	}
 }
+
+func TestFileAttributesRoundTrip(t *testing.T) {
+	// Prefixes in the order that SourceName writes them.
+	prefixes := []string{
+		modifyPrefix,
+		linkPrefix,
+		createPrefix,
+		encryptedPrefix,
+		"perm_0640_",
+		privatePrefix,
+		emptyPrefix,
+		executablePrefix,
+		dotPrefix,
+	}
+	for i := 0; i < 1<<len(prefixes); i++ {
+		for _, suffix := range []string{"", TemplateSuffix} {
+			sourceName := ""
+			for j, prefix := range prefixes {
+				if i&(1<<j) != 0 {
+					sourceName += prefix
+				}
+			}
+			sourceName += "foo" + suffix
+			perm := i&(1<<4) != 0
+			private := i&(1<<5) != 0
+			executable := i&(1<<7) != 0
+			t.Run(sourceName, func(t *testing.T) {
+				err := checkCanonicalSourceName(sourceName, ParseFileAttributes(sourceName).SourceName())
+				if perm && (private || executable) {
+					assert.Error(t, err)
+				} else {
+					assert.NoError(t, err)
+				}
+			})
+		}
+	}
+
+	for _, sourceName := range []string{
+		"perm_644_foo",
+		"perm_0644_private_executable_foo",
+		"perm_0600_private_foo",
+		"perm_0755_executable_foo",
+	} {
+		t.Run(sourceName, func(t *testing.T) {
+			assert.Error(t, checkCanonicalSourceName(sourceName, ParseFileAttributes(sourceName).SourceName()))
+		})
+	}
+}
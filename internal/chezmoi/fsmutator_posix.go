@@ -4,6 +4,7 @@ package chezmoi
 
 import (
 	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"syscall"
@@ -16,35 +17,13 @@ import (
 func (m *FSMutator) WriteFile(name string, data []byte, perm os.FileMode, currData []byte) error {
 	// Special case: if writing to the real filesystem, use github.com/google/renameio
 	if m.FS == vfs.OSFS {
-		dir := filepath.Dir(name)
-		dev, ok := m.devCache[dir]
-		if !ok {
-			info, err := m.Stat(dir)
-			if err != nil {
-				return err
-			}
-			statT, ok := info.Sys().(*syscall.Stat_t)
-			if !ok {
-				return errors.New("os.FileInfo.Sys() cannot be converted to a *syscall.Stat_t")
-			}
-			dev = uint(statT.Dev)
-			m.devCache[dir] = dev
-		}
-		tempDir, ok := m.tempDirCache[dev]
-		if !ok {
-			tempDir = renameio.TempDir(dir)
-			m.tempDirCache[dev] = tempDir
-		}
-		t, err := renameio.TempFile(tempDir, name)
+		t, err := m.tempFile(name, perm)
 		if err != nil {
 			return err
 		}
 		defer func() {
 			_ = t.Cleanup()
 		}()
-		if err := t.Chmod(perm); err != nil {
-			return err
-		}
 		if _, err := t.Write(data); err != nil {
 			return err
 		}
@@ -52,3 +31,55 @@ func (m *FSMutator) WriteFile(name string, data []byte, perm os.FileMode, currDa
 	}
 	return m.FS.WriteFile(name, data, perm)
 }
+
+// WriteFileFrom implements Mutator.WriteFileFrom.
+func (m *FSMutator) WriteFileFrom(name string, r io.Reader, size int64, perm os.FileMode) error {
+	// Special case: if writing to the real filesystem, use github.com/google/renameio
+	if m.FS == vfs.OSFS {
+		t, err := m.tempFile(name, perm)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = t.Cleanup()
+		}()
+		if _, err := io.Copy(t, r); err != nil {
+			return err
+		}
+		return t.CloseAtomicallyReplace()
+	}
+	return writeFileFrom(m.FS, name, r, perm)
+}
+
+// tempFile returns a new temporary file with permissions perm that atomically
+// replaces name when it is closed.
+func (m *FSMutator) tempFile(name string, perm os.FileMode) (*renameio.PendingFile, error) {
+	dir := filepath.Dir(name)
+	dev, ok := m.devCache[dir]
+	if !ok {
+		info, err := m.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		statT, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil, errors.New("os.FileInfo.Sys() cannot be converted to a *syscall.Stat_t")
+		}
+		dev = uint(statT.Dev)
+		m.devCache[dir] = dev
+	}
+	tempDir, ok := m.tempDirCache[dev]
+	if !ok {
+		tempDir = renameio.TempDir(dir)
+		m.tempDirCache[dev] = tempDir
+	}
+	t, err := renameio.TempFile(tempDir, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Chmod(perm); err != nil {
+		_ = t.Cleanup()
+		return nil, err
+	}
+	return t, nil
+}
@@ -3,6 +3,7 @@
 package chezmoi
 
 import (
+	"io"
 	"os"
 )
 
@@ -10,3 +11,8 @@ import (
 func (m *FSMutator) WriteFile(name string, data []byte, perm os.FileMode, currData []byte) error {
 	return m.FS.WriteFile(name, data, perm)
 }
+
+// WriteFileFrom implements Mutator.WriteFileFrom.
+func (m *FSMutator) WriteFileFrom(name string, r io.Reader, size int64, perm os.FileMode) error {
+	return writeFileFrom(m.FS, name, r, perm)
+}
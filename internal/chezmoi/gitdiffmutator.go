@@ -1,6 +1,7 @@
 package chezmoi
 
 import (
+	"io"
 	"os"
 	"os/exec"
 	"strings"
@@ -36,7 +37,7 @@ func (m *GitDiffMutator) Chmod(name string, mode os.FileMode) error {
 		return err
 	}
 	// Assume that we're only changing permissions.
-	toFileMode, err := filemode.NewFromOSFileMode(info.Mode()&^os.ModePerm | mode)
+	toFileMode, err := filemode.NewFromOSFileMode(info.Mode()&^permMask | mode)
 	if err != nil {
 		return err
 	}
@@ -64,6 +65,12 @@ func (m *GitDiffMutator) IdempotentCmdOutput(cmd *exec.Cmd) ([]byte, error) {
 	return m.m.IdempotentCmdOutput(cmd)
 }
 
+// Lchown implements Mutator.Lchown. Git diffs cannot represent owners, so it
+// does nothing.
+func (m *GitDiffMutator) Lchown(name string, uid, gid int) error {
+	return nil
+}
+
 // Mkdir implements Mutator.Mkdir.
 func (m *GitDiffMutator) Mkdir(name string, perm os.FileMode) error {
 	toFileMode, err := filemode.NewFromOSFileMode(os.ModeDir | perm)
@@ -169,6 +176,37 @@ func (m *GitDiffMutator) WriteFile(filename string, data []byte, perm os.FileMod
 	})
 }
 
+// WriteFileFrom implements Mutator.WriteFileFrom. The file is always treated
+// as binary and the hash of its current contents is not computed.
+func (m *GitDiffMutator) WriteFileFrom(filename string, r io.Reader, size int64, perm os.FileMode) error {
+	fileMode, _, err := m.getFileMode(filename)
+	if err != nil {
+		return err
+	}
+	hasher := plumbing.NewHasher(plumbing.BlobObject, size)
+	if _, err := io.Copy(hasher, r); err != nil {
+		return err
+	}
+	path := m.trimPrefix(filename)
+	return m.unifiedEncoder.Encode(&gitDiffPatch{
+		filePatches: []diff.FilePatch{
+			&gitDiffFilePatch{
+				isBinary: true,
+				from: &gitDiffFile{
+					fileMode: fileMode,
+					path:     path,
+					hash:     plumbing.ZeroHash,
+				},
+				to: &gitDiffFile{
+					fileMode: fileMode,
+					path:     path,
+					hash:     hasher.Sum(),
+				},
+			},
+		},
+	})
+}
+
 // WriteSymlink implements Mutator.WriteSymlink.
 func (m *GitDiffMutator) WriteSymlink(oldname, newname string) error {
 	return m.unifiedEncoder.Encode(&gitDiffPatch{
@@ -14,16 +14,15 @@ type GPG struct {
 	Symmetric bool
 }
 
-// Decrypt decrypts ciphertext. filename is used as a hint for naming temporary
-// files.
-func (g *GPG) Decrypt(filename string, ciphertext []byte) ([]byte, error) {
+// Decrypt decrypts ciphertext.
+func (g *GPG) Decrypt(ciphertext []byte) ([]byte, error) {
 	tempDir, err := ioutil.TempDir("", "chezmoi-decrypt")
 	if err != nil {
 		return nil, err
 	}
 	defer os.RemoveAll(tempDir)
 
-	outputFilename := filepath.Join(tempDir, filepath.Base(filename))
+	outputFilename := filepath.Join(tempDir, "plaintext")
 	inputFilename := outputFilename + ".gpg"
 	if err := ioutil.WriteFile(inputFilename, ciphertext, 0o600); err != nil {
 		return nil, err
@@ -46,16 +45,15 @@ func (g *GPG) Decrypt(filename string, ciphertext []byte) ([]byte, error) {
 	return ioutil.ReadFile(outputFilename)
 }
 
-// Encrypt encrypts plaintext for ts's recipient. filename is used as a hint for
-// naming temporary files.
-func (g *GPG) Encrypt(filename string, plaintext []byte) ([]byte, error) {
+// Encrypt encrypts plaintext for g's recipient.
+func (g *GPG) Encrypt(plaintext []byte) ([]byte, error) {
 	tempDir, err := ioutil.TempDir("", "chezmoi-encrypt")
 	if err != nil {
 		return nil, err
 	}
 	defer os.RemoveAll(tempDir)
 
-	inputFilename := filepath.Join(tempDir, filepath.Base(filename))
+	inputFilename := filepath.Join(tempDir, "plaintext")
 	if err := ioutil.WriteFile(inputFilename, plaintext, 0o600); err != nil {
 		return nil, err
 	}
@@ -74,7 +72,7 @@ func (g *GPG) Encrypt(filename string, plaintext []byte) ([]byte, error) {
 		}
 		args = append(args, "--encrypt")
 	}
-	args = append(args, filename)
+	args = append(args, inputFilename)
 
 	//nolint:gosec
 	cmd := exec.Command(g.Command, args...)
@@ -0,0 +1,42 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package chezmoi
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+const (
+	immutableFlagName     = "uchg"
+	immutableClearCommand = "chflags nouchg"
+
+	// ufImmutable is UF_IMMUTABLE from sys/stat.h, shown as uchg by ls -lO.
+	ufImmutable = 0x2
+)
+
+// getImmutable returns whether name has the uchg flag set. It is a variable so
+// that tests can replace it.
+var getImmutable = func(name string) (bool, error) {
+	var stat unix.Stat_t
+	if err := unix.Lstat(name, &stat); err != nil {
+		return false, err
+	}
+	return stat.Flags&ufImmutable != 0, nil
+}
+
+// setImmutable sets or clears the uchg flag on name. It is a variable so that
+// tests can replace it.
+var setImmutable = func(name string, immutable bool) error {
+	var stat unix.Stat_t
+	if err := unix.Lstat(name, &stat); err != nil {
+		return err
+	}
+	flags := stat.Flags
+	if immutable {
+		flags |= ufImmutable
+	} else {
+		flags &^= ufImmutable
+	}
+	return unix.Chflags(name, int(flags))
+}
@@ -0,0 +1,69 @@
+package chezmoi
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	immutableFlagName     = "immutable"
+	immutableClearCommand = "chattr -i"
+
+	// fsImmutableFL is FS_IMMUTABLE_FL from linux/fs.h.
+	fsImmutableFL = 0x10
+
+	// fsIOCSetFlags is FS_IOC_SETFLAGS, which is missing from
+	// golang.org/x/sys/unix. It is _IOW('f', 2, long) where FS_IOC_GETFLAGS is
+	// _IOR('f', 1, long), so it is derived by swapping the read and write
+	// direction bits, which are the top two bits on all architectures.
+	fsIOCSetFlags = (unix.FS_IOC_GETFLAGS ^ 0xc0000000) + 1
+)
+
+// getImmutable returns whether name has the immutable flag set. It is a
+// variable so that tests can replace it.
+var getImmutable = func(name string) (bool, error) {
+	flags, err := getFSFlags(name)
+	if err != nil {
+		return false, err
+	}
+	return flags&fsImmutableFL != 0, nil
+}
+
+// setImmutable sets or clears the immutable flag on name. It is a variable so
+// that tests can replace it.
+var setImmutable = func(name string, immutable bool) error {
+	flags, err := getFSFlags(name)
+	if err != nil {
+		return err
+	}
+	if immutable {
+		flags |= fsImmutableFL
+	} else {
+		flags &^= fsImmutableFL
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return unix.IoctlSetPointerInt(int(f.Fd()), fsIOCSetFlags, flags)
+}
+
+// getFSFlags returns the inode flags of name, as shown by lsattr. Only regular
+// files and directories have flags, so symlinks are not followed.
+func getFSFlags(name string) (int, error) {
+	info, err := os.Lstat(name)
+	if err != nil {
+		return 0, err
+	}
+	if !info.Mode().IsRegular() && !info.IsDir() {
+		return 0, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return unix.IoctlGetInt(int(f.Fd()), unix.FS_IOC_GETFLAGS)
+}
@@ -0,0 +1,25 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package chezmoi
+
+import (
+	"errors"
+)
+
+const (
+	immutableFlagName     = "immutable"
+	immutableClearCommand = "attrib -r"
+)
+
+// getImmutable returns whether name has the immutable flag set. Immutable flags
+// are not supported on this platform, so it always returns false. It is a
+// variable so that tests can replace it.
+var getImmutable = func(name string) (bool, error) {
+	return false, nil
+}
+
+// setImmutable sets or clears the immutable flag on name. It is a variable so
+// that tests can replace it.
+var setImmutable = func(name string, immutable bool) error {
+	return errors.New("immutable flags not supported")
+}
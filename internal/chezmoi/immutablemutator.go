@@ -0,0 +1,138 @@
+package chezmoi
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	vfs "github.com/twpayne/go-vfs"
+)
+
+// An ImmutableError is returned when a target cannot be modified because its
+// immutable flag is set.
+type ImmutableError struct {
+	Path string
+}
+
+func (e *ImmutableError) Error() string {
+	return fmt.Sprintf("%s: %s flag set, clear it with %s %s or set apply.clearImmutable", e.Path, immutableFlagName, immutableClearCommand, MaybeShellQuote(e.Path))
+}
+
+// An ImmutableMutator wraps a Mutator and detects targets with the immutable
+// flag set, for example with chattr +i on Linux or chflags uchg on macOS. If
+// clearImmutable is set then the flag is cleared before the target is modified
+// and restored afterwards, otherwise an *ImmutableError is returned.
+type ImmutableMutator struct {
+	m              Mutator
+	fs             vfs.FS
+	clearImmutable bool
+}
+
+// NewImmutableMutator returns a new ImmutableMutator that wraps m. Paths are
+// translated to real paths with fs.
+func NewImmutableMutator(m Mutator, fs vfs.FS, clearImmutable bool) *ImmutableMutator {
+	return &ImmutableMutator{
+		m:              m,
+		fs:             fs,
+		clearImmutable: clearImmutable,
+	}
+}
+
+// Chmod implements Mutator.Chmod.
+func (m *ImmutableMutator) Chmod(name string, mode os.FileMode) error {
+	return m.modify(name, true, func() error {
+		return m.m.Chmod(name, mode)
+	})
+}
+
+// IdempotentCmdOutput implements Mutator.IdempotentCmdOutput.
+func (m *ImmutableMutator) IdempotentCmdOutput(cmd *exec.Cmd) ([]byte, error) {
+	return m.m.IdempotentCmdOutput(cmd)
+}
+
+// Lchown implements Mutator.Lchown.
+func (m *ImmutableMutator) Lchown(name string, uid, gid int) error {
+	return m.modify(name, true, func() error {
+		return m.m.Lchown(name, uid, gid)
+	})
+}
+
+// Mkdir implements Mutator.Mkdir.
+func (m *ImmutableMutator) Mkdir(name string, perm os.FileMode) error {
+	return m.m.Mkdir(name, perm)
+}
+
+// RemoveAll implements Mutator.RemoveAll.
+func (m *ImmutableMutator) RemoveAll(name string) error {
+	return m.modify(name, false, func() error {
+		return m.m.RemoveAll(name)
+	})
+}
+
+// Rename implements Mutator.Rename.
+func (m *ImmutableMutator) Rename(oldpath, newpath string) error {
+	return m.modify(newpath, true, func() error {
+		return m.m.Rename(oldpath, newpath)
+	})
+}
+
+// RunCmd implements Mutator.RunCmd.
+func (m *ImmutableMutator) RunCmd(cmd *exec.Cmd) error {
+	return m.m.RunCmd(cmd)
+}
+
+// Stat implements Mutator.Stat.
+func (m *ImmutableMutator) Stat(name string) (os.FileInfo, error) {
+	return m.m.Stat(name)
+}
+
+// WriteFile implements Mutator.WriteFile.
+func (m *ImmutableMutator) WriteFile(name string, data []byte, perm os.FileMode, currData []byte) error {
+	return m.modify(name, true, func() error {
+		return m.m.WriteFile(name, data, perm, currData)
+	})
+}
+
+// WriteFileFrom implements Mutator.WriteFileFrom.
+func (m *ImmutableMutator) WriteFileFrom(name string, r io.Reader, size int64, perm os.FileMode) error {
+	return m.modify(name, true, func() error {
+		return m.m.WriteFileFrom(name, r, size, perm)
+	})
+}
+
+// WriteSymlink implements Mutator.WriteSymlink.
+func (m *ImmutableMutator) WriteSymlink(oldname, newname string) error {
+	return m.modify(newname, false, func() error {
+		return m.m.WriteSymlink(oldname, newname)
+	})
+}
+
+// modify calls f, which modifies name. If name has the immutable flag set then
+// the flag is cleared first and, if restore is set, restored afterwards.
+func (m *ImmutableMutator) modify(name string, restore bool, f func() error) error {
+	rawName, err := m.fs.RawPath(name)
+	if err != nil {
+		return err
+	}
+	// Errors are ignored as they also occur when name does not exist or its
+	// filesystem does not support flags, and f will report any real problem.
+	if immutable, err := getImmutable(rawName); err != nil || !immutable {
+		return f()
+	}
+	if !m.clearImmutable {
+		return &ImmutableError{
+			Path: name,
+		}
+	}
+	if err := setImmutable(rawName, false); err != nil {
+		return fmt.Errorf("%s: clear %s flag: %w", name, immutableFlagName, err)
+	}
+	err = f()
+	if restore {
+		if setErr := setImmutable(rawName, true); setErr != nil && err == nil {
+			err = fmt.Errorf("%s: restore %s flag: %w", name, immutableFlagName, setErr)
+		}
+	}
+	return err
+}
@@ -0,0 +1,112 @@
+package chezmoi
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+var _ Mutator = &ImmutableMutator{}
+
+func TestImmutableMutator(t *testing.T) {
+	for _, tc := range []struct {
+		name              string
+		clearImmutable    bool
+		expectedErr       bool
+		expectedContents  string
+		expectedImmutable bool
+	}{
+		{
+			name:              "error",
+			expectedErr:       true,
+			expectedContents:  "# old\n",
+			expectedImmutable: true,
+		},
+		{
+			name:              "clear_immutable",
+			clearImmutable:    true,
+			expectedContents:  "# new\n",
+			expectedImmutable: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+				"/home/user/.bashrc": "# old\n",
+				"/home/user/.zshrc":  "# old\n",
+			})
+			require.NoError(t, err)
+			defer cleanup()
+			rawBashrc, err := fs.RawPath("/home/user/.bashrc")
+			require.NoError(t, err)
+
+			// Simulate the immutable flag, which requires privileges and
+			// filesystem support to set for real.
+			immutable := map[string]bool{
+				rawBashrc: true,
+			}
+			oldGetImmutable, oldSetImmutable := getImmutable, setImmutable
+			defer func() {
+				getImmutable, setImmutable = oldGetImmutable, oldSetImmutable
+			}()
+			getImmutable = func(name string) (bool, error) {
+				return immutable[name], nil
+			}
+			setImmutable = func(name string, value bool) error {
+				immutable[name] = value
+				return nil
+			}
+			m := NewImmutableMutator(&failImmutableMutator{
+				Mutator:   NewFSMutator(fs),
+				immutable: immutable,
+				fs:        fs,
+			}, fs, tc.clearImmutable)
+
+			err = m.WriteFile("/home/user/.bashrc", []byte("# new\n"), 0o644, []byte("# old\n"))
+			if tc.expectedErr {
+				var immutableErr *ImmutableError
+				require.True(t, errors.As(err, &immutableErr))
+				assert.Equal(t, "/home/user/.bashrc", immutableErr.Path)
+				assert.Contains(t, err.Error(), immutableClearCommand)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedImmutable, immutable[rawBashrc])
+			vfst.RunTests(t, fs, "",
+				vfst.TestPath("/home/user/.bashrc",
+					vfst.TestContentsString(tc.expectedContents),
+				),
+			)
+
+			// Targets without the flag are unaffected.
+			require.NoError(t, m.WriteFile("/home/user/.zshrc", []byte("# new\n"), 0o644, []byte("# old\n")))
+			vfst.RunTests(t, fs, "",
+				vfst.TestPath("/home/user/.zshrc",
+					vfst.TestContentsString("# new\n"),
+				),
+			)
+		})
+	}
+}
+
+// A failImmutableMutator is a Mutator that fails to write files that have the
+// simulated immutable flag set, as a real filesystem would.
+type failImmutableMutator struct {
+	Mutator
+	immutable map[string]bool
+	fs        *vfst.TestFS
+}
+
+func (m *failImmutableMutator) WriteFile(name string, data []byte, perm os.FileMode, currData []byte) error {
+	rawName, err := m.fs.RawPath(name)
+	if err != nil {
+		return err
+	}
+	if m.immutable[rawName] {
+		return &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+	}
+	return m.Mutator.WriteFile(name, data, perm, currData)
+}
@@ -0,0 +1,67 @@
+package chezmoi
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+
+	vfs "github.com/twpayne/go-vfs"
+)
+
+// DefaultLargeFileSize is the default size above which plain files are
+// streamed instead of being read into memory.
+const DefaultLargeFileSize = 16 << 20
+
+// copyFile copies the contents of src to the new file dst with permissions
+// perm, without reading all of src into memory.
+func copyFile(fs vfs.FS, src, dst string, perm os.FileMode) error {
+	srcFile, err := fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	dstFile, err := fs.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dstFile, srcFile)
+	if closeErr := dstFile.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// HashFile returns the SHA256 hash of the contents of name in fs, reading it in
+// chunks.
+func HashFile(fs vfs.FS, name string) ([]byte, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return hashReader(f)
+}
+
+// hashReader returns the SHA256 hash of the contents of r, reading it in
+// chunks.
+func hashReader(r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// writeFileFrom writes the contents of r to name in fs, creating it with
+// permissions perm if it does not exist, as vfs.FS.WriteFile does.
+func writeFileFrom(fs vfs.FS, name string, r io.Reader, perm os.FileMode) error {
+	f, err := fs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,166 @@
+package chezmoi
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	vfs "github.com/twpayne/go-vfs"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+// largeFileTestSize is the size of the sparse files used to test streaming.
+const largeFileTestSize = 300 << 20
+
+// writeSparseFile creates a sparse file of size bytes at name in fs that ends
+// with suffix.
+func writeSparseFile(t *testing.T, fs *vfst.TestFS, name string, size int64, suffix string) {
+	t.Helper()
+	rawName, err := fs.RawPath(name)
+	require.NoError(t, err)
+	f, err := os.OpenFile(rawName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte(suffix), size-int64(len(suffix)))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func newLargeFileTestTargetState(t *testing.T, fs vfs.FS) *TargetState {
+	t.Helper()
+	ts := NewTargetState(
+		WithDestDir("/home/user"),
+		WithLargeFileSize(1<<20),
+		WithSourceDir("/home/user/.local/share/chezmoi"),
+		WithUmask(0o22),
+	)
+	require.NoError(t, ts.Populate(fs, nil))
+	return ts
+}
+
+func newLargeFileTestApplyOptions(ts *TargetState) *ApplyOptions {
+	return &ApplyOptions{
+		DestDir:           ts.DestDir,
+		Ignore:            ts.TargetIgnore.Match,
+		ScriptStateBucket: []byte("script"),
+		Stdout:            ioutil.Discard,
+		Umask:             0o22,
+	}
+}
+
+func TestLargeFileApply(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping large file test in short mode")
+	}
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_small": "small",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	writeSparseFile(t, fs, "/home/user/.local/share/chezmoi/large", largeFileTestSize, "end\n")
+
+	ts := newLargeFileTestTargetState(t, fs)
+	large, ok := ts.Entries["large"].(*File)
+	require.True(t, ok)
+	assert.NotNil(t, large.openContents)
+	assert.Equal(t, int64(largeFileTestSize), large.size)
+	small, ok := ts.Entries[".small"].(*File)
+	require.True(t, ok)
+	assert.Nil(t, small.openContents)
+	require.NoError(t, ts.Evaluate())
+
+	applyOptions := newLargeFileTestApplyOptions(ts)
+	sb := &strings.Builder{}
+	require.NoError(t, ts.Apply(fs, NewSummaryMutator(sb, NewFSMutator(fs), fs, false, "/home/user", false), false, applyOptions))
+	assert.Contains(t, sb.String(), "created large\n")
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/large",
+			vfst.TestModeIsRegular,
+			vfst.TestModePerm(0o644),
+			vfst.TestSize(largeFileTestSize),
+		),
+	)
+	sourceHash, err := HashFile(fs, "/home/user/.local/share/chezmoi/large")
+	require.NoError(t, err)
+	targetHash, err := HashFile(fs, "/home/user/large")
+	require.NoError(t, err)
+	assert.Equal(t, sourceHash, targetHash)
+
+	// Applying again should not change anything.
+	sb.Reset()
+	require.NoError(t, ts.Apply(fs, NewSummaryMutator(sb, NewFSMutator(fs), fs, false, "/home/user", false), false, applyOptions))
+	assert.Equal(t, "", sb.String())
+
+	// A file of the same size with different contents should be replaced.
+	writeSparseFile(t, fs, "/home/user/large", largeFileTestSize, "END\n")
+	logSB := &strings.Builder{}
+	require.NoError(t, ts.Apply(fs, NewLogMutator(logSB, NewFSMutator(fs), fs, false), false, applyOptions))
+	var entries []LogEntry
+	s := bufio.NewScanner(strings.NewReader(logSB.String()))
+	for s.Scan() {
+		var entry LogEntry
+		require.NoError(t, json.Unmarshal(s.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, s.Err())
+	require.Len(t, entries, 1)
+	assert.Equal(t, "write", entries[0].Action)
+	assert.Equal(t, "/home/user/large", entries[0].Path)
+	require.NotNil(t, entries[0].Size)
+	assert.Equal(t, largeFileTestSize, *entries[0].Size)
+	assert.Equal(t, hex.EncodeToString(sourceHash), entries[0].SHA256)
+	targetHash, err = HashFile(fs, "/home/user/large")
+	require.NoError(t, err)
+	assert.Equal(t, sourceHash, targetHash)
+}
+
+func TestLargeFileArchiveTAR(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping large file test in short mode")
+	}
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	writeSparseFile(t, fs, "/home/user/.local/share/chezmoi/large", largeFileTestSize, "end\n")
+
+	ts := newLargeFileTestTargetState(t, fs)
+	r, w := io.Pipe()
+	errCh := make(chan error, 1)
+	go func() {
+		tw := tar.NewWriter(w)
+		err := ts.ArchiveTAR(tw, 0o22, EncryptedModeDecrypt)
+		if err == nil {
+			err = tw.Close()
+		}
+		w.CloseWithError(err)
+		errCh <- err
+	}()
+
+	tr := tar.NewReader(r)
+	header, err := tr.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "large", header.Name)
+	assert.Equal(t, int64(largeFileTestSize), header.Size)
+	tail := &bytes.Buffer{}
+	n, err := io.Copy(ioutil.Discard, io.LimitReader(tr, largeFileTestSize-4))
+	require.NoError(t, err)
+	assert.Equal(t, int64(largeFileTestSize-4), n)
+	_, err = io.Copy(tail, tr)
+	require.NoError(t, err)
+	assert.Equal(t, "end\n", tail.String())
+	_, err = tr.Next()
+	assert.Equal(t, io.EOF, err)
+	assert.NoError(t, <-errCh)
+}
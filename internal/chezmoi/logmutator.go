@@ -0,0 +1,235 @@
+package chezmoi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"time"
+
+	vfs "github.com/twpayne/go-vfs"
+)
+
+// A LogEntry is a single entry in the log written by a LogMutator. Contents
+// are never logged, only their size and SHA256 hash, so that logs do not leak
+// secrets.
+type LogEntry struct {
+	Time       time.Time `json:"time"`
+	Action     string    `json:"action"`
+	Path       string    `json:"path,omitempty"`
+	NewPath    string    `json:"newPath,omitempty"`
+	OldMode    string    `json:"oldMode,omitempty"`
+	NewMode    string    `json:"newMode,omitempty"`
+	Owner      string    `json:"owner,omitempty"`
+	Size       *int      `json:"size,omitempty"`
+	SHA256     string    `json:"sha256,omitempty"`
+	Script     string    `json:"script,omitempty"`
+	ExitStatus *int      `json:"exitStatus,omitempty"`
+	DryRun     bool      `json:"dryRun"`
+}
+
+// A LogMutator wraps a Mutator and writes a JSON object describing each action
+// that it executes to a log, one per line.
+type LogMutator struct {
+	m      Mutator
+	w      io.Writer
+	fs     vfs.FS
+	dryRun bool
+	now    func() time.Time
+}
+
+// NewLogMutator returns a new LogMutator that writes log entries to w. The
+// previous state of each target is read from fs. Each entry is written with a
+// single call to w.Write, so if w is unbuffered then each entry is flushed
+// immediately.
+func NewLogMutator(w io.Writer, m Mutator, fs vfs.FS, dryRun bool) *LogMutator {
+	return &LogMutator{
+		m:      m,
+		w:      w,
+		fs:     fs,
+		dryRun: dryRun,
+		now:    time.Now,
+	}
+}
+
+// Chmod implements Mutator.Chmod.
+func (m *LogMutator) Chmod(name string, mode os.FileMode) error {
+	oldMode := m.oldMode(name)
+	if err := m.m.Chmod(name, mode); err != nil {
+		return err
+	}
+	return m.log(&LogEntry{
+		Action:  "chmod",
+		Path:    name,
+		OldMode: oldMode,
+		NewMode: formatMode(mode),
+	})
+}
+
+// IdempotentCmdOutput implements Mutator.IdempotentCmdOutput.
+func (m *LogMutator) IdempotentCmdOutput(cmd *exec.Cmd) ([]byte, error) {
+	return m.m.IdempotentCmdOutput(cmd)
+}
+
+// Lchown implements Mutator.Lchown.
+func (m *LogMutator) Lchown(name string, uid, gid int) error {
+	if err := m.m.Lchown(name, uid, gid); err != nil {
+		return err
+	}
+	return m.log(&LogEntry{
+		Action: "chown",
+		Path:   name,
+		Owner:  fmt.Sprintf("%d:%d", uid, gid),
+	})
+}
+
+// LogScript logs that the script name was run and exited with exitStatus, or
+// would have been run in dry run mode.
+func (m *LogMutator) LogScript(name string, exitStatus int) error {
+	entry := &LogEntry{
+		Action: "script",
+		Script: name,
+	}
+	if !m.dryRun {
+		entry.ExitStatus = &exitStatus
+	}
+	return m.log(entry)
+}
+
+// Mkdir implements Mutator.Mkdir.
+func (m *LogMutator) Mkdir(name string, perm os.FileMode) error {
+	if err := m.m.Mkdir(name, perm); err != nil {
+		return err
+	}
+	return m.log(&LogEntry{
+		Action:  "mkdir",
+		Path:    name,
+		NewMode: formatMode(perm),
+	})
+}
+
+// RemoveAll implements Mutator.RemoveAll.
+func (m *LogMutator) RemoveAll(name string) error {
+	oldMode := m.oldMode(name)
+	if err := m.m.RemoveAll(name); err != nil {
+		return err
+	}
+	return m.log(&LogEntry{
+		Action:  "remove",
+		Path:    name,
+		OldMode: oldMode,
+	})
+}
+
+// Rename implements Mutator.Rename.
+func (m *LogMutator) Rename(oldpath, newpath string) error {
+	if err := m.m.Rename(oldpath, newpath); err != nil {
+		return err
+	}
+	return m.log(&LogEntry{
+		Action:  "rename",
+		Path:    oldpath,
+		NewPath: newpath,
+	})
+}
+
+// RunCmd implements Mutator.RunCmd.
+func (m *LogMutator) RunCmd(cmd *exec.Cmd) error {
+	return m.m.RunCmd(cmd)
+}
+
+// Stat implements Mutator.Stat.
+func (m *LogMutator) Stat(name string) (os.FileInfo, error) {
+	return m.m.Stat(name)
+}
+
+// WriteFile implements Mutator.WriteFile.
+func (m *LogMutator) WriteFile(name string, data []byte, perm os.FileMode, currData []byte) error {
+	oldMode := m.oldMode(name)
+	if err := m.m.WriteFile(name, data, perm, currData); err != nil {
+		return err
+	}
+	size := len(data)
+	contentsSHA256 := sha256.Sum256(data)
+	return m.log(&LogEntry{
+		Action:  "write",
+		Path:    name,
+		OldMode: oldMode,
+		NewMode: formatMode(perm),
+		Size:    &size,
+		SHA256:  hex.EncodeToString(contentsSHA256[:]),
+	})
+}
+
+// WriteFileFrom implements Mutator.WriteFileFrom.
+func (m *LogMutator) WriteFileFrom(name string, r io.Reader, size int64, perm os.FileMode) error {
+	oldMode := m.oldMode(name)
+	h := sha256.New()
+	tr := io.TeeReader(r, h)
+	if err := m.m.WriteFileFrom(name, tr, size, perm); err != nil {
+		return err
+	}
+	// The wrapped Mutator might not read all of r, for example in dry run
+	// mode, so hash the rest.
+	if _, err := io.Copy(ioutil.Discard, tr); err != nil {
+		return err
+	}
+	intSize := int(size)
+	return m.log(&LogEntry{
+		Action:  "write",
+		Path:    name,
+		OldMode: oldMode,
+		NewMode: formatMode(perm),
+		Size:    &intSize,
+		SHA256:  hex.EncodeToString(h.Sum(nil)),
+	})
+}
+
+// WriteSymlink implements Mutator.WriteSymlink.
+func (m *LogMutator) WriteSymlink(oldname, newname string) error {
+	oldMode := m.oldMode(newname)
+	if err := m.m.WriteSymlink(oldname, newname); err != nil {
+		return err
+	}
+	size := len(oldname)
+	linknameSHA256 := sha256.Sum256([]byte(oldname))
+	return m.log(&LogEntry{
+		Action:  "symlink",
+		Path:    newname,
+		OldMode: oldMode,
+		Size:    &size,
+		SHA256:  hex.EncodeToString(linknameSHA256[:]),
+	})
+}
+
+// log writes entry to m.w as a single line.
+func (m *LogMutator) log(entry *LogEntry) error {
+	entry.Time = m.now()
+	entry.DryRun = m.dryRun
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = m.w.Write(append(data, '\n'))
+	return err
+}
+
+// oldMode returns the formatted mode of name before it is modified, or the
+// empty string if name does not exist.
+func (m *LogMutator) oldMode(name string) string {
+	info, err := m.fs.Lstat(name)
+	if err != nil {
+		return ""
+	}
+	return formatMode(info.Mode())
+}
+
+// formatMode returns mode's type and permissions as a string, for example
+// "-rw-r--r--".
+func formatMode(mode os.FileMode) string {
+	return fmt.Sprint(mode)
+}
@@ -0,0 +1,70 @@
+package chezmoi
+
+import (
+	"bufio"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+var _ Mutator = &LogMutator{}
+
+func TestLogMutator(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.bashrc": &vfst.File{
+			Perm:     0o644,
+			Contents: []byte("# old\n"),
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	sb := &strings.Builder{}
+	m := NewLogMutator(sb, NewFSMutator(fs), fs, false)
+	require.NoError(t, m.WriteFile("/home/user/.bashrc", []byte("secret\n"), 0o600, []byte("# old\n")))
+	require.NoError(t, m.Mkdir("/home/user/.ssh", 0o700))
+	require.NoError(t, m.LogScript("run_install.sh", 1))
+
+	var entries []LogEntry
+	s := bufio.NewScanner(strings.NewReader(sb.String()))
+	for s.Scan() {
+		var entry LogEntry
+		require.NoError(t, json.Unmarshal(s.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, s.Err())
+	require.Len(t, entries, 3)
+	assert.NotContains(t, sb.String(), "secret")
+
+	assert.Equal(t, "write", entries[0].Action)
+	assert.Equal(t, "/home/user/.bashrc", entries[0].Path)
+	assert.Equal(t, "-rw-r--r--", entries[0].OldMode)
+	assert.Equal(t, "-rw-------", entries[0].NewMode)
+	require.NotNil(t, entries[0].Size)
+	assert.Equal(t, 7, *entries[0].Size)
+	assert.Equal(t, "b37e50cedcd3e3f1ff64f4afc0422084ae694253cf399326868e07a35f4a45fb", entries[0].SHA256)
+	assert.False(t, entries[0].DryRun)
+	assert.False(t, entries[0].Time.IsZero())
+
+	assert.Equal(t, "mkdir", entries[1].Action)
+	assert.Equal(t, "", entries[1].OldMode)
+
+	assert.Equal(t, "script", entries[2].Action)
+	assert.Equal(t, "run_install.sh", entries[2].Script)
+	require.NotNil(t, entries[2].ExitStatus)
+	assert.Equal(t, 1, *entries[2].ExitStatus)
+}
+
+func TestLogMutatorDryRun(t *testing.T) {
+	sb := &strings.Builder{}
+	m := NewLogMutator(sb, NullMutator{}, nil, true)
+	require.NoError(t, m.LogScript("run_install.sh", 0))
+	var entry LogEntry
+	require.NoError(t, json.Unmarshal([]byte(sb.String()), &entry))
+	assert.True(t, entry.DryRun)
+	assert.Nil(t, entry.ExitStatus)
+}
@@ -0,0 +1,87 @@
+package chezmoi
+
+// A MemoryPersistentState is a state that is only persisted in memory, and is
+// discarded when it is no longer referenced.
+type MemoryPersistentState struct {
+	buckets map[string]map[string][]byte
+}
+
+// NewMemoryPersistentState returns a new, empty MemoryPersistentState.
+func NewMemoryPersistentState() *MemoryPersistentState {
+	return &MemoryPersistentState{
+		buckets: make(map[string]map[string][]byte),
+	}
+}
+
+// Close closes m.
+func (m *MemoryPersistentState) Close() error {
+	return nil
+}
+
+// Delete deletes the value associate with key in bucket. If bucket or key does
+// not exist then Delete does nothing.
+func (m *MemoryPersistentState) Delete(bucket, key []byte) error {
+	delete(m.buckets[string(bucket)], string(key))
+	return nil
+}
+
+// DeleteBucket deletes bucket and all the keys and values in it. If bucket does
+// not exist then DeleteBucket does nothing.
+func (m *MemoryPersistentState) DeleteBucket(bucket []byte) error {
+	delete(m.buckets, string(bucket))
+	return nil
+}
+
+// ForEach calls fn for each key and value in bucket. If bucket does not exist
+// then ForEach does nothing.
+func (m *MemoryPersistentState) ForEach(bucket []byte, fn func(k, v []byte) error) error {
+	for key, value := range m.buckets[string(bucket)] {
+		if err := fn([]byte(key), copyBytes(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the value associated with key in bucket.
+func (m *MemoryPersistentState) Get(bucket, key []byte) ([]byte, error) {
+	value, ok := m.buckets[string(bucket)][string(key)]
+	if !ok {
+		return nil, nil
+	}
+	return copyBytes(value), nil
+}
+
+// Set sets the value associated with key in bucket. bucket will be created if
+// it does not already exist.
+func (m *MemoryPersistentState) Set(bucket, key, value []byte) error {
+	b, ok := m.buckets[string(bucket)]
+	if !ok {
+		b = make(map[string][]byte)
+		m.buckets[string(bucket)] = b
+	}
+	b[string(key)] = copyBytes(value)
+	return nil
+}
+
+// Update sets the values associated with the keys of values in bucket. Keys
+// whose values are nil are deleted. bucket will be created if it does not
+// already exist.
+func (m *MemoryPersistentState) Update(bucket []byte, values map[string][]byte) error {
+	for key, value := range values {
+		if value == nil {
+			if err := m.Delete(bucket, []byte(key)); err != nil {
+				return err
+			}
+		} else if err := m.Set(bucket, []byte(key), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyBytes(b []byte) []byte {
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
@@ -0,0 +1,73 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ PersistentState = &MemoryPersistentState{}
+
+func TestMemoryPersistentState(t *testing.T) {
+	m := NewMemoryPersistentState()
+
+	var (
+		bucket = []byte("bucket")
+		key    = []byte("key")
+		value  = []byte("value")
+	)
+
+	require.NoError(t, m.Delete(bucket, key))
+
+	actualValue, err := m.Get(bucket, key)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(nil), actualValue)
+
+	require.NoError(t, m.Set(bucket, key, value))
+	actualValue, err = m.Get(bucket, key)
+	require.NoError(t, err)
+	assert.Equal(t, value, actualValue)
+
+	actualValue[0] = 'V'
+	actualValue, err = m.Get(bucket, key)
+	require.NoError(t, err)
+	assert.Equal(t, value, actualValue)
+
+	visited := false
+	require.NoError(t, m.ForEach(bucket, func(k, v []byte) error {
+		visited = true
+		assert.Equal(t, key, k)
+		assert.Equal(t, value, v)
+		return nil
+	}))
+	assert.True(t, visited)
+
+	require.NoError(t, m.Delete(bucket, key))
+	actualValue, err = m.Get(bucket, key)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(nil), actualValue)
+
+	require.NoError(t, m.Update(bucket, map[string][]byte{
+		"key":  value,
+		"key2": nil,
+	}))
+	actualValue, err = m.Get(bucket, key)
+	require.NoError(t, err)
+	assert.Equal(t, value, actualValue)
+	require.NoError(t, m.Update(bucket, map[string][]byte{
+		"key": nil,
+	}))
+	actualValue, err = m.Get(bucket, key)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(nil), actualValue)
+
+	require.NoError(t, m.Set(bucket, key, value))
+	require.NoError(t, m.DeleteBucket(bucket))
+	actualValue, err = m.Get(bucket, key)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(nil), actualValue)
+	require.NoError(t, m.DeleteBucket(bucket))
+
+	require.NoError(t, m.Close())
+}
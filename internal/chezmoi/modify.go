@@ -0,0 +1,67 @@
+package chezmoi
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	vfs "github.com/twpayne/go-vfs"
+)
+
+// newEvaluateModifiedContents returns a function that returns the contents of
+// f's target in fs after they are modified by f's modify_ script, whose
+// contents are returned by evaluateScript. The script is run every time, even
+// in dry run mode, so it must only write the modified contents to its standard
+// output. Missing targets and targets that are not regular files are modified
+// as if they were empty.
+func (ts *TargetState) newEvaluateModifiedContents(fs vfs.FS, f *File, evaluateScript func() ([]byte, error)) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		script, err := evaluateScript()
+		if err != nil {
+			return nil, err
+		}
+		targetPath := filepath.Join(ts.DestDir, f.targetName)
+		var currContents []byte
+		info, err := fs.Stat(targetPath)
+		switch {
+		case err == nil && info.Mode().IsRegular():
+			currContents, err = fs.ReadFile(targetPath)
+			if err != nil {
+				return nil, err
+			}
+		case err == nil:
+		case os.IsNotExist(err):
+		default:
+			return nil, err
+		}
+		if len(bytes.TrimSpace(script)) == 0 {
+			return currContents, nil
+		}
+		return ts.runModifyScript(f, script, currContents)
+	}
+}
+
+// runModifyScript runs script, f's modify_ script, with currContents on its
+// standard input and returns its standard output. If the temporary directory is
+// on a filesystem mounted noexec then the next one is tried, as for run_
+// scripts.
+func (ts *TargetState) runModifyScript(f *File, script, currContents []byte) ([]byte, error) {
+	tempDirs := ts.ScriptTempDirs
+	if len(tempDirs) == 0 {
+		tempDirs = []string{os.TempDir()}
+	}
+	var stdout bytes.Buffer
+	var err error
+	for i, tempDir := range tempDirs {
+		stdout.Reset()
+		_, err = runInTempDir(tempDir, f.sourceName, f.targetName, script, ts.DestDir, ts.ScriptEnv, bytes.NewReader(currContents), &stdout)
+		if i == len(tempDirs)-1 || !isNoExecError(err) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: modify script: %w", sourcePath(f, ts.SourceDir), err)
+	}
+	return stdout.Bytes(), nil
+}
@@ -1,6 +1,7 @@
 package chezmoi
 
 import (
+	"io"
 	"os"
 	"os/exec"
 )
@@ -9,11 +10,13 @@ import (
 type Mutator interface {
 	Chmod(name string, mode os.FileMode) error
 	IdempotentCmdOutput(cmd *exec.Cmd) ([]byte, error)
+	Lchown(name string, uid, gid int) error
 	Mkdir(name string, perm os.FileMode) error
 	RemoveAll(name string) error
 	Rename(oldpath, newpath string) error
 	RunCmd(cmd *exec.Cmd) error
 	Stat(name string) (os.FileInfo, error)
 	WriteFile(filename string, data []byte, perm os.FileMode, currData []byte) error
+	WriteFileFrom(filename string, r io.Reader, size int64, perm os.FileMode) error
 	WriteSymlink(oldname, newname string) error
 }
@@ -1,6 +1,7 @@
 package chezmoi
 
 import (
+	"io"
 	"os"
 	"os/exec"
 )
@@ -18,6 +19,11 @@ func (NullMutator) IdempotentCmdOutput(cmd *exec.Cmd) ([]byte, error) {
 	return cmd.Output()
 }
 
+// Lchown implements Mutator.Lchown.
+func (NullMutator) Lchown(string, int, int) error {
+	return nil
+}
+
 // Mkdir implements Mutator.Mkdir.
 func (NullMutator) Mkdir(string, os.FileMode) error {
 	return nil
@@ -52,6 +58,11 @@ func (NullMutator) WriteFile(string, []byte, os.FileMode, []byte) error {
 	return nil
 }
 
+// WriteFileFrom implements Mutator.WriteFileFrom.
+func (NullMutator) WriteFileFrom(string, io.Reader, int64, os.FileMode) error {
+	return nil
+}
+
 // WriteSymlink implements Mutator.WriteSymlink.
 func (NullMutator) WriteSymlink(string, string) error {
 	return nil
@@ -0,0 +1,52 @@
+package chezmoi
+
+import (
+	"os"
+	"path/filepath"
+
+	vfs "github.com/twpayne/go-vfs"
+)
+
+// An Owner is the user and group that own a target.
+type Owner struct {
+	UID       int
+	GID       int
+	Username  string
+	Groupname string
+}
+
+// applyOwner gives the target of entry to its owner, if it has one and it is
+// not already owned by it. Scripts have no targets and ignored targets are not
+// changed, so neither are given away.
+func applyOwner(entry Entry, fs vfs.FS, mutator Mutator, applyOptions *ApplyOptions) error {
+	if applyOptions.Owner == nil || applyOptions.Ignore(entry.TargetName()) {
+		return nil
+	}
+	if _, ok := entry.(*Script); ok {
+		return nil
+	}
+	owner := applyOptions.Owner(entry.TargetName())
+	if owner == nil {
+		return nil
+	}
+	targetPath := filepath.Join(applyOptions.DestDir, entry.TargetName())
+	info, err := fs.Lstat(targetPath)
+	switch {
+	case err == nil:
+		uid, gid, ok := FileOwner(info)
+		if !ok || uid == owner.UID && gid == owner.GID {
+			return nil
+		}
+	case os.IsNotExist(err) && applyOptions.DryRun:
+		// In dry run mode, the target would have been created.
+	case os.IsNotExist(err):
+		// The target was removed.
+		return nil
+	default:
+		return err
+	}
+	if applyOptions.CanChangeOwner != nil && !applyOptions.CanChangeOwner(entry.TargetName(), owner) {
+		return nil
+	}
+	return mutator.Lchown(targetPath, owner.UID, owner.GID)
+}
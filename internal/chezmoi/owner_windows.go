@@ -0,0 +1,13 @@
+// +build windows
+
+package chezmoi
+
+import (
+	"os"
+)
+
+// FileOwner always returns false on Windows, as files do not have numeric
+// owners.
+func FileOwner(info os.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
@@ -8,6 +8,7 @@ import (
 type PatternSet struct {
 	includes map[string]struct{}
 	excludes map[string]struct{}
+	unmap    func(string) string
 }
 
 // NewPatternSet returns a new PatternSet.
@@ -31,8 +32,12 @@ func (ps *PatternSet) Add(pattern string, include bool) error {
 	return nil
 }
 
-// Match returns if name matches any pattern in ps.
+// Match returns if name matches any pattern in ps. If ps has an unmap
+// function, name is unmapped before being matched.
 func (ps *PatternSet) Match(name string) bool {
+	if ps.unmap != nil {
+		name = ps.unmap(name)
+	}
 	for pattern := range ps.excludes {
 		if ok, _ := doublestar.PathMatch(pattern, name); ok {
 			return false
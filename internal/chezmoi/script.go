@@ -1,42 +1,65 @@
 package chezmoi
 
 import (
-	"archive/tar"
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	vfs "github.com/twpayne/go-vfs"
 )
 
 // FIXME allow encrypted scripts
-// FIXME add pre- and post- attributes
 
 // A ScriptAttributes holds attributes parsed from a source script name.
 type ScriptAttributes struct {
 	Name     string
 	Once     bool
+	Before   bool
+	After    bool
 	Template bool
 }
 
 // A ScriptState represents the state of a script.
 type ScriptState struct {
-	Name       string    `json:"name"`
-	ExecutedAt time.Time `json:"executedAt"`
+	Name           string        `json:"name"`
+	ExecutedAt     time.Time     `json:"executedAt"`
+	Version        string        `json:"version,omitempty"`
+	ExitStatus     int           `json:"exitStatus"`
+	Duration       time.Duration `json:"duration"`
+	ContentsSHA256 string        `json:"contentsSHA256,omitempty"`
 }
 
+// A ScriptStatus is the status of a script relative to the persistent state.
+type ScriptStatus int
+
+// Script statuses.
+const (
+	ScriptStatusUpToDate ScriptStatus = iota // Script does not need to run.
+	ScriptStatusAlways                       // Script runs on every apply.
+	ScriptStatusNotRun                       // Script has never run successfully.
+	ScriptStatusChanged                      // Script has changed since it last ran.
+)
+
 // A Script represents a script to run.
 type Script struct {
+	sourceDir        string
 	sourceName       string
 	targetName       string
 	Once             bool
+	Before           bool
+	After            bool
 	Template         bool
 	contents         []byte
 	contentsErr      error
@@ -48,18 +71,38 @@ type scriptConcreteValue struct {
 	SourcePath string `json:"sourcePath" yaml:"sourcePath"`
 	TargetPath string `json:"targetPath" yaml:"targetPath"`
 	Once       bool   `json:"once" yaml:"once"`
+	Before     bool   `json:"before" yaml:"before"`
+	After      bool   `json:"after" yaml:"after"`
 	Template   bool   `json:"template" yaml:"template"`
 	Contents   string `json:"contents" yaml:"contents"`
 }
 
-// ParseScriptAttributes parses a source script file name.
+// ParseScriptAttributes parses a source script file name. The once_ attribute
+// must come before the before_ or after_ attribute, as returned by SourceName,
+// but is also parsed after it so that misordered source names like
+// run_after_once_foo are rejected as non-canonical rather than silently parsed
+// as scripts called once_foo.
 func ParseScriptAttributes(sourceName string) ScriptAttributes {
 	name := strings.TrimPrefix(sourceName, runPrefix)
 	once := false
+	before := false
+	after := false
 	template := false
-	if strings.HasPrefix(name, oncePrefix) {
-		once = true
-		name = strings.TrimPrefix(name, oncePrefix)
+FOR:
+	for {
+		switch {
+		case !once && strings.HasPrefix(name, oncePrefix):
+			once = true
+			name = strings.TrimPrefix(name, oncePrefix)
+		case !before && !after && strings.HasPrefix(name, beforePrefix):
+			before = true
+			name = strings.TrimPrefix(name, beforePrefix)
+		case !before && !after && strings.HasPrefix(name, afterPrefix):
+			after = true
+			name = strings.TrimPrefix(name, afterPrefix)
+		default:
+			break FOR
+		}
 	}
 	if strings.HasSuffix(name, TemplateSuffix) {
 		template = true
@@ -68,6 +111,8 @@ func ParseScriptAttributes(sourceName string) ScriptAttributes {
 	return ScriptAttributes{
 		Name:     name,
 		Once:     once,
+		Before:   before,
+		After:    after,
 		Template: template,
 	}
 }
@@ -78,6 +123,12 @@ func (sa ScriptAttributes) SourceName() string {
 	if sa.Once {
 		sourceName += oncePrefix
 	}
+	switch {
+	case sa.Before:
+		sourceName += beforePrefix
+	case sa.After:
+		sourceName += afterPrefix
+	}
 	sourceName += sa.Name
 	if sa.Template {
 		sourceName += TemplateSuffix
@@ -103,63 +154,109 @@ func (s *Script) Apply(fs vfs.FS, mutator Mutator, follow bool, applyOptions *Ap
 		return nil
 	}
 
-	var key []byte
+	contentsSHA256 := sha256.Sum256(contents)
+	key := scriptStateKey(s.targetName, contentsSHA256[:])
 	if s.Once {
-		contentsKeyArr := sha256.Sum256(contents)
-		key = []byte(s.targetName + ":" + hex.EncodeToString(contentsKeyArr[:]))
-		scriptStateData, err := applyOptions.PersistentState.Get(applyOptions.ScriptStateBucket, key)
+		scriptState, err := getScriptState(applyOptions.PersistentState, applyOptions.ScriptStateBucket, key)
 		if err != nil {
 			return err
 		}
-		if scriptStateData != nil {
+		if scriptState != nil && scriptState.ExitStatus == 0 {
 			return nil
 		}
 	}
 
-	if applyOptions.Verbose {
+	// If the mutator summarizes actions then use it to summarize running the
+	// script, otherwise write the script's contents in verbose mode.
+	summarizer, summarize := mutator.(Summarizer)
+
+	// In dry run mode, scripts are never run and their state is never
+	// recorded, so the persistent state is only read.
+	if applyOptions.DryRun && applyOptions.Verbose {
+		notYetRun := ""
+		if s.Once {
+			notYetRun = "not yet run"
+		}
+		if summarize {
+			summarizer.Summarize(wouldRunScriptAction, s.sourceName, notYetRun)
+		} else {
+			if notYetRun != "" {
+				notYetRun = " (" + notYetRun + ")"
+			}
+			if _, err := fmt.Fprintf(applyOptions.Stdout, "%s %s%s\n", wouldRunScriptAction, s.sourceName, notYetRun); err != nil {
+				return err
+			}
+		}
+	}
+	if applyOptions.Verbose && !summarize {
 		if _, err := applyOptions.Stdout.Write(contents); err != nil {
 			return err
 		}
 	}
 	if applyOptions.DryRun {
+		if applyOptions.LogScript != nil {
+			return applyOptions.LogScript(s.sourceName, 0)
+		}
 		return nil
 	}
 
-	// Write the temporary script file. Put the randomness on the front of the
-	// filename to preserve any file extension for Windows scripts.
-	f, err := ioutil.TempFile("", "*."+filepath.Base(s.targetName))
-	if err != nil {
-		return err
+	// Run the script from a temporary file. If the temporary directory is on
+	// a filesystem mounted noexec then try the next one.
+	tempDirs := applyOptions.ScriptTempDirs
+	if len(tempDirs) == 0 {
+		tempDirs = []string{os.TempDir()}
 	}
-
-	defer func() {
-		_ = os.RemoveAll(f.Name())
-	}()
-	if err := os.Chmod(f.Name(), 0o700); err != nil {
-		return err
+	var scriptPath string
+	var start time.Time
+	var runErr error
+	for i, tempDir := range tempDirs {
+		start = time.Now()
+		scriptPath, runErr = runInTempDir(tempDir, s.sourceName, s.targetName, contents, applyOptions.DestDir, applyOptions.ScriptEnv, os.Stdin, os.Stdout)
+		if i == len(tempDirs)-1 || !isNoExecError(runErr) {
+			break
+		}
+		if applyOptions.Verbose {
+			if _, err := fmt.Fprintf(applyOptions.Stdout, "cannot run script %s from %s, retrying from %s: %v\n", s.sourceName, scriptPath, tempDirs[i+1], runErr); err != nil {
+				return err
+			}
+		}
 	}
-	if _, err := f.Write(contents); err != nil {
-		return err
+	duration := time.Since(start)
+	if applyOptions.Verbose {
+		action, details, errSuffix := "ran script", duration.Round(100*time.Millisecond).String()+", "+scriptPath, ""
+		if runErr != nil {
+			action, details, errSuffix = "failed script", details+", "+runErr.Error(), ": "+runErr.Error()
+		}
+		if summarize {
+			summarizer.Summarize(action, s.sourceName, details)
+		} else if _, err := fmt.Fprintf(applyOptions.Stdout, "%s %s from %s%s\n", action, s.sourceName, scriptPath, errSuffix); err != nil {
+			return err
+		}
 	}
-	if err := f.Close(); err != nil {
-		return err
+
+	exitStatus := 0
+	if runErr != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(runErr, &exitErr) {
+			return runErr
+		}
+		exitStatus = exitErr.ExitCode()
 	}
 
-	// Run the temporary script file.
-	//nolint:gosec
-	c := exec.Command(f.Name())
-	c.Dir = filepath.Join(applyOptions.DestDir, filepath.Dir(s.targetName))
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
-	c.Stdin = os.Stdin
-	if err := c.Run(); err != nil {
-		return err
+	if applyOptions.LogScript != nil {
+		if err := applyOptions.LogScript(s.sourceName, exitStatus); err != nil {
+			return err
+		}
 	}
 
 	if s.Once {
 		scriptState := &ScriptState{
-			Name:       s.sourceName,
-			ExecutedAt: time.Now(),
+			Name:           s.sourceName,
+			ExecutedAt:     start,
+			Version:        applyOptions.Version,
+			ExitStatus:     exitStatus,
+			Duration:       duration,
+			ContentsSHA256: hex.EncodeToString(contentsSHA256[:]),
 		}
 		scriptStateData, err := json.Marshal(&scriptState)
 		if err != nil {
@@ -170,11 +267,11 @@ func (s *Script) Apply(fs vfs.FS, mutator Mutator, follow bool, applyOptions *Ap
 		}
 	}
 
-	return err
+	return runErr
 }
 
 // ConcreteValue implements Entry.ConcreteValue.
-func (s *Script) ConcreteValue(ignore func(string) bool, sourceDir string, umask os.FileMode, recursive bool) (interface{}, error) {
+func (s *Script) ConcreteValue(ignore func(string) bool, sourceDir string, umask os.FileMode, encryptedMode EncryptedMode, recursive bool) (interface{}, error) {
 	if ignore(s.targetName) {
 		return nil, nil
 	}
@@ -184,9 +281,11 @@ func (s *Script) ConcreteValue(ignore func(string) bool, sourceDir string, umask
 	}
 	return &scriptConcreteValue{
 		Type:       "script",
-		SourcePath: filepath.Join(sourceDir, s.SourceName()),
+		SourcePath: sourcePath(s, sourceDir),
 		TargetPath: s.TargetName(),
 		Once:       s.Once,
+		Before:     s.Before,
+		After:      s.After,
 		Template:   s.Template,
 		Contents:   string(contents),
 	}, nil
@@ -210,18 +309,64 @@ func (s *Script) Evaluate(ignore func(string) bool) error {
 	return err
 }
 
+// Status returns the status of s in bucket in persistentState.
+func (s *Script) Status(persistentState PersistentState, bucket []byte) (ScriptStatus, error) {
+	contents, err := s.Contents()
+	if err != nil {
+		return ScriptStatusUpToDate, err
+	}
+	if len(bytes.TrimSpace(contents)) == 0 {
+		return ScriptStatusUpToDate, nil
+	}
+	if !s.Once {
+		return ScriptStatusAlways, nil
+	}
+	contentsSHA256 := sha256.Sum256(contents)
+	scriptState, err := getScriptState(persistentState, bucket, scriptStateKey(s.targetName, contentsSHA256[:]))
+	if err != nil {
+		return ScriptStatusUpToDate, err
+	}
+	if scriptState != nil && scriptState.ExitStatus == 0 {
+		return ScriptStatusUpToDate, nil
+	}
+
+	// Look for a successful run of an earlier version of s.
+	prefix := []byte(s.targetName + ":")
+	changed := false
+	if err := persistentState.ForEach(bucket, func(k, v []byte) error {
+		if !bytes.HasPrefix(k, prefix) {
+			return nil
+		}
+		if scriptState := parseScriptState(v); scriptState.ExitStatus == 0 {
+			changed = true
+		}
+		return nil
+	}); err != nil {
+		return ScriptStatusUpToDate, err
+	}
+	if changed {
+		return ScriptStatusChanged, nil
+	}
+	return ScriptStatusNotRun, nil
+}
+
 // SourceName implements Entry.SourceName.
 func (s *Script) SourceName() string {
 	return s.sourceName
 }
 
+// sourceDirectory implements Entry.sourceDirectory.
+func (s *Script) sourceDirectory() string {
+	return s.sourceDir
+}
+
 // TargetName implements Entry.TargetName.
 func (s *Script) TargetName() string {
 	return s.targetName
 }
 
 // archive writes s to w.
-func (s *Script) archive(w *tar.Writer, ignore func(string) bool, headerTemplate *tar.Header, umask os.FileMode) error {
+func (s *Script) archive(w archiveWriter, ignore func(string) bool, umask os.FileMode, encryptedMode EncryptedMode) error {
 	if ignore(s.targetName) {
 		return nil
 	}
@@ -229,14 +374,132 @@ func (s *Script) archive(w *tar.Writer, ignore func(string) bool, headerTemplate
 	if err != nil {
 		return err
 	}
-	header := *headerTemplate
-	header.Typeflag = tar.TypeReg
-	header.Name = s.targetName
-	header.Size = int64(len(contents))
-	header.Mode = int64(0o777 &^ umask)
-	if err := w.WriteHeader(&header); err != nil {
-		return nil
+	return w.writeFile(s.targetName, contents, 0o777&^umask)
+}
+
+// runInTempDir writes contents, the script with sourceName and targetName, to a
+// temporary file in tempDir and runs it in the directory of its target in
+// destDir, with env added to its environment, reading from stdin and writing to
+// stdout. It returns the path of the temporary file, which is always removed,
+// even if chezmoi is interrupted while the script is running.
+func runInTempDir(tempDir, sourceName, targetName string, contents []byte, destDir string, env []string, stdin io.Reader, stdout io.Writer) (string, error) {
+	// Only create the directory if it does not exist, so that the permissions
+	// of shared directories like /tmp are not changed.
+	if err := os.MkdirAll(tempDir, 0o700); err != nil {
+		return "", err
 	}
-	_, err = w.Write(contents)
-	return err
+
+	// Write the temporary script file. Put the randomness on the front of the
+	// filename to preserve any file extension for Windows scripts.
+	f, err := ioutil.TempFile(tempDir, "*."+filepath.Base(targetName))
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = os.RemoveAll(f.Name())
+	}()
+	if err := os.Chmod(f.Name(), 0o700); err != nil {
+		return f.Name(), err
+	}
+	if _, err := f.Write(contents); err != nil {
+		_ = f.Close()
+		return f.Name(), err
+	}
+	if err := f.Close(); err != nil {
+		return f.Name(), err
+	}
+
+	// Catch signals while the script runs so that chezmoi is not killed before
+	// the temporary script file is removed. Interrupts from the terminal are
+	// also received by the script, other signals are forwarded to it.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	//nolint:gosec
+	c := exec.Command(f.Name())
+	c.Dir = getScriptDir(destDir, targetName)
+	if len(env) != 0 {
+		c.Env = append(os.Environ(), env...)
+	}
+	c.Stdout = stdout
+	c.Stderr = os.Stderr
+	c.Stdin = stdin
+	if err := c.Start(); err != nil {
+		return f.Name(), err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Wait()
+	}()
+	var received os.Signal
+	for {
+		select {
+		case received = <-signals:
+			if received != os.Interrupt {
+				_ = c.Process.Signal(received)
+			}
+		case err := <-done:
+			if received != nil {
+				return f.Name(), fmt.Errorf("%s: interrupted by %s", sourceName, received)
+			}
+			return f.Name(), err
+		}
+	}
+}
+
+// getScriptDir returns the directory that the script with targetName is run
+// from, which is the directory containing its target or, if that does not exist
+// yet, for example for before_ scripts, its closest existing parent.
+func getScriptDir(destDir, targetName string) string {
+	dir := filepath.Join(destDir, filepath.Dir(targetName))
+	for dir != destDir {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+// getScriptState returns the state of the script with key in bucket in
+// persistentState, or nil if the script has no state.
+func getScriptState(persistentState PersistentState, bucket, key []byte) (*ScriptState, error) {
+	data, err := persistentState.Get(bucket, key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return parseScriptState(data), nil
+}
+
+// parseScriptState parses data as a ScriptState. Older versions of chezmoi
+// recorded less information, or only a placeholder value, so any value that
+// cannot be parsed is treated as a successful run.
+func parseScriptState(data []byte) *ScriptState {
+	scriptState := &ScriptState{}
+	if err := json.Unmarshal(data, scriptState); err != nil {
+		return &ScriptState{}
+	}
+	return scriptState
+}
+
+// scriptStateKey returns the key of the script with targetName and contents
+// with SHA256 sum contentsSHA256.
+func scriptStateKey(targetName string, contentsSHA256 []byte) []byte {
+	return []byte(targetName + ":" + hex.EncodeToString(contentsSHA256))
+}
+
+// ScriptStateKeyTargetName returns the target name of the script whose state
+// is recorded under key, and whether key is a valid script state key. It is the
+// inverse of scriptStateKey.
+func ScriptStateKeyTargetName(key []byte) (string, bool) {
+	i := bytes.LastIndexByte(key, ':')
+	if i == -1 {
+		return "", false
+	}
+	contentsSHA256, err := hex.DecodeString(string(key[i+1:]))
+	if err != nil || len(contentsSHA256) != sha256.Size {
+		return "", false
+	}
+	return string(key[:i]), true
 }
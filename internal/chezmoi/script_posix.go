@@ -0,0 +1,14 @@
+// +build !windows
+
+package chezmoi
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isNoExecError returns whether err is the error returned when running a
+// script from a filesystem that is mounted noexec.
+func isNoExecError(err error) bool {
+	return errors.Is(err, syscall.EACCES) || errors.Is(err, syscall.ENOEXEC)
+}
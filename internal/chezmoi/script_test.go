@@ -0,0 +1,238 @@
+package chezmoi
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+func TestScriptAttributes(t *testing.T) {
+	for _, tc := range []struct {
+		sourceName          string
+		sa                  ScriptAttributes
+		canonicalSourceName string
+	}{
+		{sourceName: "run_foo", sa: ScriptAttributes{Name: "foo"}},
+		{sourceName: "run_once_foo.tmpl", sa: ScriptAttributes{Name: "foo", Once: true, Template: true}},
+		{sourceName: "run_before_10-setup.sh", sa: ScriptAttributes{Name: "10-setup.sh", Before: true}},
+		{sourceName: "run_after_reload", sa: ScriptAttributes{Name: "reload", After: true}},
+		{sourceName: "run_once_before_foo", sa: ScriptAttributes{Name: "foo", Once: true, Before: true}},
+		{sourceName: "run_after_once_foo", sa: ScriptAttributes{Name: "foo", Once: true, After: true}, canonicalSourceName: "run_once_after_foo"},
+		{sourceName: "run_before_after_foo", sa: ScriptAttributes{Name: "after_foo", Before: true}},
+	} {
+		t.Run(tc.sourceName, func(t *testing.T) {
+			assert.Equal(t, tc.sa, ParseScriptAttributes(tc.sourceName))
+			canonicalSourceName := tc.canonicalSourceName
+			if canonicalSourceName == "" {
+				canonicalSourceName = tc.sourceName
+			}
+			assert.Equal(t, canonicalSourceName, tc.sa.SourceName())
+		})
+	}
+}
+
+func TestScriptAttributesRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		sourceName string
+		valid      bool
+	}{
+		{sourceName: "run_foo", valid: true},
+		{sourceName: "run_once_foo", valid: true},
+		{sourceName: "run_before_foo.tmpl", valid: true},
+		{sourceName: "run_once_after_foo", valid: true},
+		{sourceName: "run_after_once_foo", valid: false},
+		{sourceName: "run_before_once_foo.tmpl", valid: false},
+	} {
+		t.Run(tc.sourceName, func(t *testing.T) {
+			err := checkCanonicalSourceName(tc.sourceName, ParseScriptAttributes(tc.sourceName).SourceName())
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestParseScriptState(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want *ScriptState
+	}{
+		{
+			name: "single_byte",
+			data: []byte{1},
+			want: &ScriptState{},
+		},
+		{
+			name: "name_and_executed_at",
+			data: []byte(`{"name":"run_once_foo","executedAt":"2020-01-02T03:04:05Z"}`),
+			want: &ScriptState{
+				Name:       "run_once_foo",
+				ExecutedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			},
+		},
+		{
+			name: "failed",
+			data: []byte(`{"name":"run_once_foo","exitStatus":1,"duration":1000000000}`),
+			want: &ScriptState{
+				Name:       "run_once_foo",
+				ExitStatus: 1,
+				Duration:   time.Second,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, parseScriptState(tc.data))
+		})
+	}
+}
+
+func TestScriptStateKeyTargetName(t *testing.T) {
+	contentsSHA256 := sha256.Sum256([]byte("#!/bin/sh\n"))
+	for _, tc := range []struct {
+		name           string
+		key            []byte
+		wantTargetName string
+		wantOK         bool
+	}{
+		{
+			name:           "simple",
+			key:            scriptStateKey("install", contentsSHA256[:]),
+			wantTargetName: "install",
+			wantOK:         true,
+		},
+		{
+			name:           "colon_in_target_name",
+			key:            scriptStateKey("dir/a:b", contentsSHA256[:]),
+			wantTargetName: "dir/a:b",
+			wantOK:         true,
+		},
+		{
+			name: "no_colon",
+			key:  []byte("install"),
+		},
+		{
+			name: "invalid_sha256",
+			key:  []byte("install:xyz"),
+		},
+		{
+			name: "short_sha256",
+			key:  []byte("install:0123"),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			targetName, ok := ScriptStateKeyTargetName(tc.key)
+			assert.Equal(t, tc.wantTargetName, targetName)
+			assert.Equal(t, tc.wantOK, ok)
+		})
+	}
+}
+
+func TestScriptStatus(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.config/chezmoi": &vfst.Dir{Perm: 0o755},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	persistentState, err := NewBoltPersistentState(fs, "/home/user/.config/chezmoi/chezmoistate.boltdb", vfst.DefaultUmask, nil)
+	require.NoError(t, err)
+	defer persistentState.Close()
+	bucket := []byte("script")
+
+	setScriptState := func(targetName, contents string, exitStatus int) {
+		contentsSHA256 := sha256.Sum256([]byte(contents))
+		data, err := json.Marshal(&ScriptState{
+			Name:       "run_once_" + targetName,
+			ExitStatus: exitStatus,
+		})
+		require.NoError(t, err)
+		require.NoError(t, persistentState.Set(bucket, scriptStateKey(targetName, contentsSHA256[:]), data))
+	}
+
+	for _, tc := range []struct {
+		name   string
+		script *Script
+		setup  func()
+		want   ScriptStatus
+	}{
+		{
+			name: "always",
+			script: &Script{
+				targetName: "always",
+				contents:   []byte("#!/bin/sh\n"),
+			},
+			want: ScriptStatusAlways,
+		},
+		{
+			name: "empty",
+			script: &Script{
+				targetName: "empty",
+				Once:       true,
+				contents:   []byte(" \n"),
+			},
+			want: ScriptStatusUpToDate,
+		},
+		{
+			name: "not_run",
+			script: &Script{
+				targetName: "not_run",
+				Once:       true,
+				contents:   []byte("#!/bin/sh\n"),
+			},
+			want: ScriptStatusNotRun,
+		},
+		{
+			name: "up_to_date",
+			script: &Script{
+				targetName: "up_to_date",
+				Once:       true,
+				contents:   []byte("#!/bin/sh\n"),
+			},
+			setup: func() {
+				setScriptState("up_to_date", "#!/bin/sh\n", 0)
+			},
+			want: ScriptStatusUpToDate,
+		},
+		{
+			name: "failed",
+			script: &Script{
+				targetName: "failed",
+				Once:       true,
+				contents:   []byte("#!/bin/sh\n"),
+			},
+			setup: func() {
+				setScriptState("failed", "#!/bin/sh\n", 1)
+			},
+			want: ScriptStatusNotRun,
+		},
+		{
+			name: "changed",
+			script: &Script{
+				targetName: "changed",
+				Once:       true,
+				contents:   []byte("#!/bin/sh\necho new\n"),
+			},
+			setup: func() {
+				setScriptState("changed", "#!/bin/sh\necho old\n", 0)
+			},
+			want: ScriptStatusChanged,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.setup != nil {
+				tc.setup()
+			}
+			status, err := tc.script.Status(persistentState, bucket)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, status)
+		})
+	}
+}
@@ -0,0 +1,9 @@
+// +build windows
+
+package chezmoi
+
+// isNoExecError always returns false on Windows, which does not have noexec
+// mounts.
+func isNoExecError(err error) bool {
+	return false
+}
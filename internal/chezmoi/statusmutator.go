@@ -0,0 +1,125 @@
+package chezmoi
+
+import (
+	"io"
+	"os"
+	"os/exec"
+
+	vfs "github.com/twpayne/go-vfs"
+)
+
+// Statuses recorded by a StatusMutator.
+const (
+	StatusAdded    = 'A'
+	StatusDeleted  = 'D'
+	StatusModified = 'M'
+)
+
+// A StatusMutator wraps a Mutator and records how each path would be changed,
+// like the second column of git status --short.
+type StatusMutator struct {
+	m        Mutator
+	fs       vfs.FS
+	statuses map[string]byte
+}
+
+// NewStatusMutator returns a new StatusMutator that reads the current state of
+// each path from fs.
+func NewStatusMutator(m Mutator, fs vfs.FS) *StatusMutator {
+	return &StatusMutator{
+		m:        m,
+		fs:       fs,
+		statuses: make(map[string]byte),
+	}
+}
+
+// Chmod implements Mutator.Chmod.
+func (m *StatusMutator) Chmod(name string, mode os.FileMode) error {
+	m.record(name, false)
+	return m.m.Chmod(name, mode)
+}
+
+// IdempotentCmdOutput implements Mutator.IdempotentCmdOutput.
+func (m *StatusMutator) IdempotentCmdOutput(cmd *exec.Cmd) ([]byte, error) {
+	return m.m.IdempotentCmdOutput(cmd)
+}
+
+// Lchown implements Mutator.Lchown.
+func (m *StatusMutator) Lchown(name string, uid, gid int) error {
+	m.record(name, false)
+	return m.m.Lchown(name, uid, gid)
+}
+
+// Mkdir implements Mutator.Mkdir.
+func (m *StatusMutator) Mkdir(name string, perm os.FileMode) error {
+	m.record(name, false)
+	return m.m.Mkdir(name, perm)
+}
+
+// RemoveAll implements Mutator.RemoveAll.
+func (m *StatusMutator) RemoveAll(name string) error {
+	m.record(name, true)
+	return m.m.RemoveAll(name)
+}
+
+// Rename implements Mutator.Rename.
+func (m *StatusMutator) Rename(oldpath, newpath string) error {
+	m.record(oldpath, true)
+	m.record(newpath, false)
+	return m.m.Rename(oldpath, newpath)
+}
+
+// RunCmd implements Mutator.RunCmd.
+func (m *StatusMutator) RunCmd(cmd *exec.Cmd) error {
+	return m.m.RunCmd(cmd)
+}
+
+// Stat implements Mutator.Stat.
+func (m *StatusMutator) Stat(name string) (os.FileInfo, error) {
+	return m.m.Stat(name)
+}
+
+// Statuses returns the status of each path that would be changed.
+func (m *StatusMutator) Statuses() map[string]byte {
+	return m.statuses
+}
+
+// WriteFile implements Mutator.WriteFile.
+func (m *StatusMutator) WriteFile(name string, data []byte, perm os.FileMode, currData []byte) error {
+	m.record(name, false)
+	return m.m.WriteFile(name, data, perm, currData)
+}
+
+// WriteFileFrom implements Mutator.WriteFileFrom.
+func (m *StatusMutator) WriteFileFrom(name string, r io.Reader, size int64, perm os.FileMode) error {
+	m.record(name, false)
+	return m.m.WriteFileFrom(name, r, size, perm)
+}
+
+// WriteSymlink implements Mutator.WriteSymlink.
+func (m *StatusMutator) WriteSymlink(oldname, newname string) error {
+	m.record(newname, false)
+	return m.m.WriteSymlink(oldname, newname)
+}
+
+// record records the status of name. A path that does not exist is added, a
+// path that exists is deleted if remove is true and modified otherwise. A path
+// that is deleted and then written, for example because its type changes, is
+// modified.
+func (m *StatusMutator) record(name string, remove bool) {
+	var status byte
+	switch _, err := m.fs.Lstat(name); {
+	case os.IsNotExist(err):
+		status = StatusAdded
+	case remove:
+		status = StatusDeleted
+	default:
+		status = StatusModified
+	}
+	switch prevStatus, ok := m.statuses[name]; {
+	case !ok:
+		m.statuses[name] = status
+	case prevStatus == StatusDeleted && !remove:
+		m.statuses[name] = StatusModified
+	}
+}
@@ -0,0 +1,37 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-vfs/vfst"
+)
+
+var _ Mutator = &StatusMutator{}
+
+func TestStatusMutator(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".bashrc": "# old\n",
+			".old":    "old\n",
+			".vimrc":  &vfst.Symlink{Target: ".bashrc"},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	m := NewStatusMutator(NullMutator{}, fs)
+	require.NoError(t, m.WriteFile("/home/user/.bashrc", []byte("# new\n"), 0o644, []byte("# old\n")))
+	require.NoError(t, m.RemoveAll("/home/user/.old"))
+	require.NoError(t, m.RemoveAll("/home/user/.vimrc"))
+	require.NoError(t, m.WriteFile("/home/user/.vimrc", []byte("\" vimrc\n"), 0o644, nil))
+	require.NoError(t, m.Mkdir("/home/user/.config", 0o755))
+	require.NoError(t, m.Chmod("/home/user/.config", 0o700))
+	assert.Equal(t, map[string]byte{
+		"/home/user/.bashrc": StatusModified,
+		"/home/user/.config": StatusAdded,
+		"/home/user/.old":    StatusDeleted,
+		"/home/user/.vimrc":  StatusModified,
+	}, m.Statuses())
+}
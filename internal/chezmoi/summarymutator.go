@@ -0,0 +1,228 @@
+package chezmoi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	vfs "github.com/twpayne/go-vfs"
+)
+
+// A Summarizer summarizes actions that are not executed by a Mutator, for
+// example running scripts.
+type Summarizer interface {
+	Summarize(action, name, details string)
+}
+
+// wouldRunScriptAction is the action that scripts that would be run in dry run
+// mode are summarized with.
+const wouldRunScriptAction = "would run script"
+
+// summaryActionColors maps the first word of an action to an ANSI color.
+var summaryActionColors = map[string]string{
+	"created": "\x1b[32m",
+	"failed":  "\x1b[31m",
+	"ran":     "\x1b[36m",
+	"removed": "\x1b[31m",
+	"renamed": "\x1b[34m",
+	"updated": "\x1b[33m",
+	"would":   "\x1b[36m",
+}
+
+// summaryDryRunActions maps actions to the actions that they are summarized as
+// in dry run mode, when they are not executed.
+var summaryDryRunActions = map[string]string{
+	"created": "would create",
+	"removed": "would remove",
+	"renamed": "would rename",
+	"updated": "would update",
+}
+
+// A SummaryMutator wraps a Mutator and writes a one line summary of each
+// action that it executes, for example "created .bashrc" or "updated .zshrc
+// (contents, mode 0644→0600)".
+type SummaryMutator struct {
+	m       Mutator
+	w       io.Writer
+	fs      vfs.FS
+	colored bool
+	destDir string
+	dryRun  bool
+}
+
+// NewSummaryMutator returns a new SummaryMutator that writes summaries to w.
+// The previous state of each target is read from fs and paths in destDir are
+// written relative to destDir. If dryRun is true then actions are summarized as
+// actions that would be executed.
+func NewSummaryMutator(w io.Writer, m Mutator, fs vfs.FS, colored bool, destDir string, dryRun bool) *SummaryMutator {
+	return &SummaryMutator{
+		m:       m,
+		w:       w,
+		fs:      fs,
+		colored: colored,
+		destDir: destDir,
+		dryRun:  dryRun,
+	}
+}
+
+// Chmod implements Mutator.Chmod.
+func (m *SummaryMutator) Chmod(name string, mode os.FileMode) error {
+	var details string
+	if info, err := m.fs.Lstat(name); err == nil {
+		details = formatModeChange(info.Mode()&permMask, mode&permMask)
+	}
+	if err := m.m.Chmod(name, mode); err != nil {
+		return err
+	}
+	m.Summarize("updated", m.displayPath(name), details)
+	return nil
+}
+
+// IdempotentCmdOutput implements Mutator.IdempotentCmdOutput.
+func (m *SummaryMutator) IdempotentCmdOutput(cmd *exec.Cmd) ([]byte, error) {
+	return m.m.IdempotentCmdOutput(cmd)
+}
+
+// Lchown implements Mutator.Lchown.
+func (m *SummaryMutator) Lchown(name string, uid, gid int) error {
+	if err := m.m.Lchown(name, uid, gid); err != nil {
+		return err
+	}
+	m.Summarize("updated", m.displayPath(name), fmt.Sprintf("owner %d:%d", uid, gid))
+	return nil
+}
+
+// Mkdir implements Mutator.Mkdir.
+func (m *SummaryMutator) Mkdir(name string, perm os.FileMode) error {
+	if err := m.m.Mkdir(name, perm); err != nil {
+		return err
+	}
+	m.Summarize("created", m.displayPath(name), "")
+	return nil
+}
+
+// RemoveAll implements Mutator.RemoveAll.
+func (m *SummaryMutator) RemoveAll(name string) error {
+	if err := m.m.RemoveAll(name); err != nil {
+		return err
+	}
+	m.Summarize("removed", m.displayPath(name), "")
+	return nil
+}
+
+// Rename implements Mutator.Rename.
+func (m *SummaryMutator) Rename(oldpath, newpath string) error {
+	if err := m.m.Rename(oldpath, newpath); err != nil {
+		return err
+	}
+	m.Summarize("renamed", m.displayPath(oldpath), "to "+m.displayPath(newpath))
+	return nil
+}
+
+// RunCmd implements Mutator.RunCmd.
+func (m *SummaryMutator) RunCmd(cmd *exec.Cmd) error {
+	return m.m.RunCmd(cmd)
+}
+
+// Stat implements Mutator.Stat.
+func (m *SummaryMutator) Stat(name string) (os.FileInfo, error) {
+	return m.m.Stat(name)
+}
+
+// Summarize implements Summarizer.Summarize.
+func (m *SummaryMutator) Summarize(action, name, details string) {
+	color, ok := summaryActionColors[strings.Fields(action)[0]]
+	if m.dryRun {
+		if dryRunAction, ok := summaryDryRunActions[action]; ok {
+			action = dryRunAction
+		}
+	}
+	if m.colored && ok {
+		action = color + action + "\x1b[0m"
+	}
+	if details == "" {
+		_, _ = fmt.Fprintf(m.w, "%s %s\n", action, name)
+	} else {
+		_, _ = fmt.Fprintf(m.w, "%s %s (%s)\n", action, name, details)
+	}
+}
+
+// WriteFile implements Mutator.WriteFile.
+func (m *SummaryMutator) WriteFile(name string, data []byte, perm os.FileMode, currData []byte) error {
+	action := "created"
+	var details []string
+	if info, err := m.fs.Lstat(name); err == nil && info.Mode().IsRegular() {
+		action = "updated"
+		if !bytes.Equal(currData, data) {
+			details = append(details, "contents")
+		}
+		if modeChange := formatModeChange(info.Mode()&permMask, perm&permMask); modeChange != "" {
+			details = append(details, modeChange)
+		}
+	}
+	if err := m.m.WriteFile(name, data, perm, currData); err != nil {
+		return err
+	}
+	m.Summarize(action, m.displayPath(name), strings.Join(details, ", "))
+	return nil
+}
+
+// WriteFileFrom implements Mutator.WriteFileFrom. The contents of an existing
+// file are assumed to change, as they are not read.
+func (m *SummaryMutator) WriteFileFrom(name string, r io.Reader, size int64, perm os.FileMode) error {
+	action := "created"
+	var details []string
+	if info, err := m.fs.Lstat(name); err == nil && info.Mode().IsRegular() {
+		action = "updated"
+		details = append(details, "contents")
+		if modeChange := formatModeChange(info.Mode()&permMask, perm&permMask); modeChange != "" {
+			details = append(details, modeChange)
+		}
+	}
+	if err := m.m.WriteFileFrom(name, r, size, perm); err != nil {
+		return err
+	}
+	m.Summarize(action, m.displayPath(name), strings.Join(details, ", "))
+	return nil
+}
+
+// WriteSymlink implements Mutator.WriteSymlink.
+func (m *SummaryMutator) WriteSymlink(oldname, newname string) error {
+	action := "created"
+	if _, err := m.fs.Lstat(newname); err == nil {
+		action = "updated"
+	}
+	if err := m.m.WriteSymlink(oldname, newname); err != nil {
+		return err
+	}
+	m.Summarize(action, m.displayPath(newname), "")
+	return nil
+}
+
+// displayPath returns path relative to m.destDir, or path if it is not in
+// m.destDir.
+func (m *SummaryMutator) displayPath(path string) string {
+	if m.destDir == "" {
+		return path
+	}
+	if path == m.destDir {
+		return "."
+	}
+	if relPath := strings.TrimPrefix(path, strings.TrimSuffix(m.destDir, string(filepath.Separator))+string(filepath.Separator)); relPath != path {
+		return relPath
+	}
+	return path
+}
+
+// formatModeChange returns a description of the change from oldMode to
+// newMode, or the empty string if they are equal.
+func formatModeChange(oldMode, newMode os.FileMode) string {
+	if oldMode == newMode {
+		return ""
+	}
+	return fmt.Sprintf("mode %04o→%04o", fileModeToUnixPerm(oldMode), fileModeToUnixPerm(newMode))
+}
@@ -0,0 +1,88 @@
+package chezmoi
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var _ Mutator = &SummaryMutator{}
+
+func TestSummaryMutatorSummarize(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		colored     bool
+		dryRun      bool
+		action      string
+		path        string
+		details     string
+		expectedStr string
+	}{
+		{
+			name:        "created",
+			action:      "created",
+			path:        filepath.Join("/home/user", ".bashrc"),
+			expectedStr: "created .bashrc\n",
+		},
+		{
+			name:        "updated_details",
+			action:      "updated",
+			path:        filepath.Join("/home/user", ".zshrc"),
+			details:     "contents, mode 0644→0600",
+			expectedStr: "updated .zshrc (contents, mode 0644→0600)\n",
+		},
+		{
+			name:        "outside_dest_dir",
+			action:      "removed",
+			path:        filepath.Join("/etc", "hosts"),
+			expectedStr: "removed " + filepath.Join("/etc", "hosts") + "\n",
+		},
+		{
+			name:        "colored",
+			colored:     true,
+			action:      "removed",
+			path:        filepath.Join("/home/user", ".old"),
+			expectedStr: "\x1b[31mremoved\x1b[0m .old\n",
+		},
+		{
+			name:        "colored_script",
+			colored:     true,
+			action:      "would run script",
+			path:        "run_install.sh",
+			expectedStr: "\x1b[36mwould run script\x1b[0m run_install.sh\n",
+		},
+		{
+			name:        "dry_run",
+			dryRun:      true,
+			action:      "updated",
+			path:        filepath.Join("/home/user", ".zshrc"),
+			details:     "contents",
+			expectedStr: "would update .zshrc (contents)\n",
+		},
+		{
+			name:        "dry_run_colored",
+			colored:     true,
+			dryRun:      true,
+			action:      "created",
+			path:        filepath.Join("/home/user", ".config", "foo"),
+			expectedStr: "\x1b[32mwould create\x1b[0m " + filepath.Join(".config", "foo") + "\n",
+		},
+		{
+			name:        "failed_script",
+			colored:     true,
+			action:      "failed script",
+			path:        "run_install.sh",
+			details:     "exit status 1",
+			expectedStr: "\x1b[31mfailed script\x1b[0m run_install.sh (exit status 1)\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sb := &strings.Builder{}
+			m := NewSummaryMutator(sb, NullMutator{}, nil, tc.colored, "/home/user", tc.dryRun)
+			m.Summarize(tc.action, m.displayPath(tc.path), tc.details)
+			assert.Equal(t, tc.expectedStr, sb.String())
+		})
+	}
+}
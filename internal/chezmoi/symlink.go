@@ -1,7 +1,6 @@
 package chezmoi
 
 import (
-	"archive/tar"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,6 +10,7 @@ import (
 
 // A Symlink represents the target state of a symlink.
 type Symlink struct {
+	sourceDir        string
 	sourceName       string
 	targetName       string
 	Template         bool
@@ -41,6 +41,9 @@ func (s *Symlink) Apply(fs vfs.FS, mutator Mutator, follow bool, applyOptions *A
 	if err != nil {
 		return err
 	}
+	if target != "" && applyOptions.RewriteLinkname != nil {
+		target = applyOptions.RewriteLinkname(target)
+	}
 	targetPath := filepath.Join(applyOptions.DestDir, s.targetName)
 	var info os.FileInfo
 	if follow {
@@ -70,7 +73,7 @@ func (s *Symlink) Apply(fs vfs.FS, mutator Mutator, follow bool, applyOptions *A
 }
 
 // ConcreteValue implements Entry.ConcreteValue.
-func (s *Symlink) ConcreteValue(ignore func(string) bool, sourceDir string, umask os.FileMode, recursive bool) (interface{}, error) {
+func (s *Symlink) ConcreteValue(ignore func(string) bool, sourceDir string, umask os.FileMode, encryptedMode EncryptedMode, recursive bool) (interface{}, error) {
 	if ignore(s.targetName) {
 		return nil, nil
 	}
@@ -80,7 +83,7 @@ func (s *Symlink) ConcreteValue(ignore func(string) bool, sourceDir string, umas
 	}
 	return &symlinkConcreteValue{
 		Type:       "symlink",
-		SourcePath: filepath.Join(sourceDir, s.SourceName()),
+		SourcePath: sourcePath(s, sourceDir),
 		TargetPath: s.TargetName(),
 		Template:   s.Template,
 		Linkname:   linkname,
@@ -110,13 +113,18 @@ func (s *Symlink) SourceName() string {
 	return s.sourceName
 }
 
+// sourceDirectory implements Entry.sourceDirectory.
+func (s *Symlink) sourceDirectory() string {
+	return s.sourceDir
+}
+
 // TargetName implements Entry.TargetName.
 func (s *Symlink) TargetName() string {
 	return s.targetName
 }
 
 // archive writes s to w.
-func (s *Symlink) archive(w *tar.Writer, ignore func(string) bool, headerTemplate *tar.Header, umask os.FileMode) error {
+func (s *Symlink) archive(w archiveWriter, ignore func(string) bool, umask os.FileMode, encryptedMode EncryptedMode) error {
 	if ignore(s.targetName) {
 		return nil
 	}
@@ -124,9 +132,5 @@ func (s *Symlink) archive(w *tar.Writer, ignore func(string) bool, headerTemplat
 	if err != nil {
 		return err
 	}
-	header := *headerTemplate
-	header.Name = s.targetName
-	header.Typeflag = tar.TypeSymlink
-	header.Linkname = linkname
-	return w.WriteHeader(&header)
+	return w.writeSymlink(s.targetName, linkname)
 }
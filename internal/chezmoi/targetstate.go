@@ -2,14 +2,18 @@ package chezmoi
 
 import (
 	"archive/tar"
+	"archive/zip"
 	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 
@@ -21,7 +25,17 @@ import (
 // DefaultTemplateOptions are the default template options.
 var DefaultTemplateOptions = []string{"missingkey=error"}
 
+// maxIncludeTemplateDepth is the maximum depth of nested includeTemplate
+// calls, so that templates that include themselves fail instead of recursing
+// forever.
+const maxIncludeTemplateDepth = 100
+
+// includeTemplateFuncName is the name of the template function that executes a
+// template from .chezmoitemplates with the given data.
+const includeTemplateFuncName = "includeTemplate"
+
 const (
+	dependenciesName = ".chezmoidependencies"
 	ignoreName       = ".chezmoiignore"
 	removeName       = ".chezmoiremove"
 	templatesDirName = ".chezmoitemplates"
@@ -30,12 +44,16 @@ const (
 
 // An AddOptions contains options for TargetState.Add.
 type AddOptions struct {
+	Create       bool
 	Empty        bool
 	Encrypt      bool
 	Exact        bool
 	Recursive    bool
 	Template     bool
 	AutoTemplate bool
+	// NoSuffix, if set with Template, adds templates without the .tmpl
+	// suffix. The source name must match a template glob.
+	NoSuffix bool
 }
 
 // An ImportTAROptions contains options for TargetState.ImportTAR.
@@ -48,22 +66,97 @@ type ImportTAROptions struct {
 // A PopulateOptions contains options for TargetState.Populate.
 type PopulateOptions struct {
 	ExecuteTemplates bool
+	// NoDecrypt, if set, populates encrypted directories without decrypting
+	// them, so they have no entries.
+	NoDecrypt bool
+	// Symlink, if set, populates plain files as if they had the link_
+	// attribute.
+	Symlink bool
+	// ReportError, if set, is called with each problem found in the source
+	// state, and Populate continues instead of returning the first error.
+	// line is zero if the problem is not on a particular line.
+	ReportError func(path string, line int, err error)
+	// TargetNames, if not empty, restricts Populate to the entries whose
+	// target names are equal to, inside, or ancestors of any of TargetNames.
+	// Ignore, remove, template, and version files are always read.
+	TargetNames []string
+}
+
+// includeTargetName returns whether the entry with targetName should be
+// populated.
+func (o *PopulateOptions) includeTargetName(targetName string) bool {
+	if o == nil || len(o.TargetNames) == 0 {
+		return true
+	}
+	for _, name := range o.TargetNames {
+		if targetName == name ||
+			strings.HasPrefix(targetName, name+string(filepath.Separator)) ||
+			strings.HasPrefix(name, targetName+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// A ScopedDirRule describes subdirectories of the root of a source directory,
+// or of other scoped directories, whose contents are only used when a
+// condition is true, and which are then merged into the root of the target
+// state.
+type ScopedDirRule struct {
+	// Pattern is matched against the names of subdirectories of the root of
+	// each source directory.
+	Pattern string
+	// Condition is a template that is executed with the template data and
+	// the name of the subdirectory in .scopedDir, and which must return true
+	// or false.
+	Condition string
+	// Priority orders matching subdirectories. Subdirectories with higher
+	// priorities override those with lower priorities, and on equal
+	// priorities more deeply nested subdirectories override less deeply
+	// nested ones.
+	Priority int
+}
+
+// A scopedDir is a subdirectory of a source directory matching a
+// ScopedDirRule whose condition is true.
+type scopedDir struct {
+	sourceDir      string
+	sourceDirIndex int
+	name           string
+	depth          int
+	priority       int
 }
 
 // A TargetState represents the root target state.
 type TargetState struct {
-	DestDir         string
-	Entries         map[string]Entry
-	GPG             *GPG
-	MinVersion      *semver.Version
-	SourceDir       string
-	TargetIgnore    *PatternSet
-	TargetRemove    *PatternSet
-	TemplateData    map[string]interface{}
-	TemplateFuncs   template.FuncMap
-	TemplateOptions []string
-	Templates       map[string]*template.Template
-	Umask           os.FileMode
+	Dependencies     map[string][]string
+	DestDir          string
+	EncryptedPrivate bool
+	Encryption       Encryption
+	Entries          map[string]Entry
+	MinVersion       *semver.Version
+	Owner            func(string) *Owner
+	PathMap          map[string]string
+	ScopedDirRules   []ScopedDirRule
+	ScriptEnv        []string
+	ScriptTempDirs   []string
+	SourceDir        string
+	SourceDirs       []string
+	TargetIgnore     *PatternSet
+	TargetRemove     *PatternSet
+	TemplateData     map[string]interface{}
+	TemplateFuncs    template.FuncMap
+	TemplateGlobs    []string
+	TemplateOptions  []string
+	Templates        map[string]*template.Template
+	Umask            os.FileMode
+	// LargeFileSize is the size above which the contents of plain files, which
+	// are neither encrypted nor templates, are streamed instead of being read
+	// into memory. If it is zero then contents are always read into memory.
+	LargeFileSize int64
+	// dependencyPaths are the paths of the .chezmoidependencies files that
+	// declare the dependencies of each target name, for error messages.
+	dependencyPaths map[string]string
 }
 
 // A TargetStateOption sets an option on a TargeState.
@@ -76,6 +169,20 @@ func WithDestDir(destDir string) TargetStateOption {
 	}
 }
 
+// WithEncryptedPrivate sets whether encrypted files are private by default.
+func WithEncryptedPrivate(encryptedPrivate bool) TargetStateOption {
+	return func(ts *TargetState) {
+		ts.EncryptedPrivate = encryptedPrivate
+	}
+}
+
+// WithEncryption sets the encryption used for encrypted files.
+func WithEncryption(encryption Encryption) TargetStateOption {
+	return func(ts *TargetState) {
+		ts.Encryption = encryption
+	}
+}
+
 // WithEntries sets the entries.
 func WithEntries(entries map[string]Entry) TargetStateOption {
 	return func(ts *TargetState) {
@@ -83,10 +190,11 @@ func WithEntries(entries map[string]Entry) TargetStateOption {
 	}
 }
 
-// WithGPG sets the GPG options.
-func WithGPG(gpg *GPG) TargetStateOption {
+// WithLargeFileSize sets the size above which the contents of plain files are
+// streamed.
+func WithLargeFileSize(largeFileSize int64) TargetStateOption {
 	return func(ts *TargetState) {
-		ts.GPG = gpg
+		ts.LargeFileSize = largeFileSize
 	}
 }
 
@@ -97,6 +205,43 @@ func WithMinVersion(minVersion *semver.Version) TargetStateOption {
 	}
 }
 
+// WithOwner sets Owner.
+func WithOwner(owner func(string) *Owner) TargetStateOption {
+	return func(ts *TargetState) {
+		ts.Owner = owner
+	}
+}
+
+// WithPathMap sets the path map, which maps logical target names to the
+// target names that they are deployed to.
+func WithPathMap(pathMap map[string]string) TargetStateOption {
+	return func(ts *TargetState) {
+		ts.PathMap = pathMap
+	}
+}
+
+// WithScopedDirRules sets the scoped directory rules.
+func WithScopedDirRules(scopedDirRules []ScopedDirRule) TargetStateOption {
+	return func(ts *TargetState) {
+		ts.ScopedDirRules = scopedDirRules
+	}
+}
+
+// WithScriptEnv sets the environment added to modify_ scripts.
+func WithScriptEnv(scriptEnv []string) TargetStateOption {
+	return func(ts *TargetState) {
+		ts.ScriptEnv = scriptEnv
+	}
+}
+
+// WithScriptTempDirs sets the directories in which modify_ scripts are written
+// before they are run, in order of preference.
+func WithScriptTempDirs(scriptTempDirs []string) TargetStateOption {
+	return func(ts *TargetState) {
+		ts.ScriptTempDirs = scriptTempDirs
+	}
+}
+
 // WithSourceDir sets the source directory.
 func WithSourceDir(sourceDir string) TargetStateOption {
 	return func(ts *TargetState) {
@@ -104,6 +249,13 @@ func WithSourceDir(sourceDir string) TargetStateOption {
 	}
 }
 
+// WithSourceDirs sets the source directories, in increasing order of priority.
+func WithSourceDirs(sourceDirs []string) TargetStateOption {
+	return func(ts *TargetState) {
+		ts.SourceDirs = sourceDirs
+	}
+}
+
 // WithTargetIgnore sets the target patterns to ignore.
 func WithTargetIgnore(targetIgnore *PatternSet) TargetStateOption {
 	return func(ts *TargetState) {
@@ -132,6 +284,13 @@ func WithTemplateFuncs(templateFuncs template.FuncMap) TargetStateOption {
 	}
 }
 
+// WithTemplateGlobs sets TemplateGlobs.
+func WithTemplateGlobs(templateGlobs []string) TargetStateOption {
+	return func(ts *TargetState) {
+		ts.TemplateGlobs = templateGlobs
+	}
+}
+
 // WithTemplateOptions sets the template functions.
 func WithTemplateOptions(templateOptions []string) TargetStateOption {
 	return func(ts *TargetState) {
@@ -156,10 +315,12 @@ func WithUmask(umask os.FileMode) TargetStateOption {
 // NewTargetState creates a new TargetState with the given options.
 func NewTargetState(options ...TargetStateOption) *TargetState {
 	ts := &TargetState{
+		Dependencies:    make(map[string][]string),
 		Entries:         make(map[string]Entry),
 		TargetIgnore:    NewPatternSet(),
 		TargetRemove:    NewPatternSet(),
 		TemplateOptions: DefaultTemplateOptions,
+		LargeFileSize:   DefaultLargeFileSize,
 	}
 	for _, o := range options {
 		o(ts)
@@ -180,6 +341,11 @@ func (ts *TargetState) Add(fs vfs.FS, addOptions AddOptions, targetPath string,
 	if err != nil {
 		return err
 	}
+	// Targets are added under their logical target names.
+	targetName, ok := ts.unmapTargetName(targetName)
+	if !ok {
+		return fmt.Errorf("%s: hidden by path map", targetPath)
+	}
 	if info == nil {
 		var err error
 		if follow {
@@ -197,6 +363,12 @@ func (ts *TargetState) Add(fs vfs.FS, addOptions AddOptions, targetPath string,
 		}
 	}
 
+	// Targets inside encrypted directories are added by updating the whole
+	// encrypted directory.
+	if encryptedDir := ts.encryptedDirOf(targetName); encryptedDir != nil {
+		return ts.Add(fs, AddOptions{Encrypt: true, Recursive: true}, filepath.Join(ts.DestDir, encryptedDir.targetName), nil, follow, mutator)
+	}
+
 	// Add the parent directories, if needed.
 	parentDirSourceName := ""
 	entries := ts.Entries
@@ -206,7 +378,13 @@ func (ts *TargetState) Add(fs vfs.FS, addOptions AddOptions, targetPath string,
 			return err
 		}
 		if parentEntry == nil {
-			if err := ts.Add(fs, addOptions, filepath.Join(ts.DestDir, parentDirName), nil, follow, mutator); err != nil {
+			// Parent directories are added implicitly with only the
+			// attributes of their on-disk state, not as exact directories,
+			// and without .keep files as they will contain targetPath.
+			parentAddOptions := AddOptions{
+				Recursive: true,
+			}
+			if err := ts.Add(fs, parentAddOptions, filepath.Join(ts.DestDir, ts.mapTargetName(parentDirName)), nil, follow, mutator); err != nil {
 				return err
 			}
 			parentEntry, err = ts.findEntry(parentDirName)
@@ -217,13 +395,23 @@ func (ts *TargetState) Add(fs vfs.FS, addOptions AddOptions, targetPath string,
 			return fmt.Errorf("%s: not a directory", parentDirName)
 		}
 		parentDir := parentEntry.(*Dir)
+		if parentDir.Empty {
+			return fmt.Errorf("%s: inside empty directory %s", targetPath, filepath.Join(ts.DestDir, parentDir.targetName))
+		}
 		parentDirSourceName = parentDir.sourceName
+		// If the parent directory is in another source directory then create
+		// it in this one.
+		if ts.EntrySourceDir(parentDir) != ts.SourceDir {
+			if err := vfs.MkdirAll(mutator, filepath.Join(ts.SourceDir, parentDirSourceName), 0o777&^ts.Umask); err != nil {
+				return err
+			}
+		}
 		entries = parentDir.Entries
 	}
 
 	switch {
 	case info.IsDir():
-		perm := info.Mode().Perm()
+		perm := info.Mode() & permMask
 		infos, err := fs.ReadDir(targetPath)
 		if err != nil {
 			return err
@@ -232,14 +420,21 @@ func (ts *TargetState) Add(fs vfs.FS, addOptions AddOptions, targetPath string,
 		if err != nil {
 			return err
 		}
-		if private {
+		existingDir, _ := entries[filepath.Base(targetName)].(*Dir)
+		encrypt := addOptions.Encrypt || existingDir != nil && existingDir.Encrypted
+		if private || encrypt && ts.EncryptedPrivate {
 			perm &^= 0o77
 		}
+		attributesPerm := ParseDirAttributes(DirAttributes{Perm: perm}.SourceName()).Perm
+		explicitPerm := ts.needsExplicitPerm(attributesPerm, perm)
+		if encrypt {
+			return ts.addEncryptedDir(fs, targetName, targetPath, entries, parentDirSourceName, addOptions.Exact, perm, explicitPerm, mutator)
+		}
 		// If the directory is empty, or the directory was not added
 		// recursively, add a .keep file so the directory is managed by git.
 		// chezmoi will ignore the .keep file as it begins with a dot.
 		createKeepFile := len(infos) == 0 || !addOptions.Recursive
-		return ts.addDir(targetName, entries, parentDirSourceName, addOptions.Exact, perm, createKeepFile, mutator)
+		return ts.addDir(targetName, entries, parentDirSourceName, addOptions.Exact, perm, explicitPerm, createKeepFile, mutator)
 	case info.Mode().IsRegular():
 		if info.Size() == 0 && !addOptions.Empty {
 			entry, err := ts.Get(fs, targetPath)
@@ -247,7 +442,7 @@ func (ts *TargetState) Add(fs vfs.FS, addOptions AddOptions, targetPath string,
 			case os.IsNotExist(err):
 				return nil
 			case err == nil:
-				return mutator.RemoveAll(filepath.Join(ts.SourceDir, entry.SourceName()))
+				return mutator.RemoveAll(ts.SourcePath(entry))
 			default:
 				return err
 			}
@@ -260,25 +455,35 @@ func (ts *TargetState) Add(fs vfs.FS, addOptions AddOptions, targetPath string,
 			contents = autoTemplate(contents, ts.TemplateData)
 		}
 		if addOptions.Encrypt {
-			contents, err = ts.GPG.Encrypt(targetPath, contents)
+			contents, err = ts.Encryption.Encrypt(contents)
 			if err != nil {
 				return err
 			}
 		}
-		perm := info.Mode().Perm()
+		perm := info.Mode() & permMask
 		private, err := IsPrivate(fs, targetPath, perm&0o77 == 0)
 		if err != nil {
 			return err
 		}
-		if private {
+		if private || addOptions.Encrypt && ts.EncryptedPrivate {
 			perm &^= 0o77
 		}
-		return ts.addFile(targetName, entries, parentDirSourceName, info, perm, addOptions.Encrypt, addOptions.Template, contents, mutator)
+		attributesPerm := ParseFileAttributes(FileAttributes{Mode: perm}.SourceName()).Mode
+		explicitPerm := ts.needsExplicitPerm(attributesPerm, perm)
+		if addOptions.NoSuffix && !addOptions.Template {
+			return fmt.Errorf("%s: only templates can be added without a suffix", targetPath)
+		}
+		return ts.addFile(targetName, entries, parentDirSourceName, info, perm, explicitPerm, addOptions.Create, addOptions.Encrypt, addOptions.Template, addOptions.NoSuffix, contents, mutator)
 	case info.Mode()&os.ModeType == os.ModeSymlink:
 		linkname, err := fs.Readlink(targetPath)
 		if err != nil {
 			return err
 		}
+		// If the symlink points to the target's file in the source state then
+		// the target is deployed as a symlink.
+		if entry, ok := entries[filepath.Base(targetName)]; ok && linkname == ts.SourcePath(entry) {
+			return ts.addLink(entry, mutator)
+		}
 		return ts.addSymlink(targetName, entries, parentDirSourceName, linkname, mutator)
 	default:
 		return fmt.Errorf("%s: not a regular file, directory, or symlink", targetName)
@@ -297,19 +502,33 @@ func (ts *TargetState) AllEntries() []Entry {
 // Apply ensures that ts.DestDir in fs matches ts.
 func (ts *TargetState) Apply(fs vfs.FS, mutator Mutator, follow bool, applyOptions *ApplyOptions) error {
 	if applyOptions.Remove {
-		// Build a set of targets to remove.
+		// Build a set of targets to remove. Patterns that do not match any
+		// targets are ignored.
 		targetsToRemove := make(map[string]struct{})
 		includes := make([]string, 0, len(ts.TargetRemove.includes))
 		for include := range ts.TargetRemove.includes {
 			includes = append(includes, include)
 		}
+		sort.Strings(includes)
 		for _, include := range includes {
 			matches, err := doublestar.GlobOS(fs, filepath.Join(ts.DestDir, include))
 			if err != nil {
 				return err
 			}
 			for _, match := range matches {
-				relPath := strings.TrimPrefix(match, ts.DestDir+string(filepath.Separator))
+				// Never remove anything outside the destination directory, or
+				// the destination directory itself.
+				relPath, err := filepath.Rel(ts.DestDir, match)
+				if err != nil || relPath == "." || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+					continue
+				}
+				// Globs follow symlinks to directories, so the match might
+				// really be outside the destination directory.
+				if throughSymlink, err := hasSymlinkedParent(fs, ts.DestDir, relPath); err != nil {
+					return err
+				} else if throughSymlink {
+					continue
+				}
 				// Don't remove targets that are ignored.
 				if ts.TargetIgnore.Match(relPath) {
 					continue
@@ -318,13 +537,16 @@ func (ts *TargetState) Apply(fs vfs.FS, mutator Mutator, follow bool, applyOptio
 				if !ts.TargetRemove.Match(relPath) {
 					continue
 				}
+				// Don't remove targets that are in the target state.
+				if logicalName, ok := ts.unmapTargetName(relPath); ok {
+					if _, err := ts.findEntry(logicalName); err == nil {
+						continue
+					}
+				}
 				targetsToRemove[match] = struct{}{}
 			}
 		}
 
-		// FIXME check that the set of targets to remove does not intersect wth
-		// the list of all entries.
-
 		// Remove targets in reverse order so we remove children before their
 		// parents.
 		sortedTargetsToRemove := make([]string, 0, len(targetsToRemove))
@@ -339,34 +561,64 @@ func (ts *TargetState) Apply(fs vfs.FS, mutator Mutator, follow bool, applyOptio
 		}
 	}
 
-	for _, entryName := range sortedEntryNames(ts.Entries) {
-		if err := ts.Entries[entryName].Apply(fs, mutator, follow, applyOptions); err != nil {
+	entryNames := sortedEntryNames(ts.Entries)
+	entries := make([]Entry, 0, len(entryNames))
+	for _, entryName := range entryNames {
+		entries = append(entries, ts.Entries[entryName])
+	}
+	return ts.ApplyEntries(entries, fs, mutator, follow, applyOptions)
+}
+
+// ApplyEntries applies entries, which must be in ts, with chezmoi.ApplyEntry,
+// except that the prerequisites declared in .chezmoidependencies are applied
+// before the entries that depend on them. Prerequisites that are not in or
+// inside entries are not applied. In verbose mode, the order in which entries
+// with dependencies are applied is written first.
+func (ts *TargetState) ApplyEntries(entries []Entry, fs vfs.FS, mutator Mutator, follow bool, applyOptions *ApplyOptions) error {
+	order := ts.newApplyOrder(entries)
+	if order == nil {
+		return ApplyEntries(entries, fs, mutator, follow, applyOptions)
+	}
+	if applyOptions.Verbose {
+		if err := order.writeOrder(applyOptions.Stdout, entries); err != nil {
 			return err
 		}
 	}
-	return nil
+	orderedApplyOptions := *applyOptions
+	orderedApplyOptions.order = order
+	return ApplyEntries(entries, fs, mutator, follow, &orderedApplyOptions)
 }
 
-// Archive writes ts to w.
-func (ts *TargetState) Archive(w *tar.Writer, umask os.FileMode) error {
+// ArchiveTAR writes ts to w as a tar archive.
+func (ts *TargetState) ArchiveTAR(w *tar.Writer, umask os.FileMode, encryptedMode EncryptedMode) error {
 	headerTemplate, err := ts.getTarHeaderTemplate()
 	if err != nil {
 		return err
 	}
+	return ts.archive(&tarArchiveWriter{
+		w:              w,
+		headerTemplate: headerTemplate,
+		owner:          ts.Owner,
+	}, umask, encryptedMode)
+}
 
-	for _, entryName := range sortedEntryNames(ts.Entries) {
-		if err := ts.Entries[entryName].archive(w, ts.TargetIgnore.Match, headerTemplate, umask); err != nil {
-			return err
-		}
+// ArchiveZIP writes ts to w as a zip archive.
+func (ts *TargetState) ArchiveZIP(w *zip.Writer, umask os.FileMode, encryptedMode EncryptedMode) error {
+	headerTemplate, err := ts.getTarHeaderTemplate()
+	if err != nil {
+		return err
 	}
-	return nil
+	return ts.archive(&zipArchiveWriter{
+		w:              w,
+		headerTemplate: headerTemplate,
+	}, umask, encryptedMode)
 }
 
 // ConcreteValue returns a value suitable for serialization.
-func (ts *TargetState) ConcreteValue(recursive bool) (interface{}, error) {
+func (ts *TargetState) ConcreteValue(encryptedMode EncryptedMode, recursive bool) (interface{}, error) {
 	var entryConcreteValues []interface{}
 	for _, entryName := range sortedEntryNames(ts.Entries) {
-		entryConcreteValue, err := ts.Entries[entryName].ConcreteValue(ts.TargetIgnore.Match, ts.SourceDir, ts.Umask, recursive)
+		entryConcreteValue, err := ts.Entries[entryName].ConcreteValue(ts.TargetIgnore.Match, ts.SourceDir, ts.Umask, encryptedMode, recursive)
 		if err != nil {
 			return nil, err
 		}
@@ -377,6 +629,14 @@ func (ts *TargetState) ConcreteValue(recursive bool) (interface{}, error) {
 	return entryConcreteValues, nil
 }
 
+// EntrySourceDir returns the source directory that contains entry.
+func (ts *TargetState) EntrySourceDir(entry Entry) string {
+	if sourceDir := entry.sourceDirectory(); sourceDir != "" {
+		return sourceDir
+	}
+	return ts.SourceDir
+}
+
 // Evaluate evaluates all of the entries in ts.
 func (ts *TargetState) Evaluate() error {
 	for _, entryName := range sortedEntryNames(ts.Entries) {
@@ -389,7 +649,34 @@ func (ts *TargetState) Evaluate() error {
 
 // ExecuteTemplateData returns the result of executing template data.
 func (ts *TargetState) ExecuteTemplateData(name string, data []byte) ([]byte, error) {
-	tmpl, err := template.New(name).Option(ts.TemplateOptions...).Funcs(ts.TemplateFuncs).Parse(string(data))
+	tmpl := template.New(name).Option(ts.TemplateOptions...).Funcs(ts.TemplateFuncs)
+	depth := 0
+	tmpl.Funcs(template.FuncMap{
+		includeTemplateFuncName: func(name string, args ...interface{}) (string, error) {
+			var data interface{}
+			switch len(args) {
+			case 0:
+				data = ts.TemplateData
+			case 1:
+				data = args[0]
+			default:
+				return "", fmt.Errorf("%s: expected 1 or 2 arguments, got %d", includeTemplateFuncName, len(args)+1)
+			}
+			if depth >= maxIncludeTemplateDepth {
+				return "", fmt.Errorf("%s: %s: maximum depth exceeded", includeTemplateFuncName, name)
+			}
+			depth++
+			defer func() {
+				depth--
+			}()
+			sb := &strings.Builder{}
+			if err := tmpl.ExecuteTemplate(sb, name, data); err != nil {
+				return "", err
+			}
+			return sb.String(), nil
+		},
+	})
+	tmpl, err := tmpl.Parse(string(data))
 	if err != nil {
 		return nil, err
 	}
@@ -406,6 +693,12 @@ func (ts *TargetState) ExecuteTemplateData(name string, data []byte) ([]byte, er
 	return []byte(sb.String()), nil
 }
 
+// Filter removes the entries for which include returns false from ts, as
+// described by FilterEntry.
+func (ts *TargetState) Filter(include func(Entry) bool) {
+	ts.Entries = FilterEntries(ts.Entries, include)
+}
+
 // Get returns the state of the given target, or nil if no such target is found.
 func (ts *TargetState) Get(fs vfs.Stater, target string) (Entry, error) {
 	contains, err := vfs.Contains(fs, target, ts.DestDir)
@@ -419,9 +712,30 @@ func (ts *TargetState) Get(fs vfs.Stater, target string) (Entry, error) {
 	if err != nil {
 		return nil, err
 	}
+	targetName, ok := ts.unmapTargetName(targetName)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
 	return ts.findEntry(targetName)
 }
 
+// Hash returns a hash of the source directories and template data of ts. Any
+// change to the source state or to the template data changes the hash.
+func (ts *TargetState) Hash(fs vfs.FS) ([]byte, error) {
+	h := sha256.New()
+	for _, sourceDir := range ts.sourceDirs() {
+		if err := hashSourceDir(h, fs, sourceDir); err != nil {
+			return nil, err
+		}
+	}
+	templateData, err := json.Marshal(ts.TemplateData)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = h.Write(templateData)
+	return h.Sum(nil), nil
+}
+
 // ImportTAR imports a tar archive.
 func (ts *TargetState) ImportTAR(r *tar.Reader, importTAROptions ImportTAROptions, mutator Mutator) error {
 	for {
@@ -444,148 +758,151 @@ func (ts *TargetState) ImportTAR(r *tar.Reader, importTAROptions ImportTAROption
 	return nil
 }
 
-// Populate walks fs from ts.SourceDir to populate ts.
+// Populate walks fs from each of ts's source directories in turn to populate
+// ts. Entries in later source directories override entries with the same target
+// name in earlier ones. Entries in scoped directories whose conditions are true
+// override all other entries, and scoped directories whose conditions are
+// false are ignored.
 func (ts *TargetState) Populate(fs vfs.FS, options *PopulateOptions) error {
-	return vfs.Walk(fs, ts.SourceDir, func(path string, info os.FileInfo, _ error) error {
-		relPath, err := filepath.Rel(ts.SourceDir, path)
-		if err != nil {
+	// Templates are added before anything else so that all templates,
+	// including ignore and remove files, can use them. Templates in later
+	// source directories override those with the same name in earlier ones.
+	for _, sourceDir := range ts.sourceDirs() {
+		if err := ts.addTemplatesDir(fs, filepath.Join(sourceDir, templatesDirName)); err != nil {
 			return err
 		}
-		if relPath == "." {
-			return nil
+	}
+	var scopedDirs []scopedDir
+	for i, sourceDir := range ts.sourceDirs() {
+		if err := ts.populateSourceDir(fs, sourceDir, "", options); err != nil {
+			return err
 		}
-		// Treat all files and directories beginning with "." specially.
-		if _, name := filepath.Split(relPath); strings.HasPrefix(name, ".") {
-			switch {
-			case info.Name() == ignoreName:
-				dns := dirNames(parseDirNameComponents(splitPathList(relPath)))
-				return ts.addPatterns(fs, ts.TargetIgnore, path, filepath.Join(dns...))
-			case info.Name() == removeName:
-				dns := dirNames(parseDirNameComponents(splitPathList(relPath)))
-				return ts.addPatterns(fs, ts.TargetRemove, path, filepath.Join(dns...))
-			case info.Name() == templatesDirName:
-				if err := ts.addTemplatesDir(fs, path); err != nil {
-					return err
-				}
-				return filepath.SkipDir
-			case info.Name() == versionName:
-				data, err := fs.ReadFile(path)
-				if err != nil {
-					return err
-				}
-				version, err := semver.NewVersion(strings.TrimSpace(string(data)))
-				if err != nil {
-					return err
-				}
-				if ts.MinVersion == nil || ts.MinVersion.LessThan(*version) {
-					ts.MinVersion = version
-				}
-				return nil
-			case info.IsDir():
-				// Don't recurse into ignored subdirectories.
-				return filepath.SkipDir
-			}
-			// Ignore all other files and directories.
-			return nil
+		sourceDirScopedDirs, err := ts.findScopedDirs(fs, sourceDir, "", i)
+		if err != nil {
+			return err
 		}
+		scopedDirs = append(scopedDirs, sourceDirScopedDirs...)
+	}
+	// Populate scoped directories in order of increasing priority, then
+	// depth, so that more specific scoped directories win, then source
+	// directory, then name, so that the result is deterministic.
+	sort.SliceStable(scopedDirs, func(i, j int) bool {
 		switch {
-		case info.IsDir():
-			components := splitPathList(relPath)
-			das := parseDirNameComponents(components)
-			dns := dirNames(das)
-			targetName := filepath.Join(dns...)
-			entries, err := ts.findEntries(dns[:len(dns)-1])
-			if err != nil {
-				return err
-			}
-			da := das[len(das)-1]
-			entries[da.Name] = newDir(relPath, targetName, da.Exact, da.Perm)
-		case info.Mode().IsRegular():
-			psfp := parseSourceFilePath(relPath)
-			dns := dirNames(psfp.dirAttributes)
-			entries, err := ts.findEntries(dns)
-			if err != nil {
-				return err
-			}
-			switch {
-			case psfp.fileAttributes != nil && psfp.fileAttributes.Mode&os.ModeType == 0 || psfp.scriptAttributes != nil:
-				readFile := func() ([]byte, error) {
-					return fs.ReadFile(path)
-				}
-				evaluateContents := readFile
-				if psfp.fileAttributes != nil && psfp.fileAttributes.Encrypted {
-					prevEvaluateContents := evaluateContents
-					evaluateContents = func() ([]byte, error) {
-						ciphertext, err := prevEvaluateContents()
-						if err != nil {
-							return nil, err
-						}
-						return ts.GPG.Decrypt(path, ciphertext)
-					}
-				}
-				if psfp.fileAttributes != nil && psfp.fileAttributes.Template || psfp.scriptAttributes != nil && psfp.scriptAttributes.Template {
-					if options == nil || options.ExecuteTemplates {
-						prevEvaluateContents := evaluateContents
-						evaluateContents = func() ([]byte, error) {
-							data, err := prevEvaluateContents()
-							if err != nil {
-								return nil, err
-							}
-							return ts.ExecuteTemplateData(path, data)
-						}
-					}
-				}
-				switch {
-				case psfp.fileAttributes != nil:
-					entry := &File{
-						sourceName:       relPath,
-						targetName:       filepath.Join(append(dns, psfp.fileAttributes.Name)...),
-						Empty:            psfp.fileAttributes.Empty,
-						Encrypted:        psfp.fileAttributes.Encrypted,
-						Perm:             psfp.fileAttributes.Mode.Perm(),
-						Template:         psfp.fileAttributes.Template,
-						evaluateContents: evaluateContents,
-					}
-					entries[psfp.fileAttributes.Name] = entry
-				case psfp.scriptAttributes != nil:
-					entry := &Script{
-						sourceName:       relPath,
-						targetName:       filepath.Join(append(dns, psfp.scriptAttributes.Name)...),
-						Once:             psfp.scriptAttributes.Once,
-						Template:         psfp.scriptAttributes.Template,
-						evaluateContents: evaluateContents,
-					}
-					entries[psfp.scriptAttributes.Name] = entry
-				}
-			case psfp.fileAttributes != nil && psfp.fileAttributes.Mode&os.ModeType == os.ModeSymlink:
-				evaluateLinkname := func() (string, error) {
-					data, err := fs.ReadFile(path)
-					return string(data), err
-				}
-				if psfp.fileAttributes.Template {
-					evaluateLinkname = func() (string, error) {
-						data, err := ts.executeTemplate(fs, path)
-						return string(data), err
-					}
-				}
-				entry := &Symlink{
-					sourceName:       relPath,
-					targetName:       filepath.Join(append(dns, psfp.fileAttributes.Name)...),
-					Template:         psfp.fileAttributes.Template,
-					evaluateLinkname: evaluateLinkname,
-				}
-				entries[psfp.fileAttributes.Name] = entry
-			default:
-				return fmt.Errorf("%s: unsupported file type", path)
-			}
+		case scopedDirs[i].priority != scopedDirs[j].priority:
+			return scopedDirs[i].priority < scopedDirs[j].priority
+		case scopedDirs[i].depth != scopedDirs[j].depth:
+			return scopedDirs[i].depth < scopedDirs[j].depth
+		case scopedDirs[i].sourceDirIndex != scopedDirs[j].sourceDirIndex:
+			return scopedDirs[i].sourceDirIndex < scopedDirs[j].sourceDirIndex
 		default:
-			return fmt.Errorf("%s: unsupported file type", path)
+			return scopedDirs[i].name < scopedDirs[j].name
+		}
+	})
+	for _, scopedDir := range scopedDirs {
+		if err := ts.populateSourceDir(fs, scopedDir.sourceDir, scopedDir.name, options); err != nil {
+			return err
 		}
+	}
+	// Entries inside empty directories may come from other source
+	// directories, so empty directories are checked once they are complete.
+	for _, entry := range ts.AllEntries() {
+		if dir, ok := entry.(*Dir); ok && dir.Empty && len(dir.Entries) != 0 {
+			return emptyDirContainsError(ts.SourcePath(dir), dir.TargetName(), sortedEntryNames(dir.Entries)[0])
+		}
+	}
+	if err := ts.checkDependencies(options); err != nil {
+		return err
+	}
+	return ts.applyPathMap(options)
+}
+
+// unmapTargetName returns the logical target name of targetName and whether
+// targetName is deployed at all. Target names under a logical target name that
+// is mapped elsewhere are not deployed.
+func (ts *TargetState) unmapTargetName(targetName string) (string, bool) {
+	if len(ts.PathMap) == 0 {
+		return targetName, true
+	}
+	inversePathMap := make(map[string]string, len(ts.PathMap))
+	for logicalName, mappedName := range ts.PathMap {
+		inversePathMap[mappedName] = logicalName
+	}
+	logicalName := replacePathPrefix(inversePathMap, targetName)
+	return logicalName, ts.mapTargetName(logicalName) == targetName
+}
+
+// ScopedDir returns the path of the scoped directory that entry was populated
+// from, relative to its source directory, or the empty string if entry is not
+// in a scoped directory.
+func (ts *TargetState) ScopedDir(entry Entry) string {
+	if len(ts.ScopedDirRules) == 0 {
+		return ""
+	}
+	components := strings.Split(filepath.ToSlash(entry.SourceName()), "/")
+	n := 0
+	for n < len(components)-1 && ts.scopedDirRule(components[n]) != nil {
+		n++
+	}
+	return filepath.Join(components[:n]...)
+}
+
+// SourcePath returns the path of entry in the source state.
+func (ts *TargetState) SourcePath(entry Entry) string {
+	return sourcePath(entry, ts.SourceDir)
+}
+
+// applyPathMap sets the target names of all entries in ts to their mapped
+// target names. It is an error for two entries to have the same mapped target
+// name. Ignore patterns continue to match logical target names.
+func (ts *TargetState) applyPathMap(options *PopulateOptions) error {
+	if len(ts.PathMap) == 0 {
 		return nil
+	}
+	allEntries := ts.AllEntries()
+	sort.Slice(allEntries, func(i, j int) bool {
+		return allEntries[i].SourceName() < allEntries[j].SourceName()
 	})
+	entriesByTargetName := make(map[string]Entry, len(allEntries))
+	for _, entry := range allEntries {
+		targetName := ts.mapTargetName(entry.TargetName())
+		if otherEntry, ok := entriesByTargetName[targetName]; ok {
+			err := fmt.Errorf("%s: target of both %s and %s", targetName, otherEntry.SourceName(), entry.SourceName())
+			if options == nil || options.ReportError == nil {
+				return err
+			}
+			options.ReportError(filepath.Join(ts.EntrySourceDir(entry), entry.SourceName()), 0, err)
+			continue
+		}
+		entriesByTargetName[targetName] = entry
+		switch entry := entry.(type) {
+		case *Dir:
+			entry.targetName = targetName
+		case *File:
+			entry.targetName = targetName
+		case *Script:
+			entry.targetName = targetName
+		case *Symlink:
+			entry.targetName = targetName
+		}
+	}
+	ts.TargetIgnore.unmap = func(targetName string) string {
+		logicalName, _ := ts.unmapTargetName(targetName)
+		return logicalName
+	}
+	return nil
+}
+
+// archive writes ts to w.
+func (ts *TargetState) archive(w archiveWriter, umask os.FileMode, encryptedMode EncryptedMode) error {
+	for _, entryName := range sortedEntryNames(ts.Entries) {
+		if err := ts.Entries[entryName].archive(w, ts.TargetIgnore.Match, umask, encryptedMode); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (ts *TargetState) addDir(targetName string, entries map[string]Entry, parentDirSourceName string, exact bool, perm os.FileMode, createKeepFile bool, mutator Mutator) error {
+func (ts *TargetState) addDir(targetName string, entries map[string]Entry, parentDirSourceName string, exact bool, perm os.FileMode, explicitPerm, createKeepFile bool, mutator Mutator) error {
 	name := filepath.Base(targetName)
 	if entry, ok := entries[name]; ok {
 		if _, ok = entry.(*Dir); !ok {
@@ -594,14 +911,19 @@ func (ts *TargetState) addDir(targetName string, entries map[string]Entry, paren
 		return nil
 	}
 	sourceName := DirAttributes{
-		Name:  name,
-		Exact: exact,
-		Perm:  perm,
+		Name:         name,
+		Exact:        exact,
+		ExplicitPerm: explicitPerm,
+		Perm:         perm,
 	}.SourceName()
+	if err := checkRepresentableName(targetName, name, sourceName, ParseDirAttributes(sourceName).Name); err != nil {
+		return err
+	}
 	if parentDirSourceName != "" {
 		sourceName = filepath.Join(parentDirSourceName, sourceName)
 	}
-	dir := newDir(sourceName, targetName, exact, perm)
+	dir := newDir(sourceName, ts.mapTargetName(targetName), exact, perm)
+	dir.ExplicitPerm = explicitPerm
 	if err := mutator.Mkdir(filepath.Join(ts.SourceDir, sourceName), 0o777&^ts.Umask); err != nil {
 		return err
 	}
@@ -614,11 +936,13 @@ func (ts *TargetState) addDir(targetName string, entries map[string]Entry, paren
 	return nil
 }
 
-func (ts *TargetState) addFile(targetName string, entries map[string]Entry, parentDirSourceName string, info os.FileInfo, perm os.FileMode, encrypted, template bool, contents []byte, mutator Mutator) error {
+func (ts *TargetState) addFile(targetName string, entries map[string]Entry, parentDirSourceName string, info os.FileInfo, perm os.FileMode, explicitPerm, create, encrypted, template, noSuffix bool, contents []byte, mutator Mutator) error {
 	name := filepath.Base(targetName)
 	var existingFile *File
 	var existingContents []byte
-	if entry, ok := entries[name]; ok {
+	// Entries in other source directories are overridden rather than
+	// replaced.
+	if entry, ok := entries[name]; ok && ts.EntrySourceDir(entry) == ts.SourceDir {
 		existingFile, ok = entry.(*File)
 		if !ok {
 			return fmt.Errorf("%s: already added and not a regular file", targetName)
@@ -632,23 +956,33 @@ func (ts *TargetState) addFile(targetName string, entries map[string]Entry, pare
 
 	empty := info.Size() == 0
 	sourceName := FileAttributes{
-		Name:      name,
-		Mode:      perm,
-		Empty:     empty,
-		Encrypted: encrypted,
-		Template:  template,
+		Name:         name,
+		Mode:         perm,
+		Create:       create,
+		Empty:        empty,
+		Encrypted:    encrypted,
+		ExplicitPerm: explicitPerm,
+		Template:     template && !noSuffix,
 	}.SourceName()
+	if err := checkRepresentableName(targetName, name, sourceName, ParseFileAttributes(sourceName).Name); err != nil {
+		return err
+	}
 	if parentDirSourceName != "" {
 		sourceName = filepath.Join(parentDirSourceName, sourceName)
 	}
+	if noSuffix && !ts.matchTemplateGlob(sourceName) {
+		return fmt.Errorf("%s: source name %s does not match any template glob", targetName, sourceName)
+	}
 	file := &File{
-		sourceName: sourceName,
-		targetName: targetName,
-		Empty:      empty,
-		Encrypted:  encrypted,
-		Perm:       perm,
-		Template:   template,
-		contents:   contents,
+		sourceName:   sourceName,
+		targetName:   ts.mapTargetName(targetName),
+		Create:       create,
+		Empty:        empty,
+		Encrypted:    encrypted,
+		ExplicitPerm: explicitPerm,
+		Perm:         perm,
+		Template:     template,
+		contents:     contents,
 	}
 	if existingFile != nil {
 		if bytes.Equal(existingFile.contents, file.contents) {
@@ -665,14 +999,30 @@ func (ts *TargetState) addFile(targetName string, entries map[string]Entry, pare
 	return mutator.WriteFile(filepath.Join(ts.SourceDir, sourceName), contents, 0o666&^ts.Umask, existingContents)
 }
 
-func (ts *TargetState) addPatterns(fs vfs.FS, ps *PatternSet, path, relPath string) error {
+// addLink records that entry is deployed as a symlink to its file in the source
+// state.
+func (ts *TargetState) addLink(entry Entry, mutator Mutator) error {
+	dir, base := filepath.Split(entry.SourceName())
+	fa := ParseFileAttributes(base)
+	if fa.Link {
+		return nil
+	}
+	if _, ok := entry.(*File); !ok || fa.Create || fa.Encrypted || fa.Template {
+		return fmt.Errorf("%s: cannot be linked", entry.TargetName())
+	}
+	fa.Link = true
+	sourceDir := ts.EntrySourceDir(entry)
+	return mutator.Rename(filepath.Join(sourceDir, entry.SourceName()), filepath.Join(sourceDir, dir, fa.SourceName()))
+}
+
+func (ts *TargetState) addPatterns(fs vfs.FS, ps *PatternSet, path, relPath string, options *PopulateOptions) error {
 	data, err := ts.executeTemplate(fs, path)
 	if err != nil {
 		return err
 	}
 	dir := filepath.Dir(relPath)
 	s := bufio.NewScanner(bytes.NewReader(data))
-	for s.Scan() {
+	for line := 1; s.Scan(); line++ {
 		text := s.Text()
 		if index := strings.IndexRune(text, '#'); index != -1 {
 			text = text[:index]
@@ -687,6 +1037,11 @@ func (ts *TargetState) addPatterns(fs vfs.FS, ps *PatternSet, path, relPath stri
 			text = strings.TrimPrefix(text, "!")
 		}
 		pattern := filepath.Join(dir, text)
+		if options != nil && options.ReportError != nil {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				options.ReportError(path, line, fmt.Errorf("%s: %w", text, err))
+			}
+		}
 		if err := ps.Add(pattern, include); err != nil {
 			return fmt.Errorf("%s: %w", path, err)
 		}
@@ -701,7 +1056,7 @@ func (ts *TargetState) addSymlink(targetName string, entries map[string]Entry, p
 	name := filepath.Base(targetName)
 	var existingSymlink *Symlink
 	var existingLinkname string
-	if entry, ok := entries[name]; ok {
+	if entry, ok := entries[name]; ok && ts.EntrySourceDir(entry) == ts.SourceDir {
 		existingSymlink, ok = entry.(*Symlink)
 		if !ok {
 			return fmt.Errorf("%s: already added and not a symlink", targetName)
@@ -716,12 +1071,15 @@ func (ts *TargetState) addSymlink(targetName string, entries map[string]Entry, p
 		Name: name,
 		Mode: os.ModeSymlink,
 	}.SourceName()
+	if err := checkRepresentableName(targetName, name, sourceName, ParseFileAttributes(sourceName).Name); err != nil {
+		return err
+	}
 	if parentDirSourceName != "" {
 		sourceName = filepath.Join(parentDirSourceName, sourceName)
 	}
 	symlink := &Symlink{
 		sourceName: sourceName,
-		targetName: targetName,
+		targetName: ts.mapTargetName(targetName),
 		linkname:   linkname,
 	}
 	if existingSymlink != nil {
@@ -739,8 +1097,21 @@ func (ts *TargetState) addSymlink(targetName string, entries map[string]Entry, p
 	return mutator.WriteFile(filepath.Join(ts.SourceDir, symlink.sourceName), []byte(symlink.linkname), 0o666&^ts.Umask, []byte(existingLinkname))
 }
 
+// addTemplatesDir adds the templates in the .chezmoitemplates directory at path,
+// if it exists, named by their paths relative to it.
 func (ts *TargetState) addTemplatesDir(fs vfs.FS, path string) error {
+	if _, err := fs.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
 	prefix := filepath.ToSlash(path) + "/"
+	// Templates are parsed with the template functions so that they can use
+	// them, but only their parse trees are kept, as the functions are added
+	// when they are executed.
+	parseFuncs := template.FuncMap{
+		includeTemplateFuncName: func(string, ...interface{}) (string, error) {
+			return "", nil
+		},
+	}
 	return vfs.Walk(fs, path, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -752,7 +1123,11 @@ func (ts *TargetState) addTemplatesDir(fs vfs.FS, path string) error {
 				return err
 			}
 			name := strings.TrimPrefix(filepath.ToSlash(path), prefix)
-			tmpl, err := template.New(name).Parse(string(contents))
+			parsedTmpl, err := template.New(name).Funcs(ts.TemplateFuncs).Funcs(parseFuncs).Parse(string(contents))
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			tmpl, err := template.New(name).AddParseTree(name, parsedTmpl.Tree)
 			if err != nil {
 				return err
 			}
@@ -818,6 +1193,9 @@ func (ts *TargetState) importHeader(r io.Reader, importTAROptions ImportTAROptio
 	if err != nil {
 		return err
 	}
+	if targetName == ".." || strings.HasPrefix(targetName, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s: outside target directory %s", targetPath, ts.DestDir)
+	}
 	parentDirSourceName := ""
 	entries := ts.Entries
 	if parentDirName := filepath.Dir(targetName); parentDirName != "." {
@@ -836,14 +1214,14 @@ func (ts *TargetState) importHeader(r io.Reader, importTAROptions ImportTAROptio
 	case tar.TypeDir:
 		perm := os.FileMode(header.Mode).Perm()
 		createKeepFile := false // FIXME don't assume that we don't need a keep file
-		return ts.addDir(targetName, entries, parentDirSourceName, importTAROptions.Exact, perm, createKeepFile, mutator)
+		return ts.addDir(targetName, entries, parentDirSourceName, importTAROptions.Exact, perm, false, createKeepFile, mutator)
 	case tar.TypeReg:
 		info := header.FileInfo()
 		contents, err := ioutil.ReadAll(r)
 		if err != nil {
 			return err
 		}
-		return ts.addFile(targetName, entries, parentDirSourceName, info, info.Mode().Perm(), false, false, contents, mutator)
+		return ts.addFile(targetName, entries, parentDirSourceName, info, info.Mode().Perm(), false, false, false, false, false, contents, mutator)
 	case tar.TypeSymlink:
 		linkname := header.Linkname
 		return ts.addSymlink(targetName, entries, parentDirSourceName, linkname, mutator)
@@ -851,3 +1229,581 @@ func (ts *TargetState) importHeader(r io.Reader, importTAROptions ImportTAROptio
 		return fmt.Errorf("%s: unspported typeflag '%c'", header.Name, header.Typeflag)
 	}
 }
+
+// mapTargetName returns the target name that the logical target name
+// targetName is deployed to.
+func (ts *TargetState) mapTargetName(targetName string) string {
+	return replacePathPrefix(ts.PathMap, targetName)
+}
+
+// matchTemplateGlob returns if sourceName, relative to the source directory,
+// matches any of ts's template globs.
+func (ts *TargetState) matchTemplateGlob(sourceName string) bool {
+	for _, templateGlob := range ts.TemplateGlobs {
+		if ok, _ := doublestar.PathMatch(templateGlob, sourceName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (ts *TargetState) populateSourceDir(fs vfs.FS, sourceDir, scopeDir string, options *PopulateOptions) error {
+	// Only entries from source directories other than ts.SourceDir record
+	// their source directory.
+	entrySourceDir := ""
+	if sourceDir != ts.SourceDir {
+		entrySourceDir = sourceDir
+	}
+	// Entries in a scoped directory are populated as if the scoped directory
+	// was the root of the source directory, but their source names include
+	// the scoped directory.
+	rootDir := filepath.Join(sourceDir, scopeDir)
+	walkFunc := func(path string, info os.FileInfo) error {
+		relPath, err := filepath.Rel(rootDir, path)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+		sourceName := filepath.Join(scopeDir, relPath)
+		// Treat all files and directories beginning with "." specially.
+		if _, name := filepath.Split(relPath); strings.HasPrefix(name, ".") {
+			switch {
+			case info.Name() == ignoreName:
+				dns := dirNames(parseDirNameComponents(splitPathList(relPath)))
+				return ts.addPatterns(fs, ts.TargetIgnore, path, filepath.Join(dns...), options)
+			case info.Name() == removeName:
+				dns := dirNames(parseDirNameComponents(splitPathList(relPath)))
+				return ts.addPatterns(fs, ts.TargetRemove, path, filepath.Join(dns...), options)
+			case info.Name() == dependenciesName:
+				dns := dirNames(parseDirNameComponents(splitPathList(relPath)))
+				return ts.addDependencies(fs, path, filepath.Join(dns...), options)
+			case info.Name() == versionName:
+				data, err := fs.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				version, err := semver.NewVersion(strings.TrimSpace(string(data)))
+				if err != nil {
+					return err
+				}
+				if ts.MinVersion == nil || ts.MinVersion.LessThan(*version) {
+					ts.MinVersion = version
+				}
+				return nil
+			case info.IsDir():
+				// Don't recurse into ignored subdirectories.
+				return filepath.SkipDir
+			}
+			// Ignore all other files and directories.
+			return nil
+		}
+		switch {
+		case info.IsDir() && relPath == info.Name() && ts.scopedDirRule(info.Name()) != nil:
+			// Scoped directories are populated separately, if at all.
+			return filepath.SkipDir
+		case info.IsDir():
+			components := splitPathList(relPath)
+			das := parseDirNameComponents(components)
+			dns := dirNames(das)
+			targetName := filepath.Join(dns...)
+			if !options.includeTargetName(targetName) {
+				return filepath.SkipDir
+			}
+			entries, err := ts.findEntries(dns[:len(dns)-1])
+			if err != nil {
+				return err
+			}
+			da := das[len(das)-1]
+			if err := checkCanonicalSourceName(info.Name(), da.SourceName()); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			ts.reportNewEntryProblems(entries, path, da.Name, entrySourceDir, scopeDir, options)
+			if da.Concat {
+				if err := checkNotReplacingDir(entries, da.Name, path); err != nil {
+					return err
+				}
+				file, err := ts.newConcatFile(fs, path, sourceName, targetName, relPath, da, options)
+				if err != nil {
+					return err
+				}
+				file.sourceDir = entrySourceDir
+				entries[da.Name] = file
+				return filepath.SkipDir
+			}
+			if da.Empty {
+				if da.Encrypted {
+					return fmt.Errorf("%s: encrypted directories cannot be empty", path)
+				}
+				if err := checkEmptySourceDir(fs, path, targetName); err != nil {
+					return err
+				}
+			}
+			// Encrypted directories are populated from their bundle, and
+			// replace any directory in an earlier source directory.
+			if da.Encrypted {
+				dir, err := ts.newEncryptedDir(fs, path, sourceName, targetName, entrySourceDir, da, options != nil && options.NoDecrypt)
+				if err != nil {
+					return err
+				}
+				entries[da.Name] = dir
+				return filepath.SkipDir
+			}
+			// If the directory already exists in an earlier source directory
+			// then keep its entries but take its attributes from this one.
+			if dir, ok := entries[da.Name].(*Dir); ok {
+				dir.sourceDir = entrySourceDir
+				dir.sourceName = sourceName
+				dir.Empty = da.Empty
+				dir.Exact = da.Exact || da.Empty
+				dir.ExplicitPerm = da.ExplicitPerm
+				dir.Perm = da.Perm
+				return nil
+			}
+			dir := newDir(sourceName, targetName, da.Exact || da.Empty, da.Perm)
+			dir.sourceDir = entrySourceDir
+			dir.Empty = da.Empty
+			dir.ExplicitPerm = da.ExplicitPerm
+			entries[da.Name] = dir
+		case info.Mode().IsRegular():
+			psfp := parseSourceFilePath(relPath)
+			dns := dirNames(psfp.dirAttributes)
+			if !options.includeTargetName(filepath.Join(filepath.Join(dns...), psfp.name())) {
+				return nil
+			}
+			entries, err := ts.findEntries(dns)
+			if err != nil {
+				return err
+			}
+			canonicalSourceName := ""
+			if psfp.scriptAttributes != nil {
+				canonicalSourceName = psfp.scriptAttributes.SourceName()
+			} else {
+				canonicalSourceName = psfp.fileAttributes.SourceName()
+			}
+			if err := checkCanonicalSourceName(info.Name(), canonicalSourceName); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			ts.reportNewEntryProblems(entries, path, psfp.name(), entrySourceDir, scopeDir, options)
+			if err := checkNotReplacingDir(entries, psfp.name(), path); err != nil {
+				return err
+			}
+			// Files matching a template glob are templates even without the
+			// .tmpl suffix.
+			if len(ts.TemplateGlobs) != 0 && ts.matchTemplateGlob(relPath) {
+				switch {
+				case psfp.fileAttributes != nil && !psfp.fileAttributes.Link:
+					psfp.fileAttributes.Template = true
+				case psfp.scriptAttributes != nil:
+					psfp.scriptAttributes.Template = true
+				}
+			}
+			if options != nil && options.Symlink && psfp.fileAttributes != nil && isLinkable(*psfp.fileAttributes, info) {
+				psfp.fileAttributes.Link = true
+			}
+			switch {
+			case psfp.fileAttributes != nil && psfp.fileAttributes.Link:
+				// Files with the link_ attribute are deployed as symlinks to
+				// the file in the source directory, so their contents must be
+				// used as-is.
+				if psfp.fileAttributes.Encrypted || psfp.fileAttributes.Template {
+					return fmt.Errorf("%s: encrypted files and templates cannot be linked", path)
+				}
+				if psfp.fileAttributes.Create {
+					return fmt.Errorf("%s: files with the create_ attribute cannot be linked", path)
+				}
+				if psfp.fileAttributes.Modify {
+					return fmt.Errorf("%s: modify_ scripts cannot be linked", path)
+				}
+				entry := &Symlink{
+					sourceDir:  entrySourceDir,
+					sourceName: sourceName,
+					targetName: filepath.Join(append(dns, psfp.fileAttributes.Name)...),
+					evaluateLinkname: func() (string, error) {
+						return path, nil
+					},
+				}
+				entries[psfp.fileAttributes.Name] = entry
+			case psfp.fileAttributes != nil && psfp.fileAttributes.Mode&os.ModeType == 0 || psfp.scriptAttributes != nil:
+				encrypted := psfp.fileAttributes != nil && psfp.fileAttributes.Encrypted
+				templated := psfp.fileAttributes != nil && psfp.fileAttributes.Template || psfp.scriptAttributes != nil && psfp.scriptAttributes.Template
+				evaluateContents := ts.newEvaluateContents(fs, path, encrypted, templated, options)
+				var evaluateCiphertext func() ([]byte, error)
+				if encrypted {
+					evaluateCiphertext = func() ([]byte, error) {
+						return fs.ReadFile(path)
+					}
+				}
+				switch {
+				case psfp.fileAttributes != nil:
+					perm := psfp.fileAttributes.Mode & permMask
+					// Encrypted files contain secrets, so make them private
+					// even if the private_ attribute is missing, unless their
+					// permissions are set explicitly.
+					if psfp.fileAttributes.Encrypted && ts.EncryptedPrivate && !psfp.fileAttributes.ExplicitPerm {
+						perm &^= 0o77
+					}
+					entry := &File{
+						sourceDir:          entrySourceDir,
+						sourceName:         sourceName,
+						targetName:         filepath.Join(append(dns, psfp.fileAttributes.Name)...),
+						Create:             psfp.fileAttributes.Create,
+						Empty:              psfp.fileAttributes.Empty,
+						Encrypted:          psfp.fileAttributes.Encrypted,
+						ExplicitPerm:       psfp.fileAttributes.ExplicitPerm,
+						Perm:               perm,
+						Template:           psfp.fileAttributes.Template,
+						Modify:             psfp.fileAttributes.Modify,
+						evaluateCiphertext: evaluateCiphertext,
+						evaluateContents:   evaluateContents,
+					}
+					if entry.Modify && (options == nil || options.ExecuteTemplates) {
+						entry.evaluateContents = ts.newEvaluateModifiedContents(fs, entry, evaluateContents)
+					}
+					if !encrypted && !templated && !entry.Modify && ts.LargeFileSize != 0 && info.Size() > ts.LargeFileSize {
+						entry.openContents = func() (io.ReadCloser, error) {
+							return fs.Open(path)
+						}
+						entry.size = info.Size()
+					}
+					entries[psfp.fileAttributes.Name] = entry
+				case psfp.scriptAttributes != nil:
+					entry := &Script{
+						sourceDir:        entrySourceDir,
+						sourceName:       sourceName,
+						targetName:       filepath.Join(append(dns, psfp.scriptAttributes.Name)...),
+						Once:             psfp.scriptAttributes.Once,
+						Before:           psfp.scriptAttributes.Before,
+						After:            psfp.scriptAttributes.After,
+						Template:         psfp.scriptAttributes.Template,
+						evaluateContents: evaluateContents,
+					}
+					entries[psfp.scriptAttributes.Name] = entry
+				}
+			case psfp.fileAttributes != nil && psfp.fileAttributes.Mode&os.ModeType == os.ModeSymlink:
+				evaluateLinkname := func() (string, error) {
+					data, err := fs.ReadFile(path)
+					return string(data), err
+				}
+				if psfp.fileAttributes.Template {
+					evaluateLinkname = func() (string, error) {
+						data, err := ts.executeTemplate(fs, path)
+						return string(data), err
+					}
+				}
+				entry := &Symlink{
+					sourceDir:        entrySourceDir,
+					sourceName:       sourceName,
+					targetName:       filepath.Join(append(dns, psfp.fileAttributes.Name)...),
+					Template:         psfp.fileAttributes.Template,
+					evaluateLinkname: evaluateLinkname,
+				}
+				entries[psfp.fileAttributes.Name] = entry
+			default:
+				return fmt.Errorf("%s: unsupported file type", path)
+			}
+		default:
+			return fmt.Errorf("%s: unsupported file type", path)
+		}
+		return nil
+	}
+	// vfs.Walk ignores errors returned for directories, so they are recorded
+	// and returned separately.
+	var dirErr error
+	if err := vfs.Walk(fs, rootDir, func(path string, info os.FileInfo, _ error) error {
+		if dirErr != nil {
+			return dirErr
+		}
+		err := walkFunc(path, info)
+		if err == nil || err == filepath.SkipDir {
+			return err
+		}
+		if options == nil || options.ReportError == nil {
+			if info.IsDir() {
+				dirErr = err
+			}
+			return err
+		}
+		options.ReportError(path, 0, err)
+		// Entries in a directory with problems cannot be populated.
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	return dirErr
+}
+
+// newConcatFile returns a new file whose contents are the concatenation of the
+// contents of the fragments in the directory at path, in lexical order of
+// their source names. Each fragment may be encrypted or a template. The file's
+// permissions are taken from the directory's attributes.
+func (ts *TargetState) newConcatFile(fs vfs.FS, path, sourceName, targetName, relPath string, da DirAttributes, options *PopulateOptions) (*File, error) {
+	if da.Exact {
+		return nil, fmt.Errorf("%s: concatenated directories cannot be exact", path)
+	}
+	if da.Encrypted {
+		return nil, fmt.Errorf("%s: concatenated directories cannot be encrypted, encrypt their fragments instead", path)
+	}
+	if da.Empty {
+		return nil, fmt.Errorf("%s: concatenated directories cannot be empty", path)
+	}
+	infos, err := fs.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+	var fragments []func() ([]byte, error)
+	encrypted := false
+	for _, info := range infos {
+		// Fragments beginning with a . are ignored, like other source files.
+		if strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		fragmentPath := filepath.Join(path, info.Name())
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("%s: unsupported file type", fragmentPath)
+		}
+		fa := ParseFileAttributes(info.Name())
+		if fa.Link || fa.Mode&os.ModeType != 0 {
+			return nil, fmt.Errorf("%s: fragments cannot be symlinks", fragmentPath)
+		}
+		templated := fa.Template || len(ts.TemplateGlobs) != 0 && ts.matchTemplateGlob(filepath.Join(relPath, info.Name()))
+		fragments = append(fragments, ts.newEvaluateContents(fs, fragmentPath, fa.Encrypted, templated, options))
+		encrypted = encrypted || fa.Encrypted
+	}
+
+	perm := os.FileMode(0o666)
+	switch {
+	case da.ExplicitPerm:
+		perm = da.Perm
+	case da.Perm&0o77 == 0:
+		perm = 0o600
+	case encrypted && ts.EncryptedPrivate:
+		// As for encrypted files, fragments that are encrypted contain secrets.
+		perm = 0o600
+	}
+	return &File{
+		sourceName:   sourceName,
+		targetName:   targetName,
+		Encrypted:    encrypted,
+		ExplicitPerm: da.ExplicitPerm,
+		Perm:         perm,
+		evaluateContents: func() ([]byte, error) {
+			contents := &bytes.Buffer{}
+			for _, fragment := range fragments {
+				data, err := fragment()
+				if err != nil {
+					return nil, err
+				}
+				contents.Write(data)
+			}
+			return contents.Bytes(), nil
+		},
+	}, nil
+}
+
+// newEvaluateContents returns a function that returns the contents of the
+// source file at path, decrypting it if encrypted is true and executing it as a
+// template if template is true and options allow it.
+func (ts *TargetState) newEvaluateContents(fs vfs.FS, path string, encrypted, templated bool, options *PopulateOptions) func() ([]byte, error) {
+	evaluateContents := func() ([]byte, error) {
+		return fs.ReadFile(path)
+	}
+	if encrypted {
+		prevEvaluateContents := evaluateContents
+		evaluateContents = func() ([]byte, error) {
+			ciphertext, err := prevEvaluateContents()
+			if err != nil {
+				return nil, err
+			}
+			plaintext, err := ts.Encryption.Decrypt(ciphertext)
+			if err != nil {
+				return nil, &DecryptionError{Path: path, Err: err}
+			}
+			return plaintext, nil
+		}
+	}
+	if templated && (options == nil || options.ExecuteTemplates) {
+		prevEvaluateContents := evaluateContents
+		evaluateContents = func() ([]byte, error) {
+			data, err := prevEvaluateContents()
+			if err != nil {
+				return nil, err
+			}
+			return ts.ExecuteTemplateData(path, data)
+		}
+	}
+	return evaluateContents
+}
+
+// reportNewEntryProblems reports, if options.ReportError is set, problems with
+// an entry called name populated from path: names that start with an attribute
+// prefix, and names that conflict with an entry already populated from the
+// same source directory and scoped directory, which the new entry silently
+// replaces.
+func (ts *TargetState) reportNewEntryProblems(entries map[string]Entry, path, name, entrySourceDir, scopeDir string, options *PopulateOptions) {
+	if options == nil || options.ReportError == nil {
+		return
+	}
+	if prefix := attributePrefix(name); prefix != "" {
+		options.ReportError(path, 0, fmt.Errorf("target name %s starts with %s, check the order of attributes", name, prefix))
+	}
+	if entry, ok := entries[name]; ok && entry.sourceDirectory() == entrySourceDir && ts.ScopedDir(entry) == scopeDir {
+		options.ReportError(path, 0, fmt.Errorf("same target as %s", entry.SourceName()))
+	}
+}
+
+// findScopedDirs returns the subdirectories of scopeDir in sourceDir, and
+// recursively their subdirectories, that match a scoped directory rule whose
+// condition is true.
+func (ts *TargetState) findScopedDirs(fs vfs.FS, sourceDir, scopeDir string, sourceDirIndex int) ([]scopedDir, error) {
+	if len(ts.ScopedDirRules) == 0 {
+		return nil, nil
+	}
+	infos, err := fs.ReadDir(filepath.Join(sourceDir, scopeDir))
+	switch {
+	case os.IsNotExist(err):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	var scopedDirs []scopedDir
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		rule := ts.scopedDirRule(info.Name())
+		if rule == nil {
+			continue
+		}
+		name := filepath.Join(scopeDir, info.Name())
+		ok, err := ts.evaluateScopedDirCondition(rule, info.Name())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Join(sourceDir, name), err)
+		}
+		if !ok {
+			continue
+		}
+		scopedDirs = append(scopedDirs, scopedDir{
+			sourceDir:      sourceDir,
+			sourceDirIndex: sourceDirIndex,
+			name:           name,
+			depth:          len(splitPathList(name)),
+			priority:       rule.Priority,
+		})
+		nestedScopedDirs, err := ts.findScopedDirs(fs, sourceDir, name, sourceDirIndex)
+		if err != nil {
+			return nil, err
+		}
+		scopedDirs = append(scopedDirs, nestedScopedDirs...)
+	}
+	return scopedDirs, nil
+}
+
+// scopedDirRule returns the first scoped directory rule whose pattern matches
+// name, or nil if there is none.
+func (ts *TargetState) scopedDirRule(name string) *ScopedDirRule {
+	for i := range ts.ScopedDirRules {
+		if ok, err := doublestar.Match(ts.ScopedDirRules[i].Pattern, name); err == nil && ok {
+			return &ts.ScopedDirRules[i]
+		}
+	}
+	return nil
+}
+
+// evaluateScopedDirCondition executes rule's condition for the scoped
+// directory name and returns its result.
+func (ts *TargetState) evaluateScopedDirCondition(rule *ScopedDirRule, name string) (bool, error) {
+	data := make(map[string]interface{}, len(ts.TemplateData)+1)
+	for key, value := range ts.TemplateData {
+		data[key] = value
+	}
+	data["scopedDir"] = name
+	tmpl, err := template.New(name).Option(ts.TemplateOptions...).Funcs(ts.TemplateFuncs).Parse(rule.Condition)
+	if err != nil {
+		return false, err
+	}
+	sb := &strings.Builder{}
+	if err := tmpl.Execute(sb, data); err != nil {
+		return false, err
+	}
+	output := strings.TrimSpace(sb.String())
+	if output == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(output)
+}
+
+// sourceDirs returns ts's source directories, in increasing order of priority.
+func (ts *TargetState) sourceDirs() []string {
+	if len(ts.SourceDirs) == 0 {
+		return []string{ts.SourceDir}
+	}
+	return ts.SourceDirs
+}
+
+// hasSymlinkedParent returns whether any parent directory of relPath, relative
+// to rootDir, is a symlink.
+func hasSymlinkedParent(fs vfs.FS, rootDir, relPath string) (bool, error) {
+	for dir := filepath.Dir(relPath); dir != "."; dir = filepath.Dir(dir) {
+		info, err := fs.Lstat(filepath.Join(rootDir, dir))
+		switch {
+		case os.IsNotExist(err):
+			return false, nil
+		case err != nil:
+			return false, err
+		case info.Mode()&os.ModeSymlink != 0:
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// hashSourceDir writes the paths, modes, and contents of the files in sourceDir
+// to w.
+func hashSourceDir(w io.Writer, fs vfs.FS, sourceDir string) error {
+	if err := vfs.Walk(fs, sourceDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Name() == ".git" && info.IsDir() {
+			return filepath.SkipDir
+		}
+		relPath, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\x00%o\x00", relPath, info.Mode())
+		switch {
+		case info.Mode().IsRegular():
+			// Copy the contents in chunks, as they may be too large to hold
+			// in memory.
+			f, err := fs.Open(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%d\x00", info.Size())
+			_, err = io.Copy(w, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		case info.Mode()&os.ModeType == os.ModeSymlink:
+			linkname, err := fs.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%s\x00", linkname)
+		}
+		return nil
+	}); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
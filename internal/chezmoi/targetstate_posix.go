@@ -4,6 +4,7 @@ package chezmoi
 
 import (
 	"archive/tar"
+	"os"
 	"os/user"
 	"strconv"
 	"time"
@@ -40,3 +41,10 @@ func (ts *TargetState) getTarHeaderTemplate() (*tar.Header, error) {
 		ChangeTime: now,
 	}, nil
 }
+
+// needsExplicitPerm returns whether perm differs from the permissions
+// attributesPerm that can be expressed with attributes once ts's umask is
+// applied, and so must be set explicitly.
+func (ts *TargetState) needsExplicitPerm(attributesPerm, perm os.FileMode) bool {
+	return attributesPerm&^ts.Umask != perm
+}
@@ -3,12 +3,15 @@ package chezmoi
 import (
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 	"text/template"
 
 	"github.com/coreos/go-semver/semver"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	vfs "github.com/twpayne/go-vfs"
 	"github.com/twpayne/go-vfs/vfst"
 )
 
@@ -488,3 +491,819 @@ func TestTargetStatePopulate(t *testing.T) {
 		})
 	}
 }
+
+func TestTargetStateEncryptedPrivate(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		encryptedPrivate bool
+		wantPerm         os.FileMode
+	}{
+		{
+			name:             "private",
+			encryptedPrivate: true,
+			wantPerm:         0o600,
+		},
+		{
+			name:             "not_private",
+			encryptedPrivate: false,
+			wantPerm:         0o666,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+				"/encrypted_foo": "ciphertext",
+			})
+			require.NoError(t, err)
+			defer cleanup()
+			ts := NewTargetState(
+				WithDestDir("/"),
+				WithEncryptedPrivate(tc.encryptedPrivate),
+				WithSourceDir("/"),
+			)
+			require.NoError(t, ts.Populate(fs, nil))
+			file, ok := ts.Entries["foo"].(*File)
+			require.True(t, ok)
+			assert.True(t, file.Encrypted)
+			assert.Equal(t, tc.wantPerm, file.Perm)
+		})
+	}
+}
+
+func TestTargetStateTemplateGlobs(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/dot_config": map[string]interface{}{
+			"tool.conf":        "email = {{ .email }}\n",
+			"other.conf":       "email = {{ .email }}\n",
+			"link_linked.conf": "{{ .email }}\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	ts := NewTargetState(
+		WithDestDir("/home/user"),
+		WithSourceDir("/"),
+		WithTemplateData(map[string]interface{}{
+			"email": "user@example.com",
+		}),
+		WithTemplateGlobs([]string{"dot_config/*.conf"}),
+	)
+	require.NoError(t, ts.Populate(fs, nil))
+
+	dir, ok := ts.Entries[".config"].(*Dir)
+	require.True(t, ok)
+	for _, name := range []string{"tool.conf", "other.conf"} {
+		file, ok := dir.Entries[name].(*File)
+		require.True(t, ok)
+		assert.True(t, file.Template)
+		contents, err := file.Contents()
+		require.NoError(t, err)
+		assert.Equal(t, []byte("email = user@example.com\n"), contents)
+	}
+	symlink, ok := dir.Entries["linked.conf"].(*Symlink)
+	require.True(t, ok)
+	linkname, err := symlink.Linkname()
+	require.NoError(t, err)
+	assert.Equal(t, "/dot_config/link_linked.conf", linkname)
+}
+
+func TestTargetStateScopedDirs(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_bashrc": "unscoped bashrc\n",
+			"dot_zshrc":  "unscoped zshrc\n",
+			"dot_vimrc":  "unscoped vimrc\n",
+			"host-laptop": map[string]interface{}{
+				"dot_zshrc": "laptop zshrc\n",
+				"dot_vimrc": "laptop vimrc\n",
+			},
+			"host-server": map[string]interface{}{
+				"dot_zshrc": "server zshrc\n",
+			},
+			"os-linux": map[string]interface{}{
+				"dot_vimrc":         "linux vimrc\n",
+				"dot_config/foo":    "linux foo\n",
+				"executable_dot_sh": "#!/bin/sh\n",
+			},
+			"os-darwin": map[string]interface{}{
+				"dot_bashrc": "darwin bashrc\n",
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	ts := NewTargetState(
+		WithDestDir("/home/user"),
+		WithSourceDir("/home/user/.local/share/chezmoi"),
+		WithTemplateData(map[string]interface{}{
+			"hostname": "laptop",
+			"os":       "linux",
+		}),
+		WithScopedDirRules([]ScopedDirRule{
+			{
+				Pattern:   "host-*",
+				Condition: `{{ eq .scopedDir (print "host-" .hostname) }}`,
+				Priority:  2,
+			},
+			{
+				Pattern:   "os-*",
+				Condition: `{{ eq .scopedDir (print "os-" .os) }}`,
+				Priority:  1,
+			},
+		}),
+	)
+	var problems []string
+	require.NoError(t, ts.Populate(fs, &PopulateOptions{
+		ExecuteTemplates: true,
+		ReportError: func(path string, line int, err error) {
+			problems = append(problems, path+": "+err.Error())
+		},
+	}))
+	assert.Empty(t, problems)
+
+	assert.Len(t, ts.Entries, 5)
+	for targetName, expected := range map[string]struct {
+		sourceName string
+		scopedDir  string
+		contents   string
+	}{
+		".bashrc": {sourceName: "dot_bashrc", contents: "unscoped bashrc\n"},
+		".zshrc":  {sourceName: "host-laptop/dot_zshrc", scopedDir: "host-laptop", contents: "laptop zshrc\n"},
+		".vimrc":  {sourceName: "host-laptop/dot_vimrc", scopedDir: "host-laptop", contents: "laptop vimrc\n"},
+		".sh":     {sourceName: "os-linux/executable_dot_sh", scopedDir: "os-linux", contents: "#!/bin/sh\n"},
+	} {
+		file, ok := ts.Entries[targetName].(*File)
+		require.True(t, ok, targetName)
+		assert.Equal(t, expected.sourceName, file.SourceName(), targetName)
+		assert.Equal(t, expected.scopedDir, ts.ScopedDir(file), targetName)
+		contents, err := file.Contents()
+		require.NoError(t, err)
+		assert.Equal(t, expected.contents, string(contents), targetName)
+	}
+	dir, ok := ts.Entries[".config"].(*Dir)
+	require.True(t, ok)
+	assert.Equal(t, "os-linux/dot_config", dir.SourceName())
+	assert.Equal(t, "os-linux/dot_config/foo", dir.Entries["foo"].SourceName())
+}
+
+func TestTargetStateNestedScopedDirs(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_zshrc": "unscoped zshrc\n",
+			"host-laptop": map[string]interface{}{
+				"dot_zshrc": "laptop zshrc\n",
+			},
+			"os-linux": map[string]interface{}{
+				"dot_vimrc": "linux vimrc\n",
+				"dot_zshrc": "linux zshrc\n",
+				"host-laptop": map[string]interface{}{
+					"dot_vimrc": "linux laptop vimrc\n",
+				},
+				"host-server": map[string]interface{}{
+					"dot_zshrc": "linux server zshrc\n",
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	ts := NewTargetState(
+		WithDestDir("/home/user"),
+		WithSourceDir("/home/user/.local/share/chezmoi"),
+		WithTemplateData(map[string]interface{}{
+			"hostname": "laptop",
+			"os":       "linux",
+		}),
+		WithScopedDirRules([]ScopedDirRule{
+			{
+				Pattern:   "host-*",
+				Condition: `{{ eq .scopedDir (print "host-" .hostname) }}`,
+			},
+			{
+				Pattern:   "os-*",
+				Condition: `{{ eq .scopedDir (print "os-" .os) }}`,
+			},
+		}),
+	)
+	require.NoError(t, ts.Populate(fs, nil))
+
+	assert.Len(t, ts.Entries, 2)
+	for targetName, expected := range map[string]struct {
+		sourceName string
+		scopedDir  string
+	}{
+		".vimrc": {sourceName: "os-linux/host-laptop/dot_vimrc", scopedDir: filepath.Join("os-linux", "host-laptop")},
+		".zshrc": {sourceName: "os-linux/dot_zshrc", scopedDir: "os-linux"},
+	} {
+		file, ok := ts.Entries[targetName].(*File)
+		require.True(t, ok, targetName)
+		assert.Equal(t, expected.sourceName, filepath.ToSlash(file.SourceName()), targetName)
+		assert.Equal(t, expected.scopedDir, ts.ScopedDir(file), targetName)
+	}
+}
+
+func TestTargetStatePopulateConcat(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"private_dot_ssh/concat_private_config": map[string]interface{}{
+				".keep":         "",
+				"10-base":       "Host *\n",
+				"20-work.tmpl":  "Host {{ .host }}\n",
+				"30-other-host": "Host other\n",
+			},
+			"concat_dot_profile": map[string]interface{}{
+				"00-env": "export FOO=bar\n",
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	ts := NewTargetState(
+		WithSourceDir("/home/user/.local/share/chezmoi"),
+		WithTemplateData(map[string]interface{}{
+			"host": "work",
+		}),
+	)
+	require.NoError(t, ts.Populate(fs, nil))
+
+	entry, err := ts.findEntry(".ssh/config")
+	require.NoError(t, err)
+	file, ok := entry.(*File)
+	require.True(t, ok)
+	assert.Equal(t, "private_dot_ssh/concat_private_config", file.SourceName())
+	assert.Equal(t, os.FileMode(0o600), file.Perm)
+	contents, err := file.Contents()
+	require.NoError(t, err)
+	assert.Equal(t, "Host *\nHost work\nHost other\n", string(contents))
+
+	file, ok = ts.Entries[".profile"].(*File)
+	require.True(t, ok)
+	assert.Equal(t, os.FileMode(0o666), file.Perm)
+	contents, err = file.Contents()
+	require.NoError(t, err)
+	assert.Equal(t, "export FOO=bar\n", string(contents))
+
+	require.NoError(t, fs.Mkdir("/home/user/.local/share/chezmoi/concat_exact_foo", 0o755))
+	require.Error(t, NewTargetState(WithSourceDir("/home/user/.local/share/chezmoi")).Populate(fs, nil))
+}
+
+func TestTargetStatePopulateTargetNames(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			".chezmoiignore":  ".config/nvim/ignored\n",
+			".chezmoiversion": "1.2.3\n",
+			"dot_bashrc":      "# contents of .bashrc\n",
+			"dot_config": map[string]interface{}{
+				"htop/htoprc": "# contents of htoprc\n",
+				"nvim": map[string]interface{}{
+					"init.vim": "\" contents of init.vim\n",
+					"ignored":  "",
+				},
+				"starship.toml": "",
+			},
+			"exact_dot_vim": map[string]interface{}{
+				"vimrc": "",
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	ts := NewTargetState(WithSourceDir("/home/user/.local/share/chezmoi"))
+	require.NoError(t, ts.Populate(fs, &PopulateOptions{
+		TargetNames: []string{".config/nvim"},
+	}))
+	var targetNames []string
+	for _, entry := range ts.AllEntries() {
+		targetNames = append(targetNames, entry.TargetName())
+	}
+	sort.Strings(targetNames)
+	assert.Equal(t, []string{".config", ".config/nvim", ".config/nvim/ignored", ".config/nvim/init.vim"}, targetNames)
+	assert.True(t, ts.TargetIgnore.Match(".config/nvim/ignored"))
+	assert.Equal(t, semver.Must(semver.NewVersion("1.2.3")), ts.MinVersion)
+}
+
+func TestTargetStatePopulateInvalidAttributes(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		root        interface{}
+		expectedErr string
+	}{
+		{
+			name: "file",
+			root: map[string]interface{}{
+				"perm_0600_private_foo": "",
+			},
+			expectedErr: "/home/user/.local/share/chezmoi/perm_0600_private_foo: invalid attributes, expected perm_0600_foo",
+		},
+		{
+			name: "three_digit_perm",
+			root: map[string]interface{}{
+				"perm_755_executable_foo": "",
+			},
+			expectedErr: "/home/user/.local/share/chezmoi/perm_755_executable_foo: invalid attributes, expected perm_0755_foo",
+		},
+		{
+			name: "dir",
+			root: map[string]interface{}{
+				"dot_config/perm_0700_private_foo": &vfst.Dir{Perm: 0o755},
+			},
+			expectedErr: "/home/user/.local/share/chezmoi/dot_config/perm_0700_private_foo: invalid attributes, expected perm_0700_foo",
+		},
+		{
+			name: "script",
+			root: map[string]interface{}{
+				"run_after_once_foo": "",
+			},
+			expectedErr: "/home/user/.local/share/chezmoi/run_after_once_foo: invalid attributes, expected run_once_after_foo",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+				"/home/user/.local/share/chezmoi": tc.root,
+			})
+			require.NoError(t, err)
+			defer cleanup()
+
+			ts := NewTargetState(WithSourceDir("/home/user/.local/share/chezmoi"))
+			assert.EqualError(t, ts.Populate(fs, nil), tc.expectedErr)
+		})
+	}
+}
+
+func TestTargetStateAddUnrepresentableName(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			".local/share/chezmoi": &vfst.Dir{Perm: 0o755},
+			"private_foo":          "# contents of private_foo\n",
+			"foo.tmpl":             "# contents of foo.tmpl\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	ts := NewTargetState(
+		WithDestDir("/home/user"),
+		WithSourceDir("/home/user/.local/share/chezmoi"),
+		WithUmask(0o22),
+	)
+	require.NoError(t, ts.Populate(fs, nil))
+	assert.EqualError(t, ts.Add(fs, AddOptions{}, "/home/user/private_foo", nil, false, NewFSMutator(fs)), "private_foo: cannot be added, source name private_foo would be parsed as foo")
+	assert.EqualError(t, ts.Add(fs, AddOptions{}, "/home/user/foo.tmpl", nil, false, NewFSMutator(fs)), "foo.tmpl: cannot be added, source name foo.tmpl would be parsed as foo")
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.local/share/chezmoi/private_foo",
+			vfst.TestDoesNotExist,
+		),
+		vfst.TestPath("/home/user/.local/share/chezmoi/foo.tmpl",
+			vfst.TestDoesNotExist,
+		),
+	)
+}
+
+func TestTargetStatePathMap(t *testing.T) {
+	appSupport := filepath.Join("Library", "Application Support")
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user": map[string]interface{}{
+			"Library/Application Support": &vfst.Dir{Perm: 0o755},
+			".config/unmanaged":           "# contents of unmanaged\n",
+		},
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			"dot_bashrc": "# contents of .bashrc\n",
+			"dot_config": map[string]interface{}{
+				"htop/htoprc": "# contents of htoprc\n",
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	newTargetState := func() *TargetState {
+		return NewTargetState(
+			WithDestDir("/home/user"),
+			WithSourceDir("/home/user/.local/share/chezmoi"),
+			WithPathMap(map[string]string{
+				".config": appSupport,
+			}),
+			WithUmask(0o22),
+		)
+	}
+
+	ts := newTargetState()
+	require.NoError(t, ts.Populate(fs, nil))
+	var targetNames []string
+	for _, entry := range ts.AllEntries() {
+		targetNames = append(targetNames, entry.TargetName())
+	}
+	sort.Strings(targetNames)
+	assert.Equal(t, []string{
+		".bashrc",
+		appSupport,
+		filepath.Join(appSupport, "htop"),
+		filepath.Join(appSupport, "htop", "htoprc"),
+	}, targetNames)
+
+	entry, err := ts.Get(fs, filepath.Join("/home/user", appSupport, "htop", "htoprc"))
+	require.NoError(t, err)
+	assert.Equal(t, "dot_config/htop/htoprc", entry.SourceName())
+	_, err = ts.Get(fs, "/home/user/.config/htop/htoprc")
+	assert.True(t, os.IsNotExist(err))
+
+	applyOptions := &ApplyOptions{
+		DestDir: ts.DestDir,
+		Ignore:  ts.TargetIgnore.Match,
+		Umask:   0o22,
+	}
+	require.NoError(t, ts.Apply(fs, NewFSMutator(fs), false, applyOptions))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath(filepath.Join("/home/user", appSupport, "htop", "htoprc"),
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("# contents of htoprc\n"),
+		),
+		vfst.TestPath("/home/user/.config/htop",
+			vfst.TestDoesNotExist,
+		),
+	)
+
+	require.NoError(t, fs.WriteFile(filepath.Join("/home/user", appSupport, "newfile"), []byte("# contents of newfile\n"), 0o644))
+	require.NoError(t, ts.Add(fs, AddOptions{}, filepath.Join("/home/user", appSupport, "newfile"), nil, false, NewFSMutator(fs)))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath("/home/user/.local/share/chezmoi/dot_config/newfile",
+			vfst.TestModeIsRegular,
+			vfst.TestContentsString("# contents of newfile\n"),
+		),
+	)
+	entry, err = ts.Get(fs, filepath.Join("/home/user", appSupport, "newfile"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(appSupport, "newfile"), entry.TargetName())
+	assert.Error(t, ts.Add(fs, AddOptions{}, "/home/user/.config/unmanaged", nil, false, NewFSMutator(fs)))
+
+	require.NoError(t, vfs.MkdirAll(fs, "/home/user/.local/share/chezmoi/Library/Application Support/htop", 0o755))
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/Library/Application Support/htop/htoprc", nil, 0o644))
+	assert.Error(t, newTargetState().Populate(fs, nil))
+	var problems []string
+	assert.NoError(t, newTargetState().Populate(fs, &PopulateOptions{
+		ReportError: func(path string, line int, err error) {
+			problems = append(problems, err.Error())
+		},
+	}))
+	assert.Equal(t, []string{
+		appSupport + ": target of both Library/Application Support and dot_config",
+		filepath.Join(appSupport, "htop") + ": target of both Library/Application Support/htop and dot_config/htop",
+		filepath.Join(appSupport, "htop", "htoprc") + ": target of both Library/Application Support/htop/htoprc and dot_config/htop/htoprc",
+	}, problems)
+}
+
+func TestTargetStatePathMapIgnore(t *testing.T) {
+	appSupport := filepath.Join("Library", "Application Support")
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/Library": &vfst.Dir{Perm: 0o755},
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			".chezmoiignore": ".config/ignored\n",
+			"dot_config": map[string]interface{}{
+				"ignored": "# contents of ignored\n",
+				"htoprc":  "# contents of htoprc\n",
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	ts := NewTargetState(
+		WithDestDir("/home/user"),
+		WithSourceDir("/home/user/.local/share/chezmoi"),
+		WithPathMap(map[string]string{
+			".config": appSupport,
+		}),
+		WithUmask(0o22),
+	)
+	require.NoError(t, ts.Populate(fs, nil))
+	assert.True(t, ts.TargetIgnore.Match(filepath.Join(appSupport, "ignored")))
+	assert.False(t, ts.TargetIgnore.Match(filepath.Join(appSupport, "htoprc")))
+
+	applyOptions := &ApplyOptions{
+		DestDir: ts.DestDir,
+		Ignore:  ts.TargetIgnore.Match,
+		Umask:   0o22,
+	}
+	require.NoError(t, ts.Apply(fs, NewFSMutator(fs), false, applyOptions))
+	vfst.RunTests(t, fs, "",
+		vfst.TestPath(filepath.Join("/home/user", appSupport, "htoprc"),
+			vfst.TestModeIsRegular,
+		),
+		vfst.TestPath(filepath.Join("/home/user", appSupport, "ignored"),
+			vfst.TestDoesNotExist,
+		),
+	)
+}
+
+func TestTargetStateHash(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			".git/HEAD": "ref: refs/heads/master\n",
+			"dot_foo":   "foo",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	newTargetState := func(data map[string]interface{}) *TargetState {
+		return NewTargetState(
+			WithSourceDir("/home/user/.local/share/chezmoi"),
+			WithTemplateData(data),
+		)
+	}
+
+	hash, err := newTargetState(nil).Hash(fs)
+	require.NoError(t, err)
+
+	sameHash, err := newTargetState(nil).Hash(fs)
+	require.NoError(t, err)
+	assert.Equal(t, hash, sameHash)
+
+	dataHash, err := newTargetState(map[string]interface{}{"foo": "bar"}).Hash(fs)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, dataHash)
+
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/.git/HEAD", []byte("ref: refs/heads/main\n"), 0o644))
+	gitHash, err := newTargetState(nil).Hash(fs)
+	require.NoError(t, err)
+	assert.Equal(t, hash, gitHash)
+
+	require.NoError(t, fs.WriteFile("/home/user/.local/share/chezmoi/dot_foo", []byte("bar"), 0o644))
+	sourceHash, err := newTargetState(nil).Hash(fs)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, sourceHash)
+}
+
+func TestTargetStatePopulateSourceDirs(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/public": map[string]interface{}{
+			".chezmoiignore": "ignored\n",
+			"dot_bashrc":     "# public\n",
+			"dot_config": map[string]interface{}{
+				"git":  "# public\n",
+				"htop": "# public\n",
+			},
+			"dot_profile": "# public\n",
+			"ignored":     "",
+		},
+		"/home/user/work": map[string]interface{}{
+			"private_dot_config": map[string]interface{}{
+				"git": "# work\n",
+			},
+			"dot_profile": "# work\n",
+			"ignored":     "",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	ts := NewTargetState(
+		WithDestDir("/home/user"),
+		WithSourceDir("/home/user/work"),
+		WithSourceDirs([]string{"/home/user/public", "/home/user/work"}),
+	)
+	require.NoError(t, ts.Populate(fs, nil))
+	require.NoError(t, ts.Evaluate())
+
+	for _, tc := range []struct {
+		targetName         string
+		expectedSourcePath string
+		expectedContents   string
+	}{
+		{
+			targetName:         ".bashrc",
+			expectedSourcePath: "/home/user/public/dot_bashrc",
+			expectedContents:   "# public\n",
+		},
+		{
+			targetName:         ".config/git",
+			expectedSourcePath: "/home/user/work/private_dot_config/git",
+			expectedContents:   "# work\n",
+		},
+		{
+			targetName:         ".config/htop",
+			expectedSourcePath: "/home/user/public/dot_config/htop",
+			expectedContents:   "# public\n",
+		},
+		{
+			targetName:         ".profile",
+			expectedSourcePath: "/home/user/work/dot_profile",
+			expectedContents:   "# work\n",
+		},
+	} {
+		t.Run(tc.targetName, func(t *testing.T) {
+			entry, err := ts.findEntry(tc.targetName)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedSourcePath, ts.SourcePath(entry))
+			file, ok := entry.(*File)
+			require.True(t, ok)
+			contents, err := file.Contents()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedContents, string(contents))
+		})
+	}
+
+	dir, err := ts.findEntry(".config")
+	require.NoError(t, err)
+	assert.Equal(t, "/home/user/work", ts.EntrySourceDir(dir))
+	assert.Equal(t, os.FileMode(0o700), dir.(*Dir).Perm)
+	assert.True(t, ts.TargetIgnore.Match("ignored"))
+}
+
+func TestTargetStateIncludeTemplate(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/public/.chezmoitemplates": map[string]interface{}{
+			"greeting":  "Hello {{ . }}",
+			"recursive": `{{ includeTemplate "recursive" }}`,
+			"user":      "public",
+		},
+		"/home/user/work/.chezmoitemplates": map[string]interface{}{
+			"shell/aliases": "{{ .shell }}",
+			"user":          "work",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	ts := NewTargetState(
+		WithDestDir("/home/user"),
+		WithSourceDir("/home/user/work"),
+		WithSourceDirs([]string{"/home/user/public", "/home/user/work"}),
+		WithTemplateData(map[string]interface{}{
+			"shell": "zsh",
+		}),
+	)
+	require.NoError(t, ts.Populate(fs, nil))
+
+	for _, tc := range []struct {
+		name          string
+		data          string
+		expected      string
+		expectedError bool
+	}{
+		{
+			name:     "data",
+			data:     `{{ includeTemplate "greeting" "world" }}`,
+			expected: "Hello world",
+		},
+		{
+			name:     "default_data",
+			data:     `{{ includeTemplate "shell/aliases" }}`,
+			expected: "zsh",
+		},
+		{
+			name:     "override",
+			data:     `{{ includeTemplate "user" }}`,
+			expected: "work",
+		},
+		{
+			name:          "too_many_arguments",
+			data:          `{{ includeTemplate "greeting" "a" "b" }}`,
+			expectedError: true,
+		},
+		{
+			name:          "not_defined",
+			data:          `{{ includeTemplate "missing" }}`,
+			expectedError: true,
+		},
+		{
+			name:          "recursive",
+			data:          `{{ includeTemplate "recursive" }}`,
+			expectedError: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := ts.ExecuteTemplateData(tc.name, []byte(tc.data))
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(actual))
+		})
+	}
+}
+
+func TestTargetStatePopulateDependencies(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		root        interface{}
+		expectedErr string
+	}{
+		{
+			name: "cycle",
+			root: map[string]interface{}{
+				".chezmoidependencies": "a: b\nb: c # comment\nc: a\n",
+			},
+			expectedErr: "/home/user/.local/share/chezmoi/.chezmoidependencies: dependency cycle: a -> b -> c -> a",
+		},
+		{
+			name: "self",
+			root: map[string]interface{}{
+				".chezmoidependencies": "a: a\n",
+			},
+			expectedErr: "/home/user/.local/share/chezmoi/.chezmoidependencies: dependency cycle: a -> a",
+		},
+		{
+			name: "subdir",
+			root: map[string]interface{}{
+				".chezmoidependencies": ".config/a: .config/b\n",
+				"dot_config": map[string]interface{}{
+					".chezmoidependencies": "b: a\n",
+				},
+			},
+			expectedErr: "/home/user/.local/share/chezmoi/.chezmoidependencies: dependency cycle: .config/a -> .config/b -> .config/a",
+		},
+		{
+			name: "contains",
+			root: map[string]interface{}{
+				".chezmoidependencies": ".config: .config/a\n",
+			},
+			expectedErr: "/home/user/.local/share/chezmoi/.chezmoidependencies: .config: depends on .config/a, which it contains",
+		},
+		{
+			name: "missing_colon",
+			root: map[string]interface{}{
+				".chezmoidependencies": "\na b\n",
+			},
+			expectedErr: "/home/user/.local/share/chezmoi/.chezmoidependencies:2: a b: missing colon",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+				"/home/user/.local/share/chezmoi": tc.root,
+			})
+			require.NoError(t, err)
+			defer cleanup()
+
+			ts := NewTargetState(WithSourceDir("/home/user/.local/share/chezmoi"))
+			assert.EqualError(t, ts.Populate(fs, nil), tc.expectedErr)
+		})
+	}
+}
+
+func TestTargetStateApplyDependencies(t *testing.T) {
+	fs, cleanup, err := vfst.NewTestFS(map[string]interface{}{
+		"/home/user/.local/share/chezmoi": map[string]interface{}{
+			".chezmoidependencies": strings.Join([]string{
+				"# .bashrc sources the plugins",
+				".bashrc: install-plugins.sh",
+				"install-plugins.sh: install-asdf.sh .tool-versions",
+				"install-asdf.sh: .config/asdf/asdfrc",
+				"unknown: .bashrc",
+			}, "\n"),
+			"dot_bashrc":             "# contents of .bashrc\n",
+			"dot_config/asdf/asdfrc": "# contents of .config/asdf/asdfrc\n",
+			"dot_tool-versions":      "# contents of .tool-versions\n",
+			"run_install-asdf.sh":    "#!/bin/sh\n",
+			"run_install-plugins.sh": "#!/bin/sh\n",
+		},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	ts := NewTargetState(
+		WithDestDir("/home/user"),
+		WithSourceDir("/home/user/.local/share/chezmoi"),
+		WithUmask(0o22),
+	)
+	require.NoError(t, ts.Populate(fs, nil))
+
+	var completed []string
+	var stdout strings.Builder
+	applyOptions := &ApplyOptions{
+		Completed: func(targetName string) error {
+			completed = append(completed, targetName)
+			return nil
+		},
+		DestDir: ts.DestDir,
+		DryRun:  true,
+		Ignore:  ts.TargetIgnore.Match,
+		Stdout:  &stdout,
+		Umask:   0o22,
+		Verbose: true,
+	}
+	require.NoError(t, ts.Apply(fs, NullMutator{}, false, applyOptions))
+	assert.Equal(t, []string{
+		".tool-versions",
+		filepath.Join(".config", "asdf", "asdfrc"),
+		"install-asdf.sh",
+		"install-plugins.sh",
+		".bashrc",
+		filepath.Join(".config", "asdf"),
+		".config",
+	}, completed)
+	assert.Equal(t, strings.Join([]string{
+		"applying in dependency order:",
+		"  .tool-versions",
+		"  " + filepath.Join(".config", "asdf", "asdfrc"),
+		"  install-asdf.sh",
+		"  install-plugins.sh",
+		"  .bashrc",
+		"would run script run_install-asdf.sh",
+		"#!/bin/sh",
+		"would run script run_install-plugins.sh",
+		"#!/bin/sh",
+		"",
+	}, "\n"), stdout.String())
+}
@@ -4,6 +4,7 @@ package chezmoi
 
 import (
 	"archive/tar"
+	"os"
 	"os/user"
 	"time"
 )
@@ -23,3 +24,9 @@ func (ts *TargetState) getTarHeaderTemplate() (*tar.Header, error) {
 		ChangeTime: now,
 	}, nil
 }
+
+// needsExplicitPerm always returns false on Windows, where permissions are not
+// managed.
+func (ts *TargetState) needsExplicitPerm(attributesPerm, perm os.FileMode) bool {
+	return false
+}
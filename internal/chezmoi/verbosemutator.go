@@ -36,7 +36,7 @@ func NewVerboseMutator(w io.Writer, m Mutator, colored bool, maxDiffDataSize int
 
 // Chmod implements Mutator.Chmod.
 func (m *VerboseMutator) Chmod(name string, mode os.FileMode) error {
-	action := fmt.Sprintf("chmod %o %s", mode, MaybeShellQuote(name))
+	action := fmt.Sprintf("chmod %o %s", fileModeToUnixPerm(mode), MaybeShellQuote(name))
 	err := m.m.Chmod(name, mode)
 	if err == nil {
 		_, _ = fmt.Fprintln(m.w, action)
@@ -56,9 +56,21 @@ func (m *VerboseMutator) IdempotentCmdOutput(cmd *exec.Cmd) ([]byte, error) {
 	return output, err
 }
 
+// Lchown implements Mutator.Lchown.
+func (m *VerboseMutator) Lchown(name string, uid, gid int) error {
+	action := fmt.Sprintf("chown -h %d:%d %s", uid, gid, MaybeShellQuote(name))
+	err := m.m.Lchown(name, uid, gid)
+	if err == nil {
+		_, _ = fmt.Fprintln(m.w, action)
+	} else {
+		_, _ = fmt.Fprintf(m.w, "%s: %v\n", action, err)
+	}
+	return err
+}
+
 // Mkdir implements Mutator.Mkdir.
 func (m *VerboseMutator) Mkdir(name string, perm os.FileMode) error {
-	action := fmt.Sprintf("mkdir -m %o %s", perm, MaybeShellQuote(name))
+	action := fmt.Sprintf("mkdir -m %o %s", fileModeToUnixPerm(perm), MaybeShellQuote(name))
 	err := m.m.Mkdir(name, perm)
 	if err == nil {
 		_, _ = fmt.Fprintln(m.w, action)
@@ -111,7 +123,7 @@ func (m *VerboseMutator) Stat(name string) (os.FileInfo, error) {
 
 // WriteFile implements Mutator.WriteFile.
 func (m *VerboseMutator) WriteFile(name string, data []byte, perm os.FileMode, currData []byte) error {
-	action := fmt.Sprintf("install -m %o /dev/null %s", perm, MaybeShellQuote(name))
+	action := fmt.Sprintf("install -m %o /dev/null %s", fileModeToUnixPerm(perm), MaybeShellQuote(name))
 	err := m.m.WriteFile(name, data, perm, currData)
 	if err == nil {
 		_, _ = fmt.Fprintln(m.w, action)
@@ -153,6 +165,19 @@ func (m *VerboseMutator) WriteFile(name string, data []byte, perm os.FileMode, c
 	return err
 }
 
+// WriteFileFrom implements Mutator.WriteFileFrom. Diffs are never printed, as
+// the file is too large to hold in memory.
+func (m *VerboseMutator) WriteFileFrom(name string, r io.Reader, size int64, perm os.FileMode) error {
+	action := fmt.Sprintf("install -m %o /dev/null %s", fileModeToUnixPerm(perm), MaybeShellQuote(name))
+	err := m.m.WriteFileFrom(name, r, size, perm)
+	if err == nil {
+		_, _ = fmt.Fprintln(m.w, action)
+	} else {
+		_, _ = fmt.Fprintf(m.w, "%s: %v\n", action, err)
+	}
+	return err
+}
+
 // WriteSymlink implements Mutator.WriteSymlink.
 func (m *VerboseMutator) WriteSymlink(oldname, newname string) error {
 	action := fmt.Sprintf("ln -sf %s %s", MaybeShellQuote(oldname), MaybeShellQuote(newname))